@@ -25,9 +25,11 @@ import (
 
 	"github.com/CanonicalLtd/serial-vault/config"
 	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/retention"
 	"github.com/CanonicalLtd/serial-vault/service"
 	svlog "github.com/CanonicalLtd/serial-vault/service/log"
 	"github.com/CanonicalLtd/serial-vault/service/sentry"
+	"github.com/CanonicalLtd/serial-vault/webhook"
 	logging "github.com/op/go-logging"
 )
 
@@ -60,6 +62,15 @@ func main() {
 		svlog.Fatalf("Error initializing the signing-key database: %v", err)
 	}
 
+	// Start the promotion of the key rotations that are due
+	datastore.StartKeyRotations()
+
+	// Start the delivery of the webhook events
+	webhook.Start(datastore.Environ.Config)
+
+	// Start the archive of the signing logs that are older than the retention
+	retention.Start(datastore.Environ.Config)
+
 	var handler http.Handler
 	var port string
 
@@ -72,6 +83,12 @@ func main() {
 			port = "8081"
 		}
 	default:
+		// Open the nonce store for the serial requests
+		err = datastore.OpenNonceStore(datastore.Environ.Config)
+		if err != nil {
+			svlog.Fatalf("Error initializing the nonce store: %v", err)
+		}
+
 		// Create the user web service router
 		handler = service.SigningRouter()
 		port = datastore.Environ.Config.PortSigning
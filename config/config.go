@@ -37,28 +37,71 @@ var revision = "unknown"
 
 // Settings defines the parsed config file settings.
 type Settings struct {
-	Version        string
-	Revision       string
-	Title          string `yaml:"title"`
-	Logo           string `yaml:"logo"`
-	DocRoot        string `yaml:"docRoot"`
-	Driver         string `yaml:"driver"`
-	DataSource     string `yaml:"datasource"`
-	KeyStoreType   string `yaml:"keystore"`
-	KeyStorePath   string `yaml:"keystorePath"`
-	KeyStoreSecret string `yaml:"keystoreSecret"`
-	Mode           string `yaml:"mode"`
-	CSRFAuthKey    string `yaml:"csrfAuthKey"`
-	URLHost        string `yaml:"urlHost"`
-	PortAdmin      string `yaml:"portAdmin"`
-	PortSigning    string `yaml:"portSigning"`
-	URLScheme      string `yaml:"urlScheme"`
-	EnableUserAuth bool   `yaml:"enableUserAuth"`
-	JwtSecret      string `yaml:"jwtSecret"`
-	SyncURL        string `yaml:"syncUrl"`
-	SyncUser       string `yaml:"syncUser"`
-	SyncAPIKey     string `yaml:"syncAPIKey"`
-	SentryDSN      string `yaml:"sentryDSN"`
+	Version         string
+	Revision        string
+	Title           string `yaml:"title"`
+	Logo            string `yaml:"logo"`
+	DocRoot         string `yaml:"docRoot"`
+	Driver          string `yaml:"driver"`
+	DataSource      string `yaml:"datasource"`
+	KeyStoreType    string `yaml:"keystore"`
+	KeyStorePath    string `yaml:"keystorePath"`
+	KeyStoreSecret  string `yaml:"keystoreSecret"`
+	PKCS11Module    string `yaml:"pkcs11Module"`
+	PKCS11Token     string `yaml:"pkcs11Token"`
+	NonceStore      string `yaml:"nonceStore"`
+	NonceMaximumAge int    `yaml:"nonceMaximumAge"`
+	Mode            string `yaml:"mode"`
+	CSRFAuthKey     string `yaml:"csrfAuthKey"`
+	URLHost         string `yaml:"urlHost"`
+	PortAdmin       string `yaml:"portAdmin"`
+	PortSigning     string `yaml:"portSigning"`
+	URLScheme       string `yaml:"urlScheme"`
+	EnableUserAuth  bool   `yaml:"enableUserAuth"`
+	JwtSecret       string `yaml:"jwtSecret"`
+	SyncURL         string `yaml:"syncUrl"`
+	SyncUser        string `yaml:"syncUser"`
+	SyncAPIKey      string `yaml:"syncAPIKey"`
+	SentryDSN       string `yaml:"sentryDSN"`
+
+	// Addresses or CIDR ranges of the proxies in front of the service, which are trusted to set the
+	// X-Forwarded-For header
+	TrustedProxies []string `yaml:"trustedProxies"`
+
+	// Login provider: "usso" (default) for Ubuntu SSO or "oidc" for an OpenID Connect provider
+	AuthProvider      string `yaml:"authProvider"`
+	OIDCIssuer        string `yaml:"oidcIssuer"`
+	OIDCClientID      string `yaml:"oidcClientID"`
+	OIDCClientSecret  string `yaml:"oidcClientSecret"`
+	OIDCScopes        string `yaml:"oidcScopes"`
+	OIDCUsernameClaim string `yaml:"oidcUsernameClaim"`
+	OIDCGroupsClaim   string `yaml:"oidcGroupsClaim"`
+
+	// Role mappings from the teams or groups of the login provider, and the hours that the API key
+	// and personal access tokens of a provisioned user are valid for after the user's last login
+	RoleMappings      []RoleMapping `yaml:"roleMappings"`
+	ProvisionedExpiry int           `yaml:"provisionedExpiry"`
+
+	// Delivery of the webhook events: the seconds between checks of the queue, and the number of
+	// attempts before a delivery fails
+	WebhookInterval    int `yaml:"webhookInterval"`
+	WebhookMaxAttempts int `yaml:"webhookMaxAttempts"`
+
+	// Retention of the signing log: the months that a log is kept before it is archived (0 keeps
+	// the logs), and the directory for the compressed archive files (the archive table is used when
+	// it is not set)
+	SigningLogRetention  int    `yaml:"signingLogRetention"`
+	SigningLogArchiveDir string `yaml:"signingLogArchiveDir"`
+
+	// Base64 encoded seed of the Ed25519 key that signs the revocation lists of the models
+	RevocationSigningKey string `yaml:"revocationSigningKey"`
+}
+
+// RoleMapping maps a team or group of the login provider to a role and a set of accounts
+type RoleMapping struct {
+	Group    string   `yaml:"group"`
+	Role     string   `yaml:"role"`
+	Accounts []string `yaml:"accounts"`
 }
 
 // SettingsFile is the path to the YAML configuration file
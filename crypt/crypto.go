@@ -23,6 +23,7 @@ import (
 	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"encoding/base64"
@@ -35,6 +36,7 @@ import (
 	"github.com/snapcore/snapd/asserts"
 	"golang.org/x/crypto/openpgp/armor"
 	"golang.org/x/crypto/openpgp/packet"
+	"golang.org/x/crypto/scrypt"
 )
 
 // GenerateAuthKey generates an key from the signing key details
@@ -52,34 +54,142 @@ func CreateSecret(length int) (string, error) {
 	return base64.URLEncoding.EncodeToString(rb), nil
 }
 
-// EncryptKey uses symmetric encryption to encrypt the data for storage
+// CreateEd25519Key generates an Ed25519 signing key. The base64 encoded seed of the private key
+// and the base64 encoded public key are returned
+func CreateEd25519Key() (string, string, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(private.Seed()), base64.StdEncoding.EncodeToString(public), nil
+}
+
+// SignEd25519 signs the data with the Ed25519 key from the base64 encoded seed, and returns the
+// base64 encoded signature
+func SignEd25519(base64Seed string, data []byte) (string, error) {
+	seed, err := base64.StdEncoding.DecodeString(base64Seed)
+	if err != nil {
+		return "", err
+	}
+	if len(seed) != ed25519.SeedSize {
+		return "", errors.New("Invalid Ed25519 key seed")
+	}
+
+	signature := ed25519.Sign(ed25519.NewKeyFromSeed(seed), data)
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// Sealed-key format versions
+const (
+	SealedKeyLegacy = 1 // AES-CFB, with the key text padded to 32 bytes
+	SealedKeyV2     = 2 // AES-GCM, with the key derived from the key text using scrypt
+)
+
+// Parameters for the sealed-key format
+const (
+	saltLength = 16
+	scryptN    = 32768
+	scryptR    = 8
+	scryptP    = 1
+)
+
+// sealedKeyV2Prefix identifies the version 2 sealed-key format
+var sealedKeyV2Prefix = []byte("sv2:")
+
+// Common error messages.
+var (
+	ErrorDecryptKey = errors.New("Cannot decrypt the sealed key: the secret is wrong or the data has been modified")
+)
+
+// SealedKeyVersion returns the format version of a sealed key
+func SealedKeyVersion(sealedKey []byte) int {
+	if bytes.HasPrefix(sealedKey, sealedKeyV2Prefix) {
+		return SealedKeyV2
+	}
+	return SealedKeyLegacy
+}
+
+// EncryptKey uses authenticated symmetric encryption to encrypt the data for storage.
+// The sealed key is made up of the version prefix, the salt for the key derivation,
+// the GCM nonce and the cipher text
 func EncryptKey(plainTextKey, keyText string) ([]byte, error) {
-	// The AES key needs to be 16 or 32 bytes i.e. AES-128 or AES-256
-	aesKey := padRight(keyText, "x", 32)
+	salt := make([]byte, saltLength)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		log.Printf("Error creating the salt for the cipher: %v", err)
+		return nil, err
+	}
 
-	block, err := aes.NewCipher([]byte(aesKey))
+	aead, err := newGCM(keyText, salt)
 	if err != nil {
-		log.Printf("Error creating the cipher block: %v", err)
 		return nil, err
 	}
 
-	// The IV needs to be unique, but not secure. Including it at the start of the plaintext
-	ciphertext := make([]byte, aes.BlockSize+len(plainTextKey))
-	iv := ciphertext[:aes.BlockSize]
-	if _, err = io.ReadFull(rand.Reader, iv); err != nil {
-		log.Printf("Error creating the IV for the cipher: %v", err)
+	// The nonce needs to be unique, but not secure. Including it at the start of the cipher text
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		log.Printf("Error creating the nonce for the cipher: %v", err)
 		return nil, err
 	}
 
-	// Use CFB mode for the encryption
-	cfb := cipher.NewCFBEncrypter(block, iv)
-	cfb.XORKeyStream(ciphertext[aes.BlockSize:], []byte(plainTextKey))
+	sealedKey := make([]byte, 0, len(sealedKeyV2Prefix)+saltLength+len(nonce)+len(plainTextKey)+aead.Overhead())
+	sealedKey = append(sealedKey, sealedKeyV2Prefix...)
+	sealedKey = append(sealedKey, salt...)
+	sealedKey = append(sealedKey, nonce...)
 
-	return ciphertext, nil
+	// The version prefix and salt are authenticated with the cipher text
+	return aead.Seal(sealedKey, nonce, []byte(plainTextKey), sealedKey), nil
 }
 
-// DecryptKey handles the decryption of a sealed signing key
+// DecryptKey handles the decryption of a sealed signing key. Keys that were sealed
+// using the legacy format can still be decrypted, so they can be migrated
 func DecryptKey(sealedKey []byte, keyText string) ([]byte, error) {
+	if SealedKeyVersion(sealedKey) == SealedKeyLegacy {
+		return decryptKeyLegacy(sealedKey, keyText)
+	}
+
+	headerLength := len(sealedKeyV2Prefix) + saltLength
+	if len(sealedKey) < headerLength {
+		return nil, errors.New("Cipher text too short")
+	}
+	salt := sealedKey[len(sealedKeyV2Prefix):headerLength]
+
+	aead, err := newGCM(keyText, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealedKey) < headerLength+aead.NonceSize() {
+		return nil, errors.New("Cipher text too short")
+	}
+	nonce := sealedKey[headerLength : headerLength+aead.NonceSize()]
+	cipherText := sealedKey[headerLength+aead.NonceSize():]
+
+	plainText, err := aead.Open(nil, nonce, cipherText, sealedKey[:headerLength+aead.NonceSize()])
+	if err != nil {
+		return nil, ErrorDecryptKey
+	}
+	return plainText, nil
+}
+
+// newGCM derives the AES-256 key from the key text and creates the GCM cipher
+func newGCM(keyText string, salt []byte) (cipher.AEAD, error) {
+	aesKey, err := scrypt.Key([]byte(keyText), salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		log.Printf("Error deriving the encryption key: %v", err)
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		log.Printf("Error creating the cipher block: %v", err)
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// decryptKeyLegacy handles the decryption of a signing key that was sealed with AES-CFB
+func decryptKeyLegacy(sealedKey []byte, keyText string) ([]byte, error) {
 	aesKey := padRight(keyText, "x", 32)
 
 	block, err := aes.NewCipher([]byte(aesKey))
@@ -93,13 +203,14 @@ func DecryptKey(sealedKey []byte, keyText string) ([]byte, error) {
 	}
 
 	iv := sealedKey[:aes.BlockSize]
-	sealedKey = sealedKey[aes.BlockSize:]
+	cipherText := sealedKey[aes.BlockSize:]
+	plainText := make([]byte, len(cipherText))
 
 	// Use CFB mode for the decryption
 	cfb := cipher.NewCFBDecrypter(block, iv)
-	cfb.XORKeyStream(sealedKey, sealedKey)
+	cfb.XORKeyStream(plainText, cipherText)
 
-	return sealedKey, nil
+	return plainText, nil
 }
 
 // DeserializePrivateKey decodes a base64 encoded private key file and converts
@@ -114,7 +225,27 @@ func DeserializePrivateKey(base64PrivateKey string) (asserts.PrivateKey, string,
 	return privateKeyToAssertsKey(decodedPrivateKey)
 }
 
+// DeserializeRSAPrivateKey decodes a base64 encoded private key file and converts
+// it to an RSA private key, so it can be imported into an external key store
+func DeserializeRSAPrivateKey(base64PrivateKey string) (*rsa.PrivateKey, string, error) {
+	// The private-key is base64 encoded, so we need to decode it
+	decodedPrivateKey, err := base64.StdEncoding.DecodeString(base64PrivateKey)
+	if err != nil {
+		return nil, "error-decode-key", err
+	}
+
+	return privateKeyToRSAKey(decodedPrivateKey)
+}
+
 func privateKeyToAssertsKey(key []byte) (asserts.PrivateKey, string, error) {
+	rsaKey, errorCode, err := privateKeyToRSAKey(key)
+	if err != nil {
+		return nil, errorCode, err
+	}
+	return asserts.RSAPrivateKey(rsaKey), "", nil
+}
+
+func privateKeyToRSAKey(key []byte) (*rsa.PrivateKey, string, error) {
 	const errorInvalidKey = "invalid-keypair"
 
 	// Validate the signing-key
@@ -132,10 +263,11 @@ func privateKeyToAssertsKey(key []byte) (asserts.PrivateKey, string, error) {
 	if !ok {
 		return nil, errorInvalidKey, errors.New("Not a private key")
 	}
-	if _, ok := privk.PrivateKey.(*rsa.PrivateKey); !ok {
+	rsaKey, ok := privk.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
 		return nil, errorInvalidKey, errors.New("Not an RSA private key")
 	}
-	return asserts.RSAPrivateKey(privk.PrivateKey.(*rsa.PrivateKey)), "", nil
+	return rsaKey, "", nil
 }
 
 // padRight truncates a string to a specific length, padding with a named
@@ -20,11 +20,27 @@
 package crypt
 
 import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
 	"encoding/base64"
 	"io/ioutil"
 	"testing"
 )
 
+// legacyEncryptKey seals the data using the legacy AES-CFB format
+func legacyEncryptKey(plainTextKey, keyText string) []byte {
+	block, _ := aes.NewCipher([]byte(padRight(keyText, "x", 32)))
+	ciphertext := make([]byte, aes.BlockSize+len(plainTextKey))
+	iv := ciphertext[:aes.BlockSize]
+	rand.Read(iv)
+	cfb := cipher.NewCFBEncrypter(block, iv)
+	cfb.XORKeyStream(ciphertext[aes.BlockSize:], []byte(plainTextKey))
+	return ciphertext
+}
+
 func TestEncryptDecrypt(t *testing.T) {
 
 	plainText := "fake-hmac-ed-data"
@@ -46,6 +62,68 @@ func TestEncryptDecrypt(t *testing.T) {
 	}
 }
 
+func TestEncryptVersion(t *testing.T) {
+	cipherText, err := EncryptKey("fake-hmac-ed-data", "secret")
+	if err != nil {
+		t.Fatalf("Error encrypting text: %v", err)
+	}
+	if SealedKeyVersion(cipherText) != SealedKeyV2 {
+		t.Errorf("Expected version %d, got: %d", SealedKeyV2, SealedKeyVersion(cipherText))
+	}
+
+	// The same data is sealed differently each time
+	cipherTextAgain, _ := EncryptKey("fake-hmac-ed-data", "secret")
+	if bytes.Equal(cipherText, cipherTextAgain) {
+		t.Error("Expected a unique salt and nonce for each encryption")
+	}
+}
+
+func TestDecryptWrongSecret(t *testing.T) {
+	cipherText, err := EncryptKey("fake-hmac-ed-data", "this needs to be 32 bytes long!!")
+	if err != nil {
+		t.Fatalf("Error encrypting text: %v", err)
+	}
+
+	_, err = DecryptKey(cipherText, "this is not the right secret")
+	if err != ErrorDecryptKey {
+		t.Errorf("Expected decrypt error, got: %v", err)
+	}
+}
+
+func TestDecryptTampered(t *testing.T) {
+	cipherText, err := EncryptKey("fake-hmac-ed-data", "secret")
+	if err != nil {
+		t.Fatalf("Error encrypting text: %v", err)
+	}
+
+	for _, i := range []int{len(sealedKeyV2Prefix), len(cipherText) - 1} {
+		tampered := append([]byte{}, cipherText...)
+		tampered[i] ^= 0xff
+		if _, err = DecryptKey(tampered, "secret"); err != ErrorDecryptKey {
+			t.Errorf("Expected decrypt error for tampered byte %d, got: %v", i, err)
+		}
+	}
+
+	if _, err = DecryptKey(cipherText[:10], "secret"); err == nil {
+		t.Error("Expected error for short cipher text, got success")
+	}
+}
+
+func TestDecryptLegacy(t *testing.T) {
+	cipherText := legacyEncryptKey("fake-hmac-ed-data", "secret")
+	if SealedKeyVersion(cipherText) != SealedKeyLegacy {
+		t.Errorf("Expected version %d, got: %d", SealedKeyLegacy, SealedKeyVersion(cipherText))
+	}
+
+	plainText, err := DecryptKey(cipherText, "secret")
+	if err != nil {
+		t.Errorf("Error decrypting text: %v", err)
+	}
+	if string(plainText) != "fake-hmac-ed-data" {
+		t.Error("Invalid decryption")
+	}
+}
+
 func TestCreateSecretCLibCryptUser(t *testing.T) {
 	secret, err := CreateSecret(16)
 	if err != nil {
@@ -68,6 +146,28 @@ func TestGenerateAuthKey(t *testing.T) {
 	}
 }
 
+func TestSignEd25519(t *testing.T) {
+	seed, publicKey, err := CreateEd25519Key()
+	if err != nil {
+		t.Fatalf("Error creating the Ed25519 key: %v", err)
+	}
+
+	signature, err := SignEd25519(seed, []byte("Hello World"))
+	if err != nil {
+		t.Fatalf("Error signing with the Ed25519 key: %v", err)
+	}
+
+	public, _ := base64.StdEncoding.DecodeString(publicKey)
+	sig, _ := base64.StdEncoding.DecodeString(signature)
+	if !ed25519.Verify(public, []byte("Hello World"), sig) {
+		t.Error("Expected the signature to be verified with the public key")
+	}
+
+	if _, err := SignEd25519("invalid", []byte("Hello World")); err == nil {
+		t.Error("Expected an error for an invalid key seed")
+	}
+}
+
 func TestDeserializePrivateKey(t *testing.T) {
 	signingKey, err := ioutil.ReadFile("../keystore/TestKey.asc")
 	if err != nil {
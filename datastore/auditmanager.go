@@ -0,0 +1,259 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/service/log"
+	sq "github.com/Masterminds/squirrel"
+)
+
+const createAuditLogTableSQL = `
+	CREATE TABLE IF NOT EXISTS auditlog (
+		id           int primary key not null,
+		created      timestamp not null,
+		actor        varchar(200) not null,
+		action       varchar(100) not null,
+		target       varchar(500) not null,
+		before_state text not null,
+		after_state  text not null,
+		source_ip    varchar(100) not null,
+		prev_hash    varchar(64) not null,
+		hash         varchar(64) not null
+	)
+`
+
+// Indexes
+const createAuditLogCreatedIndexSQL = "CREATE INDEX IF NOT EXISTS auditlog_created_idx ON auditlog (created)"
+const createAuditLogActorIndexSQL = "CREATE INDEX IF NOT EXISTS auditlog_actor_idx ON auditlog (actor)"
+
+// The audit log is append-only: updates and deletes are ignored by the database (PostgreSQL only)
+const createAuditLogNoUpdateRuleSQL = "CREATE OR REPLACE RULE auditlog_no_update AS ON UPDATE TO auditlog DO INSTEAD NOTHING"
+const createAuditLogNoDeleteRuleSQL = "CREATE OR REPLACE RULE auditlog_no_delete AS ON DELETE TO auditlog DO INSTEAD NOTHING"
+
+// The table is locked while an entry is appended, so the entries form a single chain (PostgreSQL only)
+const lockAuditLogSQL = "LOCK TABLE auditlog IN EXCLUSIVE MODE"
+
+const lastAuditLogSQL = "select id, hash from auditlog order by id desc limit 1"
+
+const createAuditLogSQL = `
+	insert into auditlog (id, created, actor, action, target, before_state, after_state, source_ip, prev_hash, hash)
+	values ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)`
+
+const listAuditLogChainSQL = `
+	select id, created, actor, action, target, before_state, after_state, source_ip, prev_hash, hash
+	from auditlog
+	where id>$1
+	order by id
+	limit $2`
+
+// auditLogVerifyBatch is the number of entries that are read at a time to verify the chain
+const auditLogVerifyBatch = 1000
+
+// AuditLogDefaultLimit is the default limit for the search queries in the audit log
+const AuditLogDefaultLimit = 100
+
+// AuditLog is an entry of the audit log of the administrative actions. Before and After hold
+// the fields of the target that the action changed, as JSON. Each entry holds the hash of the
+// entry before it, so the entries form a chain that shows if the log has been tampered with
+type AuditLog struct {
+	ID       int       `json:"id"`
+	Created  time.Time `json:"created"`
+	Actor    string    `json:"actor"`
+	Action   string    `json:"action"`
+	Target   string    `json:"target"`
+	Before   string    `json:"before"`
+	After    string    `json:"after"`
+	SourceIP string    `json:"source-ip"`
+	PrevHash string    `json:"prev-hash"`
+	Hash     string    `json:"hash"`
+}
+
+// AuditLogParams holds the filters for the audit log search
+type AuditLogParams struct {
+	Actor  string
+	Action string
+	Target string // matches the start of the target
+	From   *time.Time
+	To     *time.Time
+	Limit  uint64 // 0 means no LIMIT here
+	Offset uint64
+}
+
+// AuditLogVerification is the result of the verification of the audit log chain. BrokenID is
+// the first entry that does not match the chain
+type AuditLogVerification struct {
+	Valid    bool `json:"valid"`
+	Entries  int  `json:"entries"`
+	BrokenID int  `json:"broken-id,omitempty"`
+}
+
+// ComputeHash calculates the hash of the entry, which includes the hash of the previous entry
+func (a AuditLog) ComputeHash() string {
+	data := fmt.Sprintf("%d|%s|%s|%s|%s|%s|%s|%s|%s", a.ID, a.Created.UTC().Format(time.RFC3339Nano),
+		a.Actor, a.Action, a.Target, a.Before, a.After, a.SourceIP, a.PrevHash)
+	hash := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(hash[:])
+}
+
+// CreateAuditLogTable creates the database table for the audit log
+func (db *DB) CreateAuditLogTable() error {
+	for _, s := range []string{createAuditLogTableSQL, createAuditLogCreatedIndexSQL, createAuditLogActorIndexSQL} {
+		if _, err := db.Exec(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateAuditLogRules makes the audit log table append-only
+func (db *DB) CreateAuditLogRules() error {
+	for _, s := range []string{createAuditLogNoUpdateRuleSQL, createAuditLogNoDeleteRuleSQL} {
+		if _, err := db.Exec(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateAuditLog appends an entry to the audit log, chained to the last entry
+func (db *DB) CreateAuditLog(entry AuditLog) error {
+	err := db.transaction(func(tx *sql.Tx) error {
+		if !InFactory() {
+			if _, err := tx.Exec(lockAuditLogSQL); err != nil {
+				return err
+			}
+		}
+
+		var lastID int
+		var prevHash string
+		err := tx.QueryRow(lastAuditLogSQL).Scan(&lastID, &prevHash)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		entry.ID = lastID + 1
+		entry.PrevHash = prevHash
+		// The time is stored to the microsecond, so the hash can be verified
+		entry.Created = time.Now().UTC().Truncate(time.Microsecond)
+		entry.Hash = entry.ComputeHash()
+
+		_, err = tx.Exec(createAuditLogSQL, entry.ID, entry.Created, entry.Actor, entry.Action, entry.Target,
+			entry.Before, entry.After, entry.SourceIP, entry.PrevHash, entry.Hash)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error writing the audit log: %v", err)
+	}
+	return nil
+}
+
+// ListAuditLog returns the entries of the audit log that match the filters, the latest first
+func (db *DB) ListAuditLog(params AuditLogParams) ([]AuditLog, error) {
+	query := sq.
+		Select("id", "created", "actor", "action", "target", "before_state", "after_state", "source_ip", "prev_hash", "hash").
+		From("auditlog").
+		OrderBy("id DESC").
+		Offset(params.Offset).
+		PlaceholderFormat(sq.Dollar)
+
+	if params.Limit > 0 {
+		query = query.Limit(params.Limit)
+	}
+	if params.Actor != "" {
+		query = query.Where(sq.Eq{"actor": params.Actor})
+	}
+	if params.Action != "" {
+		query = query.Where(sq.Eq{"action": params.Action})
+	}
+	if params.Target != "" {
+		query = query.Where(sq.Like{"target": params.Target + "%"})
+	}
+	if params.From != nil {
+		query = query.Where(sq.GtOrEq{"created": params.From.UTC()})
+	}
+	if params.To != nil {
+		query = query.Where(sq.Lt{"created": params.To.UTC()})
+	}
+
+	rows, err := query.RunWith(db).Query()
+	if err != nil {
+		log.Printf("Error retrieving the audit log: %v\n", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	return rowsToAuditLogs(rows)
+}
+
+// VerifyAuditLog checks the hash chain of the audit log, from the first entry
+func (db *DB) VerifyAuditLog() (AuditLogVerification, error) {
+	result := AuditLogVerification{Valid: true}
+	lastID := 0
+	prevHash := ""
+
+	for {
+		rows, err := db.Query(listAuditLogChainSQL, lastID, auditLogVerifyBatch)
+		if err != nil {
+			return result, fmt.Errorf("error retrieving the audit log: %v", err)
+		}
+		entries, err := rowsToAuditLogs(rows)
+		rows.Close()
+		if err != nil {
+			return result, fmt.Errorf("error retrieving the audit log: %v", err)
+		}
+
+		for _, e := range entries {
+			result.Entries++
+			if e.ID != lastID+1 || e.PrevHash != prevHash || e.Hash != e.ComputeHash() {
+				result.Valid = false
+				result.BrokenID = e.ID
+				return result, nil
+			}
+			lastID = e.ID
+			prevHash = e.Hash
+		}
+
+		if len(entries) < auditLogVerifyBatch {
+			return result, nil
+		}
+	}
+}
+
+func rowsToAuditLogs(rows *sql.Rows) ([]AuditLog, error) {
+	entries := []AuditLog{}
+
+	for rows.Next() {
+		e := AuditLog{}
+		err := rows.Scan(&e.ID, &e.Created, &e.Actor, &e.Action, &e.Target, &e.Before, &e.After, &e.SourceIP, &e.PrevHash, &e.Hash)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
@@ -22,18 +22,40 @@ package datastore
 
 import (
 	"database/sql"
+	"strings"
+	"time"
 
 	"github.com/CanonicalLtd/serial-vault/config"
+	"github.com/lib/pq"
 )
 
 const anyUserFilter = ""
 
-// SigningLogParams holds extra parameters for the SigningLog search
+// SigningLogParams holds extra parameters for the SigningLog search. The signing logs are sorted
+// by ID, newest first, unless a sort field is given. For keyset pagination, After is the cursor of
+// the last signing log of the previous page
 type SigningLogParams struct {
 	Limit        uint64 // 0 means no LIMIT here
 	Offset       uint64
 	Filter       []string
 	Serialnumber string
+	CreatedFrom  *time.Time // inclusive
+	CreatedTo    *time.Time // exclusive
+	Fingerprint  string
+	Revision     int   // 0 means any revision
+	Synced       *bool // nil means both synced and not synced
+	Sort         string
+	Ascending    bool
+	After        *SigningLogCursor
+}
+
+// SigningLogExportParams holds the filters for an export of the signing logs of an account. The
+// 'from' time is inclusive and the 'to' time is exclusive
+type SigningLogExportParams struct {
+	From         *time.Time
+	To           *time.Time
+	Models       []string
+	Serialnumber string // '*' matches any characters, otherwise the start of the serial number is matched
 }
 
 // Datastore interface for the database logic
@@ -66,6 +88,7 @@ type Datastore interface {
 	CreateKeypairTable() error
 	AlterKeypairTable() error
 	CheckKeypairKeynameExists(authorityID, name string) bool
+	ResealKeypairs(reseal func(keypair Keypair, authKeyHash string) (string, string, error)) (int, error)
 
 	CreateSettingsTable() error
 	PutSetting(setting Setting) error
@@ -73,15 +96,17 @@ type Datastore interface {
 
 	CreateSigningLogTable() error
 	CheckForDuplicate(signLog *SigningLog) (bool, int, error)
+	CheckForDeviceKeyConflict(signLog SigningLog) (bool, error)
+	FindMaxResignRevision(signLog SigningLog) (int, error)
 	CreateSigningLog(signLog SigningLog) error
+	CreateSigningLogs(signLogs []SigningLog) error
 	ListAllowedSigningLog(authorization User) ([]SigningLog, error)
 	ListAllowedSigningLogForAccount(authorization User, authorityID string, params *SigningLogParams) ([]SigningLog, error)
 	AllowedSigningLogFilterValues(authorization User, authorityID string) (SigningLogFilters, error)
+	ExportAllowedSigningLog(authorization User, authorityID string, params SigningLogExportParams, export func(SigningLog) error) error
+	AllowedSigningReport(authorization User, params SigningReportParams) ([]SigningReport, error)
 
 	CreateDeviceNonceTable() error
-	DeleteExpiredDeviceNonces() error
-	CreateDeviceNonce() (DeviceNonce, error)
-	ValidateDeviceNonce(nonce string) error
 
 	CreateAccountTable() error
 	AlterAccountTable() error
@@ -108,6 +133,51 @@ type Datastore interface {
 	CreateAccountUserLinkTable() error
 	CheckUserInAccount(username, authorityID string) bool
 	AlterUserTable() error
+	HashUserAPIKeys() error
+	ResetUserAPIKey(userID int) (string, error)
+	AlterUserProvisioned() error
+	AlterUserOIDCIdentity() error
+	BindUserOIDCIdentity(userID int, identity string) (bool, error)
+	ProvisionUser(user User) (int, error)
+	DeprovisionUser(userID int) error
+
+	CreateUserTokenTable() error
+	ListAllowedUserTokens(authorization User) ([]UserToken, error)
+	CreateAllowedUserToken(token UserToken, authorization User) (UserToken, error)
+	RevokeAllowedUserToken(tokenID int, authorization User) error
+
+	CreateUserSessionTable() error
+	CreateUserSession(session UserSession) error
+	GetUserSession(jti string) (UserSession, error)
+	ListUserSessions(username string) ([]UserSession, error)
+	RefreshUserSession(jti string, expires time.Time) error
+	RevokeUserSession(jti string) error
+	RevokeUserSessions(username string) error
+
+	CreateAccountPermissionTable() error
+	ListUserAccountPermissions(userID int) ([]AccountPermissions, error)
+	SetUserAccountPermissions(userID int, authorityID string, permissions []string) error
+	DeleteUserAccountPermissions(userID int, authorityID string) error
+	AllowedPermission(authorization User, authorityID, permission string) bool
+
+	CreateAuditLogTable() error
+	CreateAuditLogRules() error
+	CreateAuditLog(entry AuditLog) error
+	ListAuditLog(params AuditLogParams) ([]AuditLog, error)
+	VerifyAuditLog() (AuditLogVerification, error)
+
+	CreateWebhookTable() error
+	ListAllowedWebhooks(authorization User) ([]Webhook, error)
+	GetAllowedWebhook(webhookID int, authorization User) (Webhook, error)
+	CreateAllowedWebhook(webhook Webhook, authorization User) (Webhook, error)
+	UpdateAllowedWebhook(webhook Webhook, authorization User) error
+	DeleteAllowedWebhook(webhookID int, authorization User) error
+	ListAllowedWebhookDeliveries(webhookID int, authorization User) ([]WebhookDelivery, error)
+	RetryAllowedWebhookDelivery(webhookID, deliveryID int, authorization User) error
+	QueueWebhookEvent(authorityID, event, payload string) error
+	ListDueWebhookDeliveries(limit int) ([]WebhookDelivery, error)
+	ClaimWebhookDelivery(delivery WebhookDelivery, nextAttempt time.Time) (bool, error)
+	UpdateWebhookDelivery(delivery WebhookDelivery) error
 
 	ListUserAccounts(username string) ([]Account, error)
 	ListNotUserAccounts(username string) ([]Account, error)
@@ -130,6 +200,61 @@ type Datastore interface {
 	GetSubstore(fromModelID int, serialNumber string) (Substore, error)
 	GetSubstoreModel(brand, model, serialNumber string) (Substore, error)
 
+	CreateKeyRotationTable() error
+	ListAllowedKeyRotations(modelID int, authorization User) ([]KeyRotation, error)
+	CreateAllowedKeyRotation(rotation KeyRotation, authorization User) (KeyRotation, error)
+	DeleteAllowedKeyRotation(modelID, rotationID int, authorization User) error
+	PromoteKeyRotations() (int, error)
+	ApplyDueKeyRotations(model *Model) error
+	ListRotationKeypairs(modelID int, keyType string) ([]Keypair, error)
+
+	CreateSerialAllowlistTable() error
+	ListAllowedSerialAllowlist(modelID int, status, after string, authorization User) ([]SerialAllowlist, error)
+	ImportAllowedSerialAllowlist(modelID int, serials []SerialAllowlistImport, authorization User) (int, error)
+	DeleteAllowedSerialAllowlist(modelID, serialID int, authorization User) error
+	CheckSerialAllowlist(modelID int, serialNumber string) error
+	UpdateSerialAllowlistSigned(modelID int, serialNumber string) error
+	SyncSerialAllowlist(modelID int, serials []SerialAllowlist) error
+
+	CreateSerialRevocationTable() error
+	ListSerialRevocations(brandID, modelName string) ([]SerialRevocation, error)
+	CreateSerialRevocation(revocation SerialRevocation) (SerialRevocation, error)
+	ListAllowedSerialRevocations(modelID int, authorization User) ([]SerialRevocation, error)
+	CreateAllowedSerialRevocation(modelID int, revocation SerialRevocation, authorization User) (SerialRevocation, error)
+	DeleteAllowedSerialRevocation(modelID, revocationID int, authorization User) error
+	SyncSerialRevocations(brandID, modelName string, revocations []SerialRevocation) error
+	CheckSerialRevoked(brandID, modelName, serialNumber string, revision int) (bool, error)
+
+	CreateRemodelRuleTable() error
+	ListRemodelRules(modelID int) ([]RemodelRule, error)
+	GetRemodelRule(fromBrandID, fromModel, toBrandID, toModel string) (RemodelRule, error)
+	ListAllowedRemodelRules(modelID int, authorization User) ([]RemodelRule, error)
+	CreateAllowedRemodelRule(modelID int, rule RemodelRule, authorization User) (RemodelRule, error)
+	DeleteAllowedRemodelRule(modelID, ruleID int, authorization User) error
+
+	CreateRemodelHistoryTable() error
+	CreateRemodelHistory(history RemodelHistory) error
+	ListRemodelHistory(brandID, modelName string) ([]RemodelHistory, error)
+	ListAllowedRemodelHistory(modelID int, authorization User) ([]RemodelHistory, error)
+
+	CreateModelQuotaTable() error
+	CreateModelUsageTable() error
+	GetAPIKeyQuota(apiKey string, now time.Time) (APIKeyQuota, error)
+	ReserveModelQuota(model Model, count int, now time.Time) (bool, ModelQuota, error)
+	ReleaseModelQuota(modelID, count int, now time.Time) error
+	GetModelUsage(modelID int, now time.Time) (int, int, error)
+	GetModelQuota(model Model) (ModelQuota, error)
+	GetAllowedModelQuota(modelID int, authorization User) (ModelQuota, error)
+	UpdateAllowedModelQuota(modelID int, quota ModelQuota, authorization User) (ModelQuota, error)
+
+	CreateModelAPIKeyTable() error
+	HashModelAPIKeys() error
+	ListModelAPIKeys(modelID int) ([]ModelAPIKey, error)
+	SyncModelAPIKeys(keys []ModelAPIKey) error
+	ListAllowedModelAPIKeys(modelID int, authorization User) ([]ModelAPIKey, error)
+	CreateAllowedModelAPIKey(key ModelAPIKey, authorization User) (ModelAPIKey, error)
+	RevokeAllowedModelAPIKey(modelID, keyID int, authorization User) error
+
 	CreateTestLogTable() error
 	CreateTestLog(testLog TestLog) error
 	ListAllowedTestLog(authorization User) ([]TestLog, error)
@@ -143,14 +268,22 @@ type Datastore interface {
 	CreateSigningLogSync(signLog SigningLog) error
 	SyncSigningLog() ([]SigningLog, error)
 	SyncUpdateSigningLog(id int) error
+	ExportSigningLog(authorityID string, params SigningLogExportParams, export func(SigningLog) error) error
+	CreateSigningLogArchiveTable() error
+	ArchiveSigningLogs(before time.Time, limit int, archiveTable bool, archive func([]SigningLog) error) (int, error)
+	SigningReport(params SigningReportParams) ([]SigningReport, error)
 	SyncListTestLogs() ([]TestLog, error)
 	SyncDeleteTestLog(ID int) error
 	UpdateAllowedTestLog(ID int, authorization User) error
+
+	Transaction(action func(db Datastore) error) error
 }
 
-// DB local database interface with our custom methods.
+// DB local database interface with our custom methods. The DB is bound to a transaction when it
+// does the database changes of an action in a single transaction
 type DB struct {
 	*sql.DB
+	tx *sql.Tx
 }
 
 // Env Environment struct that holds the config and data store details.
@@ -158,6 +291,7 @@ type Env struct {
 	Config    config.Settings
 	DB        Datastore
 	KeypairDB *KeypairDatabase
+	Nonces    NonceStore
 }
 
 // Environ contains the parsed config file settings.
@@ -176,7 +310,50 @@ func OpenSysDatabase(driver, dataSource string) {
 	}
 }
 
-func (db *DB) transaction(txFunc func(*sql.Tx) error) error {
+// Transaction does the database changes of an action in a single transaction, which is rolled back
+// when the action fails. The action uses the database that it is given, which is bound to the
+// transaction
+func (db *DB) Transaction(action func(db Datastore) error) error {
+	if db.tx != nil {
+		return action(db)
+	}
+
+	return db.transaction(func(tx *sql.Tx) error {
+		return action(&DB{DB: db.DB, tx: tx})
+	})
+}
+
+// Exec executes a query, in the transaction of the DB when it is bound to one
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if db.tx != nil {
+		return db.tx.Exec(query, args...)
+	}
+	return db.DB.Exec(query, args...)
+}
+
+// Query executes a query that returns rows, in the transaction of the DB when it is bound to one
+func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	if db.tx != nil {
+		return db.tx.Query(query, args...)
+	}
+	return db.DB.Query(query, args...)
+}
+
+// QueryRow executes a query that returns a single row, in the transaction of the DB when it is
+// bound to one
+func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	if db.tx != nil {
+		return db.tx.QueryRow(query, args...)
+	}
+	return db.DB.QueryRow(query, args...)
+}
+
+func (db *DB) transaction(txFunc func(*sql.Tx) error) (err error) {
+	// The changes are part of the transaction that the DB is bound to
+	if db.tx != nil {
+		return txFunc(db.tx)
+	}
+
 	tx, err := db.Begin()
 	if err != nil {
 		return err
@@ -195,6 +372,24 @@ func (db *DB) transaction(txFunc func(*sql.Tx) error) error {
 	return err
 }
 
+// addColumn adds a column to an existing table. Only the error from a column that already
+// exists is ignored
+func (db *DB) addColumn(alterSQL string) error {
+	_, err := db.Exec(alterSQL)
+	if err == nil || columnExists(err) {
+		return nil
+	}
+	return err
+}
+
+func columnExists(err error) bool {
+	if err, ok := err.(*pq.Error); ok {
+		return err.Code.Name() == "duplicate_column"
+	}
+	// SQLite error
+	return strings.HasPrefix(err.Error(), "duplicate column name")
+}
+
 // InFactory checks if we are running in the factory (with a sqlite database)
 func InFactory() bool {
 	if Environ.Config.Driver == "sqlite3" {
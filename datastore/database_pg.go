@@ -41,6 +41,6 @@ func openPostgreSQLDatabase(driver, dataSource string) {
 		log.Fatalf("Error accessing the database: %v", err)
 	}
 
-	Environ.DB = &DB{db}
-	OpenidNonceStore.DB = &DB{db}
+	Environ.DB = &DB{DB: db}
+	OpenidNonceStore.DB = &DB{DB: db}
 }
@@ -42,6 +42,6 @@ func openSQLiteDatabase(driver, dataSource string) {
 		log.Fatalf("Error accessing the database: %v\n", err)
 	}
 
-	Environ.DB = &DB{db}
-	OpenidNonceStore.DB = &DB{db}
+	Environ.DB = &DB{DB: db}
+	OpenidNonceStore.DB = &DB{DB: db}
 }
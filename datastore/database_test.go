@@ -0,0 +1,72 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016-2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+import (
+	"database/sql"
+	"errors"
+
+	check "gopkg.in/check.v1"
+)
+
+type databaseSuite struct{}
+
+var _ = check.Suite(&databaseSuite{})
+
+func (s *databaseSuite) TestTransaction(c *check.C) {
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	c.Assert(err, check.IsNil)
+	defer sqlDB.Close()
+	sqlDB.SetMaxOpenConns(1)
+
+	db := &DB{DB: sqlDB}
+	_, err = db.Exec("create table item (name varchar(200) not null)")
+	c.Assert(err, check.IsNil)
+
+	insert := func(db Datastore, name string) error {
+		_, err := db.(*DB).Exec("insert into item values ($1)", name)
+		return err
+	}
+
+	// The changes of a failed action are rolled back
+	err = db.Transaction(func(tx Datastore) error {
+		if err := insert(tx, "first"); err != nil {
+			return err
+		}
+		return errors.New("MOCK error recording the action")
+	})
+	c.Assert(err, check.NotNil)
+
+	// A nested transaction is part of the outer one
+	err = db.Transaction(func(tx Datastore) error {
+		if err := insert(tx, "second"); err != nil {
+			return err
+		}
+		return tx.Transaction(func(tx Datastore) error {
+			return insert(tx, "third")
+		})
+	})
+	c.Assert(err, check.IsNil)
+
+	var count int
+	err = db.QueryRow("select count(*) from item").Scan(&count)
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 2)
+}
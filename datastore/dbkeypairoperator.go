@@ -24,6 +24,8 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
+	"fmt"
 
 	"github.com/CanonicalLtd/serial-vault/service/log"
 
@@ -157,6 +159,129 @@ var ReEncryptKeypair = func(keypair Keypair, newSecret string) (string, string,
 	return base64SealedSigningkey, base64AuthKeyHash, nil
 }
 
+// MigrateSealedKeypairs re-seals the signing-keys and auth-key hashes that are stored
+// using the legacy sealed-key format. Returns the number of keypairs that were updated
+func MigrateSealedKeypairs() (int, error) {
+	return Environ.DB.ResealKeypairs(func(keypair Keypair, base64AuthKeyHash string) (string, string, error) {
+		sealedSigningKey, err := base64.StdEncoding.DecodeString(keypair.SealedKey)
+		if err != nil {
+			return "", "", err
+		}
+		encryptedAuthKey, err := base64.StdEncoding.DecodeString(base64AuthKeyHash)
+		if err != nil {
+			return "", "", err
+		}
+
+		// Nothing to do if the keypair is already using the current format
+		if crypt.SealedKeyVersion(sealedSigningKey) == crypt.SealedKeyV2 && crypt.SealedKeyVersion(encryptedAuthKey) == crypt.SealedKeyV2 {
+			return keypair.SealedKey, base64AuthKeyHash, nil
+		}
+
+		return resealKeypair(keypair, base64AuthKeyHash, Environ.Config.KeyStoreSecret, Environ.Config.KeyStoreSecret)
+	})
+}
+
+// RotateKeystoreSecret re-seals every signing-key and auth-key hash using the new keystore
+// secret, in a single transaction. Each keypair is checked that it can be unsealed using
+// the new secret before the changes are committed. Returns the number of keypairs updated
+func RotateKeystoreSecret(newSecret string) (int, error) {
+	if len(newSecret) == 0 {
+		return 0, errors.New("The new keystore secret must be entered")
+	}
+
+	return Environ.DB.ResealKeypairs(func(keypair Keypair, base64AuthKeyHash string) (string, string, error) {
+		sealedKey, authKeyHash, err := resealKeypair(keypair, base64AuthKeyHash, Environ.Config.KeyStoreSecret, newSecret)
+		if err != nil {
+			return "", "", err
+		}
+
+		// Check that the signing-key unseals using the new secret
+		keypair.SealedKey = sealedKey
+		if err = verifySealedKeypair(keypair, authKeyHash, newSecret); err != nil {
+			log.Printf("Cannot unseal the signing-key %s using the new secret: %v", keypair.KeyID, err)
+			return "", "", err
+		}
+
+		return sealedKey, authKeyHash, nil
+	})
+}
+
+// verifySealedKeypair checks that the sealed signing-key unseals to the key in the keypair
+func verifySealedKeypair(keypair Keypair, base64AuthKeyHash, secret string) error {
+	encryptedAuthKey, err := base64.StdEncoding.DecodeString(base64AuthKeyHash)
+	if err != nil {
+		return err
+	}
+	authKey, err := crypt.DecryptKey(encryptedAuthKey, secret)
+	if err != nil {
+		return err
+	}
+
+	sealedSigningKey, err := base64.StdEncoding.DecodeString(keypair.SealedKey)
+	if err != nil {
+		return err
+	}
+	base64SigningKey, err := crypt.DecryptKey(sealedSigningKey, string(authKey))
+	if err != nil {
+		return err
+	}
+
+	privateKey, _, err := crypt.DeserializePrivateKey(string(base64SigningKey))
+	if err != nil {
+		return err
+	}
+	if privateKey.PublicKey().ID() != keypair.KeyID {
+		return fmt.Errorf("The unsealed signing-key does not match the key ID %s", keypair.KeyID)
+	}
+	return nil
+}
+
+// resealKeypair decrypts the auth-key and signing-key using the secret, and seals them again
+// using the new secret. The same auth-key is used to seal the signing-key
+func resealKeypair(keypair Keypair, base64AuthKeyHash, secret, newSecret string) (string, string, error) {
+	// Decode and decrypt the auth-key
+	encryptedAuthKey, err := base64.StdEncoding.DecodeString(base64AuthKeyHash)
+	if err != nil {
+		log.Println("Could not decode the auth-key for the signing-key")
+		return "", "", err
+	}
+	authKey, err := crypt.DecryptKey(encryptedAuthKey, secret)
+	if err != nil {
+		log.Println("Could not decrypt the auth-key for the signing-key")
+		return "", "", err
+	}
+
+	// Decode and decrypt the signing-key
+	sealedSigningKey, err := base64.StdEncoding.DecodeString(keypair.SealedKey)
+	if err != nil {
+		log.Println("Could not decode the signing-key")
+		return "", "", err
+	}
+	base64SigningKey, err := crypt.DecryptKey(sealedSigningKey, string(authKey))
+	if err != nil {
+		log.Println("Could not decrypt the signing-key")
+		return "", "", err
+	}
+
+	// The legacy format is not authenticated, so check that the signing-key is valid
+	if _, _, err = crypt.DeserializePrivateKey(string(base64SigningKey)); err != nil {
+		log.Println("The decrypted signing-key is invalid")
+		return "", "", err
+	}
+
+	// Seal the signing-key and the auth-key
+	newSealedSigningKey, err := crypt.EncryptKey(string(base64SigningKey), string(authKey))
+	if err != nil {
+		return "", "", err
+	}
+	newEncryptedAuthKey, err := crypt.EncryptKey(string(authKey), newSecret)
+	if err != nil {
+		return "", "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(newSealedSigningKey), base64.StdEncoding.EncodeToString(newEncryptedAuthKey), nil
+}
+
 func decryptKeypair(authorityID, keyID, base64SealedSigningKey string) ([]byte, error) {
 	// Decode and decrypt the auth-key
 	authKeySetting, err := Environ.DB.GetSetting(crypt.GenerateAuthKey(authorityID, keyID))
@@ -20,11 +20,15 @@
 package datastore
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
 	"encoding/base64"
 	"io/ioutil"
 	"testing"
 
 	"github.com/CanonicalLtd/serial-vault/config"
+	"github.com/CanonicalLtd/serial-vault/crypt"
 )
 
 func getDatabaseKeyStore() (*KeypairDatabase, error) {
@@ -99,3 +103,130 @@ func TestImportKey(t *testing.T) {
 	}
 
 }
+
+// legacySealKey seals the data using the legacy AES-CFB format, base64 encoded for storage
+func legacySealKey(plainText, keyText string) string {
+	key := []byte(keyText + "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx")[:32]
+	block, _ := aes.NewCipher(key)
+	ciphertext := make([]byte, aes.BlockSize+len(plainText))
+	iv := ciphertext[:aes.BlockSize]
+	rand.Read(iv)
+	cfb := cipher.NewCFBEncrypter(block, iv)
+	cfb.XORKeyStream(ciphertext[aes.BlockSize:], []byte(plainText))
+	return base64.StdEncoding.EncodeToString(ciphertext)
+}
+
+func TestMigrateSealedKeypairs(t *testing.T) {
+	keypairDB, _ := getDatabaseKeyStore()
+	mockDB := Environ.DB.(*MockDB)
+
+	signingKey, err := ioutil.ReadFile("../keystore/TestKey.asc")
+	if err != nil {
+		t.Fatalf("Error reading the signing-key file: %v", err)
+	}
+	encodedSigningKey := base64.StdEncoding.EncodeToString(signingKey)
+
+	mockDB.sealedKeypair = Keypair{ID: 1, AuthorityID: "System", KeyID: "abcdef12345678", SealedKey: legacySealKey(encodedSigningKey, "fake-hmac-ed-data")}
+	mockDB.encryptedAuthKeyHash = legacySealKey("fake-hmac-ed-data", Environ.Config.KeyStoreSecret)
+
+	count, err := MigrateSealedKeypairs()
+	if err != nil {
+		t.Fatalf("Error migrating the sealed keypairs: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 re-sealed keypair, got: %d", count)
+	}
+
+	for _, sealed := range []string{mockDB.sealedKeypair.SealedKey, mockDB.encryptedAuthKeyHash} {
+		decoded, _ := base64.StdEncoding.DecodeString(sealed)
+		if crypt.SealedKeyVersion(decoded) != crypt.SealedKeyV2 {
+			t.Errorf("Expected version %d, got: %d", crypt.SealedKeyV2, crypt.SealedKeyVersion(decoded))
+		}
+	}
+
+	if err = keypairDB.keypairOperator.UnsealKeypair("System", "abcdef12345678", mockDB.sealedKeypair.SealedKey); err != nil {
+		t.Errorf("Error decrypting the re-sealed signing-key: %v", err)
+	}
+
+	// The keypairs are only migrated once
+	count, err = MigrateSealedKeypairs()
+	if err != nil {
+		t.Fatalf("Error migrating the sealed keypairs: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected no re-sealed keypairs, got: %d", count)
+	}
+}
+
+func TestMigrateSealedKeypairsWrongSecret(t *testing.T) {
+	getDatabaseKeyStore()
+	mockDB := Environ.DB.(*MockDB)
+
+	mockDB.sealedKeypair = Keypair{ID: 1, AuthorityID: "System", KeyID: "abcdef12345678", SealedKey: legacySealKey("not a signing-key", "fake-hmac-ed-data")}
+	mockDB.encryptedAuthKeyHash = legacySealKey("fake-hmac-ed-data", "a different secret")
+
+	if _, err := MigrateSealedKeypairs(); err == nil {
+		t.Error("Expected error migrating with the wrong secret, got success")
+	}
+}
+
+func TestRotateKeystoreSecret(t *testing.T) {
+	getDatabaseKeyStore()
+	mockDB := Environ.DB.(*MockDB)
+
+	signingKey, err := ioutil.ReadFile("../keystore/TestKey.asc")
+	if err != nil {
+		t.Fatalf("Error reading the signing-key file: %v", err)
+	}
+	encodedSigningKey := base64.StdEncoding.EncodeToString(signingKey)
+	privateKey, _, _ := crypt.DeserializePrivateKey(encodedSigningKey)
+
+	dbOperator := DatabaseKeypairOperator{}
+	sealedKey, err := dbOperator.ImportKeypair("System", "abcdef12345678", encodedSigningKey)
+	if err != nil {
+		t.Fatalf("Error encrypting the signing-key: %v", err)
+	}
+	mockDB.sealedKeypair = Keypair{ID: 1, AuthorityID: "System", KeyID: privateKey.PublicKey().ID(), SealedKey: sealedKey}
+	oldAuthKeyHash := mockDB.encryptedAuthKeyHash
+
+	count, err := RotateKeystoreSecret("the new keystore secret")
+	if err != nil {
+		t.Fatalf("Error rotating the keystore secret: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 re-sealed keypair, got: %d", count)
+	}
+	if mockDB.encryptedAuthKeyHash == oldAuthKeyHash || mockDB.sealedKeypair.SealedKey == sealedKey {
+		t.Error("Expected the keypair to be re-sealed")
+	}
+
+	if err = verifySealedKeypair(mockDB.sealedKeypair, mockDB.encryptedAuthKeyHash, "the new keystore secret"); err != nil {
+		t.Errorf("Error unsealing the signing-key with the new secret: %v", err)
+	}
+	if err = verifySealedKeypair(mockDB.sealedKeypair, mockDB.encryptedAuthKeyHash, Environ.Config.KeyStoreSecret); err == nil {
+		t.Error("Expected error unsealing the signing-key with the old secret, got success")
+	}
+}
+
+func TestRotateKeystoreSecretInvalid(t *testing.T) {
+	getDatabaseKeyStore()
+	mockDB := Environ.DB.(*MockDB)
+
+	// The key ID does not match the sealed signing-key
+	signingKey, _ := ioutil.ReadFile("../keystore/TestKey.asc")
+	dbOperator := DatabaseKeypairOperator{}
+	sealedKey, _ := dbOperator.ImportKeypair("System", "abcdef12345678", base64.StdEncoding.EncodeToString(signingKey))
+	mockDB.sealedKeypair = Keypair{ID: 1, AuthorityID: "System", KeyID: "abcdef12345678", SealedKey: sealedKey}
+	oldAuthKeyHash := mockDB.encryptedAuthKeyHash
+
+	if _, err := RotateKeystoreSecret("the new keystore secret"); err == nil {
+		t.Error("Expected error rotating the keystore secret, got success")
+	}
+	if mockDB.encryptedAuthKeyHash != oldAuthKeyHash || mockDB.sealedKeypair.SealedKey != sealedKey {
+		t.Error("Expected the keypair to be unchanged")
+	}
+
+	if _, err := RotateKeystoreSecret(""); err == nil {
+		t.Error("Expected error for an empty secret, got success")
+	}
+}
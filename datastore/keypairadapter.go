@@ -38,7 +38,8 @@ func (db *DB) ListAllowedKeypairs(authorization User) ([]Keypair, error) {
 	}
 }
 
-// UpdateAllowedKeypairActive updates active enable/disable flag if user is authorized
+// UpdateAllowedKeypairActive updates active enable/disable flag if user is authorized. An admin
+// must have the keypair:create permission on the keypair's account
 func (db *DB) UpdateAllowedKeypairActive(keypairID int, active bool, authorization User) error {
 	switch authorization.Role {
 	case Invalid: // Authentication is disabled
@@ -46,6 +47,13 @@ func (db *DB) UpdateAllowedKeypairActive(keypairID int, active bool, authorizati
 	case Superuser:
 		return db.updateKeypairActive(keypairID, active)
 	case Admin:
+		keypair, err := db.GetKeypair(keypairID)
+		if err != nil {
+			return err
+		}
+		if !db.AllowedPermission(authorization, keypair.AuthorityID, PermissionKeypairCreate) {
+			return errorPermission(keypair.AuthorityID, PermissionKeypairCreate)
+		}
 		return db.updateKeypairActiveFilteredByUser(keypairID, active, authorization.Username)
 	default:
 		return nil
@@ -70,6 +78,9 @@ func (db *DB) UpdateKeypairAssertion(keypair Keypair, authorization User) (strin
 		if !db.CheckUserInAccount(authorization.Username, keypair.AuthorityID) {
 			return "error-auth", errors.New("You do not have permissions for that authority")
 		}
+		if !db.AllowedPermission(authorization, keypair.AuthorityID, PermissionKeypairCreate) {
+			return "error-auth", errorPermission(keypair.AuthorityID, PermissionKeypairCreate)
+		}
 	}
 
 	return "", db.updateKeypairAssertion(keypair.ID, keypair.Assertion)
@@ -24,6 +24,7 @@ import (
 	"database/sql"
 	"errors"
 
+	"github.com/CanonicalLtd/serial-vault/crypt"
 	"github.com/CanonicalLtd/serial-vault/service/log"
 )
 
@@ -90,6 +91,13 @@ const syncUpsertKeypairSQL = `
 
 const updateKeypairSQL = "UPDATE keypair SET assertion=$2 WHERE id=$1"
 
+const listSealedKeypairsSQL = `
+	SELECT id, authority_id, key_id, active, sealed_key, assertion, key_name
+	FROM keypair
+	WHERE sealed_key IS NOT NULL AND sealed_key<>''
+	ORDER BY id`
+const updateKeypairSealedKeySQL = "UPDATE keypair SET sealed_key=$2 WHERE id=$1"
+
 // Add the assertion field to store the assertion for the account key to the table
 const alterKeypairAddAssertion = "ALTER TABLE keypair ADD COLUMN assertion TEXT DEFAULT ''"
 
@@ -287,3 +295,76 @@ func (db *DB) CheckKeypairKeynameExists(authorityID, name string) bool {
 	row := db.QueryRow(checkKeypairKeynameExistsSQL, authorityID, name)
 	return db.checkBoolQuery(row)
 }
+
+// ResealKeypairs re-seals every sealed signing-key and its auth-key hash in a single transaction.
+// The reseal function is given the keypair and its auth-key hash, and returns the new values.
+// Returns the number of keypairs that were updated.
+func (db *DB) ResealKeypairs(reseal func(keypair Keypair, authKeyHash string) (string, string, error)) (int, error) {
+	count := 0
+
+	err := db.transaction(func(tx *sql.Tx) error {
+		// Fetch the keypairs first, as the rows need to be closed before updating them
+		keypairs, err := listSealedKeypairs(tx)
+		if err != nil {
+			return err
+		}
+
+		for _, keypair := range keypairs {
+			code := crypt.GenerateAuthKey(keypair.AuthorityID, keypair.KeyID)
+
+			setting := Setting{}
+			err = tx.QueryRow(getSettingSQL, code).Scan(&setting.ID, &setting.Code, &setting.Data)
+			if err != nil {
+				log.Printf("Error retrieving the auth-key for the signing-key %s: %v\n", keypair.KeyID, err)
+				return err
+			}
+
+			sealedKey, authKeyHash, err := reseal(keypair, setting.Data)
+			if err != nil {
+				log.Printf("Error re-sealing the signing-key %s: %v\n", keypair.KeyID, err)
+				return err
+			}
+			if sealedKey == keypair.SealedKey && authKeyHash == setting.Data {
+				continue
+			}
+
+			if _, err = tx.Exec(updateKeypairSealedKeySQL, keypair.ID, sealedKey); err != nil {
+				log.Printf("Error updating the sealed signing-key %s: %v\n", keypair.KeyID, err)
+				return err
+			}
+			if _, err = tx.Exec(updateSettingDataSQL, code, authKeyHash); err != nil {
+				log.Printf("Error updating the auth-key for the signing-key %s: %v\n", keypair.KeyID, err)
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func listSealedKeypairs(tx *sql.Tx) ([]Keypair, error) {
+	keypairs := []Keypair{}
+
+	rows, err := tx.Query(listSealedKeypairsSQL)
+	if err != nil {
+		log.Printf("Error retrieving the sealed keypairs: %v\n", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		keypair := Keypair{}
+		err := rows.Scan(&keypair.ID, &keypair.AuthorityID, &keypair.KeyID, &keypair.Active, &keypair.SealedKey, &keypair.Assertion, &keypair.KeyName)
+		if err != nil {
+			return nil, err
+		}
+		keypairs = append(keypairs, keypair)
+	}
+
+	return keypairs, rows.Err()
+}
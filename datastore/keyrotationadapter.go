@@ -0,0 +1,125 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package datastore
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ListAllowedKeyRotations returns the key rotations of a model, if the user is authorized to see the model
+func (db *DB) ListAllowedKeyRotations(modelID int, authorization User) ([]KeyRotation, error) {
+	if _, err := db.GetAllowedModel(modelID, authorization); err != nil {
+		return nil, err
+	}
+
+	switch authorization.Role {
+	case Invalid: // Authentication disabled
+		fallthrough
+	case Superuser:
+		fallthrough
+	case Admin:
+		return db.listKeyRotations(modelID)
+	default:
+		return []KeyRotation{}, nil
+	}
+}
+
+// CreateAllowedKeyRotation schedules the rotation of a model's key to a successor keypair,
+// if the user is authorized to update the model
+func (db *DB) CreateAllowedKeyRotation(rotation KeyRotation, authorization User) (KeyRotation, error) {
+	model, err := db.getAllowedModelToEdit(rotation.ModelID, authorization)
+	if err != nil {
+		return rotation, err
+	}
+
+	// The key being rotated is the model's current key
+	switch rotation.KeyType {
+	case KeyTypeSigning:
+		rotation.RetiringKeypairID = model.KeypairID
+	case KeyTypeSystemUser:
+		rotation.RetiringKeypairID = model.KeypairIDUser
+	}
+
+	if err = db.validateKeyRotation(rotation, model); err != nil {
+		return rotation, err
+	}
+
+	switch authorization.Role {
+	case Invalid: // Authentication is disabled
+		fallthrough
+	case Superuser:
+		fallthrough
+	case Admin:
+		return db.createKeyRotation(rotation)
+	default:
+		return KeyRotation{}, nil
+	}
+}
+
+// DeleteAllowedKeyRotation cancels a key rotation that has not been promoted, if the user
+// is authorized to update the model
+func (db *DB) DeleteAllowedKeyRotation(modelID, rotationID int, authorization User) error {
+	if _, err := db.getAllowedModelToEdit(modelID, authorization); err != nil {
+		return err
+	}
+
+	switch authorization.Role {
+	case Invalid: // Authentication is disabled
+		fallthrough
+	case Superuser:
+		fallthrough
+	case Admin:
+		return db.deleteKeyRotation(modelID, rotationID)
+	default:
+		return nil
+	}
+}
+
+func (db *DB) validateKeyRotation(rotation KeyRotation, model Model) error {
+	if rotation.KeyType != KeyTypeSigning && rotation.KeyType != KeyTypeSystemUser {
+		return fmt.Errorf("the key type must be '%s' or '%s'", KeyTypeSigning, KeyTypeSystemUser)
+	}
+
+	if rotation.SuccessorKeypairID <= 0 {
+		return errors.New("the successor signing-key must be selected")
+	}
+	if rotation.SuccessorKeypairID == rotation.RetiringKeypairID {
+		return errors.New("the successor signing-key must be different to the current signing-key")
+	}
+
+	// The successor key must belong to the model's brand
+	if !db.checkBrandsMatch(model.BrandID, rotation.SuccessorKeypairID, rotation.SuccessorKeypairID) {
+		return errors.New("the successor signing-key must belong to the model's brand")
+	}
+
+	if rotation.PromoteAt.IsZero() {
+		return errors.New("the promotion time must be entered")
+	}
+	if rotation.OverlapUntil.Before(rotation.PromoteAt) {
+		return errors.New("the end of the overlap period must not be before the promotion time")
+	}
+
+	if db.checkPendingKeyRotation(rotation.ModelID, rotation.KeyType) {
+		return fmt.Errorf("a %s key rotation is already scheduled for the model", rotation.KeyType)
+	}
+
+	return nil
+}
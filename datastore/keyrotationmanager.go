@@ -0,0 +1,318 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package datastore
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/service/log"
+)
+
+// Key types that can be rotated for a model
+const (
+	KeyTypeSigning    = "signing"
+	KeyTypeSystemUser = "system-user"
+)
+
+const createKeyRotationTableSQL = `
+	CREATE TABLE IF NOT EXISTS keyrotation (
+		id                    serial primary key not null,
+		model_id              int references model not null,
+		key_type              varchar(20) not null,
+		retiring_keypair_id   int references keypair not null,
+		successor_keypair_id  int references keypair not null,
+		promote_at            timestamp not null,
+		overlap_until         timestamp not null,
+		promoted              boolean default false,
+		created               timestamp default current_timestamp
+	)
+`
+
+// Indexes
+const createKeyRotationModelIndexSQL = "CREATE INDEX IF NOT EXISTS keyrotation_model_idx ON keyrotation (model_id)"
+
+const listKeyRotationsSQL = `
+	SELECT r.id, r.model_id, r.key_type, r.retiring_keypair_id, kr.key_id, r.successor_keypair_id, ks.key_id,
+		r.promote_at, r.overlap_until, r.promoted, r.created
+	FROM keyrotation r
+	INNER JOIN keypair kr ON kr.id = r.retiring_keypair_id
+	INNER JOIN keypair ks ON ks.id = r.successor_keypair_id
+	WHERE r.model_id=$1
+	ORDER BY r.promote_at DESC`
+
+const createKeyRotationSQL = `
+	INSERT INTO keyrotation (model_id, key_type, retiring_keypair_id, successor_keypair_id, promote_at, overlap_until)
+	VALUES ($1,$2,$3,$4,$5,$6) RETURNING id`
+
+const checkPendingKeyRotationSQL = `
+	SELECT EXISTS(
+		SELECT * FROM keyrotation WHERE model_id=$1 AND key_type=$2 AND promoted=false
+	)`
+
+const deleteKeyRotationSQL = "DELETE FROM keyrotation WHERE id=$1 AND model_id=$2 AND promoted=false"
+
+const listDueKeyRotationsSQL = `
+	SELECT id, model_id, key_type, successor_keypair_id
+	FROM keyrotation
+	WHERE promoted=false AND promote_at<=$1
+	ORDER BY promote_at`
+
+const promoteModelSigningKeySQL = "UPDATE model SET keypair_id=$2 WHERE id=$1"
+const promoteModelSystemUserKeySQL = "UPDATE model SET user_keypair_id=$2 WHERE id=$1"
+const updateKeyRotationPromotedSQL = "UPDATE keyrotation SET promoted=true WHERE id=$1"
+
+// The retiring and successor keys of the rotations that are still in their overlap period
+const listRotationKeypairsSQL = `
+	SELECT k.id, k.authority_id, k.key_id, k.active, k.sealed_key, k.assertion, k.key_name
+	FROM keypair k
+	WHERE k.id IN (
+		SELECT retiring_keypair_id FROM keyrotation WHERE model_id=$1 AND key_type=$2 AND overlap_until>$3
+		UNION
+		SELECT successor_keypair_id FROM keyrotation WHERE model_id=$1 AND key_type=$2 AND overlap_until>$3
+	)`
+
+// The successor keys of the rotations that are due, but have not been promoted yet
+const listDueRotationKeypairsSQL = `
+	SELECT r.key_type, k.id, k.authority_id, k.key_id, k.active, k.sealed_key, k.assertion, k.key_name
+	FROM keyrotation r
+	INNER JOIN keypair k ON k.id = r.successor_keypair_id
+	WHERE r.model_id=$1 AND NOT r.promoted AND r.promote_at<=$2
+	ORDER BY r.promote_at`
+
+// Interval between the checks for the key rotations that are due
+const keyRotationInterval = time.Minute
+
+// KeyRotation holds the scheduled rotation of a model's signing-key to a successor keypair.
+// The successor is promoted to be the model's key at the promotion time, and the retiring
+// key continues to be accepted until the end of the overlap period
+type KeyRotation struct {
+	ID                 int       `json:"id"`
+	ModelID            int       `json:"model-id"`
+	KeyType            string    `json:"key-type"`
+	RetiringKeypairID  int       `json:"retiring-keypair-id"`
+	RetiringKeyID      string    `json:"retiring-key-id"`
+	SuccessorKeypairID int       `json:"successor-keypair-id"`
+	SuccessorKeyID     string    `json:"successor-key-id"`
+	PromoteAt          time.Time `json:"promote-at"`
+	OverlapUntil       time.Time `json:"overlap-until"`
+	Promoted           bool      `json:"promoted"`
+	Created            time.Time `json:"created"`
+}
+
+// CreateKeyRotationTable creates the database table for the key rotations
+func (db *DB) CreateKeyRotationTable() error {
+	_, err := db.Exec(createKeyRotationTableSQL)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(createKeyRotationModelIndexSQL)
+	return err
+}
+
+func (db *DB) listKeyRotations(modelID int) ([]KeyRotation, error) {
+	rotations := []KeyRotation{}
+
+	rows, err := db.Query(listKeyRotationsSQL, modelID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving the key rotations: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r := KeyRotation{}
+		err := rows.Scan(&r.ID, &r.ModelID, &r.KeyType, &r.RetiringKeypairID, &r.RetiringKeyID, &r.SuccessorKeypairID, &r.SuccessorKeyID,
+			&r.PromoteAt, &r.OverlapUntil, &r.Promoted, &r.Created)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving the key rotations: %v", err)
+		}
+		rotations = append(rotations, r)
+	}
+
+	return rotations, nil
+}
+
+func (db *DB) createKeyRotation(rotation KeyRotation) (KeyRotation, error) {
+	err := db.QueryRow(createKeyRotationSQL, rotation.ModelID, rotation.KeyType, rotation.RetiringKeypairID, rotation.SuccessorKeypairID,
+		rotation.PromoteAt, rotation.OverlapUntil).Scan(&rotation.ID)
+	if err != nil {
+		return rotation, fmt.Errorf("error creating the key rotation: %v", err)
+	}
+
+	return rotation, nil
+}
+
+func (db *DB) checkPendingKeyRotation(modelID int, keyType string) bool {
+	row := db.QueryRow(checkPendingKeyRotationSQL, modelID, keyType)
+	return db.checkBoolQuery(row)
+}
+
+func (db *DB) deleteKeyRotation(modelID, rotationID int) error {
+	result, err := db.Exec(deleteKeyRotationSQL, rotationID, modelID)
+	if err != nil {
+		return fmt.Errorf("error deleting the key rotation: %v", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error deleting the key rotation: %v", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("cannot find a scheduled key rotation %d for the model", rotationID)
+	}
+	return nil
+}
+
+// PromoteKeyRotations promotes the successor keypairs of the rotations that are due, so
+// they become the model's keys. Returns the number of rotations that were promoted
+func (db *DB) PromoteKeyRotations() (int, error) {
+	// The factory receives the promoted keys from the cloud when it syncs the models
+	if InFactory() {
+		return 0, nil
+	}
+
+	count := 0
+	err := db.transaction(func(tx *sql.Tx) error {
+		rotations, err := listDueKeyRotations(tx, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+
+		for _, r := range rotations {
+			promoteSQL := promoteModelSigningKeySQL
+			if r.KeyType == KeyTypeSystemUser {
+				promoteSQL = promoteModelSystemUserKeySQL
+			}
+
+			if _, err = tx.Exec(promoteSQL, r.ModelID, r.SuccessorKeypairID); err != nil {
+				log.Printf("Error promoting the key rotation %d: %v\n", r.ID, err)
+				return err
+			}
+			if _, err = tx.Exec(updateKeyRotationPromotedSQL, r.ID); err != nil {
+				log.Printf("Error promoting the key rotation %d: %v\n", r.ID, err)
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// StartKeyRotations starts the background promotion of the key rotations that are due
+func StartKeyRotations() {
+	go promoteKeyRotations(keyRotationInterval)
+}
+
+func promoteKeyRotations(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := Environ.DB.PromoteKeyRotations(); err != nil {
+			log.Printf("Error promoting the key rotations: %v", err)
+		}
+	}
+}
+
+func listDueKeyRotations(tx *sql.Tx, now time.Time) ([]KeyRotation, error) {
+	rotations := []KeyRotation{}
+
+	rows, err := tx.Query(listDueKeyRotationsSQL, now)
+	if err != nil {
+		log.Printf("Error retrieving the due key rotations: %v\n", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r := KeyRotation{}
+		if err := rows.Scan(&r.ID, &r.ModelID, &r.KeyType, &r.SuccessorKeypairID); err != nil {
+			return nil, err
+		}
+		rotations = append(rotations, r)
+	}
+
+	return rotations, rows.Err()
+}
+
+// ListRotationKeypairs returns the retiring and successor keypairs of a model's key rotations
+// that are still in their overlap period. These are accepted as well as the model's current key
+func (db *DB) ListRotationKeypairs(modelID int, keyType string) ([]Keypair, error) {
+	keypairs := []Keypair{}
+
+	rows, err := db.Query(listRotationKeypairsSQL, modelID, keyType, time.Now().UTC())
+	if err != nil {
+		log.Printf("Error retrieving the key rotation keypairs: %v\n", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		keypair := Keypair{}
+		err := rows.Scan(&keypair.ID, &keypair.AuthorityID, &keypair.KeyID, &keypair.Active, &keypair.SealedKey, &keypair.Assertion, &keypair.KeyName)
+		if err != nil {
+			return nil, err
+		}
+		keypairs = append(keypairs, keypair)
+	}
+
+	return keypairs, rows.Err()
+}
+
+// ApplyDueKeyRotations uses the successor keys of the model's rotations that are due but have
+// not been promoted by the background job yet, without changing the model in the database
+func (db *DB) ApplyDueKeyRotations(model *Model) error {
+	// The factory receives the promoted keys from the cloud when it syncs the models
+	if InFactory() {
+		return nil
+	}
+
+	rows, err := db.Query(listDueRotationKeypairsSQL, model.ID, time.Now().UTC())
+	if err != nil {
+		log.Printf("Error retrieving the due key rotations: %v\n", err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var keyType string
+		k := Keypair{}
+		if err := rows.Scan(&keyType, &k.ID, &k.AuthorityID, &k.KeyID, &k.Active, &k.SealedKey, &k.Assertion, &k.KeyName); err != nil {
+			return err
+		}
+
+		if keyType == KeyTypeSystemUser {
+			model.KeypairIDUser, model.AuthorityIDUser, model.KeyIDUser = k.ID, k.AuthorityID, k.KeyID
+			model.KeyActiveUser, model.SealedKeyUser, model.AssertionUser = k.Active, k.SealedKey, k.Assertion
+		} else {
+			model.KeypairID, model.AuthorityID, model.KeyID = k.ID, k.AuthorityID, k.KeyID
+			model.KeyActive, model.SealedKey = k.Active, k.SealedKey
+		}
+	}
+
+	return rows.Err()
+}
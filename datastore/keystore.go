@@ -37,6 +37,7 @@ var (
 	FilesystemStore = KeypairStoreType{"filesystem"}
 	DatabaseStore   = KeypairStoreType{"database"}
 	TPM20Store      = KeypairStoreType{"tpm2.0"}
+	PKCS11Store     = KeypairStoreType{"pkcs11"}
 )
 
 // Common error messages.
@@ -57,6 +58,12 @@ type KeypairOperator interface {
 	UnsealKeypair(authorityID string, keyID string, base64SealedSigningKey string) error
 }
 
+// KeypairSigner interface used by keypair stores that sign assertions without exposing the signing-keys
+type KeypairSigner interface {
+	SignAssertion(assertType *asserts.AssertionType, headers map[string]interface{}, body []byte, keyID string) (asserts.Assertion, error)
+	PublicKey(keyID string) (asserts.PublicKey, error)
+}
+
 // KeypairDatabase holds the
 type KeypairDatabase struct {
 	KeyStoreType KeypairStoreType
@@ -104,6 +111,18 @@ func getKeyStore(config config.Settings) (*KeypairDatabase, error) {
 		keypairDB = KeypairDatabase{TPM20Store, db, &tpm20}
 		return &keypairDB, err
 
+	case PKCS11Store.Name:
+		// Initialize the PKCS#11 token, using the keystore secret as the user PIN
+		token := &pkcs11Token{module: config.PKCS11Module, label: config.PKCS11Token, pin: config.KeyStoreSecret}
+
+		// The memory store is not used for the signing-keys, as they never leave the token
+		db, err := asserts.OpenDatabase(&asserts.DatabaseConfig{
+			KeypairManager: asserts.NewMemoryKeypairManager(),
+		})
+
+		keypairDB = KeypairDatabase{PKCS11Store, db, &PKCS11KeypairOperator{token: token}}
+		return &keypairDB, err
+
 	case FilesystemStore.Name:
 		fsStore, err := asserts.OpenFSKeypairManager(config.KeyStorePath)
 		if err != nil {
@@ -137,6 +156,11 @@ func (kdb *KeypairDatabase) ImportSigningKey(authorityID, base64PrivateKey strin
 		sealedPrivateKey, err := kdb.keypairOperator.ImportKeypair(authorityID, privateKey.PublicKey().ID(), base64PrivateKey)
 		return privateKey, sealedPrivateKey, err
 
+	case PKCS11Store.Name:
+		// The signing-key is stored on the token, so nothing is sealed for storage
+		_, err := kdb.keypairOperator.ImportKeypair(authorityID, privateKey.PublicKey().ID(), base64PrivateKey)
+		return privateKey, "", err
+
 	default:
 		// Keypairs are handled by the snapd library, so this is a pass-through to the core library
 		return privateKey, "", kdb.ImportKey(privateKey)
@@ -161,6 +185,14 @@ func (kdb *KeypairDatabase) SignAssertion(assertType *asserts.AssertionType, hea
 		// Sign the key using the unsealed key in the memory keypair store
 		return kdb.Sign(assertType, headers, body, keyID)
 
+	case PKCS11Store.Name:
+		// Sign the assertion on the token
+		signer, ok := kdb.keypairOperator.(KeypairSigner)
+		if !ok {
+			return nil, ErrorInvalidKeystoreType
+		}
+		return signer.SignAssertion(assertType, headers, body, keyID)
+
 	default:
 		// Filesystem keypairs are handled by the snapd library, so this is a pass-through to the core library
 		return kdb.Sign(assertType, headers, body, keyID)
@@ -174,7 +206,10 @@ func (kdb *KeypairDatabase) LoadKeypair(authorityID string, keyID string, sealed
 		fallthrough
 
 	case TPM20Store.Name:
-		// Use an internal operator to handle decryption of signing-keys from storage
+		fallthrough
+
+	case PKCS11Store.Name:
+		// Use an internal operator to unseal the signing-key, or check it is on the token
 		err := kdb.keypairOperator.UnsealKeypair(authorityID, keyID, sealedSigningKey)
 		return err
 
@@ -183,3 +218,12 @@ func (kdb *KeypairDatabase) LoadKeypair(authorityID string, keyID string, sealed
 		return nil
 	}
 }
+
+// PublicKey returns the public key of a signing-key from the keypair store
+func (kdb *KeypairDatabase) PublicKey(keyID string) (asserts.PublicKey, error) {
+	if signer, ok := kdb.keypairOperator.(KeypairSigner); ok {
+		// The signing-key is held outside of the memory store
+		return signer.PublicKey(keyID)
+	}
+	return kdb.Database.PublicKey(keyID)
+}
@@ -23,12 +23,16 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 )
 
 // MockDB holds the successful mocks for the database
 type MockDB struct {
 	encryptedAuthKeyHash string
+	sealedKeypair        Keypair
+	reserved             map[int]int
+	identities           map[int]string
 }
 
 // CreateModelTable mock for the create model table method
@@ -53,6 +57,9 @@ func (mdb *MockDB) AlterKeypairTable() error {
 
 // UpdateKeypairAssertion mock to update the account-key assertion of a keypair
 func (mdb *MockDB) UpdateKeypairAssertion(keypair Keypair, authorization User) (string, error) {
+	if !mdb.AllowedPermission(authorization, keypair.AuthorityID, PermissionKeypairCreate) {
+		return "error-auth", errorPermission(keypair.AuthorityID, PermissionKeypairCreate)
+	}
 	return "", nil
 }
 
@@ -133,7 +140,7 @@ func (mdb *MockDB) UpdateAccount(account Account, authorization User) error {
 func (mdb *MockDB) ListAllowedModels(authorization User) ([]Model, error) {
 
 	var models []Model
-	if authorization.Username == "" || authorization.Username == "sv" || authorization.Username == "sync" {
+	if authorization.Username == "" || authorization.Username == "sv" || authorization.Username == "sync" || authorization.Username == "reader" {
 		models = append(models, Model{ID: 1, BrandID: "system", Name: "alder", KeypairID: 1, AuthorityID: "system", KeyID: "UytTqTvREVhx0tSfYC6KkFHmLWllIIZbQ3NsEG7OARrWuaXSRJyey0vjIQkTEvMO", SealedKey: "", KeyActive: true, KeypairIDUser: 1, AuthorityIDUser: "system", KeyIDUser: "UytTqTvREVhx0tSfYC6KkFHmLWllIIZbQ3NsEG7OARrWuaXSRJyey0vjIQkTEvMO", SealedKeyUser: "", KeyActiveUser: true})
 		models = append(models, Model{ID: 2, BrandID: "system", Name: "ash", KeypairID: 1, AuthorityID: "system", KeyID: "UytTqTvREVhx0tSfYC6KkFHmLWllIIZbQ3NsEG7OARrWuaXSRJyey0vjIQkTEvMO", SealedKey: "", KeyActive: false})
 		models = append(models, Model{ID: 3, BrandID: "system", Name: "basswood", KeypairID: 1, AuthorityID: "system", KeyID: "UytTqTvREVhx0tSfYC6KkFHmLWllIIZbQ3NsEG7OARrWuaXSRJyey0vjIQkTEvMO", SealedKey: "", KeyActive: true})
@@ -166,6 +173,21 @@ func (mdb *MockDB) FindModel(brandID, modelName, apiKey string) (Model, error) {
 	if modelName == "generic-classic" {
 		model = Model{ID: 1, BrandID: "generic", Name: "generic-classic", KeypairID: 1, AuthorityID: "generic", KeyID: "UytTqTvREVhx0tSfYC6KkFHmLWllIIZbQ3NsEG7OARrWuaXSRJyey0vjIQkTEvMO", KeyActive: true, SealedKey: ""}
 	}
+	if modelName == "alder-reject" {
+		model = Model{ID: 1, BrandID: "system", Name: "alder-reject", KeypairID: 1, AuthorityID: "system", KeyID: "UytTqTvREVhx0tSfYC6KkFHmLWllIIZbQ3NsEG7OARrWuaXSRJyey0vjIQkTEvMO", KeyActive: true, SealedKey: "", DuplicatePolicy: DuplicatePolicyReject}
+	}
+	if modelName == "alder-samekey" {
+		model = Model{ID: 1, BrandID: "system", Name: "alder-samekey", KeypairID: 1, AuthorityID: "system", KeyID: "UytTqTvREVhx0tSfYC6KkFHmLWllIIZbQ3NsEG7OARrWuaXSRJyey0vjIQkTEvMO", KeyActive: true, SealedKey: "", DuplicatePolicy: DuplicatePolicySameDeviceKey}
+	}
+	if modelName == "alder-resigns" {
+		model = Model{ID: 1, BrandID: "system", Name: "alder-resigns", KeypairID: 1, AuthorityID: "system", KeyID: "UytTqTvREVhx0tSfYC6KkFHmLWllIIZbQ3NsEG7OARrWuaXSRJyey0vjIQkTEvMO", KeyActive: true, SealedKey: "", DuplicatePolicy: DuplicatePolicyMaxResigns, MaxResigns: 2}
+	}
+	if brandID == "vendor" && strings.HasPrefix(modelName, "alder-vendor") {
+		model = Model{ID: 8, BrandID: "vendor", Name: modelName, KeypairID: 1, AuthorityID: "vendor", KeyID: "UytTqTvREVhx0tSfYC6KkFHmLWllIIZbQ3NsEG7OARrWuaXSRJyey0vjIQkTEvMO", KeyActive: true, SealedKey: ""}
+	}
+	if modelName == "alder-quota" || modelName == "alder-quota-used" {
+		model = Model{ID: 1, BrandID: "system", Name: modelName, KeypairID: 1, AuthorityID: "system", KeyID: "UytTqTvREVhx0tSfYC6KkFHmLWllIIZbQ3NsEG7OARrWuaXSRJyey0vjIQkTEvMO", KeyActive: true, SealedKey: ""}
+	}
 	if modelName == "inactive" {
 		model = Model{ID: 1, BrandID: "system", Name: "inactive", KeypairID: 1, AuthorityID: "system", KeyID: "UytTqTvREVhx0tSfYC6KkFHmLWllIIZbQ3NsEG7OARrWuaXSRJyey0vjIQkTEvMO", KeyActive: false, SealedKey: ""}
 	}
@@ -217,6 +239,18 @@ func (mdb *MockDB) GetAllowedModel(modelID int, authorization User) (Model, erro
 	return model, nil
 }
 
+// getAllowedModelToEdit mocks the check that the user can update the model
+func (mdb *MockDB) getAllowedModelToEdit(modelID int, authorization User) (Model, error) {
+	model, err := mdb.GetAllowedModel(modelID, authorization)
+	if err != nil {
+		return model, err
+	}
+	if !mdb.AllowedPermission(authorization, model.BrandID, PermissionModelEdit) {
+		return model, errorPermission(model.BrandID, PermissionModelEdit)
+	}
+	return model, nil
+}
+
 // UpdateAllowedModel mocks the model update.
 func (mdb *MockDB) UpdateAllowedModel(model Model, authorization User) (string, error) {
 	models, _ := mdb.ListAllowedModels(authorization)
@@ -229,6 +263,9 @@ func (mdb *MockDB) UpdateAllowedModel(model Model, authorization User) (string,
 	for _, mdl := range models {
 		if mdl.ID == model.ID {
 			found = true
+			if len(model.APIKey) > 0 && model.APIKey != mdl.APIKey {
+				return "error-model-apikey", errorModelAPIKey(model.ID)
+			}
 			break
 		}
 	}
@@ -318,6 +355,25 @@ func (mdb *MockDB) CheckKeypairKeynameExists(authorityID, name string) bool {
 	return false
 }
 
+// ResealKeypairs mocks re-sealing the stored signing-key
+func (mdb *MockDB) ResealKeypairs(reseal func(keypair Keypair, authKeyHash string) (string, string, error)) (int, error) {
+	if len(mdb.sealedKeypair.SealedKey) == 0 {
+		return 0, nil
+	}
+
+	sealedKey, authKeyHash, err := reseal(mdb.sealedKeypair, mdb.encryptedAuthKeyHash)
+	if err != nil {
+		return 0, err
+	}
+	if sealedKey == mdb.sealedKeypair.SealedKey && authKeyHash == mdb.encryptedAuthKeyHash {
+		return 0, nil
+	}
+
+	mdb.sealedKeypair.SealedKey = sealedKey
+	mdb.encryptedAuthKeyHash = authKeyHash
+	return 1, nil
+}
+
 // SyncKeypair database mock
 func (mdb *MockDB) SyncKeypair(keypair SyncKeypair) error {
 	return nil
@@ -325,6 +381,10 @@ func (mdb *MockDB) SyncKeypair(keypair SyncKeypair) error {
 
 // UpdateAllowedKeypairActive database mock
 func (mdb *MockDB) UpdateAllowedKeypairActive(keypairID int, active bool, authorization User) error {
+	keypair, _ := mdb.GetKeypair(keypairID)
+	if !mdb.AllowedPermission(authorization, keypair.AuthorityID, PermissionKeypairCreate) {
+		return errorPermission(keypair.AuthorityID, PermissionKeypairCreate)
+	}
 	return nil
 }
 
@@ -372,12 +432,33 @@ func (mdb *MockDB) CheckForDuplicate(signLog *SigningLog) (bool, int, error) {
 	switch signLog.SerialNumber {
 	case "Aduplicate":
 		return true, 3, nil
+	case "Areflashed":
+		return true, 1, nil
+	case "Akeyreused":
+		// The device-key has been signed for another serial number
+		return true, 0, nil
 	case "AnError":
 		return false, 0, errors.New("Error in check for duplicate")
 	}
 	return false, 0, nil
 }
 
+// FindMaxResignRevision database mock
+func (mdb *MockDB) FindMaxResignRevision(signLog SigningLog) (int, error) {
+	switch signLog.SerialNumber {
+	case "Aduplicate", "Akeyreused":
+		return 3, nil
+	case "Areflashed":
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// CheckForDeviceKeyConflict database mock
+func (mdb *MockDB) CheckForDeviceKeyConflict(signLog SigningLog) (bool, error) {
+	return signLog.SerialNumber == "Aduplicate", nil
+}
+
 // CheckForMatching database mock
 func (mdb *MockDB) CheckForMatching(signLog SigningLog) (bool, error) {
 	switch signLog.SerialNumber {
@@ -397,6 +478,16 @@ func (mdb *MockDB) CreateSigningLog(signLog SigningLog) error {
 	return nil
 }
 
+// CreateSigningLogs database mock
+func (mdb *MockDB) CreateSigningLogs(signLogs []SigningLog) error {
+	for _, signLog := range signLogs {
+		if err := mdb.CreateSigningLog(signLog); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // CreateSigningLogSync database mock
 func (mdb *MockDB) CreateSigningLogSync(signLog SigningLog) error {
 	if signLog.SerialNumber == "AsigninglogError" {
@@ -425,6 +516,61 @@ func (mdb *MockDB) ListAllowedSigningLogForAccount(authorization User, authority
 	return mdb.ListAllowedSigningLog(authorization)
 }
 
+// ExportAllowedSigningLog database mock
+func (mdb *MockDB) ExportAllowedSigningLog(authorization User, authorityID string, params SigningLogExportParams, export func(SigningLog) error) error {
+	logs, _ := mdb.ListAllowedSigningLog(authorization)
+	for _, l := range logs {
+		if err := export(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportSigningLog database mock
+func (mdb *MockDB) ExportSigningLog(authorityID string, params SigningLogExportParams, export func(SigningLog) error) error {
+	return mdb.ExportAllowedSigningLog(User{}, authorityID, params, export)
+}
+
+// CreateSigningLogArchiveTable database mock
+func (mdb *MockDB) CreateSigningLogArchiveTable() error {
+	return nil
+}
+
+// ArchiveSigningLogs database mock
+func (mdb *MockDB) ArchiveSigningLogs(before time.Time, limit int, archiveTable bool, archive func([]SigningLog) error) (int, error) {
+	logs, _ := mdb.ListAllowedSigningLog(User{})
+	if len(logs) > limit {
+		logs = logs[:limit]
+	}
+	if archive != nil {
+		if err := archive(logs); err != nil {
+			return 0, err
+		}
+	}
+	return len(logs), nil
+}
+
+// AllowedSigningReport database mock
+func (mdb *MockDB) AllowedSigningReport(authorization User, params SigningReportParams) ([]SigningReport, error) {
+	if _, ok := reportPeriodSQL[params.Period]; !ok {
+		return nil, fmt.Errorf("the report period must be '%s', '%s' or '%s'", ReportDay, ReportWeek, ReportMonth)
+	}
+	reports := []SigningReport{
+		{Period: "2020-01-06", AuthorityID: "system", Model: "alder", Signed: 4, Resigned: 1, ResignRate: 0.25, Factory: 3, Cloud: 1},
+		{Period: "2020-01-06", AuthorityID: "system", Model: "ash", Signed: 2, Factory: 2, Remodels: 1},
+	}
+	if len(authorization.Username) > 0 {
+		return reports[:1], nil
+	}
+	return reports, nil
+}
+
+// SigningReport database mock
+func (mdb *MockDB) SigningReport(params SigningReportParams) ([]SigningReport, error) {
+	return mdb.AllowedSigningReport(User{}, params)
+}
+
 // SyncSigningLog database mock
 func (mdb *MockDB) SyncSigningLog() ([]SigningLog, error) {
 	signingLog := []SigningLog{}
@@ -449,21 +595,6 @@ func (mdb *MockDB) CreateDeviceNonceTable() error {
 	return nil
 }
 
-// DeleteExpiredDeviceNonces database mock
-func (mdb *MockDB) DeleteExpiredDeviceNonces() error {
-	return nil
-}
-
-// CreateDeviceNonce database mock
-func (mdb *MockDB) CreateDeviceNonce() (DeviceNonce, error) {
-	return DeviceNonce{Nonce: "1234567890", TimeStamp: 1234567890}, nil
-}
-
-// ValidateDeviceNonce database mock
-func (mdb *MockDB) ValidateDeviceNonce(nonce string) error {
-	return nil
-}
-
 // CreateOpenidNonceTable database mock
 func (mdb *MockDB) CreateOpenidNonceTable() error {
 	return nil
@@ -494,6 +625,59 @@ func (mdb *MockDB) AlterUserTable() error {
 	return nil
 }
 
+// HashUserAPIKeys mock for hashing the API keys of the users
+func (mdb *MockDB) HashUserAPIKeys() error {
+	return nil
+}
+
+// HashModelAPIKeys mock for replacing the model API keys with their hashes
+func (mdb *MockDB) HashModelAPIKeys() error {
+	return nil
+}
+
+// ResetUserAPIKey mock for generating a new API key for a user
+func (mdb *MockDB) ResetUserAPIKey(userID int) (string, error) {
+	return "ResetUserAPIKey", nil
+}
+
+// AlterUserProvisioned mock for adding the provisioned field to the user table
+func (mdb *MockDB) AlterUserProvisioned() error {
+	return nil
+}
+
+// AlterUserOIDCIdentity mock for adding the OpenID Connect identity field to the user table
+func (mdb *MockDB) AlterUserOIDCIdentity() error {
+	return nil
+}
+
+// BindUserOIDCIdentity mock for binding a user to the identity of their first login
+func (mdb *MockDB) BindUserOIDCIdentity(userID int, identity string) (bool, error) {
+	if mdb.identities == nil {
+		mdb.identities = make(map[int]string)
+	}
+	if _, ok := mdb.identities[userID]; !ok {
+		mdb.identities[userID] = identity
+	}
+	return mdb.identities[userID] == identity, nil
+}
+
+// ProvisionUser mock for creating or updating a user from the role mappings
+func (mdb *MockDB) ProvisionUser(user User) (int, error) {
+	if err := validateUser(user); err != nil {
+		return 0, err
+	}
+	if u, err := mdb.GetUserByUsername(user.Username); err == nil {
+		return u.ID, nil
+	}
+	return 740, nil
+}
+
+// DeprovisionUser mock for removing the access of a provisioned user
+func (mdb *MockDB) DeprovisionUser(userID int) error {
+	_, err := mdb.GetUser(userID)
+	return err
+}
+
 // CreateUser mock for create user operation
 func (mdb *MockDB) CreateUser(user User) (int, error) {
 	return 740, nil
@@ -576,6 +760,19 @@ func (mdb *MockDB) ListUsers() ([]User, error) {
 				Assertion:   "assertioncontent4",
 			},
 		}})
+	users = append(users, User{
+		ID:       7,
+		Username: "reader",
+		Name:     "Log Reader",
+		Email:    "reader@example.com",
+		Role:     Admin,
+		Accounts: []Account{
+			{
+				ID:          5,
+				AuthorityID: "system",
+				Assertion:   "assertioncontent5",
+			},
+		}})
 
 	return users, nil
 }
@@ -615,11 +812,27 @@ func (mdb *MockDB) GetUserByUsername(username string) (User, error) {
 	return User{}, errors.New("Cannot find the user")
 }
 
-// GetUserByAPIKey mock returning the user if found by username in a fixed list of users
+// mockUserTokens are the personal access tokens known to the mock, by token
+var mockUserTokens = map[string]UserToken{
+	"TokenSigningLogRead":    {ID: 1, Label: "ci-logs", Scopes: []string{"signinglog:read"}, Enabled: true},
+	"TokenSigningLogAccount": {ID: 2, Label: "ci-logs-account", Scopes: []string{"signinglog:read"}, AuthorityID: "system", Enabled: true},
+	"TokenSync":              {ID: 3, Label: "factory", Scopes: []string{ScopeSync}, Enabled: true},
+}
+
+// GetUserByAPIKey mock returning the user if found by username in a fixed list of users. API keys
+// that start with 'Token' are treated as personal access tokens
 func (mdb *MockDB) GetUserByAPIKey(apiKey, username string) (User, error) {
 	users, _ := mdb.ListUsers()
 	for _, u := range users {
 		if u.Username == username {
+			if strings.HasPrefix(apiKey, "Token") {
+				t, ok := mockUserTokens[apiKey]
+				if !ok {
+					return User{}, errors.New("Cannot find the token")
+				}
+				t.UserID = u.ID
+				u.Token = &t
+			}
 			return u, nil
 		}
 	}
@@ -634,8 +847,11 @@ func (mdb *MockDB) UpdateUser(user User) error {
 
 // DeleteUser mock for delete user operation. Returns error if user not found in a fixed list of users
 func (mdb *MockDB) DeleteUser(userID int) error {
-	_, err := mdb.GetUser(userID)
-	return err
+	user, err := mdb.GetUser(userID)
+	if err != nil {
+		return err
+	}
+	return mdb.RevokeUserSessions(user.Username)
 }
 
 // ListUserAccounts mock returning a fixed list of accounts
@@ -813,6 +1029,14 @@ func (mdb *MockDB) GetSubstore(fromModelID int, serialNumber string) (Substore,
 		return Substore{ID: 2, AccountID: 1, FromModelID: 1, FromModel: fromModel, Store: "mybrand", SerialNumber: "abc1234X", ModelName: "alder-mybrand-2"}, nil
 	}
 
+	// The original model has rotated its signing-key, and the retiring key is in the overlap period
+	if serialNumber == "A123456R" {
+		fromModel.ID = 99
+		fromModel.KeypairID = 3
+		fromModel.KeyID = "successorkey"
+		return Substore{ID: 3, AccountID: 1, FromModelID: 99, FromModel: fromModel, Store: "mybrand", SerialNumber: "A123456R", ModelName: "alder-mybrand"}, nil
+	}
+
 	return Substore{ID: 1, AccountID: 1, FromModelID: 1, FromModel: fromModel, Store: "mybrand", SerialNumber: "abc1234", ModelName: "alder-mybrand"}, nil
 }
 
@@ -829,177 +1053,1116 @@ func (mdb *MockDB) GetAllowedSubstore(fromModelID int, serialNumber string, auth
 	return mdb.GetSubstore(fromModelID, serialNumber)
 }
 
-// CreateTestLog mock to create a test log
-func (mdb *MockDB) CreateTestLog(testLog TestLog) error {
+// CreateKeyRotationTable mock for the create key rotation table method
+func (mdb *MockDB) CreateKeyRotationTable() error {
 	return nil
 }
 
-// ListAllowedTestLog database mock
-func (mdb *MockDB) ListAllowedTestLog(authorization User) ([]TestLog, error) {
-	logs := []TestLog{
-		{ID: 1, Brand: "system", Model: "alder", Filename: "test1.xml"},
-		{ID: 2, Brand: "system", Model: "alder", Filename: "test2.xml"},
+// ListAllowedKeyRotations mock to list the key rotations of a model
+func (mdb *MockDB) ListAllowedKeyRotations(modelID int, authorization User) ([]KeyRotation, error) {
+	if _, err := mdb.GetAllowedModel(modelID, authorization); err != nil {
+		return nil, err
 	}
-	return logs, nil
+
+	rotations := []KeyRotation{
+		{ID: 1, ModelID: modelID, KeyType: KeyTypeSigning, RetiringKeypairID: 1, RetiringKeyID: "UytTqTvREVhx0tSfYC6KkFHmLWllIIZbQ3NsEG7OARrWuaXSRJyey0vjIQkTEvMO", SuccessorKeypairID: 2, SuccessorKeyID: "invalidone"},
+	}
+	return rotations, nil
 }
 
-// SyncListTestLogs database mock
-func (mdb *MockDB) SyncListTestLogs() ([]TestLog, error) {
-	logs := []TestLog{
-		{ID: 1, Brand: "system", Model: "alder", Filename: "test1.xml"},
-		{ID: 2, Brand: "system", Model: "alder", Filename: "test2.xml"},
+// CreateAllowedKeyRotation mock to schedule a key rotation
+func (mdb *MockDB) CreateAllowedKeyRotation(rotation KeyRotation, authorization User) (KeyRotation, error) {
+	if _, err := mdb.getAllowedModelToEdit(rotation.ModelID, authorization); err != nil {
+		return rotation, err
 	}
-	return logs, nil
+	if rotation.SuccessorKeypairID == 1 {
+		return rotation, errors.New("the successor signing-key must be different to the current signing-key")
+	}
+
+	rotation.ID = 2
+	rotation.RetiringKeypairID = 1
+	return rotation, nil
 }
 
-// SyncDeleteTestLog database mock
-func (mdb *MockDB) SyncDeleteTestLog(ID int) error {
-	if ID > 2 {
-		return errors.New("MOCK error deleting the test log")
+// DeleteAllowedKeyRotation mock to cancel a key rotation
+func (mdb *MockDB) DeleteAllowedKeyRotation(modelID, rotationID int, authorization User) error {
+	if _, err := mdb.getAllowedModelToEdit(modelID, authorization); err != nil {
+		return err
+	}
+	if rotationID != 1 {
+		return fmt.Errorf("cannot find a scheduled key rotation %d for the model", rotationID)
 	}
 	return nil
 }
 
-// UpdateAllowedTestLog database mock
-func (mdb *MockDB) UpdateAllowedTestLog(ID int, authorization User) error {
-	if authorization.Role >= SyncUser {
-		return nil
+// PromoteKeyRotations mock to promote the due key rotations
+func (mdb *MockDB) PromoteKeyRotations() (int, error) {
+	return 0, nil
+}
+
+// ApplyDueKeyRotations mock to use the successor keys of the due key rotations
+func (mdb *MockDB) ApplyDueKeyRotations(model *Model) error {
+	return nil
+}
+
+// ListRotationKeypairs mock to list the keypairs of the key rotations in their overlap period.
+// The model with ID 99 has rotated from the system keypair
+func (mdb *MockDB) ListRotationKeypairs(modelID int, keyType string) ([]Keypair, error) {
+	if modelID == 99 && keyType == KeyTypeSigning {
+		return []Keypair{keypairSystem(), {ID: 3, AuthorityID: "generic", KeyID: "successorkey", Active: true}}, nil
 	}
-	return errors.New("MOCK no permissions to update the test log")
+	return []Keypair{}, nil
 }
 
-// HealthCheck mock for a healthy datastore
-func (mdb *MockDB) HealthCheck() error {
+// CreateSerialAllowlistTable mock for the create serial allowlist table method
+func (mdb *MockDB) CreateSerialAllowlistTable() error {
 	return nil
 }
 
-// -----------------------------------------------------------------------------
+// ListAllowedSerialAllowlist mock to list the serial number allowlist of a model
+func (mdb *MockDB) ListAllowedSerialAllowlist(modelID int, status, after string, authorization User) ([]SerialAllowlist, error) {
+	if _, err := mdb.GetAllowedModel(modelID, authorization); err != nil {
+		return nil, err
+	}
 
-// ErrorMockDB holds the unsuccessful mocks for the database
-type ErrorMockDB struct{}
+	serials := []SerialAllowlist{}
+	for _, s := range []SerialAllowlist{
+		{ID: 1, ModelID: modelID, SerialNumber: "A0001", Status: SerialStatusSigned},
+		{ID: 2, ModelID: modelID, SerialNumber: "A0002", Status: SerialStatusPending},
+	} {
+		if (status == "" || s.Status == status) && s.SerialNumber > after {
+			serials = append(serials, s)
+		}
+	}
+	return serials, nil
+}
 
-// CreateModelTable mock for the create model table method
-func (mdb *ErrorMockDB) CreateModelTable() error {
-	return errors.New("Error creating the model table")
+// ImportAllowedSerialAllowlist mock to import serial numbers to a model's allowlist
+func (mdb *MockDB) ImportAllowedSerialAllowlist(modelID int, serials []SerialAllowlistImport, authorization User) (int, error) {
+	if _, err := mdb.getAllowedModelToEdit(modelID, authorization); err != nil {
+		return 0, err
+	}
+
+	serialNumbers, err := expandSerialAllowlistImport(serials)
+	return len(serialNumbers), err
 }
 
-// AlterModelTable mock for the alter model table method
-func (mdb *ErrorMockDB) AlterModelTable() error {
-	return nil
+// DeleteAllowedSerialAllowlist mock to remove a serial number from a model's allowlist
+func (mdb *MockDB) DeleteAllowedSerialAllowlist(modelID, serialID int, authorization User) error {
+	_, err := mdb.getAllowedModelToEdit(modelID, authorization)
+	return err
 }
 
-// CreateKeypairTable mock for the create keypair table method
-func (mdb *ErrorMockDB) CreateKeypairTable() error {
+// CheckSerialAllowlist mock to check a serial number against the model's allowlist
+func (mdb *MockDB) CheckSerialAllowlist(modelID int, serialNumber string) error {
+	switch serialNumber {
+	case "UNREGISTERED":
+		return ErrorSerialNotAllowed
+	case "REVOKED":
+		return ErrorSerialRevoked
+	}
 	return nil
 }
 
-// AlterKeypairTable mock for the alter keypair table method
-func (mdb *ErrorMockDB) AlterKeypairTable() error {
+// UpdateSerialAllowlistSigned mock to mark a serial number as signed
+func (mdb *MockDB) UpdateSerialAllowlistSigned(modelID int, serialNumber string) error {
 	return nil
 }
 
-// UpdateKeypairAssertion mock to update the account-key assertion of a keypair
-func (mdb *ErrorMockDB) UpdateKeypairAssertion(keypair Keypair, authorization User) (string, error) {
-	return "invalid-assertion", errors.New("MOCK Error updating the keypair assertion")
+// SyncSerialAllowlist mock to replace a model's allowlist in the factory
+func (mdb *MockDB) SyncSerialAllowlist(modelID int, serials []SerialAllowlist) error {
+	return nil
 }
 
-// CreateSettingsTable mock for the create settings table method
-func (mdb *ErrorMockDB) CreateSettingsTable() error {
+// CreateSerialRevocationTable mock for the create serial revocation table method
+func (mdb *MockDB) CreateSerialRevocationTable() error {
 	return nil
 }
 
-// CreateAccountTable mock for the create account table method
-func (mdb *ErrorMockDB) CreateAccountTable() error {
-	return nil
+// ListSerialRevocations mock to list the revoked serial assertions of a model
+func (mdb *MockDB) ListSerialRevocations(brandID, modelName string) ([]SerialRevocation, error) {
+	return []SerialRevocation{
+		{ID: 1, BrandID: brandID, Model: modelName, SerialNumber: "R12345", Revision: 0, Reason: "Stolen device", Created: time.Now()},
+		{ID: 2, BrandID: brandID, Model: modelName, SerialNumber: "R23456", Revision: 2, Reason: "Compromised device-key", Created: time.Now()},
+	}, nil
 }
 
-// AlterAccountTable mock for the create account table method
-func (mdb *ErrorMockDB) AlterAccountTable() error {
-	return nil
+// CreateSerialRevocation mock to revoke a serial assertion
+func (mdb *MockDB) CreateSerialRevocation(revocation SerialRevocation) (SerialRevocation, error) {
+	if err := validateSerialRevocation(revocation); err != nil {
+		return revocation, err
+	}
+	if revocation.SerialNumber == "R12345" {
+		return revocation, errors.New("The serial assertion has already been revoked")
+	}
+	revocation.ID = 3
+	revocation.Created = time.Now()
+	return revocation, nil
 }
 
-// CreateAccount mock to create an account record
-func (mdb *ErrorMockDB) CreateAccount(account Account) error {
-	return errors.New("MOCK creating the account")
+// ListAllowedSerialRevocations mock to list the revoked serial assertions of a model
+func (mdb *MockDB) ListAllowedSerialRevocations(modelID int, authorization User) ([]SerialRevocation, error) {
+	model, err := mdb.GetAllowedModel(modelID, authorization)
+	if err != nil {
+		return nil, err
+	}
+	return mdb.ListSerialRevocations(model.BrandID, model.Name)
 }
 
-// GetAccount mock to return a single account key
-func (mdb *ErrorMockDB) GetAccount(authorityID string) (Account, error) {
+// CreateAllowedSerialRevocation mock to revoke a serial assertion of a model
+func (mdb *MockDB) CreateAllowedSerialRevocation(modelID int, revocation SerialRevocation, authorization User) (SerialRevocation, error) {
+	model, err := mdb.getAllowedModelToEdit(modelID, authorization)
+	if err != nil {
+		return revocation, err
+	}
+	revocation.BrandID = model.BrandID
+	revocation.Model = model.Name
+	return mdb.CreateSerialRevocation(revocation)
+}
 
-	accounts, _ := mdb.ListAllowedAccounts(User{})
+// DeleteAllowedSerialRevocation mock to remove the revocation of a serial assertion
+func (mdb *MockDB) DeleteAllowedSerialRevocation(modelID, revocationID int, authorization User) error {
+	if _, err := mdb.getAllowedModelToEdit(modelID, authorization); err != nil {
+		return err
+	}
+	if revocationID != 1 {
+		return errors.New("Cannot find the serial revocation")
+	}
+	return nil
+}
 
-	for _, acc := range accounts {
-		if acc.AuthorityID == authorityID {
-			return acc, nil
-		}
+// SyncSerialRevocations mock to replace a model's revocations in the factory
+func (mdb *MockDB) SyncSerialRevocations(brandID, modelName string, revocations []SerialRevocation) error {
+	return nil
+}
+
+// CheckSerialRevoked mock to check whether a serial assertion has been revoked
+func (mdb *MockDB) CheckSerialRevoked(brandID, modelName, serialNumber string, revision int) (bool, error) {
+	switch serialNumber {
+	case "R12345":
+		return true, nil
+	case "R23456":
+		return revision == 0 || revision == 2, nil
+	case "RError":
+		return false, errors.New("Error checking the serial revocations")
 	}
-	return Account{}, errors.New("Cannot found the account assertion")
+	return false, nil
 }
 
-// GetAccountByID mock to return a single account key
-func (mdb *ErrorMockDB) GetAccountByID(ID int, user User) (Account, error) {
+// CreateRemodelRuleTable mock for the create remodel rule table method
+func (mdb *MockDB) CreateRemodelRuleTable() error {
+	return nil
+}
 
-	accounts, _ := mdb.ListAllowedAccounts(user)
+// ListRemodelRules mock to list the remodel rules of a model
+func (mdb *MockDB) ListRemodelRules(modelID int) ([]RemodelRule, error) {
+	return []RemodelRule{
+		{ID: 1, FromModelID: modelID, FromBrandID: "system", FromModelName: "alder", ToModelID: 8, ToBrandID: "vendor", ToModelName: "alder-vendor", SerialMapping: RemodelSerialKeep, Created: time.Now()},
+	}, nil
+}
 
-	for _, acc := range accounts {
-		if acc.ID == ID {
-			return acc, nil
-		}
+// GetRemodelRule mock to get the remodel rule for the original and new models
+func (mdb *MockDB) GetRemodelRule(fromBrandID, fromModel, toBrandID, toModel string) (RemodelRule, error) {
+	rule := RemodelRule{FromModelID: 1, FromBrandID: fromBrandID, FromModelName: fromModel, ToModelID: 8, ToBrandID: toBrandID, ToModelName: toModel}
+	if fromBrandID != "system" || fromModel != "alder" || toBrandID != "vendor" {
+		return rule, errors.New("Cannot find a remodel rule for the models")
 	}
-	return Account{}, errors.New("Cannot found the account assertion")
-}
 
-// GetAllowedAccount mock to fetch account
-func (mdb *ErrorMockDB) GetAllowedAccount(authorityID string, authorization User) (Account, error) {
-	return Account{}, errors.New("MOCK error getting the account")
+	switch toModel {
+	case "alder-vendor":
+		rule.ID = 1
+		rule.SerialMapping = RemodelSerialKeep
+	case "alder-vendor-prefix":
+		rule.ID = 2
+		rule.SerialMapping = RemodelSerialPrefix
+		rule.SerialPrefix = "V-"
+	case "alder-vendor-any":
+		rule.ID = 3
+		rule.SerialMapping = RemodelSerialAny
+	default:
+		return rule, errors.New("Cannot find a remodel rule for the models")
+	}
+
+	rule.FromModel, _ = mdb.FindModel(fromBrandID, fromModel, "")
+	return rule, nil
 }
 
-// ListAllowedAccounts mock to return a list of the available accounts
-func (mdb *ErrorMockDB) ListAllowedAccounts(authorization User) ([]Account, error) {
-	return nil, errors.New("Error getting the accounts")
+// ListAllowedRemodelRules mock to list the remodel rules of a model
+func (mdb *MockDB) ListAllowedRemodelRules(modelID int, authorization User) ([]RemodelRule, error) {
+	model, err := mdb.GetAllowedModel(modelID, authorization)
+	if err != nil {
+		return nil, err
+	}
+	return mdb.ListRemodelRules(model.ID)
 }
 
-// PutAccount mock to update an account assertion
-func (mdb *ErrorMockDB) PutAccount(account Account, authorization User) (string, error) {
-	return "", errors.New("MOCK error upserting the account")
+// CreateAllowedRemodelRule mock to create a remodel rule for a model
+func (mdb *MockDB) CreateAllowedRemodelRule(modelID int, rule RemodelRule, authorization User) (RemodelRule, error) {
+	if _, err := mdb.getAllowedModelToEdit(modelID, authorization); err != nil {
+		return rule, err
+	}
+	if _, err := mdb.getAllowedModelToEdit(rule.ToModelID, authorization); err != nil {
+		return rule, err
+	}
+
+	rule.FromModelID = modelID
+	if err := validateRemodelRule(rule); err != nil {
+		return rule, err
+	}
+	if rule.ToModelID == 2 {
+		return rule, errors.New("A remodel rule already exists for these models")
+	}
+	rule.ID = 2
+	rule.Created = time.Now()
+	return rule, nil
 }
 
-// SyncAccount mock to update the account
-func (mdb *ErrorMockDB) SyncAccount(account Account) error {
-	return errors.New("MOCK error syncing the account")
+// DeleteAllowedRemodelRule mock to delete a remodel rule of a model
+func (mdb *MockDB) DeleteAllowedRemodelRule(modelID, ruleID int, authorization User) error {
+	if _, err := mdb.getAllowedModelToEdit(modelID, authorization); err != nil {
+		return err
+	}
+	if ruleID != 1 {
+		return errors.New("Cannot find the remodel rule")
+	}
+	return nil
 }
 
-// UpdateAccountAssertion mock to update the account assertion
-func (mdb *ErrorMockDB) UpdateAccountAssertion(authorityID, assertion string, resellerAPI bool) error {
+// CreateRemodelHistoryTable mock for the create remodel history table method
+func (mdb *MockDB) CreateRemodelHistoryTable() error {
 	return nil
 }
 
-// UpdateAccount mock to update the account
-func (mdb *ErrorMockDB) UpdateAccount(account Account, authorization User) error {
+// CreateRemodelHistory mock to record the remodel of a device
+func (mdb *MockDB) CreateRemodelHistory(history RemodelHistory) error {
+	if !validateStringsNotEmpty(history.FromBrandID, history.FromModel, history.FromSerial, history.ToBrandID, history.ToModel, history.ToSerial, history.Fingerprint) {
+		return errors.New("The original and new brand, model and serial number, and the device-key fingerprint must be supplied")
+	}
 	return nil
 }
 
-// ListAllowedModels ModelsList Mock the database response for a list of models
-func (mdb *ErrorMockDB) ListAllowedModels(authorization User) ([]Model, error) {
-	return nil, errors.New("Error getting the models")
+// ListRemodelHistory mock to list the remodels of a model
+func (mdb *MockDB) ListRemodelHistory(brandID, modelName string) ([]RemodelHistory, error) {
+	return []RemodelHistory{
+		{ID: 1, RuleID: 1, FromBrandID: brandID, FromModel: modelName, FromSerial: "A123456L", ToBrandID: "vendor", ToModel: "alder-vendor", ToSerial: "A123456L", Fingerprint: "fingerprint", Revision: 1, Created: time.Now()},
+	}, nil
 }
 
-// FindModel mocks the database response for finding a model, returning an invalid signing-key
-func (mdb *ErrorMockDB) FindModel(brandID, modelName, apiKey string) (Model, error) {
-	return Model{}, errors.New("Error finding the model")
+// ListAllowedRemodelHistory mock to list the remodels of a model
+func (mdb *MockDB) ListAllowedRemodelHistory(modelID int, authorization User) ([]RemodelHistory, error) {
+	model, err := mdb.GetAllowedModel(modelID, authorization)
+	if err != nil {
+		return nil, err
+	}
+	return mdb.ListRemodelHistory(model.BrandID, model.Name)
 }
 
-// CheckModelExists mocks the database response for finding a model
-func (mdb *ErrorMockDB) CheckModelExists(brandID, modelName string) bool {
-	return false
+// CreateModelQuotaTable mock for the create model quota table method
+func (mdb *MockDB) CreateModelQuotaTable() error {
+	return nil
 }
 
-// CheckAPIKey mocks the database response to check the API key
-func (mdb *ErrorMockDB) CheckAPIKey(apiKey string) bool {
-	return true
+// CreateModelUsageTable mock for the create model usage table method
+func (mdb *MockDB) CreateModelUsageTable() error {
+	return nil
 }
 
-// GetAllowedModel mocks the model from the database by ID, returning an error.
+// GetAPIKeyQuota mock to get the limits of an API key
+func (mdb *MockDB) GetAPIKeyQuota(apiKey string, now time.Time) (APIKeyQuota, error) {
+	m := ModelQuota{ModelID: 1, BrandID: "system", Model: "alder", DailyUsage: 5, MonthlyUsage: 50}
+	quota := APIKeyQuota{}
+	switch apiKey {
+	case "InvalidAPIKey":
+		return APIKeyQuota{}, nil
+	case "LimitedAPIKey":
+		quota.RateLimit = 2
+	case "DailyQuotaAPIKey":
+		m.DailyQuota, m.DailyUsage = 10, 10
+	case "MonthlyQuotaAPIKey":
+		m.MonthlyQuota, m.MonthlyUsage = 100, 100
+	case "SharedQuotaAPIKey":
+		m.DailyQuota, m.DailyUsage = 10, 10
+		quota.Models = append(quota.Models, ModelQuota{ModelID: 2, BrandID: "system", Model: "ash", DailyQuota: 10, DailyUsage: 5, MonthlyUsage: 50})
+	}
+	quota.Models = append([]ModelQuota{m}, quota.Models...)
+	return quota, nil
+}
+
+// ReserveModelQuota mock to reserve the quota of a model for the serials that are to be signed.
+// The reservations are added to the usage of the model's quota
+func (mdb *MockDB) ReserveModelQuota(model Model, count int, now time.Time) (bool, ModelQuota, error) {
+	if mdb.reserved == nil {
+		mdb.reserved = make(map[int]int)
+	}
+
+	quota, _ := mdb.GetModelQuota(model)
+	quota.DailyUsage += mdb.reserved[model.ID]
+	quota.MonthlyUsage += mdb.reserved[model.ID]
+	if (quota.DailyQuota > 0 && quota.DailyUsage+count > quota.DailyQuota) || (quota.MonthlyQuota > 0 && quota.MonthlyUsage+count > quota.MonthlyQuota) {
+		return false, quota, nil
+	}
+
+	mdb.reserved[model.ID] += count
+	quota.DailyUsage += count
+	quota.MonthlyUsage += count
+	return true, quota, nil
+}
+
+// ReleaseModelQuota mock to release the quota that was reserved for a model
+func (mdb *MockDB) ReleaseModelQuota(modelID, count int, now time.Time) error {
+	if mdb.reserved != nil {
+		mdb.reserved[modelID] -= count
+	}
+	return nil
+}
+
+// GetModelUsage mock to get the usage of a model
+func (mdb *MockDB) GetModelUsage(modelID int, now time.Time) (int, int, error) {
+	return 5, 50, nil
+}
+
+// GetModelQuota mock to get the quota of a model
+func (mdb *MockDB) GetModelQuota(model Model) (ModelQuota, error) {
+	quota := ModelQuota{ModelID: model.ID, BrandID: model.BrandID, Model: model.Name, DailyQuota: 10, MonthlyQuota: 100, DailyUsage: 5, MonthlyUsage: 50}
+	switch model.Name {
+	case "alder-quota":
+		quota.DailyQuota = 7
+	case "alder-quota-used":
+		quota.MonthlyQuota = 50
+	}
+	return quota, nil
+}
+
+// GetAllowedModelQuota mock to get the quota of a model
+func (mdb *MockDB) GetAllowedModelQuota(modelID int, authorization User) (ModelQuota, error) {
+	model, err := mdb.GetAllowedModel(modelID, authorization)
+	if err != nil {
+		return ModelQuota{}, err
+	}
+	return mdb.GetModelQuota(model)
+}
+
+// UpdateAllowedModelQuota mock to set the quota of a model
+func (mdb *MockDB) UpdateAllowedModelQuota(modelID int, quota ModelQuota, authorization User) (ModelQuota, error) {
+	model, err := mdb.getAllowedModelToEdit(modelID, authorization)
+	if err != nil {
+		return quota, err
+	}
+	if err := validateModelQuota(quota); err != nil {
+		return quota, err
+	}
+	quota.ModelID = model.ID
+	quota.BrandID = model.BrandID
+	quota.Model = model.Name
+	return quota, nil
+}
+
+// CreateModelAPIKeyTable mock for the create model API key table method
+func (mdb *MockDB) CreateModelAPIKeyTable() error {
+	return nil
+}
+
+// ListModelAPIKeys mock to list the named API keys of a model
+func (mdb *MockDB) ListModelAPIKeys(modelID int) ([]ModelAPIKey, error) {
+	created := time.Date(2020, time.March, 1, 10, 0, 0, 0, time.UTC)
+	return []ModelAPIKey{
+		{ID: 1, ModelID: modelID, Label: "line-1", KeyHash: HashAPIKey("LineOneAPIKey"), Created: created, Enabled: true},
+		{ID: 2, ModelID: modelID, Label: "line-2", KeyHash: HashAPIKey("LineTwoAPIKey"), Created: created, Enabled: false},
+	}, nil
+}
+
+// SyncModelAPIKeys mock to sync the named API keys of a model
+func (mdb *MockDB) SyncModelAPIKeys(keys []ModelAPIKey) error {
+	return nil
+}
+
+// ListAllowedModelAPIKeys mock to list the named API keys of a model
+func (mdb *MockDB) ListAllowedModelAPIKeys(modelID int, authorization User) ([]ModelAPIKey, error) {
+	if _, err := mdb.GetAllowedModel(modelID, authorization); err != nil {
+		return nil, err
+	}
+	return mdb.ListModelAPIKeys(modelID)
+}
+
+// CreateAllowedModelAPIKey mock to mint a named API key for a model
+func (mdb *MockDB) CreateAllowedModelAPIKey(key ModelAPIKey, authorization User) (ModelAPIKey, error) {
+	if _, err := mdb.getAllowedModelToEdit(key.ModelID, authorization); err != nil {
+		return key, err
+	}
+	if err := validateModelAPIKey(key); err != nil {
+		return key, err
+	}
+
+	key.ID = 3
+	key.APIKey = "MintedAPIKey"
+	key.KeyHash = HashAPIKey(key.APIKey)
+	key.Created = time.Now().UTC()
+	key.Enabled = true
+	return key, nil
+}
+
+// RevokeAllowedModelAPIKey mock to disable a named API key of a model
+func (mdb *MockDB) RevokeAllowedModelAPIKey(modelID, keyID int, authorization User) error {
+	if _, err := mdb.getAllowedModelToEdit(modelID, authorization); err != nil {
+		return err
+	}
+	if keyID > 2 {
+		return fmt.Errorf("cannot find the API key %d for the model", keyID)
+	}
+	return nil
+}
+
+// CreateUserTokenTable mock for the create personal access token table method
+func (mdb *MockDB) CreateUserTokenTable() error {
+	return nil
+}
+
+// ListAllowedUserTokens mock to list the personal access tokens of a user
+func (mdb *MockDB) ListAllowedUserTokens(authorization User) ([]UserToken, error) {
+	if authorization.Role == Invalid {
+		return nil, errorTokenAuth
+	}
+	created := time.Date(2020, time.March, 1, 10, 0, 0, 0, time.UTC)
+	return []UserToken{
+		{ID: 1, UserID: authorization.ID, Label: "ci-logs", Scopes: []string{"signinglog:read"}, Created: created, Enabled: true},
+	}, nil
+}
+
+// CreateAllowedUserToken mock to create a personal access token for a user
+func (mdb *MockDB) CreateAllowedUserToken(token UserToken, authorization User) (UserToken, error) {
+	if authorization.Role == Invalid {
+		return token, errorTokenAuth
+	}
+	if err := validateUserToken(token); err != nil {
+		return token, err
+	}
+
+	token.ID = 2
+	token.UserID = authorization.ID
+	token.Token = "MintedUserToken"
+	token.Created = time.Now().UTC()
+	token.Enabled = true
+	return token, nil
+}
+
+// RevokeAllowedUserToken mock to disable a personal access token of a user
+func (mdb *MockDB) RevokeAllowedUserToken(tokenID int, authorization User) error {
+	if authorization.Role == Invalid {
+		return errorTokenAuth
+	}
+	if tokenID > 1 {
+		return fmt.Errorf("cannot find the personal access token %d", tokenID)
+	}
+	return nil
+}
+
+// mockSessions are the login sessions created through the mocks, by session ID. They are shared by
+// the MockDB and the ErrorMockDB, so that a JWT created with one is accepted with the other
+var mockSessions = struct {
+	sync.Mutex
+	sessions map[string]UserSession
+}{sessions: map[string]UserSession{}}
+
+func mockCreateUserSession(session UserSession) error {
+	mockSessions.Lock()
+	defer mockSessions.Unlock()
+	mockSessions.sessions[session.JTI] = session
+	return nil
+}
+
+func mockGetUserSession(jti string) (UserSession, error) {
+	mockSessions.Lock()
+	defer mockSessions.Unlock()
+	session, ok := mockSessions.sessions[jti]
+	if !ok || !session.Expires.After(time.Now()) {
+		return UserSession{}, errors.New("Cannot find the session")
+	}
+	return session, nil
+}
+
+func mockRefreshUserSession(jti string, expires time.Time) error {
+	mockSessions.Lock()
+	defer mockSessions.Unlock()
+	session, ok := mockSessions.sessions[jti]
+	if ok {
+		session.Expires = expires
+		session.LastSeen = time.Now()
+		mockSessions.sessions[jti] = session
+	}
+	return nil
+}
+
+func mockRevokeUserSession(jti string) error {
+	mockSessions.Lock()
+	defer mockSessions.Unlock()
+	delete(mockSessions.sessions, jti)
+	return nil
+}
+
+// CreateUserSessionTable mock for the create login session table method
+func (mdb *MockDB) CreateUserSessionTable() error {
+	return nil
+}
+
+// CreateUserSession mock to store a login session
+func (mdb *MockDB) CreateUserSession(session UserSession) error {
+	return mockCreateUserSession(session)
+}
+
+// GetUserSession mock to fetch an active login session
+func (mdb *MockDB) GetUserSession(jti string) (UserSession, error) {
+	return mockGetUserSession(jti)
+}
+
+// ListUserSessions mock to list the active login sessions of a user
+func (mdb *MockDB) ListUserSessions(username string) ([]UserSession, error) {
+	mockSessions.Lock()
+	defer mockSessions.Unlock()
+	sessions := []UserSession{}
+	for _, session := range mockSessions.sessions {
+		if session.Username == username && session.Expires.After(time.Now()) {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+// RefreshUserSession mock to extend a login session
+func (mdb *MockDB) RefreshUserSession(jti string, expires time.Time) error {
+	return mockRefreshUserSession(jti, expires)
+}
+
+// RevokeUserSession mock to revoke a login session
+func (mdb *MockDB) RevokeUserSession(jti string) error {
+	return mockRevokeUserSession(jti)
+}
+
+// RevokeUserSessions mock to revoke the login sessions of a user
+func (mdb *MockDB) RevokeUserSessions(username string) error {
+	mockSessions.Lock()
+	defer mockSessions.Unlock()
+	for jti, session := range mockSessions.sessions {
+		if session.Username == username {
+			delete(mockSessions.sessions, jti)
+		}
+	}
+	return nil
+}
+
+// mockAccountPermissions are the permissions of the users on the accounts known to the mock
+var mockAccountPermissions = map[string]map[string][]string{
+	"sv":     {"readonly": {PermissionSigningLogRead}},
+	"reader": {"system": {PermissionSigningLogRead}, "nologs": {PermissionModelEdit}},
+}
+
+// CreateAccountPermissionTable mock for the create account permission table method
+func (mdb *MockDB) CreateAccountPermissionTable() error {
+	return nil
+}
+
+// ListUserAccountPermissions mock to list the account permissions of a user
+func (mdb *MockDB) ListUserAccountPermissions(userID int) ([]AccountPermissions, error) {
+	user, err := mdb.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	permissions := []AccountPermissions{}
+	for authorityID, perms := range mockAccountPermissions[user.Username] {
+		permissions = append(permissions, AccountPermissions{AuthorityID: authorityID, Permissions: perms})
+	}
+	return permissions, nil
+}
+
+// SetUserAccountPermissions mock to set the permissions of a user on an account
+func (mdb *MockDB) SetUserAccountPermissions(userID int, authorityID string, permissions []string) error {
+	if _, err := mdb.GetUser(userID); err != nil {
+		return err
+	}
+	return validateAccountPermissions(permissions)
+}
+
+// DeleteUserAccountPermissions mock to remove the permissions of a user on an account
+func (mdb *MockDB) DeleteUserAccountPermissions(userID int, authorityID string) error {
+	_, err := mdb.GetUser(userID)
+	return err
+}
+
+// AllowedPermission mock to check a permission of the user on an account
+func (mdb *MockDB) AllowedPermission(authorization User, authorityID, permission string) bool {
+	if authorization.Role == Invalid || authorization.Role == Superuser {
+		return true
+	}
+	permissions, found := mockAccountPermissions[authorization.Username][authorityID]
+	return permitted(authorization.Role, permissions, found, permission)
+}
+
+// mockAuditLogs is the audit log written through the mocks, shared by the MockDB and the
+// ErrorMockDB so that tests can check the actions that were recorded
+var mockAuditLogs = struct {
+	sync.Mutex
+	entries []AuditLog
+}{}
+
+// CreateAuditLogTable mock for the create audit log table method
+func (mdb *MockDB) CreateAuditLogTable() error {
+	return nil
+}
+
+// CreateAuditLogRules mock for the create audit log rules method
+func (mdb *MockDB) CreateAuditLogRules() error {
+	return nil
+}
+
+// CreateAuditLog mock to append an entry to the audit log
+func (mdb *MockDB) CreateAuditLog(entry AuditLog) error {
+	mockAuditLogs.Lock()
+	defer mockAuditLogs.Unlock()
+	entry.ID = len(mockAuditLogs.entries) + 1
+	if entry.ID > 1 {
+		entry.PrevHash = mockAuditLogs.entries[entry.ID-2].Hash
+	}
+	entry.Created = time.Now().UTC()
+	entry.Hash = entry.ComputeHash()
+	mockAuditLogs.entries = append(mockAuditLogs.entries, entry)
+	return nil
+}
+
+// ListAuditLog mock to list the audit log, the latest first
+func (mdb *MockDB) ListAuditLog(params AuditLogParams) ([]AuditLog, error) {
+	mockAuditLogs.Lock()
+	defer mockAuditLogs.Unlock()
+	entries := []AuditLog{}
+	for i := len(mockAuditLogs.entries) - 1; i >= 0; i-- {
+		e := mockAuditLogs.entries[i]
+		if (params.Actor == "" || e.Actor == params.Actor) && (params.Action == "" || e.Action == params.Action) && strings.HasPrefix(e.Target, params.Target) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// VerifyAuditLog mock to verify the audit log chain
+func (mdb *MockDB) VerifyAuditLog() (AuditLogVerification, error) {
+	mockAuditLogs.Lock()
+	defer mockAuditLogs.Unlock()
+	return AuditLogVerification{Valid: true, Entries: len(mockAuditLogs.entries)}, nil
+}
+
+// mockWebhooks are the webhooks and their deliveries written through the mocks, shared by the
+// MockDB instances so that tests can follow an event from its queuing to its delivery
+var mockWebhooks = struct {
+	sync.Mutex
+	lastID     int
+	webhooks   []Webhook
+	deliveries []WebhookDelivery
+}{}
+
+// CreateWebhookTable mock for the create webhook table method
+func (mdb *MockDB) CreateWebhookTable() error {
+	return nil
+}
+
+func mockWebhookAuth(authorization User) error {
+	switch authorization.Role {
+	case Invalid, Admin, Superuser:
+		return nil
+	default:
+		return errorWebhookAuth
+	}
+}
+
+func mockFindWebhook(webhookID int) (int, error) {
+	for i, w := range mockWebhooks.webhooks {
+		if w.ID == webhookID {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("cannot find the webhook %d", webhookID)
+}
+
+// ListAllowedWebhooks mock to list the webhooks
+func (mdb *MockDB) ListAllowedWebhooks(authorization User) ([]Webhook, error) {
+	if err := mockWebhookAuth(authorization); err != nil {
+		return nil, err
+	}
+
+	mockWebhooks.Lock()
+	defer mockWebhooks.Unlock()
+	webhooks := []Webhook{}
+	for _, w := range mockWebhooks.webhooks {
+		w.Secret = ""
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, nil
+}
+
+// GetAllowedWebhook mock to get a webhook
+func (mdb *MockDB) GetAllowedWebhook(webhookID int, authorization User) (Webhook, error) {
+	if err := mockWebhookAuth(authorization); err != nil {
+		return Webhook{}, err
+	}
+
+	mockWebhooks.Lock()
+	defer mockWebhooks.Unlock()
+	i, err := mockFindWebhook(webhookID)
+	if err != nil {
+		return Webhook{}, err
+	}
+	w := mockWebhooks.webhooks[i]
+	w.Secret = ""
+	return w, nil
+}
+
+// CreateAllowedWebhook mock to create a webhook
+func (mdb *MockDB) CreateAllowedWebhook(webhook Webhook, authorization User) (Webhook, error) {
+	if err := validateWebhook(webhook); err != nil {
+		return webhook, err
+	}
+	if err := mockWebhookAuth(authorization); err != nil {
+		return webhook, err
+	}
+	if webhook.HasEvent(EventSerialSigned) && !mdb.AllowedPermission(authorization, webhook.AuthorityID, PermissionSigningLogRead) {
+		return webhook, errorPermission(webhook.AuthorityID, PermissionSigningLogRead)
+	}
+
+	mockWebhooks.Lock()
+	defer mockWebhooks.Unlock()
+	mockWebhooks.lastID++
+	webhook.ID = mockWebhooks.lastID
+	if len(webhook.Secret) == 0 {
+		webhook.Secret = "mock-webhook-secret"
+	}
+	webhook.Active = true
+	webhook.Created = time.Now().UTC()
+	mockWebhooks.webhooks = append(mockWebhooks.webhooks, webhook)
+	return webhook, nil
+}
+
+// UpdateAllowedWebhook mock to update a webhook
+func (mdb *MockDB) UpdateAllowedWebhook(webhook Webhook, authorization User) error {
+	if err := mockWebhookAuth(authorization); err != nil {
+		return err
+	}
+
+	mockWebhooks.Lock()
+	defer mockWebhooks.Unlock()
+	i, err := mockFindWebhook(webhook.ID)
+	if err != nil {
+		return err
+	}
+	webhook.AuthorityID = mockWebhooks.webhooks[i].AuthorityID
+	if err := validateWebhook(webhook); err != nil {
+		return err
+	}
+	if webhook.HasEvent(EventSerialSigned) && !mdb.AllowedPermission(authorization, webhook.AuthorityID, PermissionSigningLogRead) {
+		return errorPermission(webhook.AuthorityID, PermissionSigningLogRead)
+	}
+
+	mockWebhooks.webhooks[i].URL = webhook.URL
+	mockWebhooks.webhooks[i].Events = webhook.Events
+	mockWebhooks.webhooks[i].Active = webhook.Active
+	return nil
+}
+
+// DeleteAllowedWebhook mock to delete a webhook
+func (mdb *MockDB) DeleteAllowedWebhook(webhookID int, authorization User) error {
+	if err := mockWebhookAuth(authorization); err != nil {
+		return err
+	}
+
+	mockWebhooks.Lock()
+	defer mockWebhooks.Unlock()
+	i, err := mockFindWebhook(webhookID)
+	if err != nil {
+		return err
+	}
+	mockWebhooks.webhooks = append(mockWebhooks.webhooks[:i], mockWebhooks.webhooks[i+1:]...)
+	return nil
+}
+
+// ListAllowedWebhookDeliveries mock to list the deliveries of a webhook, the latest first
+func (mdb *MockDB) ListAllowedWebhookDeliveries(webhookID int, authorization User) ([]WebhookDelivery, error) {
+	if err := mockWebhookAuth(authorization); err != nil {
+		return nil, err
+	}
+
+	mockWebhooks.Lock()
+	defer mockWebhooks.Unlock()
+	if _, err := mockFindWebhook(webhookID); err != nil {
+		return nil, err
+	}
+	deliveries := []WebhookDelivery{}
+	for i := len(mockWebhooks.deliveries) - 1; i >= 0; i-- {
+		if d := mockWebhooks.deliveries[i]; d.WebhookID == webhookID {
+			deliveries = append(deliveries, d)
+		}
+	}
+	return deliveries, nil
+}
+
+// RetryAllowedWebhookDelivery mock to queue a delivery again
+func (mdb *MockDB) RetryAllowedWebhookDelivery(webhookID, deliveryID int, authorization User) error {
+	if err := mockWebhookAuth(authorization); err != nil {
+		return err
+	}
+
+	mockWebhooks.Lock()
+	defer mockWebhooks.Unlock()
+	for i, d := range mockWebhooks.deliveries {
+		if d.ID == deliveryID && d.WebhookID == webhookID {
+			mockWebhooks.deliveries[i].Status = WebhookPending
+			mockWebhooks.deliveries[i].Attempts = 0
+			mockWebhooks.deliveries[i].NextAttempt = time.Now().UTC()
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot find the webhook delivery %d", deliveryID)
+}
+
+// QueueWebhookEvent mock to queue an event for the webhooks of an account
+func (mdb *MockDB) QueueWebhookEvent(authorityID, event, payload string) error {
+	mockWebhooks.Lock()
+	defer mockWebhooks.Unlock()
+	now := time.Now().UTC()
+	for _, w := range mockWebhooks.webhooks {
+		if w.AuthorityID != authorityID || !w.Active || !w.HasEvent(event) {
+			continue
+		}
+		mockWebhooks.deliveries = append(mockWebhooks.deliveries, WebhookDelivery{
+			ID:          len(mockWebhooks.deliveries) + 1,
+			WebhookID:   w.ID,
+			Event:       event,
+			Payload:     payload,
+			Status:      WebhookPending,
+			NextAttempt: now,
+			Created:     now,
+		})
+	}
+	return nil
+}
+
+// ListDueWebhookDeliveries mock to list the deliveries that are due
+func (mdb *MockDB) ListDueWebhookDeliveries(limit int) ([]WebhookDelivery, error) {
+	mockWebhooks.Lock()
+	defer mockWebhooks.Unlock()
+	now := time.Now().UTC()
+	deliveries := []WebhookDelivery{}
+	for _, d := range mockWebhooks.deliveries {
+		i, err := mockFindWebhook(d.WebhookID)
+		if err != nil || d.Status != WebhookPending || d.NextAttempt.After(now) || !mockWebhooks.webhooks[i].Active {
+			continue
+		}
+		d.URL = mockWebhooks.webhooks[i].URL
+		d.Secret = mockWebhooks.webhooks[i].Secret
+		deliveries = append(deliveries, d)
+		if len(deliveries) == limit {
+			break
+		}
+	}
+	return deliveries, nil
+}
+
+// ClaimWebhookDelivery mock to claim a delivery attempt
+func (mdb *MockDB) ClaimWebhookDelivery(delivery WebhookDelivery, nextAttempt time.Time) (bool, error) {
+	mockWebhooks.Lock()
+	defer mockWebhooks.Unlock()
+	for i, d := range mockWebhooks.deliveries {
+		if d.ID == delivery.ID && d.Attempts == delivery.Attempts && d.Status == WebhookPending {
+			mockWebhooks.deliveries[i].Attempts++
+			mockWebhooks.deliveries[i].NextAttempt = nextAttempt
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// UpdateWebhookDelivery mock to record the result of a delivery attempt
+func (mdb *MockDB) UpdateWebhookDelivery(delivery WebhookDelivery) error {
+	mockWebhooks.Lock()
+	defer mockWebhooks.Unlock()
+	for i, d := range mockWebhooks.deliveries {
+		if d.ID == delivery.ID {
+			mockWebhooks.deliveries[i].Status = delivery.Status
+			mockWebhooks.deliveries[i].ResponseCode = delivery.ResponseCode
+			mockWebhooks.deliveries[i].LastError = delivery.LastError
+			mockWebhooks.deliveries[i].Delivered = delivery.Delivered
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot find the webhook delivery %d", delivery.ID)
+}
+
+// CreateTestLog mock to create a test log
+func (mdb *MockDB) CreateTestLog(testLog TestLog) error {
+	return nil
+}
+
+// ListAllowedTestLog database mock
+func (mdb *MockDB) ListAllowedTestLog(authorization User) ([]TestLog, error) {
+	logs := []TestLog{
+		{ID: 1, Brand: "system", Model: "alder", Filename: "test1.xml"},
+		{ID: 2, Brand: "system", Model: "alder", Filename: "test2.xml"},
+	}
+	return logs, nil
+}
+
+// SyncListTestLogs database mock
+func (mdb *MockDB) SyncListTestLogs() ([]TestLog, error) {
+	logs := []TestLog{
+		{ID: 1, Brand: "system", Model: "alder", Filename: "test1.xml"},
+		{ID: 2, Brand: "system", Model: "alder", Filename: "test2.xml"},
+	}
+	return logs, nil
+}
+
+// SyncDeleteTestLog database mock
+func (mdb *MockDB) SyncDeleteTestLog(ID int) error {
+	if ID > 2 {
+		return errors.New("MOCK error deleting the test log")
+	}
+	return nil
+}
+
+// UpdateAllowedTestLog database mock
+func (mdb *MockDB) UpdateAllowedTestLog(ID int, authorization User) error {
+	if authorization.Role >= SyncUser {
+		return nil
+	}
+	return errors.New("MOCK no permissions to update the test log")
+}
+
+// HealthCheck mock for a healthy datastore
+func (mdb *MockDB) HealthCheck() error {
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+
+// ErrorMockDB holds the unsuccessful mocks for the database
+type ErrorMockDB struct{}
+
+// CreateModelTable mock for the create model table method
+func (mdb *ErrorMockDB) CreateModelTable() error {
+	return errors.New("Error creating the model table")
+}
+
+// AlterModelTable mock for the alter model table method
+func (mdb *ErrorMockDB) AlterModelTable() error {
+	return nil
+}
+
+// CreateKeypairTable mock for the create keypair table method
+func (mdb *ErrorMockDB) CreateKeypairTable() error {
+	return nil
+}
+
+// AlterKeypairTable mock for the alter keypair table method
+func (mdb *ErrorMockDB) AlterKeypairTable() error {
+	return nil
+}
+
+// UpdateKeypairAssertion mock to update the account-key assertion of a keypair
+func (mdb *ErrorMockDB) UpdateKeypairAssertion(keypair Keypair, authorization User) (string, error) {
+	return "invalid-assertion", errors.New("MOCK Error updating the keypair assertion")
+}
+
+// CreateSettingsTable mock for the create settings table method
+func (mdb *ErrorMockDB) CreateSettingsTable() error {
+	return nil
+}
+
+// CreateAccountTable mock for the create account table method
+func (mdb *ErrorMockDB) CreateAccountTable() error {
+	return nil
+}
+
+// AlterAccountTable mock for the create account table method
+func (mdb *ErrorMockDB) AlterAccountTable() error {
+	return nil
+}
+
+// CreateAccount mock to create an account record
+func (mdb *ErrorMockDB) CreateAccount(account Account) error {
+	return errors.New("MOCK creating the account")
+}
+
+// GetAccount mock to return a single account key
+func (mdb *ErrorMockDB) GetAccount(authorityID string) (Account, error) {
+
+	accounts, _ := mdb.ListAllowedAccounts(User{})
+
+	for _, acc := range accounts {
+		if acc.AuthorityID == authorityID {
+			return acc, nil
+		}
+	}
+	return Account{}, errors.New("Cannot found the account assertion")
+}
+
+// GetAccountByID mock to return a single account key
+func (mdb *ErrorMockDB) GetAccountByID(ID int, user User) (Account, error) {
+
+	accounts, _ := mdb.ListAllowedAccounts(user)
+
+	for _, acc := range accounts {
+		if acc.ID == ID {
+			return acc, nil
+		}
+	}
+	return Account{}, errors.New("Cannot found the account assertion")
+}
+
+// GetAllowedAccount mock to fetch account
+func (mdb *ErrorMockDB) GetAllowedAccount(authorityID string, authorization User) (Account, error) {
+	return Account{}, errors.New("MOCK error getting the account")
+}
+
+// ListAllowedAccounts mock to return a list of the available accounts
+func (mdb *ErrorMockDB) ListAllowedAccounts(authorization User) ([]Account, error) {
+	return nil, errors.New("Error getting the accounts")
+}
+
+// PutAccount mock to update an account assertion
+func (mdb *ErrorMockDB) PutAccount(account Account, authorization User) (string, error) {
+	return "", errors.New("MOCK error upserting the account")
+}
+
+// SyncAccount mock to update the account
+func (mdb *ErrorMockDB) SyncAccount(account Account) error {
+	return errors.New("MOCK error syncing the account")
+}
+
+// UpdateAccountAssertion mock to update the account assertion
+func (mdb *ErrorMockDB) UpdateAccountAssertion(authorityID, assertion string, resellerAPI bool) error {
+	return nil
+}
+
+// UpdateAccount mock to update the account
+func (mdb *ErrorMockDB) UpdateAccount(account Account, authorization User) error {
+	return nil
+}
+
+// ListAllowedModels ModelsList Mock the database response for a list of models
+func (mdb *ErrorMockDB) ListAllowedModels(authorization User) ([]Model, error) {
+	return nil, errors.New("Error getting the models")
+}
+
+// FindModel mocks the database response for finding a model, returning an invalid signing-key
+func (mdb *ErrorMockDB) FindModel(brandID, modelName, apiKey string) (Model, error) {
+	return Model{}, errors.New("Error finding the model")
+}
+
+// CheckModelExists mocks the database response for finding a model
+func (mdb *ErrorMockDB) CheckModelExists(brandID, modelName string) bool {
+	return false
+}
+
+// CheckAPIKey mocks the database response to check the API key
+func (mdb *ErrorMockDB) CheckAPIKey(apiKey string) bool {
+	return true
+}
+
+// GetAllowedModel mocks the model from the database by ID, returning an error.
 func (mdb *ErrorMockDB) GetAllowedModel(modelID int, authorization User) (Model, error) {
 	return Model{}, errors.New("Error retrieving the model")
 }
@@ -1061,6 +2224,11 @@ func (mdb *ErrorMockDB) CheckKeypairKeynameExists(authorityID, name string) bool
 	return false
 }
 
+// ResealKeypairs error mock for the database
+func (mdb *ErrorMockDB) ResealKeypairs(reseal func(keypair Keypair, authKeyHash string) (string, string, error)) (int, error) {
+	return 0, errors.New("Error re-sealing the keypairs")
+}
+
 // SyncKeypair error mock for the database
 func (mdb *ErrorMockDB) SyncKeypair(keypair SyncKeypair) error {
 	return errors.New("Error updating the database")
@@ -1086,6 +2254,16 @@ func (mdb *ErrorMockDB) CheckForDuplicate(signLog *SigningLog) (bool, int, error
 	return false, 0, nil
 }
 
+// FindMaxResignRevision error mock for the database
+func (mdb *ErrorMockDB) FindMaxResignRevision(signLog SigningLog) (int, error) {
+	return 0, errors.New("Error communicating with the database")
+}
+
+// CheckForDeviceKeyConflict error mock for the database
+func (mdb *ErrorMockDB) CheckForDeviceKeyConflict(signLog SigningLog) (bool, error) {
+	return false, errors.New("Error in check for a device-key conflict")
+}
+
 // CheckForMatching error mock for the database
 func (mdb *ErrorMockDB) CheckForMatching(signLog SigningLog) (bool, error) {
 	return false, nil
@@ -1096,6 +2274,11 @@ func (mdb *ErrorMockDB) CreateSigningLog(signLog SigningLog) error {
 	return nil
 }
 
+// CreateSigningLogs error mock for the database
+func (mdb *ErrorMockDB) CreateSigningLogs(signLogs []SigningLog) error {
+	return errors.New("MOCK error creating the signing logs")
+}
+
 // CreateSigningLogSync error mock for the database
 func (mdb *ErrorMockDB) CreateSigningLogSync(signLog SigningLog) error {
 	return nil
@@ -1106,6 +2289,51 @@ func (mdb *ErrorMockDB) CreateSigningLogTable() error {
 	return nil
 }
 
+// CreateModelQuotaTable error mock for the create model quota table method
+func (mdb *ErrorMockDB) CreateModelQuotaTable() error {
+	return errors.New("MOCK error creating the model quota table")
+}
+
+// CreateModelUsageTable error mock for the create model usage table method
+func (mdb *ErrorMockDB) CreateModelUsageTable() error {
+	return errors.New("MOCK error creating the model usage table")
+}
+
+// GetAPIKeyQuota error mock to get the limits of an API key
+func (mdb *ErrorMockDB) GetAPIKeyQuota(apiKey string, now time.Time) (APIKeyQuota, error) {
+	return APIKeyQuota{}, errors.New("MOCK error fetching the API key quota")
+}
+
+// ReserveModelQuota error mock to reserve the quota of a model
+func (mdb *ErrorMockDB) ReserveModelQuota(model Model, count int, now time.Time) (bool, ModelQuota, error) {
+	return false, ModelQuota{}, errors.New("MOCK error updating the model usage")
+}
+
+// ReleaseModelQuota error mock to release the quota that was reserved for a model
+func (mdb *ErrorMockDB) ReleaseModelQuota(modelID, count int, now time.Time) error {
+	return errors.New("MOCK error updating the model usage")
+}
+
+// GetModelUsage error mock to get the usage of a model
+func (mdb *ErrorMockDB) GetModelUsage(modelID int, now time.Time) (int, int, error) {
+	return 0, 0, errors.New("MOCK error fetching the model usage")
+}
+
+// GetModelQuota error mock to get the quota of a model
+func (mdb *ErrorMockDB) GetModelQuota(model Model) (ModelQuota, error) {
+	return ModelQuota{}, errors.New("MOCK error fetching the model quota")
+}
+
+// GetAllowedModelQuota error mock to get the quota of a model
+func (mdb *ErrorMockDB) GetAllowedModelQuota(modelID int, authorization User) (ModelQuota, error) {
+	return ModelQuota{}, errors.New("MOCK error fetching the model quota")
+}
+
+// UpdateAllowedModelQuota error mock to set the quota of a model
+func (mdb *ErrorMockDB) UpdateAllowedModelQuota(modelID int, quota ModelQuota, authorization User) (ModelQuota, error) {
+	return quota, errors.New("MOCK error updating the model quota")
+}
+
 // CreateTestLogTable error mock for the database
 func (mdb *ErrorMockDB) CreateTestLogTable() error {
 	return nil
@@ -1122,6 +2350,36 @@ func (mdb *ErrorMockDB) ListAllowedSigningLogForAccount(authorization User, auth
 	return mdb.ListAllowedSigningLog(authorization)
 }
 
+// ExportAllowedSigningLog error mock for the database
+func (mdb *ErrorMockDB) ExportAllowedSigningLog(authorization User, authorityID string, params SigningLogExportParams, export func(SigningLog) error) error {
+	return errors.New("Error retrieving the signing logs")
+}
+
+// ExportSigningLog error mock for the database
+func (mdb *ErrorMockDB) ExportSigningLog(authorityID string, params SigningLogExportParams, export func(SigningLog) error) error {
+	return errors.New("Error retrieving the signing logs")
+}
+
+// CreateSigningLogArchiveTable error mock for the database
+func (mdb *ErrorMockDB) CreateSigningLogArchiveTable() error {
+	return errors.New("Error creating the signing log archive table")
+}
+
+// ArchiveSigningLogs error mock for the database
+func (mdb *ErrorMockDB) ArchiveSigningLogs(before time.Time, limit int, archiveTable bool, archive func([]SigningLog) error) (int, error) {
+	return 0, errors.New("Error archiving the signing logs")
+}
+
+// AllowedSigningReport error mock for the database
+func (mdb *ErrorMockDB) AllowedSigningReport(authorization User, params SigningReportParams) ([]SigningReport, error) {
+	return nil, errors.New("Error retrieving the signing report")
+}
+
+// SigningReport error mock for the database
+func (mdb *ErrorMockDB) SigningReport(params SigningReportParams) ([]SigningReport, error) {
+	return nil, errors.New("Error retrieving the signing report")
+}
+
 // SyncSigningLog error mock for the database
 func (mdb *ErrorMockDB) SyncSigningLog() ([]SigningLog, error) {
 	var signingLog []SigningLog
@@ -1143,21 +2401,6 @@ func (mdb *ErrorMockDB) CreateDeviceNonceTable() error {
 	return nil
 }
 
-// DeleteExpiredDeviceNonces error mock for the database
-func (mdb *ErrorMockDB) DeleteExpiredDeviceNonces() error {
-	return nil
-}
-
-// CreateDeviceNonce error mock for the database
-func (mdb *ErrorMockDB) CreateDeviceNonce() (DeviceNonce, error) {
-	return DeviceNonce{}, errors.New("MOCK error generating the nonce")
-}
-
-// ValidateDeviceNonce error mock for the database
-func (mdb *ErrorMockDB) ValidateDeviceNonce(nonce string) error {
-	return errors.New("MOCK error validating a nonce")
-}
-
 // CreateOpenidNonceTable database mock
 func (mdb *ErrorMockDB) CreateOpenidNonceTable() error {
 	return nil
@@ -1188,6 +2431,46 @@ func (mdb *ErrorMockDB) AlterUserTable() error {
 	return errors.New("Could not alter User table")
 }
 
+// HashUserAPIKeys mock for hashing the API keys of the users
+func (mdb *ErrorMockDB) HashUserAPIKeys() error {
+	return errors.New("MOCK error hashing the user API keys")
+}
+
+// HashModelAPIKeys error mock for replacing the model API keys with their hashes
+func (mdb *ErrorMockDB) HashModelAPIKeys() error {
+	return errors.New("MOCK error hashing the model API keys")
+}
+
+// ResetUserAPIKey mock for generating a new API key for a user
+func (mdb *ErrorMockDB) ResetUserAPIKey(userID int) (string, error) {
+	return "", errors.New("MOCK error resetting the user API key")
+}
+
+// AlterUserProvisioned mock for adding the provisioned field to the user table
+func (mdb *ErrorMockDB) AlterUserProvisioned() error {
+	return errors.New("Could not alter User table")
+}
+
+// AlterUserOIDCIdentity mock for adding the OpenID Connect identity field to the user table
+func (mdb *ErrorMockDB) AlterUserOIDCIdentity() error {
+	return errors.New("Could not alter User table")
+}
+
+// BindUserOIDCIdentity error mock for binding a user to the identity of their first login
+func (mdb *ErrorMockDB) BindUserOIDCIdentity(userID int, identity string) (bool, error) {
+	return false, errors.New("MOCK error binding the user identity")
+}
+
+// ProvisionUser mock for creating or updating a user from the role mappings
+func (mdb *ErrorMockDB) ProvisionUser(user User) (int, error) {
+	return 0, errors.New("MOCK error provisioning the user")
+}
+
+// DeprovisionUser mock for removing the access of a provisioned user
+func (mdb *ErrorMockDB) DeprovisionUser(userID int) error {
+	return errors.New("MOCK error deprovisioning the user")
+}
+
 // CreateUser error mock for create user operation
 func (mdb *ErrorMockDB) CreateUser(user User) (int, error) {
 	return 0, errors.New("Cannot create user")
@@ -1355,6 +2638,362 @@ func (mdb *ErrorMockDB) GetAllowedSubstore(fromModelID int, serialNumber string,
 	return mdb.GetSubstore(fromModelID, serialNumber)
 }
 
+// CreateKeyRotationTable mock for the create key rotation table method
+func (mdb *ErrorMockDB) CreateKeyRotationTable() error {
+	return errors.New("MOCK error creating the key rotation table")
+}
+
+// ListAllowedKeyRotations mock to list the key rotations of a model
+func (mdb *ErrorMockDB) ListAllowedKeyRotations(modelID int, authorization User) ([]KeyRotation, error) {
+	return nil, errors.New("MOCK error listing the key rotations")
+}
+
+// CreateAllowedKeyRotation mock to schedule a key rotation
+func (mdb *ErrorMockDB) CreateAllowedKeyRotation(rotation KeyRotation, authorization User) (KeyRotation, error) {
+	return rotation, errors.New("MOCK error creating the key rotation")
+}
+
+// DeleteAllowedKeyRotation mock to cancel a key rotation
+func (mdb *ErrorMockDB) DeleteAllowedKeyRotation(modelID, rotationID int, authorization User) error {
+	return errors.New("MOCK error deleting the key rotation")
+}
+
+// PromoteKeyRotations mock to promote the due key rotations
+func (mdb *ErrorMockDB) PromoteKeyRotations() (int, error) {
+	return 0, errors.New("MOCK error promoting the key rotations")
+}
+
+// ApplyDueKeyRotations mock to use the successor keys of the due key rotations
+func (mdb *ErrorMockDB) ApplyDueKeyRotations(model *Model) error {
+	return errors.New("MOCK error retrieving the due key rotations")
+}
+
+// ListRotationKeypairs mock to list the keypairs of the key rotations in their overlap period
+func (mdb *ErrorMockDB) ListRotationKeypairs(modelID int, keyType string) ([]Keypair, error) {
+	return nil, errors.New("MOCK error listing the key rotation keypairs")
+}
+
+// CreateSerialAllowlistTable mock for the create serial allowlist table method
+func (mdb *ErrorMockDB) CreateSerialAllowlistTable() error {
+	return errors.New("MOCK error creating the serial allowlist table")
+}
+
+// ListAllowedSerialAllowlist mock to list the serial number allowlist of a model
+func (mdb *ErrorMockDB) ListAllowedSerialAllowlist(modelID int, status, after string, authorization User) ([]SerialAllowlist, error) {
+	return nil, errors.New("MOCK error listing the serial number allowlist")
+}
+
+// ImportAllowedSerialAllowlist mock to import serial numbers to a model's allowlist
+func (mdb *ErrorMockDB) ImportAllowedSerialAllowlist(modelID int, serials []SerialAllowlistImport, authorization User) (int, error) {
+	return 0, errors.New("MOCK error importing the serial number allowlist")
+}
+
+// DeleteAllowedSerialAllowlist mock to remove a serial number from a model's allowlist
+func (mdb *ErrorMockDB) DeleteAllowedSerialAllowlist(modelID, serialID int, authorization User) error {
+	return errors.New("MOCK error deleting the serial number from the allowlist")
+}
+
+// CheckSerialAllowlist mock to check a serial number against the model's allowlist
+func (mdb *ErrorMockDB) CheckSerialAllowlist(modelID int, serialNumber string) error {
+	return errors.New("MOCK error checking the serial number allowlist")
+}
+
+// UpdateSerialAllowlistSigned mock to mark a serial number as signed
+func (mdb *ErrorMockDB) UpdateSerialAllowlistSigned(modelID int, serialNumber string) error {
+	return errors.New("MOCK error updating the serial number allowlist")
+}
+
+// SyncSerialAllowlist mock to replace a model's allowlist in the factory
+func (mdb *ErrorMockDB) SyncSerialAllowlist(modelID int, serials []SerialAllowlist) error {
+	return errors.New("MOCK error syncing the serial number allowlist")
+}
+
+// CreateSerialRevocationTable mock for the create serial revocation table method
+func (mdb *ErrorMockDB) CreateSerialRevocationTable() error {
+	return errors.New("MOCK error creating the serial revocation table")
+}
+
+// ListSerialRevocations mock to list the revoked serial assertions of a model
+func (mdb *ErrorMockDB) ListSerialRevocations(brandID, modelName string) ([]SerialRevocation, error) {
+	return nil, errors.New("MOCK error retrieving the serial revocations")
+}
+
+// CreateSerialRevocation mock to revoke a serial assertion
+func (mdb *ErrorMockDB) CreateSerialRevocation(revocation SerialRevocation) (SerialRevocation, error) {
+	return revocation, errors.New("MOCK error revoking the serial assertion")
+}
+
+// ListAllowedSerialRevocations mock to list the revoked serial assertions of a model
+func (mdb *ErrorMockDB) ListAllowedSerialRevocations(modelID int, authorization User) ([]SerialRevocation, error) {
+	return nil, errors.New("MOCK error retrieving the serial revocations")
+}
+
+// CreateAllowedSerialRevocation mock to revoke a serial assertion of a model
+func (mdb *ErrorMockDB) CreateAllowedSerialRevocation(modelID int, revocation SerialRevocation, authorization User) (SerialRevocation, error) {
+	return revocation, errors.New("MOCK error revoking the serial assertion")
+}
+
+// DeleteAllowedSerialRevocation mock to remove the revocation of a serial assertion
+func (mdb *ErrorMockDB) DeleteAllowedSerialRevocation(modelID, revocationID int, authorization User) error {
+	return errors.New("MOCK error deleting the serial revocation")
+}
+
+// SyncSerialRevocations mock to replace a model's revocations in the factory
+func (mdb *ErrorMockDB) SyncSerialRevocations(brandID, modelName string, revocations []SerialRevocation) error {
+	return errors.New("MOCK error syncing the serial revocations")
+}
+
+// CheckSerialRevoked mock to check whether a serial assertion has been revoked
+func (mdb *ErrorMockDB) CheckSerialRevoked(brandID, modelName, serialNumber string, revision int) (bool, error) {
+	return false, errors.New("MOCK error checking the serial revocations")
+}
+
+// CreateRemodelRuleTable mock for the create remodel rule table method
+func (mdb *ErrorMockDB) CreateRemodelRuleTable() error {
+	return errors.New("MOCK error creating the remodel rule table")
+}
+
+// ListRemodelRules mock to list the remodel rules of a model
+func (mdb *ErrorMockDB) ListRemodelRules(modelID int) ([]RemodelRule, error) {
+	return nil, errors.New("MOCK error retrieving the remodel rules")
+}
+
+// GetRemodelRule mock to get the remodel rule for the original and new models
+func (mdb *ErrorMockDB) GetRemodelRule(fromBrandID, fromModel, toBrandID, toModel string) (RemodelRule, error) {
+	return RemodelRule{}, errors.New("MOCK error retrieving the remodel rule")
+}
+
+// ListAllowedRemodelRules mock to list the remodel rules of a model
+func (mdb *ErrorMockDB) ListAllowedRemodelRules(modelID int, authorization User) ([]RemodelRule, error) {
+	return nil, errors.New("MOCK error retrieving the remodel rules")
+}
+
+// CreateAllowedRemodelRule mock to create a remodel rule for a model
+func (mdb *ErrorMockDB) CreateAllowedRemodelRule(modelID int, rule RemodelRule, authorization User) (RemodelRule, error) {
+	return rule, errors.New("MOCK error creating the remodel rule")
+}
+
+// DeleteAllowedRemodelRule mock to delete a remodel rule of a model
+func (mdb *ErrorMockDB) DeleteAllowedRemodelRule(modelID, ruleID int, authorization User) error {
+	return errors.New("MOCK error deleting the remodel rule")
+}
+
+// CreateRemodelHistoryTable mock for the create remodel history table method
+func (mdb *ErrorMockDB) CreateRemodelHistoryTable() error {
+	return errors.New("MOCK error creating the remodel history table")
+}
+
+// CreateRemodelHistory mock to record the remodel of a device
+func (mdb *ErrorMockDB) CreateRemodelHistory(history RemodelHistory) error {
+	return errors.New("MOCK error recording the remodel history")
+}
+
+// ListRemodelHistory mock to list the remodels of a model
+func (mdb *ErrorMockDB) ListRemodelHistory(brandID, modelName string) ([]RemodelHistory, error) {
+	return nil, errors.New("MOCK error retrieving the remodel history")
+}
+
+// ListAllowedRemodelHistory mock to list the remodels of a model
+func (mdb *ErrorMockDB) ListAllowedRemodelHistory(modelID int, authorization User) ([]RemodelHistory, error) {
+	return nil, errors.New("MOCK error retrieving the remodel history")
+}
+
+// CreateModelAPIKeyTable mock for the create model API key table method
+func (mdb *ErrorMockDB) CreateModelAPIKeyTable() error {
+	return nil
+}
+
+// ListModelAPIKeys mock to list the named API keys of a model
+func (mdb *ErrorMockDB) ListModelAPIKeys(modelID int) ([]ModelAPIKey, error) {
+	return nil, errors.New("MOCK error fetching the model API keys")
+}
+
+// SyncModelAPIKeys mock to sync the named API keys of a model
+func (mdb *ErrorMockDB) SyncModelAPIKeys(keys []ModelAPIKey) error {
+	return errors.New("MOCK error syncing the model API keys")
+}
+
+// ListAllowedModelAPIKeys mock to list the named API keys of a model
+func (mdb *ErrorMockDB) ListAllowedModelAPIKeys(modelID int, authorization User) ([]ModelAPIKey, error) {
+	return nil, errors.New("MOCK error fetching the model API keys")
+}
+
+// CreateAllowedModelAPIKey mock to mint a named API key for a model
+func (mdb *ErrorMockDB) CreateAllowedModelAPIKey(key ModelAPIKey, authorization User) (ModelAPIKey, error) {
+	return key, errors.New("MOCK error creating the model API key")
+}
+
+// RevokeAllowedModelAPIKey mock to disable a named API key of a model
+func (mdb *ErrorMockDB) RevokeAllowedModelAPIKey(modelID, keyID int, authorization User) error {
+	return errors.New("MOCK error revoking the model API key")
+}
+
+// CreateUserTokenTable mock for the create personal access token table method
+func (mdb *ErrorMockDB) CreateUserTokenTable() error {
+	return nil
+}
+
+// ListAllowedUserTokens mock to list the personal access tokens of a user
+func (mdb *ErrorMockDB) ListAllowedUserTokens(authorization User) ([]UserToken, error) {
+	return nil, errors.New("MOCK error fetching the personal access tokens")
+}
+
+// CreateAllowedUserToken mock to create a personal access token for a user
+func (mdb *ErrorMockDB) CreateAllowedUserToken(token UserToken, authorization User) (UserToken, error) {
+	return token, errors.New("MOCK error creating the personal access token")
+}
+
+// RevokeAllowedUserToken mock to disable a personal access token of a user
+func (mdb *ErrorMockDB) RevokeAllowedUserToken(tokenID int, authorization User) error {
+	return errors.New("MOCK error revoking the personal access token")
+}
+
+// CreateUserSessionTable mock for the create login session table method
+func (mdb *ErrorMockDB) CreateUserSessionTable() error {
+	return nil
+}
+
+// CreateUserSession mock to store a login session. The sessions are not in error, so that
+// requests are authenticated
+func (mdb *ErrorMockDB) CreateUserSession(session UserSession) error {
+	return mockCreateUserSession(session)
+}
+
+// GetUserSession mock to fetch an active login session
+func (mdb *ErrorMockDB) GetUserSession(jti string) (UserSession, error) {
+	return mockGetUserSession(jti)
+}
+
+// ListUserSessions mock to list the active login sessions of a user
+func (mdb *ErrorMockDB) ListUserSessions(username string) ([]UserSession, error) {
+	return nil, errors.New("Error retrieving the sessions")
+}
+
+// RefreshUserSession mock to extend a login session
+func (mdb *ErrorMockDB) RefreshUserSession(jti string, expires time.Time) error {
+	return mockRefreshUserSession(jti, expires)
+}
+
+// RevokeUserSession mock to revoke a login session
+func (mdb *ErrorMockDB) RevokeUserSession(jti string) error {
+	return mockRevokeUserSession(jti)
+}
+
+// RevokeUserSessions mock to revoke the login sessions of a user
+func (mdb *ErrorMockDB) RevokeUserSessions(username string) error {
+	return errors.New("Error revoking the sessions")
+}
+
+// CreateAccountPermissionTable mock for the create account permission table method
+func (mdb *ErrorMockDB) CreateAccountPermissionTable() error {
+	return nil
+}
+
+// ListUserAccountPermissions mock to list the account permissions of a user
+func (mdb *ErrorMockDB) ListUserAccountPermissions(userID int) ([]AccountPermissions, error) {
+	return nil, errors.New("Error retrieving the account permissions")
+}
+
+// SetUserAccountPermissions mock to set the permissions of a user on an account
+func (mdb *ErrorMockDB) SetUserAccountPermissions(userID int, authorityID string, permissions []string) error {
+	return errors.New("Error setting the account permissions")
+}
+
+// DeleteUserAccountPermissions mock to remove the permissions of a user on an account
+func (mdb *ErrorMockDB) DeleteUserAccountPermissions(userID int, authorityID string) error {
+	return errors.New("Error removing the account permissions")
+}
+
+// AllowedPermission mock to check a permission of the user on an account
+func (mdb *ErrorMockDB) AllowedPermission(authorization User, authorityID, permission string) bool {
+	return authorization.Role == Invalid || authorization.Role == Superuser || hasPermission(RolePermissions[authorization.Role], permission)
+}
+
+// CreateAuditLogTable mock for the create audit log table method
+func (mdb *ErrorMockDB) CreateAuditLogTable() error {
+	return nil
+}
+
+// CreateAuditLogRules mock for the create audit log rules method
+func (mdb *ErrorMockDB) CreateAuditLogRules() error {
+	return nil
+}
+
+// CreateAuditLog mock to append an entry to the audit log
+func (mdb *ErrorMockDB) CreateAuditLog(entry AuditLog) error {
+	return errors.New("Error writing the audit log")
+}
+
+// ListAuditLog mock to list the audit log
+func (mdb *ErrorMockDB) ListAuditLog(params AuditLogParams) ([]AuditLog, error) {
+	return nil, errors.New("Error retrieving the audit log")
+}
+
+// VerifyAuditLog mock to verify the audit log chain
+func (mdb *ErrorMockDB) VerifyAuditLog() (AuditLogVerification, error) {
+	return AuditLogVerification{}, errors.New("Error retrieving the audit log")
+}
+
+// CreateWebhookTable mock for the create webhook table method
+func (mdb *ErrorMockDB) CreateWebhookTable() error {
+	return errors.New("Error creating the webhook table")
+}
+
+// ListAllowedWebhooks mock to list the webhooks
+func (mdb *ErrorMockDB) ListAllowedWebhooks(authorization User) ([]Webhook, error) {
+	return nil, errors.New("Error retrieving the webhooks")
+}
+
+// GetAllowedWebhook mock to get a webhook
+func (mdb *ErrorMockDB) GetAllowedWebhook(webhookID int, authorization User) (Webhook, error) {
+	return Webhook{}, errors.New("Error retrieving the webhook")
+}
+
+// CreateAllowedWebhook mock to create a webhook
+func (mdb *ErrorMockDB) CreateAllowedWebhook(webhook Webhook, authorization User) (Webhook, error) {
+	return webhook, errors.New("Error creating the webhook")
+}
+
+// UpdateAllowedWebhook mock to update a webhook
+func (mdb *ErrorMockDB) UpdateAllowedWebhook(webhook Webhook, authorization User) error {
+	return errors.New("Error updating the webhook")
+}
+
+// DeleteAllowedWebhook mock to delete a webhook
+func (mdb *ErrorMockDB) DeleteAllowedWebhook(webhookID int, authorization User) error {
+	return errors.New("Error deleting the webhook")
+}
+
+// ListAllowedWebhookDeliveries mock to list the deliveries of a webhook
+func (mdb *ErrorMockDB) ListAllowedWebhookDeliveries(webhookID int, authorization User) ([]WebhookDelivery, error) {
+	return nil, errors.New("Error retrieving the webhook deliveries")
+}
+
+// RetryAllowedWebhookDelivery mock to queue a delivery again
+func (mdb *ErrorMockDB) RetryAllowedWebhookDelivery(webhookID, deliveryID int, authorization User) error {
+	return errors.New("Error retrying the webhook delivery")
+}
+
+// QueueWebhookEvent mock to queue an event for the webhooks of an account
+func (mdb *ErrorMockDB) QueueWebhookEvent(authorityID, event, payload string) error {
+	return errors.New("Error queuing the webhook event")
+}
+
+// ListDueWebhookDeliveries mock to list the deliveries that are due
+func (mdb *ErrorMockDB) ListDueWebhookDeliveries(limit int) ([]WebhookDelivery, error) {
+	return nil, errors.New("Error retrieving the webhook deliveries")
+}
+
+// ClaimWebhookDelivery mock to claim a delivery attempt
+func (mdb *ErrorMockDB) ClaimWebhookDelivery(delivery WebhookDelivery, nextAttempt time.Time) (bool, error) {
+	return false, errors.New("Error claiming the webhook delivery")
+}
+
+// UpdateWebhookDelivery mock to record the result of a delivery attempt
+func (mdb *ErrorMockDB) UpdateWebhookDelivery(delivery WebhookDelivery) error {
+	return errors.New("Error updating the webhook delivery")
+}
+
 // CreateTestLog mock to create a test log
 func (mdb *ErrorMockDB) CreateTestLog(testLog TestLog) error {
 	return errors.New("MOCK Cannot create the test log")
@@ -1384,3 +3023,13 @@ func (mdb *ErrorMockDB) UpdateAllowedTestLog(ID int, authorization User) error {
 func (mdb *ErrorMockDB) HealthCheck() error {
 	return errors.New("Health check failed")
 }
+
+// Transaction mock to do the database changes of an action
+func (mdb *MockDB) Transaction(action func(db Datastore) error) error {
+	return action(mdb)
+}
+
+// Transaction mock to do the database changes of an action
+func (mdb *ErrorMockDB) Transaction(action func(db Datastore) error) error {
+	return action(mdb)
+}
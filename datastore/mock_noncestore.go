@@ -0,0 +1,68 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016-2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+import "errors"
+
+// MockNonceStore is a nonce store mock that accepts any nonce
+type MockNonceStore struct{}
+
+// CreateDeviceNonce mock to create a nonce
+func (s *MockNonceStore) CreateDeviceNonce(apiKey string) (DeviceNonce, error) {
+	return DeviceNonce{Nonce: "1234567890", TimeStamp: 1234567890, APIKey: apiKey}, nil
+}
+
+// ValidateDeviceNonce mock to validate a nonce
+func (s *MockNonceStore) ValidateDeviceNonce(nonce, apiKey string) error {
+	return nil
+}
+
+// CheckDeviceNonce mock to check a nonce
+func (s *MockNonceStore) CheckDeviceNonce(nonce, apiKey string) error {
+	return nil
+}
+
+// DeleteExpiredDeviceNonces mock to remove the expired nonces
+func (s *MockNonceStore) DeleteExpiredDeviceNonces() error {
+	return nil
+}
+
+// ErrorMockNonceStore is a nonce store mock that returns errors
+type ErrorMockNonceStore struct{}
+
+// CreateDeviceNonce error mock to create a nonce
+func (s *ErrorMockNonceStore) CreateDeviceNonce(apiKey string) (DeviceNonce, error) {
+	return DeviceNonce{}, errors.New("MOCK error generating the nonce")
+}
+
+// ValidateDeviceNonce error mock to validate a nonce
+func (s *ErrorMockNonceStore) ValidateDeviceNonce(nonce, apiKey string) error {
+	return errors.New("MOCK error validating a nonce")
+}
+
+// CheckDeviceNonce error mock to check a nonce
+func (s *ErrorMockNonceStore) CheckDeviceNonce(nonce, apiKey string) error {
+	return errors.New("MOCK error checking a nonce")
+}
+
+// DeleteExpiredDeviceNonces error mock to remove the expired nonces
+func (s *ErrorMockNonceStore) DeleteExpiredDeviceNonces() error {
+	return errors.New("MOCK error deleting the expired nonces")
+}
@@ -62,6 +62,22 @@ func (db *DB) GetAllowedModel(modelID int, authorization User) (Model, error) {
 	}
 }
 
+// getAllowedModelToEdit returns the model, if the authorization is allowed to update it. The
+// user must have the model:edit permission on the model's brand
+func (db *DB) getAllowedModelToEdit(modelID int, authorization User) (Model, error) {
+	model, err := db.GetAllowedModel(modelID, authorization)
+	if err != nil {
+		return model, err
+	}
+	if model.ID == 0 {
+		return model, errors.New("You do not have permissions to this model")
+	}
+	if !db.AllowedPermission(authorization, model.BrandID, PermissionModelEdit) {
+		return model, errorPermission(model.BrandID, PermissionModelEdit)
+	}
+	return model, nil
+}
+
 // UpdateAllowedModel updates the model if authorization is allowed to do it
 func (db *DB) UpdateAllowedModel(model Model, authorization User) (string, error) {
 	errorSubcode, err := validateModel(model, "error-validate-model")
@@ -73,12 +89,7 @@ func (db *DB) UpdateAllowedModel(model Model, authorization User) (string, error
 		return "error-auth", errors.New("error updating the model: the model and the keys must have the same brand")
 	}
 
-	// Check the API key and default it if it is invalid
-	apiKey, err := buildValidOrDefaultAPIKey(model.APIKey)
-	if err != nil {
-		return "error-model-apikey", errors.New("error updating the model: error in generating a valid API key")
-	}
-	model.APIKey = apiKey
+	model.DuplicatePolicy = defaultDuplicatePolicy(model.DuplicatePolicy)
 
 	// Get the existing model using the ID
 	m, err := db.getModel(model.ID)
@@ -86,6 +97,11 @@ func (db *DB) UpdateAllowedModel(model Model, authorization User) (string, error
 		return "error-model-not-found", fmt.Errorf("error updating the model: %v", err)
 	}
 
+	// The API keys of the model are managed as named API keys, so the API key is not updated here
+	if len(model.APIKey) > 0 && model.APIKey != m.APIKey {
+		return "error-model-apikey", errorModelAPIKey(model.ID)
+	}
+
 	// If the model name is different, check that the new name does not exist
 	if model.BrandID != m.BrandID || model.Name != m.Name {
 		// Check that the new model does not exist
@@ -100,6 +116,11 @@ func (db *DB) UpdateAllowedModel(model Model, authorization User) (string, error
 	case Superuser:
 		return db.updateModel(model)
 	case Admin:
+		for _, brandID := range []string{m.BrandID, model.BrandID} {
+			if !db.AllowedPermission(authorization, brandID, PermissionModelEdit) {
+				return "error-auth", errorPermission(brandID, PermissionModelEdit)
+			}
+		}
 		return db.updateModelFilteredByUser(model, authorization.Username)
 	default:
 		return "", nil
@@ -114,6 +135,9 @@ func (db *DB) DeleteAllowedModel(model Model, authorization User) (string, error
 	case Superuser:
 		return db.deleteModel(model)
 	case Admin:
+		if m, err := db.getModel(model.ID); err == nil && !db.AllowedPermission(authorization, m.BrandID, PermissionModelEdit) {
+			return "error-auth", errorPermission(m.BrandID, PermissionModelEdit)
+		}
 		return db.deleteModelFilteredByUser(model, authorization.Username)
 	default:
 		return "", nil
@@ -141,6 +165,7 @@ func (db *DB) CreateAllowedModel(model Model, authorization User) (Model, string
 		return model, "error-model-apikey", errors.New("error creating the model: error in generating a valid API key")
 	}
 	model.APIKey = apiKey
+	model.DuplicatePolicy = defaultDuplicatePolicy(model.DuplicatePolicy)
 
 	// Check that the model does not exist
 	if found := db.CheckModelExists(model.BrandID, model.Name); found {
@@ -153,6 +178,9 @@ func (db *DB) CreateAllowedModel(model Model, authorization User) (Model, string
 	case Superuser:
 		return db.createModel(model)
 	case Admin:
+		if !db.AllowedPermission(authorization, model.BrandID, PermissionModelEdit) {
+			return model, "error-auth", errorPermission(model.BrandID, PermissionModelEdit)
+		}
 		return db.createModelFilteredByUser(model, authorization.Username)
 	default:
 		return Model{}, "", nil
@@ -181,6 +209,11 @@ func validateModel(model Model, validateModelLabel string) (string, error) {
 		return "error-validate-userkey", fmt.Errorf(errTemplate, model.Name, err)
 	}
 
+	err = validateDuplicatePolicy(model.DuplicatePolicy, model.MaxResigns)
+	if err != nil {
+		return "error-validate-policy", fmt.Errorf(errTemplate, model.Name, err)
+	}
+
 	return "", nil
 }
 
@@ -207,6 +240,29 @@ func validateKeypairIDUser(keypairIDUser int) error {
 	return nil
 }
 
+// validateDuplicatePolicy validates the duplicate-signing policy. An empty policy is
+// defaulted to allow duplicates, as before the policy was introduced
+func validateDuplicatePolicy(policy string, maxResigns int) error {
+	switch policy {
+	case "", DuplicatePolicyAllow, DuplicatePolicyReject, DuplicatePolicySameDeviceKey:
+		return nil
+	case DuplicatePolicyMaxResigns:
+		if maxResigns < 0 {
+			return errors.New("the maximum number of re-signs must not be negative")
+		}
+		return nil
+	default:
+		return fmt.Errorf("the duplicate-signing policy '%s' is invalid", policy)
+	}
+}
+
+func defaultDuplicatePolicy(policy string) string {
+	if len(policy) == 0 {
+		return DuplicatePolicyAllow
+	}
+	return policy
+}
+
 // buildValidOrDefaultAPIKey checks the API key and creates a default API key if the field is empty
 func buildValidOrDefaultAPIKey(apiKey string) (string, error) {
 	// Remove all whitespace from the API key
@@ -232,3 +288,8 @@ func generateAPIKey() (string, error) {
 
 	return reg.ReplaceAllString(apiKey, ""), nil
 }
+
+// errorModelAPIKey is the error when a model update tries to change the model's API key
+func errorModelAPIKey(modelID int) error {
+	return fmt.Errorf("error updating the model: the API keys of the model are managed through /models/%d/apikeys", modelID)
+}
@@ -52,3 +52,26 @@ func TestModelNameUpperChar(t *testing.T) {
 		t.Error("Error happening is not the one searched for")
 	}
 }
+
+func TestDuplicatePolicy(t *testing.T) {
+	tests := []struct {
+		policy     string
+		maxResigns int
+		valid      bool
+	}{
+		{"", 0, true},
+		{DuplicatePolicyAllow, 0, true},
+		{DuplicatePolicyReject, 0, true},
+		{DuplicatePolicySameDeviceKey, 0, true},
+		{DuplicatePolicyMaxResigns, 3, true},
+		{DuplicatePolicyMaxResigns, -1, false},
+		{"invalid", 0, false},
+	}
+
+	for _, tt := range tests {
+		err := validateDuplicatePolicy(tt.policy, tt.maxResigns)
+		if (err == nil) != tt.valid {
+			t.Errorf("Policy '%s' (%d): expected valid %v, got: %v", tt.policy, tt.maxResigns, tt.valid, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+// ListAllowedModelAPIKeys returns the named API keys of a model, if the user is authorized to see the model
+func (db *DB) ListAllowedModelAPIKeys(modelID int, authorization User) ([]ModelAPIKey, error) {
+	switch authorization.Role {
+	case Invalid: // Authentication disabled
+		fallthrough
+	case Superuser:
+		fallthrough
+	case Admin:
+		if _, err := db.GetAllowedModel(modelID, authorization); err != nil {
+			return nil, err
+		}
+	case SyncUser:
+		// The factory syncs the key hashes of the models in the sync user's accounts
+		if _, err := db.getModelFilteredByUser(modelID, authorization.Username); err != nil {
+			return nil, err
+		}
+	default:
+		return []ModelAPIKey{}, nil
+	}
+
+	return db.ListModelAPIKeys(modelID)
+}
+
+// CreateAllowedModelAPIKey mints a new named API key for a model, if the user is authorized
+// to update the model
+func (db *DB) CreateAllowedModelAPIKey(key ModelAPIKey, authorization User) (ModelAPIKey, error) {
+	if _, err := db.getAllowedModelToEdit(key.ModelID, authorization); err != nil {
+		return key, err
+	}
+
+	switch authorization.Role {
+	case Invalid: // Authentication is disabled
+		fallthrough
+	case Superuser:
+		fallthrough
+	case Admin:
+		return db.createModelAPIKey(key)
+	default:
+		return ModelAPIKey{}, nil
+	}
+}
+
+// RevokeAllowedModelAPIKey disables a named API key of a model, if the user is authorized
+// to update the model
+func (db *DB) RevokeAllowedModelAPIKey(modelID, keyID int, authorization User) error {
+	if _, err := db.getAllowedModelToEdit(modelID, authorization); err != nil {
+		return err
+	}
+
+	switch authorization.Role {
+	case Invalid: // Authentication is disabled
+		fallthrough
+	case Superuser:
+		fallthrough
+	case Admin:
+		return db.revokeModelAPIKey(modelID, keyID)
+	default:
+		return nil
+	}
+}
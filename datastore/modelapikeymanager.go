@@ -0,0 +1,300 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/service/log"
+)
+
+const createModelAPIKeyTableSQL = `
+	CREATE TABLE IF NOT EXISTS modelapikey (
+		id          serial primary key not null,
+		model_id    int references model not null,
+		label       varchar(200) not null,
+		key_hash    varchar(64) not null,
+		created     timestamp not null,
+		expires     timestamp,
+		last_used   timestamp,
+		enabled     boolean not null
+	)
+`
+
+// Indexes
+const createModelAPIKeyModelIndexSQL = "CREATE INDEX IF NOT EXISTS modelapikey_model_idx ON modelapikey (model_id)"
+const createModelAPIKeyHashIndexSQL = "CREATE INDEX IF NOT EXISTS modelapikey_hash_idx ON modelapikey (key_hash)"
+
+const listModelAPIKeysSQL = `
+	select id, model_id, label, key_hash, created, expires, last_used, enabled
+	from modelapikey
+	where model_id=$1
+	order by created desc`
+
+const createModelAPIKeySQL = `
+	insert into modelapikey (model_id, label, key_hash, created, expires, enabled)
+	values ($1,$2,$3,$4,$5,$6) RETURNING id`
+
+const revokeModelAPIKeySQL = "update modelapikey set enabled=$1 where id=$2 and model_id=$3"
+
+const checkModelAPIKeySQL = "select id, last_used from modelapikey where key_hash=$1 and enabled=$2 and (expires is null or expires>$3)"
+const useModelAPIKeySQL = "update modelapikey set last_used=$1 where id=$2"
+
+// sqlite3 syntax for syncing data locally
+const syncUpdateModelAPIKeySQL = "update modelapikey set model_id=$1, label=$2, key_hash=$3, created=$4, expires=$5, enabled=$6 where id=$7"
+const syncCreateModelAPIKeySQL = `
+	insert into modelapikey (model_id, label, key_hash, created, expires, enabled, id)
+	values ($1,$2,$3,$4,$5,$6,$7)`
+
+// The label of the API key that a model is created with
+const defaultAPIKeyLabel = "default"
+
+// The last-used time of an API key is only updated once it is this old, so that a key that is
+// shared by a factory line does not update its row on every signing request
+const lastUsedInterval = time.Minute
+
+// ModelAPIKey is a named API key of a model. Only the hash of the key is stored: the key
+// itself is returned once, when it is minted
+type ModelAPIKey struct {
+	ID       int        `json:"id"`
+	ModelID  int        `json:"model-id"`
+	Label    string     `json:"label"`
+	APIKey   string     `json:"api-key,omitempty"`
+	KeyHash  string     `json:"key-hash"`
+	Created  time.Time  `json:"created"`
+	Expires  *time.Time `json:"expires"`
+	LastUsed *time.Time `json:"last-used"`
+	Enabled  bool       `json:"enabled"`
+}
+
+// HashAPIKey returns the hash of an API key, as it is stored in the database
+func HashAPIKey(apiKey string) string {
+	hash := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(hash[:])
+}
+
+// CreateModelAPIKeyTable creates the database table for the named API keys of the models
+func (db *DB) CreateModelAPIKeyTable() error {
+	_, err := db.Exec(createModelAPIKeyTableSQL)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(createModelAPIKeyModelIndexSQL)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(createModelAPIKeyHashIndexSQL)
+	return err
+}
+
+// ListModelAPIKeys returns the named API keys of a model
+func (db *DB) ListModelAPIKeys(modelID int) ([]ModelAPIKey, error) {
+	keys := []ModelAPIKey{}
+
+	rows, err := db.Query(listModelAPIKeysSQL, modelID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving the model API keys: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		k := ModelAPIKey{}
+		var expires, lastUsed sql.NullTime
+		err := rows.Scan(&k.ID, &k.ModelID, &k.Label, &k.KeyHash, &k.Created, &expires, &lastUsed, &k.Enabled)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving the model API keys: %v", err)
+		}
+		k.Expires = timePointer(expires)
+		k.LastUsed = timePointer(lastUsed)
+		keys = append(keys, k)
+	}
+
+	return keys, rows.Err()
+}
+
+func (db *DB) createModelAPIKey(key ModelAPIKey) (ModelAPIKey, error) {
+	// The keys are minted in the cloud and synced to the factory
+	if InFactory() {
+		return key, errors.New("the model API keys cannot be created in the factory")
+	}
+
+	if err := validateModelAPIKey(key); err != nil {
+		return key, err
+	}
+
+	apiKey, err := generateAPIKey()
+	if err != nil {
+		return key, err
+	}
+
+	key.APIKey = apiKey
+	key.KeyHash = HashAPIKey(apiKey)
+	key.Created = time.Now().UTC()
+	key.Enabled = true
+	key.LastUsed = nil
+
+	err = db.QueryRow(createModelAPIKeySQL, key.ModelID, key.Label, key.KeyHash, key.Created, key.Expires, key.Enabled).Scan(&key.ID)
+	if err != nil {
+		return key, fmt.Errorf("error creating the model API key: %v", err)
+	}
+
+	return key, nil
+}
+
+func (db *DB) revokeModelAPIKey(modelID, keyID int) error {
+	result, err := db.Exec(revokeModelAPIKeySQL, false, keyID, modelID)
+	if err != nil {
+		return fmt.Errorf("error revoking the model API key: %v", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error revoking the model API key: %v", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("cannot find the API key %d for the model", keyID)
+	}
+	return nil
+}
+
+// SyncModelAPIKeys updates the factory with the named API keys of a model
+func (db *DB) SyncModelAPIKeys(keys []ModelAPIKey) error {
+	return db.transaction(func(tx *sql.Tx) error {
+		for _, k := range keys {
+			result, err := tx.Exec(syncUpdateModelAPIKeySQL, k.ModelID, k.Label, k.KeyHash, k.Created, k.Expires, k.Enabled, k.ID)
+			if err != nil {
+				log.Printf("Error syncing the model API key %d: %v\n", k.ID, err)
+				return err
+			}
+			if rows, err := result.RowsAffected(); err != nil || rows > 0 {
+				continue
+			}
+
+			if _, err = tx.Exec(syncCreateModelAPIKeySQL, k.ModelID, k.Label, k.KeyHash, k.Created, k.Expires, k.Enabled, k.ID); err != nil {
+				log.Printf("Error syncing the model API key %d: %v\n", k.ID, err)
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// useModelAPIKey checks that the API key is an enabled, unexpired named key and records when it was used
+func (db *DB) useModelAPIKey(apiKey string) bool {
+	now := time.Now().UTC()
+
+	rows, err := db.Query(checkModelAPIKeySQL, HashAPIKey(apiKey), true, now)
+	if err != nil {
+		log.Printf("Error checking the model API key: %v\n", err)
+		return false
+	}
+
+	stale := []int{}
+	found := false
+	for rows.Next() {
+		var id int
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&id, &lastUsed); err != nil {
+			rows.Close()
+			log.Printf("Error checking the model API key: %v\n", err)
+			return false
+		}
+		found = true
+		if !lastUsed.Valid || now.Sub(lastUsed.Time) > lastUsedInterval {
+			stale = append(stale, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range stale {
+		if _, err := db.Exec(useModelAPIKeySQL, now, id); err != nil {
+			log.Printf("Error recording the use of the model API key: %v\n", err)
+		}
+	}
+	return found
+}
+
+// HashModelAPIKeys replaces the plaintext API keys of the models with named API keys, of which
+// only the hash is stored. The factory gets the named API keys when it syncs with the cloud
+func (db *DB) HashModelAPIKeys() error {
+	rows, err := db.Query(listPlaintextModelAPIKeysSQL)
+	if err != nil {
+		log.Printf("Error retrieving the model API keys: %v\n", err)
+		return err
+	}
+
+	keys := map[int]string{}
+	for rows.Next() {
+		var id int
+		var apiKey string
+		if err := rows.Scan(&id, &apiKey); err != nil {
+			rows.Close()
+			return err
+		}
+		keys[id] = apiKey
+	}
+	rows.Close()
+
+	for id, apiKey := range keys {
+		err := db.transaction(func(tx *sql.Tx) error {
+			var keyID int
+			err := tx.QueryRow(createModelAPIKeySQL, id, defaultAPIKeyLabel, HashAPIKey(apiKey), time.Now().UTC(), nil, true).Scan(&keyID)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(updateModelAPIKeySQL, "", id)
+			return err
+		})
+		if err != nil {
+			log.Printf("Error hashing the API key of model %d: %v\n", id, err)
+			return err
+		}
+	}
+	return nil
+}
+
+func timePointer(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func validateModelAPIKey(key ModelAPIKey) error {
+	if len(strings.TrimSpace(key.Label)) == 0 {
+		return errors.New("the label of the API key must be entered")
+	}
+	if len(key.Label) > 200 {
+		return errors.New("the label of the API key must be 200 characters or less")
+	}
+	if key.Expires != nil && !key.Expires.After(time.Now()) {
+		return errors.New("the expiry time of the API key must be in the future")
+	}
+	return nil
+}
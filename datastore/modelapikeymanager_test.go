@@ -0,0 +1,65 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package datastore
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHashAPIKey(t *testing.T) {
+	hash := HashAPIKey("LineOneAPIKey")
+	if len(hash) != 64 {
+		t.Errorf("Expected a SHA-256 hex digest, got '%s'", hash)
+	}
+	if hash == HashAPIKey("LineTwoAPIKey") {
+		t.Error("Expected different API keys to have different hashes")
+	}
+	if hash != HashAPIKey("LineOneAPIKey") {
+		t.Error("Expected the same API key to have the same hash")
+	}
+}
+
+func TestValidateModelAPIKey(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		key   ModelAPIKey
+		valid bool
+	}{
+		{ModelAPIKey{ModelID: 1, Label: "line-1"}, true},
+		{ModelAPIKey{ModelID: 1, Label: "line-1", Expires: &future}, true},
+		{ModelAPIKey{ModelID: 1, Label: "line-1", Expires: &past}, false},
+		{ModelAPIKey{ModelID: 1, Label: " "}, false},
+		{ModelAPIKey{ModelID: 1, Label: strings.Repeat("a", 201)}, false},
+	}
+
+	for _, tt := range tests {
+		err := validateModelAPIKey(tt.key)
+		if tt.valid && err != nil {
+			t.Errorf("Expected the API key to be valid: %v", err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("Expected the API key to be invalid: %v", tt.key)
+		}
+	}
+}
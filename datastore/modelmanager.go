@@ -23,6 +23,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/CanonicalLtd/serial-vault/service/log"
 )
@@ -34,18 +35,20 @@ const createModelTableSQL = `
 		name             varchar(200) not null,
 		keypair_id       int references keypair not null,
 		user_keypair_id  int references keypair not null,
-		api_key          varchar(200) not null
+		api_key          varchar(200) not null,
+		duplicate_policy varchar(20) default 'allow',
+		max_resigns      int default 0
 	)
 `
 const listModelsSQL = `
-	select m.id, brand_id, name, m.keypair_id, m.api_key, k.authority_id, k.key_id, k.active, user_keypair_id, ku.authority_id, ku.key_id, ku.active, ku.assertion
+	select m.id, brand_id, name, m.keypair_id, m.api_key, k.authority_id, k.key_id, k.active, user_keypair_id, ku.authority_id, ku.key_id, ku.active, ku.assertion, m.duplicate_policy, m.max_resigns
 	from model m
 	inner join keypair k on k.id = m.keypair_id
 	inner join keypair ku on ku.id = m.user_keypair_id
 	order by name
 `
 const listModelsForUserSQL = `
-	select m.id, brand_id, m.name, m.keypair_id, m.api_key, k.authority_id, k.key_id, k.active, user_keypair_id, ku.authority_id, ku.key_id, ku.active, ku.assertion
+	select m.id, brand_id, m.name, m.keypair_id, m.api_key, k.authority_id, k.key_id, k.active, user_keypair_id, ku.authority_id, ku.key_id, ku.active, ku.assertion, m.duplicate_policy, m.max_resigns
 	from model m
 	inner join keypair k on k.id = m.keypair_id
 	inner join keypair ku on ku.id = m.user_keypair_id
@@ -56,19 +59,20 @@ const listModelsForUserSQL = `
 	order by name
 `
 const findModelSQL = `
-	select m.id, brand_id, name, m.keypair_id, m.api_key, k.authority_id, k.key_id, k.active, k.sealed_key, user_keypair_id, ku.authority_id, ku.key_id, ku.active, ku.sealed_key, ku.assertion
+	select m.id, brand_id, name, m.keypair_id, m.api_key, k.authority_id, k.key_id, k.active, k.sealed_key, user_keypair_id, ku.authority_id, ku.key_id, ku.active, ku.sealed_key, ku.assertion, m.duplicate_policy, m.max_resigns
 	from model m
 	inner join keypair k on k.id = m.keypair_id
 	inner join keypair ku on ku.id = m.user_keypair_id
-	where brand_id=$1 and name=$2 and api_key=$3`
+	where brand_id=$1 and name=$2 and m.id in (
+		select model_id from modelapikey where key_hash=$3 and enabled=$4 and (expires is null or expires>$5))`
 const getModelSQL = `
-	select m.id, brand_id, name, m.keypair_id, m.api_key, k.authority_id, k.key_id, k.active, k.sealed_key, user_keypair_id, ku.authority_id, ku.key_id, ku.active, ku.sealed_key, ku.assertion
+	select m.id, brand_id, name, m.keypair_id, m.api_key, k.authority_id, k.key_id, k.active, k.sealed_key, user_keypair_id, ku.authority_id, ku.key_id, ku.active, ku.sealed_key, ku.assertion, m.duplicate_policy, m.max_resigns
 	from model m
 	inner join keypair k on k.id = m.keypair_id
 	inner join keypair ku on ku.id = m.user_keypair_id
 	where m.id=$1`
 const getModelForUserSQL = `
-	select m.id, m.brand_id, m.name, m.keypair_id, m.api_key, k.authority_id, k.key_id, k.active, k.sealed_key, user_keypair_id, ku.authority_id, ku.key_id, ku.active, ku.sealed_key, ku.assertion
+	select m.id, m.brand_id, m.name, m.keypair_id, m.api_key, k.authority_id, k.key_id, k.active, k.sealed_key, user_keypair_id, ku.authority_id, ku.key_id, ku.active, ku.sealed_key, ku.assertion, m.duplicate_policy, m.max_resigns
 	from model m
 	inner join keypair k on k.id = m.keypair_id
 	inner join keypair ku on ku.id = m.user_keypair_id
@@ -76,20 +80,23 @@ const getModelForUserSQL = `
 	inner join useraccountlink ua on ua.account_id=acc.id
 	inner join userinfo u on ua.user_id=u.id
 	where m.id=$1 and u.username=$2`
-const updateModelSQL = "update model set brand_id=$2, name=$3, keypair_id=$4, user_keypair_id=$5, api_key=$6 where id=$1"
+const updateModelSQL = "update model set brand_id=$2, name=$3, keypair_id=$4, user_keypair_id=$5, duplicate_policy=$6, max_resigns=$7 where id=$1"
 const updateModelForUserSQL = `
-	update model m set brand_id=$2, name=$3, keypair_id=$4, user_keypair_id=$5, api_key=$6
+	update model m set brand_id=$2, name=$3, keypair_id=$4, user_keypair_id=$5, duplicate_policy=$6, max_resigns=$7
 	from account acc
 	inner join useraccountlink ua on ua.account_id=acc.id
 	inner join userinfo u on ua.user_id=u.id
-	where acc.authority_id=m.brand_id and m.id=$1 and u.username=$7`
-const createModelSQL = "insert into model (brand_id,name,keypair_id,user_keypair_id,api_key) values ($1,$2,$3,$4,$5) RETURNING id"
+	where acc.authority_id=m.brand_id and m.id=$1 and u.username=$8`
+const updateModelAPIKeySQL = "update model set api_key=$1 where id=$2"
+
+// The API key of a new model is stored as a named key, so the model's own API key is left empty
+const createModelSQL = "insert into model (brand_id,name,keypair_id,user_keypair_id,api_key,duplicate_policy,max_resigns) values ($1,$2,$3,$4,'',$5,$6) RETURNING id"
 
 // sqlite3 syntax for syncing data locally
 const syncUpsertModelSQL = `
 	INSERT OR REPLACE INTO model
-	(id,brand_id,name,keypair_id,user_keypair_id,api_key)
-	VALUES ($1, $2, $3, $4, $5, $6)
+	(id,brand_id,name,keypair_id,user_keypair_id,api_key,duplicate_policy,max_resigns)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 `
 
 const deleteModelSQL = "delete from model where id=$1"
@@ -106,12 +113,6 @@ const checkBrandsMatchSQL = `
 	where k.authority_id=$1 and k.id=$2 and ku.id=$3
 `
 
-const checkAPIKeyExistsSQL = `
-	select exists(
-		select * from model where api_key=$1
-	)
-`
-
 const checkModelExistsSQL = `
 	select exists(
 		select * from model where brand_id=$1 and name=$2
@@ -134,11 +135,26 @@ const alterModelAPIKeyNotNullable = `alter table model
 	alter column api_key drop default
 `
 
+// Add the duplicate-signing policy to the models table
+const alterModelDuplicatePolicy = "alter table model add column duplicate_policy varchar(20) default 'allow'"
+const alterModelMaxResigns = "alter table model add column max_resigns int default 0"
+
+// The plaintext API keys of the models, that are to be replaced by named API keys
+const listPlaintextModelAPIKeysSQL = "select id, api_key from model where api_key<>''"
+
 // Indexes
 const createModelAPIKeyIndexSQL = "CREATE INDEX IF NOT EXISTS api_key_idx ON model (api_key)"
 
 const minAPIKeyLength = 10
 
+// Duplicate-signing policies, for when a serial number or device-key has been signed before
+const (
+	DuplicatePolicyAllow         = "allow"           // sign with an incremented revision
+	DuplicatePolicyReject        = "reject"          // never re-sign
+	DuplicatePolicySameDeviceKey = "same-device-key" // re-sign when the serial number is used with the same device-key
+	DuplicatePolicyMaxResigns    = "max-resigns"     // re-sign up to the maximum number of times
+)
+
 // Model holds the model details in the local database
 type Model struct {
 	ID              int            `json:"id"`
@@ -156,6 +172,8 @@ type Model struct {
 	KeyActiveUser   bool           `json:"key-active-user"`   // from the system-user keypair
 	SealedKeyUser   string         `json:"-"`                 // from the system-user keypair
 	AssertionUser   string         `json:"-"`                 // from the system-user keypair
+	DuplicatePolicy string         `json:"duplicate-policy"`
+	MaxResigns      int            `json:"max-resigns"`
 	ModelAssertion  ModelAssertion `json:"assertion"`
 }
 
@@ -177,6 +195,16 @@ func (db *DB) AlterModelTable() error {
 		return err
 	}
 
+	err = db.addColumn(alterModelDuplicatePolicy)
+	if err != nil {
+		return err
+	}
+
+	err = db.addColumn(alterModelMaxResigns)
+	if err != nil {
+		return err
+	}
+
 	// Create the index on the API key
 	_, err = db.Exec(createModelAPIKeyIndexSQL)
 	if err != nil {
@@ -237,8 +265,7 @@ func (db *DB) addAPIKeyField() error {
 		}
 
 		// Update the API key on the model
-		model.APIKey = apiKey
-		db.updateModel(model)
+		db.Exec(updateModelAPIKeySQL, apiKey, model.ID)
 	}
 
 	// Add the constraints to the API key field
@@ -278,7 +305,7 @@ func (db *DB) listModelsFilteredByUser(username string) ([]Model, error) {
 	for rows.Next() {
 		model := Model{}
 		err := rows.Scan(&model.ID, &model.BrandID, &model.Name, &model.KeypairID, &model.APIKey, &model.AuthorityID, &model.KeyID, &model.KeyActive,
-			&model.KeypairIDUser, &model.AuthorityIDUser, &model.KeyIDUser, &model.KeyActiveUser, &model.AssertionUser)
+			&model.KeypairIDUser, &model.AuthorityIDUser, &model.KeyIDUser, &model.KeyActiveUser, &model.AssertionUser, &model.DuplicatePolicy, &model.MaxResigns)
 		if err != nil {
 			return nil, fmt.Errorf("error retrieving models: %v", err)
 		}
@@ -293,13 +320,13 @@ func (db *DB) listModelsFilteredByUser(username string) ([]Model, error) {
 	return models, nil
 }
 
-// FindModel retrieves the model from the database.
+// FindModel retrieves the model from the database, using the model's own API key or one of its named API keys
 func (db *DB) FindModel(brandID, modelName, apiKey string) (Model, error) {
 	model := Model{}
 
-	err := db.QueryRow(findModelSQL, brandID, modelName, apiKey).Scan(
+	err := db.QueryRow(findModelSQL, brandID, modelName, HashAPIKey(apiKey), true, time.Now().UTC()).Scan(
 		&model.ID, &model.BrandID, &model.Name, &model.KeypairID, &model.APIKey, &model.AuthorityID, &model.KeyID, &model.KeyActive, &model.SealedKey,
-		&model.KeypairIDUser, &model.AuthorityIDUser, &model.KeyIDUser, &model.KeyActiveUser, &model.SealedKeyUser, &model.AssertionUser)
+		&model.KeypairIDUser, &model.AuthorityIDUser, &model.KeyIDUser, &model.KeyActiveUser, &model.SealedKeyUser, &model.AssertionUser, &model.DuplicatePolicy, &model.MaxResigns)
 	switch {
 	case err == sql.ErrNoRows:
 		return model, err
@@ -331,7 +358,7 @@ func (db *DB) getModelFilteredByUser(modelID int, username string) (Model, error
 	}
 
 	err := row.Scan(&model.ID, &model.BrandID, &model.Name, &model.KeypairID, &model.APIKey, &model.AuthorityID, &model.KeyID, &model.KeyActive, &model.SealedKey,
-		&model.KeypairIDUser, &model.AuthorityIDUser, &model.KeyIDUser, &model.KeyActiveUser, &model.SealedKeyUser, &model.AssertionUser)
+		&model.KeypairIDUser, &model.AuthorityIDUser, &model.KeyIDUser, &model.KeyActiveUser, &model.SealedKeyUser, &model.AssertionUser, &model.DuplicatePolicy, &model.MaxResigns)
 	if err != nil {
 		return model, fmt.Errorf("error retrieving database model %d: %v", modelID, err)
 	}
@@ -351,9 +378,9 @@ func (db *DB) updateModelFilteredByUser(model Model, username string) (string, e
 	var err error
 
 	if len(username) == 0 {
-		_, err = db.Exec(updateModelSQL, model.ID, model.BrandID, model.Name, model.KeypairID, model.KeypairIDUser, model.APIKey)
+		_, err = db.Exec(updateModelSQL, model.ID, model.BrandID, model.Name, model.KeypairID, model.KeypairIDUser, model.DuplicatePolicy, model.MaxResigns)
 	} else {
-		_, err = db.Exec(updateModelForUserSQL, model.ID, model.BrandID, model.Name, model.KeypairID, model.KeypairIDUser, model.APIKey, username)
+		_, err = db.Exec(updateModelForUserSQL, model.ID, model.BrandID, model.Name, model.KeypairID, model.KeypairIDUser, model.DuplicatePolicy, model.MaxResigns, username)
 	}
 	if err != nil {
 		return "", fmt.Errorf("error updating the database model for %s: %v", model.Name, err)
@@ -367,19 +394,28 @@ func (db *DB) createModel(model Model) (Model, string, error) {
 }
 
 func (db *DB) createModelFilteredByUser(model Model, username string) (Model, string, error) {
-	// Create the model in the database
+	// Create the model in the database, along with the hash of its API key
 	var createdModelID int
 
-	err := db.QueryRow(createModelSQL, model.BrandID, model.Name, model.KeypairID, model.KeypairIDUser, model.APIKey).Scan(&createdModelID)
+	err := db.transaction(func(tx *sql.Tx) error {
+		err := tx.QueryRow(createModelSQL, model.BrandID, model.Name, model.KeypairID, model.KeypairIDUser, model.DuplicatePolicy, model.MaxResigns).Scan(&createdModelID)
+		if err != nil {
+			return err
+		}
+
+		var keyID int
+		return tx.QueryRow(createModelAPIKeySQL, createdModelID, defaultAPIKeyLabel, HashAPIKey(model.APIKey), time.Now().UTC(), nil, true).Scan(&keyID)
+	})
 	if err != nil {
 		return model, "", fmt.Errorf("error creating the model for %s: %v", model.Name, err)
 	}
 
-	// Return the created model
+	// Return the created model. The API key is only returned now, as only its hash is stored
 	mdl, err := db.getModelFilteredByUser(createdModelID, username)
 	if err != nil {
 		return model, "", fmt.Errorf("error retrieving the created model for %s: %v", model.Name, err)
 	}
+	mdl.APIKey = model.APIKey
 	return mdl, "", nil
 }
 
@@ -390,7 +426,8 @@ func (db *DB) SyncModel(m Model) error {
 		return err
 	}
 
-	_, err = db.Exec(syncUpsertModelSQL, m.ID, m.BrandID, m.Name, m.KeypairID, m.KeypairIDUser, m.APIKey)
+	m.DuplicatePolicy = defaultDuplicatePolicy(m.DuplicatePolicy)
+	_, err = db.Exec(syncUpsertModelSQL, m.ID, m.BrandID, m.Name, m.KeypairID, m.KeypairIDUser, m.APIKey, m.DuplicatePolicy, m.MaxResigns)
 	if err != nil {
 		return err
 	}
@@ -442,8 +479,7 @@ func (db *DB) checkBrandsMatch(brandID string, keypairID, keypairIDUser int) boo
 
 // CheckAPIKey validates that there is a model for the supplied API key
 func (db *DB) CheckAPIKey(apiKey string) bool {
-	row := db.QueryRow(checkAPIKeyExistsSQL, apiKey)
-	return db.checkBoolQuery(row)
+	return db.useModelAPIKey(apiKey)
 }
 
 // CheckModelExists validates that there is a model for the brand and name
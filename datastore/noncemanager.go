@@ -21,6 +21,7 @@ package datastore
 
 import (
 	"crypto/sha1"
+	"database/sql"
 	"errors"
 	"fmt"
 	"io"
@@ -32,15 +33,13 @@ import (
 	"github.com/CanonicalLtd/serial-vault/random"
 )
 
-// Set the nonce expiry time
-const nonceMaximumAge = 600
-
 const createDeviceNonceTableSQL = `
 	CREATE TABLE IF NOT EXISTS devicenonce (
 		id             serial primary key not null,
 		nonce          varchar(200) not null,
 		timestamp      int not null,		
-		created        timestamp default current_timestamp
+		created        timestamp default current_timestamp,
+		api_key        varchar(200) default ''
 	)
 `
 
@@ -49,18 +48,36 @@ const createDeviceNonceNonceIndexSQL = "CREATE INDEX IF NOT EXISTS nonce_idx ON
 const createDeviceNonceTimeStampIndexSQL = "CREATE INDEX IF NOT EXISTS timestamp_idx ON devicenonce (timestamp)"
 
 // Queries
-const maxIDDeviceNonceSQLite = "SELECT COUNT(*)+1 from devicenonce"
-const createDeviceNonceSQLite = "INSERT INTO devicenonce (id, nonce, timestamp) VALUES ($1, $2, $3)"
-const createDeviceNonceSQL = "INSERT INTO devicenonce (nonce, timestamp) VALUES ($1, $2)"
+const maxIDDeviceNonceSQLite = "SELECT COALESCE(MAX(id), 0)+1 from devicenonce"
+const createDeviceNonceSQLite = "INSERT INTO devicenonce (id, nonce, timestamp, api_key) VALUES ($1, $2, $3, $4)"
+const createDeviceNonceSQL = "INSERT INTO devicenonce (nonce, timestamp, api_key) VALUES ($1, $2, $3)"
 const deleteExpiredDeviceNonceSQL = "DELETE FROM devicenonce where timestamp<$1"
-const deleteDeviceNonceSQL = "DELETE FROM devicenonce where nonce=$1"
+const deleteDeviceNonceSQL = "DELETE FROM devicenonce where nonce=$1 and api_key=$2 and timestamp>=$3"
+const checkDeviceNonceSQL = "SELECT EXISTS(SELECT * FROM devicenonce where nonce=$1 and api_key=$2 and timestamp>=$3)"
+
+// Add the API key that requested the nonce
+const alterDeviceNonceAddAPIKeySQL = "ALTER TABLE devicenonce ADD COLUMN api_key varchar(200) default ''"
 
-// DeviceNonce holds the details of the nonce, combining a timestamp and random text
+// DeviceNonce holds the details of the nonce, combining a timestamp and random text.
+// The nonce can only be used with the model API key that requested it
 type DeviceNonce struct {
 	ID        int
 	Nonce     string
 	TimeStamp int64
 	Created   time.Time
+	APIKey    string
+}
+
+// SQLNonceStore is the nonce store that keeps the nonces in the devicenonce table.
+// The expired nonces are removed in the background, not on every request
+type SQLNonceStore struct {
+	DB     *DB
+	MaxAge int64
+}
+
+// NewSQLNonceStore creates a nonce store for the database
+func NewSQLNonceStore(db *DB, maxAge int64) *SQLNonceStore {
+	return &SQLNonceStore{DB: db, MaxAge: maxAge}
 }
 
 // CreateDeviceNonceTable creates the database table for nonces with its indexes.
@@ -77,31 +94,42 @@ func (db *DB) CreateDeviceNonceTable() error {
 		return err
 	}
 	_, err = db.Exec(createDeviceNonceTimeStampIndexSQL)
-	return err
+	if err != nil {
+		return err
+	}
+
+	// Update the table, ignoring the error if the column already exists
+	db.Exec(alterDeviceNonceAddAPIKeySQL)
+
+	return nil
 }
 
-// CreateDeviceNonce stores a new nonce entry
-func (db *DB) CreateDeviceNonce() (DeviceNonce, error) {
+// CreateDeviceNonce stores a new nonce entry for the model API key. The nonce is stored
+// with the hash of the API key
+func (s *SQLNonceStore) CreateDeviceNonce(apiKey string) (DeviceNonce, error) {
 	// Generate a nonce with a timestamp and random string
 	nonce, err := generateNonce()
 	if err != nil {
 		log.Printf("Error creating the nonce: %v\n", err)
 		return DeviceNonce{}, err
 	}
+	nonce.APIKey = apiKey
 
 	// Create the nonce in the database
 	if InFactory() {
 		// Need to generate our own ID
-		var nextID int
-		err = db.QueryRow(maxIDDeviceNonceSQLite).Scan(&nextID)
-		if err != nil {
-			log.Printf("Error retrieving next nonce ID: %v\n", err)
-			return nonce, err
-		}
-
-		_, err = db.Exec(createDeviceNonceSQLite, nextID, nonce.Nonce, nonce.TimeStamp)
+		err = s.DB.transaction(func(tx *sql.Tx) error {
+			var nextID int
+			if err := tx.QueryRow(maxIDDeviceNonceSQLite).Scan(&nextID); err != nil {
+				log.Printf("Error retrieving next nonce ID: %v\n", err)
+				return err
+			}
+
+			_, err := tx.Exec(createDeviceNonceSQLite, nextID, nonce.Nonce, nonce.TimeStamp, HashAPIKey(nonce.APIKey))
+			return err
+		})
 	} else {
-		_, err = db.Exec(createDeviceNonceSQL, nonce.Nonce, nonce.TimeStamp)
+		_, err = s.DB.Exec(createDeviceNonceSQL, nonce.Nonce, nonce.TimeStamp, HashAPIKey(nonce.APIKey))
 	}
 
 	if err != nil {
@@ -113,10 +141,10 @@ func (db *DB) CreateDeviceNonce() (DeviceNonce, error) {
 }
 
 // DeleteExpiredDeviceNonces removes nonces with timestamp older than max allowed lifetime
-func (db *DB) DeleteExpiredDeviceNonces() error {
+func (s *SQLNonceStore) DeleteExpiredDeviceNonces() error {
 	// Remove expired nonces from the table
-	timestamp := time.Now().Unix() - nonceMaximumAge
-	_, err := db.Exec(deleteExpiredDeviceNonceSQL, timestamp)
+	timestamp := time.Now().Unix() - s.MaxAge
+	_, err := s.DB.Exec(deleteExpiredDeviceNonceSQL, timestamp)
 	if err != nil {
 		log.Printf("Error deleting expired nonces: %v\n", err)
 		return errors.New("Error communicating with the database")
@@ -125,17 +153,14 @@ func (db *DB) DeleteExpiredDeviceNonces() error {
 	return nil
 }
 
-// ValidateDeviceNonce checks that a device nonce is valid and has not expired
-func (db *DB) ValidateDeviceNonce(nonce string) error {
-	err := db.DeleteExpiredDeviceNonces()
-	if err != nil {
-		log.Printf("Error checking expired nonces: %v\n", err)
-		return err
-	}
-	// Find the nonce in the database to check that it is valid (we already deleted expired nonces)
-	// Here we attempt to delete the nonce and check the number of rows affected. This makes sure that
-	// we do not allow a nonce to be re-used.
-	result, err := db.Exec(deleteDeviceNonceSQL, nonce)
+// ValidateDeviceNonce checks that a device nonce is valid, has not expired and was requested
+// with the same model API key
+func (s *SQLNonceStore) ValidateDeviceNonce(nonce, apiKey string) error {
+	// Here we attempt to delete the unexpired nonce and check the number of rows affected. This makes
+	// sure that we do not allow a nonce to be re-used, and that the expired nonces that have not been
+	// removed yet are not accepted. A nonce that is used with another API key is left in place.
+	timestamp := time.Now().Unix() - s.MaxAge
+	result, err := s.DB.Exec(deleteDeviceNonceSQL, nonce, HashAPIKey(apiKey), timestamp)
 	if err != nil {
 		log.Printf("Error checking nonce: %v\n", err)
 		return errors.New("Error communicating with the database")
@@ -147,12 +172,29 @@ func (db *DB) ValidateDeviceNonce(nonce string) error {
 	}
 	if rows == 0 {
 		log.Println("Error invalid or expired nonce")
-		return errors.New("The nonce is invalid or expired")
+		return ErrorInvalidNonce
 	}
 
 	return nil
 }
 
+// CheckDeviceNonce checks that a device nonce is valid, has not expired and was requested with
+// the same model API key, without using it up
+func (s *SQLNonceStore) CheckDeviceNonce(nonce, apiKey string) error {
+	timestamp := time.Now().Unix() - s.MaxAge
+
+	var exists bool
+	err := s.DB.QueryRow(checkDeviceNonceSQL, nonce, HashAPIKey(apiKey), timestamp).Scan(&exists)
+	if err != nil {
+		log.Printf("Error checking nonce: %v\n", err)
+		return errors.New("Error communicating with the database")
+	}
+	if !exists {
+		return ErrorInvalidNonce
+	}
+	return nil
+}
+
 func generateNonce() (DeviceNonce, error) {
 	token, err := random.GenerateRandomString(64)
 	if err != nil {
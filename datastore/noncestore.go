@@ -0,0 +1,182 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/config"
+	"github.com/CanonicalLtd/serial-vault/service/log"
+)
+
+// Default nonce expiry time, in seconds
+const defaultNonceMaximumAge = 600
+
+// Understood nonce storage types
+const (
+	nonceStoreDatabase = "database"
+	nonceStoreMemory   = "memory"
+)
+
+// Common nonce error messages.
+var (
+	ErrorInvalidNonce          = errors.New("The nonce is invalid or expired")
+	ErrorInvalidNonceStoreType = errors.New("Invalid nonce store type specified")
+)
+
+// NonceStore interface to wrap the device nonce interactions for all store types
+type NonceStore interface {
+	CreateDeviceNonce(apiKey string) (DeviceNonce, error)
+	ValidateDeviceNonce(nonce, apiKey string) error
+	CheckDeviceNonce(nonce, apiKey string) error
+	DeleteExpiredDeviceNonces() error
+}
+
+// OpenNonceStore opens the nonce store as defined in the config file, and starts
+// the background removal of the expired nonces
+func OpenNonceStore(config config.Settings) error {
+	store, err := getNonceStore(config)
+	if err != nil {
+		return err
+	}
+
+	Environ.Nonces = store
+	go expireNonces(store, nonceExpiryInterval(config))
+	return nil
+}
+
+func getNonceStore(config config.Settings) (NonceStore, error) {
+	maxAge := nonceMaximumAge(config)
+
+	switch config.NonceStore {
+	case "", nonceStoreDatabase:
+		db, ok := Environ.DB.(*DB)
+		if !ok {
+			return nil, errors.New("The database nonce store needs an open database")
+		}
+		return NewSQLNonceStore(db, maxAge), nil
+	case nonceStoreMemory:
+		return NewMemoryNonceStore(maxAge), nil
+	default:
+		return nil, ErrorInvalidNonceStoreType
+	}
+}
+
+// nonceMaximumAge returns the configured nonce expiry time, in seconds
+func nonceMaximumAge(config config.Settings) int64 {
+	if config.NonceMaximumAge <= 0 {
+		return defaultNonceMaximumAge
+	}
+	return int64(config.NonceMaximumAge)
+}
+
+// nonceExpiryInterval checks for expired nonces a few times during the lifetime of a nonce
+func nonceExpiryInterval(config config.Settings) time.Duration {
+	return time.Duration(nonceMaximumAge(config)) * time.Second / 4
+}
+
+// expireNonces periodically removes the expired nonces from the store
+func expireNonces(store NonceStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := store.DeleteExpiredDeviceNonces(); err != nil {
+			log.Printf("Error removing the expired nonces: %v", err)
+		}
+	}
+}
+
+// MemoryNonceStore is the nonce store that keeps the nonces in memory. It is only
+// suitable for a single instance of the service e.g. in the factory
+type MemoryNonceStore struct {
+	MaxAge int64
+
+	mu     sync.Mutex
+	nonces map[string]DeviceNonce
+}
+
+// NewMemoryNonceStore creates a nonce store in memory
+func NewMemoryNonceStore(maxAge int64) *MemoryNonceStore {
+	return &MemoryNonceStore{MaxAge: maxAge, nonces: make(map[string]DeviceNonce)}
+}
+
+// CreateDeviceNonce stores a new nonce entry for the model API key
+func (s *MemoryNonceStore) CreateDeviceNonce(apiKey string) (DeviceNonce, error) {
+	nonce, err := generateNonce()
+	if err != nil {
+		log.Printf("Error creating the nonce: %v\n", err)
+		return DeviceNonce{}, err
+	}
+	nonce.Created = time.Unix(nonce.TimeStamp, 0)
+	nonce.APIKey = apiKey
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nonces[nonce.Nonce] = nonce
+	return nonce, nil
+}
+
+// ValidateDeviceNonce checks that a device nonce is valid, has not expired and was requested
+// with the same model API key. The nonce is removed, so that it cannot be re-used
+func (s *MemoryNonceStore) ValidateDeviceNonce(nonce, apiKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.nonces[nonce]
+	if !ok || stored.APIKey != apiKey {
+		return ErrorInvalidNonce
+	}
+	delete(s.nonces, nonce)
+
+	if stored.TimeStamp < time.Now().Unix()-s.MaxAge {
+		return ErrorInvalidNonce
+	}
+	return nil
+}
+
+// CheckDeviceNonce checks that a device nonce is valid, has not expired and was requested
+// with the same model API key, without using it up
+func (s *MemoryNonceStore) CheckDeviceNonce(nonce, apiKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.nonces[nonce]
+	if !ok || stored.APIKey != apiKey || stored.TimeStamp < time.Now().Unix()-s.MaxAge {
+		return ErrorInvalidNonce
+	}
+	return nil
+}
+
+// DeleteExpiredDeviceNonces removes nonces with timestamp older than max allowed lifetime
+func (s *MemoryNonceStore) DeleteExpiredDeviceNonces() error {
+	timestamp := time.Now().Unix() - s.MaxAge
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for nonce, stored := range s.nonces {
+		if stored.TimeStamp < timestamp {
+			delete(s.nonces, nonce)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016-2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+import (
+	"testing"
+
+	"github.com/CanonicalLtd/serial-vault/config"
+)
+
+func TestMemoryNonceStore(t *testing.T) {
+	store := NewMemoryNonceStore(600)
+
+	nonce, err := store.CreateDeviceNonce("ValidAPIKey")
+	if err != nil {
+		t.Fatalf("Error creating the nonce: %v", err)
+	}
+
+	// The nonce is bound to the API key that requested it
+	if err = store.ValidateDeviceNonce(nonce.Nonce, "OtherAPIKey"); err != ErrorInvalidNonce {
+		t.Errorf("Expected the nonce to be invalid for another API key, got: %v", err)
+	}
+
+	// Checking the nonce does not use it up
+	if err = store.CheckDeviceNonce(nonce.Nonce, "OtherAPIKey"); err != ErrorInvalidNonce {
+		t.Errorf("Expected the nonce check to fail for another API key, got: %v", err)
+	}
+	if err = store.CheckDeviceNonce(nonce.Nonce, "ValidAPIKey"); err != nil {
+		t.Errorf("Expected the nonce check to pass, got: %v", err)
+	}
+
+	if err = store.ValidateDeviceNonce(nonce.Nonce, "ValidAPIKey"); err != nil {
+		t.Errorf("Expected a valid nonce, got: %v", err)
+	}
+	if err = store.CheckDeviceNonce(nonce.Nonce, "ValidAPIKey"); err != ErrorInvalidNonce {
+		t.Errorf("Expected the nonce check to fail once it is used, got: %v", err)
+	}
+
+	// The nonce cannot be re-used
+	if err = store.ValidateDeviceNonce(nonce.Nonce, "ValidAPIKey"); err != ErrorInvalidNonce {
+		t.Errorf("Expected the nonce to be invalid once it is used, got: %v", err)
+	}
+	if err = store.ValidateDeviceNonce("invalid", "ValidAPIKey"); err != ErrorInvalidNonce {
+		t.Errorf("Expected an invalid nonce, got: %v", err)
+	}
+}
+
+func TestMemoryNonceStoreExpired(t *testing.T) {
+	store := NewMemoryNonceStore(600)
+
+	expired, _ := store.CreateDeviceNonce("ValidAPIKey")
+	expired.TimeStamp -= 601
+	store.nonces[expired.Nonce] = expired
+	if err := store.CheckDeviceNonce(expired.Nonce, "ValidAPIKey"); err != ErrorInvalidNonce {
+		t.Errorf("Expected the check of an expired nonce to fail, got: %v", err)
+	}
+	if err := store.ValidateDeviceNonce(expired.Nonce, "ValidAPIKey"); err != ErrorInvalidNonce {
+		t.Errorf("Expected an expired nonce, got: %v", err)
+	}
+
+	expired, _ = store.CreateDeviceNonce("ValidAPIKey")
+	expired.TimeStamp -= 601
+	store.nonces[expired.Nonce] = expired
+	valid, _ := store.CreateDeviceNonce("ValidAPIKey")
+
+	if err := store.DeleteExpiredDeviceNonces(); err != nil {
+		t.Fatalf("Error removing the expired nonces: %v", err)
+	}
+	if len(store.nonces) != 1 {
+		t.Errorf("Expected 1 nonce after the expiry, got: %d", len(store.nonces))
+	}
+	if _, ok := store.nonces[valid.Nonce]; !ok {
+		t.Error("Expected the unexpired nonce to be kept")
+	}
+}
+
+func TestGetNonceStore(t *testing.T) {
+	Environ = &Env{DB: &MockDB{}}
+
+	store, err := getNonceStore(config.Settings{NonceStore: "memory", NonceMaximumAge: 60})
+	if err != nil {
+		t.Fatalf("Error opening the memory nonce store: %v", err)
+	}
+	memStore, ok := store.(*MemoryNonceStore)
+	if !ok {
+		t.Fatalf("Expected the memory nonce store, got: %T", store)
+	}
+	if memStore.MaxAge != 60 {
+		t.Errorf("Expected the nonce maximum age to be 60, got: %d", memStore.MaxAge)
+	}
+
+	// The database store needs a database connection
+	if _, err = getNonceStore(config.Settings{}); err == nil {
+		t.Error("Expected an error opening the database nonce store without a database")
+	}
+	if _, err = getNonceStore(config.Settings{NonceStore: "invalid"}); err != ErrorInvalidNonceStoreType {
+		t.Errorf("Expected an invalid nonce store error, got: %v", err)
+	}
+
+	if age := nonceMaximumAge(config.Settings{}); age != defaultNonceMaximumAge {
+		t.Errorf("Expected the default nonce maximum age, got: %d", age)
+	}
+}
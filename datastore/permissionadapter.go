@@ -0,0 +1,98 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/CanonicalLtd/serial-vault/service/log"
+)
+
+// AllowedPermission checks that the authorization has a permission on an account
+func (db *DB) AllowedPermission(authorization User, authorityID, permission string) bool {
+	switch authorization.Role {
+	case Invalid: // Authentication is disabled
+		fallthrough
+	case Superuser:
+		return true
+	}
+
+	permissions, found, err := db.getUserAccountPermissions(authorization.Username, authorityID)
+	if err != nil {
+		log.Printf("Error retrieving the permissions of user %s: %v\n", authorization.Username, err)
+		return false
+	}
+	return permitted(authorization.Role, permissions, found, permission)
+}
+
+// SetUserAccountPermissions sets the permissions of a user on one of their accounts
+func (db *DB) SetUserAccountPermissions(userID int, authorityID string, permissions []string) error {
+	user, err := db.GetUser(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := validateAccountPermissions(permissions); err != nil {
+		return err
+	}
+
+	if !db.CheckUserInAccount(user.Username, authorityID) {
+		return fmt.Errorf("the user does not have access to the account '%s'", authorityID)
+	}
+
+	return db.setUserAccountPermissions(userID, authorityID, permissions)
+}
+
+// permitted checks a permission against the user's role and, when they have been set, the
+// user's permissions on the account
+func permitted(role int, permissions []string, found bool, permission string) bool {
+	if !hasPermission(RolePermissions[role], permission) {
+		return false
+	}
+	return !found || hasPermission(permissions, permission)
+}
+
+func hasPermission(permissions []string, permission string) bool {
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// errorPermission is the error when a user does not have a permission on an account
+func errorPermission(authorityID, permission string) error {
+	return fmt.Errorf("the user does not have the '%s' permission on the account '%s'", permission, authorityID)
+}
+
+func validateAccountPermissions(permissions []string) error {
+	if len(permissions) == 0 {
+		return errors.New("at least one permission must be given")
+	}
+	for _, p := range permissions {
+		if !hasPermission(Permissions, p) {
+			return fmt.Errorf("the permission '%s' is invalid", p)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+import "testing"
+
+func TestPermitted(t *testing.T) {
+	tests := []struct {
+		role        int
+		permissions []string
+		found       bool
+		permission  string
+		want        bool
+	}{
+		{Standard, nil, false, PermissionSystemUserIssue, true},
+		{Standard, nil, false, PermissionKeypairCreate, false},
+		{Standard, []string{PermissionKeypairCreate}, true, PermissionKeypairCreate, false},
+		{Standard, []string{PermissionSigningLogRead}, true, PermissionSystemUserIssue, false},
+		{Admin, nil, false, PermissionKeypairCreate, true},
+		{Admin, []string{PermissionSigningLogRead}, true, PermissionSigningLogRead, true},
+		{Admin, []string{PermissionSigningLogRead}, true, PermissionSystemUserIssue, false},
+		{Invalid, nil, false, PermissionSigningLogRead, false},
+	}
+
+	for _, tt := range tests {
+		if got := permitted(tt.role, tt.permissions, tt.found, tt.permission); got != tt.want {
+			t.Errorf("permitted(%d, %v, %v, %s): expected %v, got %v", tt.role, tt.permissions, tt.found, tt.permission, tt.want, got)
+		}
+	}
+}
+
+func TestValidateAccountPermissions(t *testing.T) {
+	tests := []struct {
+		permissions []string
+		valid       bool
+	}{
+		{[]string{PermissionModelEdit}, true},
+		{Permissions, true},
+		{[]string{}, false},
+		{[]string{PermissionModelEdit, "model:delete"}, false},
+	}
+
+	for _, tt := range tests {
+		err := validateAccountPermissions(tt.permissions)
+		if (err == nil) != tt.valid {
+			t.Errorf("validateAccountPermissions(%v): expected valid %v, got %v", tt.permissions, tt.valid, err)
+		}
+	}
+}
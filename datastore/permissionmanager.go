@@ -0,0 +1,161 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+const createAccountPermissionTableSQL = `
+	CREATE TABLE IF NOT EXISTS accountpermission (
+		user_id     int references userinfo not null,
+		account_id  int references account not null,
+		permissions varchar(500) not null,
+		primary key (user_id, account_id)
+	)
+`
+
+const listUserAccountPermissionsSQL = `
+	select a.authority_id, p.permissions
+	from accountpermission p
+	inner join account a on a.id=p.account_id
+	where p.user_id=$1
+	order by a.authority_id`
+
+const getUserAccountPermissionsSQL = `
+	select p.permissions
+	from accountpermission p
+	inner join userinfo u on u.id=p.user_id
+	inner join account a on a.id=p.account_id
+	where u.username=$1 and a.authority_id=$2`
+
+const createUserAccountPermissionsSQL = `
+	insert into accountpermission (user_id, account_id, permissions)
+	select $1, id, $2 from account where authority_id=$3`
+
+const deleteUserAccountPermissionsSQL = `
+	delete from accountpermission
+	where user_id=$1 and account_id in (select id from account where authority_id=$2)`
+
+const deleteUserPermissionsSQL = "delete from accountpermission where user_id=$1"
+
+// Named permissions of a user on an account
+const (
+	PermissionKeypairCreate   = "keypair:create"
+	PermissionModelEdit       = "model:edit"
+	PermissionSigningLogRead  = "signinglog:read"
+	PermissionSystemUserIssue = "systemuser:issue"
+	PermissionSubstoreEdit    = "substore:edit"
+)
+
+// Permissions are the named permissions that can be given to a user on an account
+var Permissions = []string{PermissionKeypairCreate, PermissionModelEdit, PermissionSigningLogRead, PermissionSystemUserIssue, PermissionSubstoreEdit}
+
+// RolePermissions holds the permissions of each role. A user has the permissions of their role on
+// each of their accounts, unless the permissions of the user have been set for the account.
+// A superuser has all the permissions
+var RolePermissions = map[int][]string{
+	Standard:  {PermissionSystemUserIssue},
+	SyncUser:  {PermissionSystemUserIssue, PermissionSigningLogRead},
+	Admin:     Permissions,
+	Superuser: Permissions,
+}
+
+// AccountPermissions holds the permissions of a user on an account. They replace the permissions
+// of the user's role on the account, but cannot go beyond them
+type AccountPermissions struct {
+	AuthorityID string   `json:"authority-id"`
+	Permissions []string `json:"permissions"`
+}
+
+// CreateAccountPermissionTable creates the database table for the permissions of the users on the accounts
+func (db *DB) CreateAccountPermissionTable() error {
+	_, err := db.Exec(createAccountPermissionTableSQL)
+	return err
+}
+
+// ListUserAccountPermissions lists the accounts on which the permissions of a user have been set
+func (db *DB) ListUserAccountPermissions(userID int) ([]AccountPermissions, error) {
+	permissions := []AccountPermissions{}
+
+	rows, err := db.Query(listUserAccountPermissionsSQL, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving the account permissions: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p := AccountPermissions{}
+		var perms string
+		if err := rows.Scan(&p.AuthorityID, &perms); err != nil {
+			return nil, fmt.Errorf("error retrieving the account permissions: %v", err)
+		}
+		p.Permissions = splitPermissions(perms)
+		permissions = append(permissions, p)
+	}
+
+	return permissions, rows.Err()
+}
+
+// getUserAccountPermissions fetches the permissions of a user on an account, and whether they
+// have been set
+func (db *DB) getUserAccountPermissions(username, authorityID string) ([]string, bool, error) {
+	var perms string
+	err := db.QueryRow(getUserAccountPermissionsSQL, username, authorityID).Scan(&perms)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, false, nil
+	case err != nil:
+		return nil, false, err
+	}
+	return splitPermissions(perms), true, nil
+}
+
+func (db *DB) setUserAccountPermissions(userID int, authorityID string, permissions []string) error {
+	return db.transaction(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(deleteUserAccountPermissionsSQL, userID, authorityID); err != nil {
+			return fmt.Errorf("error setting the account permissions: %v", err)
+		}
+		if _, err := tx.Exec(createUserAccountPermissionsSQL, userID, strings.Join(permissions, ","), authorityID); err != nil {
+			return fmt.Errorf("error setting the account permissions: %v", err)
+		}
+		return nil
+	})
+}
+
+// DeleteUserAccountPermissions removes the permissions of a user on an account, so the user has
+// the permissions of their role on it
+func (db *DB) DeleteUserAccountPermissions(userID int, authorityID string) error {
+	_, err := db.Exec(deleteUserAccountPermissionsSQL, userID, authorityID)
+	if err != nil {
+		return fmt.Errorf("error removing the account permissions: %v", err)
+	}
+	return nil
+}
+
+func splitPermissions(permissions string) []string {
+	if len(permissions) == 0 {
+		return []string{}
+	}
+	return strings.Split(permissions, ",")
+}
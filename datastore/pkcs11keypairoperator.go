@@ -0,0 +1,301 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016-2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/CanonicalLtd/serial-vault/crypt"
+	"github.com/snapcore/snapd/asserts"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// Timestamp used by the snapd asserts module for the signing-key packets. The
+// key ID of a signing-key depends on it, so the token keys must use the same one
+var v1FixedTimestamp = time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// DER-encoded DigestInfo prefixes needed to create PKCS#1 v1.5 signatures on the token
+var digestInfoPrefix = map[crypto.Hash][]byte{
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+// PKCS11KeypairOperator is the operator that handles interactions with a PKCS#11 token (HSM).
+// The signing-keys are imported into the token and never leave it: the assertions
+// are signed by the token, so the keys are not held in the memory store.
+type PKCS11KeypairOperator struct {
+	token PKCS11Token
+}
+
+// ImportKeypair adds a new signing-key to the PKCS#11 token.
+// The key is stored on the token, so there is no sealed signing-key to store in the database.
+func (p11Store *PKCS11KeypairOperator) ImportKeypair(authorityID, keyID, base64PrivateKey string) (string, error) {
+	privateKey, _, err := crypt.DeserializeRSAPrivateKey(base64PrivateKey)
+	if err != nil {
+		return "", err
+	}
+
+	return "", p11Store.token.importKey(keyID, privateKey)
+}
+
+// UnsealKeypair checks that the signing-key is available on the PKCS#11 token.
+// The key never leaves the token, so nothing is loaded into the memory store.
+func (p11Store *PKCS11KeypairOperator) UnsealKeypair(authorityID string, keyID string, base64SealedSigningKey string) error {
+	_, err := p11Store.PublicKey(keyID)
+	return err
+}
+
+// PublicKey retrieves the public key of a signing-key from the PKCS#11 token
+func (p11Store *PKCS11KeypairOperator) PublicKey(keyID string) (asserts.PublicKey, error) {
+	pubKey, err := p11Store.token.publicKey(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey := asserts.RSAPublicKey(pubKey)
+	if publicKey.ID() != keyID {
+		return nil, fmt.Errorf("The PKCS#11 key does not match the signing-key %s", keyID)
+	}
+	return publicKey, nil
+}
+
+// SignAssertion signs an assertion using the signing-key on the PKCS#11 token.
+// The snapd asserts module only signs with keys it holds, so the assertion content is
+// assembled here, referencing the token key, and only the signature is made by the token.
+func (p11Store *PKCS11KeypairOperator) SignAssertion(assertType *asserts.AssertionType, headers map[string]interface{}, body []byte, keyID string) (asserts.Assertion, error) {
+	pubKey, err := p11Store.token.publicKey(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := assertionContent(assertType, headers, body, keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	signer := &pkcs11Signer{token: p11Store.token, keyID: keyID, pubKey: pubKey}
+	signature, err := signer.signContent(content)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := make([]byte, 0, len(content)+2+len(signature))
+	encoded = append(encoded, content...)
+	encoded = append(encoded, "\n\n"...)
+	encoded = append(encoded, signature...)
+
+	// Decoding checks the assertion in the same way as the snapd asserts module
+	return asserts.Decode(encoded)
+}
+
+// assertionContent assembles the content of an assertion that is signed by the key, in the
+// same order as the snapd asserts module: the type, format, authority-id and revision headers,
+// the primary key headers, the other headers sorted by name, the body-length and the sign key
+func assertionContent(assertType *asserts.AssertionType, headers map[string]interface{}, body []byte, keyID string) ([]byte, error) {
+	if !utf8.Valid(body) {
+		return nil, errors.New("assertion body is not utf8")
+	}
+
+	written := map[string]bool{"type": true, "body-length": true, "sign-key-sha3-384": true}
+	buf := bytes.NewBufferString("type: " + assertType.Name)
+
+	writeHeader := func(name string) error {
+		written[name] = true
+		return appendHeader(buf, name+":", headers[name], 0)
+	}
+
+	for _, name := range []string{"format", "authority-id", "revision"} {
+		if v, ok := headers[name]; !ok || ((name == "format" || name == "revision") && v == "0") {
+			written[name] = true
+			continue
+		}
+		if err := writeHeader(name); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, name := range assertType.PrimaryKey {
+		if err := writeHeader(name); err != nil {
+			return nil, err
+		}
+	}
+
+	others := []string{}
+	for name := range headers {
+		if !written[name] {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	for _, name := range others {
+		if err := writeHeader(name); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(body) > 0 {
+		appendHeader(buf, "body-length:", strconv.Itoa(len(body)), 0)
+	}
+	appendHeader(buf, "sign-key-sha3-384:", keyID, 0)
+
+	if len(body) > 0 {
+		buf.WriteString("\n\n")
+		buf.Write(body)
+	}
+	return buf.Bytes(), nil
+}
+
+// appendHeader writes a header entry in the format of the snapd asserts module. Multi-line
+// strings are indented, and the entries of lists and maps are nested
+func appendHeader(buf *bytes.Buffer, intro string, v interface{}, indent int) error {
+	const prefix = "  "
+
+	switch x := v.(type) {
+	case nil:
+		return nil
+	case string:
+		buf.WriteByte('\n')
+		buf.WriteString(intro)
+		if strings.Contains(x, "\n") {
+			pfx := strings.Repeat(" ", indent) + "    "
+			buf.WriteByte('\n')
+			buf.WriteString(pfx)
+			x = strings.Replace(x, "\n", "\n"+pfx, -1)
+		} else {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(x)
+	case []interface{}:
+		if len(x) == 0 {
+			return nil
+		}
+		buf.WriteByte('\n')
+		buf.WriteString(intro)
+		pfx := strings.Repeat(" ", indent) + prefix + "-"
+		for _, elem := range x {
+			if err := appendHeader(buf, pfx, elem, indent+len(prefix)); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		if len(x) == 0 {
+			return nil
+		}
+		buf.WriteByte('\n')
+		buf.WriteString(intro)
+		keys := make([]string, 0, len(x))
+		for key := range x {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		pfx := strings.Repeat(" ", indent) + prefix
+		for _, key := range keys {
+			if err := appendHeader(buf, pfx+key+":", x[key], len(pfx)); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("header values must be strings, lists or maps, got: %T", v)
+	}
+	return nil
+}
+
+// pkcs11Signer is a crypto.Signer that signs using a private key on the PKCS#11 token
+type pkcs11Signer struct {
+	token  PKCS11Token
+	keyID  string
+	pubKey *rsa.PublicKey
+}
+
+// Public returns the public key of the token key
+func (s *pkcs11Signer) Public() crypto.PublicKey {
+	return s.pubKey
+}
+
+// Sign creates a PKCS#1 v1.5 signature of the digest on the token
+func (s *pkcs11Signer) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	prefix, ok := digestInfoPrefix[opts.HashFunc()]
+	if !ok {
+		return nil, errors.New("Unsupported hash function for the PKCS#11 signature")
+	}
+
+	data := make([]byte, 0, len(prefix)+len(digest))
+	data = append(data, prefix...)
+	data = append(data, digest...)
+
+	return s.token.sign(s.keyID, data)
+}
+
+// signContent creates the encoded signature of the assertion content, in the
+// same way as the snapd asserts module
+func (s *pkcs11Signer) signContent(content []byte) ([]byte, error) {
+	privateKey := packet.NewSignerPrivateKey(v1FixedTimestamp, s)
+
+	sig := new(packet.Signature)
+	sig.PubKeyAlgo = privateKey.PubKeyAlgo
+	sig.Hash = crypto.SHA512
+	sig.CreationTime = time.Now()
+
+	h := sig.Hash.New()
+	h.Write(content)
+
+	err := sig.Sign(h, privateKey, &packet.Config{DefaultHash: crypto.SHA512})
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteByte(0x1) // v1 format header
+	if err = sig.Serialize(buf); err != nil {
+		return nil, err
+	}
+
+	return encodeSignature(buf.Bytes()), nil
+}
+
+// encodeSignature base64 encodes the signature, wrapping the lines at the length
+// used by the snapd asserts module
+func encodeSignature(data []byte) []byte {
+	const maxEncodeLineLength = 76
+
+	flat := base64.StdEncoding.EncodeToString(data)
+
+	buf := new(bytes.Buffer)
+	for len(flat) > maxEncodeLineLength {
+		buf.WriteString(flat[:maxEncodeLineLength])
+		buf.WriteByte('\n')
+		flat = flat[maxEncodeLineLength:]
+	}
+	buf.WriteString(flat)
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
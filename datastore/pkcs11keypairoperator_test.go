@@ -0,0 +1,238 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016-2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/config"
+	"github.com/snapcore/snapd/asserts"
+)
+
+type mockPKCS11Token struct {
+	keys map[string]*rsa.PrivateKey
+}
+
+func (tok *mockPKCS11Token) importKey(label string, key *rsa.PrivateKey) error {
+	tok.keys[label] = key
+	return nil
+}
+
+func (tok *mockPKCS11Token) publicKey(label string) (*rsa.PublicKey, error) {
+	key, ok := tok.keys[label]
+	if !ok {
+		return nil, ErrorPKCS11KeyMissing
+	}
+	return &key.PublicKey, nil
+}
+
+func (tok *mockPKCS11Token) sign(label string, data []byte) ([]byte, error) {
+	key, ok := tok.keys[label]
+	if !ok {
+		return nil, ErrorPKCS11KeyMissing
+	}
+	// Raw PKCS#1 v1.5 signature of the DigestInfo, as the CKM_RSA_PKCS mechanism
+	return rsa.SignPKCS1v15(rand.Reader, key, 0, data)
+}
+
+func getPKCS11KeyStoreWithToken(token PKCS11Token) *KeypairDatabase {
+	config := config.Settings{KeyStoreType: "pkcs11"}
+	Environ = &Env{Config: config, DB: &MockDB{}}
+
+	db, _ := asserts.OpenDatabase(&asserts.DatabaseConfig{
+		KeypairManager: asserts.NewMemoryKeypairManager(),
+	})
+
+	keypairDB = KeypairDatabase{PKCS11Store, db, &PKCS11KeypairOperator{token: token}}
+	return &keypairDB
+}
+
+func readTestSigningKey(t *testing.T) string {
+	signingKey, err := ioutil.ReadFile("../keystore/TestKey.asc")
+	if err != nil {
+		t.Fatalf("Error reading the signing-key file: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(signingKey)
+}
+
+func testPKCS11SignAssertion(t *testing.T, keypairDB *KeypairDatabase) {
+	privateKey, sealedKey, err := keypairDB.ImportSigningKey("System", readTestSigningKey(t))
+	if err != nil {
+		t.Fatalf("Error importing the signing-key: %v", err)
+	}
+	if sealedKey != "" {
+		t.Errorf("Expected no sealed signing-key, got: %s", sealedKey)
+	}
+	keyID := privateKey.PublicKey().ID()
+
+	// The signing-key must not be in the memory store
+	if _, err = keypairDB.Database.PublicKey(keyID); err == nil {
+		t.Error("Expected the signing-key to be kept out of the memory store")
+	}
+
+	publicKey, err := keypairDB.PublicKey(keyID)
+	if err != nil {
+		t.Fatalf("Error fetching the public key: %v", err)
+	}
+	if publicKey.ID() != keyID {
+		t.Errorf("Expected key ID '%s', got: %s", keyID, publicKey.ID())
+	}
+
+	if err = keypairDB.LoadKeypair("System", keyID, sealedKey); err != nil {
+		t.Errorf("Error loading the signing-key: %v", err)
+	}
+
+	headers := map[string]interface{}{
+		"authority-id": "System",
+		"brand-id":     "System",
+		"model":        "alder",
+		"series":       "16",
+		"architecture": "amd64",
+		"gadget":       "alder-gadget",
+		"kernel":       "alder-kernel",
+		"timestamp":    time.Now().UTC().Format(time.RFC3339),
+	}
+	assertion, err := keypairDB.SignAssertion(asserts.ModelType, headers, nil, "System", keyID, sealedKey)
+	if err != nil {
+		t.Fatalf("Error signing the assertion: %v", err)
+	}
+	if assertion.SignKeyID() != keyID {
+		t.Errorf("Expected sign key '%s', got: %s", keyID, assertion.SignKeyID())
+	}
+	if err = asserts.SignatureCheck(assertion, publicKey); err != nil {
+		t.Errorf("Error verifying the assertion signature: %v", err)
+	}
+}
+
+func TestPKCS11GetKeyStore(t *testing.T) {
+	config := config.Settings{KeyStoreType: "pkcs11", PKCS11Module: "/invalid/libsofthsm2.so", PKCS11Token: "serial-vault"}
+	Environ = &Env{Config: config}
+
+	keystore, err := getKeyStore(config)
+	if err != nil {
+		t.Errorf("Error setting up the PKCS#11 keystore: %v", err)
+	}
+	if keystore.KeyStoreType != PKCS11Store {
+		t.Errorf("Expected the PKCS#11 keystore, got: %s", keystore.KeyStoreType.Name)
+	}
+
+	// The module is loaded when the token is first used
+	if _, err = keystore.PublicKey("invalid"); err != ErrorPKCS11Module {
+		t.Errorf("Expected module error, got: %v", err)
+	}
+}
+
+func TestPKCS11SignAssertion(t *testing.T) {
+	keypairDB := getPKCS11KeyStoreWithToken(&mockPKCS11Token{keys: map[string]*rsa.PrivateKey{}})
+	testPKCS11SignAssertion(t, keypairDB)
+}
+
+func TestPKCS11AssertionContent(t *testing.T) {
+	keypairDB := getPKCS11KeyStoreWithToken(&mockPKCS11Token{keys: map[string]*rsa.PrivateKey{}})
+	privateKey, _, err := keypairDB.ImportSigningKey("System", readTestSigningKey(t))
+	if err != nil {
+		t.Fatalf("Error importing the signing-key: %v", err)
+	}
+	keyID := privateKey.PublicKey().ID()
+
+	// The content is the same as the content assembled by the snapd asserts module
+	db, err := asserts.OpenDatabase(&asserts.DatabaseConfig{KeypairManager: asserts.NewMemoryKeypairManager()})
+	if err != nil {
+		t.Fatalf("Error opening the memory store: %v", err)
+	}
+	if err = db.ImportKey(privateKey); err != nil {
+		t.Fatalf("Error importing the signing-key: %v", err)
+	}
+
+	deviceKey, err := asserts.EncodePublicKey(privateKey.PublicKey())
+	if err != nil {
+		t.Fatalf("Error encoding the device-key: %v", err)
+	}
+	headers := map[string]interface{}{
+		"authority-id":        "System",
+		"brand-id":            "System",
+		"model":               "alder",
+		"serial":              "A123456L",
+		"device-key":          string(deviceKey),
+		"device-key-sha3-384": keyID,
+		"revision":            "2",
+		"extra":               []interface{}{"one", map[string]interface{}{"name": "two", "lines": "a\nb"}},
+		"timestamp":           time.Now().UTC().Format(time.RFC3339),
+	}
+	body := []byte("the body")
+
+	expected, err := db.Sign(asserts.SerialType, headers, body, keyID)
+	if err != nil {
+		t.Fatalf("Error signing the assertion: %v", err)
+	}
+	assertion, err := keypairDB.SignAssertion(asserts.SerialType, headers, body, "System", keyID, "")
+	if err != nil {
+		t.Fatalf("Error signing the assertion: %v", err)
+	}
+
+	content, _ := assertion.Signature()
+	expectedContent, _ := expected.Signature()
+	if string(content) != string(expectedContent) {
+		t.Errorf("Expected content:\n%s\ngot:\n%s", expectedContent, content)
+	}
+	if err = asserts.SignatureCheck(assertion, privateKey.PublicKey()); err != nil {
+		t.Errorf("Error verifying the assertion signature: %v", err)
+	}
+}
+
+func TestPKCS11LoadKeypairMissing(t *testing.T) {
+	keypairDB := getPKCS11KeyStoreWithToken(&mockPKCS11Token{keys: map[string]*rsa.PrivateKey{}})
+
+	if err := keypairDB.LoadKeypair("System", "invalid", ""); err != ErrorPKCS11KeyMissing {
+		t.Errorf("Expected missing key error, got: %v", err)
+	}
+	if _, err := keypairDB.SignAssertion(asserts.ModelType, map[string]interface{}{}, nil, "System", "invalid", ""); err != ErrorPKCS11KeyMissing {
+		t.Errorf("Expected missing key error, got: %v", err)
+	}
+}
+
+// TestPKCS11SoftHSM runs against a real token e.g.
+//   softhsm2-util --init-token --free --label serial-vault --so-pin 1234 --pin 1234
+//   PKCS11_MODULE=/usr/lib/softhsm/libsofthsm2.so PKCS11_TOKEN=serial-vault PKCS11_PIN=1234 go test ./datastore
+func TestPKCS11SoftHSM(t *testing.T) {
+	if os.Getenv("PKCS11_MODULE") == "" {
+		t.Skip("PKCS11_MODULE is not set")
+	}
+
+	config := config.Settings{
+		KeyStoreType:   "pkcs11",
+		PKCS11Module:   os.Getenv("PKCS11_MODULE"),
+		PKCS11Token:    os.Getenv("PKCS11_TOKEN"),
+		KeyStoreSecret: os.Getenv("PKCS11_PIN"),
+	}
+	Environ = &Env{Config: config, DB: &MockDB{}}
+
+	keypairDB, err := getKeyStore(config)
+	if err != nil {
+		t.Fatalf("Error setting up the PKCS#11 keystore: %v", err)
+	}
+	testPKCS11SignAssertion(t, keypairDB)
+}
@@ -0,0 +1,259 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016-2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/CanonicalLtd/serial-vault/service/log"
+	"github.com/miekg/pkcs11"
+)
+
+// Common PKCS#11 error messages.
+var (
+	ErrorPKCS11Module       = errors.New("Cannot load the PKCS#11 module")
+	ErrorPKCS11TokenMissing = errors.New("Cannot find the PKCS#11 token")
+	ErrorPKCS11KeyMissing   = errors.New("Cannot find the signing-key on the PKCS#11 token")
+	ErrorPKCS11Sync         = errors.New("The signing-keys are held on the PKCS#11 token, so they cannot be synced to a factory")
+)
+
+// PKCS11Token is an interface for wrapping the PKCS#11 token operations.
+// Keys are referenced on the token by their label, which is the key ID of the signing-key
+type PKCS11Token interface {
+	importKey(label string, key *rsa.PrivateKey) error
+	publicKey(label string) (*rsa.PublicKey, error)
+	sign(label string, data []byte) ([]byte, error)
+}
+
+// pkcs11Token holds a logged-in session to a token, provided by a PKCS#11 module (e.g. SoftHSM)
+type pkcs11Token struct {
+	module string
+	label  string
+	pin    string
+
+	mu      sync.Mutex
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+}
+
+// open loads the PKCS#11 module and logs in to the token, if that has not been done already
+func (tok *pkcs11Token) open() error {
+	if tok.ctx != nil {
+		return nil
+	}
+
+	ctx := pkcs11.New(tok.module)
+	if ctx == nil {
+		log.Printf("Error loading the PKCS#11 module: %s", tok.module)
+		return ErrorPKCS11Module
+	}
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return err
+	}
+
+	slot, err := tok.findSlot(ctx)
+	if err != nil {
+		ctx.Finalize()
+		ctx.Destroy()
+		return err
+	}
+
+	session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		ctx.Finalize()
+		ctx.Destroy()
+		return err
+	}
+
+	err = ctx.Login(session, pkcs11.CKU_USER, tok.pin)
+	if err != nil && err != pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+		ctx.CloseSession(session)
+		ctx.Finalize()
+		ctx.Destroy()
+		return err
+	}
+
+	tok.ctx = ctx
+	tok.session = session
+	return nil
+}
+
+// findSlot finds the slot that holds the token with the configured label
+func (tok *pkcs11Token) findSlot(ctx *pkcs11.Ctx) (uint, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, slot := range slots {
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil {
+			continue
+		}
+		if info.Label == tok.label {
+			return slot, nil
+		}
+	}
+	return 0, ErrorPKCS11TokenMissing
+}
+
+// findObject finds the handle of a key object on the token by its class and label
+func (tok *pkcs11Token) findObject(class uint, label string) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+	if err := tok.ctx.FindObjectsInit(tok.session, template); err != nil {
+		return 0, err
+	}
+	defer tok.ctx.FindObjectsFinal(tok.session)
+
+	objects, _, err := tok.ctx.FindObjects(tok.session, 1)
+	if err != nil {
+		return 0, err
+	}
+	if len(objects) == 0 {
+		return 0, ErrorPKCS11KeyMissing
+	}
+	return objects[0], nil
+}
+
+// importKey creates the private and public key objects on the token. The private key is
+// marked as sensitive and non-extractable, so it cannot be read back from the token
+func (tok *pkcs11Token) importKey(label string, key *rsa.PrivateKey) error {
+	tok.mu.Lock()
+	defer tok.mu.Unlock()
+
+	if err := tok.open(); err != nil {
+		return err
+	}
+
+	// Nothing to do if the key has already been imported
+	if _, err := tok.findObject(pkcs11.CKO_PRIVATE_KEY, label); err == nil {
+		return nil
+	}
+
+	key.Precompute()
+	if len(key.Primes) != 2 {
+		return fmt.Errorf("Unsupported RSA key with %d primes", len(key.Primes))
+	}
+
+	exponent := big.NewInt(int64(key.E)).Bytes()
+
+	_, err := tok.ctx.CreateObject(tok.session, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PUBLIC_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_RSA),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, []byte(label)),
+		pkcs11.NewAttribute(pkcs11.CKA_MODULUS, key.N.Bytes()),
+		pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, exponent),
+	})
+	if err != nil {
+		log.Printf("Error creating the public key on the PKCS#11 token: %v", err)
+		return err
+	}
+
+	_, err = tok.ctx.CreateObject(tok.session, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_RSA),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+		pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, []byte(label)),
+		pkcs11.NewAttribute(pkcs11.CKA_MODULUS, key.N.Bytes()),
+		pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, exponent),
+		pkcs11.NewAttribute(pkcs11.CKA_PRIVATE_EXPONENT, key.D.Bytes()),
+		pkcs11.NewAttribute(pkcs11.CKA_PRIME_1, key.Primes[0].Bytes()),
+		pkcs11.NewAttribute(pkcs11.CKA_PRIME_2, key.Primes[1].Bytes()),
+		pkcs11.NewAttribute(pkcs11.CKA_EXPONENT_1, key.Precomputed.Dp.Bytes()),
+		pkcs11.NewAttribute(pkcs11.CKA_EXPONENT_2, key.Precomputed.Dq.Bytes()),
+		pkcs11.NewAttribute(pkcs11.CKA_COEFFICIENT, key.Precomputed.Qinv.Bytes()),
+	})
+	if err != nil {
+		log.Printf("Error creating the private key on the PKCS#11 token: %v", err)
+	}
+	return err
+}
+
+// publicKey reads the public key of a signing-key from the token
+func (tok *pkcs11Token) publicKey(label string) (*rsa.PublicKey, error) {
+	tok.mu.Lock()
+	defer tok.mu.Unlock()
+
+	if err := tok.open(); err != nil {
+		return nil, err
+	}
+
+	obj, err := tok.findObject(pkcs11.CKO_PUBLIC_KEY, label)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs, err := tok.ctx.GetAttributeValue(tok.session, obj, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pubKey := &rsa.PublicKey{N: new(big.Int)}
+	for _, a := range attrs {
+		switch a.Type {
+		case pkcs11.CKA_MODULUS:
+			pubKey.N.SetBytes(a.Value)
+		case pkcs11.CKA_PUBLIC_EXPONENT:
+			pubKey.E = int(new(big.Int).SetBytes(a.Value).Int64())
+		}
+	}
+	return pubKey, nil
+}
+
+// sign creates a PKCS#1 v1.5 signature of the data using the private key on the token.
+// The data is expected to be the DER-encoded DigestInfo of the hashed content
+func (tok *pkcs11Token) sign(label string, data []byte) ([]byte, error) {
+	tok.mu.Lock()
+	defer tok.mu.Unlock()
+
+	if err := tok.open(); err != nil {
+		return nil, err
+	}
+
+	obj, err := tok.findObject(pkcs11.CKO_PRIVATE_KEY, label)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tok.ctx.SignInit(tok.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)}, obj)
+	if err != nil {
+		return nil, err
+	}
+	return tok.ctx.Sign(tok.session, data)
+}
@@ -0,0 +1,68 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+import (
+	"errors"
+)
+
+// GetAllowedModelQuota returns the quota and usage of a model, if the user is authorized
+// to see the model
+func (db *DB) GetAllowedModelQuota(modelID int, authorization User) (ModelQuota, error) {
+	model, err := db.GetAllowedModel(modelID, authorization)
+	if err != nil {
+		return ModelQuota{}, err
+	}
+	if model.ID == 0 {
+		return ModelQuota{}, errors.New("You do not have permissions to this model")
+	}
+
+	switch authorization.Role {
+	case Invalid: // Authentication disabled
+		fallthrough
+	case Superuser:
+		fallthrough
+	case Admin:
+		return db.GetModelQuota(model)
+	default:
+		return ModelQuota{}, nil
+	}
+}
+
+// UpdateAllowedModelQuota sets the rate limit and quotas of a model, if the user is authorized
+// to update the model
+func (db *DB) UpdateAllowedModelQuota(modelID int, quota ModelQuota, authorization User) (ModelQuota, error) {
+	model, err := db.getAllowedModelToEdit(modelID, authorization)
+	if err != nil {
+		return quota, err
+	}
+
+	switch authorization.Role {
+	case Invalid: // Authentication is disabled
+		fallthrough
+	case Superuser:
+		fallthrough
+	case Admin:
+		return db.updateModelQuota(model, quota)
+	default:
+		return quota, nil
+	}
+}
@@ -0,0 +1,307 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/service/log"
+)
+
+const createModelQuotaTableSQL = `
+	CREATE TABLE IF NOT EXISTS modelquota (
+		id              serial primary key not null,
+		model_id        int references model not null,
+		rate_limit      int default 0,
+		daily_quota     int default 0,
+		monthly_quota   int default 0,
+		unique (model_id)
+	)
+`
+
+const createModelUsageTableSQL = `
+	CREATE TABLE IF NOT EXISTS modelusage (
+		model_id        int not null,
+		period          varchar(10) not null,
+		count           int default 0,
+		primary key (model_id, period)
+	)
+`
+
+// The limits of the models of an API key, with their daily and monthly usage
+const listAPIKeyQuotaSQL = `
+	select m.id, m.brand_id, m.name, coalesce(q.rate_limit, 0), coalesce(q.daily_quota, 0), coalesce(q.monthly_quota, 0),
+		coalesce(ud.count, 0), coalesce(um.count, 0)
+	from model m
+	left outer join modelquota q on q.model_id=m.id
+	left outer join modelusage ud on ud.model_id=m.id and ud.period=$1
+	left outer join modelusage um on um.model_id=m.id and um.period=$2
+	where m.id in (
+		select model_id from modelapikey where key_hash=$3 and enabled=$4 and (expires is null or expires>$5))
+	order by m.id`
+
+const getModelQuotaSQL = "select rate_limit, daily_quota, monthly_quota from modelquota where model_id=$1"
+const updateModelQuotaSQL = "update modelquota set rate_limit=$1, daily_quota=$2, monthly_quota=$3 where model_id=$4"
+const createModelQuotaSQLite = "insert into modelquota (id, model_id, rate_limit, daily_quota, monthly_quota) values ((select coalesce(max(id), 0)+1 from modelquota), $1, $2, $3, $4)"
+const createModelQuotaSQL = "insert into modelquota (model_id, rate_limit, daily_quota, monthly_quota) values ($1, $2, $3, $4)"
+
+// The usage is recorded against the model, whichever of its API keys is used
+const getModelUsageSQL = "select count from modelusage where model_id=$1 and period=$2"
+const incrementModelUsageSQL = "update modelusage set count=count+$1 where model_id=$2 and period=$3"
+const reserveModelUsageSQL = "update modelusage set count=count+$1 where model_id=$2 and period=$3 and count<=$4"
+const createModelUsageSQLite = "insert or ignore into modelusage (model_id, period, count) values ($1, $2, 0)"
+const createModelUsageSQL = "insert into modelusage (model_id, period, count) values ($1, $2, 0) on conflict do nothing"
+
+// errQuotaUsed rolls back a reservation that would take the usage past a quota
+var errQuotaUsed = errors.New("The quota has been used up")
+
+// ModelQuota holds the rate limit (requests per minute) of the model's API keys, and the daily
+// and monthly quotas (signed serials) of the model. A zero value is unlimited
+type ModelQuota struct {
+	ModelID      int    `json:"model-id"`
+	BrandID      string `json:"brand-id"`
+	Model        string `json:"model"`
+	RateLimit    int    `json:"rate-limit"`
+	DailyQuota   int    `json:"daily-quota"`
+	MonthlyQuota int    `json:"monthly-quota"`
+	DailyUsage   int    `json:"daily-usage"`
+	MonthlyUsage int    `json:"monthly-usage"`
+}
+
+// APIKeyQuota holds the rate limit of an API key, combined from the models that use the key,
+// and the quotas and usage of each of the models
+type APIKeyQuota struct {
+	RateLimit int
+	Models    []ModelQuota
+}
+
+// QuotaPeriods returns the daily and monthly usage periods for the time, in UTC
+func QuotaPeriods(t time.Time) (string, string) {
+	t = t.UTC()
+	return t.Format("2006-01-02"), t.Format("2006-01")
+}
+
+// CreateModelQuotaTable creates the database table for the model quotas
+func (db *DB) CreateModelQuotaTable() error {
+	_, err := db.Exec(createModelQuotaTableSQL)
+	return err
+}
+
+// CreateModelUsageTable creates the database table for the quota usage of the models
+func (db *DB) CreateModelUsageTable() error {
+	_, err := db.Exec(createModelUsageTableSQL)
+	return err
+}
+
+// GetAPIKeyQuota returns the limits of an API key, with the usage of its models at the time.
+// When the key is shared by several models, the lowest rate limit is used
+func (db *DB) GetAPIKeyQuota(apiKey string, now time.Time) (APIKeyQuota, error) {
+	quota := APIKeyQuota{}
+	daily, monthly := QuotaPeriods(now)
+
+	rows, err := db.Query(listAPIKeyQuotaSQL, daily, monthly, HashAPIKey(apiKey), true, time.Now().UTC())
+	if err != nil {
+		log.Printf("Error retrieving the API key quota: %v\n", err)
+		return quota, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m := ModelQuota{}
+		err := rows.Scan(&m.ModelID, &m.BrandID, &m.Model, &m.RateLimit, &m.DailyQuota, &m.MonthlyQuota, &m.DailyUsage, &m.MonthlyUsage)
+		if err != nil {
+			return quota, err
+		}
+		quota.RateLimit = lowestLimit(quota.RateLimit, m.RateLimit)
+		quota.Models = append(quota.Models, m)
+	}
+
+	return quota, rows.Err()
+}
+
+// ReserveModelQuota adds serials that are about to be signed for the model to its daily and
+// monthly usage, as long as the usage stays within the quotas. The usage is checked as part of the
+// update, so concurrent requests cannot reserve past the quotas. It returns whether the serials
+// were reserved, along with the quota of the model and its usage
+func (db *DB) ReserveModelQuota(model Model, count int, now time.Time) (bool, ModelQuota, error) {
+	quota := ModelQuota{ModelID: model.ID, BrandID: model.BrandID, Model: model.Name}
+	daily, monthly := QuotaPeriods(now)
+
+	err := db.transaction(func(tx *sql.Tx) error {
+		err := tx.QueryRow(getModelQuotaSQL, model.ID).Scan(&quota.RateLimit, &quota.DailyQuota, &quota.MonthlyQuota)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		if err := reserveUsage(tx, model.ID, daily, count, quota.DailyQuota); err != nil {
+			return err
+		}
+		return reserveUsage(tx, model.ID, monthly, count, quota.MonthlyQuota)
+	})
+	if err != nil && err != errQuotaUsed {
+		log.Printf("Error reserving the model quota: %v\n", err)
+		return false, quota, err
+	}
+
+	var errUsage error
+	quota.DailyUsage, quota.MonthlyUsage, errUsage = db.GetModelUsage(model.ID, now)
+	if errUsage != nil {
+		log.Printf("Error retrieving the model usage: %v\n", errUsage)
+	}
+	return err == nil, quota, nil
+}
+
+// ReleaseModelQuota removes serials that were reserved, but not signed, from the daily and
+// monthly usage of the model. The time is the time of the reservation
+func (db *DB) ReleaseModelQuota(modelID, count int, now time.Time) error {
+	daily, monthly := QuotaPeriods(now)
+
+	err := db.transaction(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(incrementModelUsageSQL, -count, modelID, daily); err != nil {
+			return err
+		}
+		_, err := tx.Exec(incrementModelUsageSQL, -count, modelID, monthly)
+		return err
+	})
+	if err != nil {
+		log.Printf("Error releasing the model quota: %v\n", err)
+	}
+	return err
+}
+
+// GetModelUsage returns the daily and monthly usage of the model
+func (db *DB) GetModelUsage(modelID int, now time.Time) (int, int, error) {
+	daily, monthly := QuotaPeriods(now)
+	dailyUsage, err := db.getUsage(modelID, daily)
+	if err != nil {
+		return 0, 0, err
+	}
+	monthlyUsage, err := db.getUsage(modelID, monthly)
+	return dailyUsage, monthlyUsage, err
+}
+
+// GetModelQuota returns the quota of a model, with its usage
+func (db *DB) GetModelQuota(model Model) (ModelQuota, error) {
+	quota := ModelQuota{ModelID: model.ID, BrandID: model.BrandID, Model: model.Name}
+
+	err := db.QueryRow(getModelQuotaSQL, model.ID).Scan(&quota.RateLimit, &quota.DailyQuota, &quota.MonthlyQuota)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error retrieving the model quota: %v\n", err)
+		return quota, err
+	}
+
+	quota.DailyUsage, quota.MonthlyUsage, err = db.GetModelUsage(model.ID, time.Now())
+	if err != nil {
+		log.Printf("Error retrieving the model usage: %v\n", err)
+	}
+	return quota, err
+}
+
+// updateModelQuota sets the quota of a model
+func (db *DB) updateModelQuota(model Model, quota ModelQuota) (ModelQuota, error) {
+	if err := validateModelQuota(quota); err != nil {
+		return quota, err
+	}
+
+	err := db.transaction(func(tx *sql.Tx) error {
+		result, err := tx.Exec(updateModelQuotaSQL, quota.RateLimit, quota.DailyQuota, quota.MonthlyQuota, model.ID)
+		if err != nil {
+			return err
+		}
+		if rows, err := result.RowsAffected(); err != nil || rows > 0 {
+			return err
+		}
+
+		if InFactory() {
+			_, err = tx.Exec(createModelQuotaSQLite, model.ID, quota.RateLimit, quota.DailyQuota, quota.MonthlyQuota)
+		} else {
+			_, err = tx.Exec(createModelQuotaSQL, model.ID, quota.RateLimit, quota.DailyQuota, quota.MonthlyQuota)
+		}
+		return err
+	})
+	if err != nil {
+		log.Printf("Error updating the model quota: %v\n", err)
+		return quota, err
+	}
+
+	return db.GetModelQuota(model)
+}
+
+func (db *DB) getUsage(modelID int, period string) (int, error) {
+	var count int
+	err := db.QueryRow(getModelUsageSQL, modelID, period).Scan(&count)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return count, err
+}
+
+// reserveUsage adds to the usage of the model for the period, unless that takes the usage past
+// the quota. The transaction is rolled back with errQuotaUsed when the quota is used up
+func reserveUsage(tx *sql.Tx, modelID int, period string, count, quota int) error {
+	// Make sure there is a row for the period, so that the update can check the usage
+	createSQL := createModelUsageSQL
+	if InFactory() {
+		createSQL = createModelUsageSQLite
+	}
+	if _, err := tx.Exec(createSQL, modelID, period); err != nil {
+		return err
+	}
+
+	var result sql.Result
+	var err error
+	if quota > 0 {
+		result, err = tx.Exec(reserveModelUsageSQL, count, modelID, period, quota-count)
+	} else {
+		result, err = tx.Exec(incrementModelUsageSQL, count, modelID, period)
+	}
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errQuotaUsed
+	}
+	return nil
+}
+
+// lowestLimit returns the lowest of two limits, where zero is unlimited
+func lowestLimit(a, b int) int {
+	if a == 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+func validateModelQuota(quota ModelQuota) error {
+	if quota.RateLimit < 0 || quota.DailyQuota < 0 || quota.MonthlyQuota < 0 {
+		return errors.New("The rate limit and quotas cannot be negative")
+	}
+	if quota.DailyQuota > 0 && quota.MonthlyQuota > 0 && quota.DailyQuota > quota.MonthlyQuota {
+		return errors.New("The daily quota cannot be more than the monthly quota")
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/config"
+	check "gopkg.in/check.v1"
+)
+
+type quotaSuite struct{}
+
+var _ = check.Suite(&quotaSuite{})
+
+func (s *quotaSuite) TestReserveModelQuota(c *check.C) {
+	Environ = &Env{Config: config.Settings{Driver: "sqlite3"}}
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	c.Assert(err, check.IsNil)
+	defer sqlDB.Close()
+	sqlDB.SetMaxOpenConns(1)
+
+	db := &DB{DB: sqlDB}
+	c.Assert(db.CreateModelQuotaTable(), check.IsNil)
+	c.Assert(db.CreateModelUsageTable(), check.IsNil)
+
+	model := Model{ID: 1, BrandID: "system", Name: "alder"}
+	_, err = db.updateModelQuota(model, ModelQuota{DailyQuota: 3, MonthlyQuota: 4})
+	c.Assert(err, check.IsNil)
+	now := time.Date(2020, time.March, 30, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		count   int
+		success bool
+		daily   int
+		monthly int
+	}{
+		{2, true, 2, 2},
+		{2, false, 2, 2},
+		{1, true, 3, 3},
+		{1, false, 3, 3},
+	}
+	for _, t := range tests {
+		ok, quota, err := db.ReserveModelQuota(model, t.count, now)
+		c.Assert(err, check.IsNil)
+		c.Assert(ok, check.Equals, t.success)
+		c.Assert(quota.DailyUsage, check.Equals, t.daily)
+		c.Assert(quota.MonthlyUsage, check.Equals, t.monthly)
+	}
+
+	// The released quota can be reserved again
+	c.Assert(db.ReleaseModelQuota(model.ID, 1, now), check.IsNil)
+	ok, _, err := db.ReserveModelQuota(model, 1, now)
+	c.Assert(err, check.IsNil)
+	c.Assert(ok, check.Equals, true)
+
+	// The daily usage is not reserved when the monthly quota is used up
+	ok, quota, err := db.ReserveModelQuota(model, 2, now.Add(24*time.Hour))
+	c.Assert(err, check.IsNil)
+	c.Assert(ok, check.Equals, false)
+	c.Assert(quota.DailyUsage, check.Equals, 0)
+	c.Assert(quota.MonthlyUsage, check.Equals, 3)
+}
@@ -0,0 +1,119 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/service/log"
+)
+
+const createRemodelHistoryTableSQL = `
+	CREATE TABLE IF NOT EXISTS remodelhistory (
+		id             serial primary key not null,
+		rule_id        int not null default 0,
+		from_brand_id  varchar(200) not null,
+		from_model     varchar(200) not null,
+		from_serial    varchar(200) not null,
+		to_brand_id    varchar(200) not null,
+		to_model       varchar(200) not null,
+		to_serial      varchar(200) not null,
+		fingerprint    varchar(200) not null,
+		revision       int not null default 1,
+		created        timestamp default current_timestamp
+	)
+`
+
+const listRemodelHistorySQL = `
+	SELECT id, rule_id, from_brand_id, from_model, from_serial, to_brand_id, to_model, to_serial, fingerprint, revision, created
+	FROM remodelhistory
+	WHERE (from_brand_id=$1 AND from_model=$2) OR (to_brand_id=$1 AND to_model=$2)
+	ORDER BY id DESC LIMIT 10000`
+
+const createRemodelHistorySQL = `
+	INSERT INTO remodelhistory (rule_id, from_brand_id, from_model, from_serial, to_brand_id, to_model, to_serial, fingerprint, revision)
+	VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`
+
+// RemodelHistory records the remodel of a device. The rule ID is zero when the remodel was
+// allowed by a sub-store mapping
+type RemodelHistory struct {
+	ID          int       `json:"id"`
+	RuleID      int       `json:"rule-id"`
+	FromBrandID string    `json:"from-brand-id"`
+	FromModel   string    `json:"from-model"`
+	FromSerial  string    `json:"from-serial"`
+	ToBrandID   string    `json:"to-brand-id"`
+	ToModel     string    `json:"to-model"`
+	ToSerial    string    `json:"to-serial"`
+	Fingerprint string    `json:"fingerprint"`
+	Revision    int       `json:"revision"`
+	Created     time.Time `json:"created"`
+}
+
+// CreateRemodelHistoryTable creates the database table for the remodel history
+func (db *DB) CreateRemodelHistoryTable() error {
+	_, err := db.Exec(createRemodelHistoryTableSQL)
+	return err
+}
+
+// CreateRemodelHistory records the remodel of a device. The remodel history is kept in
+// the cloud, so it is not recorded in the factory
+func (db *DB) CreateRemodelHistory(history RemodelHistory) error {
+	if InFactory() {
+		return nil
+	}
+
+	if !validateStringsNotEmpty(history.FromBrandID, history.FromModel, history.FromSerial, history.ToBrandID, history.ToModel, history.ToSerial, history.Fingerprint) {
+		return errors.New("The original and new brand, model and serial number, and the device-key fingerprint must be supplied")
+	}
+
+	_, err := db.Exec(createRemodelHistorySQL, history.RuleID, history.FromBrandID, history.FromModel, history.FromSerial,
+		history.ToBrandID, history.ToModel, history.ToSerial, history.Fingerprint, history.Revision)
+	if err != nil {
+		log.Printf("Error recording the remodel history: %v\n", err)
+		return errors.New("Error recording the remodel history")
+	}
+	return nil
+}
+
+// ListRemodelHistory returns the remodels from, or to, a model
+func (db *DB) ListRemodelHistory(brandID, modelName string) ([]RemodelHistory, error) {
+	history := []RemodelHistory{}
+
+	rows, err := db.Query(listRemodelHistorySQL, brandID, modelName)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving the remodel history: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		h := RemodelHistory{}
+		err := rows.Scan(&h.ID, &h.RuleID, &h.FromBrandID, &h.FromModel, &h.FromSerial, &h.ToBrandID, &h.ToModel, &h.ToSerial, &h.Fingerprint, &h.Revision, &h.Created)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving the remodel history: %v", err)
+		}
+		history = append(history, h)
+	}
+
+	return history, rows.Err()
+}
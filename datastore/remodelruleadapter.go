@@ -0,0 +1,111 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+// ListAllowedRemodelRules returns the remodel rules from, or to, a model, if the user is
+// authorized to see the model
+func (db *DB) ListAllowedRemodelRules(modelID int, authorization User) ([]RemodelRule, error) {
+	model, err := db.GetAllowedModel(modelID, authorization)
+	if err != nil {
+		return nil, err
+	}
+
+	switch authorization.Role {
+	case Invalid: // Authentication disabled
+		fallthrough
+	case Superuser:
+		fallthrough
+	case Admin:
+		return db.ListRemodelRules(model.ID)
+	default:
+		return []RemodelRule{}, nil
+	}
+}
+
+// CreateAllowedRemodelRule creates a rule to remodel the devices of a model, if the user is
+// authorized to update both the original and the new model
+func (db *DB) CreateAllowedRemodelRule(modelID int, rule RemodelRule, authorization User) (RemodelRule, error) {
+	fromModel, err := db.getAllowedModelToEdit(modelID, authorization)
+	if err != nil {
+		return rule, err
+	}
+	toModel, err := db.getAllowedModelToEdit(rule.ToModelID, authorization)
+	if err != nil {
+		return rule, err
+	}
+
+	rule.FromModelID = fromModel.ID
+	rule.FromBrandID = fromModel.BrandID
+	rule.FromModelName = fromModel.Name
+	rule.ToBrandID = toModel.BrandID
+	rule.ToModelName = toModel.Name
+
+	switch authorization.Role {
+	case Invalid: // Authentication is disabled
+		fallthrough
+	case Superuser:
+		fallthrough
+	case Admin:
+		return db.createRemodelRule(rule)
+	default:
+		return rule, nil
+	}
+}
+
+// DeleteAllowedRemodelRule deletes a remodel rule from, or to, a model, if the user is
+// authorized to update the model
+func (db *DB) DeleteAllowedRemodelRule(modelID, ruleID int, authorization User) error {
+	model, err := db.getAllowedModelToEdit(modelID, authorization)
+	if err != nil {
+		return err
+	}
+
+	switch authorization.Role {
+	case Invalid: // Authentication is disabled
+		fallthrough
+	case Superuser:
+		fallthrough
+	case Admin:
+		return db.deleteRemodelRule(model.ID, ruleID)
+	default:
+		return nil
+	}
+}
+
+// ListAllowedRemodelHistory returns the remodels from, or to, a model, if the user is
+// authorized to see the model
+func (db *DB) ListAllowedRemodelHistory(modelID int, authorization User) ([]RemodelHistory, error) {
+	model, err := db.GetAllowedModel(modelID, authorization)
+	if err != nil {
+		return nil, err
+	}
+
+	switch authorization.Role {
+	case Invalid: // Authentication disabled
+		fallthrough
+	case Superuser:
+		fallthrough
+	case Admin:
+		return db.ListRemodelHistory(model.BrandID, model.Name)
+	default:
+		return []RemodelHistory{}, nil
+	}
+}
@@ -0,0 +1,215 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/service/log"
+)
+
+// Serial number mappings of a remodel rule
+const (
+	RemodelSerialKeep   = "keep"
+	RemodelSerialPrefix = "prefix"
+	RemodelSerialAny    = "any"
+)
+
+const createRemodelRuleTableSQL = `
+	CREATE TABLE IF NOT EXISTS remodelrule (
+		id              serial primary key not null,
+		from_model_id   int references model not null,
+		to_model_id     int references model not null,
+		serial_mapping  varchar(20) not null default 'keep',
+		serial_prefix   varchar(200) not null default '',
+		created         timestamp default current_timestamp,
+		unique (from_model_id, to_model_id)
+	)
+`
+
+const listRemodelRulesSQL = `
+	SELECT r.id, r.from_model_id, f.brand_id, f.name, r.to_model_id, t.brand_id, t.name, r.serial_mapping, r.serial_prefix, r.created
+	FROM remodelrule r
+	INNER JOIN model f ON f.id = r.from_model_id
+	INNER JOIN model t ON t.id = r.to_model_id
+	WHERE r.from_model_id=$1 OR r.to_model_id=$1
+	ORDER BY r.id`
+
+const getRemodelRuleSQL = `
+	SELECT r.id, r.from_model_id, f.brand_id, f.name, r.to_model_id, t.brand_id, t.name, r.serial_mapping, r.serial_prefix, r.created
+	FROM remodelrule r
+	INNER JOIN model f ON f.id = r.from_model_id
+	INNER JOIN model t ON t.id = r.to_model_id
+	WHERE f.brand_id=$1 AND f.name=$2 AND t.brand_id=$3 AND t.name=$4`
+
+const createRemodelRuleSQL = `
+	INSERT INTO remodelrule (from_model_id, to_model_id, serial_mapping, serial_prefix)
+	VALUES ($1,$2,$3,$4) RETURNING id, created`
+
+const checkRemodelRuleExistsSQL = "SELECT EXISTS(SELECT * FROM remodelrule WHERE from_model_id=$1 AND to_model_id=$2)"
+
+const deleteRemodelRuleSQL = "DELETE FROM remodelrule WHERE id=$1 AND (from_model_id=$2 OR to_model_id=$2)"
+
+// RemodelRule allows any device of a model to be remodeled to another model, which can be
+// of a different brand. The serial number mapping decides the serial number of the device
+// for the new model: the original serial number is kept, or it is remapped
+type RemodelRule struct {
+	ID            int       `json:"id"`
+	FromModelID   int       `json:"from-model-id"`
+	FromBrandID   string    `json:"from-brand-id"`
+	FromModelName string    `json:"from-model"`
+	ToModelID     int       `json:"to-model-id"`
+	ToBrandID     string    `json:"to-brand-id"`
+	ToModelName   string    `json:"to-model"`
+	SerialMapping string    `json:"serial-mapping"`
+	SerialPrefix  string    `json:"serial-prefix"`
+	Created       time.Time `json:"created"`
+	FromModel     Model     `json:"-"`
+}
+
+// CheckSerial checks that the serial number for the new model follows the serial number
+// mapping of the rule
+func (rule RemodelRule) CheckSerial(originalSerial, serialNumber string) error {
+	switch rule.SerialMapping {
+	case RemodelSerialPrefix:
+		if serialNumber != rule.SerialPrefix+originalSerial {
+			return fmt.Errorf("The serial number must be the original serial number with the prefix '%s'", rule.SerialPrefix)
+		}
+	case RemodelSerialAny:
+		if len(serialNumber) == 0 {
+			return errors.New("The serial number must be supplied")
+		}
+	default:
+		if serialNumber != originalSerial {
+			return errors.New("The serial number must be the original serial number")
+		}
+	}
+	return nil
+}
+
+// CreateRemodelRuleTable creates the database table for the remodel rules
+func (db *DB) CreateRemodelRuleTable() error {
+	_, err := db.Exec(createRemodelRuleTableSQL)
+	return err
+}
+
+// ListRemodelRules returns the remodel rules from, or to, a model
+func (db *DB) ListRemodelRules(modelID int) ([]RemodelRule, error) {
+	rules := []RemodelRule{}
+
+	rows, err := db.Query(listRemodelRulesSQL, modelID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving the remodel rules: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r := RemodelRule{}
+		err := rows.Scan(&r.ID, &r.FromModelID, &r.FromBrandID, &r.FromModelName, &r.ToModelID, &r.ToBrandID, &r.ToModelName, &r.SerialMapping, &r.SerialPrefix, &r.Created)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving the remodel rules: %v", err)
+		}
+		rules = append(rules, r)
+	}
+
+	return rules, rows.Err()
+}
+
+// GetRemodelRule fetches the rule that allows the devices of a model to be remodeled to the new
+// model, along with the original model. The remodel rules are managed in the cloud, so there
+// are no rules in the factory
+func (db *DB) GetRemodelRule(fromBrandID, fromModel, toBrandID, toModel string) (RemodelRule, error) {
+	r := RemodelRule{}
+	if InFactory() {
+		return r, errors.New("Cannot find a remodel rule for the models")
+	}
+
+	err := db.QueryRow(getRemodelRuleSQL, fromBrandID, fromModel, toBrandID, toModel).Scan(
+		&r.ID, &r.FromModelID, &r.FromBrandID, &r.FromModelName, &r.ToModelID, &r.ToBrandID, &r.ToModelName, &r.SerialMapping, &r.SerialPrefix, &r.Created)
+	if err != nil {
+		return r, fmt.Errorf("Cannot find a remodel rule for the models: %v", err)
+	}
+
+	r.FromModel, err = db.getModel(r.FromModelID)
+	if err != nil {
+		return r, fmt.Errorf("error retrieving database model %d: %v", r.FromModelID, err)
+	}
+	return r, nil
+}
+
+func (db *DB) createRemodelRule(rule RemodelRule) (RemodelRule, error) {
+	if err := validateRemodelRule(rule); err != nil {
+		return rule, err
+	}
+	if len(rule.SerialMapping) == 0 {
+		rule.SerialMapping = RemodelSerialKeep
+	}
+
+	if db.checkBoolQuery(db.QueryRow(checkRemodelRuleExistsSQL, rule.FromModelID, rule.ToModelID)) {
+		return rule, errors.New("A remodel rule already exists for these models")
+	}
+
+	err := db.QueryRow(createRemodelRuleSQL, rule.FromModelID, rule.ToModelID, rule.SerialMapping, rule.SerialPrefix).Scan(&rule.ID, &rule.Created)
+	if err != nil {
+		log.Printf("Error creating the remodel rule: %v\n", err)
+		return rule, fmt.Errorf("error creating the remodel rule: %v", err)
+	}
+	return rule, nil
+}
+
+func (db *DB) deleteRemodelRule(modelID, ruleID int) error {
+	result, err := db.Exec(deleteRemodelRuleSQL, ruleID, modelID)
+	if err != nil {
+		return fmt.Errorf("error deleting the remodel rule: %v", err)
+	}
+
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return errors.New("Cannot find the remodel rule")
+	}
+	return nil
+}
+
+func validateRemodelRule(rule RemodelRule) error {
+	if err := validateModelID("From Model", rule.FromModelID); err != nil {
+		return err
+	}
+	if err := validateModelID("To Model", rule.ToModelID); err != nil {
+		return err
+	}
+	if rule.FromModelID == rule.ToModelID {
+		return errors.New("A model cannot be remodeled to itself")
+	}
+
+	switch rule.SerialMapping {
+	case "", RemodelSerialKeep, RemodelSerialAny:
+		return nil
+	case RemodelSerialPrefix:
+		if len(strings.TrimSpace(rule.SerialPrefix)) == 0 {
+			return errors.New("The serial number prefix must be supplied")
+		}
+		return nil
+	default:
+		return fmt.Errorf("Invalid serial number mapping '%s'", rule.SerialMapping)
+	}
+}
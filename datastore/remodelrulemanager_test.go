@@ -0,0 +1,77 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package datastore
+
+import (
+	"testing"
+)
+
+func TestRemodelRuleCheckSerial(t *testing.T) {
+	tests := []struct {
+		mapping string
+		serial  string
+		valid   bool
+	}{
+		{"", "A123456L", true},
+		{"", "B123456L", false},
+		{RemodelSerialKeep, "A123456L", true},
+		{RemodelSerialKeep, "V-A123456L", false},
+		{RemodelSerialPrefix, "V-A123456L", true},
+		{RemodelSerialPrefix, "A123456L", false},
+		{RemodelSerialAny, "B123456L", true},
+		{RemodelSerialAny, "", false},
+	}
+
+	for _, tt := range tests {
+		rule := RemodelRule{SerialMapping: tt.mapping, SerialPrefix: "V-"}
+		err := rule.CheckSerial("A123456L", tt.serial)
+		if tt.valid && err != nil {
+			t.Errorf("Expected the serial '%s' to be valid for the '%s' mapping: %v", tt.serial, tt.mapping, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("Expected the serial '%s' to be invalid for the '%s' mapping", tt.serial, tt.mapping)
+		}
+	}
+}
+
+func TestValidateRemodelRule(t *testing.T) {
+	tests := []struct {
+		rule  RemodelRule
+		valid bool
+	}{
+		{RemodelRule{FromModelID: 1, ToModelID: 2}, true},
+		{RemodelRule{FromModelID: 1, ToModelID: 2, SerialMapping: RemodelSerialAny}, true},
+		{RemodelRule{FromModelID: 1, ToModelID: 2, SerialMapping: RemodelSerialPrefix, SerialPrefix: "V-"}, true},
+		{RemodelRule{FromModelID: 1, ToModelID: 2, SerialMapping: RemodelSerialPrefix}, false},
+		{RemodelRule{FromModelID: 1, ToModelID: 2, SerialMapping: "invalid"}, false},
+		{RemodelRule{FromModelID: 1, ToModelID: 1}, false},
+		{RemodelRule{FromModelID: 1}, false},
+	}
+
+	for _, tt := range tests {
+		err := validateRemodelRule(tt.rule)
+		if tt.valid && err != nil {
+			t.Errorf("Expected the remodel rule to be valid: %v", err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("Expected the remodel rule to be invalid: %v", tt.rule)
+		}
+	}
+}
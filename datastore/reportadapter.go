@@ -0,0 +1,56 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+// AllowedSigningReport returns the signing statistics of the accounts on which the user can read
+// the signing logs
+func (db *DB) AllowedSigningReport(authorization User, params SigningReportParams) ([]SigningReport, error) {
+	switch authorization.Role {
+	case Invalid: // Authentication disabled
+		fallthrough
+	case Superuser:
+		return db.SigningReport(params)
+	case Admin:
+		if len(params.AuthorityID) > 0 && !db.AllowedPermission(authorization, params.AuthorityID, PermissionSigningLogRead) {
+			return nil, errorPermission(params.AuthorityID, PermissionSigningLogRead)
+		}
+		reports, err := db.signingReportFilteredByUser(authorization.Username, params)
+		if err != nil {
+			return nil, err
+		}
+
+		allowed := map[string]bool{}
+		filtered := []SigningReport{}
+		for _, r := range reports {
+			ok, checked := allowed[r.AuthorityID]
+			if !checked {
+				ok = db.AllowedPermission(authorization, r.AuthorityID, PermissionSigningLogRead)
+				allowed[r.AuthorityID] = ok
+			}
+			if ok {
+				filtered = append(filtered, r)
+			}
+		}
+		return filtered, nil
+	default:
+		return []SigningReport{}, nil
+	}
+}
@@ -0,0 +1,230 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/service/log"
+	sq "github.com/Masterminds/squirrel"
+)
+
+// Periods of the signing report
+const (
+	ReportDay   = "day"
+	ReportWeek  = "week"
+	ReportMonth = "month"
+)
+
+// The start of the period of a timestamp as text (YYYY-MM-DD), for PostgreSQL and SQLite. A
+// week starts on Monday
+var reportPeriodSQL = map[string]string{
+	ReportDay:   "to_char(date_trunc('day', %s), 'YYYY-MM-DD')",
+	ReportWeek:  "to_char(date_trunc('week', %s), 'YYYY-MM-DD')",
+	ReportMonth: "to_char(date_trunc('month', %s), 'YYYY-MM-DD')",
+}
+var reportPeriodSQLite = map[string]string{
+	ReportDay:   "date(%s)",
+	ReportWeek:  "date(%s, 'weekday 0', '-6 days')",
+	ReportMonth: "strftime('%%Y-%%m-01', %s)",
+}
+
+// SigningReportParams holds the filters of the signing report. The 'from' time is inclusive and
+// the 'to' time is exclusive
+type SigningReportParams struct {
+	Period      string
+	From        *time.Time
+	To          *time.Time
+	AuthorityID string // all accounts when empty
+	Model       string // all models when empty
+}
+
+// SigningReport holds the signing statistics of a model for a period (day, week or month). The
+// signing logs that are synced are those received from a factory, the others were signed in the
+// cloud. The remodels are the devices remodeled to the model
+type SigningReport struct {
+	Period      string  `json:"period"`
+	AuthorityID string  `json:"authority-id"`
+	Model       string  `json:"model"`
+	Signed      int     `json:"signed"`
+	Resigned    int     `json:"resigned"`
+	ResignRate  float64 `json:"resign-rate"`
+	Factory     int     `json:"factory"`
+	Cloud       int     `json:"cloud"`
+	Remodels    int     `json:"remodels"`
+}
+
+// SigningReport returns the signing statistics of each model for each period, including the
+// archived logs of the archive table. When the logs are archived to files, the range must start
+// after the retention cutoff
+func (db *DB) SigningReport(params SigningReportParams) ([]SigningReport, error) {
+	return db.signingReportFilteredByUser(anyUserFilter, params)
+}
+
+func (db *DB) signingReportFilteredByUser(username string, params SigningReportParams) ([]SigningReport, error) {
+	if _, ok := reportPeriodSQL[params.Period]; !ok {
+		return nil, fmt.Errorf("the report period must be '%s', '%s' or '%s'", ReportDay, ReportWeek, ReportMonth)
+	}
+	if err := checkSigningLogRetention(params.From); err != nil {
+		return nil, err
+	}
+
+	reports := []SigningReport{}
+	index := map[string]int{}
+	report := func(period, authorityID, model string) *SigningReport {
+		key := period + "/" + authorityID + "/" + model
+		i, ok := index[key]
+		if !ok {
+			i = len(reports)
+			index[key] = i
+			reports = append(reports, SigningReport{Period: period, AuthorityID: authorityID, Model: model})
+		}
+		return &reports[i]
+	}
+
+	rows, err := signingReportSQLBuilder(username, params).RunWith(db).Query()
+	if err != nil {
+		log.Printf("Error retrieving the signing report: %v\n", err)
+		return nil, errors.New("Error retrieving the signing report")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var period, authorityID, model string
+		var signed, resigned, synced int
+		if err := rows.Scan(&period, &authorityID, &model, &signed, &resigned, &synced); err != nil {
+			log.Printf("Error retrieving the signing report: %v\n", err)
+			return nil, errors.New("Error retrieving the signing report")
+		}
+		r := report(period, authorityID, model)
+		r.Signed = signed
+		r.Resigned = resigned
+		r.Factory = synced
+		r.Cloud = signed - synced
+		if signed > 0 {
+			r.ResignRate = float64(resigned) / float64(signed)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	remodelRows, err := remodelReportSQLBuilder(username, params).RunWith(db).Query()
+	if err != nil {
+		log.Printf("Error retrieving the remodel report: %v\n", err)
+		return nil, errors.New("Error retrieving the signing report")
+	}
+	defer remodelRows.Close()
+	for remodelRows.Next() {
+		var period, authorityID, model string
+		var remodels int
+		if err := remodelRows.Scan(&period, &authorityID, &model, &remodels); err != nil {
+			log.Printf("Error retrieving the remodel report: %v\n", err)
+			return nil, errors.New("Error retrieving the signing report")
+		}
+		report(period, authorityID, model).Remodels = remodels
+	}
+	if err := remodelRows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		a, b := reports[i], reports[j]
+		if a.Period != b.Period {
+			return a.Period < b.Period
+		}
+		if a.AuthorityID != b.AuthorityID {
+			return a.AuthorityID < b.AuthorityID
+		}
+		return a.Model < b.Model
+	})
+	return reports, nil
+}
+
+func reportPeriod(period, column string) string {
+	if InFactory() {
+		return fmt.Sprintf(reportPeriodSQLite[period], column)
+	}
+	return fmt.Sprintf(reportPeriodSQL[period], column)
+}
+
+func signingReportSQLBuilder(username string, params SigningReportParams) sq.SelectBuilder {
+	period := reportPeriod(params.Period, "created")
+	sql := sq.
+		Select(period+" AS period", "make", "model", "count(*)",
+			"sum(CASE WHEN revision > 1 THEN 1 ELSE 0 END)",
+			"sum(CASE WHEN synced = 1 THEN 1 ELSE 0 END)").
+		From(signingLogSource()).
+		GroupBy(period, "make", "model").
+		PlaceholderFormat(sq.Dollar)
+
+	if username != "" {
+		sql = sql.Where(signingLogUserFilter(username))
+	}
+	if params.AuthorityID != "" {
+		sql = sql.Where(sq.Eq{"make": params.AuthorityID})
+	}
+	if params.Model != "" {
+		sql = sql.Where(sq.Eq{"model": params.Model})
+	}
+	if params.From != nil {
+		sql = sql.Where(sq.GtOrEq{"created": sqlTime(*params.From)})
+	}
+	if params.To != nil {
+		sql = sql.Where(sq.Lt{"created": sqlTime(*params.To)})
+	}
+
+	return sql
+}
+
+func remodelReportSQLBuilder(username string, params SigningReportParams) sq.SelectBuilder {
+	period := reportPeriod(params.Period, "created")
+	sql := sq.
+		Select(period+" AS period", "to_brand_id", "to_model", "count(*)").
+		From("remodelhistory r").
+		GroupBy(period, "to_brand_id", "to_model").
+		PlaceholderFormat(sq.Dollar)
+
+	if username != "" {
+		sql = sql.Where(sq.Select("*").Prefix("EXISTS (").
+			From("account acc").
+			JoinClause("INNER JOIN useraccountlink ua on ua.account_id=acc.id").
+			JoinClause("INNER JOIN userinfo u on ua.user_id=u.id").
+			Where("acc.authority_id=r.to_brand_id AND u.username=?", username).
+			Suffix(")").PlaceholderFormat(sq.Dollar))
+	}
+	if params.AuthorityID != "" {
+		sql = sql.Where(sq.Eq{"to_brand_id": params.AuthorityID})
+	}
+	if params.Model != "" {
+		sql = sql.Where(sq.Eq{"to_model": params.Model})
+	}
+	if params.From != nil {
+		sql = sql.Where(sq.GtOrEq{"created": sqlTime(*params.From)})
+	}
+	if params.To != nil {
+		sql = sql.Where(sq.Lt{"created": sqlTime(*params.To)})
+	}
+
+	return sql
+}
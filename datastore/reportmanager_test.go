@@ -0,0 +1,92 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+import (
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/config"
+	check "gopkg.in/check.v1"
+)
+
+type reportSuite struct{}
+
+var _ = check.Suite(&reportSuite{})
+
+func (s *reportSuite) SetUpTest(c *check.C) {
+	Environ = &Env{}
+}
+
+func (s *reportSuite) TestSigningReportSQLBuilder(c *check.C) {
+	from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		username   string
+		params     SigningReportParams
+		factory    bool
+		wantSQL    string
+		wantParams []interface{}
+	}{
+		{
+			params:     SigningReportParams{Period: ReportDay},
+			wantSQL:    "SELECT to_char(date_trunc('day', created), 'YYYY-MM-DD') AS period, make, model, count(*), sum(CASE WHEN revision > 1 THEN 1 ELSE 0 END), sum(CASE WHEN synced = 1 THEN 1 ELSE 0 END) FROM (SELECT id, make, model, serial_number, fingerprint, created, revision, synced FROM signinglog UNION ALL SELECT id, make, model, serial_number, fingerprint, created, revision, synced FROM signinglogarchive) s GROUP BY to_char(date_trunc('day', created), 'YYYY-MM-DD'), make, model",
+			wantParams: nil,
+		},
+		{
+			params:     SigningReportParams{Period: ReportMonth, AuthorityID: "system", Model: "alder", From: &from, To: &to},
+			wantSQL:    "SELECT to_char(date_trunc('month', created), 'YYYY-MM-DD') AS period, make, model, count(*), sum(CASE WHEN revision > 1 THEN 1 ELSE 0 END), sum(CASE WHEN synced = 1 THEN 1 ELSE 0 END) FROM (SELECT id, make, model, serial_number, fingerprint, created, revision, synced FROM signinglog UNION ALL SELECT id, make, model, serial_number, fingerprint, created, revision, synced FROM signinglogarchive) s WHERE make = $1 AND model = $2 AND created >= $3 AND created < $4 GROUP BY to_char(date_trunc('month', created), 'YYYY-MM-DD'), make, model",
+			wantParams: []interface{}{"system", "alder", from, to},
+		},
+		{
+			username:   "bob",
+			params:     SigningReportParams{Period: ReportWeek},
+			factory:    true,
+			wantSQL:    "SELECT date(created, 'weekday 0', '-6 days') AS period, make, model, count(*), sum(CASE WHEN revision > 1 THEN 1 ELSE 0 END), sum(CASE WHEN synced = 1 THEN 1 ELSE 0 END) FROM (SELECT id, make, model, serial_number, fingerprint, created, revision, synced FROM signinglog UNION ALL SELECT id, make, model, serial_number, fingerprint, created, revision, synced FROM signinglogarchive) s WHERE EXISTS ( SELECT * FROM account acc INNER JOIN useraccountlink ua on ua.account_id=acc.id INNER JOIN userinfo u on ua.user_id=u.id WHERE acc.authority_id=s.make AND u.username=$1 ) GROUP BY date(created, 'weekday 0', '-6 days'), make, model",
+			wantParams: []interface{}{"bob"},
+		},
+	}
+
+	for _, tt := range tests {
+		if tt.factory {
+			Environ.Config = config.Settings{Driver: "sqlite3"}
+		}
+		sql, args, err := signingReportSQLBuilder(tt.username, tt.params).ToSql()
+		Environ.Config = config.Settings{}
+
+		c.Assert(err, check.IsNil)
+		c.Assert(sql, check.Equals, tt.wantSQL)
+		c.Assert(args, check.DeepEquals, tt.wantParams)
+	}
+}
+
+func (s *reportSuite) TestRemodelReportSQLBuilder(c *check.C) {
+	sql, args, err := remodelReportSQLBuilder("bob", SigningReportParams{Period: ReportMonth, AuthorityID: "system"}).ToSql()
+	c.Assert(err, check.IsNil)
+	c.Assert(sql, check.Equals, "SELECT to_char(date_trunc('month', created), 'YYYY-MM-DD') AS period, to_brand_id, to_model, count(*) FROM remodelhistory r WHERE EXISTS ( SELECT * FROM account acc INNER JOIN useraccountlink ua on ua.account_id=acc.id INNER JOIN userinfo u on ua.user_id=u.id WHERE acc.authority_id=r.to_brand_id AND u.username=$1 ) AND to_brand_id = $2 GROUP BY to_char(date_trunc('month', created), 'YYYY-MM-DD'), to_brand_id, to_model")
+	c.Assert(args, check.DeepEquals, []interface{}{"bob", "system"})
+}
+
+func (s *reportSuite) TestSigningReportInvalidPeriod(c *check.C) {
+	db := &DB{}
+	_, err := db.SigningReport(SigningReportParams{Period: "year"})
+	c.Assert(err, check.ErrorMatches, "the report period must be 'day', 'week' or 'month'")
+}
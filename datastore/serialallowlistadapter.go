@@ -0,0 +1,170 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package datastore
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// MaxSerialRange is the maximum number of serial numbers in an imported range
+const MaxSerialRange = 100000
+
+// MaxSerialImport is the maximum number of serial numbers in an import
+const MaxSerialImport = 100000
+
+// A serial number range is defined by serial numbers that have the same prefix and
+// numeric suffixes of the same length e.g. A0001 to A0999
+var serialRangeRegexp = regexp.MustCompile(`^(.*?)([0-9]+)$`)
+
+// ListAllowedSerialAllowlist returns a page of the serial number allowlist of a model, after a
+// serial number, if the user is authorized to see the model. The list can be filtered by status
+func (db *DB) ListAllowedSerialAllowlist(modelID int, status, after string, authorization User) ([]SerialAllowlist, error) {
+	switch authorization.Role {
+	case Invalid: // Authentication disabled
+		fallthrough
+	case Superuser:
+		fallthrough
+	case Admin:
+		model, err := db.GetAllowedModel(modelID, authorization)
+		if err != nil {
+			return nil, err
+		}
+		return db.listSerialAllowlist(model.ID, status, after)
+	case SyncUser:
+		// The factory syncs the allowlists of the models in the sync user's accounts
+		model, err := db.getModelFilteredByUser(modelID, authorization.Username)
+		if err != nil {
+			return nil, err
+		}
+		return db.listSerialAllowlist(model.ID, status, after)
+	default:
+		return []SerialAllowlist{}, nil
+	}
+}
+
+// ImportAllowedSerialAllowlist adds serial numbers and ranges to a model's allowlist, if the
+// user is authorized to update the model. Returns the number of serial numbers that were added
+func (db *DB) ImportAllowedSerialAllowlist(modelID int, serials []SerialAllowlistImport, authorization User) (int, error) {
+	model, err := db.getAllowedModelToEdit(modelID, authorization)
+	if err != nil {
+		return 0, err
+	}
+
+	serialNumbers, err := expandSerialAllowlistImport(serials)
+	if err != nil {
+		return 0, err
+	}
+
+	switch authorization.Role {
+	case Invalid: // Authentication is disabled
+		fallthrough
+	case Superuser:
+		fallthrough
+	case Admin:
+		return db.importSerialAllowlist(model.ID, serialNumbers)
+	default:
+		return 0, nil
+	}
+}
+
+// DeleteAllowedSerialAllowlist removes a serial number from a model's allowlist, if the user is
+// authorized to update the model
+func (db *DB) DeleteAllowedSerialAllowlist(modelID, serialID int, authorization User) error {
+	model, err := db.getAllowedModelToEdit(modelID, authorization)
+	if err != nil {
+		return err
+	}
+
+	switch authorization.Role {
+	case Invalid: // Authentication is disabled
+		fallthrough
+	case Superuser:
+		fallthrough
+	case Admin:
+		return db.deleteSerialAllowlist(model.ID, serialID)
+	default:
+		return nil
+	}
+}
+
+// expandSerialAllowlistImport converts the imported serial numbers and ranges to a list of serial numbers
+func expandSerialAllowlistImport(serials []SerialAllowlistImport) ([]string, error) {
+	serialNumbers := []string{}
+
+	for _, s := range serials {
+		if err := validateNotEmpty("Serial-number", s.SerialNumber); err != nil {
+			return nil, err
+		}
+
+		if len(s.SerialNumberEnd) == 0 {
+			serialNumbers = append(serialNumbers, s.SerialNumber)
+		} else {
+			r, err := expandSerialRange(s.SerialNumber, s.SerialNumberEnd)
+			if err != nil {
+				return nil, err
+			}
+			serialNumbers = append(serialNumbers, r...)
+		}
+
+		if len(serialNumbers) > MaxSerialImport {
+			return nil, fmt.Errorf("cannot import more than %d serial numbers at a time", MaxSerialImport)
+		}
+	}
+
+	return serialNumbers, nil
+}
+
+// expandSerialRange converts a range of serial numbers to a list of the serial numbers in the range
+func expandSerialRange(start, end string) ([]string, error) {
+	startParts := serialRangeRegexp.FindStringSubmatch(start)
+	endParts := serialRangeRegexp.FindStringSubmatch(end)
+	if startParts == nil || endParts == nil {
+		return nil, fmt.Errorf("the serial number range %s to %s must end with a number", start, end)
+	}
+
+	prefix, width := startParts[1], len(startParts[2])
+	if endParts[1] != prefix || len(endParts[2]) != width {
+		return nil, fmt.Errorf("the serial number range %s to %s must have the same prefix and length", start, end)
+	}
+
+	first, err := strconv.ParseUint(startParts[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid serial number range %s to %s: %v", start, end, err)
+	}
+	last, err := strconv.ParseUint(endParts[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid serial number range %s to %s: %v", start, end, err)
+	}
+
+	if last < first {
+		return nil, fmt.Errorf("the serial number range %s to %s must be in ascending order", start, end)
+	}
+	if last-first >= MaxSerialRange {
+		return nil, fmt.Errorf("the serial number range %s to %s cannot have more than %d serial numbers", start, end, MaxSerialRange)
+	}
+
+	serialNumbers := make([]string, 0, last-first+1)
+	for i := first; i <= last; i++ {
+		serialNumbers = append(serialNumbers, fmt.Sprintf("%s%0*d", prefix, width, i))
+	}
+	return serialNumbers, nil
+}
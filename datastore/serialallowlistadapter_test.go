@@ -0,0 +1,96 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package datastore
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestExpandSerialRange(t *testing.T) {
+	serials, err := expandSerialRange("A0998", "A1002")
+	if err != nil {
+		t.Fatalf("Error expanding the serial number range: %v", err)
+	}
+
+	expected := []string{"A0998", "A0999", "A1000", "A1001", "A1002"}
+	if len(serials) != len(expected) {
+		t.Fatalf("Expected %d serial numbers, got: %d", len(expected), len(serials))
+	}
+	for i := range expected {
+		if serials[i] != expected[i] {
+			t.Errorf("Expected serial number '%s', got: %s", expected[i], serials[i])
+		}
+	}
+}
+
+func TestExpandSerialRangeInvalid(t *testing.T) {
+	tests := []struct {
+		start string
+		end   string
+	}{
+		{"A0001", "B0010"},
+		{"A0001", "A10"},
+		{"A0010", "A0001"},
+		{"ABC", "ABD"},
+		{"A000000", "A999999"},
+	}
+
+	for _, tt := range tests {
+		if _, err := expandSerialRange(tt.start, tt.end); err == nil {
+			t.Errorf("Expected an error for the range %s to %s", tt.start, tt.end)
+		}
+	}
+}
+
+func TestExpandSerialAllowlistImport(t *testing.T) {
+	serials, err := expandSerialAllowlistImport([]SerialAllowlistImport{
+		{SerialNumber: "R5001"},
+		{SerialNumber: "A01", SerialNumberEnd: "A03"},
+	})
+	if err != nil {
+		t.Fatalf("Error expanding the serial numbers: %v", err)
+	}
+	if len(serials) != 4 {
+		t.Errorf("Expected 4 serial numbers, got: %d", len(serials))
+	}
+
+	if _, err = expandSerialAllowlistImport([]SerialAllowlistImport{{SerialNumber: ""}}); err == nil {
+		t.Error("Expected an error for an empty serial number")
+	}
+}
+
+func TestExpandSerialAllowlistImportTooMany(t *testing.T) {
+	serials := []SerialAllowlistImport{
+		{SerialNumber: "A00000", SerialNumberEnd: "A99998"},
+		{SerialNumber: "B00000", SerialNumberEnd: "B00001"},
+	}
+	if _, err := expandSerialAllowlistImport(serials); err == nil {
+		t.Error("Expected an error for too many serial numbers in the ranges")
+	}
+
+	serials = []SerialAllowlistImport{}
+	for i := 0; i <= MaxSerialImport; i++ {
+		serials = append(serials, SerialAllowlistImport{SerialNumber: fmt.Sprintf("S%d", i)})
+	}
+	if _, err := expandSerialAllowlistImport(serials); err == nil {
+		t.Error("Expected an error for too many serial numbers")
+	}
+}
@@ -0,0 +1,230 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package datastore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/service/log"
+)
+
+// Statuses of the serial numbers in a model's allowlist
+const (
+	SerialStatusPending = "pending"
+	SerialStatusSigned  = "signed"
+	SerialStatusRevoked = "revoked"
+)
+
+// Errors from checking a serial number against the model's allowlist
+var (
+	ErrorSerialNotAllowed = errors.New("The serial number is not registered for the model")
+	ErrorSerialRevoked    = errors.New("The serial number has been revoked")
+)
+
+const createSerialAllowlistTableSQL = `
+	CREATE TABLE IF NOT EXISTS serialallowlist (
+		id             serial primary key not null,
+		model_id       int references model not null,
+		serial_number  varchar(200) not null,
+		status         varchar(20) not null default 'pending',
+		created        timestamp default current_timestamp,
+		modified       timestamp default current_timestamp,
+		unique (model_id, serial_number)
+	)
+`
+
+// SerialAllowlistPageSize is the maximum number of serial numbers in a page of a model's allowlist
+const SerialAllowlistPageSize = 10000
+
+// The page of the allowlist that follows a serial number
+const listSerialAllowlistSQL = `
+	SELECT id, model_id, serial_number, status, created, modified
+	FROM serialallowlist
+	WHERE model_id=$1 AND ($2='' OR status=$2) AND serial_number>$3
+	ORDER BY serial_number LIMIT 10000`
+
+const createSerialAllowlistSQL = `
+	INSERT INTO serialallowlist (model_id, serial_number)
+	SELECT $1, $2
+	WHERE NOT EXISTS (SELECT * FROM serialallowlist WHERE model_id=$1 AND serial_number=$2)`
+
+const deleteSerialAllowlistSQL = "DELETE FROM serialallowlist WHERE id=$1 AND model_id=$2"
+
+const deleteModelSerialAllowlistSQL = "DELETE FROM serialallowlist WHERE model_id=$1"
+
+const syncSerialAllowlistSQL = `
+	INSERT INTO serialallowlist (id, model_id, serial_number, status, created, modified)
+	VALUES ($1,$2,$3,$4,$5,$6)`
+
+const checkSerialAllowlistExistsSQL = "SELECT EXISTS(SELECT * FROM serialallowlist WHERE model_id=$1)"
+
+const getSerialAllowlistStatusSQL = "SELECT status FROM serialallowlist WHERE model_id=$1 AND serial_number=$2"
+
+const updateSerialAllowlistSignedSQL = `
+	UPDATE serialallowlist SET status='signed', modified=$3
+	WHERE model_id=$1 AND serial_number=$2 AND status='pending'`
+
+// SerialAllowlist holds a serial number that is registered for a model. When a model has
+// registered serial numbers, only those serial numbers will be signed
+type SerialAllowlist struct {
+	ID           int       `json:"id"`
+	ModelID      int       `json:"model-id"`
+	SerialNumber string    `json:"serial-number"`
+	Status       string    `json:"status"`
+	Created      time.Time `json:"created"`
+	Modified     time.Time `json:"modified"`
+}
+
+// SerialAllowlistImport holds a serial number, or a range of serial numbers, to add to a model's allowlist
+type SerialAllowlistImport struct {
+	SerialNumber    string `json:"serial-number"`
+	SerialNumberEnd string `json:"serial-number-end"`
+}
+
+// CreateSerialAllowlistTable creates the database table for the serial number allowlist
+func (db *DB) CreateSerialAllowlistTable() error {
+	_, err := db.Exec(createSerialAllowlistTableSQL)
+	return err
+}
+
+func (db *DB) listSerialAllowlist(modelID int, status, after string) ([]SerialAllowlist, error) {
+	serials := []SerialAllowlist{}
+
+	rows, err := db.Query(listSerialAllowlistSQL, modelID, status, after)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving the serial number allowlist: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		s := SerialAllowlist{}
+		err := rows.Scan(&s.ID, &s.ModelID, &s.SerialNumber, &s.Status, &s.Created, &s.Modified)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving the serial number allowlist: %v", err)
+		}
+		serials = append(serials, s)
+	}
+
+	return serials, rows.Err()
+}
+
+// importSerialAllowlist adds the serial numbers to the model's allowlist in a single transaction.
+// Serial numbers that are already registered keep their status. Returns the number of serial
+// numbers that were added
+func (db *DB) importSerialAllowlist(modelID int, serialNumbers []string) (int, error) {
+	count := 0
+	err := db.transaction(func(tx *sql.Tx) error {
+		stmt, err := tx.Prepare(createSerialAllowlistSQL)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, s := range serialNumbers {
+			result, err := stmt.Exec(modelID, s)
+			if err != nil {
+				log.Printf("Error adding serial number %s to the allowlist: %v\n", s, err)
+				return err
+			}
+			if rows, err := result.RowsAffected(); err == nil {
+				count += int(rows)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error importing the serial number allowlist: %v", err)
+	}
+
+	return count, nil
+}
+
+func (db *DB) deleteSerialAllowlist(modelID, serialID int) error {
+	_, err := db.Exec(deleteSerialAllowlistSQL, serialID, modelID)
+	if err != nil {
+		return fmt.Errorf("error deleting the serial number from the allowlist: %v", err)
+	}
+	return nil
+}
+
+// SyncSerialAllowlist replaces the allowlist of a model in the factory with the allowlist
+// that is managed in the cloud
+func (db *DB) SyncSerialAllowlist(modelID int, serials []SerialAllowlist) error {
+	err := db.transaction(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(deleteModelSerialAllowlistSQL, modelID); err != nil {
+			return err
+		}
+
+		stmt, err := tx.Prepare(syncSerialAllowlistSQL)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, s := range serials {
+			if _, err := stmt.Exec(s.ID, modelID, s.SerialNumber, s.Status, s.Created, s.Modified); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error syncing the serial number allowlist: %v\n", err)
+		return fmt.Errorf("error syncing the serial number allowlist: %v", err)
+	}
+	return nil
+}
+
+// CheckSerialAllowlist checks that the serial number may be signed for the model. Models
+// without an allowlist accept any serial number. The factory checks the allowlist that it
+// synced from the cloud
+func (db *DB) CheckSerialAllowlist(modelID int, serialNumber string) error {
+	var status string
+	err := db.QueryRow(getSerialAllowlistStatusSQL, modelID, serialNumber).Scan(&status)
+	switch {
+	case err == sql.ErrNoRows:
+		// Only registered serial numbers are accepted when the model has an allowlist
+		if db.checkBoolQuery(db.QueryRow(checkSerialAllowlistExistsSQL, modelID)) {
+			return ErrorSerialNotAllowed
+		}
+		return nil
+	case err != nil:
+		log.Printf("Error checking the serial number allowlist: %v\n", err)
+		return errors.New("Error communicating with the database")
+	}
+
+	if status == SerialStatusRevoked {
+		return ErrorSerialRevoked
+	}
+	return nil
+}
+
+// UpdateSerialAllowlistSigned marks a registered serial number as signed. Nothing is
+// updated if the serial number is not in the model's allowlist
+func (db *DB) UpdateSerialAllowlistSigned(modelID int, serialNumber string) error {
+	_, err := db.Exec(updateSerialAllowlistSignedSQL, modelID, serialNumber, time.Now().UTC())
+	if err != nil {
+		log.Printf("Error updating the serial number allowlist: %v\n", err)
+	}
+	return err
+}
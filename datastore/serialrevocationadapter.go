@@ -0,0 +1,91 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+// ListAllowedSerialRevocations returns the revoked serial assertions of a model, if the user
+// is authorized to see the model
+func (db *DB) ListAllowedSerialRevocations(modelID int, authorization User) ([]SerialRevocation, error) {
+	switch authorization.Role {
+	case Invalid: // Authentication disabled
+		fallthrough
+	case Superuser:
+		fallthrough
+	case Admin:
+		model, err := db.GetAllowedModel(modelID, authorization)
+		if err != nil {
+			return nil, err
+		}
+		return db.ListSerialRevocations(model.BrandID, model.Name)
+	case SyncUser:
+		// The factory syncs the revocations of the models in the sync user's accounts
+		model, err := db.getModelFilteredByUser(modelID, authorization.Username)
+		if err != nil {
+			return nil, err
+		}
+		return db.ListSerialRevocations(model.BrandID, model.Name)
+	default:
+		return []SerialRevocation{}, nil
+	}
+}
+
+// CreateAllowedSerialRevocation revokes a serial assertion of a model, if the user is authorized
+// to update the model
+func (db *DB) CreateAllowedSerialRevocation(modelID int, revocation SerialRevocation, authorization User) (SerialRevocation, error) {
+	model, err := db.getAllowedModelToEdit(modelID, authorization)
+	if err != nil {
+		return revocation, err
+	}
+
+	// The revocation is always for the brand and name of the model
+	revocation.BrandID = model.BrandID
+	revocation.Model = model.Name
+
+	switch authorization.Role {
+	case Invalid: // Authentication is disabled
+		fallthrough
+	case Superuser:
+		fallthrough
+	case Admin:
+		return db.CreateSerialRevocation(revocation)
+	default:
+		return revocation, nil
+	}
+}
+
+// DeleteAllowedSerialRevocation removes the revocation of a serial assertion of a model, if the
+// user is authorized to update the model
+func (db *DB) DeleteAllowedSerialRevocation(modelID, revocationID int, authorization User) error {
+	model, err := db.getAllowedModelToEdit(modelID, authorization)
+	if err != nil {
+		return err
+	}
+
+	switch authorization.Role {
+	case Invalid: // Authentication is disabled
+		fallthrough
+	case Superuser:
+		fallthrough
+	case Admin:
+		return db.deleteSerialRevocation(model.BrandID, model.Name, revocationID)
+	default:
+		return nil
+	}
+}
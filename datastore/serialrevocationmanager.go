@@ -0,0 +1,218 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/service/log"
+)
+
+const createSerialRevocationTableSQL = `
+	CREATE TABLE IF NOT EXISTS serialrevocation (
+		id             serial primary key not null,
+		brand_id       varchar(200) not null,
+		model          varchar(200) not null,
+		serial_number  varchar(200) not null,
+		revision       int not null default 0,
+		reason         text not null,
+		created        timestamp default current_timestamp,
+		unique (brand_id, model, serial_number, revision)
+	)
+`
+
+const listSerialRevocationsSQL = `
+	SELECT id, brand_id, model, serial_number, revision, reason, created
+	FROM serialrevocation
+	WHERE brand_id=$1 AND model=$2
+	ORDER BY serial_number, revision`
+
+const checkSerialRevocationExistsSQL = `
+	SELECT EXISTS(
+		SELECT * FROM serialrevocation WHERE brand_id=$1 AND model=$2 AND serial_number=$3 AND revision=$4
+	)`
+
+const createSerialRevocationSQL = `
+	INSERT INTO serialrevocation (brand_id, model, serial_number, revision, reason)
+	VALUES ($1,$2,$3,$4,$5) RETURNING id, created`
+
+// Keep the status of the serial number in the allowlists of the model in step with the revocation
+const revokeSerialAllowlistSQL = `
+	UPDATE serialallowlist SET status='revoked', modified=current_timestamp
+	WHERE serial_number=$3 AND model_id IN (SELECT id FROM model WHERE brand_id=$1 AND name=$2)`
+
+const deleteModelSerialRevocationsSQL = "DELETE FROM serialrevocation WHERE brand_id=$1 AND model=$2"
+
+const syncSerialRevocationSQL = `
+	INSERT INTO serialrevocation (id, brand_id, model, serial_number, revision, reason, created)
+	VALUES ($1,$2,$3,$4,$5,$6,$7)`
+
+const deleteSerialRevocationSQL = "DELETE FROM serialrevocation WHERE id=$1 AND brand_id=$2 AND model=$3"
+
+// A revision of zero revokes every revision of the serial assertion
+const checkSerialRevokedSQL = `
+	SELECT EXISTS(
+		SELECT * FROM serialrevocation
+		WHERE brand_id=$1 AND model=$2 AND serial_number=$3 AND ($4=0 OR revision=0 OR revision=$4)
+	)`
+
+// SerialRevocation holds the revocation of a signed serial assertion. A revision of zero
+// revokes all the revisions of the serial assertion for the serial number
+type SerialRevocation struct {
+	ID           int       `json:"id"`
+	BrandID      string    `json:"brand-id"`
+	Model        string    `json:"model"`
+	SerialNumber string    `json:"serial-number"`
+	Revision     int       `json:"revision"`
+	Reason       string    `json:"reason"`
+	Created      time.Time `json:"created"`
+}
+
+// CreateSerialRevocationTable creates the database table for the revoked serial assertions
+func (db *DB) CreateSerialRevocationTable() error {
+	_, err := db.Exec(createSerialRevocationTableSQL)
+	return err
+}
+
+// ListSerialRevocations returns the revoked serial assertions of a model
+func (db *DB) ListSerialRevocations(brandID, modelName string) ([]SerialRevocation, error) {
+	revocations := []SerialRevocation{}
+
+	rows, err := db.Query(listSerialRevocationsSQL, brandID, modelName)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving the serial revocations: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r := SerialRevocation{}
+		err := rows.Scan(&r.ID, &r.BrandID, &r.Model, &r.SerialNumber, &r.Revision, &r.Reason, &r.Created)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving the serial revocations: %v", err)
+		}
+		revocations = append(revocations, r)
+	}
+
+	return revocations, rows.Err()
+}
+
+// CreateSerialRevocation revokes a serial assertion, and marks the serial number as revoked in
+// the allowlist of the model
+func (db *DB) CreateSerialRevocation(revocation SerialRevocation) (SerialRevocation, error) {
+	if err := validateSerialRevocation(revocation); err != nil {
+		return revocation, err
+	}
+
+	if db.checkBoolQuery(db.QueryRow(checkSerialRevocationExistsSQL, revocation.BrandID, revocation.Model, revocation.SerialNumber, revocation.Revision)) {
+		return revocation, errors.New("The serial assertion has already been revoked")
+	}
+
+	err := db.transaction(func(tx *sql.Tx) error {
+		err := tx.QueryRow(createSerialRevocationSQL, revocation.BrandID, revocation.Model, revocation.SerialNumber, revocation.Revision, revocation.Reason).Scan(&revocation.ID, &revocation.Created)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(revokeSerialAllowlistSQL, revocation.BrandID, revocation.Model, revocation.SerialNumber)
+		return err
+	})
+	if err != nil {
+		log.Printf("Error revoking the serial assertion: %v\n", err)
+		return revocation, fmt.Errorf("error revoking the serial assertion: %v", err)
+	}
+
+	return revocation, nil
+}
+
+func (db *DB) deleteSerialRevocation(brandID, modelName string, revocationID int) error {
+	result, err := db.Exec(deleteSerialRevocationSQL, revocationID, brandID, modelName)
+	if err != nil {
+		return fmt.Errorf("error deleting the serial revocation: %v", err)
+	}
+
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return errors.New("Cannot find the serial revocation")
+	}
+	return nil
+}
+
+// SyncSerialRevocations replaces the revocations of a model in the factory with the revocations
+// that are managed in the cloud
+func (db *DB) SyncSerialRevocations(brandID, modelName string, revocations []SerialRevocation) error {
+	err := db.transaction(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(deleteModelSerialRevocationsSQL, brandID, modelName); err != nil {
+			return err
+		}
+
+		stmt, err := tx.Prepare(syncSerialRevocationSQL)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, r := range revocations {
+			if _, err := stmt.Exec(r.ID, brandID, modelName, r.SerialNumber, r.Revision, r.Reason, r.Created); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error syncing the serial revocations: %v\n", err)
+		return fmt.Errorf("error syncing the serial revocations: %v", err)
+	}
+	return nil
+}
+
+// CheckSerialRevoked checks whether a revision of a serial assertion has been revoked. A
+// revision of zero checks for the revocation of any revision of the serial number. The
+// factory checks the revocations that it synced from the cloud
+func (db *DB) CheckSerialRevoked(brandID, modelName, serialNumber string, revision int) (bool, error) {
+	var revoked bool
+	err := db.QueryRow(checkSerialRevokedSQL, brandID, modelName, serialNumber, revision).Scan(&revoked)
+	if err != nil {
+		log.Printf("Error checking the serial revocations: %v\n", err)
+		return false, errors.New("Error communicating with the database")
+	}
+	return revoked, nil
+}
+
+func validateSerialRevocation(revocation SerialRevocation) error {
+	if err := validateNotEmpty("Brand", revocation.BrandID); err != nil {
+		return err
+	}
+	if err := validateNotEmpty("Model", revocation.Model); err != nil {
+		return err
+	}
+	if err := validateNotEmpty("Serial-number", revocation.SerialNumber); err != nil {
+		return err
+	}
+	if err := validateNotEmpty("Reason", revocation.Reason); err != nil {
+		return err
+	}
+	if revocation.Revision < 0 {
+		return errors.New("The revision must not be negative")
+	}
+	return nil
+}
@@ -63,6 +63,8 @@ const maxIDSettingsSQLite = `
 
 const getSettingSQL = "select id, code, data from settings where code=$1"
 
+const updateSettingDataSQL = "update settings set data=$2 where code=$1"
+
 // Setting holds the keypair reference details in the local database
 type Setting struct {
 	ID   int
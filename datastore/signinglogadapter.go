@@ -29,7 +29,11 @@ func (db *DB) ListAllowedSigningLog(authorization User) ([]SigningLog, error) {
 	case SyncUser:
 		fallthrough
 	case Admin:
-		return db.listSigningLogFilteredByUser(authorization.Username)
+		logs, err := db.listSigningLogFilteredByUser(authorization.Username)
+		if err != nil {
+			return nil, err
+		}
+		return db.filterSigningLogByPermission(logs, authorization), nil
 	default:
 		return []SigningLog{}, nil
 	}
@@ -45,6 +49,9 @@ func (db *DB) ListAllowedSigningLogForAccount(authorization User, authorityID st
 	case SyncUser:
 		fallthrough
 	case Admin:
+		if !db.AllowedPermission(authorization, authorityID, PermissionSigningLogRead) {
+			return nil, errorPermission(authorityID, PermissionSigningLogRead)
+		}
 		return db.listSigningLogForAccountFilteredByUser(authorization.Username, authorityID, params)
 	default:
 		return []SigningLog{}, nil
@@ -59,8 +66,48 @@ func (db *DB) AllowedSigningLogFilterValues(authorization User, authorityID stri
 	case Superuser:
 		return db.allSigningLogFilterValues(authorityID)
 	case Admin:
+		if !db.AllowedPermission(authorization, authorityID, PermissionSigningLogRead) {
+			return SigningLogFilters{}, errorPermission(authorityID, PermissionSigningLogRead)
+		}
 		return db.signingLogFilterValuesFilteredByUser(authorization.Username, authorityID)
 	default:
 		return SigningLogFilters{}, nil
 	}
 }
+
+// ExportAllowedSigningLog streams the signing logs of an account that the user is authorized to see
+func (db *DB) ExportAllowedSigningLog(authorization User, authorityID string, params SigningLogExportParams, export func(SigningLog) error) error {
+	switch authorization.Role {
+	case Invalid: // Authentication disabled
+		fallthrough
+	case Superuser:
+		return db.ExportSigningLog(authorityID, params, export)
+	case SyncUser:
+		fallthrough
+	case Admin:
+		if !db.AllowedPermission(authorization, authorityID, PermissionSigningLogRead) {
+			return errorPermission(authorityID, PermissionSigningLogRead)
+		}
+		return db.exportSigningLogFilteredByUser(authorization.Username, authorityID, params, export)
+	default:
+		return nil
+	}
+}
+
+// filterSigningLogByPermission removes the signing logs of the accounts on which the user does not
+// have the permission to read the signing logs
+func (db *DB) filterSigningLogByPermission(logs []SigningLog, authorization User) []SigningLog {
+	allowed := map[string]bool{}
+	filtered := []SigningLog{}
+	for _, l := range logs {
+		ok, checked := allowed[l.Make]
+		if !checked {
+			ok = db.AllowedPermission(authorization, l.Make, PermissionSigningLogRead)
+			allowed[l.Make] = ok
+		}
+		if ok {
+			filtered = append(filtered, l)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,211 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/service/log"
+	sq "github.com/Masterminds/squirrel"
+)
+
+const createSigningLogArchiveTableSQL = `
+	CREATE TABLE IF NOT EXISTS signinglogarchive (
+		id             int primary key not null,
+		make           varchar(200) not null,
+		model          varchar(200) not null,
+		serial_number  varchar(200) not null,
+		fingerprint    varchar(200) not null,
+		created        timestamp,
+		revision       int default 1,
+		synced         int default 0,
+		archived       timestamp default current_timestamp
+	)
+`
+
+// The compact index of the archived signing logs, which is used to detect duplicates. It holds
+// the latest revision of each serial number and device-key
+const createSigningLogIndexTableSQL = `
+	CREATE TABLE IF NOT EXISTS signinglogindex (
+		make           varchar(200) not null,
+		model          varchar(200) not null,
+		serial_number  varchar(200) not null,
+		fingerprint    varchar(200) not null,
+		revision       int not null default 1,
+		primary key (make, model, serial_number, fingerprint)
+	)
+`
+
+const createSigningLogArchiveCreatedIndexSQL = "CREATE INDEX IF NOT EXISTS signinglogarchive_created_idx ON signinglogarchive (created)"
+const createSigningLogIndexFingerprintIndexSQL = "CREATE INDEX IF NOT EXISTS signinglogindex_fingerprint_idx ON signinglogindex (fingerprint)"
+
+const getSigningLogIndexSQL = "SELECT revision FROM signinglogindex WHERE make=$1 AND model=$2 AND serial_number=$3 AND fingerprint=$4"
+const createSigningLogIndexSQL = "INSERT INTO signinglogindex (make, model, serial_number, fingerprint, revision) VALUES ($1, $2, $3, $4, $5)"
+const updateSigningLogIndexSQL = "UPDATE signinglogindex SET revision=$1 WHERE make=$2 AND model=$3 AND serial_number=$4 AND fingerprint=$5"
+
+var signingLogColumns = []string{"id", "make", "model", "serial_number", "fingerprint", "created", "revision", "synced"}
+
+// CreateSigningLogArchiveTable creates the database tables for the archived signing logs and
+// their duplicate-detection index
+func (db *DB) CreateSigningLogArchiveTable() error {
+	for _, s := range []string{createSigningLogArchiveTableSQL, createSigningLogIndexTableSQL, createSigningLogArchiveCreatedIndexSQL, createSigningLogIndexFingerprintIndexSQL} {
+		if _, err := db.Exec(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SigningLogRetentionCutoff returns the time before which the signing logs are archived, for a
+// retention in months
+func SigningLogRetentionCutoff(months int) time.Time {
+	return time.Now().AddDate(0, -months, 0)
+}
+
+// signingLogSource returns the table that the exports and reports read the signing logs from.
+// Unless the signing logs are archived to files, the archive table is read with the signing log,
+// so the archived logs are part of the result
+func signingLogSource() string {
+	if len(Environ.Config.SigningLogArchiveDir) > 0 {
+		return "signinglog s"
+	}
+	columns := strings.Join(signingLogColumns, ", ")
+	return fmt.Sprintf("(SELECT %s FROM signinglog UNION ALL SELECT %s FROM signinglogarchive) s", columns, columns)
+}
+
+// checkSigningLogRetention refuses a range of the signing log that starts before the retention
+// cutoff when the signing logs are archived to files, as the older signing logs may have been
+// archived and would be missing from the result
+func checkSigningLogRetention(from *time.Time) error {
+	months := Environ.Config.SigningLogRetention
+	if months <= 0 || len(Environ.Config.SigningLogArchiveDir) == 0 {
+		return nil
+	}
+
+	cutoff := SigningLogRetentionCutoff(months)
+	if from == nil || from.Before(cutoff) {
+		earliest := cutoff.UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+		return fmt.Errorf("the signing logs are archived to files after %d months, so the range must start on or after %s", months, earliest.Format("2006-01-02"))
+	}
+	return nil
+}
+
+// ArchiveSigningLogs moves a batch of the signing logs that were created before a time out of the
+// signing log, oldest first, and returns the number of logs that were moved. Each log is added to
+// the duplicate-detection index and, when the archive table is used, copied to the archive table.
+// The archive function is called with the batch before the transaction is committed, so a batch
+// that fails to be archived stays in the signing log. When an error is returned, the batch was not
+// removed and the caller discards what the archive function wrote. In the factory, a log is only
+// archived once it has been synced to the cloud
+func (db *DB) ArchiveSigningLogs(before time.Time, limit int, archiveTable bool, archive func([]SigningLog) error) (int, error) {
+	where := sq.And{sq.Lt{"created": sqlTime(before)}}
+	if InFactory() {
+		where = append(where, sq.Eq{"synced": 1})
+	}
+
+	var count int
+	err := db.transaction(func(tx *sql.Tx) error {
+		query := sq.Select(signingLogColumns...).
+			From("signinglog").
+			Where(where).
+			OrderBy("id").
+			Limit(uint64(limit)).
+			PlaceholderFormat(sq.Dollar)
+		if !InFactory() {
+			// Lock the batch, so that an instance that archives at the same time skips its logs
+			// instead of waiting for them
+			query = query.Suffix("FOR UPDATE SKIP LOCKED")
+		}
+
+		rows, err := query.RunWith(tx).Query()
+		if err != nil {
+			return err
+		}
+		signingLogs, err := rowsToSigningLogs(rows)
+		rows.Close()
+		if err != nil || len(signingLogs) == 0 {
+			return err
+		}
+		// The batch is the logs that were locked, as the logs that were skipped belong to the batch
+		// of another instance
+		ids := make([]int, 0, len(signingLogs))
+		for _, signingLog := range signingLogs {
+			ids = append(ids, signingLog.ID)
+		}
+		batch := sq.Eq{"id": ids}
+
+		for _, signingLog := range signingLogs {
+			if err := indexSigningLog(tx, signingLog); err != nil {
+				return err
+			}
+		}
+
+		if archiveTable {
+			_, err = sq.Insert("signinglogarchive").
+				Columns(signingLogColumns...).
+				Select(sq.Select(signingLogColumns...).From("signinglog").Where(batch)).
+				PlaceholderFormat(sq.Dollar).
+				RunWith(tx).Exec()
+			if err != nil {
+				return err
+			}
+		}
+
+		if archive != nil {
+			if err := archive(signingLogs); err != nil {
+				return err
+			}
+		}
+
+		result, err := sq.Delete("signinglog").Where(batch).PlaceholderFormat(sq.Dollar).RunWith(tx).Exec()
+		if err != nil {
+			return err
+		}
+		if deleted, err := result.RowsAffected(); err != nil || int(deleted) != len(signingLogs) {
+			return fmt.Errorf("the signing log changed while it was archived (%d of %d logs)", deleted, len(signingLogs))
+		}
+
+		count = len(signingLogs)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error archiving the signing logs: %v\n", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// indexSigningLog adds the serial number and device-key of a signing log to the index that is
+// used to detect duplicates, keeping the latest revision
+func indexSigningLog(tx *sql.Tx, signingLog SigningLog) error {
+	var revision int
+	err := tx.QueryRow(getSigningLogIndexSQL, signingLog.Make, signingLog.Model, signingLog.SerialNumber, signingLog.Fingerprint).Scan(&revision)
+	switch {
+	case err == sql.ErrNoRows:
+		_, err = tx.Exec(createSigningLogIndexSQL, signingLog.Make, signingLog.Model, signingLog.SerialNumber, signingLog.Fingerprint, signingLog.Revision)
+	case err == nil && revision < signingLog.Revision:
+		_, err = tx.Exec(updateSigningLogIndexSQL, signingLog.Revision, signingLog.Make, signingLog.Model, signingLog.SerialNumber, signingLog.Fingerprint)
+	}
+	return err
+}
@@ -21,8 +21,11 @@ package datastore
 
 import (
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/CanonicalLtd/serial-vault/service/log"
@@ -52,19 +55,68 @@ const MaxFromID = 2147483647
 // ListSigningLogDefaultLimit is the default limit for the search queries in SigningLog
 const ListSigningLogDefaultLimit = 50
 
+// Sort fields of the signing log search
+const (
+	SigningLogSortID           = "id"
+	SigningLogSortCreated      = "created"
+	SigningLogSortSerialNumber = "serialnumber"
+)
+
+var signingLogSortColumns = map[string]string{
+	SigningLogSortID:           "id",
+	SigningLogSortCreated:      "created",
+	SigningLogSortSerialNumber: "serial_number",
+}
+
+// signingLogExportBatch is the number of signing logs that are read at a time for an export
+const signingLogExportBatch = 1000
+
 // Indexes
 const createSigningLogSerialNumberIndexSQL = "CREATE INDEX IF NOT EXISTS serialnumber_idx ON signinglog (make,model,serial_number)"
 const createSigningLogFingerprintIndexSQL = "CREATE INDEX IF NOT EXISTS fingerprint_idx ON signinglog (fingerprint)"
 const createSigningLogCreatedIndexSQL = "CREATE INDEX IF NOT EXISTS created_idx ON signinglog (created)"
 
 // Queries
-const findMatchingSigningLogSQL = "SELECT EXISTS(SELECT * FROM signinglog where make=$1 and model=$2 and serial_number=$3 and revision=$4)"
-const findExistingSigningLogSQL = "SELECT EXISTS(SELECT * FROM signinglog where (make=$1 and model=$2 and serial_number=$3) or fingerprint=$4)"
-const findMaxRevisionSigningLogSQL = "SELECT COALESCE(MAX(revision), 0) FROM signinglog where make=$1 and model=$2 and serial_number=$3"
-const maxIDSigningLogSQLite = "SELECT COUNT(*)+1 from signinglog"
+// The duplicate checks include the index of the archived signing logs, which keeps the latest
+// revision of each serial number and device-key
+const findMatchingSigningLogSQL = `
+	SELECT EXISTS(SELECT * FROM signinglog where make=$1 and model=$2 and serial_number=$3 and revision=$4)
+	OR EXISTS(SELECT * FROM signinglogindex where make=$5 and model=$6 and serial_number=$7 and revision>=$8)`
+const findExistingSigningLogSQL = `
+	SELECT EXISTS(SELECT * FROM signinglog where (make=$1 and model=$2 and serial_number=$3) or fingerprint=$4)
+	OR EXISTS(SELECT * FROM signinglogindex where (make=$5 and model=$6 and serial_number=$7) or fingerprint=$8)`
+const findDeviceKeyConflictSigningLogSQL = `
+	SELECT EXISTS(
+		SELECT * FROM signinglog
+		WHERE (make=$1 and model=$2 and serial_number=$3 and fingerprint<>$4)
+		OR (fingerprint=$4 and not (make=$1 and model=$2 and serial_number=$3))
+	) OR EXISTS(
+		SELECT * FROM signinglogindex
+		WHERE (make=$5 and model=$6 and serial_number=$7 and fingerprint<>$8)
+		OR (fingerprint=$8 and not (make=$5 and model=$6 and serial_number=$7))
+	)`
+const findMaxRevisionSigningLogSQL = `
+	SELECT COALESCE(MAX(revision), 0) FROM (
+		SELECT revision FROM signinglog where make=$1 and model=$2 and serial_number=$3
+		UNION ALL
+		SELECT revision FROM signinglogindex where make=$4 and model=$5 and serial_number=$6
+	) r`
+
+// The maximum revision of the signing logs of the serial number or the device-key
+const findMaxResignRevisionSigningLogSQL = `
+	SELECT COALESCE(MAX(revision), 0) FROM (
+		SELECT revision FROM signinglog where (make=$1 and model=$2 and serial_number=$3) or fingerprint=$4
+		UNION ALL
+		SELECT revision FROM signinglogindex where (make=$5 and model=$6 and serial_number=$7) or fingerprint=$8
+	) r`
+
+// The archived signing logs keep their IDs, so a new ID must not reuse one of them
+const maxIDSigningLogSQLite = "SELECT COALESCE(MAX(id), 0)+1 FROM (SELECT id FROM signinglog UNION ALL SELECT id FROM signinglogarchive)"
 const createSigningLogSQLite = "INSERT INTO signinglog (id, make, model, serial_number, fingerprint,revision) VALUES ($1, $2, $3, $4, $5, $6)"
 const createSigningLogSQL = "INSERT INTO signinglog (make, model, serial_number, fingerprint,revision) VALUES ($1, $2, $3, $4, $5)"
-const createSigningLogSyncSQL = "INSERT INTO signinglog (make, model, serial_number, fingerprint,revision,created) VALUES ($1, $2, $3, $4, $5, $6)"
+
+// A signing log received from a factory is marked as synced, as it is in the factory once it is sent
+const createSigningLogSyncSQL = "INSERT INTO signinglog (make, model, serial_number, fingerprint,revision,created,synced) VALUES ($1, $2, $3, $4, $5, $6, 1)"
 const listSigningLogSQL = "SELECT * FROM signinglog WHERE id < $1 ORDER BY id DESC LIMIT 10000"
 const listSigningLogForUserSQL = `
 	SELECT s.* FROM signinglog s
@@ -106,6 +158,38 @@ type SigningLog struct {
 	Total        int
 }
 
+// SigningLogCursor is the position of a signing log in a sorted list of signing logs, for keyset
+// pagination
+type SigningLogCursor struct {
+	ID           int       `json:"id"`
+	Created      time.Time `json:"created"`
+	SerialNumber string    `json:"serialnumber"`
+}
+
+// NewSigningLogCursor returns the cursor of the position of a signing log
+func NewSigningLogCursor(signingLog SigningLog) SigningLogCursor {
+	return SigningLogCursor{ID: signingLog.ID, Created: signingLog.Created, SerialNumber: signingLog.SerialNumber}
+}
+
+// Encode returns the cursor as an opaque string, to be used as a query parameter
+func (c SigningLogCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeSigningLogCursor returns the cursor from its opaque string
+func DecodeSigningLogCursor(value string) (SigningLogCursor, error) {
+	cursor := SigningLogCursor{}
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, errors.New("the cursor is invalid")
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID <= 0 {
+		return cursor, errors.New("the cursor is invalid")
+	}
+	return cursor, nil
+}
+
 // SigningLogFilters holds the values of the filters for the searchable columns
 type SigningLogFilters struct {
 	Makes  []string `json:"makes"`
@@ -143,14 +227,14 @@ func (db *DB) CreateSigningLogTable() error {
 func (db *DB) CheckForDuplicate(signLog *SigningLog) (bool, int, error) {
 	var duplicateExists bool
 	var maxRevision int
-	err := db.QueryRow(findExistingSigningLogSQL, signLog.Make, signLog.Model, signLog.SerialNumber, signLog.Fingerprint).Scan(&duplicateExists)
+	err := db.QueryRow(findExistingSigningLogSQL, signLog.Make, signLog.Model, signLog.SerialNumber, signLog.Fingerprint, signLog.Make, signLog.Model, signLog.SerialNumber, signLog.Fingerprint).Scan(&duplicateExists)
 	if err != nil {
 		log.Printf("Error checking signinglog for duplicate: %v\n", err)
 		return false, 0, errors.New("Error communicating with the database")
 	}
 
 	// If we do have a duplicate, we need to find the maximum revision number
-	err = db.QueryRow(findMaxRevisionSigningLogSQL, signLog.Make, signLog.Model, signLog.SerialNumber).Scan(&maxRevision)
+	err = db.QueryRow(findMaxRevisionSigningLogSQL, signLog.Make, signLog.Model, signLog.SerialNumber, signLog.Make, signLog.Model, signLog.SerialNumber).Scan(&maxRevision)
 	if err != nil {
 		log.Printf("Error checking signinglog for maximum revision number of the serial: %v\n", err)
 		return false, 0, errors.New("Error communicating with the database")
@@ -159,11 +243,38 @@ func (db *DB) CheckForDuplicate(signLog *SigningLog) (bool, int, error) {
 	return duplicateExists, maxRevision, nil
 }
 
+// FindMaxResignRevision returns the maximum revision of the signing logs of the serial number
+// or the device-key, so that re-signing a device-key for another serial number is also counted
+// as a re-sign
+func (db *DB) FindMaxResignRevision(signLog SigningLog) (int, error) {
+	var maxRevision int
+	err := db.QueryRow(findMaxResignRevisionSigningLogSQL, signLog.Make, signLog.Model, signLog.SerialNumber, signLog.Fingerprint, signLog.Make, signLog.Model, signLog.SerialNumber, signLog.Fingerprint).Scan(&maxRevision)
+	if err != nil {
+		log.Printf("Error checking signinglog for maximum revision number of the serial or device-key: %v\n", err)
+		return 0, errors.New("Error communicating with the database")
+	}
+
+	return maxRevision, nil
+}
+
+// CheckForDeviceKeyConflict checks if the serial number has been signed with a different device-key,
+// or if the device-key has been used to sign a different serial number
+func (db *DB) CheckForDeviceKeyConflict(signLog SigningLog) (bool, error) {
+	var conflict bool
+	err := db.QueryRow(findDeviceKeyConflictSigningLogSQL, signLog.Make, signLog.Model, signLog.SerialNumber, signLog.Fingerprint, signLog.Make, signLog.Model, signLog.SerialNumber, signLog.Fingerprint).Scan(&conflict)
+	if err != nil {
+		log.Printf("Error checking signinglog for a device-key conflict: %v\n", err)
+		return false, errors.New("Error communicating with the database")
+	}
+
+	return conflict, nil
+}
+
 // CheckForMatching checks to see if a matching signing-log entry exists
 // (same brand, model, serial number and revision)
 func (db *DB) CheckForMatching(signLog SigningLog) (bool, error) {
 	var duplicateExists bool
-	err := db.QueryRow(findMatchingSigningLogSQL, signLog.Make, signLog.Model, signLog.SerialNumber, signLog.Revision).Scan(&duplicateExists)
+	err := db.QueryRow(findMatchingSigningLogSQL, signLog.Make, signLog.Model, signLog.SerialNumber, signLog.Revision, signLog.Make, signLog.Model, signLog.SerialNumber, signLog.Revision).Scan(&duplicateExists)
 	if err != nil {
 		log.Printf("Error checking signinglog for matching record: %v\n", err)
 		return false, errors.New("Error communicating with the database")
@@ -204,6 +315,43 @@ func (db *DB) CreateSigningLog(signLog SigningLog) error {
 	return nil
 }
 
+// CreateSigningLogs logs the signing of a batch of serial assertions in a single transaction,
+// so that either all or none of the signing logs are created
+func (db *DB) CreateSigningLogs(signLogs []SigningLog) error {
+	// Validate the data
+	for _, signLog := range signLogs {
+		if !validateStringsNotEmpty(signLog.Make, signLog.Model, signLog.SerialNumber, signLog.Fingerprint) {
+			return errors.New("The Make, Model, Serial Number and device-key Fingerprint must be supplied")
+		}
+	}
+
+	err := db.transaction(func(tx *sql.Tx) error {
+		for _, signLog := range signLogs {
+			var err error
+			if InFactory() {
+				// Need to generate our own ID
+				var nextID int
+				err = tx.QueryRow(maxIDSigningLogSQLite).Scan(&nextID)
+				if err != nil {
+					return err
+				}
+
+				_, err = tx.Exec(createSigningLogSQLite, nextID, signLog.Make, signLog.Model, signLog.SerialNumber, signLog.Fingerprint, signLog.Revision)
+			} else {
+				_, err = tx.Exec(createSigningLogSQL, signLog.Make, signLog.Model, signLog.SerialNumber, signLog.Fingerprint, signLog.Revision)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error creating the signing logs: %v\n", err)
+	}
+	return err
+}
+
 // CreateSigningLogSync logs that a specific serial number has been used, along with the device-key fingerprint.
 func (db *DB) CreateSigningLogSync(signLog SigningLog) error {
 	var err error
@@ -262,28 +410,39 @@ func (db *DB) listAllSigningLogForAccount(authorityID string, params *SigningLog
 }
 
 func signingLogSQLBuilder(username, authorityID string, params *SigningLogParams) sq.SelectBuilder {
+	column, ok := signingLogSortColumns[params.Sort]
+	if !ok {
+		column = "id"
+	}
+	direction, compare := "DESC", "<"
+	if params.Ascending {
+		direction, compare = "ASC", ">"
+	}
+	orderBy := []string{"id " + direction}
+	if column != "id" {
+		// The ID breaks the ties, so the order is the same for each page
+		orderBy = append([]string{column + " " + direction}, orderBy...)
+	}
+
 	sql := sq.
-		Select("*", "count(*) OVER() AS total_count").
+		Select("*").
 		From("signinglog s").          // FROM signinglog s
 		Where(sq.Lt{"id": MaxFromID}). // WHERE id < $1
 		Where("make=?", authorityID).  // AND make=$2
-		OrderBy("id DESC").
-		Offset(params.Offset).
+		OrderBy(orderBy...).
 		PlaceholderFormat(sq.Dollar)
 
+	// The pages of keyset pagination are not counted, as counting would read all the matching logs
+	if params.After == nil {
+		sql = sql.Column("count(*) OVER() AS total_count").Offset(params.Offset)
+	}
+
 	if params.Limit > 0 {
 		sql = sql.Limit(params.Limit)
 	}
 
 	if username != "" {
-		nestedBuilder := sq.Select("*").Prefix("EXISTS (").
-			From("account acc").
-			JoinClause("INNER JOIN useraccountlink ua on ua.account_id=acc.id").
-			JoinClause("INNER JOIN userinfo u on ua.user_id=u.id").
-			Where("acc.authority_id=s.make AND u.username=?", username).
-			Suffix(")").PlaceholderFormat(sq.Dollar)
-
-		sql = sql.Where(nestedBuilder)
+		sql = sql.Where(signingLogUserFilter(username))
 	}
 	if len(params.Filter) > 0 {
 		sql = sql.Where(sq.Eq{"model": params.Filter})
@@ -292,10 +451,60 @@ func signingLogSQLBuilder(username, authorityID string, params *SigningLogParams
 		// WHERE serial_number LIKE 123%
 		sql = sql.Where(sq.Like{"serial_number": fmt.Sprintf("%s%%", params.Serialnumber)})
 	}
+	if params.CreatedFrom != nil {
+		sql = sql.Where(sq.GtOrEq{"created": sqlTime(*params.CreatedFrom)})
+	}
+	if params.CreatedTo != nil {
+		sql = sql.Where(sq.Lt{"created": sqlTime(*params.CreatedTo)})
+	}
+	if params.Fingerprint != "" {
+		sql = sql.Where(sq.Eq{"fingerprint": params.Fingerprint})
+	}
+	if params.Revision > 0 {
+		sql = sql.Where(sq.Eq{"revision": params.Revision})
+	}
+	if params.Synced != nil {
+		synced := 0
+		if *params.Synced {
+			synced = 1
+		}
+		sql = sql.Where(sq.Eq{"synced": synced})
+	}
+	if params.After != nil {
+		// Keyset pagination: the signing logs after the cursor in the sort order
+		switch column {
+		case "created":
+			created := sqlTime(params.After.Created)
+			sql = sql.Where(fmt.Sprintf("(created %s ? OR (created = ? AND id %s ?))", compare, compare), created, created, params.After.ID)
+		case "serial_number":
+			sql = sql.Where(fmt.Sprintf("(serial_number %s ? OR (serial_number = ? AND id %s ?))", compare, compare), params.After.SerialNumber, params.After.SerialNumber, params.After.ID)
+		default:
+			sql = sql.Where(fmt.Sprintf("id %s ?", compare), params.After.ID)
+		}
+	}
 
 	return sql
 }
 
+// sqlTime returns a time as a query parameter. On SQLite, the timestamps are stored as text, in
+// UTC to the second, so the time is given in the same format to compare it
+func sqlTime(t time.Time) interface{} {
+	if InFactory() {
+		return t.UTC().Format("2006-01-02 15:04:05")
+	}
+	return t.UTC()
+}
+
+// signingLogUserFilter limits the signing logs to the accounts of the user
+func signingLogUserFilter(username string) sq.SelectBuilder {
+	return sq.Select("*").Prefix("EXISTS (").
+		From("account acc").
+		JoinClause("INNER JOIN useraccountlink ua on ua.account_id=acc.id").
+		JoinClause("INNER JOIN userinfo u on ua.user_id=u.id").
+		Where("acc.authority_id=s.make AND u.username=?", username).
+		Suffix(")").PlaceholderFormat(sq.Dollar)
+}
+
 func (db *DB) listSigningLogForAccountFilteredByUser(username, authorityID string, params *SigningLogParams) ([]SigningLog, error) {
 	signingLogs := []SigningLog{}
 
@@ -309,9 +518,13 @@ func (db *DB) listSigningLogForAccountFilteredByUser(username, authorityID strin
 
 	for rows.Next() {
 		signingLog := SigningLog{}
-		err := rows.Scan(&signingLog.ID, &signingLog.Make, &signingLog.Model,
+		dest := []interface{}{&signingLog.ID, &signingLog.Make, &signingLog.Model,
 			&signingLog.SerialNumber, &signingLog.Fingerprint, &signingLog.Created,
-			&signingLog.Revision, &signingLog.Synced, &signingLog.Total)
+			&signingLog.Revision, &signingLog.Synced}
+		if params.After == nil {
+			dest = append(dest, &signingLog.Total)
+		}
+		err := rows.Scan(dest...)
 		if err != nil {
 			log.Printf("Error retrieving signing logs: %v\n", err)
 			return nil, err
@@ -322,6 +535,101 @@ func (db *DB) listSigningLogForAccountFilteredByUser(username, authorityID strin
 	return signingLogs, nil
 }
 
+// ExportSigningLog streams the signing logs of an account to the export function, in order of
+// ID. The logs are read in batches after the last ID that was exported, so the export is not
+// held in memory. The archived logs are exported from the archive table, but when the logs are
+// archived to files the range must start after the retention cutoff
+func (db *DB) ExportSigningLog(authorityID string, params SigningLogExportParams, export func(SigningLog) error) error {
+	return db.exportSigningLogFilteredByUser(anyUserFilter, authorityID, params, export)
+}
+
+func (db *DB) exportSigningLogFilteredByUser(username, authorityID string, params SigningLogExportParams, export func(SigningLog) error) error {
+	if err := checkSigningLogRetention(params.From); err != nil {
+		return err
+	}
+	lastID := 0
+
+	for {
+		query := signingLogExportSQLBuilder(username, authorityID, params, lastID)
+		rows, err := query.RunWith(db).Query()
+		if err != nil {
+			log.Printf("Error retrieving signing logs: %v\n", err)
+			return err
+		}
+		signingLogs, err := rowsToSigningLogs(rows)
+		rows.Close()
+		if err != nil {
+			log.Printf("Error retrieving signing logs: %v\n", err)
+			return err
+		}
+
+		for _, signingLog := range signingLogs {
+			if err := export(signingLog); err != nil {
+				return err
+			}
+			lastID = signingLog.ID
+		}
+
+		if len(signingLogs) < signingLogExportBatch {
+			return nil
+		}
+	}
+}
+
+func signingLogExportSQLBuilder(username, authorityID string, params SigningLogExportParams, afterID int) sq.SelectBuilder {
+	sql := sq.
+		Select("id", "make", "model", "serial_number", "fingerprint", "created", "revision", "synced").
+		From(signingLogSource()).
+		Where(sq.Gt{"id": afterID}).
+		Where("make=?", authorityID).
+		OrderBy("id").
+		Limit(signingLogExportBatch).
+		PlaceholderFormat(sq.Dollar)
+
+	if username != "" {
+		sql = sql.Where(signingLogUserFilter(username))
+	}
+	if params.From != nil {
+		sql = sql.Where(sq.GtOrEq{"created": sqlTime(*params.From)})
+	}
+	if params.To != nil {
+		sql = sql.Where(sq.Lt{"created": sqlTime(*params.To)})
+	}
+	if len(params.Models) > 0 {
+		sql = sql.Where(sq.Eq{"model": params.Models})
+	}
+	if params.Serialnumber != "" {
+		sql = sql.Where("serial_number LIKE ? ESCAPE '\\'", serialNumberPattern(params.Serialnumber))
+	}
+
+	return sql
+}
+
+// serialNumberPattern converts a serial number pattern, where '*' matches any characters, to a
+// LIKE pattern. A pattern without a '*' matches the start of the serial number
+func serialNumberPattern(pattern string) string {
+	like := strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_", "*", "%").Replace(pattern)
+	if !strings.Contains(pattern, "*") {
+		like += "%"
+	}
+	return like
+}
+
+func rowsToSigningLogs(rows *sql.Rows) ([]SigningLog, error) {
+	signingLogs := []SigningLog{}
+
+	for rows.Next() {
+		signingLog := SigningLog{}
+		err := rows.Scan(&signingLog.ID, &signingLog.Make, &signingLog.Model, &signingLog.SerialNumber, &signingLog.Fingerprint, &signingLog.Created, &signingLog.Revision, &signingLog.Synced)
+		if err != nil {
+			return nil, err
+		}
+		signingLogs = append(signingLogs, signingLog)
+	}
+
+	return signingLogs, rows.Err()
+}
+
 func (db *DB) allSigningLogFilterValues(authorityID string) (SigningLogFilters, error) {
 	return db.signingLogFilterValuesFilteredByUser(anyUserFilter, authorityID)
 }
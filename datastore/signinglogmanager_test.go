@@ -20,8 +20,12 @@
 package datastore
 
 import (
+	"database/sql"
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/CanonicalLtd/serial-vault/config"
 	check "gopkg.in/check.v1"
 )
 
@@ -31,7 +35,14 @@ type sqlSuite struct{}
 
 var _ = check.Suite(&sqlSuite{})
 
+func (vs *sqlSuite) SetUpTest(c *check.C) {
+	Environ = &Env{}
+}
+
 func (vs *sqlSuite) TestSigningLogSQLBuilder(c *check.C) {
+	from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	synced := true
 
 	tests := []struct {
 		username    string
@@ -109,6 +120,53 @@ func (vs *sqlSuite) TestSigningLogSQLBuilder(c *check.C) {
 			wantSQL:    `SELECT *, count(*) OVER() AS total_count FROM signinglog s WHERE id < $1 AND make=$2 AND serial_number LIKE $3 ORDER BY id DESC OFFSET 0`,
 			wantParams: []interface{}{2147483647, "admin", "Robert'); DROP TABLE signinglog;--%"},
 		},
+		{
+			authorityID: "admin",
+			params: &SigningLogParams{
+				CreatedFrom: &from,
+				CreatedTo:   &to,
+				Fingerprint: "aaaabbbb",
+				Revision:    2,
+				Synced:      &synced,
+			},
+			wantSQL:    "SELECT *, count(*) OVER() AS total_count FROM signinglog s WHERE id < $1 AND make=$2 AND created >= $3 AND created < $4 AND fingerprint = $5 AND revision = $6 AND synced = $7 ORDER BY id DESC OFFSET 0",
+			wantParams: []interface{}{2147483647, "admin", from, to, "aaaabbbb", 2, 1},
+		},
+		{
+			authorityID: "admin",
+			params: &SigningLogParams{
+				Limit: 50,
+				After: &SigningLogCursor{ID: 100},
+			},
+			wantSQL:    "SELECT * FROM signinglog s WHERE id < $1 AND make=$2 AND id < $3 ORDER BY id DESC LIMIT 50",
+			wantParams: []interface{}{2147483647, "admin", 100},
+		},
+		{
+			authorityID: "admin",
+			params: &SigningLogParams{
+				Limit:     50,
+				Sort:      SigningLogSortCreated,
+				Ascending: true,
+				After:     &SigningLogCursor{ID: 100, Created: from},
+			},
+			wantSQL:    "SELECT * FROM signinglog s WHERE id < $1 AND make=$2 AND (created > $3 OR (created = $4 AND id > $5)) ORDER BY created ASC, id ASC LIMIT 50",
+			wantParams: []interface{}{2147483647, "admin", from, from, 100},
+		},
+		{
+			authorityID: "admin",
+			params: &SigningLogParams{
+				Sort:  SigningLogSortSerialNumber,
+				After: &SigningLogCursor{ID: 100, SerialNumber: "R100"},
+			},
+			wantSQL:    "SELECT * FROM signinglog s WHERE id < $1 AND make=$2 AND (serial_number < $3 OR (serial_number = $4 AND id < $5)) ORDER BY serial_number DESC, id DESC",
+			wantParams: []interface{}{2147483647, "admin", "R100", "R100", 100},
+		},
+		{
+			authorityID: "admin",
+			params:      &SigningLogParams{Sort: "fingerprint", Ascending: true},
+			wantSQL:     "SELECT *, count(*) OVER() AS total_count FROM signinglog s WHERE id < $1 AND make=$2 ORDER BY id ASC OFFSET 0",
+			wantParams:  []interface{}{2147483647, "admin"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -120,3 +178,135 @@ func (vs *sqlSuite) TestSigningLogSQLBuilder(c *check.C) {
 		c.Assert(args, check.DeepEquals, tt.wantParams)
 	}
 }
+
+func (vs *sqlSuite) TestSigningLogExportSQLBuilder(c *check.C) {
+	from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		username   string
+		params     SigningLogExportParams
+		afterID    int
+		wantSQL    string
+		wantParams []interface{}
+	}{
+		{
+			params:     SigningLogExportParams{},
+			wantSQL:    "SELECT id, make, model, serial_number, fingerprint, created, revision, synced FROM (SELECT id, make, model, serial_number, fingerprint, created, revision, synced FROM signinglog UNION ALL SELECT id, make, model, serial_number, fingerprint, created, revision, synced FROM signinglogarchive) s WHERE id > $1 AND make=$2 ORDER BY id LIMIT 1000",
+			wantParams: []interface{}{0, "admin"},
+		},
+		{
+			params:     SigningLogExportParams{From: &from, To: &to, Models: []string{"foo", "bar"}},
+			afterID:    1000,
+			wantSQL:    "SELECT id, make, model, serial_number, fingerprint, created, revision, synced FROM (SELECT id, make, model, serial_number, fingerprint, created, revision, synced FROM signinglog UNION ALL SELECT id, make, model, serial_number, fingerprint, created, revision, synced FROM signinglogarchive) s WHERE id > $1 AND make=$2 AND created >= $3 AND created < $4 AND model IN ($5,$6) ORDER BY id LIMIT 1000",
+			wantParams: []interface{}{1000, "admin", from, to, "foo", "bar"},
+		},
+		{
+			params:     SigningLogExportParams{Serialnumber: "R12*_0"},
+			wantSQL:    `SELECT id, make, model, serial_number, fingerprint, created, revision, synced FROM (SELECT id, make, model, serial_number, fingerprint, created, revision, synced FROM signinglog UNION ALL SELECT id, make, model, serial_number, fingerprint, created, revision, synced FROM signinglogarchive) s WHERE id > $1 AND make=$2 AND serial_number LIKE $3 ESCAPE '\' ORDER BY id LIMIT 1000`,
+			wantParams: []interface{}{0, "admin", `R12%\_0`},
+		},
+		{
+			username:   "bob",
+			params:     SigningLogExportParams{Serialnumber: "R100%"},
+			wantSQL:    `SELECT id, make, model, serial_number, fingerprint, created, revision, synced FROM (SELECT id, make, model, serial_number, fingerprint, created, revision, synced FROM signinglog UNION ALL SELECT id, make, model, serial_number, fingerprint, created, revision, synced FROM signinglogarchive) s WHERE id > $1 AND make=$2 AND EXISTS ( SELECT * FROM account acc INNER JOIN useraccountlink ua on ua.account_id=acc.id INNER JOIN userinfo u on ua.user_id=u.id WHERE acc.authority_id=s.make AND u.username=$3 ) AND serial_number LIKE $4 ESCAPE '\' ORDER BY id LIMIT 1000`,
+			wantParams: []interface{}{0, "admin", "bob", `R100\%%`},
+		},
+	}
+
+	for _, tt := range tests {
+		got := signingLogExportSQLBuilder(tt.username, "admin", tt.params, tt.afterID)
+		sql, args, err := got.ToSql()
+
+		c.Assert(err, check.IsNil)
+		c.Assert(sql, check.Equals, tt.wantSQL)
+		c.Assert(args, check.DeepEquals, tt.wantParams)
+	}
+}
+
+func (vs *sqlSuite) TestSigningLogCursor(c *check.C) {
+	cursor := NewSigningLogCursor(SigningLog{ID: 12, Make: "system", SerialNumber: "R100", Created: time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)})
+
+	decoded, err := DecodeSigningLogCursor(cursor.Encode())
+	c.Assert(err, check.IsNil)
+	c.Assert(decoded, check.DeepEquals, cursor)
+
+	for _, value := range []string{"", "not base64!", "bm90IGpzb24", "e30"} {
+		_, err = DecodeSigningLogCursor(value)
+		c.Assert(err, check.ErrorMatches, "the cursor is invalid")
+	}
+}
+
+func (vs *sqlSuite) TestCheckSigningLogRetention(c *check.C) {
+	recent := time.Now().AddDate(0, -1, 0)
+	old := time.Now().AddDate(-2, 0, 0)
+
+	c.Assert(checkSigningLogRetention(nil), check.IsNil)
+	c.Assert(checkSigningLogRetention(&old), check.IsNil)
+
+	// The archive table is read with the signing log, so any range can be exported
+	Environ.Config.SigningLogRetention = 12
+	c.Assert(checkSigningLogRetention(nil), check.IsNil)
+	c.Assert(checkSigningLogRetention(&old), check.IsNil)
+
+	Environ.Config.SigningLogArchiveDir = "/var/lib/serial-vault/archive"
+	c.Assert(checkSigningLogRetention(&recent), check.IsNil)
+	for _, from := range []*time.Time{nil, &old} {
+		c.Assert(checkSigningLogRetention(from), check.ErrorMatches, "the signing logs are archived to files after 12 months, so the range must start on or after .*")
+	}
+
+	db := &DB{}
+	err := db.ExportSigningLog("system", SigningLogExportParams{From: &old}, nil)
+	c.Assert(err, check.ErrorMatches, "the signing logs are archived to files after 12 months.*")
+	_, err = db.SigningReport(SigningReportParams{Period: ReportDay})
+	c.Assert(err, check.ErrorMatches, "the signing logs are archived to files after 12 months.*")
+}
+
+func (vs *sqlSuite) TestSigningLogSource(c *check.C) {
+	c.Assert(signingLogSource(), check.Equals, "(SELECT id, make, model, serial_number, fingerprint, created, revision, synced FROM signinglog UNION ALL SELECT id, make, model, serial_number, fingerprint, created, revision, synced FROM signinglogarchive) s")
+
+	Environ.Config.SigningLogArchiveDir = "/var/lib/serial-vault/archive"
+	c.Assert(signingLogSource(), check.Equals, "signinglog s")
+}
+
+func (vs *sqlSuite) TestExportSigningLogArchive(c *check.C) {
+	Environ = &Env{Config: config.Settings{Driver: "sqlite3", SigningLogRetention: 6}}
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	c.Assert(err, check.IsNil)
+	defer sqlDB.Close()
+	sqlDB.SetMaxOpenConns(1)
+
+	db := &DB{DB: sqlDB}
+	c.Assert(db.CreateSigningLogTable(), check.IsNil)
+	c.Assert(db.CreateSigningLogArchiveTable(), check.IsNil)
+	c.Assert(db.CreateRemodelHistoryTable(), check.IsNil)
+
+	// A year of signing logs, one a month, of which the older ones are archived
+	now := time.Now().UTC()
+	for i := 1; i <= 12; i++ {
+		created := now.AddDate(0, -i, 0).Format("2006-01-02 15:04:05")
+		_, err = sqlDB.Exec("INSERT INTO signinglog (id, make, model, serial_number, fingerprint, created, synced) VALUES ($1, 'system', 'alder', $2, $3, $4, 1)", i, fmt.Sprintf("R%d", i), fmt.Sprintf("fingerprint%d", i), created)
+		c.Assert(err, check.IsNil)
+	}
+	count, err := db.ArchiveSigningLogs(SigningLogRetentionCutoff(6), 100, true, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 6)
+
+	from := now.AddDate(-1, 0, -1)
+	exported := []int{}
+	err = db.ExportSigningLog("system", SigningLogExportParams{From: &from}, func(signingLog SigningLog) error {
+		exported = append(exported, signingLog.ID)
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(exported, check.DeepEquals, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12})
+
+	reports, err := db.SigningReport(SigningReportParams{Period: ReportMonth, From: &from})
+	c.Assert(err, check.IsNil)
+	signed := 0
+	for _, report := range reports {
+		signed += report.Signed
+	}
+	c.Assert(signed, check.Equals, 12)
+}
@@ -69,6 +69,9 @@ func (db *DB) UpdateAllowedSubstore(store Substore, authorization User) error {
 	case Superuser:
 		return db.updateSubstore(store)
 	case Admin:
+		if err := db.checkSubstorePermission(store.ID, authorization); err != nil {
+			return err
+		}
 		return db.updateSubstoreFilteredByUser(store, authorization.Username)
 	default:
 		return nil
@@ -93,8 +96,11 @@ func (db *DB) CreateAllowedSubstore(store Substore, authorization User) (Substor
 	case Invalid: // Authentication is disabled
 		fallthrough
 	case Superuser:
-		fallthrough
+		return db.createSubstore(store)
 	case Admin:
+		if !db.AllowedPermission(authorization, acc.AuthorityID, PermissionSubstoreEdit) {
+			return store, errorPermission(acc.AuthorityID, PermissionSubstoreEdit)
+		}
 		return db.createSubstore(store)
 	default:
 		return Substore{}, nil
@@ -109,12 +115,27 @@ func (db *DB) DeleteAllowedSubstore(storeID int, authorization User) (string, er
 	case Superuser:
 		return db.deleteSubstore(storeID)
 	case Admin:
+		if err := db.checkSubstorePermission(storeID, authorization); err != nil {
+			return "error-auth", err
+		}
 		return db.deleteSubstoreFilteredByUser(storeID, authorization.Username)
 	default:
 		return "", nil
 	}
 }
 
+// checkSubstorePermission checks that the user can edit the sub-stores of the sub-store's account
+func (db *DB) checkSubstorePermission(storeID int, authorization User) error {
+	authorityID, err := db.getSubstoreAuthorityID(storeID)
+	if err != nil {
+		return fmt.Errorf("cannot find the sub-store: %v", err)
+	}
+	if !db.AllowedPermission(authorization, authorityID, PermissionSubstoreEdit) {
+		return errorPermission(authorityID, PermissionSubstoreEdit)
+	}
+	return nil
+}
+
 func validateSubstore(store Substore, validateStoreLabel string) (string, error) {
 	errTemplate := "invalid substore %s: %v"
 
@@ -97,6 +97,12 @@ const deleteSubstoreForUserSQL = `
 		INNER JOIN userinfo u ON ua.user_id=u.id
 		WHERE s.id=$1 AND acc.id=s.account_id AND u.username=$2`
 
+const getSubstoreAuthorityIDSQL = `
+	SELECT acc.authority_id
+	FROM substore s
+	INNER JOIN account acc ON acc.id=s.account_id
+	WHERE s.id=$1`
+
 // Substore holds the substore details for an account in the local database
 type Substore struct {
 	ID           int    `json:"id"`
@@ -250,6 +256,13 @@ func (db *DB) deleteSubstoreFilteredByUser(storeID int, username string) (string
 	return "", nil
 }
 
+// getSubstoreAuthorityID fetches the authority ID of the account of a sub-store
+func (db *DB) getSubstoreAuthorityID(storeID int) (string, error) {
+	var authorityID string
+	err := db.QueryRow(getSubstoreAuthorityIDSQL, storeID).Scan(&authorityID)
+	return authorityID, err
+}
+
 func (db *DB) rowsToSubstores(rows *sql.Rows) ([]Substore, error) {
 	stores := []Substore{}
 
@@ -21,7 +21,9 @@ package datastore
 
 import (
 	"errors"
+	"fmt"
 	"regexp"
+	"strings"
 )
 
 const validUsernamePattern = defaultNicknamePattern
@@ -47,16 +49,16 @@ func (db *DB) CreateUser(user User) (int, error) {
 	return db.createUser(user)
 }
 
-// UpdateUser validates and sets user new values for an existing record. Also updates useraccount link. All that in a transaction
+// UpdateUser validates and sets user new values for an existing record. Also updates useraccount link. All that in a transaction.
+// The user's API key is kept when a new key is not supplied
 func (db *DB) UpdateUser(user User) error {
-	// Check the API key and default it if it is invalid
-	apiKey, err := buildValidOrDefaultAPIKey(user.APIKey)
-	if err != nil {
-		return errors.New("Error in generating a valid API key")
+	// Check a new API key
+	user.APIKey = strings.Replace(user.APIKey, " ", "", -1)
+	if len(user.APIKey) > 0 && len(user.APIKey) <= minAPIKeyLength {
+		return fmt.Errorf("The API key must be longer than %d characters", minAPIKeyLength)
 	}
-	user.APIKey = apiKey
 
-	err = validateUser(user)
+	err := validateUser(user)
 	if err != nil {
 		return err
 	}
@@ -64,6 +66,17 @@ func (db *DB) UpdateUser(user User) error {
 	return db.updateUser(user)
 }
 
+// ProvisionUser validates and creates or updates a user from the role mappings of the login
+// provider. A new user gets a generated API key
+func (db *DB) ProvisionUser(user User) (int, error) {
+	err := validateUser(user)
+	if err != nil {
+		return 0, err
+	}
+
+	return db.provisionUser(user)
+}
+
 func validateUser(user User) error {
 	// Validate username; the rule is: lowercase with no spaces
 	err := validateUsername(user.Username)
@@ -22,6 +22,9 @@ package datastore
 import (
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/config"
 )
 
 func TestUserName(t *testing.T) {
@@ -158,3 +161,26 @@ func TestValidEmails(t *testing.T) {
 		}
 	}
 }
+
+func TestUserProvisionExpired(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		user    User
+		expiry  int
+		expired bool
+	}{
+		{User{Username: "manual"}, 0, false},
+		{User{Username: "provisioned", Provisioned: true, ProvisionedAt: now.Add(-time.Hour)}, 0, false},
+		{User{Username: "provisioned", Provisioned: true, ProvisionedAt: now.Add(-25 * time.Hour)}, 0, true},
+		{User{Username: "provisioned", Provisioned: true, ProvisionedAt: now.Add(-3 * time.Hour)}, 2, true},
+		{User{Username: "provisioned", Provisioned: true}, 0, true},
+	}
+
+	for _, tt := range tests {
+		Environ = &Env{Config: config.Settings{ProvisionedExpiry: tt.expiry}}
+		if got := tt.user.ProvisionExpired(now); got != tt.expired {
+			t.Errorf("ProvisionExpired(%v) with expiry %d = %v, want %v", tt.user.ProvisionedAt, tt.expiry, got, tt.expired)
+		}
+	}
+}
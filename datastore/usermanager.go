@@ -22,6 +22,8 @@ package datastore
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/CanonicalLtd/serial-vault/service/log"
 )
@@ -33,7 +35,11 @@ const createUserTableSQL = `
 		name             varchar(200),
 		email            varchar(255) not null,
 		userrole         int not null,
-		api_key          varchar(200) not null
+		api_key          varchar(200) not null,
+		api_key_hash     varchar(64) default '',
+		provisioned      boolean default false,
+		provisioned_at   timestamp,
+		oidc_identity    varchar(255) default ''
 	)
 `
 
@@ -44,17 +50,18 @@ const createAccountUserLinkTableSQL = `
 	)
 `
 
-const listUsersSQL = "select id, username, name, email, userrole, api_key from userinfo order by username"
-const getUserSQL = "select id, username, name, email, userrole, api_key from userinfo where id=$1"
-const getUserByUsernameSQL = "select id, username, name, email, userrole, api_key from userinfo where username=$1"
-const getUserByAPIKeySQL = "select id, username, name, email, userrole, api_key from userinfo where api_key=$1 and username=$2"
-const findUsersSQL = "select id, username, name, email, userrole, api_key from userinfo where username like '%$1%' or name like '%$1%'"
-const createUserSQL = "insert into userinfo (username, name, email, userrole, api_key) values ($1,$2,$3,$4,$5) RETURNING id"
-const updateUserSQL = "update userinfo set username=$1, name=$2, email=$3, userrole=$4, api_key=$6 where id=$5"
+const listUsersSQL = "select id, username, name, email, userrole, provisioned, provisioned_at from userinfo order by username"
+const getUserSQL = "select id, username, name, email, userrole, provisioned, provisioned_at from userinfo where id=$1"
+const getUserByUsernameSQL = "select id, username, name, email, userrole, provisioned, provisioned_at from userinfo where username=$1"
+const getUserByAPIKeySQL = "select id, username, name, email, userrole, provisioned, provisioned_at from userinfo where api_key_hash=$1 and username=$2"
+const findUsersSQL = "select id, username, name, email, userrole, provisioned, provisioned_at from userinfo where username like '%$1%' or name like '%$1%'"
+const createUserSQL = "insert into userinfo (username, name, email, userrole, api_key, api_key_hash) values ($1,$2,$3,$4,'',$5) RETURNING id"
+const updateUserSQL = "update userinfo set username=$1, name=$2, email=$3, userrole=$4 where id=$5"
+const updateUserAPIKeySQL = "update userinfo set api_key='', api_key_hash=$1 where id=$2"
 const deleteUserSQL = "delete from userinfo where id=$1"
 
 const listAccountUsersSQL = `
-	select id, username, name, email, userrole, api_key
+	select id, username, name, email, userrole, provisioned, provisioned_at
 	from userinfo u
 	inner join useraccountlink l on u.id = l.user_id
 	inner join account a on l.account_id = a.id
@@ -83,6 +90,24 @@ const alterUserAPIKeyNotNullable = `alter table userinfo
 	alter column api_key drop default
 `
 
+// Add the hashed API key field to the user table. The plaintext API keys are moved to it
+const alterUserAPIKeyHash = "alter table userinfo add column api_key_hash varchar(64) default ''"
+const listPlaintextUserAPIKeysSQL = "select id, api_key from userinfo where api_key<>''"
+
+// Add the provisioned fields to the user table, for the users that are provisioned from the role mappings
+const alterUserProvisioned = "alter table userinfo add column provisioned boolean default false"
+const alterUserProvisionedAt = "alter table userinfo add column provisioned_at timestamp"
+
+// Add the OpenID Connect identity field to the user table, which binds the user to the identity of
+// their first login
+const alterUserOIDCIdentity = "alter table userinfo add column oidc_identity varchar(255) default ''"
+const bindUserOIDCIdentitySQL = "update userinfo set oidc_identity=$1 where id=$2 and coalesce(oidc_identity, '')=''"
+const getUserOIDCIdentitySQL = "select coalesce(oidc_identity, '') from userinfo where id=$1"
+
+const provisionUserSQL = "update userinfo set provisioned=$1, provisioned_at=$2 where id=$3"
+const deprovisionUserSQL = "update userinfo set userrole=$1, api_key='', api_key_hash='' where id=$2"
+const disableUserTokensSQL = "update usertoken set enabled=$1 where user_id=$2"
+
 // Available user roles:
 //
 // * Invalid:	default value set in case there is no authentication previous process for this user and thus not got a valid role.
@@ -104,15 +129,43 @@ var RoleName = map[int]string{0: "", 100: "standard", 150: "syncuser", 200: "adm
 // RoleID holds the ID for each of the named roles
 var RoleID = map[string]int{"": 0, "standard": 100, "syncuser": 150, "admin": 200, "superuser": 300}
 
-// User holds user personal, authentication and authorization info
+// User holds user personal, authentication and authorization info. Only the hash of the
+// API key is stored, so the APIKey is only set when the key is created or reset. The Token
+// is set when the user is authenticated with a personal access token. A Provisioned user
+// is created and updated from the role mappings of the login provider, and ProvisionedAt is
+// when the user's groups were last checked. The SourceIP is the address of the user's request,
+// for the audit log
 type User struct {
-	ID       int
-	Username string
-	Name     string
-	Email    string
-	APIKey   string
-	Role     int
-	Accounts []Account
+	ID            int
+	Username      string
+	Name          string
+	Email         string
+	APIKey        string
+	Role          int
+	Accounts      []Account
+	Provisioned   bool
+	ProvisionedAt time.Time  `json:"-"`
+	Token         *UserToken `json:"-"`
+	SourceIP      string     `json:"-"`
+}
+
+// defaultProvisionedExpiry is the hours that the API key and personal access tokens of a
+// provisioned user are valid for after the user's groups were last checked
+const defaultProvisionedExpiry = 24
+
+// ProvisionExpired checks whether the groups of a provisioned user were last checked too long
+// ago. The groups are only checked when the user logs in, so the user's API key and personal
+// access tokens cannot be used until the user logs in again
+func (user User) ProvisionExpired(now time.Time) bool {
+	if !user.Provisioned {
+		return false
+	}
+
+	hours := Environ.Config.ProvisionedExpiry
+	if hours <= 0 {
+		hours = defaultProvisionedExpiry
+	}
+	return now.Sub(user.ProvisionedAt) > time.Duration(hours)*time.Hour
 }
 
 // CreateUserTable creates User table in database
@@ -146,35 +199,149 @@ func (db *DB) addUserAPIKeyField() error {
 		return nil
 	}
 
-	// Default the API key for any records where it is empty
-	users, err := db.ListUsers()
+	// The API keys of the existing users are set when they are reset, as only the hash of a key is stored
+
+	// Add the constraints to the API key field
+	_, err = db.Exec(alterUserAPIKeyNotNullable)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// HashUserAPIKeys adds the hashed API key field to the user table, and replaces the plaintext
+// API keys with their hashes
+func (db *DB) HashUserAPIKeys() error {
+	// Add the hashed API key field (ignore the error as it may already be there)
+	db.Exec(alterUserAPIKeyHash)
+
+	rows, err := db.Query(listPlaintextUserAPIKeysSQL)
 	if err != nil {
+		log.Printf("Error retrieving the user API keys: %v\n", err)
 		return err
 	}
-	for _, user := range users {
-		if len(user.APIKey) > 0 {
-			continue
+
+	keys := map[int]string{}
+	for rows.Next() {
+		var id int
+		var apiKey string
+		if err := rows.Scan(&id, &apiKey); err != nil {
+			rows.Close()
+			return err
 		}
+		keys[id] = apiKey
+	}
+	rows.Close()
 
-		// Generate an random API key and update the record
-		apiKey, err := generateAPIKey()
-		if err != nil {
-			log.Printf("Could not generate random string for the API key")
-			return errors.New("Error generating random string for the API key")
+	for id, apiKey := range keys {
+		if _, err := db.Exec(updateUserAPIKeySQL, HashAPIKey(apiKey), id); err != nil {
+			log.Printf("Error hashing the API key of user %d: %v\n", id, err)
+			return err
 		}
+	}
+	return nil
+}
+
+// AlterUserProvisioned adds the provisioned fields to the user table
+func (db *DB) AlterUserProvisioned() error {
+	// Add the provisioned fields (ignore the errors as they may already be there)
+	db.Exec(alterUserProvisioned)
+	db.Exec(alterUserProvisionedAt)
+	return nil
+}
+
+// AlterUserOIDCIdentity adds the OpenID Connect identity field to the user table
+func (db *DB) AlterUserOIDCIdentity() error {
+	// Add the identity field (ignore the error as it may already be there)
+	db.Exec(alterUserOIDCIdentity)
+	return nil
+}
 
-		// Update the API key on the model
-		user.APIKey = apiKey
-		db.updateUser(user)
+// BindUserOIDCIdentity binds the user to the OpenID Connect identity (issuer and subject) on
+// the user's first login. It returns false when the user is bound to a different identity
+func (db *DB) BindUserOIDCIdentity(userID int, identity string) (bool, error) {
+	if _, err := db.Exec(bindUserOIDCIdentitySQL, identity, userID); err != nil {
+		log.Printf("Error binding the user identity: %v\n", err)
+		return false, err
 	}
 
-	// Add the constraints to the API key field
-	_, err = db.Exec(alterUserAPIKeyNotNullable)
+	var bound string
+	if err := db.QueryRow(getUserOIDCIdentitySQL, userID).Scan(&bound); err != nil {
+		log.Printf("Error retrieving the user identity: %v\n", err)
+		return false, err
+	}
+	return bound == identity, nil
+}
+
+// provisionUser creates or updates a user from the role mappings, and marks the user as provisioned
+func (db *DB) provisionUser(user User) (int, error) {
+	existing, err := db.GetUserByUsername(user.Username)
+	switch {
+	case err == sql.ErrNoRows:
+		user.ID, err = db.CreateUser(user)
+	case err != nil:
+		return 0, err
+	default:
+		user.ID = existing.ID
+		user.APIKey = ""
+		err = db.updateUser(user)
+	}
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	_, err = db.Exec(provisionUserSQL, true, time.Now().UTC(), user.ID)
+	if err != nil {
+		log.Printf("Error provisioning user %v: %v\n", user.Username, err)
+	}
+	return user.ID, err
+}
+
+// DeprovisionUser removes the access of a provisioned user: the user's role, accounts, API key,
+// personal access tokens and sessions are removed, and the user can no longer log in
+func (db *DB) DeprovisionUser(userID int) error {
+	return db.transaction(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(deprovisionUserSQL, Invalid, userID); err != nil {
+			log.Printf("Error deprovisioning user %v: %v\n", userID, err)
+			return err
+		}
+
+		if _, err := tx.Exec(deleteUserAccountsSQL, userID); err != nil {
+			log.Printf("Error deleting user accounts: %v", err)
+			return err
+		}
+
+		if _, err := tx.Exec(disableUserTokensSQL, false, userID); err != nil {
+			log.Printf("Error disabling the personal access tokens of user %v: %v\n", userID, err)
+			return err
+		}
+
+		if _, err := tx.Exec(revokeUserSessionsByIDSQL, userID); err != nil {
+			log.Printf("Error revoking the sessions of user %v: %v\n", userID, err)
+			return err
+		}
+		return nil
+	})
+}
+
+// ResetUserAPIKey generates a new API key for the user. The key is returned, as only its hash is stored
+func (db *DB) ResetUserAPIKey(userID int) (string, error) {
+	apiKey, err := generateAPIKey()
+	if err != nil {
+		return "", errors.New("Error generating random string for the API key")
+	}
+
+	result, err := db.Exec(updateUserAPIKeySQL, HashAPIKey(apiKey), userID)
+	if err != nil {
+		log.Printf("Error resetting the API key of user %d: %v\n", userID, err)
+		return "", err
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return "", fmt.Errorf("cannot find the user %d", userID)
+	}
+
+	return apiKey, nil
 }
 
 // ListUsers returns current available users in database
@@ -221,18 +388,30 @@ func (db *DB) GetUserByUsername(username string) (User, error) {
 	return user, err
 }
 
-// GetUserByAPIKey fetches a single user from database
+// GetUserByAPIKey fetches a single user from database, using the user's API key or one of
+// the user's personal access tokens. The API key and tokens of a provisioned user expire when
+// the user has not logged in recently
 func (db *DB) GetUserByAPIKey(apiKey, username string) (User, error) {
 	if len(apiKey) == 0 || len(username) == 0 {
 		return User{}, errors.New("The 'user' and 'api-key' must be supplied")
 	}
 
-	row := db.QueryRow(getUserByAPIKeySQL, apiKey, username)
+	row := db.QueryRow(getUserByAPIKeySQL, HashAPIKey(apiKey), username)
 	user, err := db.rowToUser(row)
-	if err != nil {
+	if err == sql.ErrNoRows {
+		user, err = db.getUserByToken(apiKey, username)
+	} else if err != nil {
 		log.Printf("Error retrieving user %v: %v\n", username, err)
 	}
-	return user, err
+	if err != nil {
+		return user, err
+	}
+
+	if user.ProvisionExpired(time.Now().UTC()) {
+		log.Printf("Error retrieving user %v: the groups of the provisioned user have expired\n", username)
+		return User{}, errors.New("The API key has expired, as the user has not logged in recently")
+	}
+	return user, nil
 }
 
 // createUser adds a new record to User database table, Returns new record identifier if success
@@ -242,7 +421,7 @@ func (db *DB) createUser(user User) (int, error) {
 
 	err := db.transaction(func(tx *sql.Tx) error {
 
-		err := tx.QueryRow(createUserSQL, user.Username, user.Name, user.Email, user.Role, user.APIKey).Scan(&createdUserID)
+		err := tx.QueryRow(createUserSQL, user.Username, user.Name, user.Email, user.Role, HashAPIKey(user.APIKey)).Scan(&createdUserID)
 		if err != nil {
 			log.Printf("Error creating user %v: %v\n", user.Username, err)
 			return err
@@ -260,17 +439,26 @@ func (db *DB) createUser(user User) (int, error) {
 	return createdUserID, err
 }
 
-// updateUser sets user new values for an existing record. Also updates useraccount link. All that in a transaction
+// updateUser sets user new values for an existing record. Also updates useraccount link. All that in a transaction.
+// The API key is only changed when a new one is supplied
 func (db *DB) updateUser(user User) error {
 
 	return db.transaction(func(tx *sql.Tx) error {
 
-		_, err := tx.Exec(updateUserSQL, user.Username, user.Name, user.Email, user.Role, user.ID, user.APIKey)
+		_, err := tx.Exec(updateUserSQL, user.Username, user.Name, user.Email, user.Role, user.ID)
 		if err != nil {
 			log.Printf("Error updating database user %v: %v\n", user.ID, err)
 			return err
 		}
 
+		if len(user.APIKey) > 0 {
+			_, err = tx.Exec(updateUserAPIKeySQL, HashAPIKey(user.APIKey), user.ID)
+			if err != nil {
+				log.Printf("Error updating database user %v: %v\n", user.ID, err)
+				return err
+			}
+		}
+
 		err = db.putUserAccounts(user.ID, user.Accounts, tx)
 		if err != nil {
 			log.Printf("Error creating user %v: %v\n", user.Username, err)
@@ -281,12 +469,24 @@ func (db *DB) updateUser(user User) error {
 	})
 }
 
-// DeleteUser deletes a user
+// DeleteUser deletes a user, revoking the user's sessions
 func (db *DB) DeleteUser(userID int) error {
 
 	return db.transaction(func(tx *sql.Tx) error {
 
-		_, err := tx.Exec(deleteUserSQL, userID)
+		_, err := tx.Exec(revokeUserSessionsByIDSQL, userID)
+		if err != nil {
+			log.Printf("Error revoking the sessions of user %v: %v\n", userID, err)
+			return err
+		}
+
+		_, err = tx.Exec(deleteUserPermissionsSQL, userID)
+		if err != nil {
+			log.Printf("Error deleting the account permissions of user %v: %v\n", userID, err)
+			return err
+		}
+
+		_, err = tx.Exec(deleteUserSQL, userID)
 		if err != nil {
 			log.Printf("Error deleting database user %v: %v\n", userID, err)
 			return err
@@ -315,10 +515,12 @@ func (db *DB) ListAccountUsers(authorityID string) ([]User, error) {
 
 	for rows.Next() {
 		user := User{}
-		err := rows.Scan(&user.ID, &user.Username, &user.Name, &user.Email, &user.Role, &user.APIKey)
+		var provisionedAt sql.NullTime
+		err := rows.Scan(&user.ID, &user.Username, &user.Name, &user.Email, &user.Role, &user.Provisioned, &provisionedAt)
 		if err != nil {
 			return nil, err
 		}
+		user.ProvisionedAt = provisionedAt.Time
 		users = append(users, user)
 	}
 
@@ -375,10 +577,12 @@ func (db *DB) putUserAccounts(userID int, accounts []Account, tx *sql.Tx) error
 
 func (db *DB) rowToUser(row *sql.Row) (User, error) {
 	user := User{}
-	err := row.Scan(&user.ID, &user.Username, &user.Name, &user.Email, &user.Role, &user.APIKey)
+	var provisionedAt sql.NullTime
+	err := row.Scan(&user.ID, &user.Username, &user.Name, &user.Email, &user.Role, &user.Provisioned, &provisionedAt)
 	if err != nil {
 		return User{}, err
 	}
+	user.ProvisionedAt = provisionedAt.Time
 
 	// Get related accounts and fill related User field
 	user.Accounts, err = db.listAccountsFilteredByUser(user.Username)
@@ -391,11 +595,13 @@ func (db *DB) rowToUser(row *sql.Row) (User, error) {
 
 func (db *DB) rowsToUser(rows *sql.Rows) (User, error) {
 	user := User{}
-	err := rows.Scan(&user.ID, &user.Username, &user.Name, &user.Email, &user.Role, &user.APIKey)
+	var provisionedAt sql.NullTime
+	err := rows.Scan(&user.ID, &user.Username, &user.Name, &user.Email, &user.Role, &user.Provisioned, &provisionedAt)
 	if err != nil {
 		log.Printf("Error scanning user fields: %v", err)
 		return User{}, err
 	}
+	user.ProvisionedAt = provisionedAt.Time
 
 	// Get related accounts and fill related User field
 	user.Accounts, err = db.listAccountsFilteredByUser(user.Username)
@@ -0,0 +1,160 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/service/log"
+)
+
+const createUserSessionTableSQL = `
+	CREATE TABLE IF NOT EXISTS usersession (
+		jti       varchar(64) primary key not null,
+		username  varchar(200) not null,
+		created   timestamp not null,
+		expires   timestamp not null,
+		last_seen timestamp not null
+	)
+`
+
+// Indexes
+const createUserSessionUsernameIndexSQL = "CREATE INDEX IF NOT EXISTS usersession_username_idx ON usersession (username)"
+
+const createUserSessionSQL = `
+	insert into usersession (jti, username, created, expires, last_seen)
+	values ($1,$2,$3,$4,$5)`
+
+const deleteExpiredUserSessionsSQL = "delete from usersession where expires<$1"
+
+const getUserSessionSQL = `
+	select jti, username, created, expires, last_seen
+	from usersession
+	where jti=$1 and expires>$2`
+
+const listUserSessionsSQL = `
+	select jti, username, created, expires, last_seen
+	from usersession
+	where username=$1 and expires>$2
+	order by created desc`
+
+const refreshUserSessionSQL = "update usersession set expires=$1, last_seen=$2 where jti=$3"
+
+const revokeUserSessionSQL = "delete from usersession where jti=$1"
+
+const revokeUserSessionsSQL = "delete from usersession where username=$1"
+
+const revokeUserSessionsByIDSQL = "delete from usersession where username in (select username from userinfo where id=$1)"
+
+// UserSession is the server-side record of a login to the admin UI. Each JWT carries the ID of its
+// session, so the JWT is only accepted while its session is active. Removing the session revokes
+// the JWT, and the JWT is refreshed for as long as the session is in use
+type UserSession struct {
+	JTI      string    `json:"jti"`
+	Username string    `json:"username"`
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires"`
+	LastSeen time.Time `json:"last-seen"`
+}
+
+// CreateUserSessionTable creates the database table for the login sessions
+func (db *DB) CreateUserSessionTable() error {
+	_, err := db.Exec(createUserSessionTableSQL)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(createUserSessionUsernameIndexSQL)
+	return err
+}
+
+// CreateUserSession stores a new login session. The sessions that have expired are removed
+func (db *DB) CreateUserSession(session UserSession) error {
+	if _, err := db.Exec(deleteExpiredUserSessionsSQL, time.Now().UTC()); err != nil {
+		log.Printf("Error removing the expired sessions: %v\n", err)
+	}
+
+	_, err := db.Exec(createUserSessionSQL, session.JTI, session.Username, session.Created.UTC(), session.Expires.UTC(), session.LastSeen.UTC())
+	if err != nil {
+		return fmt.Errorf("error creating the session: %v", err)
+	}
+	return nil
+}
+
+// GetUserSession fetches an active session by its ID
+func (db *DB) GetUserSession(jti string) (UserSession, error) {
+	session := UserSession{}
+
+	err := db.QueryRow(getUserSessionSQL, jti, time.Now().UTC()).Scan(&session.JTI, &session.Username, &session.Created, &session.Expires, &session.LastSeen)
+	if err != nil {
+		return session, err
+	}
+	return session, nil
+}
+
+// ListUserSessions lists the active sessions of a user
+func (db *DB) ListUserSessions(username string) ([]UserSession, error) {
+	sessions := []UserSession{}
+
+	rows, err := db.Query(listUserSessionsSQL, username, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving the sessions: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		s := UserSession{}
+		if err := rows.Scan(&s.JTI, &s.Username, &s.Created, &s.Expires, &s.LastSeen); err != nil {
+			return nil, fmt.Errorf("error retrieving the sessions: %v", err)
+		}
+		sessions = append(sessions, s)
+	}
+
+	return sessions, rows.Err()
+}
+
+// RefreshUserSession extends the expiry of an active session
+func (db *DB) RefreshUserSession(jti string, expires time.Time) error {
+	_, err := db.Exec(refreshUserSessionSQL, expires.UTC(), time.Now().UTC(), jti)
+	if err != nil {
+		return fmt.Errorf("error refreshing the session: %v", err)
+	}
+	return nil
+}
+
+// RevokeUserSession removes a session, so its JWT is no longer accepted
+func (db *DB) RevokeUserSession(jti string) error {
+	_, err := db.Exec(revokeUserSessionSQL, jti)
+	if err != nil {
+		return fmt.Errorf("error revoking the session: %v", err)
+	}
+	return nil
+}
+
+// RevokeUserSessions removes all the sessions of a user
+func (db *DB) RevokeUserSessions(username string) error {
+	_, err := db.Exec(revokeUserSessionsSQL, username)
+	if err != nil {
+		return fmt.Errorf("error revoking the sessions of user %s: %v", username, err)
+	}
+	return nil
+}
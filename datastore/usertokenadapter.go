@@ -0,0 +1,89 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errorTokenAuth = errors.New("Personal access tokens need user authentication to be enabled")
+
+// ListAllowedUserTokens returns the personal access tokens of the user
+func (db *DB) ListAllowedUserTokens(authorization User) ([]UserToken, error) {
+	switch authorization.Role {
+	case Standard:
+		fallthrough
+	case SyncUser:
+		fallthrough
+	case Admin:
+		fallthrough
+	case Superuser:
+		return db.listUserTokens(authorization.Username)
+	default:
+		return nil, errorTokenAuth
+	}
+}
+
+// CreateAllowedUserToken creates a personal access token for the user. The token can only be
+// limited to an account that the user can access
+func (db *DB) CreateAllowedUserToken(token UserToken, authorization User) (UserToken, error) {
+	if err := validateUserToken(token); err != nil {
+		return token, err
+	}
+
+	switch authorization.Role {
+	case Standard:
+		fallthrough
+	case SyncUser:
+		fallthrough
+	case Admin:
+		if len(token.AuthorityID) > 0 && !db.CheckUserInAccount(authorization.Username, token.AuthorityID) {
+			return token, fmt.Errorf("You do not have permissions to the account '%s'", token.AuthorityID)
+		}
+		fallthrough
+	case Superuser:
+		user, err := db.GetUserByUsername(authorization.Username)
+		if err != nil {
+			return token, err
+		}
+		token.UserID = user.ID
+		return db.createUserToken(token)
+	default:
+		return token, errorTokenAuth
+	}
+}
+
+// RevokeAllowedUserToken disables a personal access token of the user
+func (db *DB) RevokeAllowedUserToken(tokenID int, authorization User) error {
+	switch authorization.Role {
+	case Standard:
+		fallthrough
+	case SyncUser:
+		fallthrough
+	case Admin:
+		fallthrough
+	case Superuser:
+		return db.revokeUserToken(authorization.Username, tokenID)
+	default:
+		return errorTokenAuth
+	}
+}
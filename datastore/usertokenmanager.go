@@ -0,0 +1,300 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/service/log"
+)
+
+const createUserTokenTableSQL = `
+	CREATE TABLE IF NOT EXISTS usertoken (
+		id           serial primary key not null,
+		user_id      int references userinfo not null,
+		label        varchar(200) not null,
+		token_hash   varchar(64) not null,
+		scopes       varchar(500) not null,
+		authority_id varchar(200) default '',
+		created      timestamp not null,
+		expires      timestamp,
+		last_used    timestamp,
+		enabled      boolean not null
+	)
+`
+
+// Indexes
+const createUserTokenUserIndexSQL = "CREATE INDEX IF NOT EXISTS usertoken_user_idx ON usertoken (user_id)"
+const createUserTokenHashIndexSQL = "CREATE INDEX IF NOT EXISTS usertoken_hash_idx ON usertoken (token_hash)"
+
+const listUserTokensSQL = `
+	select t.id, t.user_id, t.label, t.scopes, t.authority_id, t.created, t.expires, t.last_used, t.enabled
+	from usertoken t
+	inner join userinfo u on u.id=t.user_id
+	where u.username=$1
+	order by t.created desc`
+
+const getUserTokenByHashSQL = `
+	select t.id, t.user_id, t.label, t.scopes, t.authority_id, t.created, t.expires, t.last_used, t.enabled
+	from usertoken t
+	inner join userinfo u on u.id=t.user_id
+	where t.token_hash=$1 and u.username=$2 and t.enabled=$3 and (t.expires is null or t.expires>$4)`
+
+const createUserTokenSQL = `
+	insert into usertoken (user_id, label, token_hash, scopes, authority_id, created, expires, enabled)
+	values ($1,$2,$3,$4,$5,$6,$7,$8) RETURNING id`
+
+// sqlite3 syntax, generating the ID
+const createUserTokenSQLite = `
+	insert into usertoken (id, user_id, label, token_hash, scopes, authority_id, created, expires, enabled)
+	values ((select coalesce(max(id), 0)+1 from usertoken), $1,$2,$3,$4,$5,$6,$7,$8)`
+const lastUserTokenIDSQLite = "select max(id) from usertoken where user_id=$1"
+
+const revokeUserTokenSQL = `
+	update usertoken set enabled=$1
+	where id=$2 and user_id in (select id from userinfo where username=$3)`
+
+const updateUserTokenLastUsedSQL = "update usertoken set last_used=$1 where id=$2"
+
+// ScopeSync is the scope of a personal access token that gives access to the factory sync API
+const ScopeSync = "sync"
+
+// TokenScopeAreas are the areas of the Admin API that a personal access token can be scoped to. The
+// scope of an area is the area with the read or write access, e.g. 'signinglog:read'. Write access
+// includes read access
+var TokenScopeAreas = []string{"accounts", "assertions", "keypairs", "models", "signinglog", "testlog", "webhooks"}
+
+// Access levels of the token scopes
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// UserToken is a personal access token of a user. It is used in place of the user's API key,
+// limited to its scopes and, optionally, to a single account. Only the hash of the token is
+// stored: the token itself is returned once, when it is created
+type UserToken struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"user-id"`
+	Label       string     `json:"label"`
+	Token       string     `json:"token,omitempty"`
+	Scopes      []string   `json:"scopes"`
+	AuthorityID string     `json:"authority-id"`
+	Created     time.Time  `json:"created"`
+	Expires     *time.Time `json:"expires"`
+	LastUsed    *time.Time `json:"last-used"`
+	Enabled     bool       `json:"enabled"`
+}
+
+// HasScope checks whether the token gives access to an area of the Admin API
+func (t UserToken) HasScope(area string, write bool) bool {
+	for _, s := range t.Scopes {
+		if s == area+":"+ScopeWrite || (!write && s == area+":"+ScopeRead) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasSyncScope checks whether the token gives access to the factory sync API
+func (t UserToken) HasSyncScope() bool {
+	for _, s := range t.Scopes {
+		if s == ScopeSync {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateUserTokenTable creates the database table for the personal access tokens
+func (db *DB) CreateUserTokenTable() error {
+	_, err := db.Exec(createUserTokenTableSQL)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(createUserTokenUserIndexSQL)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(createUserTokenHashIndexSQL)
+	return err
+}
+
+func (db *DB) listUserTokens(username string) ([]UserToken, error) {
+	tokens := []UserToken{}
+
+	rows, err := db.Query(listUserTokensSQL, username)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving the personal access tokens: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t, err := rowsToUserToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving the personal access tokens: %v", err)
+		}
+		tokens = append(tokens, t)
+	}
+
+	return tokens, rows.Err()
+}
+
+func (db *DB) createUserToken(token UserToken) (UserToken, error) {
+	t, err := generateAPIKey()
+	if err != nil {
+		return token, errors.New("Error generating random string for the token")
+	}
+
+	token.Token = t
+	token.Created = time.Now().UTC()
+	token.Enabled = true
+	token.LastUsed = nil
+	scopes := strings.Join(token.Scopes, ",")
+
+	if InFactory() {
+		err = db.transaction(func(tx *sql.Tx) error {
+			_, err := tx.Exec(createUserTokenSQLite, token.UserID, token.Label, HashAPIKey(t), scopes, token.AuthorityID, token.Created, token.Expires, token.Enabled)
+			if err != nil {
+				return err
+			}
+			return tx.QueryRow(lastUserTokenIDSQLite, token.UserID).Scan(&token.ID)
+		})
+	} else {
+		err = db.QueryRow(createUserTokenSQL, token.UserID, token.Label, HashAPIKey(t), scopes, token.AuthorityID, token.Created, token.Expires, token.Enabled).Scan(&token.ID)
+	}
+	if err != nil {
+		return token, fmt.Errorf("error creating the personal access token: %v", err)
+	}
+
+	return token, nil
+}
+
+func (db *DB) revokeUserToken(username string, tokenID int) error {
+	result, err := db.Exec(revokeUserTokenSQL, false, tokenID, username)
+	if err != nil {
+		return fmt.Errorf("error revoking the personal access token: %v", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error revoking the personal access token: %v", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("cannot find the personal access token %d", tokenID)
+	}
+	return nil
+}
+
+// getUserByToken fetches the user of an enabled, unexpired personal access token, and records when
+// the token was used
+func (db *DB) getUserByToken(token, username string) (User, error) {
+	now := time.Now().UTC()
+
+	rows, err := db.Query(getUserTokenByHashSQL, HashAPIKey(token), username, true, now)
+	if err != nil {
+		log.Printf("Error retrieving the personal access token of user %v: %v\n", username, err)
+		return User{}, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		log.Printf("Error retrieving user %v: invalid API key or token\n", username)
+		return User{}, sql.ErrNoRows
+	}
+	t, err := rowsToUserToken(rows)
+	if err != nil {
+		log.Printf("Error retrieving the personal access token of user %v: %v\n", username, err)
+		return User{}, err
+	}
+	rows.Close()
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		return User{}, err
+	}
+
+	if _, err := db.Exec(updateUserTokenLastUsedSQL, now, t.ID); err != nil {
+		log.Printf("Error updating the personal access token %d: %v\n", t.ID, err)
+	}
+
+	user.Token = &t
+	return user, nil
+}
+
+func rowsToUserToken(rows *sql.Rows) (UserToken, error) {
+	t := UserToken{}
+	var scopes string
+	var expires, lastUsed sql.NullTime
+
+	err := rows.Scan(&t.ID, &t.UserID, &t.Label, &scopes, &t.AuthorityID, &t.Created, &expires, &lastUsed, &t.Enabled)
+	if err != nil {
+		return t, err
+	}
+
+	t.Scopes = strings.Split(scopes, ",")
+	t.Expires = timePointer(expires)
+	t.LastUsed = timePointer(lastUsed)
+	return t, nil
+}
+
+// ValidTokenScope checks that the scope is one of the scopes of the personal access tokens
+func ValidTokenScope(scope string) bool {
+	if scope == ScopeSync {
+		return true
+	}
+
+	for _, area := range TokenScopeAreas {
+		if scope == area+":"+ScopeRead || scope == area+":"+ScopeWrite {
+			return true
+		}
+	}
+	return false
+}
+
+func validateUserToken(token UserToken) error {
+	if len(strings.TrimSpace(token.Label)) == 0 {
+		return errors.New("the label of the token must be entered")
+	}
+	if len(token.Label) > 200 {
+		return errors.New("the label of the token must be 200 characters or less")
+	}
+
+	if len(token.Scopes) == 0 {
+		return errors.New("the token must have at least one scope")
+	}
+	for _, s := range token.Scopes {
+		if !ValidTokenScope(s) {
+			return fmt.Errorf("the scope '%s' is invalid", s)
+		}
+	}
+
+	if token.Expires != nil && !token.Expires.After(time.Now()) {
+		return errors.New("the expiry time of the token must be in the future")
+	}
+	return nil
+}
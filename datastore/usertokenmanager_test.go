@@ -0,0 +1,82 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package datastore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserTokenHasScope(t *testing.T) {
+	token := UserToken{Scopes: []string{"signinglog:read", "models:write", ScopeSync}}
+
+	tests := []struct {
+		area  string
+		write bool
+		want  bool
+	}{
+		{"signinglog", false, true},
+		{"signinglog", true, false},
+		{"models", false, true},
+		{"models", true, true},
+		{"keypairs", false, false},
+	}
+
+	for _, tt := range tests {
+		if got := token.HasScope(tt.area, tt.write); got != tt.want {
+			t.Errorf("HasScope(%s, %v) = %v, want %v", tt.area, tt.write, got, tt.want)
+		}
+	}
+
+	if !token.HasSyncScope() {
+		t.Error("Expected the token to have the sync scope")
+	}
+	if (UserToken{Scopes: []string{"signinglog:read"}}).HasSyncScope() {
+		t.Error("Expected the token not to have the sync scope")
+	}
+}
+
+func TestValidateUserToken(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		token UserToken
+		valid bool
+	}{
+		{UserToken{Label: "ci-logs", Scopes: []string{"signinglog:read"}}, true},
+		{UserToken{Label: "factory", Scopes: []string{ScopeSync}, Expires: &future}, true},
+		{UserToken{Label: "ci-logs", Scopes: []string{"signinglog:read"}, Expires: &past}, false},
+		{UserToken{Label: "ci-logs"}, false},
+		{UserToken{Label: "ci-logs", Scopes: []string{"signinglog:delete"}}, false},
+		{UserToken{Label: "ci-logs", Scopes: []string{"users:read"}}, false},
+		{UserToken{Label: " ", Scopes: []string{"signinglog:read"}}, false},
+	}
+
+	for _, tt := range tests {
+		err := validateUserToken(tt.token)
+		if tt.valid && err != nil {
+			t.Errorf("Expected the token to be valid: %v", err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("Expected the token to be invalid: %v", tt.token)
+		}
+	}
+}
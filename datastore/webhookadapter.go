@@ -0,0 +1,141 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errorWebhookAuth = errors.New("Your user does not have permissions for the webhooks")
+
+// ListAllowedWebhooks returns the webhooks of the accounts that the user can access
+func (db *DB) ListAllowedWebhooks(authorization User) ([]Webhook, error) {
+	switch authorization.Role {
+	case Invalid: // Authentication is disabled
+		fallthrough
+	case Superuser:
+		return db.listWebhooksQuery(listWebhooksSQL)
+	case Admin:
+		return db.listWebhooksQuery(listWebhooksForUserSQL, authorization.Username)
+	default:
+		return nil, errorWebhookAuth
+	}
+}
+
+// GetAllowedWebhook returns a webhook, if the user can access its account
+func (db *DB) GetAllowedWebhook(webhookID int, authorization User) (Webhook, error) {
+	webhook, err := db.getWebhook(webhookID)
+	if err != nil {
+		return webhook, err
+	}
+
+	if err := db.checkWebhookAccount(webhook.AuthorityID, authorization); err != nil {
+		return Webhook{}, err
+	}
+	return webhook, nil
+}
+
+// CreateAllowedWebhook creates a webhook for an account that the user can access. The webhook
+// holds the generated secret, which is not returned again
+func (db *DB) CreateAllowedWebhook(webhook Webhook, authorization User) (Webhook, error) {
+	if err := validateWebhook(webhook); err != nil {
+		return webhook, err
+	}
+
+	if err := db.checkWebhookAccount(webhook.AuthorityID, authorization); err != nil {
+		return webhook, err
+	}
+	if err := db.checkWebhookEvents(webhook, authorization); err != nil {
+		return webhook, err
+	}
+
+	webhook.Active = true
+	return db.createWebhook(webhook)
+}
+
+// UpdateAllowedWebhook updates the URL, events and state of a webhook. The account of the webhook
+// cannot be changed
+func (db *DB) UpdateAllowedWebhook(webhook Webhook, authorization User) error {
+	existing, err := db.GetAllowedWebhook(webhook.ID, authorization)
+	if err != nil {
+		return err
+	}
+
+	webhook.AuthorityID = existing.AuthorityID
+	if err := validateWebhook(webhook); err != nil {
+		return err
+	}
+	if err := db.checkWebhookEvents(webhook, authorization); err != nil {
+		return err
+	}
+	return db.updateWebhook(webhook)
+}
+
+// DeleteAllowedWebhook removes a webhook and its deliveries
+func (db *DB) DeleteAllowedWebhook(webhookID int, authorization User) error {
+	if _, err := db.GetAllowedWebhook(webhookID, authorization); err != nil {
+		return err
+	}
+	return db.deleteWebhook(webhookID)
+}
+
+// ListAllowedWebhookDeliveries returns the latest deliveries of a webhook
+func (db *DB) ListAllowedWebhookDeliveries(webhookID int, authorization User) ([]WebhookDelivery, error) {
+	if _, err := db.GetAllowedWebhook(webhookID, authorization); err != nil {
+		return nil, err
+	}
+	return db.listWebhookDeliveries(webhookID)
+}
+
+// RetryAllowedWebhookDelivery queues a delivery of a webhook to be attempted again
+func (db *DB) RetryAllowedWebhookDelivery(webhookID, deliveryID int, authorization User) error {
+	if _, err := db.GetAllowedWebhook(webhookID, authorization); err != nil {
+		return err
+	}
+	return db.retryWebhookDelivery(webhookID, deliveryID)
+}
+
+// checkWebhookAccount checks that the user can manage the webhooks of an account
+func (db *DB) checkWebhookAccount(authorityID string, authorization User) error {
+	switch authorization.Role {
+	case Invalid: // Authentication is disabled
+		fallthrough
+	case Superuser:
+		return nil
+	case Admin:
+		if !db.CheckUserInAccount(authorization.Username, authorityID) {
+			return fmt.Errorf("You do not have permissions to the account '%s'", authorityID)
+		}
+		return nil
+	default:
+		return errorWebhookAuth
+	}
+}
+
+// checkWebhookEvents checks that the user can read the signing logs of the account, when the
+// webhook subscribes to the signing of serials
+func (db *DB) checkWebhookEvents(webhook Webhook, authorization User) error {
+	if webhook.HasEvent(EventSerialSigned) && !db.AllowedPermission(authorization, webhook.AuthorityID, PermissionSigningLogRead) {
+		return errorPermission(webhook.AuthorityID, PermissionSigningLogRead)
+	}
+	return nil
+}
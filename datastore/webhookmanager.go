@@ -0,0 +1,447 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package datastore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const createWebhookTableSQL = `
+	CREATE TABLE IF NOT EXISTS webhook (
+		id           serial primary key not null,
+		authority_id varchar(200) not null,
+		url          text not null,
+		secret       varchar(200) not null,
+		events       text not null,
+		active       boolean not null,
+		created      timestamp not null
+	)
+`
+
+const createWebhookDeliveryTableSQL = `
+	CREATE TABLE IF NOT EXISTS webhookdelivery (
+		id            serial primary key not null,
+		webhook_id    int references webhook not null,
+		event         varchar(200) not null,
+		payload       text not null,
+		status        varchar(20) not null,
+		attempts      int not null,
+		next_attempt  timestamp not null,
+		response_code int not null,
+		last_error    text not null,
+		created       timestamp not null,
+		delivered     timestamp
+	)
+`
+
+// Indexes
+const createWebhookAccountIndexSQL = "CREATE INDEX IF NOT EXISTS webhook_account_idx ON webhook (authority_id)"
+const createWebhookDeliveryWebhookIndexSQL = "CREATE INDEX IF NOT EXISTS webhookdelivery_webhook_idx ON webhookdelivery (webhook_id)"
+const createWebhookDeliveryDueIndexSQL = "CREATE INDEX IF NOT EXISTS webhookdelivery_due_idx ON webhookdelivery (status, next_attempt)"
+
+const listWebhooksSQL = `
+	select id, authority_id, url, events, active, created
+	from webhook
+	order by authority_id, id`
+
+const listWebhooksForUserSQL = `
+	select w.id, w.authority_id, w.url, w.events, w.active, w.created
+	from webhook w
+	inner join account acc on acc.authority_id=w.authority_id
+	inner join useraccountlink ua on ua.account_id=acc.id
+	inner join userinfo u on ua.user_id=u.id
+	where u.username=$1
+	order by w.authority_id, w.id`
+
+const listActiveWebhooksForAccountSQL = `
+	select id, authority_id, url, events, active, created
+	from webhook
+	where authority_id=$1 and active=$2`
+
+const getWebhookSQL = "select id, authority_id, url, events, active, created from webhook where id=$1"
+
+const createWebhookSQL = `
+	insert into webhook (authority_id, url, secret, events, active, created)
+	values ($1,$2,$3,$4,$5,$6) RETURNING id`
+
+// sqlite3 syntax, generating the ID
+const createWebhookSQLite = `
+	insert into webhook (id, authority_id, url, secret, events, active, created)
+	values ((select coalesce(max(id), 0)+1 from webhook), $1,$2,$3,$4,$5,$6)`
+const lastWebhookIDSQLite = "select max(id) from webhook"
+
+const updateWebhookSQL = "update webhook set url=$1, events=$2, active=$3 where id=$4"
+const deleteWebhookSQL = "delete from webhook where id=$1"
+
+const createWebhookDeliverySQL = `
+	insert into webhookdelivery (webhook_id, event, payload, status, attempts, next_attempt, response_code, last_error, created)
+	values ($1,$2,$3,$4,0,$5,0,'',$6)`
+
+// sqlite3 syntax, generating the ID
+const createWebhookDeliverySQLite = `
+	insert into webhookdelivery (id, webhook_id, event, payload, status, attempts, next_attempt, response_code, last_error, created)
+	values ((select coalesce(max(id), 0)+1 from webhookdelivery), $1,$2,$3,$4,0,$5,0,'',$6)`
+
+const listWebhookDeliveriesSQL = `
+	select id, webhook_id, event, payload, status, attempts, next_attempt, response_code, last_error, created, delivered
+	from webhookdelivery
+	where webhook_id=$1
+	order by id desc
+	limit $2`
+
+const listDueWebhookDeliveriesSQL = `
+	select d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.next_attempt, d.response_code, d.last_error, d.created, d.delivered, w.url, w.secret
+	from webhookdelivery d
+	inner join webhook w on w.id=d.webhook_id
+	where d.status=$1 and d.next_attempt<=$2 and w.active=$3
+	order by d.next_attempt
+	limit $4`
+
+// Claims a delivery attempt, so the number of rows affected shows whether another instance of the
+// service has claimed it first
+const claimWebhookDeliverySQL = `
+	update webhookdelivery set attempts=attempts+1, next_attempt=$1
+	where id=$2 and attempts=$3 and status=$4`
+
+const updateWebhookDeliverySQL = `
+	update webhookdelivery set status=$1, response_code=$2, last_error=$3, delivered=$4
+	where id=$5`
+
+const retryWebhookDeliverySQL = `
+	update webhookdelivery set status=$1, attempts=0, next_attempt=$2
+	where id=$3 and webhook_id=$4`
+
+const deleteWebhookDeliveriesSQL = "delete from webhookdelivery where webhook_id=$1"
+
+// Events that are sent to the webhooks
+const (
+	EventSerialSigned     = "serial:signed"
+	EventSystemUserIssued = "systemuser:issued"
+	EventPivotPerformed   = "pivot:performed"
+	EventKeypairGenerated = "keypair:generated"
+	EventKeypairDisabled  = "keypair:disabled"
+	EventSyncReceived     = "sync:received"
+)
+
+// WebhookEvents are the events that a webhook can subscribe to
+var WebhookEvents = []string{EventSerialSigned, EventSystemUserIssued, EventPivotPerformed, EventKeypairGenerated, EventKeypairDisabled, EventSyncReceived}
+
+// Status of the delivery of an event to a webhook
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed"
+)
+
+// WebhookDeliveryListLimit is the number of the latest deliveries that are listed for a webhook
+const WebhookDeliveryListLimit = 100
+
+// Webhook is the subscription of a URL to the events of an account. The events are sent as JSON,
+// signed with the secret of the webhook, which is only returned when the webhook is created
+type Webhook struct {
+	ID          int       `json:"id"`
+	AuthorityID string    `json:"authority-id"`
+	URL         string    `json:"url"`
+	Secret      string    `json:"secret,omitempty"`
+	Events      []string  `json:"events"`
+	Active      bool      `json:"active"`
+	Created     time.Time `json:"created"`
+}
+
+// HasEvent checks whether the webhook subscribes to an event
+func (w Webhook) HasEvent(event string) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is the delivery of an event to a webhook. A pending delivery is attempted until
+// it is delivered or it fails too many times. The URL and secret of the webhook are only fetched
+// for the deliveries that are due
+type WebhookDelivery struct {
+	ID           int        `json:"id"`
+	WebhookID    int        `json:"webhook-id"`
+	Event        string     `json:"event"`
+	Payload      string     `json:"payload"`
+	Status       string     `json:"status"`
+	Attempts     int        `json:"attempts"`
+	NextAttempt  time.Time  `json:"next-attempt"`
+	ResponseCode int        `json:"response-code"`
+	LastError    string     `json:"last-error"`
+	Created      time.Time  `json:"created"`
+	Delivered    *time.Time `json:"delivered"`
+	URL          string     `json:"-"`
+	Secret       string     `json:"-"`
+}
+
+// CreateWebhookTable creates the database tables for the webhooks and their deliveries
+func (db *DB) CreateWebhookTable() error {
+	for _, s := range []string{createWebhookTableSQL, createWebhookDeliveryTableSQL, createWebhookAccountIndexSQL,
+		createWebhookDeliveryWebhookIndexSQL, createWebhookDeliveryDueIndexSQL} {
+		if _, err := db.Exec(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QueueWebhookEvent queues the delivery of an event to the active webhooks of an account that
+// subscribe to it
+func (db *DB) QueueWebhookEvent(authorityID, event, payload string) error {
+	webhooks, err := db.listWebhooksQuery(listActiveWebhooksForAccountSQL, authorityID, true)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	return db.transaction(func(tx *sql.Tx) error {
+		for _, w := range webhooks {
+			if !w.HasEvent(event) {
+				continue
+			}
+
+			s := createWebhookDeliverySQL
+			if InFactory() {
+				s = createWebhookDeliverySQLite
+			}
+			if _, err := tx.Exec(s, w.ID, event, payload, WebhookPending, now, now); err != nil {
+				return fmt.Errorf("error queuing the webhook delivery: %v", err)
+			}
+		}
+		return nil
+	})
+}
+
+// ListDueWebhookDeliveries returns the pending deliveries that are due to be attempted, with the
+// URL and secret of their webhooks
+func (db *DB) ListDueWebhookDeliveries(limit int) ([]WebhookDelivery, error) {
+	rows, err := db.Query(listDueWebhookDeliveriesSQL, WebhookPending, time.Now().UTC(), true, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving the webhook deliveries: %v", err)
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		d, err := rowsToWebhookDelivery(rows, true)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving the webhook deliveries: %v", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// ClaimWebhookDelivery records an attempt of a delivery and when it is to be attempted next, if it
+// fails. It returns false if the attempt has already been claimed
+func (db *DB) ClaimWebhookDelivery(delivery WebhookDelivery, nextAttempt time.Time) (bool, error) {
+	result, err := db.Exec(claimWebhookDeliverySQL, nextAttempt, delivery.ID, delivery.Attempts, WebhookPending)
+	if err != nil {
+		return false, fmt.Errorf("error claiming the webhook delivery: %v", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error claiming the webhook delivery: %v", err)
+	}
+	return rows == 1, nil
+}
+
+// UpdateWebhookDelivery records the result of a delivery attempt
+func (db *DB) UpdateWebhookDelivery(delivery WebhookDelivery) error {
+	_, err := db.Exec(updateWebhookDeliverySQL, delivery.Status, delivery.ResponseCode, delivery.LastError, delivery.Delivered, delivery.ID)
+	if err != nil {
+		return fmt.Errorf("error updating the webhook delivery: %v", err)
+	}
+	return nil
+}
+
+func (db *DB) listWebhooksQuery(query string, args ...interface{}) ([]Webhook, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving the webhooks: %v", err)
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		w := Webhook{}
+		var events string
+		if err := rows.Scan(&w.ID, &w.AuthorityID, &w.URL, &events, &w.Active, &w.Created); err != nil {
+			return nil, fmt.Errorf("error retrieving the webhooks: %v", err)
+		}
+		w.Events = strings.Split(events, ",")
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+func (db *DB) getWebhook(webhookID int) (Webhook, error) {
+	webhooks, err := db.listWebhooksQuery(getWebhookSQL, webhookID)
+	if err != nil {
+		return Webhook{}, err
+	}
+	if len(webhooks) == 0 {
+		return Webhook{}, fmt.Errorf("cannot find the webhook %d", webhookID)
+	}
+	return webhooks[0], nil
+}
+
+func (db *DB) createWebhook(webhook Webhook) (Webhook, error) {
+	if len(webhook.Secret) == 0 {
+		secret, err := generateAPIKey()
+		if err != nil {
+			return webhook, errors.New("Error generating random string for the webhook secret")
+		}
+		webhook.Secret = secret
+	}
+	webhook.Created = time.Now().UTC()
+	events := strings.Join(webhook.Events, ",")
+
+	var err error
+	if InFactory() {
+		err = db.transaction(func(tx *sql.Tx) error {
+			_, err := tx.Exec(createWebhookSQLite, webhook.AuthorityID, webhook.URL, webhook.Secret, events, webhook.Active, webhook.Created)
+			if err != nil {
+				return err
+			}
+			return tx.QueryRow(lastWebhookIDSQLite).Scan(&webhook.ID)
+		})
+	} else {
+		err = db.QueryRow(createWebhookSQL, webhook.AuthorityID, webhook.URL, webhook.Secret, events, webhook.Active, webhook.Created).Scan(&webhook.ID)
+	}
+	if err != nil {
+		return webhook, fmt.Errorf("error creating the webhook: %v", err)
+	}
+	return webhook, nil
+}
+
+func (db *DB) updateWebhook(webhook Webhook) error {
+	_, err := db.Exec(updateWebhookSQL, webhook.URL, strings.Join(webhook.Events, ","), webhook.Active, webhook.ID)
+	if err != nil {
+		return fmt.Errorf("error updating the webhook: %v", err)
+	}
+	return nil
+}
+
+// deleteWebhook removes a webhook along with its deliveries
+func (db *DB) deleteWebhook(webhookID int) error {
+	return db.transaction(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(deleteWebhookDeliveriesSQL, webhookID); err != nil {
+			return fmt.Errorf("error deleting the webhook deliveries: %v", err)
+		}
+		if _, err := tx.Exec(deleteWebhookSQL, webhookID); err != nil {
+			return fmt.Errorf("error deleting the webhook: %v", err)
+		}
+		return nil
+	})
+}
+
+func (db *DB) listWebhookDeliveries(webhookID int) ([]WebhookDelivery, error) {
+	rows, err := db.Query(listWebhookDeliveriesSQL, webhookID, WebhookDeliveryListLimit)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving the webhook deliveries: %v", err)
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		d, err := rowsToWebhookDelivery(rows, false)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving the webhook deliveries: %v", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// retryWebhookDelivery queues a delivery to be attempted again now, e.g. once it has failed
+func (db *DB) retryWebhookDelivery(webhookID, deliveryID int) error {
+	result, err := db.Exec(retryWebhookDeliverySQL, WebhookPending, time.Now().UTC(), deliveryID, webhookID)
+	if err != nil {
+		return fmt.Errorf("error retrying the webhook delivery: %v", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error retrying the webhook delivery: %v", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("cannot find the webhook delivery %d", deliveryID)
+	}
+	return nil
+}
+
+func rowsToWebhookDelivery(rows *sql.Rows, withWebhook bool) (WebhookDelivery, error) {
+	d := WebhookDelivery{}
+	var delivered sql.NullTime
+
+	fields := []interface{}{&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.NextAttempt,
+		&d.ResponseCode, &d.LastError, &d.Created, &delivered}
+	if withWebhook {
+		fields = append(fields, &d.URL, &d.Secret)
+	}
+
+	if err := rows.Scan(fields...); err != nil {
+		return d, err
+	}
+	d.Delivered = timePointer(delivered)
+	return d, nil
+}
+
+// validateWebhook checks the URL, account and events of a webhook
+func validateWebhook(webhook Webhook) error {
+	if len(strings.TrimSpace(webhook.AuthorityID)) == 0 {
+		return errors.New("The account of the webhook must be supplied")
+	}
+
+	u, err := url.Parse(webhook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return errors.New("The URL of the webhook must be an http or https URL")
+	}
+
+	if len(webhook.Events) == 0 {
+		return errors.New("The webhook must subscribe to at least one event")
+	}
+	for _, e := range webhook.Events {
+		if !validWebhookEvent(e) {
+			return fmt.Errorf("Invalid webhook event '%s'", e)
+		}
+	}
+	return nil
+}
+
+func validWebhookEvent(event string) bool {
+	for _, e := range WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
@@ -21,6 +21,7 @@ require (
 	github.com/lib/pq v0.0.0-20180327071824-d34b9ff171c2
 	github.com/mattn/go-sqlite3 v1.6.0
 	github.com/mediocregopher/mediocre-go-lib v0.0.0-20181029021733-cb65787f37ed // indirect
+	github.com/miekg/pkcs11 v1.0.3
 	github.com/ojii/gettext.go v0.0.0-20170120061437-b6dae1d7af8a // indirect
 	github.com/op/go-logging v0.0.0-20160315200505-970db520ece7
 	github.com/prometheus/client_golang v1.1.0
@@ -114,6 +114,15 @@ func UpdateDatabase() {
 		// Update the User table, removing not needed openid_identity field
 		{datastore.Environ.DB.AlterUserTable, update, "userinfo", true},
 
+		// Update the User table, replacing the API keys with their hashes
+		{datastore.Environ.DB.HashUserAPIKeys, update, "userinfo api key", false},
+
+		// Update the User table, adding the provisioned field
+		{datastore.Environ.DB.AlterUserProvisioned, update, "userinfo provisioned", false},
+
+		// Update the User table, adding the OpenID Connect identity field
+		{datastore.Environ.DB.AlterUserOIDCIdentity, update, "userinfo oidc identity", false},
+
 		// Create the Keypair Status table, if it does not exist, and add indexes
 		{datastore.Environ.DB.CreateKeypairStatusTable, create, "keypair status", false},
 		{datastore.Environ.DB.AlterKeypairStatusTable, update, "keypair status", false},
@@ -127,6 +136,45 @@ func UpdateDatabase() {
 
 		// Create the testlog table, if it does not exist
 		{datastore.Environ.DB.CreateTestLogTable, create, "testlog", false},
+
+		// Create the key rotation table, if it does not exist
+		{datastore.Environ.DB.CreateKeyRotationTable, create, "key rotation", false},
+
+		// Create the serial number allowlist table, if it does not exist
+		{datastore.Environ.DB.CreateSerialAllowlistTable, create, "serial allowlist", false},
+
+		// Create the serial revocation table, if it does not exist
+		{datastore.Environ.DB.CreateSerialRevocationTable, create, "serial revocation", false},
+
+		// Create the remodel rule and history tables, if they do not exist
+		{datastore.Environ.DB.CreateRemodelRuleTable, create, "remodel rule", true},
+		{datastore.Environ.DB.CreateRemodelHistoryTable, create, "remodel history", true},
+
+		// Create the model quota and usage tables, if they do not exist
+		{datastore.Environ.DB.CreateModelQuotaTable, create, "model quota", false},
+		{datastore.Environ.DB.CreateModelUsageTable, create, "model usage", false},
+
+		// Create the model API key table, if it does not exist, and replace the models' own API
+		// keys with named keys. The factory syncs the named keys from the cloud
+		{datastore.Environ.DB.CreateModelAPIKeyTable, create, "model api key", false},
+		{datastore.Environ.DB.HashModelAPIKeys, update, "model api key", true},
+
+		// Create the personal access token table, if it does not exist
+		{datastore.Environ.DB.CreateUserTokenTable, create, "user token", false},
+
+		// Create the login session table, if it does not exist
+		{datastore.Environ.DB.CreateUserSessionTable, create, "user session", false},
+
+		// Create the account permission table, if it does not exist
+		{datastore.Environ.DB.CreateAccountPermissionTable, create, "account permission", false},
+
+		// Create the append-only audit log table, if it does not exist
+		{datastore.Environ.DB.CreateAuditLogTable, create, "audit log", false},
+		{datastore.Environ.DB.CreateAuditLogRules, create, "audit log rules", true},
+		{datastore.Environ.DB.CreateWebhookTable, create, "webhook", false},
+
+		// Create the signing log archive and its duplicate-detection index, if they do not exist
+		{datastore.Environ.DB.CreateSigningLogArchiveTable, create, "signing log archive", false},
 	}
 
 	exec(operations)
@@ -137,6 +185,16 @@ func UpdateDatabase() {
 		datastore.Environ.DB.PutKeypair(datastore.Keypair{AuthorityID: "System", KeyID: "61abf588e52be7a3"})
 	}
 
+	// Re-seal the signing-keys that are stored using the legacy format
+	if datastore.Environ.Config.KeyStoreType == datastore.DatabaseStore.Name || datastore.Environ.Config.KeyStoreType == datastore.TPM20Store.Name {
+		count, err := datastore.MigrateSealedKeypairs()
+		if err != nil {
+			log.Fatal(err)
+		} else {
+			fmt.Printf("Re-sealed %d signing-keys.\n", count)
+		}
+	}
+
 	// Initialize the TPM store, authenticating with the TPM 2.0 module
 	if datastore.Environ.Config.KeyStoreType == datastore.TPM20Store.Name {
 		fmt.Println("Initialize the TPM2.0 store")
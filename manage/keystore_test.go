@@ -0,0 +1,76 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package manage
+
+import (
+	"errors"
+
+	"github.com/CanonicalLtd/serial-vault/config"
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"gopkg.in/check.v1"
+)
+
+type KeystoreSuite struct {
+	secret string
+	err    error
+}
+
+var _ = check.Suite(&KeystoreSuite{})
+
+func (s *KeystoreSuite) SetUpTest(c *check.C) {
+	config := config.Settings{KeyStoreType: "database", KeyStoreSecret: "secret code to encrypt the auth-key hash"}
+	datastore.Environ = &datastore.Env{DB: &datastore.MockDB{}, Config: config}
+
+	s.secret = "a new secret"
+	s.err = nil
+	readSecret = func() (string, error) { return s.secret, s.err }
+}
+
+func (s *KeystoreSuite) TestKeystore(c *check.C) {
+	tests := []struct {
+		Args         []string
+		Secret       string
+		Err          error
+		ErrorMessage string
+	}{
+		{[]string{"serial-vault-admin", "keystore"}, "a new secret", nil, "Please specify the rotate-secret command"},
+		{[]string{"serial-vault-admin", "keystore", "rotate-secret", "-s", "a new secret"}, "a new secret", nil, "unknown flag `s'"},
+		{[]string{"serial-vault-admin", "keystore", "rotate-secret"}, "", errors.New("the secrets do not match"), "Error reading the new keystore secret: the secrets do not match"},
+		{[]string{"serial-vault-admin", "keystore", "rotate-secret"}, "", nil, "The new keystore secret must not be empty"},
+		{[]string{"serial-vault-admin", "keystore", "rotate-secret"}, "secret code to encrypt the auth-key hash", nil, "The new keystore secret must be different to the current one"},
+		{[]string{"serial-vault-admin", "keystore", "rotate-secret"}, "a new secret", nil, ""},
+	}
+
+	for _, t := range tests {
+		s.secret = t.Secret
+		s.err = t.Err
+		runTest(c, t.Args, t.ErrorMessage)
+	}
+}
+
+func (s *KeystoreSuite) TestKeystoreError(c *check.C) {
+	datastore.Environ.DB = &datastore.ErrorMockDB{}
+	runTest(c, []string{"serial-vault-admin", "keystore", "rotate-secret"}, "Error rotating the keystore secret: .*")
+}
+
+func (s *KeystoreSuite) TestKeystoreInvalidType(c *check.C) {
+	datastore.Environ.Config.KeyStoreType = "filesystem"
+	runTest(c, []string{"serial-vault-admin", "keystore", "rotate-secret"}, "The 'filesystem' keystore does not use .*")
+}
@@ -0,0 +1,98 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package manage
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// KeystoreRotateSecretCommand handles re-encrypting the signing-keys using a new keystore secret.
+// The new secret is read from the standard input, so it is not kept in the shell history or shown
+// in the process list
+type KeystoreRotateSecretCommand struct{}
+
+// readSecret reads the new keystore secret: from a prompt that does not echo it when the standard
+// input is a terminal, otherwise from the first line of the standard input
+var readSecret = func() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && len(line) == 0 {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprint(os.Stderr, "New keystore secret: ")
+	secret, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprint(os.Stderr, "Confirm the new keystore secret: ")
+	confirm, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if string(secret) != string(confirm) {
+		return "", errors.New("the secrets do not match")
+	}
+	return string(secret), nil
+}
+
+// Execute the rotation of the keystore secret
+func (cmd KeystoreRotateSecretCommand) Execute(args []string) error {
+
+	openDatabase()
+
+	keystoreType := datastore.Environ.Config.KeyStoreType
+	if keystoreType != datastore.DatabaseStore.Name && keystoreType != datastore.TPM20Store.Name {
+		return fmt.Errorf("The '%s' keystore does not use the keystore secret to seal the signing-keys", keystoreType)
+	}
+
+	newSecret, err := readSecret()
+	if err != nil {
+		return fmt.Errorf("Error reading the new keystore secret: %v", err)
+	}
+	if len(newSecret) == 0 {
+		return fmt.Errorf("The new keystore secret must not be empty")
+	}
+
+	if newSecret == datastore.Environ.Config.KeyStoreSecret {
+		return fmt.Errorf("The new keystore secret must be different to the current one")
+	}
+
+	count, err := datastore.RotateKeystoreSecret(newSecret)
+	if err != nil {
+		return fmt.Errorf("Error rotating the keystore secret: %v", err)
+	}
+
+	fmt.Printf("Re-sealed %d signing-keys using the new secret.\n", count)
+	fmt.Println("Update the keystoreSecret in the config file and restart the services.")
+	return nil
+}
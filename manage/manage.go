@@ -28,10 +28,14 @@ import (
 type Command struct {
 	SettingsFile string `short:"c" long:"config" description:"Path to the config file" default:"./settings.yaml"`
 
-	Account  AccountCommand  `command:"account" alias:"a" description:"Account management"`
-	Client   ClientCommand   `command:"client" alias:"c" description:"Serial-Vault Client to generate a test serial assertion request"`
-	Database DatabaseCommand `command:"database" alias:"d" description:"Database schema update"`
-	User     UserCommand     `command:"user" alias:"u" description:"User management"`
+	Account    AccountCommand    `command:"account" alias:"a" description:"Account management"`
+	Client     ClientCommand     `command:"client" alias:"c" description:"Serial-Vault Client to generate a test serial assertion request"`
+	Database   DatabaseCommand   `command:"database" alias:"d" description:"Database schema update"`
+	Keystore   KeystoreCommand   `command:"keystore" alias:"k" description:"Signing-key store management"`
+	Report     ReportCommand     `command:"report" alias:"r" description:"Signing statistics report"`
+	Serial     SerialCommand     `command:"serial" alias:"s" description:"Serial assertion management"`
+	SigningLog SigningLogCommand `command:"signinglog" alias:"l" description:"Signing log management"`
+	User       UserCommand       `command:"user" alias:"u" description:"User management"`
 }
 
 // Manage is the implementation of the command configuration for the serial-vault-admin command-line
@@ -0,0 +1,114 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package manage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/report"
+	"github.com/CanonicalLtd/serial-vault/service/signinglog"
+)
+
+// ReportCommand handles the signing report for the serial-vault-admin command
+type ReportCommand struct {
+	Period string `short:"p" long:"period" description:"The period of the report" choice:"day" choice:"week" choice:"month" default:"day"`
+	Brand  string `short:"b" long:"brand" description:"The brand-id of the account (all accounts when not set)"`
+	Model  string `short:"m" long:"model" description:"The model name (all models when not set)"`
+	From   string `long:"from" description:"The start of the date range (YYYY-MM-DD or RFC3339 time)"`
+	To     string `long:"to" description:"The end of the date range, which is not included (YYYY-MM-DD or RFC3339 time)"`
+	Format string `short:"f" long:"format" description:"The report format" choice:"table" choice:"csv" choice:"json" default:"table"`
+	Output string `short:"o" long:"output" description:"The file to write the report to (standard output when not set)"`
+}
+
+// Execute the signing report
+func (cmd ReportCommand) Execute(args []string) error {
+	params := datastore.SigningReportParams{
+		Period:      cmd.Period,
+		AuthorityID: cmd.Brand,
+		Model:       cmd.Model,
+	}
+
+	for _, p := range []struct {
+		value string
+		time  **time.Time
+	}{{cmd.From, &params.From}, {cmd.To, &params.To}} {
+		if len(p.value) == 0 {
+			continue
+		}
+		t, err := signinglog.ParseTimeFilter(p.value)
+		if err != nil {
+			return fmt.Errorf("Error creating the report: %v", err)
+		}
+		*p.time = &t
+	}
+
+	openDatabase()
+	reports, err := datastore.Environ.DB.SigningReport(params)
+	if err != nil {
+		return fmt.Errorf("Error creating the report: %v", err)
+	}
+
+	var out io.Writer = os.Stdout
+	if len(cmd.Output) > 0 {
+		f, err := os.Create(cmd.Output)
+		if err != nil {
+			return fmt.Errorf("Error creating the report: %v", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	switch cmd.Format {
+	case report.FormatCSV:
+		err = report.WriteSigningCSV(out, reports)
+	case report.FormatJSON:
+		err = json.NewEncoder(out).Encode(reports)
+	default:
+		err = writeSigningTable(out, reports)
+	}
+	if err != nil {
+		return fmt.Errorf("Error creating the report: %v", err)
+	}
+	return nil
+}
+
+func writeSigningTable(out io.Writer, reports []datastore.SigningReport) error {
+	// Create a tabwriter to format the output
+	w := new(tabwriter.Writer)
+	w.Init(out, 5, 0, 4, ' ', 0)
+
+	// Print the headers
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Period\tBrand\tModel\tSigned\tRe-signed\tRe-sign Rate\tFactory\tCloud\tRemodels")
+
+	// Print the report
+	for _, r := range reports {
+		s := fmt.Sprintf("%s\t%s\t%s\t%d\t%d\t%.1f%%\t%d\t%d\t%d", r.Period, r.AuthorityID, r.Model, r.Signed, r.Resigned, r.ResignRate*100, r.Factory, r.Cloud, r.Remodels)
+		fmt.Fprintln(w, s)
+	}
+	fmt.Fprintln(w, "")
+	return w.Flush()
+}
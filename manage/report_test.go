@@ -0,0 +1,84 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package manage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"gopkg.in/check.v1"
+)
+
+type ReportSuite struct{}
+
+var _ = check.Suite(&ReportSuite{})
+
+func (s *ReportSuite) SetUpTest(c *check.C) {
+	datastore.Environ = &datastore.Env{DB: &datastore.MockDB{}}
+
+	// The options are kept from the previous command
+	Manage.Report = ReportCommand{}
+}
+
+func (s *ReportSuite) TestReport(c *check.C) {
+	dir, err := ioutil.TempDir("", "report")
+	c.Assert(err, check.IsNil)
+	defer os.RemoveAll(dir)
+	csvFile := filepath.Join(dir, "report.csv")
+	tableFile := filepath.Join(dir, "report.txt")
+
+	tests := []manTest{
+		{
+			Args:         []string{"serial-vault-admin", "report", "-p", "year"},
+			ErrorMessage: "Invalid value `year' for option `-p, --period'.*"},
+		{
+			Args:         []string{"serial-vault-admin", "report", "-p", "week", "-b", "system", "-m", "alder", "--from", "2020-01-01", "-f", "csv", "-o", csvFile},
+			ErrorMessage: ""},
+		{
+			Args:         []string{"serial-vault-admin", "report", "-o", tableFile},
+			ErrorMessage: ""},
+		{
+			Args:         []string{"serial-vault-admin", "report", "-p", "month", "-f", "json", "-o", filepath.Join(dir, "report.json")},
+			ErrorMessage: ""},
+		{
+			Args:         []string{"serial-vault-admin", "report", "--to", "tomorrow"},
+			ErrorMessage: "Error creating the report: the time 'tomorrow' must be a date .*"},
+	}
+
+	for _, t := range tests {
+		runTest(c, t.Args, t.ErrorMessage)
+	}
+
+	data, err := ioutil.ReadFile(csvFile)
+	c.Assert(err, check.IsNil)
+	c.Assert(strings.Split(strings.TrimSpace(string(data)), "\n"), check.HasLen, 3)
+
+	data, err = ioutil.ReadFile(tableFile)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Matches, "(?s).*2020-01-06 +system +alder +4 +1 +25.0% +3 +1 +0.*")
+}
+
+func (s *ReportSuite) TestReportError(c *check.C) {
+	datastore.Environ.DB = &datastore.ErrorMockDB{}
+	runTest(c, []string{"serial-vault-admin", "report"}, "Error creating the report: .*")
+}
@@ -0,0 +1,27 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package manage
+
+// SerialCommand is the main command for serial assertion management
+type SerialCommand struct {
+	Revoke      SerialRevokeCommand        `command:"revoke" alias:"r" description:"Revoke a signed serial assertion"`
+	Revocations SerialRevocationsCommand   `command:"revocations" alias:"l" description:"List the revoked serial assertions of a model"`
+	Key         SerialRevocationKeyCommand `command:"revocation-key" alias:"k" description:"Generate the key that signs the revocation lists"`
+}
@@ -0,0 +1,75 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package manage
+
+import (
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"gopkg.in/check.v1"
+)
+
+type SerialSuite struct{}
+
+var _ = check.Suite(&SerialSuite{})
+
+func (s *SerialSuite) SetUpTest(c *check.C) {
+	datastore.Environ = &datastore.Env{DB: &datastore.MockDB{}}
+}
+
+func (s *SerialSuite) TestSerial(c *check.C) {
+	tests := []manTest{
+		{
+			Args:         []string{"serial-vault-admin", "serial"},
+			ErrorMessage: "Please specify one command of: revocation-key, revocations or revoke"},
+		{
+			Args:         []string{"serial-vault-admin", "serial", "revoke", "-b", "system", "-m", "alder", "-s", "A123456"},
+			ErrorMessage: "the required flag `--reason' was not specified"},
+		{
+			Args:         []string{"serial-vault-admin", "serial", "revoke", "-b", "system", "-m", "alder", "-s", "A123456", "--reason", "Stolen device"},
+			ErrorMessage: ""},
+		{
+			Args:         []string{"serial-vault-admin", "serial", "revoke", "-b", "system", "-m", "alder", "-s", "A123456", "-r", "2", "--reason", "Stolen device"},
+			ErrorMessage: ""},
+		{
+			Args:         []string{"serial-vault-admin", "serial", "revoke", "-b", "system", "-m", "alder", "-s", "A123456", "-r", "-1", "--reason", "Stolen device"},
+			ErrorMessage: "Error revoking the serial assertion: The revision must not be negative"},
+		{
+			Args:         []string{"serial-vault-admin", "serial", "revoke", "-b", "system", "-m", "alder", "-s", "R12345", "--reason", "Stolen device"},
+			ErrorMessage: "Error revoking the serial assertion: The serial assertion has already been revoked"},
+		{
+			Args:         []string{"serial-vault-admin", "serial", "revocations"},
+			ErrorMessage: "the required flags `-b, --brand' and `-m, --model' were not specified"},
+		{
+			Args:         []string{"serial-vault-admin", "serial", "revocations", "-b", "system", "-m", "alder"},
+			ErrorMessage: ""},
+		{
+			Args:         []string{"serial-vault-admin", "serial", "revocation-key"},
+			ErrorMessage: ""},
+	}
+
+	for _, t := range tests {
+		runTest(c, t.Args, t.ErrorMessage)
+	}
+}
+
+func (s *SerialSuite) TestSerialError(c *check.C) {
+	datastore.Environ.DB = &datastore.ErrorMockDB{}
+	runTest(c, []string{"serial-vault-admin", "serial", "revoke", "-b", "system", "-m", "alder", "-s", "A123456", "--reason", "Stolen device"}, "Error revoking the serial assertion: .*")
+	runTest(c, []string{"serial-vault-admin", "serial", "revocations", "-b", "system", "-m", "alder"}, "Error listing the serial revocations: .*")
+}
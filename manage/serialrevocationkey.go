@@ -0,0 +1,43 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package manage
+
+import (
+	"fmt"
+
+	"github.com/CanonicalLtd/serial-vault/crypt"
+)
+
+// SerialRevocationKeyCommand handles the generation of the revocation signing key for the serial-vault-admin command
+type SerialRevocationKeyCommand struct{}
+
+// Execute the generation of the revocation signing key
+func (cmd SerialRevocationKeyCommand) Execute(args []string) error {
+	seed, publicKey, err := crypt.CreateEd25519Key()
+	if err != nil {
+		return fmt.Errorf("Error generating the revocation signing key: %v", err)
+	}
+
+	fmt.Println("Add the signing key to the settings of the signing service:")
+	fmt.Printf("revocationSigningKey: \"%s\"\n", seed)
+	fmt.Println("")
+	fmt.Println("The Ed25519 public key that verifies the revocation lists:")
+	fmt.Println(publicKey)
+	return nil
+}
@@ -0,0 +1,68 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package manage
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+)
+
+// SerialRevocationsCommand handles the list of revoked serial assertions for the serial-vault-admin command
+type SerialRevocationsCommand struct {
+	Brand string `short:"b" long:"brand" description:"The brand-id of the model" required:"yes"`
+	Model string `short:"m" long:"model" description:"The model name" required:"yes"`
+}
+
+// Execute the list of revoked serial assertions
+func (cmd SerialRevocationsCommand) Execute(args []string) error {
+
+	openDatabase()
+	revocations, err := datastore.Environ.DB.ListSerialRevocations(cmd.Brand, cmd.Model)
+	if err != nil {
+		return fmt.Errorf("Error listing the serial revocations: %v", err)
+	}
+
+	// Create a tabwriter to format the output
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 5, 0, 4, ' ', 0)
+
+	// Print the headers
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Serial Number\tRevision\tRevoked\tReason")
+
+	// Print the revocation list
+	for _, r := range revocations {
+		revision := "all"
+		if r.Revision > 0 {
+			revision = fmt.Sprintf("%d", r.Revision)
+		}
+
+		s := fmt.Sprintf("%s\t%s\t%s\t%s", r.SerialNumber, revision, r.Created.Format(time.RFC3339), r.Reason)
+		fmt.Fprintln(w, s)
+	}
+	fmt.Fprintln(w, "")
+	w.Flush()
+
+	return nil
+}
@@ -0,0 +1,61 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package manage
+
+import (
+	"fmt"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+)
+
+// SerialRevokeCommand handles revoking a serial assertion for the serial-vault-admin command
+type SerialRevokeCommand struct {
+	Brand        string `short:"b" long:"brand" description:"The brand-id of the device" required:"yes"`
+	Model        string `short:"m" long:"model" description:"The model name of the device" required:"yes"`
+	SerialNumber string `short:"s" long:"serial" description:"The serial number of the device" required:"yes"`
+	Revision     int    `short:"r" long:"revision" description:"The revision of the serial assertion (all revisions when not set)" default:"0"`
+	Reason       string `long:"reason" description:"The reason for the revocation" required:"yes"`
+}
+
+// Execute the revocation of the serial assertion
+func (cmd SerialRevokeCommand) Execute(args []string) error {
+
+	openDatabase()
+
+	revocation := datastore.SerialRevocation{
+		BrandID:      cmd.Brand,
+		Model:        cmd.Model,
+		SerialNumber: cmd.SerialNumber,
+		Revision:     cmd.Revision,
+		Reason:       cmd.Reason,
+	}
+
+	revocation, err := datastore.Environ.DB.CreateSerialRevocation(revocation)
+	if err != nil {
+		return fmt.Errorf("Error revoking the serial assertion: %v", err)
+	}
+
+	if revocation.Revision == 0 {
+		fmt.Printf("Revoked all the serial assertions of %s/%s/%s.\n", revocation.BrandID, revocation.Model, revocation.SerialNumber)
+	} else {
+		fmt.Printf("Revoked revision %d of the serial assertion of %s/%s/%s.\n", revocation.Revision, revocation.BrandID, revocation.Model, revocation.SerialNumber)
+	}
+	return nil
+}
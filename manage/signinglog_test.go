@@ -0,0 +1,126 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package manage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"gopkg.in/check.v1"
+)
+
+type SigningLogSuite struct{}
+
+var _ = check.Suite(&SigningLogSuite{})
+
+func (s *SigningLogSuite) SetUpTest(c *check.C) {
+	datastore.Environ = &datastore.Env{DB: &datastore.MockDB{}}
+
+	// The options are kept from the previous command
+	Manage.SigningLog = SigningLogCommand{}
+}
+
+func (s *SigningLogSuite) TestSigningLogExport(c *check.C) {
+	dir, err := ioutil.TempDir("", "signinglog")
+	c.Assert(err, check.IsNil)
+	defer os.RemoveAll(dir)
+	csvFile := filepath.Join(dir, "export.csv")
+	jsonlFile := filepath.Join(dir, "export.jsonl")
+
+	tests := []manTest{
+		{
+			Args:         []string{"serial-vault-admin", "signinglog"},
+			ErrorMessage: "Please specify one command of: archive or export"},
+		{
+			Args:         []string{"serial-vault-admin", "signinglog", "export"},
+			ErrorMessage: "the required flag `-b, --brand' was not specified"},
+		{
+			Args:         []string{"serial-vault-admin", "signinglog", "export", "-b", "system", "-f", "xml"},
+			ErrorMessage: "Invalid value `xml' for option `-f, --format'.*"},
+		{
+			Args:         []string{"serial-vault-admin", "signinglog", "export", "-b", "system", "--from", "yesterday"},
+			ErrorMessage: "Error exporting the signing log: the time 'yesterday' must be a date .*"},
+		{
+			Args:         []string{"serial-vault-admin", "signinglog", "export", "-b", "system", "-m", "alder", "-m", "ash", "-s", "A*", "--from", "2020-01-01", "--to", "2021-01-01T00:00:00Z", "-o", csvFile},
+			ErrorMessage: ""},
+		{
+			Args:         []string{"serial-vault-admin", "signinglog", "export", "-b", "system", "-f", "jsonl", "-o", jsonlFile},
+			ErrorMessage: ""},
+	}
+
+	for _, t := range tests {
+		runTest(c, t.Args, t.ErrorMessage)
+	}
+
+	data, err := ioutil.ReadFile(csvFile)
+	c.Assert(err, check.IsNil)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	c.Assert(lines, check.HasLen, 11)
+	c.Assert(lines[0], check.Equals, "id,make,model,serialnumber,fingerprint,created,revision,synced")
+
+	data, err = ioutil.ReadFile(jsonlFile)
+	c.Assert(err, check.IsNil)
+	c.Assert(strings.Split(strings.TrimSpace(string(data)), "\n"), check.HasLen, 10)
+}
+
+func (s *SigningLogSuite) TestSigningLogExportError(c *check.C) {
+	datastore.Environ.DB = &datastore.ErrorMockDB{}
+	runTest(c, []string{"serial-vault-admin", "signinglog", "export", "-b", "system"}, "Error exporting the signing log: .*")
+}
+
+func (s *SigningLogSuite) TestSigningLogArchive(c *check.C) {
+	dir, err := ioutil.TempDir("", "signinglog")
+	c.Assert(err, check.IsNil)
+	defer os.RemoveAll(dir)
+
+	tests := []manTest{
+		{
+			Args:         []string{"serial-vault-admin", "signinglog", "archive"},
+			ErrorMessage: "Error archiving the signing log: the retention months must be set"},
+		{
+			Args:         []string{"serial-vault-admin", "signinglog", "archive", "--months", "-1"},
+			ErrorMessage: "Error archiving the signing log: the retention months must be set"},
+		{
+			Args:         []string{"serial-vault-admin", "signinglog", "archive", "--months", "24"},
+			ErrorMessage: ""},
+		{
+			Args:         []string{"serial-vault-admin", "signinglog", "archive", "--months", "24", "--dir", dir},
+			ErrorMessage: ""},
+	}
+
+	for _, t := range tests {
+		runTest(c, t.Args, t.ErrorMessage)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "signinglog-archive-*.csv.gz"))
+	c.Assert(err, check.IsNil)
+	c.Assert(files, check.HasLen, 1)
+}
+
+func (s *SigningLogSuite) TestSigningLogArchiveConfig(c *check.C) {
+	datastore.Environ.Config.SigningLogRetention = 12
+	runTest(c, []string{"serial-vault-admin", "signinglog", "archive"}, "")
+
+	datastore.Environ.DB = &datastore.ErrorMockDB{}
+	runTest(c, []string{"serial-vault-admin", "signinglog", "archive"}, "Error archiving the signing log: Error archiving the signing logs")
+}
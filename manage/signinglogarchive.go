@@ -0,0 +1,58 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package manage
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/retention"
+)
+
+// SigningLogArchiveCommand handles the archive of the signing log for the serial-vault-admin command
+type SigningLogArchiveCommand struct {
+	Months int    `long:"months" description:"The months that the signing logs are kept (signingLogRetention when not set)"`
+	Dir    string `long:"dir" description:"The directory for the compressed archive file (signingLogArchiveDir when not set, otherwise the archive table is used)"`
+}
+
+// Execute the archive of the signing log
+func (cmd SigningLogArchiveCommand) Execute(args []string) error {
+	openDatabase()
+
+	months := cmd.Months
+	if months == 0 {
+		months = datastore.Environ.Config.SigningLogRetention
+	}
+	if months <= 0 {
+		return errors.New("Error archiving the signing log: the retention months must be set")
+	}
+	dir := cmd.Dir
+	if len(dir) == 0 {
+		dir = datastore.Environ.Config.SigningLogArchiveDir
+	}
+
+	count, err := retention.Archive(months, dir)
+	if err != nil {
+		return fmt.Errorf("Error archiving the signing log: %v", err)
+	}
+	fmt.Printf("Archived %d signing logs.\n", count)
+	return nil
+}
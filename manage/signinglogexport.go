@@ -0,0 +1,88 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package manage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/signinglog"
+)
+
+// SigningLogExportCommand handles the export of the signing log for the serial-vault-admin command
+type SigningLogExportCommand struct {
+	Brand        string   `short:"b" long:"brand" description:"The brand-id of the account" required:"yes"`
+	Models       []string `short:"m" long:"model" description:"The model name (can be repeated)"`
+	SerialNumber string   `short:"s" long:"serial" description:"The serial number pattern, where '*' matches any characters (otherwise matches the start of the serial number)"`
+	From         string   `long:"from" description:"The start of the date range (YYYY-MM-DD or RFC3339 time)"`
+	To           string   `long:"to" description:"The end of the date range, which is not included (YYYY-MM-DD or RFC3339 time)"`
+	Format       string   `short:"f" long:"format" description:"The export format" choice:"csv" choice:"jsonl" default:"csv"`
+	Output       string   `short:"o" long:"output" description:"The file to write the export to (standard output when not set)"`
+}
+
+// Execute the export of the signing log
+func (cmd SigningLogExportCommand) Execute(args []string) error {
+	params := datastore.SigningLogExportParams{
+		Models:       cmd.Models,
+		Serialnumber: cmd.SerialNumber,
+	}
+
+	for _, p := range []struct {
+		value string
+		time  **time.Time
+	}{{cmd.From, &params.From}, {cmd.To, &params.To}} {
+		if len(p.value) == 0 {
+			continue
+		}
+		t, err := signinglog.ParseTimeFilter(p.value)
+		if err != nil {
+			return fmt.Errorf("Error exporting the signing log: %v", err)
+		}
+		*p.time = &t
+	}
+
+	var out io.Writer = os.Stdout
+	if len(cmd.Output) > 0 {
+		f, err := os.Create(cmd.Output)
+		if err != nil {
+			return fmt.Errorf("Error exporting the signing log: %v", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	export, err := signinglog.NewExportWriter(out, cmd.Format)
+	if err != nil {
+		return fmt.Errorf("Error exporting the signing log: %v", err)
+	}
+
+	openDatabase()
+	err = datastore.Environ.DB.ExportSigningLog(cmd.Brand, params, export.Write)
+	if err == nil {
+		err = export.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("Error exporting the signing log: %v", err)
+	}
+	return nil
+}
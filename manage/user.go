@@ -27,6 +27,7 @@ type UserCommand struct {
 	Add    UserAddCommand    `command:"add" alias:"a" description:"Add a new user"`
 	Update UserUpdateCommand `command:"update" alias:"a" description:"Update an existing user"`
 	Delete UserDeleteCommand `command:"delete" alias:"d" description:"Delete an existing user"`
+	APIKey UserAPIKeyCommand `command:"apikey" description:"Generate a new API key for an existing user"`
 }
 
 func checkUsernameArg(args []string, action string) error {
@@ -36,7 +36,7 @@ func (s *UserSuite) TestUser(c *check.C) {
 	tests := []manTest{
 		{
 			Args:         []string{"serial-vault-admin", "user"},
-			ErrorMessage: "Please specify one command of: add, delete, list or update"},
+			ErrorMessage: "Please specify one command of: add, apikey, delete, list or update"},
 		{
 			Args:         []string{"serial-vault-admin", "user", "list"},
 			ErrorMessage: ""},
@@ -82,6 +82,15 @@ func (s *UserSuite) TestUser(c *check.C) {
 		{
 			Args:         []string{"serial-vault-admin", "user", "delete", "sv"},
 			ErrorMessage: ""},
+		{
+			Args:         []string{"serial-vault-admin", "user", "apikey"},
+			ErrorMessage: "API key user expects a 'username' argument"},
+		{
+			Args:         []string{"serial-vault-admin", "user", "apikey", "sv"},
+			ErrorMessage: ""},
+		{
+			Args:         []string{"serial-vault-admin", "user", "apikey", "unknown"},
+			ErrorMessage: "Error finding the user 'unknown'"},
 	}
 
 	for _, t := range tests {
@@ -56,11 +56,18 @@ func (cmd UserAddCommand) Execute(args []string) error {
 		Accounts: []datastore.Account{},
 	}
 
-	_, err = datastore.Environ.DB.CreateUser(user)
+	user.ID, err = datastore.Environ.DB.CreateUser(user)
 	if err != nil {
 		return fmt.Errorf("Error creating the user: %v", err)
 	}
 
+	// Only the hash of the API key is stored, so the key is generated and shown now
+	apiKey, err := datastore.Environ.DB.ResetUserAPIKey(user.ID)
+	if err != nil {
+		return fmt.Errorf("Error generating the API key: %v", err)
+	}
+
 	fmt.Printf("User '%s' created successfully\n", user.Username)
+	fmt.Printf("API key for user '%s': %s\n", user.Username, apiKey)
 	return nil
 }
@@ -0,0 +1,52 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package manage
+
+import (
+	"fmt"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+)
+
+// UserAPIKeyCommand handles resetting a user's API key for the serial-vault-admin command
+type UserAPIKeyCommand struct{}
+
+// Execute the API key reset. Only the hash of the key is stored, so the new key is only shown here
+func (cmd UserAPIKeyCommand) Execute(args []string) error {
+	err := checkUsernameArg(args, "API key")
+	if err != nil {
+		return err
+	}
+
+	// Open the database and get the user from the database
+	openDatabase()
+	user, err := datastore.Environ.DB.GetUserByUsername(args[0])
+	if err != nil {
+		return fmt.Errorf("Error finding the user '%s'", args[0])
+	}
+
+	apiKey, err := datastore.Environ.DB.ResetUserAPIKey(user.ID)
+	if err != nil {
+		return fmt.Errorf("Error resetting the API key: %v", err)
+	}
+
+	fmt.Printf("New API key for user '%s': %s\n", user.Username, apiKey)
+	return nil
+}
@@ -0,0 +1,198 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package retention
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/config"
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/log"
+	"github.com/CanonicalLtd/serial-vault/service/signinglog"
+)
+
+const (
+	archiveBatch    = 500
+	archiveInterval = 24 * time.Hour
+)
+
+// Start starts the daily archive of the signing logs, when a retention is configured
+func Start(config config.Settings) {
+	if config.SigningLogRetention <= 0 {
+		return
+	}
+	go schedule(config.SigningLogRetention, config.SigningLogArchiveDir)
+}
+
+func schedule(months int, dir string) {
+	ticker := time.NewTicker(archiveInterval)
+	defer ticker.Stop()
+
+	for {
+		count, err := Archive(months, dir)
+		if err != nil {
+			log.Printf("Error archiving the signing logs: %v", err)
+		} else if count > 0 {
+			log.Printf("Archived %d signing logs", count)
+		}
+		<-ticker.C
+	}
+}
+
+// Archive moves the signing logs that are older than the retention months out of the signing log,
+// and returns the number of logs that were archived. The logs are moved to the archive table or,
+// when a directory is given, to a new compressed CSV file in the directory
+func Archive(months int, dir string) (int, error) {
+	if months <= 0 {
+		return 0, errors.New("the retention must be at least one month")
+	}
+	before := datastore.SigningLogRetentionCutoff(months)
+
+	var file *archiveFile
+	var archive func([]datastore.SigningLog) error
+	if len(dir) > 0 {
+		archive = func(signingLogs []datastore.SigningLog) error {
+			if file == nil {
+				var err error
+				if file, err = createArchiveFile(dir); err != nil {
+					return err
+				}
+			}
+			return file.write(signingLogs)
+		}
+	}
+
+	total := 0
+	for {
+		count, err := datastore.Environ.DB.ArchiveSigningLogs(before, archiveBatch, len(dir) == 0, archive)
+		total += count
+
+		// Keep the batch in the file once it has been removed from the signing log, or discard it
+		// so that it is only archived once, when it is retried
+		if file != nil && err != nil {
+			if errFile := file.rollback(); errFile != nil {
+				log.Printf("Error discarding the batch from the signing log archive file: %v", errFile)
+			}
+		} else if file != nil {
+			err = file.commit()
+		}
+
+		if err != nil || count < archiveBatch {
+			if errClose := file.close(); err == nil {
+				err = errClose
+			}
+			return total, err
+		}
+	}
+}
+
+// archiveFile is a gzipped CSV file of archived signing logs. Each batch is written as a gzip
+// member of its own, which is synced to the disk before the batch is removed from the signing log.
+// A batch that is not removed is truncated from the file, so the file only holds the batches that
+// were removed. Gzip readers read the members as a single stream
+type archiveFile struct {
+	file      *os.File
+	member    *gzip.Writer
+	w         signinglog.ExportWriter
+	committed int64
+}
+
+func createArchiveFile(dir string) (*archiveFile, error) {
+	name := filepath.Join(dir, fmt.Sprintf("signinglog-archive-%s.csv.gz", time.Now().UTC().Format("20060102T150405Z")))
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &archiveFile{file: f}
+	a.w, err = signinglog.NewExportWriter(a, signinglog.ExportCSV)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// The CSV header is a member of its own, so it is kept when the first batch is truncated
+	if err := a.write(nil); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := a.commit(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+// Write writes to the gzip member of the batch
+func (a *archiveFile) Write(p []byte) (int, error) {
+	return a.member.Write(p)
+}
+
+// write writes a batch of signing logs as a new gzip member, and syncs it to the disk
+func (a *archiveFile) write(signingLogs []datastore.SigningLog) error {
+	a.member = gzip.NewWriter(a.file)
+	for _, l := range signingLogs {
+		if err := a.w.Write(l); err != nil {
+			return err
+		}
+	}
+	if err := a.w.Flush(); err != nil {
+		return err
+	}
+	if err := a.member.Close(); err != nil {
+		return err
+	}
+	return a.file.Sync()
+}
+
+// commit keeps the batches that have been written, once they have been removed from the signing log
+func (a *archiveFile) commit() error {
+	offset, err := a.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	a.committed = offset
+	return nil
+}
+
+// rollback discards the batch that was written since the last commit
+func (a *archiveFile) rollback() error {
+	if err := a.file.Truncate(a.committed); err != nil {
+		return err
+	}
+	if _, err := a.file.Seek(a.committed, io.SeekStart); err != nil {
+		return err
+	}
+	return a.file.Sync()
+}
+
+func (a *archiveFile) close() error {
+	if a == nil {
+		return nil
+	}
+	return a.file.Close()
+}
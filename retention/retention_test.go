@@ -0,0 +1,133 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package retention
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	check "gopkg.in/check.v1"
+)
+
+func TestRetentionSuite(t *testing.T) { check.TestingT(t) }
+
+type retentionSuite struct{}
+
+var _ = check.Suite(&retentionSuite{})
+
+func (s *retentionSuite) SetUpTest(c *check.C) {
+	datastore.Environ = &datastore.Env{DB: &datastore.MockDB{}}
+}
+
+func (s *retentionSuite) TestArchiveTable(c *check.C) {
+	count, err := Archive(12, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 10)
+}
+
+func (s *retentionSuite) TestArchiveFile(c *check.C) {
+	dir, err := ioutil.TempDir("", "retention")
+	c.Assert(err, check.IsNil)
+	defer os.RemoveAll(dir)
+
+	count, err := Archive(12, dir)
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 10)
+
+	files, err := filepath.Glob(filepath.Join(dir, "signinglog-archive-*.csv.gz"))
+	c.Assert(err, check.IsNil)
+	c.Assert(files, check.HasLen, 1)
+
+	f, err := os.Open(files[0])
+	c.Assert(err, check.IsNil)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	c.Assert(err, check.IsNil)
+	records, err := csv.NewReader(gz).ReadAll()
+	c.Assert(err, check.IsNil)
+	c.Assert(records, check.HasLen, 11)
+	c.Assert(records[1][1], check.Equals, "System")
+}
+
+// rollbackMockDB writes the batch to the archive and then fails to remove it from the signing log
+type rollbackMockDB struct {
+	datastore.MockDB
+}
+
+func (mdb *rollbackMockDB) ArchiveSigningLogs(before time.Time, limit int, archiveTable bool, archive func([]datastore.SigningLog) error) (int, error) {
+	if _, err := mdb.MockDB.ArchiveSigningLogs(before, limit, archiveTable, archive); err != nil {
+		return 0, err
+	}
+	return 0, errors.New("MOCK error committing the archive")
+}
+
+func (s *retentionSuite) TestArchiveFileRollback(c *check.C) {
+	datastore.Environ.DB = &rollbackMockDB{}
+	dir, err := ioutil.TempDir("", "retention")
+	c.Assert(err, check.IsNil)
+	defer os.RemoveAll(dir)
+
+	count, err := Archive(12, dir)
+	c.Assert(err, check.ErrorMatches, "MOCK error committing the archive")
+	c.Assert(count, check.Equals, 0)
+
+	// The batch that stays in the signing log is not kept in the file
+	files, err := filepath.Glob(filepath.Join(dir, "signinglog-archive-*.csv.gz"))
+	c.Assert(err, check.IsNil)
+	c.Assert(files, check.HasLen, 1)
+
+	f, err := os.Open(files[0])
+	c.Assert(err, check.IsNil)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	c.Assert(err, check.IsNil)
+	records, err := csv.NewReader(gz).ReadAll()
+	c.Assert(err, check.IsNil)
+	c.Assert(records, check.HasLen, 1)
+	c.Assert(records[0][0], check.Equals, "id")
+}
+
+func (s *retentionSuite) TestArchiveInvalid(c *check.C) {
+	tests := []struct {
+		months int
+		dir    string
+		db     datastore.Datastore
+		err    string
+	}{
+		{0, "", &datastore.MockDB{}, "the retention must be at least one month"},
+		{12, "/does/not/exist", &datastore.MockDB{}, ".*no such file or directory"},
+		{12, "", &datastore.ErrorMockDB{}, "Error archiving the signing logs"},
+	}
+
+	for _, t := range tests {
+		datastore.Environ.DB = t.db
+		count, err := Archive(t.months, t.dir)
+		c.Assert(err, check.ErrorMatches, t.err)
+		c.Assert(count, check.Equals, 0)
+	}
+}
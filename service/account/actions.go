@@ -28,6 +28,7 @@ import (
 	"github.com/CanonicalLtd/serial-vault/service/log"
 
 	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/audit"
 	"github.com/CanonicalLtd/serial-vault/service/auth"
 	"github.com/CanonicalLtd/serial-vault/service/response"
 	"github.com/snapcore/snapd/asserts"
@@ -81,7 +82,12 @@ func createHandler(w http.ResponseWriter, user datastore.User, apiCall bool, acc
 		return
 	}
 
-	err = datastore.Environ.DB.CreateAccount(acct)
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		if err := db.CreateAccount(acct); err != nil {
+			return err
+		}
+		return audit.Record(db, user, "account:create", "account/"+acct.AuthorityID, nil, acct)
+	})
 	if err != nil {
 		response.FormatStandardResponse(false, "error-creating-account", "", "Error creating the account in the database", w)
 		return
@@ -122,7 +128,14 @@ func updateHandler(w http.ResponseWriter, user datastore.User, apiCall bool, acc
 		return
 	}
 
-	err = datastore.Environ.DB.UpdateAccount(acct, user)
+	before, _ := datastore.Environ.DB.GetAccountByID(acct.ID, user)
+
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		if err := db.UpdateAccount(acct, user); err != nil {
+			return err
+		}
+		return audit.Record(db, user, "account:update", "account/"+acct.AuthorityID, before, acct)
+	})
 	if err != nil {
 		log.Println("Error updating the account:", err)
 		response.FormatStandardResponse(false, "error-account", "", "Error updating the model", w)
@@ -169,7 +182,15 @@ func uploadHandler(w http.ResponseWriter, user datastore.User, apiCall bool, ass
 		Assertion:   string(decodedAssertion),
 	}
 
-	errorCode, err := datastore.Environ.DB.PutAccount(account, user)
+	var errorCode string
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		var err error
+		errorCode, err = db.PutAccount(account, user)
+		if err != nil {
+			return err
+		}
+		return audit.Record(db, user, "account:upload", "account/"+account.AuthorityID, nil, account)
+	})
 	if err != nil {
 		response.FormatStandardResponse(false, errorCode, "", err.Error(), w)
 		return
@@ -34,6 +34,7 @@ import (
 	"github.com/CanonicalLtd/serial-vault/random"
 	"github.com/CanonicalLtd/serial-vault/service/auth"
 	"github.com/CanonicalLtd/serial-vault/service/response"
+	"github.com/CanonicalLtd/serial-vault/webhook"
 	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/release"
 )
@@ -57,6 +58,17 @@ func systemUserAssertionAction(w http.ResponseWriter, authUser datastore.User, a
 		return
 	}
 
+	// Use the successor system-user key of a rotation that is due, until it is promoted
+	if err := datastore.Environ.DB.ApplyDueKeyRotations(&model); err != nil {
+		log.Println(err)
+	}
+
+	// Check that the user can issue system-users for the model's brand
+	if !datastore.Environ.DB.AllowedPermission(authUser, model.BrandID, datastore.PermissionSystemUserIssue) {
+		response.FormatStandardResponse(false, response.ErrorAuth.Code, "", "Your user does not have permissions to issue system-users for the brand", w)
+		return
+	}
+
 	// Generate the system-user assertion and return the response
 	resp := GenerateSystemUserAssertion(user, model)
 	if !resp.Success {
@@ -100,6 +112,16 @@ func GenerateSystemUserAssertion(user SystemUserRequest, model datastore.Model)
 	// Format the composite assertion
 	composite := fmt.Sprintf("%s\n%s\n%s", account.Assertion, model.AssertionUser, serializedAssertion)
 
+	webhook.Notify(model.AuthorityIDUser, datastore.EventSystemUserIssued, map[string]interface{}{
+		"brand-id": model.AuthorityIDUser,
+		"model":    model.Name,
+		"username": user.Username,
+		"email":    user.Email,
+		"serials":  user.Serials,
+		"since":    user.Since,
+		"until":    user.Until,
+	})
+
 	return SystemUserResponse{Success: true, Assertion: composite}
 }
 
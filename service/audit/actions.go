@@ -0,0 +1,113 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/auth"
+	"github.com/CanonicalLtd/serial-vault/service/log"
+	"github.com/CanonicalLtd/serial-vault/service/response"
+)
+
+// ListResponse is the JSON response from the API Audit Log method
+type ListResponse struct {
+	Success      bool                 `json:"success"`
+	ErrorCode    string               `json:"error_code"`
+	ErrorSubcode string               `json:"error_subcode"`
+	ErrorMessage string               `json:"message"`
+	AuditLog     []datastore.AuditLog `json:"logs"`
+}
+
+// VerifyResponse is the JSON response from the API Audit Log Verify method
+type VerifyResponse struct {
+	Success      bool                           `json:"success"`
+	ErrorCode    string                         `json:"error_code"`
+	ErrorSubcode string                         `json:"error_subcode"`
+	ErrorMessage string                         `json:"message"`
+	Verification datastore.AuditLogVerification `json:"verification"`
+}
+
+// listHandler is the API method to fetch the entries of the audit log
+func listHandler(w http.ResponseWriter, user datastore.User, apiCall bool, params datastore.AuditLogParams) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.Superuser, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	logs, err := datastore.Environ.DB.ListAuditLog(params)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-fetch-auditlog", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	formatListResponse(logs, w)
+}
+
+// verifyHandler is the API method to verify the hash chain of the audit log
+func verifyHandler(w http.ResponseWriter, user datastore.User, apiCall bool) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.Superuser, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	verification, err := datastore.Environ.DB.VerifyAuditLog()
+	if err != nil {
+		response.FormatStandardResponse(false, "error-verify-auditlog", "", err.Error(), w)
+		return
+	}
+	if !verification.Valid {
+		log.Printf("The audit log chain is broken at entry %d", verification.BrokenID)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	formatVerifyResponse(verification, w)
+}
+
+func formatListResponse(logs []datastore.AuditLog, w http.ResponseWriter) error {
+	response := ListResponse{Success: true, AuditLog: logs}
+
+	// Encode the response as JSON
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Println("Error forming the audit log response.")
+		return err
+	}
+	return nil
+}
+
+func formatVerifyResponse(verification datastore.AuditLogVerification, w http.ResponseWriter) error {
+	response := VerifyResponse{Success: true, Verification: verification}
+
+	// Encode the response as JSON
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Println("Error forming the audit log verification response.")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/log"
+)
+
+// secretFields are the fields that are not written to the audit log. A change of a secret is
+// recorded, but not its value
+var secretFields = []string{"api-key", "APIKey", "SealedKey", "secret", "token"}
+
+const redacted = "*****"
+
+// Record writes an entry to the audit log for an action of the user on a target. The before and
+// after states of the target are reduced to the fields that the action changed. The entry is written
+// to the database of the action's transaction, so the action fails when it cannot be recorded
+func Record(db datastore.Datastore, user datastore.User, action, target string, before, after interface{}) error {
+	b, a := diff(before, after)
+
+	entry := datastore.AuditLog{
+		Actor:    user.Username,
+		Action:   action,
+		Target:   target,
+		Before:   b,
+		After:    a,
+		SourceIP: user.SourceIP,
+	}
+	if err := db.CreateAuditLog(entry); err != nil {
+		log.Printf("Error recording '%s' of '%s' in the audit log: %v", action, target, err)
+		return err
+	}
+	return nil
+}
+
+// diff returns the JSON of the fields of the before and after states that differ. A nil state is
+// one that does not exist, i.e. before a create or after a delete
+func diff(before, after interface{}) (string, string) {
+	b := toFields(before)
+	a := toFields(after)
+
+	if b != nil && a != nil {
+		for k, v := range b {
+			if w, ok := a[k]; ok && reflect.DeepEqual(v, w) {
+				delete(b, k)
+				delete(a, k)
+			}
+		}
+	}
+
+	return encode(b), encode(a)
+}
+
+// toFields converts a state to its JSON fields. A state that is not a JSON object is held in
+// the 'value' field
+func toFields(state interface{}) map[string]interface{} {
+	if state == nil || reflect.ValueOf(state).Kind() == reflect.Ptr && reflect.ValueOf(state).IsNil() {
+		return nil
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		log.Printf("Error encoding the state for the audit log: %v", err)
+		return nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil
+	}
+
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		fields = map[string]interface{}{"value": value}
+	}
+	return fields
+}
+
+func encode(fields map[string]interface{}) string {
+	if fields == nil {
+		return ""
+	}
+
+	for _, k := range secretFields {
+		if v, ok := fields[k]; ok && v != "" {
+			fields[k] = redacted
+		}
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
@@ -0,0 +1,80 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package audit
+
+import (
+	"testing"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	check "gopkg.in/check.v1"
+)
+
+func TestAudit(t *testing.T) { check.TestingT(t) }
+
+type AuditSuite struct{}
+
+var _ = check.Suite(&AuditSuite{})
+
+func (s *AuditSuite) SetUpTest(c *check.C) {
+	datastore.Environ = &datastore.Env{DB: &datastore.MockDB{}}
+}
+
+func (s *AuditSuite) TestDiff(c *check.C) {
+	tests := []struct {
+		before interface{}
+		after  interface{}
+		b      string
+		a      string
+	}{
+		{nil, nil, "", ""},
+		{map[string]string{"name": "a", "email": "a@example.com"}, map[string]string{"name": "b", "email": "a@example.com"}, `{"name":"a"}`, `{"name":"b"}`},
+		{map[string]string{"name": "a"}, nil, `{"name":"a"}`, ""},
+		{map[string]bool{"active": true}, map[string]bool{"active": true}, "{}", "{}"},
+		{"plain", "text", `{"value":"plain"}`, `{"value":"text"}`},
+		{map[string]string{"api-key": "old"}, map[string]string{"api-key": "new"}, `{"api-key":"*****"}`, `{"api-key":"*****"}`},
+		{nil, datastore.User{Username: "jdoe", APIKey: "secret"}, "", `{"APIKey":"*****","Accounts":null,"Email":"","ID":0,"Name":"","Provisioned":false,"Role":0,"Username":"jdoe"}`},
+	}
+
+	for _, t := range tests {
+		b, a := diff(t.before, t.after)
+		c.Check(b, check.Equals, t.b)
+		c.Check(a, check.Equals, t.a)
+	}
+}
+
+func (s *AuditSuite) TestRecord(c *check.C) {
+	user := datastore.User{Username: "sv", SourceIP: "10.0.0.1"}
+	err := Record(datastore.Environ.DB, user, "keypair:update", "keypair/1", map[string]string{"key-name": "old"}, map[string]string{"key-name": "new"})
+	c.Assert(err, check.IsNil)
+
+	logs, err := datastore.Environ.DB.ListAuditLog(datastore.AuditLogParams{Action: "keypair:update", Target: "keypair/1"})
+	c.Assert(err, check.IsNil)
+	c.Assert(len(logs) > 0, check.Equals, true)
+	c.Assert(logs[0].Actor, check.Equals, "sv")
+	c.Assert(logs[0].SourceIP, check.Equals, "10.0.0.1")
+	c.Assert(logs[0].Before, check.Equals, `{"key-name":"old"}`)
+	c.Assert(logs[0].After, check.Equals, `{"key-name":"new"}`)
+	c.Assert(logs[0].Hash, check.Equals, logs[0].ComputeHash())
+
+	// An error writing the audit log fails the action
+	datastore.Environ.DB = &datastore.ErrorMockDB{}
+	err = Record(datastore.Environ.DB, user, "keypair:update", "keypair/1", nil, nil)
+	c.Assert(err, check.NotNil)
+}
@@ -0,0 +1,92 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package audit
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/auth"
+	"github.com/CanonicalLtd/serial-vault/service/response"
+)
+
+// List is the API method to fetch the entries of the audit log, filtered by the query parameters
+func List(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	params, err := GetAuditLogParams(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auditlog-params", "", err.Error(), w)
+		return
+	}
+
+	listHandler(w, authUser, false, params)
+}
+
+// Verify is the API method to verify the hash chain of the audit log
+func Verify(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	verifyHandler(w, authUser, false)
+}
+
+// GetAuditLogParams returns the audit log filters from the query parameters. The 'from' and
+// 'to' times are in RFC3339 format
+func GetAuditLogParams(r *http.Request) (datastore.AuditLogParams, error) {
+	query := r.URL.Query()
+	params := datastore.AuditLogParams{
+		Actor:  query.Get("actor"),
+		Action: query.Get("action"),
+		Target: query.Get("target"),
+		Limit:  datastore.AuditLogDefaultLimit,
+	}
+
+	if offset, err := strconv.ParseUint(query.Get("offset"), 10, 64); err == nil {
+		params.Offset = offset
+	}
+	if limit, err := strconv.ParseUint(query.Get("limit"), 10, 64); err == nil && limit > 0 {
+		params.Limit = limit
+	}
+
+	for _, p := range []struct {
+		name  string
+		value **time.Time
+	}{{"from", &params.From}, {"to", &params.To}} {
+		if v := query.Get(p.name); len(v) > 0 {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return params, err
+			}
+			*p.value = &t
+		}
+	}
+
+	return params, nil
+}
@@ -0,0 +1,146 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package audit_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/CanonicalLtd/serial-vault/config"
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service"
+	"github.com/CanonicalLtd/serial-vault/service/audit"
+	"github.com/CanonicalLtd/serial-vault/usso"
+	"github.com/juju/usso/openid"
+	check "gopkg.in/check.v1"
+)
+
+type HandlersSuite struct{}
+
+var _ = check.Suite(&HandlersSuite{})
+
+func (s *HandlersSuite) SetUpTest(c *check.C) {
+	// Mock the database
+	config := config.Settings{KeyStoreType: "filesystem", KeyStorePath: "../../keystore", JwtSecret: "SomeTestSecretValue", EnableUserAuth: true}
+	datastore.Environ = &datastore.Env{DB: &datastore.MockDB{}, Config: config}
+	datastore.OpenKeyStore(config)
+
+	// Disable CSRF for tests as we do not have a secure connection
+	service.MiddlewareWithCSRF = service.Middleware
+}
+
+func (s *HandlersSuite) TestListHandler(c *check.C) {
+	// Delete a user, which is recorded in the audit log
+	w := sendAdminRequest("DELETE", "/v1/users/4", datastore.Superuser, c)
+	c.Assert(w.Code, check.Equals, http.StatusOK)
+
+	w = sendAdminRequest("GET", "/v1/audit?action=user:delete&target=user/4", datastore.Superuser, c)
+	c.Assert(w.Code, check.Equals, http.StatusOK)
+
+	result := audit.ListResponse{}
+	err := json.NewDecoder(w.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Success, check.Equals, true)
+	c.Assert(len(result.AuditLog) > 0, check.Equals, true)
+	c.Assert(result.AuditLog[0].Actor, check.Equals, "root")
+	c.Assert(result.AuditLog[0].Target, check.Equals, "user/4")
+	c.Assert(result.AuditLog[0].After, check.Equals, "")
+	c.Assert(result.AuditLog[0].SourceIP, check.Equals, "10.0.0.1")
+}
+
+func (s *HandlersSuite) TestVerifyHandler(c *check.C) {
+	w := sendAdminRequest("GET", "/v1/audit/verify", datastore.Superuser, c)
+	c.Assert(w.Code, check.Equals, http.StatusOK)
+
+	result := audit.VerifyResponse{}
+	err := json.NewDecoder(w.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Success, check.Equals, true)
+	c.Assert(result.Verification.Valid, check.Equals, true)
+}
+
+func (s *HandlersSuite) TestHandlersInvalid(c *check.C) {
+	tests := []struct {
+		url         string
+		permissions int
+		code        int
+	}{
+		{"/v1/audit", datastore.Admin, http.StatusBadRequest},
+		{"/v1/audit/verify", datastore.Admin, http.StatusBadRequest},
+		{"/v1/audit?from=yesterday", datastore.Superuser, http.StatusBadRequest},
+		{"/v1/audit?to=2020-01-01", datastore.Superuser, http.StatusBadRequest},
+	}
+
+	for _, t := range tests {
+		w := sendAdminRequest("GET", t.url, t.permissions, c)
+		c.Assert(w.Code, check.Equals, t.code)
+	}
+
+	datastore.Environ.DB = &datastore.ErrorMockDB{}
+	for _, url := range []string{"/v1/audit", "/v1/audit/verify"} {
+		w := sendAdminRequest("GET", url, datastore.Superuser, c)
+		c.Assert(w.Code, check.Equals, http.StatusBadRequest)
+	}
+}
+
+func (s *HandlersSuite) TestGetAuditLogParams(c *check.C) {
+	r, _ := http.NewRequest("GET", "/v1/audit?actor=sv&action=model:update&target=model/1&from=2020-01-01T00:00:00Z&offset=20&limit=5", nil)
+	params, err := audit.GetAuditLogParams(r)
+	c.Assert(err, check.IsNil)
+	c.Assert(params.Actor, check.Equals, "sv")
+	c.Assert(params.Action, check.Equals, "model:update")
+	c.Assert(params.Target, check.Equals, "model/1")
+	c.Assert(params.From.Year(), check.Equals, 2020)
+	c.Assert(params.To, check.IsNil)
+	c.Assert(params.Offset, check.Equals, uint64(20))
+	c.Assert(params.Limit, check.Equals, uint64(5))
+
+	r, _ = http.NewRequest("GET", "/v1/audit", nil)
+	params, err = audit.GetAuditLogParams(r)
+	c.Assert(err, check.IsNil)
+	c.Assert(params.Limit, check.Equals, uint64(datastore.AuditLogDefaultLimit))
+}
+
+func sendAdminRequest(method, url string, permissions int, c *check.C) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(method, url, nil)
+	r.RemoteAddr = "10.0.0.1:34567"
+
+	// Create a JWT and add it to the request
+	err := createJWTWithRole(r, permissions)
+	c.Assert(err, check.IsNil)
+
+	service.AdminRouter().ServeHTTP(w, r)
+
+	return w
+}
+
+func createJWTWithRole(r *http.Request, role int) error {
+	sreg := map[string]string{"nickname": "root", "fullname": "Root User", "email": "the_root_user@thisdb.com"}
+	resp := openid.Response{ID: "identity", Teams: []string{}, SReg: sreg}
+	jwtToken, err := usso.NewJWTToken(&resp, role)
+	if err != nil {
+		return fmt.Errorf("Error creating a JWT: %v", err)
+	}
+	r.Header.Set("Authorization", "Bearer "+jwtToken)
+	return nil
+}
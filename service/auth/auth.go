@@ -24,6 +24,7 @@ import (
 	"net/http"
 
 	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/request"
 	"github.com/CanonicalLtd/serial-vault/usso"
 	jwt "github.com/dgrijalva/jwt-go"
 )
@@ -37,7 +38,7 @@ func GetUserFromJWT(w http.ResponseWriter, r *http.Request) (datastore.User, err
 
 	// Null token means that auth is not enabled.
 	if token == nil {
-		return datastore.User{}, nil
+		return datastore.User{SourceIP: request.SourceIP(r)}, nil
 	}
 
 	claims := token.Claims.(jwt.MapClaims)
@@ -47,6 +48,7 @@ func GetUserFromJWT(w http.ResponseWriter, r *http.Request) (datastore.User, err
 	return datastore.User{
 		Username: username,
 		Role:     role,
+		SourceIP: request.SourceIP(r),
 	}, nil
 }
 
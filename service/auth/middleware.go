@@ -30,7 +30,7 @@ import (
 	jwt "github.com/dgrijalva/jwt-go"
 )
 
-// JWTCheck extracts the JWT from the request, validates it and returns the token
+// JWTCheck extracts the JWT from the request, validates it and its session, and returns the token
 func JWTCheck(w http.ResponseWriter, r *http.Request) (*jwt.Token, error) {
 
 	// Do not validate access if user authentication is off (default)
@@ -45,8 +45,8 @@ func JWTCheck(w http.ResponseWriter, r *http.Request) (*jwt.Token, error) {
 		return nil, errors.New("Error in retrieving the authentication token")
 	}
 
-	// Verify the JWT string
-	token, err := usso.VerifyJWT(jwtToken)
+	// Verify the JWT string and its session, refreshing the JWT when it is close to expiry
+	token, refreshed, err := usso.VerifySession(jwtToken)
 	if err != nil {
 		log.Printf("JWT fails verification: %v", err.Error())
 		return nil, errors.New("The authentication token is invalid")
@@ -57,6 +57,12 @@ func JWTCheck(w http.ResponseWriter, r *http.Request) (*jwt.Token, error) {
 		return nil, errors.New("The authentication token is invalid")
 	}
 
+	// Set up the refreshed token in the header and cookie
+	if len(refreshed) > 0 {
+		usso.AddJWTCookie(refreshed, w)
+		return token, nil
+	}
+
 	// Set up the bearer token in the header
 	w.Header().Set("Authorization", "Bearer "+jwtToken)
 
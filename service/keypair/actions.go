@@ -30,8 +30,10 @@ import (
 	"github.com/CanonicalLtd/serial-vault/service/log"
 
 	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/audit"
 	"github.com/CanonicalLtd/serial-vault/service/auth"
 	"github.com/CanonicalLtd/serial-vault/service/response"
+	"github.com/CanonicalLtd/serial-vault/webhook"
 	"github.com/snapcore/snapd/asserts"
 )
 
@@ -121,9 +123,18 @@ func updateHandler(w http.ResponseWriter, user datastore.User, apiCall bool, key
 	}
 
 	// Update the key name
+	before := k
 	k.KeyName = keypair.KeyName
 
-	errorCode, err := datastore.Environ.DB.PutKeypair(k)
+	var errorCode string
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		var err error
+		errorCode, err = db.PutKeypair(k)
+		if err != nil {
+			return err
+		}
+		return audit.Record(db, user, "keypair:update", fmt.Sprintf("keypair/%d", k.ID), before, k)
+	})
 	if err != nil {
 		response.FormatStandardResponse(false, errorCode, "", err.Error(), w)
 		return
@@ -142,6 +153,12 @@ func createHandler(w http.ResponseWriter, user datastore.User, apiCall bool, key
 		return
 	}
 
+	// Check that the user can create signing keys for the account
+	if !datastore.Environ.DB.AllowedPermission(user, keypairWithKey.AuthorityID, datastore.PermissionKeypairCreate) {
+		response.FormatStandardResponse(false, response.ErrorAuth.Code, "", "Your user does not have permissions to create signing keys for the Signing Authority", w)
+		return
+	}
+
 	if len(strings.TrimSpace(keypairWithKey.KeyName)) == 0 {
 		response.FormatStandardResponse(false, response.ErrorInvalidKeypair.Code, "", "The key name must be supplied", w)
 		return
@@ -161,7 +178,15 @@ func createHandler(w http.ResponseWriter, user datastore.User, apiCall bool, key
 		SealedKey:   sealedPrivateKey,
 		KeyName:     keypairWithKey.KeyName,
 	}
-	errorCode, err := datastore.Environ.DB.PutKeypair(keypair)
+	var errorCode string
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		var err error
+		errorCode, err = db.PutKeypair(keypair)
+		if err != nil {
+			return err
+		}
+		return audit.Record(db, user, "keypair:create", "keypair/"+keypair.AuthorityID+"/"+keypair.KeyID, nil, keypair)
+	})
 	if err != nil {
 		response.FormatStandardResponse(false, errorCode, "", err.Error(), w)
 		return
@@ -180,12 +205,28 @@ func generateHandler(w http.ResponseWriter, user datastore.User, apiCall bool, k
 		return
 	}
 
+	// Check that the user can create signing keys for the account
+	if !datastore.Environ.DB.AllowedPermission(user, keypairWithKey.AuthorityID, datastore.PermissionKeypairCreate) {
+		response.FormatStandardResponse(false, response.ErrorAuth.Code, "", "Your user does not have permissions to create signing keys for the Signing Authority", w)
+		return
+	}
+
 	if len(strings.TrimSpace(keypairWithKey.KeyName)) == 0 {
 		response.FormatStandardResponse(false, response.ErrorInvalidKeypair.Code, "", "The key name must be supplied", w)
 		return
 	}
 
-	go datastore.GenerateKeypair(keypairWithKey.AuthorityID, "", keypairWithKey.KeyName)
+	// The key is generated in the background, so it is recorded before it is started
+	err = audit.Record(datastore.Environ.DB, user, "keypair:generate", "keypair/"+keypairWithKey.AuthorityID+"/"+keypairWithKey.KeyName, nil, map[string]string{
+		"authority-id": keypairWithKey.AuthorityID,
+		"key-name":     keypairWithKey.KeyName,
+	})
+	if err != nil {
+		response.FormatStandardResponse(false, response.ErrorStoreKeypair.Code, "", err.Error(), w)
+		return
+	}
+
+	go generateKeypair(keypairWithKey.AuthorityID, keypairWithKey.KeyName)
 
 	// Return the URL to watch for the response
 	statusURL := fmt.Sprintf("/v1/keypairs/status/%s/%s", keypairWithKey.AuthorityID, keypairWithKey.KeyName)
@@ -194,6 +235,28 @@ func generateHandler(w http.ResponseWriter, user datastore.User, apiCall bool, k
 	response.FormatStandardResponse(true, "", "", statusURL, w)
 }
 
+// generateKeypair generates a signing key in the background, and sends it to the webhooks of the
+// account once it is stored
+func generateKeypair(authorityID, keyName string) {
+	if err := datastore.GenerateKeypair(authorityID, "", keyName); err != nil {
+		log.Printf("Error generating the signing key '%s': %v", keyName, err)
+	}
+
+	keypair, err := datastore.Environ.DB.GetKeypairByName(authorityID, keyName)
+	if err != nil {
+		return
+	}
+	webhook.Notify(authorityID, datastore.EventKeypairGenerated, keypairEvent(keypair))
+}
+
+func keypairEvent(keypair datastore.Keypair) map[string]interface{} {
+	return map[string]interface{}{
+		"authority-id": keypair.AuthorityID,
+		"key-id":       keypair.KeyID,
+		"key-name":     keypair.KeyName,
+	}
+}
+
 // enableDisableHandler is the API method to enable/disable a signing key
 func enableDisableHandler(w http.ResponseWriter, user datastore.User, apiCall bool, enabled bool, keypairID int) {
 	err := auth.CheckUserPermissions(user, datastore.Admin, apiCall)
@@ -202,13 +265,29 @@ func enableDisableHandler(w http.ResponseWriter, user datastore.User, apiCall bo
 		return
 	}
 
+	before, _ := datastore.Environ.DB.GetKeypair(keypairID)
+
+	action := "keypair:disable"
+	if enabled {
+		action = "keypair:enable"
+	}
+
 	// Update the keypair in the local database
-	err = datastore.Environ.DB.UpdateAllowedKeypairActive(keypairID, enabled, user)
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		if err := db.UpdateAllowedKeypairActive(keypairID, enabled, user); err != nil {
+			return err
+		}
+		return audit.Record(db, user, action, fmt.Sprintf("keypair/%d", keypairID), map[string]bool{"active": before.Active}, map[string]bool{"active": enabled})
+	})
 	if err != nil {
 		response.FormatStandardResponse(false, response.ErrorStoreKeypair.Code, "", err.Error(), w)
 		return
 	}
 
+	if !enabled && before.Active {
+		webhook.Notify(before.AuthorityID, datastore.EventKeypairDisabled, keypairEvent(before))
+	}
+
 	// Return success response
 	w.WriteHeader(http.StatusOK)
 	response.FormatStandardResponse(true, "", "", "", w)
@@ -255,7 +334,15 @@ func assertionHandler(w http.ResponseWriter, user datastore.User, apiCall bool,
 		Assertion:   string(decodedAssertion),
 	}
 
-	errorCode, err := datastore.Environ.DB.UpdateKeypairAssertion(keypair, user)
+	var errorCode string
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		var err error
+		errorCode, err = db.UpdateKeypairAssertion(keypair, user)
+		if err != nil {
+			return err
+		}
+		return audit.Record(db, user, "keypair:assertion", fmt.Sprintf("keypair/%d", keypair.ID), nil, map[string]string{"assertion": keypair.Assertion})
+	})
 	if err != nil {
 		response.FormatStandardResponse(false, errorCode, "", err.Error(), w)
 		return
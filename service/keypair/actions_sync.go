@@ -55,6 +55,12 @@ func syncHandler(w http.ResponseWriter, user datastore.User, apiCall bool, reque
 		}
 	}
 
+	// The signing-keys never leave a PKCS#11 token, so there is no sealed key to re-encrypt
+	if datastore.Environ.Config.KeyStoreType == datastore.PKCS11Store.Name {
+		response.FormatStandardResponse(false, "error-sync-keypairs", "", datastore.ErrorPKCS11Sync.Error(), w)
+		return
+	}
+
 	// Get the keypairs that the user can access (does not include the sealed key)
 	keypairs, err := datastore.Environ.DB.ListAllowedKeypairs(user)
 	if err != nil {
@@ -88,6 +88,18 @@ func (s *KeypairSuite) TestAPISyncKeypairsHandler(c *check.C) {
 
 		datastore.Environ.Config.EnableUserAuth = false
 	}
+
+	// The signing-keys on a PKCS#11 token cannot be synced
+	datastore.Environ.Config.KeyStoreType = "pkcs11"
+	defer func() { datastore.Environ.Config.KeyStoreType = "filesystem" }()
+	datastore.Environ.Config.EnableUserAuth = true
+	defer func() { datastore.Environ.Config.EnableUserAuth = false }()
+
+	w := sendAdminAPIRequest("POST", "/api/keypairs/sync", bytes.NewReader(data), datastore.SyncUser, c)
+	c.Assert(w.Code, check.Equals, 400)
+	result, err := parseSyncResponse(w)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Success, check.Equals, false)
 }
 
 func sendAdminAPIRequest(method, url string, data io.Reader, permissions int, c *check.C) *httptest.ResponseRecorder {
@@ -29,6 +29,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/CanonicalLtd/serial-vault/config"
@@ -260,6 +261,52 @@ func (s *KeypairSuite) TestCreateKeyStoreError(c *check.C) {
 	}
 }
 
+func (s *KeypairSuite) TestCreateGenerateWithoutPermission(c *check.C) {
+	// Mock the database and the keystore
+	config := config.Settings{KeyStoreType: "memory", EnableUserAuth: true, JwtSecret: "SomeTestSecretValue"}
+	datastore.Environ = &datastore.Env{DB: &datastore.MockDB{}, Config: config}
+	datastore.Environ.KeypairDB, _ = datastore.GetMemoryKeyStore(config)
+
+	// The user can only read the signing logs of the account
+	signingKey, err := ioutil.ReadFile("../../keystore/TestKey.asc")
+	c.Assert(err, check.IsNil)
+	encodedSigningKey := base64.StdEncoding.EncodeToString(signingKey)
+	data, _ := json.Marshal(keypair.WithPrivateKey{PrivateKey: string(encodedSigningKey), AuthorityID: "readonly", KeyName: "serial-key"})
+
+	for _, url := range []string{"/v1/keypairs", "/v1/keypairs/generate"} {
+		w := sendAdminRequest("POST", url, bytes.NewReader(data), datastore.Admin, c)
+		c.Assert(w.Code, check.Equals, 400)
+
+		result, err := response.ParseStandardResponse(w)
+		c.Assert(err, check.IsNil)
+		c.Assert(result.Success, check.Equals, false)
+		c.Assert(result.ErrorCode, check.Equals, response.ErrorAuth.Code)
+	}
+}
+
+func (s *KeypairSuite) TestActiveWithoutPermission(c *check.C) {
+	config := config.Settings{EnableUserAuth: true, JwtSecret: "SomeTestSecretValue"}
+	datastore.Environ = &datastore.Env{DB: &datastore.MockDB{}, Config: config}
+
+	// The admin can only read the signing logs of the keypair's account
+	sreg := map[string]string{"nickname": "reader", "fullname": "Log Reader", "email": "reader@example.com"}
+	jwtToken, err := usso.NewJWTToken(&openid.Response{ID: "identity", Teams: []string{}, SReg: sreg}, datastore.Admin)
+	c.Assert(err, check.IsNil)
+
+	for _, url := range []string{"/v1/keypairs/1/disable", "/v1/keypairs/1/enable"} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("POST", url, nil)
+		r.Header.Set("Authorization", "Bearer "+jwtToken)
+		service.AdminRouter().ServeHTTP(w, r)
+		c.Assert(w.Code, check.Equals, 400)
+
+		result, err := response.ParseStandardResponse(w)
+		c.Assert(err, check.IsNil)
+		c.Assert(result.Success, check.Equals, false)
+		c.Assert(strings.Contains(result.ErrorMessage, datastore.PermissionKeypairCreate), check.Equals, true)
+	}
+}
+
 func (s *KeypairSuite) TestAssertionHandler(c *check.C) {
 	// Create the account key assertion
 	assertAcc, err := generateAccountAssertion(asserts.AccountKeyType, "alder", "maple-inc")
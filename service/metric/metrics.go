@@ -41,10 +41,20 @@ var HTTPIncomingTimeoutsCounterVec = prometheus.NewCounterVec(
 	[]string{"method", "view"},
 )
 
+// APIKeyQuotaUsageGaugeVec is prometheus metric for the daily and monthly usage of the model API keys
+var APIKeyQuotaUsageGaugeVec = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "api_key_quota_usage",
+		Help: "metric for the daily and monthly usage of the model API keys",
+	},
+	[]string{"brand", "model", "period"},
+)
+
 // InitMetrics register all the metrics
 func InitMetrics() {
 	prometheus.MustRegister(HTTPIncomingRequestCounterVec)
 	prometheus.MustRegister(HTTPIncomingLatencyHistogramVec)
 	prometheus.MustRegister(HTTPIncomingErrorsCounterVec)
 	prometheus.MustRegister(HTTPIncomingTimeoutsCounterVec)
+	prometheus.MustRegister(APIKeyQuotaUsageGaugeVec)
 }
@@ -21,11 +21,13 @@ package model
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 
 	"github.com/CanonicalLtd/serial-vault/service/log"
 
 	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/audit"
 	"github.com/CanonicalLtd/serial-vault/service/auth"
 	"github.com/CanonicalLtd/serial-vault/service/response"
 )
@@ -48,6 +50,24 @@ type InstanceResponse struct {
 	Model        datastore.Model `json:"model"`
 }
 
+// KeyRotationListResponse is the JSON response from the API Key Rotations method
+type KeyRotationListResponse struct {
+	Success      bool                    `json:"success"`
+	ErrorCode    string                  `json:"error_code"`
+	ErrorSubcode string                  `json:"error_subcode"`
+	ErrorMessage string                  `json:"message"`
+	KeyRotations []datastore.KeyRotation `json:"keyrotations"`
+}
+
+// KeyRotationResponse is the JSON response from the API Create Key Rotation method
+type KeyRotationResponse struct {
+	Success      bool                  `json:"success"`
+	ErrorCode    string                `json:"error_code"`
+	ErrorSubcode string                `json:"error_subcode"`
+	ErrorMessage string                `json:"message"`
+	KeyRotation  datastore.KeyRotation `json:"keyrotation"`
+}
+
 // listHandler is the API method to fetch the user records
 func listHandler(w http.ResponseWriter, user datastore.User, apiCall bool) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
@@ -106,7 +126,17 @@ func updateHandler(w http.ResponseWriter, user datastore.User, apiCall bool, mod
 		return
 	}
 
-	errorSubcode, err := datastore.Environ.DB.UpdateAllowedModel(mdl, user)
+	before, _ := datastore.Environ.DB.GetAllowedModel(mdl.ID, user)
+
+	var errorSubcode string
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		var err error
+		errorSubcode, err = db.UpdateAllowedModel(mdl, user)
+		if err != nil {
+			return err
+		}
+		return audit.Record(db, user, "model:update", fmt.Sprintf("model/%d", mdl.ID), before, mdl)
+	})
 	if err != nil {
 		log.Println(err)
 		response.FormatStandardResponse(false, "error-updating-model", errorSubcode, err.Error(), w)
@@ -128,7 +158,17 @@ func deleteHandler(w http.ResponseWriter, user datastore.User, apiCall bool, mod
 	}
 
 	mdl := datastore.Model{ID: modelID}
-	errorSubcode, err := datastore.Environ.DB.DeleteAllowedModel(mdl, user)
+	before, _ := datastore.Environ.DB.GetAllowedModel(modelID, user)
+
+	var errorSubcode string
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		var err error
+		errorSubcode, err = db.DeleteAllowedModel(mdl, user)
+		if err != nil {
+			return err
+		}
+		return audit.Record(db, user, "model:delete", fmt.Sprintf("model/%d", modelID), before, nil)
+	})
 	if err != nil {
 		log.Println(err)
 		response.FormatStandardResponse(false, "error-deleting-model", errorSubcode, err.Error(), w)
@@ -149,7 +189,16 @@ func createHandler(w http.ResponseWriter, user datastore.User, apiCall bool, mdl
 		return
 	}
 
-	allowedModel, errorSubcode, err := datastore.Environ.DB.CreateAllowedModel(mdl, user)
+	var allowedModel datastore.Model
+	var errorSubcode string
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		var err error
+		allowedModel, errorSubcode, err = db.CreateAllowedModel(mdl, user)
+		if err != nil {
+			return err
+		}
+		return audit.Record(db, user, "model:create", fmt.Sprintf("model/%d", allowedModel.ID), nil, allowedModel)
+	})
 	if err != nil {
 		log.Println(err)
 		response.FormatStandardResponse(false, "error-model-json", errorSubcode, err.Error(), w)
@@ -178,7 +227,12 @@ func assertionHeaders(w http.ResponseWriter, user datastore.User, apiCall bool,
 		return
 	}
 
-	err = datastore.Environ.DB.UpsertModelAssert(assert)
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		if err := db.UpsertModelAssert(assert); err != nil {
+			return err
+		}
+		return audit.Record(db, user, "model:assertion", fmt.Sprintf("model/%d", assert.ModelID), nil, assert)
+	})
 	if err != nil {
 		log.Println(err)
 		response.FormatStandardResponse(false, "create-assertion", "", err.Error(), w)
@@ -189,6 +243,82 @@ func assertionHeaders(w http.ResponseWriter, user datastore.User, apiCall bool,
 	response.FormatStandardResponse(true, "", "", "", w)
 }
 
+// keyRotationListHandler is the API method to fetch the key rotations of a model
+func keyRotationListHandler(w http.ResponseWriter, user datastore.User, apiCall bool, modelID int) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.Admin, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	rotations, err := datastore.Environ.DB.ListAllowedKeyRotations(modelID, user)
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-fetch-keyrotations", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	formatKeyRotationListResponse(rotations, w)
+}
+
+// keyRotationCreateHandler is the API method to schedule the rotation of a model's key
+func keyRotationCreateHandler(w http.ResponseWriter, user datastore.User, apiCall bool, modelID int, rotation datastore.KeyRotation) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.Admin, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	rotation.ModelID = modelID
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		var err error
+		rotation, err = db.CreateAllowedKeyRotation(rotation, user)
+		if err != nil {
+			return err
+		}
+		return audit.Record(db, user, "model:keyrotation-create", fmt.Sprintf("model/%d/keyrotation/%d", modelID, rotation.ID), nil, rotation)
+	})
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-creating-keyrotation", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	formatKeyRotationResponse(rotation, w)
+}
+
+// keyRotationDeleteHandler is the API method to cancel a scheduled key rotation
+func keyRotationDeleteHandler(w http.ResponseWriter, user datastore.User, apiCall bool, modelID, rotationID int) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.Admin, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		if err := db.DeleteAllowedKeyRotation(modelID, rotationID, user); err != nil {
+			return err
+		}
+		return audit.Record(db, user, "model:keyrotation-delete", fmt.Sprintf("model/%d/keyrotation/%d", modelID, rotationID), nil, nil)
+	})
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-deleting-keyrotation", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response.FormatStandardResponse(true, "", "", "", w)
+}
+
 func formatListResponse(models []datastore.Model, w http.ResponseWriter) error {
 	response := ListResponse{Success: true, Models: models}
 
@@ -210,3 +340,25 @@ func formatInstanceResponse(model datastore.Model, w http.ResponseWriter) error
 	}
 	return nil
 }
+
+func formatKeyRotationListResponse(rotations []datastore.KeyRotation, w http.ResponseWriter) error {
+	response := KeyRotationListResponse{Success: true, KeyRotations: rotations}
+
+	// Encode the response as JSON
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error forming the key rotations response (%v).\n %v", response, err)
+		return err
+	}
+	return nil
+}
+
+func formatKeyRotationResponse(rotation datastore.KeyRotation, w http.ResponseWriter) error {
+	response := KeyRotationResponse{Success: true, KeyRotation: rotation}
+
+	// Encode the response as JSON
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error forming the key rotation response (%v).\n %v", response, err)
+		return err
+	}
+	return nil
+}
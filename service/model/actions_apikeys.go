@@ -0,0 +1,150 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/audit"
+	"github.com/CanonicalLtd/serial-vault/service/auth"
+	"github.com/CanonicalLtd/serial-vault/service/log"
+	"github.com/CanonicalLtd/serial-vault/service/response"
+)
+
+// APIKeyListResponse is the JSON response from the API Model API Key List method
+type APIKeyListResponse struct {
+	Success      bool                    `json:"success"`
+	ErrorCode    string                  `json:"error_code"`
+	ErrorSubcode string                  `json:"error_subcode"`
+	ErrorMessage string                  `json:"message"`
+	APIKeys      []datastore.ModelAPIKey `json:"apikeys"`
+}
+
+// APIKeyResponse is the JSON response from the API Model API Key Create method
+type APIKeyResponse struct {
+	Success      bool                  `json:"success"`
+	ErrorCode    string                `json:"error_code"`
+	ErrorSubcode string                `json:"error_subcode"`
+	ErrorMessage string                `json:"message"`
+	APIKey       datastore.ModelAPIKey `json:"apikey"`
+}
+
+// apiKeyListHandler is the API method to fetch the named API keys of a model. The sync user
+// fetches the key hashes for the factory
+func apiKeyListHandler(w http.ResponseWriter, user datastore.User, apiCall bool, modelID int) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.SyncUser, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	keys, err := datastore.Environ.DB.ListAllowedModelAPIKeys(modelID, user)
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-fetch-apikeys", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	formatAPIKeyListResponse(keys, w)
+}
+
+// apiKeyCreateHandler is the API method to mint a named API key for a model. The response
+// holds the new API key, which cannot be retrieved later
+func apiKeyCreateHandler(w http.ResponseWriter, user datastore.User, apiCall bool, modelID int, key datastore.ModelAPIKey) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.Admin, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	key.ModelID = modelID
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		var err error
+		key, err = db.CreateAllowedModelAPIKey(key, user)
+		if err != nil {
+			return err
+		}
+		return audit.Record(db, user, "model:apikey-create", fmt.Sprintf("model/%d/apikey/%d", modelID, key.ID), nil, key)
+	})
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-creating-apikey", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	formatAPIKeyResponse(key, w)
+}
+
+// apiKeyRevokeHandler is the API method to revoke a named API key of a model
+func apiKeyRevokeHandler(w http.ResponseWriter, user datastore.User, apiCall bool, modelID, keyID int) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.Admin, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		if err := db.RevokeAllowedModelAPIKey(modelID, keyID, user); err != nil {
+			return err
+		}
+		return audit.Record(db, user, "model:apikey-revoke", fmt.Sprintf("model/%d/apikey/%d", modelID, keyID), nil, nil)
+	})
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-revoking-apikey", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response.FormatStandardResponse(true, "", "", "", w)
+}
+
+func formatAPIKeyListResponse(keys []datastore.ModelAPIKey, w http.ResponseWriter) error {
+	response := APIKeyListResponse{Success: true, APIKeys: keys}
+
+	// Encode the response as JSON
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error forming the model API keys response (%v).\n %v", response, err)
+		return err
+	}
+	return nil
+}
+
+func formatAPIKeyResponse(key datastore.ModelAPIKey, w http.ResponseWriter) error {
+	response := APIKeyResponse{Success: true, APIKey: key}
+
+	// Encode the response as JSON
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error forming the model API key response.\n %v", err)
+		return err
+	}
+	return nil
+}
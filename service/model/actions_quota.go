@@ -0,0 +1,103 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/audit"
+	"github.com/CanonicalLtd/serial-vault/service/auth"
+	"github.com/CanonicalLtd/serial-vault/service/log"
+	"github.com/CanonicalLtd/serial-vault/service/response"
+)
+
+// QuotaResponse is the JSON response from the API Model Quota methods
+type QuotaResponse struct {
+	Success      bool                 `json:"success"`
+	ErrorCode    string               `json:"error_code"`
+	ErrorSubcode string               `json:"error_subcode"`
+	ErrorMessage string               `json:"message"`
+	Quota        datastore.ModelQuota `json:"quota"`
+}
+
+// quotaGetHandler is the API method to fetch the rate limit, quotas and usage of a model
+func quotaGetHandler(w http.ResponseWriter, user datastore.User, apiCall bool, modelID int) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.Admin, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	quota, err := datastore.Environ.DB.GetAllowedModelQuota(modelID, user)
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-fetch-quota", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	formatQuotaResponse(quota, w)
+}
+
+// quotaUpdateHandler is the API method to set the rate limit and quotas of a model
+func quotaUpdateHandler(w http.ResponseWriter, user datastore.User, apiCall bool, modelID int, quota datastore.ModelQuota) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.Admin, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	before, _ := datastore.Environ.DB.GetAllowedModelQuota(modelID, user)
+
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		var err error
+		quota, err = db.UpdateAllowedModelQuota(modelID, quota, user)
+		if err != nil {
+			return err
+		}
+		return audit.Record(db, user, "model:quota-update", fmt.Sprintf("model/%d/quota", modelID), before, quota)
+	})
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-updating-quota", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	formatQuotaResponse(quota, w)
+}
+
+func formatQuotaResponse(quota datastore.ModelQuota, w http.ResponseWriter) error {
+	response := QuotaResponse{Success: true, Quota: quota}
+
+	// Encode the response as JSON
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error forming the model quota response (%v).\n %v", response, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/audit"
+	"github.com/CanonicalLtd/serial-vault/service/auth"
+	"github.com/CanonicalLtd/serial-vault/service/log"
+	"github.com/CanonicalLtd/serial-vault/service/response"
+)
+
+// RemodelRuleListResponse is the JSON response from the API Remodel Rule List method
+type RemodelRuleListResponse struct {
+	Success      bool                    `json:"success"`
+	ErrorCode    string                  `json:"error_code"`
+	ErrorSubcode string                  `json:"error_subcode"`
+	ErrorMessage string                  `json:"message"`
+	Rules        []datastore.RemodelRule `json:"remodels"`
+}
+
+// RemodelRuleResponse is the JSON response from the API Remodel Rule Create method
+type RemodelRuleResponse struct {
+	Success      bool                  `json:"success"`
+	ErrorCode    string                `json:"error_code"`
+	ErrorSubcode string                `json:"error_subcode"`
+	ErrorMessage string                `json:"message"`
+	Rule         datastore.RemodelRule `json:"remodel"`
+}
+
+// RemodelHistoryResponse is the JSON response from the API Remodel History method
+type RemodelHistoryResponse struct {
+	Success      bool                       `json:"success"`
+	ErrorCode    string                     `json:"error_code"`
+	ErrorSubcode string                     `json:"error_subcode"`
+	ErrorMessage string                     `json:"message"`
+	History      []datastore.RemodelHistory `json:"history"`
+}
+
+// remodelRuleListHandler is the API method to fetch the remodel rules of a model
+func remodelRuleListHandler(w http.ResponseWriter, user datastore.User, apiCall bool, modelID int) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.Admin, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	rules, err := datastore.Environ.DB.ListAllowedRemodelRules(modelID, user)
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-fetch-remodels", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	formatRemodelRuleListResponse(rules, w)
+}
+
+// remodelRuleCreateHandler is the API method to allow a model to be remodelled to another model
+func remodelRuleCreateHandler(w http.ResponseWriter, user datastore.User, apiCall bool, modelID int, rule datastore.RemodelRule) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.Admin, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		var err error
+		rule, err = db.CreateAllowedRemodelRule(modelID, rule, user)
+		if err != nil {
+			return err
+		}
+		return audit.Record(db, user, "model:remodel-create", fmt.Sprintf("model/%d/remodel/%d", modelID, rule.ID), nil, rule)
+	})
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-creating-remodel", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	formatRemodelRuleResponse(rule, w)
+}
+
+// remodelRuleDeleteHandler is the API method to remove a remodel rule of a model
+func remodelRuleDeleteHandler(w http.ResponseWriter, user datastore.User, apiCall bool, modelID, ruleID int) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.Admin, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		if err := db.DeleteAllowedRemodelRule(modelID, ruleID, user); err != nil {
+			return err
+		}
+		return audit.Record(db, user, "model:remodel-delete", fmt.Sprintf("model/%d/remodel/%d", modelID, ruleID), nil, nil)
+	})
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-deleting-remodel", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response.FormatStandardResponse(true, "", "", "", w)
+}
+
+// remodelHistoryHandler is the API method to fetch the devices that were remodelled from or to a model
+func remodelHistoryHandler(w http.ResponseWriter, user datastore.User, apiCall bool, modelID int) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.Admin, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	history, err := datastore.Environ.DB.ListAllowedRemodelHistory(modelID, user)
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-fetch-remodel-history", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	formatRemodelHistoryResponse(history, w)
+}
+
+func formatRemodelRuleListResponse(rules []datastore.RemodelRule, w http.ResponseWriter) error {
+	response := RemodelRuleListResponse{Success: true, Rules: rules}
+
+	// Encode the response as JSON
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error forming the remodel rules response (%v).\n %v", response, err)
+		return err
+	}
+	return nil
+}
+
+func formatRemodelRuleResponse(rule datastore.RemodelRule, w http.ResponseWriter) error {
+	response := RemodelRuleResponse{Success: true, Rule: rule}
+
+	// Encode the response as JSON
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error forming the remodel rule response (%v).\n %v", response, err)
+		return err
+	}
+	return nil
+}
+
+func formatRemodelHistoryResponse(history []datastore.RemodelHistory, w http.ResponseWriter) error {
+	response := RemodelHistoryResponse{Success: true, History: history}
+
+	// Encode the response as JSON
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error forming the remodel history response (%v).\n %v", response, err)
+		return err
+	}
+	return nil
+}
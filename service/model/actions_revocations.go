@@ -0,0 +1,148 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/audit"
+	"github.com/CanonicalLtd/serial-vault/service/auth"
+	"github.com/CanonicalLtd/serial-vault/service/log"
+	"github.com/CanonicalLtd/serial-vault/service/response"
+)
+
+// RevocationListResponse is the JSON response from the API Serial Revocation List method
+type RevocationListResponse struct {
+	Success      bool                         `json:"success"`
+	ErrorCode    string                       `json:"error_code"`
+	ErrorSubcode string                       `json:"error_subcode"`
+	ErrorMessage string                       `json:"message"`
+	Revocations  []datastore.SerialRevocation `json:"revocations"`
+}
+
+// RevocationResponse is the JSON response from the API Serial Revocation Create method
+type RevocationResponse struct {
+	Success      bool                       `json:"success"`
+	ErrorCode    string                     `json:"error_code"`
+	ErrorSubcode string                     `json:"error_subcode"`
+	ErrorMessage string                     `json:"message"`
+	Revocation   datastore.SerialRevocation `json:"revocation"`
+}
+
+// revocationListHandler is the API method to fetch the revoked serial assertions of a model. The
+// sync user fetches the revocations for the factory
+func revocationListHandler(w http.ResponseWriter, user datastore.User, apiCall bool, modelID int) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.SyncUser, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	revocations, err := datastore.Environ.DB.ListAllowedSerialRevocations(modelID, user)
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-fetch-revocations", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	formatRevocationListResponse(revocations, w)
+}
+
+// revocationCreateHandler is the API method to revoke a serial assertion of a model
+func revocationCreateHandler(w http.ResponseWriter, user datastore.User, apiCall bool, modelID int, revocation datastore.SerialRevocation) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.Admin, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		var err error
+		revocation, err = db.CreateAllowedSerialRevocation(modelID, revocation, user)
+		if err != nil {
+			return err
+		}
+		return audit.Record(db, user, "model:revocation-create", fmt.Sprintf("model/%d/revocation/%d", modelID, revocation.ID), nil, revocation)
+	})
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-revoking-serial", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	formatRevocationResponse(revocation, w)
+}
+
+// revocationDeleteHandler is the API method to remove the revocation of a serial assertion of a model
+func revocationDeleteHandler(w http.ResponseWriter, user datastore.User, apiCall bool, modelID, revocationID int) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.Admin, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		if err := db.DeleteAllowedSerialRevocation(modelID, revocationID, user); err != nil {
+			return err
+		}
+		return audit.Record(db, user, "model:revocation-delete", fmt.Sprintf("model/%d/revocation/%d", modelID, revocationID), nil, nil)
+	})
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-deleting-revocation", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response.FormatStandardResponse(true, "", "", "", w)
+}
+
+func formatRevocationListResponse(revocations []datastore.SerialRevocation, w http.ResponseWriter) error {
+	response := RevocationListResponse{Success: true, Revocations: revocations}
+
+	// Encode the response as JSON
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error forming the serial revocations response (%v).\n %v", response, err)
+		return err
+	}
+	return nil
+}
+
+func formatRevocationResponse(revocation datastore.SerialRevocation, w http.ResponseWriter) error {
+	response := RevocationResponse{Success: true, Revocation: revocation}
+
+	// Encode the response as JSON
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error forming the serial revocation response (%v).\n %v", response, err)
+		return err
+	}
+	return nil
+}
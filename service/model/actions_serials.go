@@ -0,0 +1,211 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package model
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/audit"
+	"github.com/CanonicalLtd/serial-vault/service/auth"
+	"github.com/CanonicalLtd/serial-vault/service/log"
+	"github.com/CanonicalLtd/serial-vault/service/response"
+)
+
+// SerialListResponse is the JSON response from the API Serial Allowlist method
+type SerialListResponse struct {
+	Success      bool                        `json:"success"`
+	ErrorCode    string                      `json:"error_code"`
+	ErrorSubcode string                      `json:"error_subcode"`
+	ErrorMessage string                      `json:"message"`
+	Serials      []datastore.SerialAllowlist `json:"serials"`
+}
+
+// SerialImportResponse is the JSON response from the API Import Serial Allowlist method
+type SerialImportResponse struct {
+	Success      bool   `json:"success"`
+	ErrorCode    string `json:"error_code"`
+	ErrorSubcode string `json:"error_subcode"`
+	ErrorMessage string `json:"message"`
+	Count        int    `json:"count"`
+}
+
+// serialListHandler is the API method to fetch a page of the serial number allowlist of a model,
+// after a serial number. The sync user fetches the allowlist for the factory
+func serialListHandler(w http.ResponseWriter, user datastore.User, apiCall bool, modelID int, status, after string) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.SyncUser, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	switch status {
+	case "", datastore.SerialStatusPending, datastore.SerialStatusSigned, datastore.SerialStatusRevoked:
+	default:
+		response.FormatStandardResponse(false, "error-invalid-status", "", "The serial number status is invalid", w)
+		return
+	}
+
+	serials, err := datastore.Environ.DB.ListAllowedSerialAllowlist(modelID, status, after, user)
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-fetch-serials", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	formatSerialListResponse(serials, w)
+}
+
+// serialImportHandler is the API method to import serial numbers into the allowlist of a model
+func serialImportHandler(w http.ResponseWriter, user datastore.User, apiCall bool, modelID int, serials []datastore.SerialAllowlistImport) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.Admin, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	var count int
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		var err error
+		count, err = db.ImportAllowedSerialAllowlist(modelID, serials, user)
+		if err != nil {
+			return err
+		}
+		return audit.Record(db, user, "model:serial-import", fmt.Sprintf("model/%d/serials", modelID), nil, map[string]int{"imported": count})
+	})
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-import-serials", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	formatSerialImportResponse(count, w)
+}
+
+// serialDeleteHandler is the API method to remove a serial number from the allowlist of a model
+func serialDeleteHandler(w http.ResponseWriter, user datastore.User, apiCall bool, modelID, serialID int) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.Admin, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		if err := db.DeleteAllowedSerialAllowlist(modelID, serialID, user); err != nil {
+			return err
+		}
+		return audit.Record(db, user, "model:serial-delete", fmt.Sprintf("model/%d/serials/%d", modelID, serialID), nil, nil)
+	})
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-deleting-serial", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response.FormatStandardResponse(true, "", "", "", w)
+}
+
+// decodeSerialImport decodes the serial numbers and ranges from the request body. The body is
+// either a JSON list, or CSV with the serial number and an optional serial number for the end of a range
+func decodeSerialImport(r *http.Request) ([]datastore.SerialAllowlistImport, error) {
+	defer r.Body.Close()
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		return decodeSerialImportCSV(r.Body)
+	}
+
+	serials := []datastore.SerialAllowlistImport{}
+	err := json.NewDecoder(r.Body).Decode(&serials)
+	if err == io.EOF {
+		return nil, errors.New("No serial numbers supplied")
+	}
+	return serials, err
+}
+
+func decodeSerialImportCSV(body io.Reader) ([]datastore.SerialAllowlistImport, error) {
+	serials := []datastore.SerialAllowlistImport{}
+
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Skip the header row
+		if len(serials) == 0 && record[0] == "serial-number" {
+			continue
+		}
+
+		s := datastore.SerialAllowlistImport{SerialNumber: strings.TrimSpace(record[0])}
+		if len(record) > 1 {
+			s.SerialNumberEnd = strings.TrimSpace(record[1])
+		}
+		serials = append(serials, s)
+	}
+
+	if len(serials) == 0 {
+		return nil, errors.New("No serial numbers supplied")
+	}
+	return serials, nil
+}
+
+func formatSerialListResponse(serials []datastore.SerialAllowlist, w http.ResponseWriter) error {
+	response := SerialListResponse{Success: true, Serials: serials}
+
+	// Encode the response as JSON
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error forming the serial numbers response (%v).\n %v", response, err)
+		return err
+	}
+	return nil
+}
+
+func formatSerialImportResponse(count int, w http.ResponseWriter) error {
+	response := SerialImportResponse{Success: true, Count: count}
+
+	// Encode the response as JSON
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error forming the serial import response (%v).\n %v", response, err)
+		return err
+	}
+	return nil
+}
@@ -174,3 +174,456 @@ func APIAssertionHeaders(w http.ResponseWriter, r *http.Request) {
 
 	assertionHeaders(w, user, true, assert)
 }
+
+// APIKeyRotationList is the API method to fetch the key rotations of a model
+func APIKeyRotationList(w http.ResponseWriter, r *http.Request) {
+	// Validate the user and API key
+	user, err := request.CheckUserAPI(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+
+	keyRotationListHandler(w, user, true, modelID)
+}
+
+// APIKeyRotationCreate is the API method to schedule the rotation of a model's key
+func APIKeyRotationCreate(w http.ResponseWriter, r *http.Request) {
+	// Validate the user and API key
+	user, err := request.CheckUserAPI(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+
+	defer r.Body.Close()
+
+	// Decode the JSON body
+	rotation := datastore.KeyRotation{}
+	err = json.NewDecoder(r.Body).Decode(&rotation)
+	switch {
+	// Check we have some data
+	case err == io.EOF:
+		response.FormatStandardResponse(false, "error-keyrotation-data", "", "No key rotation data supplied", w)
+		return
+		// Check for parsing errors
+	case err != nil:
+		response.FormatStandardResponse(false, "error-decode-json", "", err.Error(), w)
+		return
+	}
+
+	keyRotationCreateHandler(w, user, true, modelID, rotation)
+}
+
+// APIKeyRotationDelete is the API method to cancel a scheduled key rotation
+func APIKeyRotationDelete(w http.ResponseWriter, r *http.Request) {
+	// Validate the user and API key
+	user, err := request.CheckUserAPI(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+	rotationID, err := strconv.Atoi(vars["rotationID"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-keyrotation", "", err.Error(), w)
+		return
+	}
+
+	keyRotationDeleteHandler(w, user, true, modelID, rotationID)
+}
+
+// APISerialList is the API method to fetch the serial number allowlist of a model
+func APISerialList(w http.ResponseWriter, r *http.Request) {
+	// Validate the user and API key
+	user, err := request.CheckUserAPI(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+
+	serialListHandler(w, user, true, modelID, r.URL.Query().Get("status"), r.URL.Query().Get("after"))
+}
+
+// APISerialImport is the API method to import serial numbers and ranges into the allowlist of a model, as JSON or CSV
+func APISerialImport(w http.ResponseWriter, r *http.Request) {
+	// Validate the user and API key
+	user, err := request.CheckUserAPI(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+
+	serials, err := decodeSerialImport(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-decode-serials", "", err.Error(), w)
+		return
+	}
+
+	serialImportHandler(w, user, true, modelID, serials)
+}
+
+// APISerialDelete is the API method to remove a serial number from the allowlist of a model
+func APISerialDelete(w http.ResponseWriter, r *http.Request) {
+	// Validate the user and API key
+	user, err := request.CheckUserAPI(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+	serialID, err := strconv.Atoi(vars["serialID"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-serial", "", err.Error(), w)
+		return
+	}
+
+	serialDeleteHandler(w, user, true, modelID, serialID)
+}
+
+// APIRevocationList is the API method to fetch the revoked serial assertions of a model
+func APIRevocationList(w http.ResponseWriter, r *http.Request) {
+	// Validate the user and API key
+	user, err := request.CheckUserAPI(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+
+	revocationListHandler(w, user, true, modelID)
+}
+
+// APIRevocationCreate is the API method to revoke a serial assertion of a model
+func APIRevocationCreate(w http.ResponseWriter, r *http.Request) {
+	// Validate the user and API key
+	user, err := request.CheckUserAPI(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+
+	defer r.Body.Close()
+
+	// Decode the JSON body
+	revocation := datastore.SerialRevocation{}
+	err = json.NewDecoder(r.Body).Decode(&revocation)
+	switch {
+	// Check we have some data
+	case err == io.EOF:
+		response.FormatStandardResponse(false, "error-revocation-data", "", "No serial revocation data supplied", w)
+		return
+		// Check for parsing errors
+	case err != nil:
+		response.FormatStandardResponse(false, "error-decode-json", "", err.Error(), w)
+		return
+	}
+
+	revocationCreateHandler(w, user, true, modelID, revocation)
+}
+
+// APIRevocationDelete is the API method to remove the revocation of a serial assertion of a model
+func APIRevocationDelete(w http.ResponseWriter, r *http.Request) {
+	// Validate the user and API key
+	user, err := request.CheckUserAPI(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+	revocationID, err := strconv.Atoi(vars["revocationID"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-revocation", "", err.Error(), w)
+		return
+	}
+
+	revocationDeleteHandler(w, user, true, modelID, revocationID)
+}
+
+// APIRemodelRuleList is the API method to fetch the remodel rules of a model
+func APIRemodelRuleList(w http.ResponseWriter, r *http.Request) {
+	// Validate the user and API key
+	user, err := request.CheckUserAPI(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+
+	remodelRuleListHandler(w, user, true, modelID)
+}
+
+// APIRemodelRuleCreate is the API method to allow a model to be remodelled to another model
+func APIRemodelRuleCreate(w http.ResponseWriter, r *http.Request) {
+	// Validate the user and API key
+	user, err := request.CheckUserAPI(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+
+	defer r.Body.Close()
+
+	// Decode the JSON body
+	rule := datastore.RemodelRule{}
+	err = json.NewDecoder(r.Body).Decode(&rule)
+	switch {
+	// Check we have some data
+	case err == io.EOF:
+		response.FormatStandardResponse(false, "error-remodel-data", "", "No remodel rule data supplied", w)
+		return
+		// Check for parsing errors
+	case err != nil:
+		response.FormatStandardResponse(false, "error-decode-json", "", err.Error(), w)
+		return
+	}
+
+	remodelRuleCreateHandler(w, user, true, modelID, rule)
+}
+
+// APIRemodelRuleDelete is the API method to remove a remodel rule of a model
+func APIRemodelRuleDelete(w http.ResponseWriter, r *http.Request) {
+	// Validate the user and API key
+	user, err := request.CheckUserAPI(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+	ruleID, err := strconv.Atoi(vars["ruleID"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-remodel", "", err.Error(), w)
+		return
+	}
+
+	remodelRuleDeleteHandler(w, user, true, modelID, ruleID)
+}
+
+// APIRemodelHistory is the API method to fetch the devices that were remodelled from or to a model
+func APIRemodelHistory(w http.ResponseWriter, r *http.Request) {
+	// Validate the user and API key
+	user, err := request.CheckUserAPI(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+
+	remodelHistoryHandler(w, user, true, modelID)
+}
+
+// APIQuotaGet is the API method to fetch the rate limit, quotas and usage of a model
+func APIQuotaGet(w http.ResponseWriter, r *http.Request) {
+	// Validate the user and API key
+	user, err := request.CheckUserAPI(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+
+	quotaGetHandler(w, user, true, modelID)
+}
+
+// APIQuotaUpdate is the API method to set the rate limit and quotas of a model
+func APIQuotaUpdate(w http.ResponseWriter, r *http.Request) {
+	// Validate the user and API key
+	user, err := request.CheckUserAPI(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+
+	defer r.Body.Close()
+
+	// Decode the JSON body
+	quota := datastore.ModelQuota{}
+	err = json.NewDecoder(r.Body).Decode(&quota)
+	switch {
+	// Check we have some data
+	case err == io.EOF:
+		response.FormatStandardResponse(false, "error-quota-data", "", "No quota data supplied", w)
+		return
+		// Check for parsing errors
+	case err != nil:
+		response.FormatStandardResponse(false, "error-decode-json", "", err.Error(), w)
+		return
+	}
+
+	quotaUpdateHandler(w, user, true, modelID, quota)
+}
+
+// APIModelAPIKeyList is the API method to fetch the named API keys of a model
+func APIModelAPIKeyList(w http.ResponseWriter, r *http.Request) {
+	// Validate the user and API key
+	user, err := request.CheckUserAPI(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+
+	apiKeyListHandler(w, user, true, modelID)
+}
+
+// APIModelAPIKeyCreate is the API method to mint a named API key for a model
+func APIModelAPIKeyCreate(w http.ResponseWriter, r *http.Request) {
+	// Validate the user and API key
+	user, err := request.CheckUserAPI(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+
+	defer r.Body.Close()
+
+	// Decode the JSON body
+	key := datastore.ModelAPIKey{}
+	err = json.NewDecoder(r.Body).Decode(&key)
+	switch {
+	// Check we have some data
+	case err == io.EOF:
+		response.FormatStandardResponse(false, "error-apikey-data", "", "No API key data supplied", w)
+		return
+		// Check for parsing errors
+	case err != nil:
+		response.FormatStandardResponse(false, "error-decode-json", "", err.Error(), w)
+		return
+	}
+
+	apiKeyCreateHandler(w, user, true, modelID, key)
+}
+
+// APIModelAPIKeyRevoke is the API method to revoke a named API key of a model
+func APIModelAPIKeyRevoke(w http.ResponseWriter, r *http.Request) {
+	// Validate the user and API key
+	user, err := request.CheckUserAPI(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+	keyID, err := strconv.Atoi(vars["keyID"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-apikey", "", err.Error(), w)
+		return
+	}
+
+	apiKeyRevokeHandler(w, user, true, modelID, keyID)
+}
@@ -26,9 +26,12 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 
 	"github.com/CanonicalLtd/serial-vault/datastore"
 	"github.com/CanonicalLtd/serial-vault/service"
+	"github.com/CanonicalLtd/serial-vault/service/model"
+	"github.com/CanonicalLtd/serial-vault/service/response"
 	check "gopkg.in/check.v1"
 )
 
@@ -104,3 +107,249 @@ func sendAdminAPIRequest(method, url string, data io.Reader, permissions int, c
 
 	return w
 }
+
+func (s *ModelsSuite) TestAPIKeyRotationHandler(c *check.C) {
+	data := `{"key-type":"signing", "successor-keypair-id":2, "promote-at":"2030-01-01T00:00:00Z", "overlap-until":"2030-02-01T00:00:00Z"}`
+
+	tests := []SuiteTest{
+		{false, "GET", "/api/models/1/keyrotations", nil, 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 1},
+		{false, "GET", "/api/models/1/keyrotations", nil, 400, "application/json; charset=UTF-8", 0, true, false, 0},
+		{false, "POST", "/api/models/1/keyrotations", []byte(data), 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 0},
+		{false, "DELETE", "/api/models/1/keyrotations/1", nil, 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 0},
+		{true, "DELETE", "/api/models/1/keyrotations/1", nil, 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+	}
+
+	for _, t := range tests {
+		datastore.Environ.Config.EnableUserAuth = t.EnableAuth
+		if t.MockError {
+			datastore.Environ.DB = &datastore.ErrorMockDB{}
+		}
+
+		w := sendAdminAPIRequest(t.Method, t.URL, bytes.NewReader(t.Data), t.Permissions, c)
+		c.Assert(w.Code, check.Equals, t.Code)
+		c.Assert(w.Header().Get("Content-Type"), check.Equals, t.Type)
+
+		result := model.KeyRotationListResponse{}
+		err := json.NewDecoder(w.Body).Decode(&result)
+		c.Assert(err, check.IsNil)
+		c.Assert(result.Success, check.Equals, t.Success)
+		c.Assert(len(result.KeyRotations), check.Equals, t.List)
+
+		datastore.Environ.Config.EnableUserAuth = false
+		if t.MockError {
+			datastore.Environ.DB = &datastore.MockDB{}
+		}
+	}
+}
+
+func (s *ModelsSuite) TestAPIRevocationHandler(c *check.C) {
+	data := `{"serial-number":"A123456L", "reason":"Stolen device"}`
+
+	tests := []SuiteTest{
+		{false, "GET", "/api/models/1/revocations", nil, 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 2},
+		{false, "GET", "/api/models/1/revocations", nil, 400, "application/json; charset=UTF-8", 0, true, false, 0},
+		{false, "POST", "/api/models/1/revocations", []byte(data), 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 0},
+		{false, "DELETE", "/api/models/1/revocations/1", nil, 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 0},
+		{true, "DELETE", "/api/models/1/revocations/1", nil, 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+	}
+
+	for _, t := range tests {
+		datastore.Environ.Config.EnableUserAuth = t.EnableAuth
+		if t.MockError {
+			datastore.Environ.DB = &datastore.ErrorMockDB{}
+		}
+
+		w := sendAdminAPIRequest(t.Method, t.URL, bytes.NewReader(t.Data), t.Permissions, c)
+		c.Assert(w.Code, check.Equals, t.Code)
+		c.Assert(w.Header().Get("Content-Type"), check.Equals, t.Type)
+
+		result := model.RevocationListResponse{}
+		err := json.NewDecoder(w.Body).Decode(&result)
+		c.Assert(err, check.IsNil)
+		c.Assert(result.Success, check.Equals, t.Success)
+		c.Assert(len(result.Revocations), check.Equals, t.List)
+
+		datastore.Environ.Config.EnableUserAuth = false
+		if t.MockError {
+			datastore.Environ.DB = &datastore.MockDB{}
+		}
+	}
+}
+
+func (s *ModelsSuite) TestAPIRemodelRuleHandler(c *check.C) {
+	data := `{"to-model-id":3}`
+
+	tests := []SuiteTest{
+		{false, "GET", "/api/models/1/remodels", nil, 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 1},
+		{false, "GET", "/api/models/1/remodels", nil, 400, "application/json; charset=UTF-8", 0, true, false, 0},
+		{false, "POST", "/api/models/1/remodels", []byte(data), 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 0},
+		{false, "DELETE", "/api/models/1/remodels/1", nil, 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 0},
+		{true, "DELETE", "/api/models/1/remodels/1", nil, 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{false, "GET", "/api/models/1/remodelhistory", nil, 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 0},
+		{true, "GET", "/api/models/1/remodelhistory", nil, 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+	}
+
+	for _, t := range tests {
+		datastore.Environ.Config.EnableUserAuth = t.EnableAuth
+		if t.MockError {
+			datastore.Environ.DB = &datastore.ErrorMockDB{}
+		}
+
+		w := sendAdminAPIRequest(t.Method, t.URL, bytes.NewReader(t.Data), t.Permissions, c)
+		c.Assert(w.Code, check.Equals, t.Code)
+		c.Assert(w.Header().Get("Content-Type"), check.Equals, t.Type)
+
+		result := model.RemodelRuleListResponse{}
+		err := json.NewDecoder(w.Body).Decode(&result)
+		c.Assert(err, check.IsNil)
+		c.Assert(result.Success, check.Equals, t.Success)
+		c.Assert(len(result.Rules), check.Equals, t.List)
+
+		datastore.Environ.Config.EnableUserAuth = false
+		if t.MockError {
+			datastore.Environ.DB = &datastore.MockDB{}
+		}
+	}
+}
+
+func (s *ModelsSuite) TestAPIModelAPIKeyHandler(c *check.C) {
+	data := `{"label":"line-3"}`
+
+	tests := []SuiteTest{
+		{false, "GET", "/api/models/1/apikeys", nil, 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 2},
+		{false, "GET", "/api/models/1/apikeys", nil, 200, "application/json; charset=UTF-8", datastore.SyncUser, true, true, 2},
+		{false, "GET", "/api/models/1/apikeys", nil, 400, "application/json; charset=UTF-8", 0, true, false, 0},
+		{false, "POST", "/api/models/1/apikeys", []byte(data), 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 0},
+		{false, "POST", "/api/models/1/apikeys", []byte(data), 400, "application/json; charset=UTF-8", datastore.SyncUser, true, false, 0},
+		{true, "POST", "/api/models/1/apikeys", []byte(data), 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{false, "DELETE", "/api/models/1/apikeys/2", nil, 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 0},
+		{true, "DELETE", "/api/models/1/apikeys/2", nil, 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+	}
+
+	for _, t := range tests {
+		datastore.Environ.Config.EnableUserAuth = t.EnableAuth
+		if t.MockError {
+			datastore.Environ.DB = &datastore.ErrorMockDB{}
+		}
+
+		w := sendAdminAPIRequest(t.Method, t.URL, bytes.NewReader(t.Data), t.Permissions, c)
+		c.Assert(w.Code, check.Equals, t.Code)
+		c.Assert(w.Header().Get("Content-Type"), check.Equals, t.Type)
+
+		result := model.APIKeyListResponse{}
+		err := json.NewDecoder(w.Body).Decode(&result)
+		c.Assert(err, check.IsNil)
+		c.Assert(result.Success, check.Equals, t.Success)
+		c.Assert(len(result.APIKeys), check.Equals, t.List)
+
+		datastore.Environ.Config.EnableUserAuth = false
+		if t.MockError {
+			datastore.Environ.DB = &datastore.MockDB{}
+		}
+	}
+}
+
+func (s *ModelsSuite) TestAPIQuotaHandler(c *check.C) {
+	data := `{"daily-quota":1000}`
+
+	tests := []SuiteTest{
+		{false, "GET", "/api/models/1/quota", nil, 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 0},
+		{false, "GET", "/api/models/1/quota", nil, 400, "application/json; charset=UTF-8", 0, true, false, 0},
+		{false, "PUT", "/api/models/1/quota", []byte(data), 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 0},
+		{true, "PUT", "/api/models/1/quota", []byte(data), 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+	}
+
+	for _, t := range tests {
+		datastore.Environ.Config.EnableUserAuth = t.EnableAuth
+		if t.MockError {
+			datastore.Environ.DB = &datastore.ErrorMockDB{}
+		}
+
+		w := sendAdminAPIRequest(t.Method, t.URL, bytes.NewReader(t.Data), t.Permissions, c)
+		c.Assert(w.Code, check.Equals, t.Code)
+		c.Assert(w.Header().Get("Content-Type"), check.Equals, t.Type)
+
+		result := model.QuotaResponse{}
+		err := json.NewDecoder(w.Body).Decode(&result)
+		c.Assert(err, check.IsNil)
+		c.Assert(result.Success, check.Equals, t.Success)
+
+		datastore.Environ.Config.EnableUserAuth = false
+		if t.MockError {
+			datastore.Environ.DB = &datastore.MockDB{}
+		}
+	}
+}
+
+func (s *ModelsSuite) TestAPISerialImportCSV(c *check.C) {
+	data := "serial-number,serial-number-end\nA0001\nB0001,B0005\n"
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "/api/models/1/serials", bytes.NewReader([]byte(data)))
+	r.Header.Set("user", "sv")
+	r.Header.Set("api-key", "ValidAPIKey")
+	r.Header.Set("Content-Type", "text/csv")
+	service.AdminRouter().ServeHTTP(w, r)
+
+	c.Assert(w.Code, check.Equals, 200)
+	result := model.SerialImportResponse{}
+	err := json.NewDecoder(w.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Success, check.Equals, true)
+	c.Assert(result.Count, check.Equals, 6)
+
+	// Invalid CSV
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("POST", "/api/models/1/serials", bytes.NewReader([]byte("\"A0001\n")))
+	r.Header.Set("user", "sv")
+	r.Header.Set("api-key", "ValidAPIKey")
+	r.Header.Set("Content-Type", "text/csv")
+	service.AdminRouter().ServeHTTP(w, r)
+
+	c.Assert(w.Code, check.Equals, 400)
+}
+
+func (s *ModelsSuite) TestAPIUpdateWithoutPermission(c *check.C) {
+	rotation := `{"key-type":"signing", "successor-keypair-id":2, "promote-at":"2030-01-01T00:00:00Z", "overlap-until":"2030-02-01T00:00:00Z"}`
+
+	tests := []struct {
+		Method string
+		URL    string
+		Data   string
+	}{
+		{"POST", "/api/models/1/apikeys", `{"label":"line-3"}`},
+		{"DELETE", "/api/models/1/apikeys/1", ""},
+		{"PUT", "/api/models/1/quota", `{"daily-quota":1000}`},
+		{"POST", "/api/models/1/serials", `[{"serial-number":"A0001"}]`},
+		{"DELETE", "/api/models/1/serials/1", ""},
+		{"POST", "/api/models/1/revocations", `{"serial-number":"A123456L", "reason":"Stolen device"}`},
+		{"DELETE", "/api/models/1/revocations/1", ""},
+		{"POST", "/api/models/1/remodels", `{"to-model-id":3}`},
+		{"DELETE", "/api/models/1/remodels/1", ""},
+		{"POST", "/api/models/1/keyrotations", rotation},
+		{"DELETE", "/api/models/1/keyrotations/1", ""},
+	}
+
+	// The admin can only read the signing logs of the models' brand
+	for _, t := range tests {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(t.Method, t.URL, bytes.NewReader([]byte(t.Data)))
+		r.Header.Set("user", "reader")
+		r.Header.Set("api-key", "ValidAPIKey")
+		service.AdminRouter().ServeHTTP(w, r)
+
+		c.Assert(w.Code, check.Equals, 400, check.Commentf("%s %s", t.Method, t.URL))
+		result, err := response.ParseStandardResponse(w)
+		c.Assert(err, check.IsNil)
+		c.Assert(result.Success, check.Equals, false)
+		c.Assert(strings.Contains(result.ErrorMessage, datastore.PermissionModelEdit), check.Equals, true, check.Commentf("%s %s: %s", t.Method, t.URL, result.ErrorMessage))
+	}
+
+	// The admin can still see the model
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/api/models/1/quota", nil)
+	r.Header.Set("user", "reader")
+	r.Header.Set("api-key", "ValidAPIKey")
+	service.AdminRouter().ServeHTTP(w, r)
+	c.Assert(w.Code, check.Equals, 200)
+}
@@ -165,3 +165,438 @@ func AssertionHeaders(w http.ResponseWriter, r *http.Request) {
 
 	assertionHeaders(w, authUser, false, assert)
 }
+
+// KeyRotationList is the API method to fetch the key rotations of a model
+func KeyRotationList(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+
+	keyRotationListHandler(w, authUser, false, modelID)
+}
+
+// KeyRotationCreate is the API method to schedule the rotation of a model's key
+func KeyRotationCreate(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+
+	defer r.Body.Close()
+
+	// Decode the JSON body
+	rotation := datastore.KeyRotation{}
+	err = json.NewDecoder(r.Body).Decode(&rotation)
+	switch {
+	// Check we have some data
+	case err == io.EOF:
+		response.FormatStandardResponse(false, "error-keyrotation-data", "", "No key rotation data supplied", w)
+		return
+		// Check for parsing errors
+	case err != nil:
+		response.FormatStandardResponse(false, "error-decode-json", "", err.Error(), w)
+		return
+	}
+
+	keyRotationCreateHandler(w, authUser, false, modelID, rotation)
+}
+
+// KeyRotationDelete is the API method to cancel a scheduled key rotation
+func KeyRotationDelete(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+	rotationID, err := strconv.Atoi(vars["rotationID"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-keyrotation", "", err.Error(), w)
+		return
+	}
+
+	keyRotationDeleteHandler(w, authUser, false, modelID, rotationID)
+}
+
+// SerialList is the API method to fetch the serial number allowlist of a model
+func SerialList(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+
+	serialListHandler(w, authUser, false, modelID, r.URL.Query().Get("status"), r.URL.Query().Get("after"))
+}
+
+// SerialImport is the API method to import serial numbers and ranges into the allowlist of a model, as JSON or CSV
+func SerialImport(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+
+	serials, err := decodeSerialImport(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-decode-serials", "", err.Error(), w)
+		return
+	}
+
+	serialImportHandler(w, authUser, false, modelID, serials)
+}
+
+// SerialDelete is the API method to remove a serial number from the allowlist of a model
+func SerialDelete(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+	serialID, err := strconv.Atoi(vars["serialID"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-serial", "", err.Error(), w)
+		return
+	}
+
+	serialDeleteHandler(w, authUser, false, modelID, serialID)
+}
+
+// RevocationList is the API method to fetch the revoked serial assertions of a model
+func RevocationList(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+
+	revocationListHandler(w, authUser, false, modelID)
+}
+
+// RevocationCreate is the API method to revoke a serial assertion of a model
+func RevocationCreate(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+
+	defer r.Body.Close()
+
+	// Decode the JSON body
+	revocation := datastore.SerialRevocation{}
+	err = json.NewDecoder(r.Body).Decode(&revocation)
+	switch {
+	// Check we have some data
+	case err == io.EOF:
+		response.FormatStandardResponse(false, "error-revocation-data", "", "No serial revocation data supplied", w)
+		return
+		// Check for parsing errors
+	case err != nil:
+		response.FormatStandardResponse(false, "error-decode-json", "", err.Error(), w)
+		return
+	}
+
+	revocationCreateHandler(w, authUser, false, modelID, revocation)
+}
+
+// RevocationDelete is the API method to remove the revocation of a serial assertion of a model
+func RevocationDelete(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+	revocationID, err := strconv.Atoi(vars["revocationID"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-revocation", "", err.Error(), w)
+		return
+	}
+
+	revocationDeleteHandler(w, authUser, false, modelID, revocationID)
+}
+
+// RemodelRuleList is the API method to fetch the remodel rules of a model
+func RemodelRuleList(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+
+	remodelRuleListHandler(w, authUser, false, modelID)
+}
+
+// RemodelRuleCreate is the API method to allow a model to be remodelled to another model
+func RemodelRuleCreate(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+
+	defer r.Body.Close()
+
+	// Decode the JSON body
+	rule := datastore.RemodelRule{}
+	err = json.NewDecoder(r.Body).Decode(&rule)
+	switch {
+	// Check we have some data
+	case err == io.EOF:
+		response.FormatStandardResponse(false, "error-remodel-data", "", "No remodel rule data supplied", w)
+		return
+		// Check for parsing errors
+	case err != nil:
+		response.FormatStandardResponse(false, "error-decode-json", "", err.Error(), w)
+		return
+	}
+
+	remodelRuleCreateHandler(w, authUser, false, modelID, rule)
+}
+
+// RemodelRuleDelete is the API method to remove a remodel rule of a model
+func RemodelRuleDelete(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+	ruleID, err := strconv.Atoi(vars["ruleID"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-remodel", "", err.Error(), w)
+		return
+	}
+
+	remodelRuleDeleteHandler(w, authUser, false, modelID, ruleID)
+}
+
+// RemodelHistory is the API method to fetch the devices that were remodelled from or to a model
+func RemodelHistory(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+
+	remodelHistoryHandler(w, authUser, false, modelID)
+}
+
+// QuotaGet is the API method to fetch the rate limit, quotas and usage of a model
+func QuotaGet(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+
+	quotaGetHandler(w, authUser, false, modelID)
+}
+
+// QuotaUpdate is the API method to set the rate limit and quotas of a model
+func QuotaUpdate(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+
+	defer r.Body.Close()
+
+	// Decode the JSON body
+	quota := datastore.ModelQuota{}
+	err = json.NewDecoder(r.Body).Decode(&quota)
+	switch {
+	// Check we have some data
+	case err == io.EOF:
+		response.FormatStandardResponse(false, "error-quota-data", "", "No quota data supplied", w)
+		return
+		// Check for parsing errors
+	case err != nil:
+		response.FormatStandardResponse(false, "error-decode-json", "", err.Error(), w)
+		return
+	}
+
+	quotaUpdateHandler(w, authUser, false, modelID, quota)
+}
+
+// APIKeyList is the API method to fetch the named API keys of a model
+func APIKeyList(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+
+	apiKeyListHandler(w, authUser, false, modelID)
+}
+
+// APIKeyCreate is the API method to mint a named API key for a model
+func APIKeyCreate(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+
+	defer r.Body.Close()
+
+	// Decode the JSON body
+	key := datastore.ModelAPIKey{}
+	err = json.NewDecoder(r.Body).Decode(&key)
+	switch {
+	// Check we have some data
+	case err == io.EOF:
+		response.FormatStandardResponse(false, "error-apikey-data", "", "No API key data supplied", w)
+		return
+		// Check for parsing errors
+	case err != nil:
+		response.FormatStandardResponse(false, "error-decode-json", "", err.Error(), w)
+		return
+	}
+
+	apiKeyCreateHandler(w, authUser, false, modelID, key)
+}
+
+// APIKeyRevoke is the API method to revoke a named API key of a model
+func APIKeyRevoke(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	modelID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-model", "", err.Error(), w)
+		return
+	}
+	keyID, err := strconv.Atoi(vars["keyID"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-apikey", "", err.Error(), w)
+		return
+	}
+
+	apiKeyRevokeHandler(w, authUser, false, modelID, keyID)
+}
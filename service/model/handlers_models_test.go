@@ -210,6 +210,13 @@ func (s *ModelsSuite) TestUpdateDeleteHandler(c *check.C) {
 		"serial":"A1234-L",
 		"device-key":"ssh-rsa NNhqloxPyIYXiTP+3JTPWV/mNoBar2geWIf"
 	}`
+	dataAPIKey := `
+	{
+		"id": 1,
+		"brand-id": "System",
+		"model":"the-model",
+		"api-key":"NewAPIKeyForTheModel"
+	}`
 	dataExists := `
 	{
 		"id": 1,
@@ -227,6 +234,7 @@ func (s *ModelsSuite) TestUpdateDeleteHandler(c *check.C) {
 		{false, "PUT", "/v1/models/1", []byte(data), 200, "application/json; charset=UTF-8", 0, false, true, 0},
 		{false, "PUT", "/v1/models/1", []byte(data), 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 0},
 		{false, "PUT", "/v1/models/1", []byte(dataExists), 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{false, "PUT", "/v1/models/1", []byte(dataAPIKey), 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
 		{false, "PUT", "/v1/models/1", []byte(dataNotFound), 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
 		{false, "PUT", "/v1/models/1", []byte(data), 400, "application/json; charset=UTF-8", datastore.Invalid, true, false, 0},
 		{false, "PUT", "/v1/models/1", []byte(data), 400, "application/json; charset=UTF-8", datastore.Standard, true, false, 0},
@@ -393,3 +401,390 @@ func createJWTWithRole(r *http.Request, role int) error {
 	r.Header.Set("Authorization", "Bearer "+jwtToken)
 	return nil
 }
+
+func (s *ModelsSuite) TestKeyRotationHandler(c *check.C) {
+	data := `{"key-type":"signing", "successor-keypair-id":2, "promote-at":"2030-01-01T00:00:00Z", "overlap-until":"2030-02-01T00:00:00Z"}`
+	dataSameKey := `{"key-type":"signing", "successor-keypair-id":1, "promote-at":"2030-01-01T00:00:00Z", "overlap-until":"2030-02-01T00:00:00Z"}`
+
+	tests := []SuiteTest{
+		{false, "GET", "/v1/models/1/keyrotations", nil, 200, "application/json; charset=UTF-8", 0, false, true, 1},
+		{false, "GET", "/v1/models/1/keyrotations", nil, 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 1},
+		{false, "GET", "/v1/models/1/keyrotations", nil, 400, "application/json; charset=UTF-8", datastore.Standard, true, false, 0},
+		{false, "GET", "/v1/models/5/keyrotations", nil, 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{true, "GET", "/v1/models/1/keyrotations", nil, 400, "application/json; charset=UTF-8", 0, false, false, 0},
+		{false, "POST", "/v1/models/1/keyrotations", []byte(data), 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 0},
+		{false, "POST", "/v1/models/1/keyrotations", []byte(dataSameKey), 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{false, "POST", "/v1/models/1/keyrotations", []byte("invalid"), 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{false, "POST", "/v1/models/1/keyrotations", []byte(data), 400, "application/json; charset=UTF-8", datastore.Standard, true, false, 0},
+		{true, "POST", "/v1/models/1/keyrotations", []byte(data), 400, "application/json; charset=UTF-8", 0, false, false, 0},
+		{false, "DELETE", "/v1/models/1/keyrotations/1", nil, 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 0},
+		{false, "DELETE", "/v1/models/1/keyrotations/2", nil, 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{false, "DELETE", "/v1/models/1/keyrotations/1", nil, 400, "application/json; charset=UTF-8", datastore.Standard, true, false, 0},
+		{true, "DELETE", "/v1/models/1/keyrotations/1", nil, 400, "application/json; charset=UTF-8", 0, false, false, 0},
+	}
+
+	for _, t := range tests {
+		datastore.Environ.Config.EnableUserAuth = t.EnableAuth
+		if t.MockError {
+			datastore.Environ.DB = &datastore.ErrorMockDB{}
+		}
+
+		w := sendAdminRequest(t.Method, t.URL, bytes.NewReader(t.Data), t.Permissions, c)
+		c.Assert(w.Code, check.Equals, t.Code)
+		c.Assert(w.Header().Get("Content-Type"), check.Equals, t.Type)
+
+		result := model.KeyRotationListResponse{}
+		err := json.NewDecoder(w.Body).Decode(&result)
+		c.Assert(err, check.IsNil)
+		c.Assert(result.Success, check.Equals, t.Success)
+		c.Assert(len(result.KeyRotations), check.Equals, t.List)
+
+		datastore.Environ.Config.EnableUserAuth = true
+		if t.MockError {
+			datastore.Environ.DB = &datastore.MockDB{}
+		}
+	}
+}
+
+func (s *ModelsSuite) TestSerialAllowlistHandler(c *check.C) {
+	data := `[{"serial-number":"A0001"}, {"serial-number":"B0001", "serial-number-end":"B0010"}]`
+	dataInvalidRange := `[{"serial-number":"B0010", "serial-number-end":"B0001"}]`
+
+	tests := []SuiteTest{
+		{false, "GET", "/v1/models/1/serials", nil, 200, "application/json; charset=UTF-8", 0, false, true, 2},
+		{false, "GET", "/v1/models/1/serials?status=pending", nil, 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 1},
+		{false, "GET", "/v1/models/1/serials?status=invalid", nil, 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{false, "GET", "/v1/models/1/serials", nil, 400, "application/json; charset=UTF-8", datastore.Standard, true, false, 0},
+		{false, "GET", "/v1/models/5/serials", nil, 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{true, "GET", "/v1/models/1/serials", nil, 400, "application/json; charset=UTF-8", 0, false, false, 0},
+		{false, "POST", "/v1/models/1/serials", []byte(data), 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 11},
+		{false, "POST", "/v1/models/1/serials", []byte(dataInvalidRange), 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{false, "POST", "/v1/models/1/serials", []byte(""), 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{false, "POST", "/v1/models/1/serials", []byte(data), 400, "application/json; charset=UTF-8", datastore.Standard, true, false, 0},
+		{true, "POST", "/v1/models/1/serials", []byte(data), 400, "application/json; charset=UTF-8", 0, false, false, 0},
+		{false, "DELETE", "/v1/models/1/serials/1", nil, 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 0},
+		{false, "DELETE", "/v1/models/1/serials/1", nil, 400, "application/json; charset=UTF-8", datastore.Standard, true, false, 0},
+		{true, "DELETE", "/v1/models/1/serials/1", nil, 400, "application/json; charset=UTF-8", 0, false, false, 0},
+	}
+
+	for _, t := range tests {
+		datastore.Environ.Config.EnableUserAuth = t.EnableAuth
+		if t.MockError {
+			datastore.Environ.DB = &datastore.ErrorMockDB{}
+		}
+
+		w := sendAdminRequest(t.Method, t.URL, bytes.NewReader(t.Data), t.Permissions, c)
+		c.Assert(w.Code, check.Equals, t.Code)
+		c.Assert(w.Header().Get("Content-Type"), check.Equals, t.Type)
+
+		switch t.Method {
+		case "POST":
+			result := model.SerialImportResponse{}
+			err := json.NewDecoder(w.Body).Decode(&result)
+			c.Assert(err, check.IsNil)
+			c.Assert(result.Success, check.Equals, t.Success)
+			c.Assert(result.Count, check.Equals, t.List)
+		default:
+			result := model.SerialListResponse{}
+			err := json.NewDecoder(w.Body).Decode(&result)
+			c.Assert(err, check.IsNil)
+			c.Assert(result.Success, check.Equals, t.Success)
+			c.Assert(len(result.Serials), check.Equals, t.List)
+		}
+
+		datastore.Environ.Config.EnableUserAuth = true
+		if t.MockError {
+			datastore.Environ.DB = &datastore.MockDB{}
+		}
+	}
+}
+
+func (s *ModelsSuite) TestRevocationHandler(c *check.C) {
+	data := `{"serial-number":"A123456L", "revision":1, "reason":"Stolen device"}`
+	dataRevoked := `{"serial-number":"R12345", "reason":"Stolen device"}`
+	dataNoReason := `{"serial-number":"A123456L"}`
+
+	tests := []SuiteTest{
+		{false, "GET", "/v1/models/1/revocations", nil, 200, "application/json; charset=UTF-8", 0, false, true, 2},
+		{false, "GET", "/v1/models/1/revocations", nil, 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 2},
+		{false, "GET", "/v1/models/1/revocations", nil, 400, "application/json; charset=UTF-8", datastore.Standard, true, false, 0},
+		{false, "GET", "/v1/models/5/revocations", nil, 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{true, "GET", "/v1/models/1/revocations", nil, 400, "application/json; charset=UTF-8", 0, false, false, 0},
+		{false, "POST", "/v1/models/1/revocations", []byte(data), 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 0},
+		{false, "POST", "/v1/models/1/revocations", []byte(dataRevoked), 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{false, "POST", "/v1/models/1/revocations", []byte(dataNoReason), 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{false, "POST", "/v1/models/1/revocations", []byte(""), 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{false, "POST", "/v1/models/1/revocations", []byte(data), 400, "application/json; charset=UTF-8", datastore.Standard, true, false, 0},
+		{true, "POST", "/v1/models/1/revocations", []byte(data), 400, "application/json; charset=UTF-8", 0, false, false, 0},
+		{false, "DELETE", "/v1/models/1/revocations/1", nil, 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 0},
+		{false, "DELETE", "/v1/models/1/revocations/2", nil, 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{false, "DELETE", "/v1/models/1/revocations/1", nil, 400, "application/json; charset=UTF-8", datastore.Standard, true, false, 0},
+		{true, "DELETE", "/v1/models/1/revocations/1", nil, 400, "application/json; charset=UTF-8", 0, false, false, 0},
+	}
+
+	for _, t := range tests {
+		datastore.Environ.Config.EnableUserAuth = t.EnableAuth
+		if t.MockError {
+			datastore.Environ.DB = &datastore.ErrorMockDB{}
+		}
+
+		w := sendAdminRequest(t.Method, t.URL, bytes.NewReader(t.Data), t.Permissions, c)
+		c.Assert(w.Code, check.Equals, t.Code)
+		c.Assert(w.Header().Get("Content-Type"), check.Equals, t.Type)
+
+		switch t.Method {
+		case "POST":
+			result := model.RevocationResponse{}
+			err := json.NewDecoder(w.Body).Decode(&result)
+			c.Assert(err, check.IsNil)
+			c.Assert(result.Success, check.Equals, t.Success)
+			if t.Success {
+				c.Assert(result.Revocation.BrandID, check.Equals, "system")
+				c.Assert(result.Revocation.Revision, check.Equals, 1)
+			}
+		default:
+			result := model.RevocationListResponse{}
+			err := json.NewDecoder(w.Body).Decode(&result)
+			c.Assert(err, check.IsNil)
+			c.Assert(result.Success, check.Equals, t.Success)
+			c.Assert(len(result.Revocations), check.Equals, t.List)
+		}
+
+		datastore.Environ.Config.EnableUserAuth = true
+		if t.MockError {
+			datastore.Environ.DB = &datastore.MockDB{}
+		}
+	}
+}
+
+func (s *ModelsSuite) TestRemodelRuleHandler(c *check.C) {
+	data := `{"to-model-id":3, "serial-mapping":"prefix", "serial-prefix":"V-"}`
+	dataExists := `{"to-model-id":2}`
+	dataNoPrefix := `{"to-model-id":3, "serial-mapping":"prefix"}`
+	dataSelf := `{"to-model-id":1}`
+
+	tests := []SuiteTest{
+		{false, "GET", "/v1/models/1/remodels", nil, 200, "application/json; charset=UTF-8", 0, false, true, 1},
+		{false, "GET", "/v1/models/1/remodels", nil, 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 1},
+		{false, "GET", "/v1/models/1/remodels", nil, 400, "application/json; charset=UTF-8", datastore.Standard, true, false, 0},
+		{false, "GET", "/v1/models/5/remodels", nil, 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{true, "GET", "/v1/models/1/remodels", nil, 400, "application/json; charset=UTF-8", 0, false, false, 0},
+		{false, "POST", "/v1/models/1/remodels", []byte(data), 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 0},
+		{false, "POST", "/v1/models/1/remodels", []byte(dataExists), 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{false, "POST", "/v1/models/1/remodels", []byte(dataNoPrefix), 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{false, "POST", "/v1/models/1/remodels", []byte(dataSelf), 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{false, "POST", "/v1/models/1/remodels", []byte(""), 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{false, "POST", "/v1/models/1/remodels", []byte(data), 400, "application/json; charset=UTF-8", datastore.Standard, true, false, 0},
+		{true, "POST", "/v1/models/1/remodels", []byte(data), 400, "application/json; charset=UTF-8", 0, false, false, 0},
+		{false, "DELETE", "/v1/models/1/remodels/1", nil, 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 0},
+		{false, "DELETE", "/v1/models/1/remodels/2", nil, 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{false, "DELETE", "/v1/models/1/remodels/1", nil, 400, "application/json; charset=UTF-8", datastore.Standard, true, false, 0},
+		{true, "DELETE", "/v1/models/1/remodels/1", nil, 400, "application/json; charset=UTF-8", 0, false, false, 0},
+	}
+
+	for _, t := range tests {
+		datastore.Environ.Config.EnableUserAuth = t.EnableAuth
+		if t.MockError {
+			datastore.Environ.DB = &datastore.ErrorMockDB{}
+		}
+
+		w := sendAdminRequest(t.Method, t.URL, bytes.NewReader(t.Data), t.Permissions, c)
+		c.Assert(w.Code, check.Equals, t.Code)
+		c.Assert(w.Header().Get("Content-Type"), check.Equals, t.Type)
+
+		switch t.Method {
+		case "POST":
+			result := model.RemodelRuleResponse{}
+			err := json.NewDecoder(w.Body).Decode(&result)
+			c.Assert(err, check.IsNil)
+			c.Assert(result.Success, check.Equals, t.Success)
+			if t.Success {
+				c.Assert(result.Rule.FromModelID, check.Equals, 1)
+				c.Assert(result.Rule.ToModelID, check.Equals, 3)
+				c.Assert(result.Rule.SerialPrefix, check.Equals, "V-")
+			}
+		default:
+			result := model.RemodelRuleListResponse{}
+			err := json.NewDecoder(w.Body).Decode(&result)
+			c.Assert(err, check.IsNil)
+			c.Assert(result.Success, check.Equals, t.Success)
+			c.Assert(len(result.Rules), check.Equals, t.List)
+		}
+
+		datastore.Environ.Config.EnableUserAuth = true
+		if t.MockError {
+			datastore.Environ.DB = &datastore.MockDB{}
+		}
+	}
+}
+
+func (s *ModelsSuite) TestRemodelHistoryHandler(c *check.C) {
+	tests := []SuiteTest{
+		{false, "GET", "/v1/models/1/remodelhistory", nil, 200, "application/json; charset=UTF-8", 0, false, true, 1},
+		{false, "GET", "/v1/models/1/remodelhistory", nil, 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 1},
+		{false, "GET", "/v1/models/1/remodelhistory", nil, 400, "application/json; charset=UTF-8", datastore.Standard, true, false, 0},
+		{false, "GET", "/v1/models/5/remodelhistory", nil, 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{true, "GET", "/v1/models/1/remodelhistory", nil, 400, "application/json; charset=UTF-8", 0, false, false, 0},
+	}
+
+	for _, t := range tests {
+		datastore.Environ.Config.EnableUserAuth = t.EnableAuth
+		if t.MockError {
+			datastore.Environ.DB = &datastore.ErrorMockDB{}
+		}
+
+		w := sendAdminRequest(t.Method, t.URL, bytes.NewReader(t.Data), t.Permissions, c)
+		c.Assert(w.Code, check.Equals, t.Code)
+		c.Assert(w.Header().Get("Content-Type"), check.Equals, t.Type)
+
+		result := model.RemodelHistoryResponse{}
+		err := json.NewDecoder(w.Body).Decode(&result)
+		c.Assert(err, check.IsNil)
+		c.Assert(result.Success, check.Equals, t.Success)
+		c.Assert(len(result.History), check.Equals, t.List)
+
+		datastore.Environ.Config.EnableUserAuth = true
+		if t.MockError {
+			datastore.Environ.DB = &datastore.MockDB{}
+		}
+	}
+}
+
+func (s *ModelsSuite) TestQuotaHandler(c *check.C) {
+	data := `{"rate-limit":60, "daily-quota":1000, "monthly-quota":20000}`
+	dataInvalid := `{"daily-quota":1000, "monthly-quota":100}`
+
+	tests := []SuiteTest{
+		{false, "GET", "/v1/models/1/quota", nil, 200, "application/json; charset=UTF-8", 0, false, true, 0},
+		{false, "GET", "/v1/models/1/quota", nil, 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 0},
+		{false, "GET", "/v1/models/1/quota", nil, 400, "application/json; charset=UTF-8", datastore.Standard, true, false, 0},
+		{false, "GET", "/v1/models/5/quota", nil, 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{true, "GET", "/v1/models/1/quota", nil, 400, "application/json; charset=UTF-8", 0, false, false, 0},
+		{false, "PUT", "/v1/models/1/quota", []byte(data), 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 0},
+		{false, "PUT", "/v1/models/1/quota", []byte(dataInvalid), 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{false, "PUT", "/v1/models/1/quota", []byte(""), 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{false, "PUT", "/v1/models/1/quota", []byte(data), 400, "application/json; charset=UTF-8", datastore.Standard, true, false, 0},
+		{true, "PUT", "/v1/models/1/quota", []byte(data), 400, "application/json; charset=UTF-8", 0, false, false, 0},
+	}
+
+	for _, t := range tests {
+		datastore.Environ.Config.EnableUserAuth = t.EnableAuth
+		if t.MockError {
+			datastore.Environ.DB = &datastore.ErrorMockDB{}
+		}
+
+		w := sendAdminRequest(t.Method, t.URL, bytes.NewReader(t.Data), t.Permissions, c)
+		c.Assert(w.Code, check.Equals, t.Code)
+		c.Assert(w.Header().Get("Content-Type"), check.Equals, t.Type)
+
+		result := model.QuotaResponse{}
+		err := json.NewDecoder(w.Body).Decode(&result)
+		c.Assert(err, check.IsNil)
+		c.Assert(result.Success, check.Equals, t.Success)
+		if t.Success {
+			c.Assert(result.Quota.ModelID, check.Equals, 1)
+			c.Assert(result.Quota.BrandID, check.Equals, "system")
+		}
+		if t.Success && t.Method == "PUT" {
+			c.Assert(result.Quota.RateLimit, check.Equals, 60)
+			c.Assert(result.Quota.DailyQuota, check.Equals, 1000)
+		}
+		if t.Success && t.Method == "GET" {
+			c.Assert(result.Quota.DailyUsage, check.Equals, 5)
+			c.Assert(result.Quota.MonthlyUsage, check.Equals, 50)
+		}
+
+		datastore.Environ.Config.EnableUserAuth = true
+		if t.MockError {
+			datastore.Environ.DB = &datastore.MockDB{}
+		}
+	}
+}
+
+func (s *ModelsSuite) TestAPIKeyHandler(c *check.C) {
+	data := `{"label":"line-3"}`
+	dataNoLabel := `{"expires":"2020-01-01T00:00:00Z"}`
+	dataExpired := `{"label":"line-3", "expires":"2020-01-01T00:00:00Z"}`
+
+	tests := []SuiteTest{
+		{false, "GET", "/v1/models/1/apikeys", nil, 200, "application/json; charset=UTF-8", 0, false, true, 2},
+		{false, "GET", "/v1/models/1/apikeys", nil, 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 2},
+		{false, "GET", "/v1/models/1/apikeys", nil, 400, "application/json; charset=UTF-8", datastore.Standard, true, false, 0},
+		{false, "GET", "/v1/models/5/apikeys", nil, 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{true, "GET", "/v1/models/1/apikeys", nil, 400, "application/json; charset=UTF-8", 0, false, false, 0},
+		{false, "POST", "/v1/models/1/apikeys", []byte(data), 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 0},
+		{false, "POST", "/v1/models/1/apikeys", []byte(dataNoLabel), 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{false, "POST", "/v1/models/1/apikeys", []byte(dataExpired), 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{false, "POST", "/v1/models/1/apikeys", []byte(""), 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{false, "POST", "/v1/models/1/apikeys", []byte(data), 400, "application/json; charset=UTF-8", datastore.Standard, true, false, 0},
+		{true, "POST", "/v1/models/1/apikeys", []byte(data), 400, "application/json; charset=UTF-8", 0, false, false, 0},
+	}
+
+	for _, t := range tests {
+		datastore.Environ.Config.EnableUserAuth = t.EnableAuth
+		if t.MockError {
+			datastore.Environ.DB = &datastore.ErrorMockDB{}
+		}
+
+		w := sendAdminRequest(t.Method, t.URL, bytes.NewReader(t.Data), t.Permissions, c)
+		c.Assert(w.Code, check.Equals, t.Code)
+		c.Assert(w.Header().Get("Content-Type"), check.Equals, t.Type)
+
+		if t.Method == "GET" {
+			result := model.APIKeyListResponse{}
+			err := json.NewDecoder(w.Body).Decode(&result)
+			c.Assert(err, check.IsNil)
+			c.Assert(result.Success, check.Equals, t.Success)
+			c.Assert(len(result.APIKeys), check.Equals, t.List)
+			for _, k := range result.APIKeys {
+				c.Assert(k.APIKey, check.Equals, "")
+			}
+		} else {
+			result := model.APIKeyResponse{}
+			err := json.NewDecoder(w.Body).Decode(&result)
+			c.Assert(err, check.IsNil)
+			c.Assert(result.Success, check.Equals, t.Success)
+			if t.Success {
+				c.Assert(result.APIKey.ModelID, check.Equals, 1)
+				c.Assert(result.APIKey.Label, check.Equals, "line-3")
+				c.Assert(result.APIKey.APIKey, check.Equals, "MintedAPIKey")
+				c.Assert(result.APIKey.KeyHash, check.Equals, datastore.HashAPIKey("MintedAPIKey"))
+			}
+		}
+
+		datastore.Environ.Config.EnableUserAuth = true
+		if t.MockError {
+			datastore.Environ.DB = &datastore.MockDB{}
+		}
+	}
+}
+
+func (s *ModelsSuite) TestAPIKeyRevokeHandler(c *check.C) {
+	tests := []SuiteTest{
+		{false, "DELETE", "/v1/models/1/apikeys/1", nil, 200, "application/json; charset=UTF-8", datastore.Admin, true, true, 0},
+		{false, "DELETE", "/v1/models/1/apikeys/99", nil, 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{false, "DELETE", "/v1/models/5/apikeys/1", nil, 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{false, "DELETE", "/v1/models/1/apikeys/1", nil, 400, "application/json; charset=UTF-8", datastore.Standard, true, false, 0},
+		{true, "DELETE", "/v1/models/1/apikeys/1", nil, 400, "application/json; charset=UTF-8", 0, false, false, 0},
+	}
+
+	for _, t := range tests {
+		datastore.Environ.Config.EnableUserAuth = t.EnableAuth
+		if t.MockError {
+			datastore.Environ.DB = &datastore.ErrorMockDB{}
+		}
+
+		w := sendAdminRequest(t.Method, t.URL, bytes.NewReader(t.Data), t.Permissions, c)
+		c.Assert(w.Code, check.Equals, t.Code)
+		c.Assert(w.Header().Get("Content-Type"), check.Equals, t.Type)
+
+		result, err := response.ParseStandardResponse(w)
+		c.Assert(err, check.IsNil)
+		c.Assert(result.Success, check.Equals, t.Success)
+
+		datastore.Environ.Config.EnableUserAuth = true
+		if t.MockError {
+			datastore.Environ.DB = &datastore.MockDB{}
+		}
+	}
+}
@@ -34,6 +34,7 @@ import (
 	svlog "github.com/CanonicalLtd/serial-vault/service/log"
 	"github.com/CanonicalLtd/serial-vault/service/request"
 	"github.com/CanonicalLtd/serial-vault/service/response"
+	"github.com/CanonicalLtd/serial-vault/webhook"
 	"github.com/snapcore/snapd/asserts"
 )
 
@@ -156,6 +157,14 @@ func SerialAssertion(w http.ResponseWriter, r *http.Request) response.ErrorRespo
 		return response.ErrorResponse{Success: false, Code: "signing-assertion", Message: err.Error(), StatusCode: http.StatusBadRequest}
 	}
 
+	webhook.Notify(substore.FromModel.BrandID, datastore.EventPivotPerformed, map[string]interface{}{
+		"brand-id":    substore.FromModel.BrandID,
+		"model":       assertion.HeaderString("model"),
+		"serial":      assertion.HeaderString("serial"),
+		"pivot-model": substore.ModelName,
+		"store":       substore.Store,
+	})
+
 	// Add the account assertion to the assertions list
 	fetchAssertionFromStore(&assertions, asserts.AccountType, []string{substore.FromModel.BrandID})
 
@@ -199,6 +208,17 @@ func parseSerialAssertion(r *http.Request) (asserts.Assertion, response.ErrorRes
 		return nil, response.ErrorInvalidType
 	}
 
+	// Check that the serial assertion has not been revoked
+	revoked, err := datastore.Environ.DB.CheckSerialRevoked(assertion.HeaderString("brand-id"), assertion.HeaderString("model"), assertion.HeaderString("serial"), assertion.Revision())
+	if err != nil {
+		svlog.Message("PIVOT", response.ErrorCheckAssertion.Code, err.Error())
+		return nil, response.ErrorCheckAssertion
+	}
+	if revoked {
+		svlog.Message("PIVOT", response.ErrorRevokedSerial.Code, response.ErrorRevokedSerial.Message)
+		return nil, response.ErrorRevokedSerial
+	}
+
 	return assertion, response.ErrorResponse{Success: true}
 }
 
@@ -157,6 +157,30 @@ func (s *PivotSuite) TestPivotSystemUserAssertionHandler(c *check.C) {
 	}
 }
 
+func (s *PivotSuite) TestPivotRevokedSerialAssertion(c *check.C) {
+	datastore.Environ.DB = &revokedMockDB{}
+
+	for _, url := range []string{"/v1/pivot", "/v1/pivotmodel", "/v1/pivotserial"} {
+		w := sendSigningRequest("POST", url, bytes.NewReader([]byte(pivot.SerialAssert)), "ValidAPIKey", c)
+		c.Assert(w.Code, check.Equals, 400)
+		c.Assert(w.Header().Get("Content-Type"), check.Equals, jsonType)
+
+		result, err := parsePivotResponse(w)
+		c.Assert(err, check.IsNil)
+		c.Assert(result.Success, check.Equals, false)
+	}
+
+	datastore.Environ.DB = &datastore.MockDB{}
+}
+
+type revokedMockDB struct {
+	datastore.MockDB
+}
+
+func (mdb *revokedMockDB) CheckSerialRevoked(brandID, modelName, serialNumber string, revision int) (bool, error) {
+	return true, nil
+}
+
 func sendSigningRequest(method, url string, data io.Reader, apiKey string, c *check.C) *httptest.ResponseRecorder {
 	w := httptest.NewRecorder()
 	r, _ := http.NewRequest(method, url, data)
@@ -0,0 +1,235 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package quota
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/log"
+	"github.com/CanonicalLtd/serial-vault/service/metric"
+	"github.com/CanonicalLtd/serial-vault/service/response"
+)
+
+// rateWindow is the length of the window for the rate limit
+const rateWindow = time.Minute
+
+// now returns the current time, and is replaced in the tests
+var now = time.Now
+
+var limiter = newRateLimiter()
+
+// Limit checks the rate limit of the model API key, and that its models have not used up their
+// daily and monthly quotas, before calling the handler. Over-limit calls get a 429 response with
+// a Retry-After header. The quotas are only checked here: the signing handler reserves the quota
+// of the model for each serial before it is signed
+func Limit(f func(http.ResponseWriter, *http.Request) response.ErrorResponse) func(http.ResponseWriter, *http.Request) response.ErrorResponse {
+	return func(w http.ResponseWriter, r *http.Request) response.ErrorResponse {
+		apiKey := r.Header.Get("api-key")
+		if len(apiKey) == 0 {
+			// The handler rejects the request
+			return f(w, r)
+		}
+
+		t := now()
+		quota, err := datastore.Environ.DB.GetAPIKeyQuota(apiKey, t)
+		if err != nil {
+			// Do not block the signing service if the quota cannot be checked
+			log.Printf("Error checking the API key quota: %v", err)
+			return f(w, r)
+		}
+		if len(quota.Models) == 0 {
+			// Invalid API key: the handler rejects the request
+			return f(w, r)
+		}
+
+		if ok, retry := limiter.allow(apiKey, quota.RateLimit, t); !ok {
+			return tooManyRequests(w, response.ErrorRateLimit, retry)
+		}
+
+		// The request is refused when none of the models of the API key has any quota left
+		errQuota := response.ErrorResponse{Success: true}
+		for _, m := range quota.Models {
+			setUsageGauges(m)
+			left, errResponse := remaining(m)
+			if left > 0 {
+				return f(w, r)
+			}
+			if errQuota.Success || errResponse == response.ErrorDailyQuota {
+				errQuota = errResponse
+			}
+		}
+		return Refuse(w, errQuota)
+	}
+}
+
+// Reservation holds the serials that have been reserved from the quota of a model, so that they
+// can be released when they are not signed
+type Reservation struct {
+	model datastore.Model
+	count int
+	t     time.Time
+}
+
+// Reserve reserves the quota of the model for serials that are about to be signed, before they are
+// signed. The daily and monthly quota error is returned when the model does not have enough quota
+// left. When the quota cannot be checked, the serials are not limited and nothing is reserved
+func Reserve(model datastore.Model, count int) (Reservation, response.ErrorResponse) {
+	t := now()
+	ok, quota, err := datastore.Environ.DB.ReserveModelQuota(model, count, t)
+	if err != nil {
+		// Do not block the signing service if the quota cannot be checked
+		log.Printf("Error reserving the model quota: %v", err)
+		return Reservation{}, response.ErrorResponse{Success: true}
+	}
+	setUsageGauges(quota)
+
+	if !ok {
+		return Reservation{}, exceeded(quota, count)
+	}
+	return Reservation{model: model, count: count, t: t}, response.ErrorResponse{Success: true}
+}
+
+// Release gives back the reserved quota of serials that have not been signed
+func (res Reservation) Release() {
+	if res.count == 0 {
+		return
+	}
+
+	err := datastore.Environ.DB.ReleaseModelQuota(res.model.ID, res.count, res.t)
+	if err != nil {
+		log.Printf("Error releasing the model quota: %v", err)
+	}
+}
+
+// Refuse returns the error for a used up daily or monthly quota, with the time until it is reset
+func Refuse(w http.ResponseWriter, errQuota response.ErrorResponse) response.ErrorResponse {
+	t := now()
+	if errQuota == response.ErrorMonthlyQuota {
+		return tooManyRequests(w, errQuota, untilNextMonth(t))
+	}
+	return tooManyRequests(w, errQuota, untilNextDay(t))
+}
+
+// remaining returns the number of serials left in the daily and monthly quotas of the model, and
+// the error for the quota that runs out first
+func remaining(quota datastore.ModelQuota) (int, response.ErrorResponse) {
+	left, errResponse := math.MaxInt32, response.ErrorResponse{Success: true}
+	if quota.DailyQuota > 0 && quota.DailyQuota-quota.DailyUsage < left {
+		left, errResponse = quota.DailyQuota-quota.DailyUsage, response.ErrorDailyQuota
+	}
+	if quota.MonthlyQuota > 0 && quota.MonthlyQuota-quota.MonthlyUsage <= left {
+		left, errResponse = quota.MonthlyQuota-quota.MonthlyUsage, response.ErrorMonthlyQuota
+	}
+	if left < 0 {
+		left = 0
+	}
+	return left, errResponse
+}
+
+// exceeded returns the error for the quota that the serials would take past its limit
+func exceeded(quota datastore.ModelQuota, count int) response.ErrorResponse {
+	if quota.MonthlyQuota > 0 && quota.MonthlyUsage+count > quota.MonthlyQuota {
+		if quota.DailyQuota == 0 || quota.DailyUsage+count <= quota.DailyQuota {
+			return response.ErrorMonthlyQuota
+		}
+	}
+	return response.ErrorDailyQuota
+}
+
+func tooManyRequests(w http.ResponseWriter, e response.ErrorResponse, retry time.Duration) response.ErrorResponse {
+	seconds := int(math.Ceil(retry.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	log.Message("QUOTA", e.Code, e.Message)
+	return e
+}
+
+// setUsageGauges publishes the quota usage of the model
+func setUsageGauges(m datastore.ModelQuota) {
+	metric.APIKeyQuotaUsageGaugeVec.WithLabelValues(m.BrandID, m.Model, "daily").Set(float64(m.DailyUsage))
+	metric.APIKeyQuotaUsageGaugeVec.WithLabelValues(m.BrandID, m.Model, "monthly").Set(float64(m.MonthlyUsage))
+}
+
+func untilNextDay(t time.Time) time.Duration {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC).Sub(t)
+}
+
+func untilNextMonth(t time.Time) time.Duration {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC).Sub(t)
+}
+
+// rateLimiter counts the requests of each API key in a fixed window. The counts are held
+// in memory, so the limit applies to each instance of the signing service
+type rateLimiter struct {
+	mu      sync.Mutex
+	windows map[string]*window
+}
+
+type window struct {
+	start time.Time
+	count int
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{windows: make(map[string]*window)}
+}
+
+// allow records a request for the API key. It returns false, and the time until the
+// window ends, when the key has used up its limit. A zero limit is unlimited
+func (l *rateLimiter) allow(apiKey string, limit int, t time.Time) (bool, time.Duration) {
+	if limit <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	win, ok := l.windows[apiKey]
+	if !ok || t.Sub(win.start) >= rateWindow {
+		l.removeExpired(t)
+		win = &window{start: t}
+		l.windows[apiKey] = win
+	}
+
+	if win.count >= limit {
+		return false, win.start.Add(rateWindow).Sub(t)
+	}
+	win.count++
+	return true, 0
+}
+
+// removeExpired removes the windows that have ended
+func (l *rateLimiter) removeExpired(t time.Time) {
+	for apiKey, win := range l.windows {
+		if t.Sub(win.start) >= rateWindow {
+			delete(l.windows, apiKey)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package quota
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/response"
+)
+
+func okHandler(w http.ResponseWriter, r *http.Request) response.ErrorResponse {
+	return response.ErrorResponse{Success: true}
+}
+
+func sendRequest(apiKey string) (*httptest.ResponseRecorder, response.ErrorResponse) {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "/v1/serial", nil)
+	r.Header.Set("api-key", apiKey)
+	return w, Limit(okHandler)(w, r)
+}
+
+func setUp(t time.Time) {
+	datastore.Environ = &datastore.Env{DB: &datastore.MockDB{}}
+	limiter = newRateLimiter()
+	now = func() time.Time { return t }
+}
+
+func TestLimit(t *testing.T) {
+	setUp(time.Date(2020, time.March, 30, 10, 30, 0, 0, time.UTC))
+
+	tests := []struct {
+		apiKey     string
+		code       string
+		retryAfter string
+	}{
+		{"ValidAPIKey", "", ""},
+		{"", "", ""},
+		{"InvalidAPIKey", "", ""},
+		{"LimitedAPIKey", "", ""},
+		{"LimitedAPIKey", "", ""},
+		{"LimitedAPIKey", "rate-limit", "60"},
+		{"DailyQuotaAPIKey", "quota-exceeded", "48600"},
+		{"MonthlyQuotaAPIKey", "quota-exceeded", "135000"},
+		{"SharedQuotaAPIKey", "", ""},
+	}
+
+	for _, tt := range tests {
+		w, e := sendRequest(tt.apiKey)
+		if tt.code == "" {
+			if !e.Success {
+				t.Errorf("%s: expected the request to be allowed, got: %s", tt.apiKey, e.Code)
+			}
+			continue
+		}
+
+		if e.Success || e.Code != tt.code || e.StatusCode != http.StatusTooManyRequests {
+			t.Errorf("%s: expected a 429 '%s' error, got: %v", tt.apiKey, tt.code, e)
+		}
+		if w.Header().Get("Retry-After") != tt.retryAfter {
+			t.Errorf("%s: expected Retry-After %s, got: %s", tt.apiKey, tt.retryAfter, w.Header().Get("Retry-After"))
+		}
+	}
+}
+
+func TestLimitDatabaseError(t *testing.T) {
+	setUp(time.Now())
+	datastore.Environ.DB = &datastore.ErrorMockDB{}
+
+	// The signing service is not blocked when the quota cannot be checked
+	if _, e := sendRequest("LimitedAPIKey"); !e.Success {
+		t.Errorf("Expected the request to be allowed, got: %s", e.Code)
+	}
+}
+
+func TestReserve(t *testing.T) {
+	setUp(time.Now())
+
+	tests := []struct {
+		id      int
+		model   string
+		count   int
+		success bool
+		code    string
+	}{
+		{1, "alder", 5, true, ""},
+		{1, "alder", 1, false, response.ErrorDailyQuota.Code},
+		{2, "alder-quota", 1, true, ""},
+		{2, "alder-quota", 2, false, response.ErrorDailyQuota.Code},
+		{3, "alder-quota-used", 1, false, response.ErrorMonthlyQuota.Code},
+	}
+
+	for _, tt := range tests {
+		res, e := Reserve(datastore.Model{ID: tt.id, BrandID: "system", Name: tt.model}, tt.count)
+		if e.Success != tt.success || e.Code != tt.code {
+			t.Errorf("%s: expected the reservation of %d to be %v with '%s', got: %v with '%s'", tt.model, tt.count, tt.success, tt.code, e.Success, e.Code)
+		}
+		if tt.success && res.count != tt.count {
+			t.Errorf("%s: expected %d reserved, got: %d", tt.model, tt.count, res.count)
+		}
+	}
+
+	// The released quota can be reserved again
+	model := datastore.Model{ID: 10, BrandID: "system", Name: "alder"}
+	res, e := Reserve(model, 5)
+	if !e.Success {
+		t.Fatalf("Expected the quota to be reserved, got: %s", e.Code)
+	}
+	res.Release()
+	if _, e := Reserve(model, 5); !e.Success {
+		t.Errorf("Expected the released quota to be reserved, got: %s", e.Code)
+	}
+
+	// The signing service is not blocked when the quota cannot be checked
+	datastore.Environ.DB = &datastore.ErrorMockDB{}
+	res, e = Reserve(datastore.Model{ID: 1, BrandID: "system", Name: "alder-quota-used"}, 1)
+	if !e.Success || res.count != 0 {
+		t.Errorf("Expected no limit, got: %v", e)
+	}
+	res.Release()
+}
+
+func TestRemainingQuotas(t *testing.T) {
+
+	tests := []struct {
+		daily   int
+		monthly int
+		left    int
+		code    string
+	}{
+		{4, 50, 6, response.ErrorDailyQuota.Code},
+		{4, 98, 2, response.ErrorMonthlyQuota.Code},
+		{0, 90, 10, response.ErrorMonthlyQuota.Code},
+		{12, 50, 0, response.ErrorDailyQuota.Code},
+	}
+
+	for _, tt := range tests {
+		left, e := remaining(datastore.ModelQuota{DailyQuota: 10, MonthlyQuota: 100, DailyUsage: tt.daily, MonthlyUsage: tt.monthly})
+		if left != tt.left || e.Code != tt.code || e.SubCode == "" {
+			t.Errorf("%d/%d: expected %d remaining with '%s', got: %d with '%s'", tt.daily, tt.monthly, tt.left, tt.code, left, e.Code)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter()
+	start := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.allow("key", 3, start.Add(time.Duration(i)*time.Second)); !ok {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+	}
+
+	ok, retry := l.allow("key", 3, start.Add(20*time.Second))
+	if ok {
+		t.Error("Expected the request to be over the limit")
+	}
+	if retry != 40*time.Second {
+		t.Errorf("Expected to retry after 40s, got: %v", retry)
+	}
+
+	// Other keys have their own limit
+	if ok, _ := l.allow("other", 3, start.Add(20*time.Second)); !ok {
+		t.Error("Expected the request for another key to be allowed")
+	}
+
+	// A new window starts after a minute, and the ended windows are removed
+	if ok, _ := l.allow("key", 3, start.Add(time.Minute)); !ok {
+		t.Error("Expected the request to be allowed in a new window")
+	}
+	if len(l.windows) != 2 {
+		t.Errorf("Expected 2 windows, got: %d", len(l.windows))
+	}
+	if ok, _ := l.allow("third", 3, start.Add(2*time.Minute)); !ok {
+		t.Error("Expected the request to be allowed in a new window")
+	}
+	if len(l.windows) != 1 {
+		t.Errorf("Expected the ended windows to be removed, got: %d", len(l.windows))
+	}
+
+	// No limit
+	for i := 0; i < 100; i++ {
+		if ok, _ := l.allow("unlimited", 0, start); !ok {
+			t.Fatal("Expected no limit")
+		}
+	}
+}
+
+func TestRetryAfterQuota(t *testing.T) {
+	tm := time.Date(2020, time.December, 31, 23, 0, 0, 0, time.UTC)
+	if d := untilNextDay(tm); d != time.Hour {
+		t.Errorf("Expected an hour until the next day, got: %v", d)
+	}
+	if d := untilNextMonth(tm); d != time.Hour {
+		t.Errorf("Expected an hour until the next month, got: %v", d)
+	}
+}
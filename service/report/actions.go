@@ -0,0 +1,82 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/auth"
+	"github.com/CanonicalLtd/serial-vault/service/log"
+	"github.com/CanonicalLtd/serial-vault/service/response"
+)
+
+// SigningResponse is the JSON response from the API Signing Report method
+type SigningResponse struct {
+	Success      bool                      `json:"success"`
+	ErrorCode    string                    `json:"error_code"`
+	ErrorSubcode string                    `json:"error_subcode"`
+	ErrorMessage string                    `json:"message"`
+	Reports      []datastore.SigningReport `json:"reports"`
+}
+
+// signingHandler is the API method to fetch the signing statistics, as JSON or as a CSV download
+func signingHandler(w http.ResponseWriter, user datastore.User, apiCall bool, format string, params datastore.SigningReportParams) {
+	err := auth.CheckUserPermissions(user, datastore.Admin, apiCall)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	reports, err := datastore.Environ.DB.AllowedSigningReport(user, params)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		response.FormatStandardResponse(false, "error-fetch-report", "", err.Error(), w)
+		return
+	}
+
+	if format == FormatCSV {
+		w.Header().Set("Content-Type", "text/csv; charset=UTF-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"signing-report-%s.csv\"", params.Period))
+		w.WriteHeader(http.StatusOK)
+		if err := WriteSigningCSV(w, reports); err != nil {
+			log.Printf("Error writing the signing report: %v\n", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	formatSigningResponse(reports, w)
+}
+
+func formatSigningResponse(reports []datastore.SigningReport, w http.ResponseWriter) error {
+	response := SigningResponse{Success: true, Reports: reports}
+
+	// Encode the response as JSON
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Println("Error forming the signing report response.")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package report
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/auth"
+	"github.com/CanonicalLtd/serial-vault/service/response"
+	"github.com/CanonicalLtd/serial-vault/service/signinglog"
+)
+
+// Signing is the API method to fetch the signing statistics per account and model, for each day,
+// week or month
+func Signing(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	format, params, err := GetSigningReportParams(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		response.FormatStandardResponse(false, "error-report-params", "", err.Error(), w)
+		return
+	}
+
+	signingHandler(w, authUser, false, format, params)
+}
+
+// GetSigningReportParams returns the format and filters of the signing report from the query
+// parameters. The period is 'day' (the default), 'week' or 'month', and the 'from' and 'to' times
+// are dates (2006-01-02) or RFC3339 times
+func GetSigningReportParams(r *http.Request) (string, datastore.SigningReportParams, error) {
+	query := r.URL.Query()
+	params := datastore.SigningReportParams{
+		Period:      query.Get("period"),
+		AuthorityID: query.Get("account"),
+		Model:       query.Get("model"),
+	}
+
+	format := query.Get("format")
+	if len(format) == 0 {
+		format = FormatJSON
+	}
+	if format != FormatJSON && format != FormatCSV {
+		return format, params, fmt.Errorf("the report format must be '%s' or '%s'", FormatJSON, FormatCSV)
+	}
+
+	switch params.Period {
+	case "":
+		params.Period = datastore.ReportDay
+	case datastore.ReportDay, datastore.ReportWeek, datastore.ReportMonth:
+	default:
+		return format, params, fmt.Errorf("the report period must be '%s', '%s' or '%s'", datastore.ReportDay, datastore.ReportWeek, datastore.ReportMonth)
+	}
+
+	for _, p := range []struct {
+		name  string
+		value **time.Time
+	}{{"from", &params.From}, {"to", &params.To}} {
+		if v := query.Get(p.name); len(v) > 0 {
+			t, err := signinglog.ParseTimeFilter(v)
+			if err != nil {
+				return format, params, err
+			}
+			*p.value = &t
+		}
+	}
+
+	return format, params, nil
+}
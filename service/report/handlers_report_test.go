@@ -0,0 +1,156 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package report_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CanonicalLtd/serial-vault/config"
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service"
+	"github.com/CanonicalLtd/serial-vault/service/report"
+	"github.com/CanonicalLtd/serial-vault/usso"
+	"github.com/juju/usso/openid"
+	check "gopkg.in/check.v1"
+)
+
+func TestReportSuite(t *testing.T) { check.TestingT(t) }
+
+type ReportSuite struct{}
+
+var _ = check.Suite(&ReportSuite{})
+
+func (s *ReportSuite) SetUpTest(c *check.C) {
+	// Mock the database
+	config := config.Settings{KeyStoreType: "filesystem", KeyStorePath: "../../keystore", JwtSecret: "SomeTestSecretValue"}
+	datastore.Environ = &datastore.Env{DB: &datastore.MockDB{}, Config: config}
+	datastore.OpenKeyStore(config)
+
+	// Disable CSRF for tests as we do not have a secure connection
+	service.MiddlewareWithCSRF = service.Middleware
+}
+
+func (s *ReportSuite) TestSigningHandler(c *check.C) {
+	tests := []struct {
+		url         string
+		permissions int
+		enableAuth  bool
+		code        int
+		reports     int
+	}{
+		{"/v1/reports/signing", 0, false, http.StatusOK, 2},
+		{"/v1/reports/signing?period=month&account=system&model=alder&from=2020-01-01&to=2021-01-01", 0, false, http.StatusOK, 2},
+		{"/v1/reports/signing?period=week", datastore.Admin, true, http.StatusOK, 1},
+		{"/v1/reports/signing", datastore.Superuser, true, http.StatusOK, 1},
+		{"/v1/reports/signing", datastore.Standard, true, http.StatusBadRequest, 0},
+		{"/v1/reports/signing", 0, true, http.StatusBadRequest, 0},
+		{"/v1/reports/signing?period=year", 0, false, http.StatusBadRequest, 0},
+		{"/v1/reports/signing?format=xml", 0, false, http.StatusBadRequest, 0},
+		{"/v1/reports/signing?from=yesterday", 0, false, http.StatusBadRequest, 0},
+	}
+
+	for _, t := range tests {
+		datastore.Environ.Config.EnableUserAuth = t.enableAuth
+
+		w := sendAdminRequest("GET", t.url, t.permissions, c)
+		c.Assert(w.Code, check.Equals, t.code, check.Commentf(t.url))
+		c.Assert(w.Header().Get("Content-Type"), check.Equals, "application/json; charset=UTF-8")
+
+		result := report.SigningResponse{}
+		err := json.NewDecoder(w.Body).Decode(&result)
+		c.Assert(err, check.IsNil)
+		c.Assert(result.Success, check.Equals, t.code == http.StatusOK)
+		c.Assert(result.Reports, check.HasLen, t.reports)
+	}
+	datastore.Environ.Config.EnableUserAuth = false
+}
+
+func (s *ReportSuite) TestSigningHandlerCSV(c *check.C) {
+	w := sendAdminRequest("GET", "/v1/reports/signing?period=week&format=csv", 0, c)
+	c.Assert(w.Code, check.Equals, http.StatusOK)
+	c.Assert(w.Header().Get("Content-Type"), check.Equals, "text/csv; charset=UTF-8")
+	c.Assert(w.Header().Get("Content-Disposition"), check.Equals, `attachment; filename="signing-report-week.csv"`)
+
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	c.Assert(lines, check.DeepEquals, []string{
+		"period,authority-id,model,signed,resigned,resign-rate,factory,cloud,remodels",
+		"2020-01-06,system,alder,4,1,0.2500,3,1,0",
+		"2020-01-06,system,ash,2,0,0.0000,2,0,1",
+	})
+}
+
+func (s *ReportSuite) TestSigningHandlerError(c *check.C) {
+	datastore.Environ.DB = &datastore.ErrorMockDB{}
+
+	for _, url := range []string{"/v1/reports/signing", "/v1/reports/signing?format=csv"} {
+		w := sendAdminRequest("GET", url, 0, c)
+		c.Assert(w.Code, check.Equals, http.StatusBadRequest)
+		c.Assert(w.Header().Get("Content-Type"), check.Equals, "application/json; charset=UTF-8")
+	}
+}
+
+func (s *ReportSuite) TestGetSigningReportParams(c *check.C) {
+	r, _ := http.NewRequest("GET", "/v1/reports/signing?period=month&account=system&model=alder&from=2020-01-01&format=csv", nil)
+	format, params, err := report.GetSigningReportParams(r)
+	c.Assert(err, check.IsNil)
+	c.Assert(format, check.Equals, report.FormatCSV)
+	c.Assert(params.Period, check.Equals, datastore.ReportMonth)
+	c.Assert(params.AuthorityID, check.Equals, "system")
+	c.Assert(params.Model, check.Equals, "alder")
+	c.Assert(params.From.Year(), check.Equals, 2020)
+	c.Assert(params.To, check.IsNil)
+
+	r, _ = http.NewRequest("GET", "/v1/reports/signing", nil)
+	format, params, err = report.GetSigningReportParams(r)
+	c.Assert(err, check.IsNil)
+	c.Assert(format, check.Equals, report.FormatJSON)
+	c.Assert(params.Period, check.Equals, datastore.ReportDay)
+}
+
+func sendAdminRequest(method, url string, permissions int, c *check.C) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(method, url, nil)
+
+	if permissions > 0 {
+		// Create a JWT and add it to the request
+		err := createJWTWithRole(r, permissions)
+		c.Assert(err, check.IsNil)
+	}
+
+	service.AdminRouter().ServeHTTP(w, r)
+
+	return w
+}
+
+func createJWTWithRole(r *http.Request, role int) error {
+	sreg := map[string]string{"nickname": "sv", "fullname": "Steven Vault", "email": "sv@example.com"}
+	resp := openid.Response{ID: "identity", Teams: []string{}, SReg: sreg}
+	jwtToken, err := usso.NewJWTToken(&resp, role)
+	if err != nil {
+		return fmt.Errorf("Error creating a JWT: %v", err)
+	}
+	r.Header.Set("Authorization", "Bearer "+jwtToken)
+	return nil
+}
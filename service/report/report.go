@@ -0,0 +1,64 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package report
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+)
+
+// Formats of the reports
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+var signingCSVHeader = []string{"period", "authority-id", "model", "signed", "resigned", "resign-rate", "factory", "cloud", "remodels"}
+
+// WriteSigningCSV writes the signing report as CSV, with a header row
+func WriteSigningCSV(w io.Writer, reports []datastore.SigningReport) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(signingCSVHeader); err != nil {
+		return err
+	}
+
+	for _, r := range reports {
+		err := out.Write([]string{
+			r.Period,
+			r.AuthorityID,
+			r.Model,
+			strconv.Itoa(r.Signed),
+			strconv.Itoa(r.Resigned),
+			strconv.FormatFloat(r.ResignRate, 'f', 4, 64),
+			strconv.Itoa(r.Factory),
+			strconv.Itoa(r.Cloud),
+			strconv.Itoa(r.Remodels),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
@@ -21,19 +21,70 @@ package request
 
 import (
 	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"strings"
 
 	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/gorilla/mux"
 )
 
-// CheckUserAPI validates the user and API key
+// syncRoutes are the routes of the factory sync API, that are allowed by the sync scope
+var syncRoutes = map[string]bool{
+	"GET /api/accounts":                   true,
+	"POST /api/keypairs/sync":             true,
+	"GET /api/models":                     true,
+	"GET /api/models/{id:[0-9]+}/apikeys": true,
+	"POST /api/signinglog":                true,
+	"GET /api/testlog":                    true,
+	"POST /api/testlog":                   true,
+	"PUT /api/testlog/{id:[0-9]+}":        true,
+}
+
+// CheckUserAPI validates the user and API key. The API key may be a personal access token of the
+// user, in which case the route must be allowed by the scopes of the token
 func CheckUserAPI(r *http.Request) (datastore.User, error) {
 	// Get the user and API key from the header
 	username := r.Header.Get("user")
 	apiKey := r.Header.Get("api-key")
 
 	// Find the user by API key
-	return datastore.Environ.DB.GetUserByAPIKey(apiKey, username)
+	user, err := datastore.Environ.DB.GetUserByAPIKey(apiKey, username)
+	user.SourceIP = SourceIP(r)
+	if err != nil || user.Token == nil {
+		return user, err
+	}
+
+	return user, checkTokenScope(r, *user.Token)
+}
+
+// checkTokenScope checks that the personal access token allows the route. The area of the route is
+// the first part of its path after /api/. GET requests need read access and all other methods need
+// write access. A token that is limited to an account can only be used on routes for that account
+func checkTokenScope(r *http.Request, token datastore.UserToken) error {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return errors.New("The token is not valid for this request")
+	}
+	path, err := route.GetPathTemplate()
+	if err != nil {
+		return errors.New("The token is not valid for this request")
+	}
+
+	if len(token.AuthorityID) > 0 && mux.Vars(r)["authorityID"] != token.AuthorityID {
+		return fmt.Errorf("The token is limited to the account '%s'", token.AuthorityID)
+	}
+
+	if token.HasSyncScope() && syncRoutes[r.Method+" "+path] {
+		return nil
+	}
+
+	area := strings.SplitN(strings.TrimPrefix(path, "/api/"), "/", 2)[0]
+	if token.HasScope(area, r.Method != http.MethodGet) {
+		return nil
+	}
+	return fmt.Errorf("The token does not have the scope for this request")
 }
 
 // CheckModelAPI the API key header to make sure it is an allowed header
@@ -49,3 +100,51 @@ func CheckModelAPI(r *http.Request) (string, error) {
 
 	return apiKey, nil
 }
+
+// SourceIP returns the address of the client of the request. The X-Forwarded-For header is only
+// used when the request comes from one of the trusted proxies, and the address is the last one in
+// the header that was not added by a trusted proxy, as the client can set the earlier ones
+func SourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !trustedProxy(host) {
+		return host
+	}
+
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		address := strings.TrimSpace(forwarded[i])
+		if len(address) == 0 {
+			continue
+		}
+		host = address
+		if !trustedProxy(address) {
+			break
+		}
+	}
+	return host
+}
+
+// trustedProxy checks if the address is one of the configured proxies, which may be an address
+// or a CIDR range
+func trustedProxy(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+
+	for _, proxy := range datastore.Environ.Config.TrustedProxies {
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if trusted := net.ParseIP(proxy); trusted != nil && trusted.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016-2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package request_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/CanonicalLtd/serial-vault/config"
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/request"
+	check "gopkg.in/check.v1"
+)
+
+func TestRequestSuite(t *testing.T) { check.TestingT(t) }
+
+type RequestSuite struct{}
+
+var _ = check.Suite(&RequestSuite{})
+
+func (s *RequestSuite) SetUpTest(c *check.C) {
+	settings := config.Settings{TrustedProxies: []string{"10.0.0.1", "192.168.0.0/16"}}
+	datastore.Environ = &datastore.Env{DB: &datastore.MockDB{}, Config: settings}
+}
+
+func (s *RequestSuite) TestSourceIP(c *check.C) {
+	tests := []struct {
+		remoteAddr string
+		forwarded  string
+		sourceIP   string
+	}{
+		{"203.0.113.5:4000", "", "203.0.113.5"},
+		{"203.0.113.5:4000", "198.51.100.1", "203.0.113.5"},
+		{"10.0.0.1:4000", "", "10.0.0.1"},
+		{"10.0.0.1:4000", "198.51.100.1", "198.51.100.1"},
+		{"10.0.0.1:4000", "1.2.3.4, 198.51.100.1", "198.51.100.1"},
+		{"10.0.0.1:4000", "198.51.100.1, 192.168.1.1", "198.51.100.1"},
+		{"10.0.0.2:4000", "198.51.100.1", "10.0.0.2"},
+		{"10.0.0.1:4000", "192.168.1.1", "192.168.1.1"},
+	}
+
+	for _, t := range tests {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.RemoteAddr = t.remoteAddr
+		if len(t.forwarded) > 0 {
+			r.Header.Set("X-Forwarded-For", t.forwarded)
+		}
+		c.Assert(request.SourceIP(r), check.Equals, t.sourceIP)
+	}
+}
@@ -51,6 +51,8 @@ var (
 	ErrorInactiveModel             = ErrorResponse{false, "invalid-model", "", "The model is linked with an inactive signing-key", http.StatusBadRequest}
 	ErrorInvalidAccount            = ErrorResponse{false, "invalid-account", "", "The account cannot be found", http.StatusBadRequest}
 	ErrorInvalidAssertion          = ErrorResponse{false, "invalid-assertion", "", "The assertion is invalid", http.StatusBadRequest}
+	ErrorInvalidModelSignature     = ErrorResponse{false, "invalid-model-signature", "", "The model assertion is not signed by a trusted signing-key", http.StatusBadRequest}
+	ErrorRemodelSerial             = ErrorResponse{false, "remodel-serial", "", "The serial number does not follow the serial number mapping of the remodel rule", http.StatusBadRequest}
 	ErrorInvalidKeypair            = ErrorResponse{false, "invalid-keypair", "", "The keypair is invalid", http.StatusBadRequest}
 	ErrorFetchKeypairs             = ErrorResponse{false, "fetch-keypairs", "", "Error fetching the signing-keys", http.StatusBadRequest}
 	ErrorFetchKeypair              = ErrorResponse{false, "fetch-keypair", "", "Error fetching the signing-key", http.StatusBadRequest}
@@ -62,8 +64,16 @@ var (
 	ErrorCreateModelAssertion      = ErrorResponse{false, "create-assertion", "", "Error with the model assertion headers", http.StatusBadRequest}
 	ErrorCreateSystemUserAssertion = ErrorResponse{false, "create-assertion", "", "Error with the system-user assertion", http.StatusBadRequest}
 	ErrorDuplicateAssertion        = ErrorResponse{false, "duplicate-assertion", "", "The serial number and/or device-key have already been used to sign a device", http.StatusBadRequest}
+	ErrorDuplicatePolicy           = ErrorResponse{false, "duplicate-policy", "", "The serial number has already been signed and the model's duplicate-signing policy does not allow it to be re-signed", http.StatusBadRequest}
+	ErrorUnknownSerial             = ErrorResponse{false, "unknown-serial", "", "The serial number is not registered for the model", http.StatusBadRequest}
+	ErrorRevokedSerial             = ErrorResponse{false, "revoked-serial", "", "The serial number has been revoked", http.StatusBadRequest}
+	ErrorDuplicateInBatch          = ErrorResponse{false, "duplicate-in-batch", "", "The serial number is repeated in the batch of serial-requests", http.StatusBadRequest}
+	ErrorBatchSize                 = ErrorResponse{false, "batch-size", "", "Too many serial-requests in the batch", http.StatusBadRequest}
 	ErrorAccountAssertion          = ErrorResponse{false, "account-assertion", "", "Error retrieving the account assertion from the database", http.StatusBadRequest}
 	ErrorSignAssertion             = ErrorResponse{false, "signing-assertion", "", "Error signing the assertion", http.StatusBadRequest}
 	ErrorGenerateNonce             = ErrorResponse{false, "generate-nonce", "", "Error generating a nonce. Please try again later", http.StatusBadRequest}
+	ErrorRateLimit                 = ErrorResponse{false, "rate-limit", "", "Too many requests for the API key. Please try again later", http.StatusTooManyRequests}
+	ErrorDailyQuota                = ErrorResponse{false, "quota-exceeded", "daily", "The daily quota for the API key has been used up", http.StatusTooManyRequests}
+	ErrorMonthlyQuota              = ErrorResponse{false, "quota-exceeded", "monthly", "The monthly quota for the API key has been used up", http.StatusTooManyRequests}
 	ErrorInternal                  = ErrorResponse{false, "server-error", "", "Internal Server Error", http.StatusInternalServerError}
 )
@@ -28,11 +28,14 @@ import (
 	"github.com/CanonicalLtd/serial-vault/service/account"
 	"github.com/CanonicalLtd/serial-vault/service/app"
 	"github.com/CanonicalLtd/serial-vault/service/assertion"
+	"github.com/CanonicalLtd/serial-vault/service/audit"
 	"github.com/CanonicalLtd/serial-vault/service/core"
 	"github.com/CanonicalLtd/serial-vault/service/keypair"
 	"github.com/CanonicalLtd/serial-vault/service/metric"
 	"github.com/CanonicalLtd/serial-vault/service/model"
 	"github.com/CanonicalLtd/serial-vault/service/pivot"
+	"github.com/CanonicalLtd/serial-vault/service/quota"
+	"github.com/CanonicalLtd/serial-vault/service/report"
 	"github.com/CanonicalLtd/serial-vault/service/sign"
 	"github.com/CanonicalLtd/serial-vault/service/signinglog"
 	"github.com/CanonicalLtd/serial-vault/service/status"
@@ -40,6 +43,7 @@ import (
 	"github.com/CanonicalLtd/serial-vault/service/substore"
 	"github.com/CanonicalLtd/serial-vault/service/testlog"
 	"github.com/CanonicalLtd/serial-vault/service/user"
+	"github.com/CanonicalLtd/serial-vault/service/webhook"
 	"github.com/CanonicalLtd/serial-vault/usso"
 	"github.com/gorilla/mux"
 )
@@ -54,25 +58,31 @@ func SigningRouter() *mux.Router {
 
 	// API routes
 	router.Handle("/v1/serial", metric.CollectAPIStats("signSerial",
-		Middleware(ErrorHandler(sign.Serial)))).
+		Middleware(ErrorHandler(quota.Limit(sign.Serial))))).
+		Methods("POST")
+	router.Handle("/v1/serials", metric.CollectAPIStats("signSerials",
+		Middleware(ErrorHandler(quota.Limit(sign.Serials))))).
 		Methods("POST")
 	router.Handle("/v1/request-id", metric.CollectAPIStats("signRequestID",
-		Middleware(ErrorHandler(sign.RequestID)))).
+		Middleware(ErrorHandler(quota.Limit(sign.RequestID))))).
 		Methods("POST")
+	router.Handle("/v1/revocations", metric.CollectAPIStats("signRevocationList",
+		Middleware(ErrorHandler(sign.RevocationList)))).
+		Methods("GET")
 	router.Handle("/v1/model", metric.CollectAPIStats("assertionModelAssertion",
 		Middleware(ErrorHandler(assertion.ModelAssertion)))).
 		Methods("POST")
 	router.Handle("/v1/pivot", metric.CollectAPIStats("pivotModel",
-		Middleware(ErrorHandler(pivot.Model)))).
+		Middleware(ErrorHandler(quota.Limit(pivot.Model))))).
 		Methods("POST")
 	router.Handle("/v1/pivotmodel", metric.CollectAPIStats("pivotModelAssertion",
-		Middleware(ErrorHandler(pivot.ModelAssertion)))).
+		Middleware(ErrorHandler(quota.Limit(pivot.ModelAssertion))))).
 		Methods("POST")
 	router.Handle("/v1/pivotserial", metric.CollectAPIStats("pivotSerialAssertion",
-		Middleware(ErrorHandler(pivot.SerialAssertion)))).
+		Middleware(ErrorHandler(quota.Limit(pivot.SerialAssertion))))).
 		Methods("POST")
 	router.Handle("/v1/pivotuser", metric.CollectAPIStats("pivotSystemUserAssertion",
-		Middleware(ErrorHandler(pivot.SystemUserAssertion)))).
+		Middleware(ErrorHandler(quota.Limit(pivot.SystemUserAssertion))))).
 		Methods("POST")
 
 	// Test log upload routes (only in the factory)
@@ -124,6 +134,60 @@ func AdminRouter() *mux.Router {
 	router.Handle("/v1/models/{id:[0-9]+}", metric.CollectAPIStats("modelDelete",
 		MiddlewareWithCSRF(http.HandlerFunc(model.Delete)))).
 		Methods("DELETE")
+	router.Handle("/v1/models/{id:[0-9]+}/keyrotations", metric.CollectAPIStats("modelKeyRotationList",
+		MiddlewareWithCSRF(http.HandlerFunc(model.KeyRotationList)))).
+		Methods("GET")
+	router.Handle("/v1/models/{id:[0-9]+}/keyrotations", metric.CollectAPIStats("modelKeyRotationCreate",
+		MiddlewareWithCSRF(http.HandlerFunc(model.KeyRotationCreate)))).
+		Methods("POST")
+	router.Handle("/v1/models/{id:[0-9]+}/keyrotations/{rotationID:[0-9]+}", metric.CollectAPIStats("modelKeyRotationDelete",
+		MiddlewareWithCSRF(http.HandlerFunc(model.KeyRotationDelete)))).
+		Methods("DELETE")
+	router.Handle("/v1/models/{id:[0-9]+}/serials", metric.CollectAPIStats("modelSerialList",
+		MiddlewareWithCSRF(http.HandlerFunc(model.SerialList)))).
+		Methods("GET")
+	router.Handle("/v1/models/{id:[0-9]+}/serials", metric.CollectAPIStats("modelSerialImport",
+		MiddlewareWithCSRF(http.HandlerFunc(model.SerialImport)))).
+		Methods("POST")
+	router.Handle("/v1/models/{id:[0-9]+}/serials/{serialID:[0-9]+}", metric.CollectAPIStats("modelSerialDelete",
+		MiddlewareWithCSRF(http.HandlerFunc(model.SerialDelete)))).
+		Methods("DELETE")
+	router.Handle("/v1/models/{id:[0-9]+}/revocations", metric.CollectAPIStats("modelRevocationList",
+		MiddlewareWithCSRF(http.HandlerFunc(model.RevocationList)))).
+		Methods("GET")
+	router.Handle("/v1/models/{id:[0-9]+}/revocations", metric.CollectAPIStats("modelRevocationCreate",
+		MiddlewareWithCSRF(http.HandlerFunc(model.RevocationCreate)))).
+		Methods("POST")
+	router.Handle("/v1/models/{id:[0-9]+}/revocations/{revocationID:[0-9]+}", metric.CollectAPIStats("modelRevocationDelete",
+		MiddlewareWithCSRF(http.HandlerFunc(model.RevocationDelete)))).
+		Methods("DELETE")
+	router.Handle("/v1/models/{id:[0-9]+}/remodels", metric.CollectAPIStats("modelRemodelRuleList",
+		MiddlewareWithCSRF(http.HandlerFunc(model.RemodelRuleList)))).
+		Methods("GET")
+	router.Handle("/v1/models/{id:[0-9]+}/remodels", metric.CollectAPIStats("modelRemodelRuleCreate",
+		MiddlewareWithCSRF(http.HandlerFunc(model.RemodelRuleCreate)))).
+		Methods("POST")
+	router.Handle("/v1/models/{id:[0-9]+}/remodels/{ruleID:[0-9]+}", metric.CollectAPIStats("modelRemodelRuleDelete",
+		MiddlewareWithCSRF(http.HandlerFunc(model.RemodelRuleDelete)))).
+		Methods("DELETE")
+	router.Handle("/v1/models/{id:[0-9]+}/remodelhistory", metric.CollectAPIStats("modelRemodelHistory",
+		MiddlewareWithCSRF(http.HandlerFunc(model.RemodelHistory)))).
+		Methods("GET")
+	router.Handle("/v1/models/{id:[0-9]+}/quota", metric.CollectAPIStats("modelQuotaGet",
+		MiddlewareWithCSRF(http.HandlerFunc(model.QuotaGet)))).
+		Methods("GET")
+	router.Handle("/v1/models/{id:[0-9]+}/quota", metric.CollectAPIStats("modelQuotaUpdate",
+		MiddlewareWithCSRF(http.HandlerFunc(model.QuotaUpdate)))).
+		Methods("PUT")
+	router.Handle("/v1/models/{id:[0-9]+}/apikeys", metric.CollectAPIStats("modelAPIKeyList",
+		MiddlewareWithCSRF(http.HandlerFunc(model.APIKeyList)))).
+		Methods("GET")
+	router.Handle("/v1/models/{id:[0-9]+}/apikeys", metric.CollectAPIStats("modelAPIKeyCreate",
+		MiddlewareWithCSRF(http.HandlerFunc(model.APIKeyCreate)))).
+		Methods("POST")
+	router.Handle("/v1/models/{id:[0-9]+}/apikeys/{keyID:[0-9]+}", metric.CollectAPIStats("modelAPIKeyRevoke",
+		MiddlewareWithCSRF(http.HandlerFunc(model.APIKeyRevoke)))).
+		Methods("DELETE")
 
 	// API routes: signing-keys
 	router.Handle("/v1/keypairs", metric.CollectAPIStats("keypairList",
@@ -172,6 +236,9 @@ func AdminRouter() *mux.Router {
 	router.Handle("/v1/signinglog/account/{authorityID}/filters", metric.CollectAPIStats("signinglogListFilters",
 		MiddlewareWithCSRF(http.HandlerFunc(signinglog.ListFilters)))).
 		Methods("GET")
+	router.Handle("/v1/signinglog/account/{authorityID}/export", metric.CollectAPIStats("signinglogExport",
+		MiddlewareWithCSRF(http.HandlerFunc(signinglog.Export)))).
+		Methods("GET")
 
 	// API routes: account assertions
 	router.Handle("/v1/accounts", metric.CollectAPIStats("accountList",
@@ -226,6 +293,71 @@ func AdminRouter() *mux.Router {
 	router.Handle("/v1/users/{id:[0-9]+}/otheraccounts", metric.CollectAPIStats("userGetOtherAccounts",
 		MiddlewareWithCSRF(http.HandlerFunc(user.GetOtherAccounts)))).
 		Methods("GET")
+	router.Handle("/v1/users/{id:[0-9]+}/apikey", metric.CollectAPIStats("userAPIKeyReset",
+		MiddlewareWithCSRF(http.HandlerFunc(user.APIKeyReset)))).
+		Methods("POST")
+	router.Handle("/v1/users/{id:[0-9]+}/sessions", metric.CollectAPIStats("userSessionList",
+		MiddlewareWithCSRF(http.HandlerFunc(user.SessionList)))).
+		Methods("GET")
+	router.Handle("/v1/users/{id:[0-9]+}/sessions", metric.CollectAPIStats("userSessionRevoke",
+		MiddlewareWithCSRF(http.HandlerFunc(user.SessionRevoke)))).
+		Methods("DELETE")
+	router.Handle("/v1/users/{id:[0-9]+}/permissions", metric.CollectAPIStats("userPermissionList",
+		MiddlewareWithCSRF(http.HandlerFunc(user.PermissionList)))).
+		Methods("GET")
+	router.Handle("/v1/users/{id:[0-9]+}/permissions", metric.CollectAPIStats("userPermissionUpdate",
+		MiddlewareWithCSRF(http.HandlerFunc(user.PermissionUpdate)))).
+		Methods("PUT")
+	router.Handle("/v1/users/{id:[0-9]+}/permissions/{authorityID}", metric.CollectAPIStats("userPermissionDelete",
+		MiddlewareWithCSRF(http.HandlerFunc(user.PermissionDelete)))).
+		Methods("DELETE")
+
+	// API routes: reports
+	router.Handle("/v1/reports/signing", metric.CollectAPIStats("reportSigning",
+		MiddlewareWithCSRF(http.HandlerFunc(report.Signing)))).
+		Methods("GET")
+
+	// API routes: audit log
+	router.Handle("/v1/audit", metric.CollectAPIStats("auditList",
+		MiddlewareWithCSRF(http.HandlerFunc(audit.List)))).
+		Methods("GET")
+	router.Handle("/v1/audit/verify", metric.CollectAPIStats("auditVerify",
+		MiddlewareWithCSRF(http.HandlerFunc(audit.Verify)))).
+		Methods("GET")
+
+	// API routes: webhooks
+	router.Handle("/v1/webhooks", metric.CollectAPIStats("webhookList",
+		MiddlewareWithCSRF(http.HandlerFunc(webhook.List)))).
+		Methods("GET")
+	router.Handle("/v1/webhooks", metric.CollectAPIStats("webhookCreate",
+		MiddlewareWithCSRF(http.HandlerFunc(webhook.Create)))).
+		Methods("POST")
+	router.Handle("/v1/webhooks/{id:[0-9]+}", metric.CollectAPIStats("webhookGet",
+		MiddlewareWithCSRF(http.HandlerFunc(webhook.Get)))).
+		Methods("GET")
+	router.Handle("/v1/webhooks/{id:[0-9]+}", metric.CollectAPIStats("webhookUpdate",
+		MiddlewareWithCSRF(http.HandlerFunc(webhook.Update)))).
+		Methods("PUT")
+	router.Handle("/v1/webhooks/{id:[0-9]+}", metric.CollectAPIStats("webhookDelete",
+		MiddlewareWithCSRF(http.HandlerFunc(webhook.Delete)))).
+		Methods("DELETE")
+	router.Handle("/v1/webhooks/{id:[0-9]+}/deliveries", metric.CollectAPIStats("webhookDeliveryList",
+		MiddlewareWithCSRF(http.HandlerFunc(webhook.DeliveryList)))).
+		Methods("GET")
+	router.Handle("/v1/webhooks/{id:[0-9]+}/deliveries/{deliveryID:[0-9]+}/retry", metric.CollectAPIStats("webhookDeliveryRetry",
+		MiddlewareWithCSRF(http.HandlerFunc(webhook.DeliveryRetry)))).
+		Methods("POST")
+
+	// API routes: personal access tokens of the logged-in user
+	router.Handle("/v1/tokens", metric.CollectAPIStats("userTokenList",
+		MiddlewareWithCSRF(http.HandlerFunc(user.TokenList)))).
+		Methods("GET")
+	router.Handle("/v1/tokens", metric.CollectAPIStats("userTokenCreate",
+		MiddlewareWithCSRF(http.HandlerFunc(user.TokenCreate)))).
+		Methods("POST")
+	router.Handle("/v1/tokens/{id:[0-9]+}", metric.CollectAPIStats("userTokenRevoke",
+		MiddlewareWithCSRF(http.HandlerFunc(user.TokenRevoke)))).
+		Methods("DELETE")
 
 	// OpenID routes: using Ubuntu SSO
 	router.Handle("/login", metric.CollectAPIStats("ussoLoginHandler",
@@ -252,6 +384,12 @@ func AdminRouter() *mux.Router {
 	router.Handle("/api/signinglog", metric.CollectAPIStats("signinglogAPIList",
 		Middleware(http.HandlerFunc(signinglog.APIList)))).
 		Methods("GET")
+	router.Handle("/api/signinglog/account/{authorityID}", metric.CollectAPIStats("signinglogAPIListForAccount",
+		Middleware(http.HandlerFunc(signinglog.APIListForAccount)))).
+		Methods("GET")
+	router.Handle("/api/signinglog/account/{authorityID}/export", metric.CollectAPIStats("signinglogAPIExport",
+		Middleware(http.HandlerFunc(signinglog.APIExport)))).
+		Methods("GET")
 	router.Handle("/api/keypairs", metric.CollectAPIStats("keypairAPIList",
 		Middleware(http.HandlerFunc(keypair.APIList)))).
 		Methods("GET")
@@ -291,6 +429,82 @@ func AdminRouter() *mux.Router {
 	router.Handle("/api/models/assertion", metric.CollectAPIStats("modelAPIAssertionHeaders",
 		Middleware(http.HandlerFunc(model.APIAssertionHeaders)))).
 		Methods("POST")
+	router.Handle("/api/models/{id:[0-9]+}/keyrotations", metric.CollectAPIStats("modelAPIKeyRotationList",
+		Middleware(http.HandlerFunc(model.APIKeyRotationList)))).
+		Methods("GET")
+	router.Handle("/api/models/{id:[0-9]+}/keyrotations", metric.CollectAPIStats("modelAPIKeyRotationCreate",
+		Middleware(http.HandlerFunc(model.APIKeyRotationCreate)))).
+		Methods("POST")
+	router.Handle("/api/models/{id:[0-9]+}/keyrotations/{rotationID:[0-9]+}", metric.CollectAPIStats("modelAPIKeyRotationDelete",
+		Middleware(http.HandlerFunc(model.APIKeyRotationDelete)))).
+		Methods("DELETE")
+	router.Handle("/api/models/{id:[0-9]+}/serials", metric.CollectAPIStats("modelAPISerialList",
+		Middleware(http.HandlerFunc(model.APISerialList)))).
+		Methods("GET")
+	router.Handle("/api/models/{id:[0-9]+}/serials", metric.CollectAPIStats("modelAPISerialImport",
+		Middleware(http.HandlerFunc(model.APISerialImport)))).
+		Methods("POST")
+	router.Handle("/api/models/{id:[0-9]+}/serials/{serialID:[0-9]+}", metric.CollectAPIStats("modelAPISerialDelete",
+		Middleware(http.HandlerFunc(model.APISerialDelete)))).
+		Methods("DELETE")
+	router.Handle("/api/models/{id:[0-9]+}/revocations", metric.CollectAPIStats("modelAPIRevocationList",
+		Middleware(http.HandlerFunc(model.APIRevocationList)))).
+		Methods("GET")
+	router.Handle("/api/models/{id:[0-9]+}/revocations", metric.CollectAPIStats("modelAPIRevocationCreate",
+		Middleware(http.HandlerFunc(model.APIRevocationCreate)))).
+		Methods("POST")
+	router.Handle("/api/models/{id:[0-9]+}/revocations/{revocationID:[0-9]+}", metric.CollectAPIStats("modelAPIRevocationDelete",
+		Middleware(http.HandlerFunc(model.APIRevocationDelete)))).
+		Methods("DELETE")
+	router.Handle("/api/models/{id:[0-9]+}/remodels", metric.CollectAPIStats("modelAPIRemodelRuleList",
+		Middleware(http.HandlerFunc(model.APIRemodelRuleList)))).
+		Methods("GET")
+	router.Handle("/api/models/{id:[0-9]+}/remodels", metric.CollectAPIStats("modelAPIRemodelRuleCreate",
+		Middleware(http.HandlerFunc(model.APIRemodelRuleCreate)))).
+		Methods("POST")
+	router.Handle("/api/models/{id:[0-9]+}/remodels/{ruleID:[0-9]+}", metric.CollectAPIStats("modelAPIRemodelRuleDelete",
+		Middleware(http.HandlerFunc(model.APIRemodelRuleDelete)))).
+		Methods("DELETE")
+	router.Handle("/api/models/{id:[0-9]+}/remodelhistory", metric.CollectAPIStats("modelAPIRemodelHistory",
+		Middleware(http.HandlerFunc(model.APIRemodelHistory)))).
+		Methods("GET")
+	router.Handle("/api/models/{id:[0-9]+}/quota", metric.CollectAPIStats("modelAPIQuotaGet",
+		Middleware(http.HandlerFunc(model.APIQuotaGet)))).
+		Methods("GET")
+	router.Handle("/api/models/{id:[0-9]+}/quota", metric.CollectAPIStats("modelAPIQuotaUpdate",
+		Middleware(http.HandlerFunc(model.APIQuotaUpdate)))).
+		Methods("PUT")
+	router.Handle("/api/models/{id:[0-9]+}/apikeys", metric.CollectAPIStats("modelAPIModelAPIKeyList",
+		Middleware(http.HandlerFunc(model.APIModelAPIKeyList)))).
+		Methods("GET")
+	router.Handle("/api/models/{id:[0-9]+}/apikeys", metric.CollectAPIStats("modelAPIModelAPIKeyCreate",
+		Middleware(http.HandlerFunc(model.APIModelAPIKeyCreate)))).
+		Methods("POST")
+	router.Handle("/api/models/{id:[0-9]+}/apikeys/{keyID:[0-9]+}", metric.CollectAPIStats("modelAPIModelAPIKeyRevoke",
+		Middleware(http.HandlerFunc(model.APIModelAPIKeyRevoke)))).
+		Methods("DELETE")
+
+	router.Handle("/api/webhooks", metric.CollectAPIStats("webhookAPIList",
+		Middleware(http.HandlerFunc(webhook.APIList)))).
+		Methods("GET")
+	router.Handle("/api/webhooks", metric.CollectAPIStats("webhookAPICreate",
+		Middleware(http.HandlerFunc(webhook.APICreate)))).
+		Methods("POST")
+	router.Handle("/api/webhooks/{id:[0-9]+}", metric.CollectAPIStats("webhookAPIGet",
+		Middleware(http.HandlerFunc(webhook.APIGet)))).
+		Methods("GET")
+	router.Handle("/api/webhooks/{id:[0-9]+}", metric.CollectAPIStats("webhookAPIUpdate",
+		Middleware(http.HandlerFunc(webhook.APIUpdate)))).
+		Methods("PUT")
+	router.Handle("/api/webhooks/{id:[0-9]+}", metric.CollectAPIStats("webhookAPIDelete",
+		Middleware(http.HandlerFunc(webhook.APIDelete)))).
+		Methods("DELETE")
+	router.Handle("/api/webhooks/{id:[0-9]+}/deliveries", metric.CollectAPIStats("webhookAPIDeliveryList",
+		Middleware(http.HandlerFunc(webhook.APIDeliveryList)))).
+		Methods("GET")
+	router.Handle("/api/webhooks/{id:[0-9]+}/deliveries/{deliveryID:[0-9]+}/retry", metric.CollectAPIStats("webhookAPIDeliveryRetry",
+		Middleware(http.HandlerFunc(webhook.APIDeliveryRetry)))).
+		Methods("POST")
 
 	// Sync API routes
 	router.Handle("/api/accounts", metric.CollectAPIStats("accountAPIList",
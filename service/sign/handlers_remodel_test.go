@@ -0,0 +1,150 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package sign_test
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/response"
+	"github.com/snapcore/snapd/asserts"
+	check "gopkg.in/check.v1"
+)
+
+// historyMockDB keeps the recorded remodel history
+type historyMockDB struct {
+	trustedMockDB
+	history []datastore.RemodelHistory
+}
+
+func (mdb *historyMockDB) CreateRemodelHistory(history datastore.RemodelHistory) error {
+	mdb.history = append(mdb.history, history)
+	return nil
+}
+
+func generateRemodelRequest(brandID, model, originalSerial, serial string) ([]byte, error) {
+	privateKey, _ := generatePrivateKey()
+	encodedPubKey, _ := asserts.EncodePublicKey(privateKey.PublicKey())
+
+	headers := map[string]interface{}{
+		"brand-id":   brandID,
+		"device-key": string(encodedPubKey),
+		"request-id": "REQID",
+		"model":      model,
+		"serial":     serial,
+
+		"original-brand-id": "system",
+		"original-model":    "alder",
+		"original-serial":   originalSerial,
+	}
+
+	sreq, err := asserts.SignWithoutAuthority(asserts.SerialRequestType, headers, nil, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return asserts.Encode(sreq), nil
+}
+
+func (s *SignSuite) TestRemodelRule(c *check.C) {
+	// Get the serial assertion for the original model
+	serialReq, err := generateSerialRequestAssertion("alder", "A123456L", "")
+	c.Assert(err, check.IsNil)
+	w := sendRequest("POST", "/v1/serial", bytes.NewReader(serialReq), "ValidAPIKey", c)
+	c.Assert(w.Code, check.Equals, 200)
+	serialAssertions := w.Body.String()
+
+	tests := []struct {
+		model   string
+		serial  string
+		code    int
+		errCode string
+		ruleID  int
+	}{
+		{"alder-vendor", "A123456L", 200, "", 1},
+		{"alder-vendor", "B123456L", 400, response.ErrorRemodelSerial.Code, 0},
+		{"alder-vendor-prefix", "V-A123456L", 200, "", 2},
+		{"alder-vendor-prefix", "A123456L", 400, response.ErrorRemodelSerial.Code, 0},
+		{"alder-vendor-any", "NEW0001", 200, "", 3},
+		{"alder-vendor-norule", "A123456L", 400, response.ErrorInvalidAssertion.Code, 0},
+	}
+
+	for _, t := range tests {
+		modelAssert := asserts.Encode(brandAccounts.Model("vendor", t.model, map[string]interface{}{
+			"architecture": "amd64",
+			"gadget":       "vendor-gadget",
+			"kernel":       "vendor-linux",
+		}))
+
+		assertions, err := generateRemodelRequest("vendor", t.model, "A123456L", t.serial)
+		c.Assert(err, check.IsNil)
+		assertions = append(assertions, []byte("\n"+string(modelAssert))...)
+		assertions = append(assertions, []byte("\n"+serialAssertions)...)
+
+		db := &historyMockDB{}
+		datastore.Environ.DB = db
+		w := sendRequest("POST", "/v1/serial", bytes.NewReader(assertions), "ValidAPIKey", c)
+		c.Assert(w.Code, check.Equals, t.code)
+
+		if t.code != 200 {
+			result := response.ErrorResponse{}
+			err = json.NewDecoder(w.Body).Decode(&result)
+			c.Assert(err, check.IsNil)
+			c.Assert(result.Code, check.Equals, t.errCode)
+			c.Assert(db.history, check.HasLen, 0)
+			continue
+		}
+
+		// The remodel is recorded in the history
+		c.Assert(db.history, check.HasLen, 1)
+		c.Assert(db.history[0].RuleID, check.Equals, t.ruleID)
+		c.Assert(db.history[0].FromModel, check.Equals, "alder")
+		c.Assert(db.history[0].FromSerial, check.Equals, "A123456L")
+		c.Assert(db.history[0].ToBrandID, check.Equals, "vendor")
+		c.Assert(db.history[0].ToModel, check.Equals, t.model)
+		c.Assert(db.history[0].ToSerial, check.Equals, t.serial)
+	}
+	datastore.Environ.DB = &trustedMockDB{}
+}
+
+func (s *SignSuite) TestRemodelSubstoreHistory(c *check.C) {
+	serialReq, err := generateSerialRequestAssertion("alder", "A123456L", "")
+	c.Assert(err, check.IsNil)
+	w := sendRequest("POST", "/v1/serial", bytes.NewReader(serialReq), "ValidAPIKey", c)
+	c.Assert(w.Code, check.Equals, 200)
+	serialAssertions := w.Body.String()
+
+	serialReq, err = generateSerialRequestAssertionRemodeling("alder-mybrand", "alder", "A123456L", "")
+	c.Assert(err, check.IsNil)
+	assertions := append(serialReq, []byte("\n"+newModelAssertion)...)
+	assertions = append(assertions, []byte("\n"+serialAssertions)...)
+
+	db := &historyMockDB{}
+	datastore.Environ.DB = db
+	w = sendRequest("POST", "/v1/serial", bytes.NewReader(assertions), "ValidAPIKey", c)
+	c.Assert(w.Code, check.Equals, 200)
+
+	// A remodel that is allowed by a sub-store mapping has no rule
+	c.Assert(db.history, check.HasLen, 1)
+	c.Assert(db.history[0].RuleID, check.Equals, 0)
+	c.Assert(db.history[0].ToModel, check.Equals, "alder-mybrand")
+	datastore.Environ.DB = &trustedMockDB{}
+}
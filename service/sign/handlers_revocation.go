@@ -0,0 +1,96 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package sign
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/crypt"
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	svlog "github.com/CanonicalLtd/serial-vault/service/log"
+	"github.com/CanonicalLtd/serial-vault/service/request"
+	"github.com/CanonicalLtd/serial-vault/service/response"
+)
+
+// RevocationSignatureHeader is the response header that holds the signature of the revocation list
+const RevocationSignatureHeader = "X-Revocation-Signature"
+
+// RevocationListResponse is the JSON response from the API Revocation List method
+type RevocationListResponse struct {
+	BrandID     string                       `json:"brand-id"`
+	Model       string                       `json:"model"`
+	Timestamp   time.Time                    `json:"timestamp"`
+	Revocations []datastore.SerialRevocation `json:"revocations"`
+}
+
+// RevocationList is the API method to fetch the revoked serial assertions of a model, so that
+// a device-management service can poll it. The response body is signed with the Ed25519
+// revocation signing key of the service, and the signature is returned in the
+// X-Revocation-Signature header. The model's API key is held by the factory stations, so it
+// cannot be used to sign the list
+func RevocationList(w http.ResponseWriter, r *http.Request) response.ErrorResponse {
+	// Check that we have an authorised API key header
+	apiKey, err := request.CheckModelAPI(r)
+	if err != nil {
+		svlog.Message("REVOCATION", response.ErrorInvalidAPIKey.Code, response.ErrorInvalidAPIKey.Message)
+		return response.ErrorInvalidAPIKey
+	}
+
+	// Validate the model by checking that it exists on the database
+	brandID := r.URL.Query().Get("brand-id")
+	modelName := r.URL.Query().Get("model")
+	model, err := datastore.Environ.DB.FindModel(brandID, modelName, apiKey)
+	if err != nil {
+		svlog.Message("REVOCATION", response.ErrorInvalidModel.Code, response.ErrorInvalidModel.Message)
+		return response.ErrorInvalidModel
+	}
+
+	if len(datastore.Environ.Config.RevocationSigningKey) == 0 {
+		svlog.Message("REVOCATION", "error-revocation-key", "The revocation signing key is not configured")
+		return response.ErrorResponse{Success: false, Code: "error-revocation-key", Message: "The revocation signing key is not configured", StatusCode: http.StatusInternalServerError}
+	}
+
+	revocations, err := datastore.Environ.DB.ListSerialRevocations(model.BrandID, model.Name)
+	if err != nil {
+		svlog.Message("REVOCATION", "error-fetch-revocations", err.Error())
+		return response.ErrorResponse{Success: false, Code: "error-fetch-revocations", Message: err.Error(), StatusCode: http.StatusBadRequest}
+	}
+
+	body, err := json.Marshal(RevocationListResponse{BrandID: model.BrandID, Model: model.Name, Timestamp: time.Now().UTC(), Revocations: revocations})
+	if err != nil {
+		svlog.Message("REVOCATION", "error-encode-revocations", err.Error())
+		return response.ErrorResponse{Success: false, Code: "error-encode-revocations", Message: err.Error(), StatusCode: http.StatusBadRequest}
+	}
+
+	signature, err := crypt.SignEd25519(datastore.Environ.Config.RevocationSigningKey, body)
+	if err != nil {
+		svlog.Message("REVOCATION", "error-revocation-key", err.Error())
+		return response.ErrorResponse{Success: false, Code: "error-revocation-key", Message: "The revocation signing key is invalid", StatusCode: http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", response.JSONHeader)
+	w.Header().Set(RevocationSignatureHeader, "ed25519="+signature)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+	return response.ErrorResponse{Success: true}
+}
@@ -0,0 +1,271 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package sign
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	svlog "github.com/CanonicalLtd/serial-vault/service/log"
+	"github.com/CanonicalLtd/serial-vault/service/quota"
+	"github.com/CanonicalLtd/serial-vault/service/request"
+	"github.com/CanonicalLtd/serial-vault/service/response"
+	"github.com/snapcore/snapd/asserts"
+)
+
+// MaxBatchSerials is the maximum number of serial-requests that can be signed in one batch
+const MaxBatchSerials = 1000
+
+// SerialStatus is the result of signing one of the serial-requests in a batch
+type SerialStatus struct {
+	RequestID    string `json:"request-id"`
+	BrandID      string `json:"brand-id"`
+	Model        string `json:"model"`
+	Serial       string `json:"serial"`
+	Success      bool   `json:"success"`
+	ErrorCode    string `json:"error_code"`
+	ErrorMessage string `json:"message"`
+}
+
+// SerialsResponse is the JSON response from the API Serials method. The serial assertions
+// are returned as a single assertion stream, in the order of the successful statuses
+type SerialsResponse struct {
+	Success      bool           `json:"success"`
+	ErrorMessage string         `json:"message"`
+	Assertions   string         `json:"assertions"`
+	Serials      []SerialStatus `json:"serials"`
+}
+
+// Serials is the API method to sign a batch of serial-requests from a factory line. The
+// request is a stream of serial-request assertions, each of which goes through the same
+// checks as the Serial method. The quota of the model is reserved for each serial before it is
+// signed, and the nonces are only used up once the whole batch has been validated. The signing
+// logs of the batch are stored in one transaction. The nonce store is not part of that
+// transaction, so when the logs cannot be stored the nonces of the batch stay used up and the
+// devices must fetch new request-ids, while the quota reserved for the batch is released
+func Serials(w http.ResponseWriter, r *http.Request) response.ErrorResponse {
+	// Check that we have an authorised API key header
+	apiKey, err := request.CheckModelAPI(r)
+	if err != nil {
+		svlog.Message("SIGN", response.ErrorInvalidAPIKey.Code, response.ErrorInvalidAPIKey.Message)
+		return response.ErrorInvalidAPIKey
+	}
+
+	serialReqs, errResponse := parseSerialRequestStream(r)
+	if !errResponse.Success {
+		return errResponse
+	}
+
+	statuses := make([]SerialStatus, 0, len(serialReqs))
+	validated := []signedSerial{}
+	validatedStatus := []int{}
+	inBatch := make(map[string]bool)
+	deviceKeys := make(map[string]datastore.SigningLog)
+
+	for _, serialReq := range serialReqs {
+		status := SerialStatus{
+			RequestID: serialReq.HeaderString("request-id"),
+			BrandID:   serialReq.BrandID(),
+			Model:     serialReq.Model(),
+			Serial:    serialReq.Serial(),
+		}
+
+		s, errResponse := signSerialRequest(serialReq, nil, nil, apiKey, reserveSerial)
+		if errResponse.Success {
+			status.Serial = s.signingLog.SerialNumber
+			errResponse = checkBatchDuplicate(s, inBatch, deviceKeys)
+			if !errResponse.Success {
+				s.reservation.Release()
+			}
+		}
+		if errResponse.Success {
+			validated = append(validated, s)
+			validatedStatus = append(validatedStatus, len(statuses))
+		}
+
+		statuses = append(statuses, setSerialStatus(status, errResponse))
+	}
+
+	// Use up the nonces of the validated serial-requests. A nonce that is repeated in the batch,
+	// or that has been used since it was checked, fails its serial-request. The serial-requests
+	// past the quota of their model keep their nonces, so they can be sent again later
+	signed := []signedSerial{}
+	for i, s := range validated {
+		status := statuses[validatedStatus[i]]
+		err = datastore.Environ.Nonces.ValidateDeviceNonce(status.RequestID, apiKey)
+		if err != nil {
+			s.reservation.Release()
+			svlog.Message("SIGN", response.ErrorInvalidNonce.Code, response.ErrorInvalidNonce.Message)
+			statuses[validatedStatus[i]] = setSerialStatus(status, response.ErrorInvalidNonce)
+			continue
+		}
+		signed = append(signed, s)
+	}
+
+	// Store the serial numbers and device-key fingerprints in the database
+	if len(signed) > 0 {
+		signingLogs := make([]datastore.SigningLog, 0, len(signed))
+		for _, s := range signed {
+			signingLogs = append(signingLogs, s.signingLog)
+		}
+
+		// The nonces have already been used up, which keeps a failed batch from being replayed
+		err = datastore.Environ.DB.CreateSigningLogs(signingLogs)
+		if err != nil {
+			for _, s := range signed {
+				s.reservation.Release()
+			}
+			svlog.Message("SIGN", "logging-assertion", err.Error())
+			return response.ErrorResponse{Success: false, Code: "logging-assertion", Message: err.Error(), StatusCode: http.StatusBadRequest}
+		}
+		notifySerialsSigned(signingLogs)
+	}
+
+	// Mark the serial numbers as signed in the models' allowlists
+	for _, s := range signed {
+		err = datastore.Environ.DB.UpdateSerialAllowlistSigned(s.model.ID, s.signingLog.SerialNumber)
+		if err != nil {
+			svlog.Message("SIGN", "update-serial-allowlist", err.Error())
+		}
+	}
+
+	// Return the JSON response with the signed assertions and the status of each request
+	return formatSerialsResponse(signed, statuses, w)
+}
+
+// reserveSerial reserves the quota of the model for a serial of the batch. The nonce is left for
+// later, so that a serial-request that is refused can be sent again
+func reserveSerial(nonce string, model datastore.Model) (quota.Reservation, response.ErrorResponse) {
+	reservation, errQuota := quota.Reserve(model, 1)
+	if !errQuota.Success {
+		svlog.Message("SIGN", errQuota.Code, errQuota.Message)
+	}
+	return reservation, errQuota
+}
+
+// setSerialStatus sets the result of signing a serial-request in the batch
+func setSerialStatus(status SerialStatus, errResponse response.ErrorResponse) SerialStatus {
+	status.Success = errResponse.Success
+	status.ErrorCode = errResponse.Code
+	status.ErrorMessage = errResponse.Message
+	return status
+}
+
+// checkBatchDuplicate checks a signed serial against the ones that have already been signed in
+// the batch. A serial number can only be signed once in a batch, and a device-key that is reused
+// in the batch is subject to the model's duplicate-signing policy
+func checkBatchDuplicate(s signedSerial, inBatch map[string]bool, deviceKeys map[string]datastore.SigningLog) response.ErrorResponse {
+	key := fmt.Sprintf("%s/%s/%s", s.signingLog.Make, s.signingLog.Model, s.signingLog.SerialNumber)
+	if inBatch[key] {
+		svlog.Message("SIGN", response.ErrorDuplicateInBatch.Code, response.ErrorDuplicateInBatch.Message)
+		return response.ErrorDuplicateInBatch
+	}
+
+	earlier, ok := deviceKeys[s.signingLog.Fingerprint]
+	if ok {
+		var msg string
+		switch s.model.DuplicatePolicy {
+		case datastore.DuplicatePolicyReject, datastore.DuplicatePolicySameDeviceKey:
+			msg = "The device-key has already been used to sign a device in the batch"
+		case datastore.DuplicatePolicyMaxResigns:
+			// A device-key that was signed for another serial number is also a re-sign
+			if earlier.Revision > s.model.MaxResigns {
+				msg = fmt.Sprintf("The device-key has already been re-signed the maximum number of times (%d)", s.model.MaxResigns)
+			}
+		}
+
+		if len(msg) > 0 {
+			svlog.Message("SIGN", response.ErrorDuplicatePolicy.Code, msg)
+			return response.ErrorResponse{Success: false, Code: response.ErrorDuplicatePolicy.Code, Message: msg, StatusCode: http.StatusBadRequest}
+		}
+	}
+
+	inBatch[key] = true
+	if !ok || s.signingLog.Revision > earlier.Revision {
+		deviceKeys[s.signingLog.Fingerprint] = s.signingLog
+	}
+	return response.ErrorResponse{Success: true}
+}
+
+func parseSerialRequestStream(r *http.Request) ([]*asserts.SerialRequest, response.ErrorResponse) {
+	defer r.Body.Close()
+	serialReqs := []*asserts.SerialRequest{}
+
+	// Use snapd assertion module to decode the assertions in the request stream
+	dec := asserts.NewDecoder(r.Body)
+	for {
+		assertion, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			svlog.Message("SIGN", "invalid-assertion", err.Error())
+			return nil, response.ErrorResponse{Success: false, Code: response.ErrorInvalidAssertion.Code, Message: err.Error(), StatusCode: http.StatusBadRequest}
+		}
+
+		// Check that we only have serial-request assertions (the details will have been validated by Decode call)
+		serialReq, ok := assertion.(*asserts.SerialRequest)
+		if !ok {
+			msg := fmt.Sprintf("The assertion type must be 'serial-request', got %q", assertion.Type().Name)
+			svlog.Message("SIGN", response.ErrorInvalidType.Code, msg)
+			return nil, response.ErrorResponse{Success: false, Code: response.ErrorInvalidType.Code, Message: msg, StatusCode: http.StatusBadRequest}
+		}
+
+		if len(serialReqs) == MaxBatchSerials {
+			svlog.Message("SIGN", response.ErrorBatchSize.Code, response.ErrorBatchSize.Message)
+			return nil, response.ErrorBatchSize
+		}
+		serialReqs = append(serialReqs, serialReq)
+	}
+
+	if len(serialReqs) == 0 {
+		svlog.Message("SIGN", "invalid-assertion", response.ErrorEmptyData.Message)
+		return nil, response.ErrorEmptyData
+	}
+
+	return serialReqs, response.ErrorResponse{Success: true}
+}
+
+func formatSerialsResponse(signed []signedSerial, statuses []SerialStatus, w http.ResponseWriter) response.ErrorResponse {
+	buf := new(bytes.Buffer)
+	encoder := asserts.NewEncoder(buf)
+	for _, s := range signed {
+		if err := encoder.Encode(s.assertion); err != nil {
+			svlog.Message("SIGN", "error-encode-assertion", err.Error())
+			return response.ErrorResponse{Success: false, Code: "error-encode-assertion", Message: err.Error(), StatusCode: http.StatusBadRequest}
+		}
+	}
+
+	resp := SerialsResponse{Success: len(signed) == len(statuses), Assertions: buf.String(), Serials: statuses}
+
+	w.Header().Set("Content-Type", response.JSONHeader)
+	w.WriteHeader(http.StatusOK)
+
+	// Encode the response as JSON
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		svlog.Message("SIGN", "error-encode-json", err.Error())
+	}
+	return response.ErrorResponse{Success: true}
+}
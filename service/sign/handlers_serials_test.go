@@ -0,0 +1,339 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package sign_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/response"
+	"github.com/CanonicalLtd/serial-vault/service/sign"
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	check "gopkg.in/check.v1"
+)
+
+// generateSerialRequestBatch generates a batch of serial-requests, each with its own device-key
+func generateSerialRequestBatch(serials ...string) ([]byte, error) {
+	return generateSerialRequestBatchWithNonce("REQID", serials...)
+}
+
+func generateSerialRequestBatchWithNonce(nonce string, serials ...string) ([]byte, error) {
+	batch := []byte{}
+	for _, serial := range serials {
+		privateKey, _ := assertstest.GenerateKey(752)
+		assertion, err := generateSerialRequestAssertionWithKey("alder", serial, "", nonce, privateKey)
+		if err != nil {
+			return nil, err
+		}
+		batch = append(batch, assertion...)
+		batch = append(batch, []byte("\n")...)
+	}
+	return batch, nil
+}
+
+func (s *SignSuite) TestSerials(c *check.C) {
+	batch, err := generateSerialRequestBatch("A123456L", "A123456L", "R12345", "A234567L")
+	c.Assert(err, check.IsNil)
+
+	w := sendRequest("POST", "/v1/serials", bytes.NewReader(batch), "ValidAPIKey", c)
+	c.Assert(w.Code, check.Equals, 200)
+	c.Assert(w.Header().Get("Content-Type"), check.Equals, response.JSONHeader)
+
+	result := sign.SerialsResponse{}
+	err = json.NewDecoder(w.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Success, check.Equals, false)
+	c.Assert(len(result.Serials), check.Equals, 4)
+
+	expected := []struct {
+		serial  string
+		success bool
+		code    string
+	}{
+		{"A123456L", true, ""},
+		{"A123456L", false, response.ErrorDuplicateInBatch.Code},
+		{"R12345", false, response.ErrorRevokedSerial.Code},
+		{"A234567L", true, ""},
+	}
+	for i, e := range expected {
+		c.Assert(result.Serials[i].Serial, check.Equals, e.serial)
+		c.Assert(result.Serials[i].RequestID, check.Equals, "REQID")
+		c.Assert(result.Serials[i].Success, check.Equals, e.success)
+		c.Assert(result.Serials[i].ErrorCode, check.Equals, e.code)
+	}
+
+	// The signed serial assertions are returned as a stream
+	dec := asserts.NewDecoder(strings.NewReader(result.Assertions))
+	serials := []string{}
+	for {
+		assertion, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, check.IsNil)
+		c.Assert(assertion.Type(), check.Equals, asserts.SerialType)
+		serials = append(serials, assertion.HeaderString("serial"))
+	}
+	c.Assert(serials, check.DeepEquals, []string{"A123456L", "A234567L"})
+}
+
+func (s *SignSuite) TestSerialsWebhookEvent(c *check.C) {
+	superuser := datastore.User{Role: datastore.Superuser}
+	hook, err := datastore.Environ.DB.CreateAllowedWebhook(datastore.Webhook{AuthorityID: "system", URL: "https://mes.example.com/hook", Events: []string{datastore.EventSerialSigned}}, superuser)
+	c.Assert(err, check.IsNil)
+	defer datastore.Environ.DB.DeleteAllowedWebhook(hook.ID, superuser)
+
+	batch, err := generateSerialRequestBatch("A123456L", "A234567L")
+	c.Assert(err, check.IsNil)
+
+	w := sendRequest("POST", "/v1/serials", bytes.NewReader(batch), "ValidAPIKey", c)
+	c.Assert(w.Code, check.Equals, 200)
+
+	// The serials of the batch are sent as a single event
+	deliveries, err := datastore.Environ.DB.ListAllowedWebhookDeliveries(hook.ID, superuser)
+	c.Assert(err, check.IsNil)
+	c.Assert(deliveries, check.HasLen, 1)
+
+	payload := struct {
+		Data struct {
+			BrandID string                   `json:"brand-id"`
+			Serials []map[string]interface{} `json:"serials"`
+		} `json:"data"`
+	}{}
+	c.Assert(json.Unmarshal([]byte(deliveries[0].Payload), &payload), check.IsNil)
+	c.Assert(payload.Data.BrandID, check.Equals, "system")
+	c.Assert(payload.Data.Serials, check.HasLen, 2)
+	c.Assert(payload.Data.Serials[0]["serial"], check.Equals, "A123456L")
+	c.Assert(payload.Data.Serials[1]["serial"], check.Equals, "A234567L")
+}
+
+func (s *SignSuite) TestSerialsAllSigned(c *check.C) {
+	batch, err := generateSerialRequestBatch("A123456L", "A234567L")
+	c.Assert(err, check.IsNil)
+
+	w := sendRequest("POST", "/v1/serials", bytes.NewReader(batch), "ValidAPIKey", c)
+	c.Assert(w.Code, check.Equals, 200)
+
+	result := sign.SerialsResponse{}
+	err = json.NewDecoder(w.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Success, check.Equals, true)
+	c.Assert(len(result.Serials), check.Equals, 2)
+}
+
+func (s *SignSuite) TestSerialsQuota(c *check.C) {
+	// The model can sign two more serials today
+	batch := []byte{}
+	for _, serial := range []string{"A123456L", "R12345", "A234567L", "A345678L"} {
+		privateKey, _ := assertstest.GenerateKey(752)
+		assertion, err := generateSerialRequestAssertionWithKey("alder-quota", serial, "", "REQID", privateKey)
+		c.Assert(err, check.IsNil)
+		batch = append(batch, assertion...)
+		batch = append(batch, []byte("\n")...)
+	}
+
+	w := sendRequest("POST", "/v1/serials", bytes.NewReader(batch), "ValidAPIKey", c)
+	c.Assert(w.Code, check.Equals, 200)
+
+	result := sign.SerialsResponse{}
+	err := json.NewDecoder(w.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Success, check.Equals, false)
+
+	expected := []struct {
+		success bool
+		code    string
+	}{
+		{true, ""},
+		{false, response.ErrorRevokedSerial.Code},
+		{true, ""},
+		{false, response.ErrorDailyQuota.Code},
+	}
+	for i, e := range expected {
+		c.Assert(result.Serials[i].Success, check.Equals, e.success)
+		c.Assert(result.Serials[i].ErrorCode, check.Equals, e.code)
+	}
+}
+
+func (s *SignSuite) TestSerialsDeviceKeyInBatch(c *check.C) {
+	// The same device-key is used for different serial numbers in the batch
+	privateKey, _ := assertstest.GenerateKey(752)
+
+	tests := []struct {
+		model   string
+		success bool
+		code    string
+	}{
+		{"alder", true, ""},
+		{"alder-reject", false, response.ErrorDuplicatePolicy.Code},
+		{"alder-samekey", false, response.ErrorDuplicatePolicy.Code},
+		{"alder-resigns", true, ""},
+	}
+
+	for _, t := range tests {
+		datastore.Environ.DB = &trustedMockDB{}
+
+		batch := []byte{}
+		for _, serial := range []string{"A123456L", "A234567L"} {
+			assertion, err := generateSerialRequestAssertionWithKey(t.model, serial, "", "REQID", privateKey)
+			c.Assert(err, check.IsNil)
+			batch = append(batch, assertion...)
+			batch = append(batch, []byte("\n")...)
+		}
+
+		w := sendRequest("POST", "/v1/serials", bytes.NewReader(batch), "ValidAPIKey", c)
+		c.Assert(w.Code, check.Equals, 200)
+
+		result := sign.SerialsResponse{}
+		err := json.NewDecoder(w.Body).Decode(&result)
+		c.Assert(err, check.IsNil)
+		c.Assert(result.Serials[0].Success, check.Equals, true)
+		c.Assert(result.Serials[1].Success, check.Equals, t.success)
+		c.Assert(result.Serials[1].ErrorCode, check.Equals, t.code)
+	}
+}
+
+func (s *SignSuite) TestSerialsNonce(c *check.C) {
+	datastore.Environ.Nonces = datastore.NewMemoryNonceStore(600)
+	defer func() { datastore.Environ.Nonces = &datastore.MockNonceStore{} }()
+
+	nonce, err := datastore.Environ.Nonces.CreateDeviceNonce("ValidAPIKey")
+	c.Assert(err, check.IsNil)
+
+	// The nonce is not used up by a serial-request that fails its checks
+	batch, err := generateSerialRequestBatchWithNonce(nonce.Nonce, "R12345")
+	c.Assert(err, check.IsNil)
+
+	w := sendRequest("POST", "/v1/serials", bytes.NewReader(batch), "ValidAPIKey", c)
+	c.Assert(w.Code, check.Equals, 200)
+	c.Assert(datastore.Environ.Nonces.CheckDeviceNonce(nonce.Nonce, "ValidAPIKey"), check.IsNil)
+
+	// A nonce that is repeated in the batch is only used once
+	batch, err = generateSerialRequestBatchWithNonce(nonce.Nonce, "A123456L", "A234567L")
+	c.Assert(err, check.IsNil)
+
+	w = sendRequest("POST", "/v1/serials", bytes.NewReader(batch), "ValidAPIKey", c)
+	c.Assert(w.Code, check.Equals, 200)
+
+	result := sign.SerialsResponse{}
+	err = json.NewDecoder(w.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Serials[0].Success, check.Equals, true)
+	c.Assert(result.Serials[1].Success, check.Equals, false)
+	c.Assert(result.Serials[1].ErrorCode, check.Equals, response.ErrorInvalidNonce.Code)
+}
+
+func (s *SignSuite) TestSerialsQuotaReleased(c *check.C) {
+	// The quota reserved for a batch is released when the signing logs cannot be stored
+	batch, err := generateSerialRequestBatch("A123456L", "AsigninglogError")
+	c.Assert(err, check.IsNil)
+	w := sendRequest("POST", "/v1/serials", bytes.NewReader(batch), "ValidAPIKey", c)
+	c.Assert(w.Code, check.Equals, 400)
+
+	// The quota reserved for a serial-request with a used nonce is released
+	datastore.Environ.Nonces = datastore.NewMemoryNonceStore(600)
+	defer func() { datastore.Environ.Nonces = &datastore.MockNonceStore{} }()
+
+	nonce, err := datastore.Environ.Nonces.CreateDeviceNonce("ValidAPIKey")
+	c.Assert(err, check.IsNil)
+	batch, err = generateSerialRequestBatchWithNonce(nonce.Nonce, "A123456L", "A234567L")
+	c.Assert(err, check.IsNil)
+	w = sendRequest("POST", "/v1/serials", bytes.NewReader(batch), "ValidAPIKey", c)
+	c.Assert(w.Code, check.Equals, 200)
+
+	// The model can sign five more serials today, and one of them has been signed
+	model := datastore.Model{ID: 1, BrandID: "system", Name: "alder"}
+	ok, _, err := datastore.Environ.DB.ReserveModelQuota(model, 4, time.Now())
+	c.Assert(err, check.IsNil)
+	c.Assert(ok, check.Equals, true)
+	ok, _, err = datastore.Environ.DB.ReserveModelQuota(model, 1, time.Now())
+	c.Assert(err, check.IsNil)
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *SignSuite) TestSerialsNoncesUsedOnLogError(c *check.C) {
+	// The nonces of a batch are used up when the signing logs cannot be stored, so the
+	// devices have to fetch new request-ids before the batch is sent again
+	datastore.Environ.Nonces = datastore.NewMemoryNonceStore(600)
+	defer func() { datastore.Environ.Nonces = &datastore.MockNonceStore{} }()
+
+	batch := []byte{}
+	nonces := []string{}
+	for _, serial := range []string{"A123456L", "AsigninglogError"} {
+		nonce, err := datastore.Environ.Nonces.CreateDeviceNonce("ValidAPIKey")
+		c.Assert(err, check.IsNil)
+		nonces = append(nonces, nonce.Nonce)
+
+		privateKey, _ := assertstest.GenerateKey(752)
+		assertion, err := generateSerialRequestAssertionWithKey("alder", serial, "", nonce.Nonce, privateKey)
+		c.Assert(err, check.IsNil)
+		batch = append(batch, assertion...)
+		batch = append(batch, []byte("\n")...)
+	}
+
+	w := sendRequest("POST", "/v1/serials", bytes.NewReader(batch), "ValidAPIKey", c)
+	c.Assert(w.Code, check.Equals, 400)
+
+	for _, nonce := range nonces {
+		err := datastore.Environ.Nonces.CheckDeviceNonce(nonce, "ValidAPIKey")
+		c.Assert(err, check.NotNil)
+	}
+
+	// The quota reserved for the batch has been released
+	model := datastore.Model{ID: 1, BrandID: "system", Name: "alder"}
+	ok, _, err := datastore.Environ.DB.ReserveModelQuota(model, 5, time.Now())
+	c.Assert(err, check.IsNil)
+	c.Assert(ok, check.Equals, true)
+}
+
+func (s *SignSuite) TestSerialsErrors(c *check.C) {
+	batch, err := generateSerialRequestBatch("A123456L", "A234567L")
+	c.Assert(err, check.IsNil)
+	batchSigningLogError, err := generateSerialRequestBatch("A123456L", "AsigninglogError")
+	c.Assert(err, check.IsNil)
+	batchWrongType := append(batch, []byte(modelAssertion)...)
+
+	tests := []SuiteTest{
+		{false, "POST", "/v1/serials", batch, 400, response.JSONHeader, "InvalidAPIKey"},
+		{false, "POST", "/v1/serials", nil, 400, response.JSONHeader, "ValidAPIKey"},
+		{false, "POST", "/v1/serials", []byte(badSerialRequest), 400, response.JSONHeader, "ValidAPIKey"},
+		{false, "POST", "/v1/serials", batchWrongType, 400, response.JSONHeader, "ValidAPIKey"},
+		{false, "POST", "/v1/serials", batchSigningLogError, 400, response.JSONHeader, "ValidAPIKey"},
+		{true, "POST", "/v1/serials", batch, 200, response.JSONHeader, "ValidAPIKey"},
+	}
+
+	for _, t := range tests {
+		if t.MockError {
+			datastore.Environ.DB = &datastore.ErrorMockDB{}
+		}
+
+		w := sendRequest(t.Method, t.URL, bytes.NewReader(t.Data), t.APIKey, c)
+		c.Assert(w.Code, check.Equals, t.Code)
+		c.Assert(w.Header().Get("Content-Type"), check.Equals, t.Type)
+
+		datastore.Environ.DB = &trustedMockDB{}
+	}
+}
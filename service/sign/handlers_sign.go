@@ -22,7 +22,6 @@ package sign
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -32,8 +31,10 @@ import (
 
 	"github.com/CanonicalLtd/serial-vault/datastore"
 	svlog "github.com/CanonicalLtd/serial-vault/service/log"
+	"github.com/CanonicalLtd/serial-vault/service/quota"
 	"github.com/CanonicalLtd/serial-vault/service/request"
 	"github.com/CanonicalLtd/serial-vault/service/response"
+	"github.com/CanonicalLtd/serial-vault/webhook"
 	"github.com/snapcore/snapd/asserts"
 	"gopkg.in/yaml.v2"
 )
@@ -49,19 +50,13 @@ type RequestIDResponse struct {
 func RequestID(w http.ResponseWriter, r *http.Request) response.ErrorResponse {
 	w.Header().Set("Content-Type", response.JSONHeader)
 	// Check that we have an authorised API key header
-	_, err := request.CheckModelAPI(r)
+	apiKey, err := request.CheckModelAPI(r)
 	if err != nil {
 		svlog.Message("REQUESTID", response.ErrorInvalidAPIKey.Code, response.ErrorInvalidAPIKey.Message)
 		return response.ErrorInvalidAPIKey
 	}
 
-	err = datastore.Environ.DB.DeleteExpiredDeviceNonces()
-	if err != nil {
-		svlog.Message("REQUESTID", "delete-expired-nonces", err.Error())
-		return response.ErrorGenerateNonce
-	}
-
-	nonce, err := datastore.Environ.DB.CreateDeviceNonce()
+	nonce, err := datastore.Environ.Nonces.CreateDeviceNonce(apiKey)
 	if err != nil {
 		svlog.Message("REQUESTID", "generate-request-id", err.Error())
 		return response.ErrorGenerateNonce
@@ -171,176 +166,460 @@ func Serial(w http.ResponseWriter, r *http.Request) response.ErrorResponse {
 		return response.ErrorResponse{Success: false, Code: response.ErrorInvalidAssertion.Code, Message: msg, StatusCode: http.StatusBadRequest}
 	}
 
-	err = asserts.SignatureCheck(serialReq, serialReq.DeviceKey())
+	// Reserve the quota of the model, as the API key may be shared with models that have quota
+	// left, and only then use up the nonce
+	reserve := func(nonce string, model datastore.Model) (quota.Reservation, response.ErrorResponse) {
+		reservation, errQuota := quota.Reserve(model, 1)
+		if !errQuota.Success {
+			return reservation, quota.Refuse(w, errQuota)
+		}
+
+		if err := datastore.Environ.Nonces.ValidateDeviceNonce(nonce, apiKey); err != nil {
+			reservation.Release()
+			svlog.Message("SIGN", response.ErrorInvalidNonce.Code, response.ErrorInvalidNonce.Message)
+			return quota.Reservation{}, response.ErrorInvalidNonce
+		}
+		return reservation, response.ErrorResponse{Success: true}
+	}
+
+	signed, errResponse := signSerialRequest(serialReq, assertions["model"], assertions["serial"], apiKey, reserve)
+	if !errResponse.Success {
+		return errResponse
+	}
+
+	// Store the serial number and device-key fingerprint in the database
+	err = datastore.Environ.DB.CreateSigningLog(signed.signingLog)
+	if err != nil {
+		signed.reservation.Release()
+		svlog.Message("SIGN", "logging-assertion", err.Error())
+		return response.ErrorResponse{Success: false, Code: "logging-assertion", Message: err.Error(), StatusCode: http.StatusBadRequest}
+	}
+	notifySerialsSigned([]datastore.SigningLog{signed.signingLog})
+
+	// Record the remodel of the device
+	if signed.remodel != nil {
+		if err = datastore.Environ.DB.CreateRemodelHistory(*signed.remodel); err != nil {
+			svlog.Message("SIGN", "remodel-history", err.Error())
+		}
+	}
+
+	// Mark the serial number as signed in the model's allowlist
+	err = datastore.Environ.DB.UpdateSerialAllowlistSigned(signed.model.ID, signed.signingLog.SerialNumber)
+	if err != nil {
+		svlog.Message("SIGN", "update-serial-allowlist", err.Error())
+	}
+
+	// Return successful JSON response with the signed text
+	formatSignResponse(signed.assertion, w)
+	return response.ErrorResponse{Success: true}
+}
+
+// notifySerialsSigned sends the signing of serial assertions to the webhooks of their brands. The
+// serials of a brand are queued as a single event, so a batch does not queue an event per serial
+func notifySerialsSigned(signingLogs []datastore.SigningLog) {
+	brands := []string{}
+	serials := make(map[string][]map[string]interface{})
+	for _, signingLog := range signingLogs {
+		if _, ok := serials[signingLog.Make]; !ok {
+			brands = append(brands, signingLog.Make)
+		}
+		serials[signingLog.Make] = append(serials[signingLog.Make], map[string]interface{}{
+			"model":       signingLog.Model,
+			"serial":      signingLog.SerialNumber,
+			"fingerprint": signingLog.Fingerprint,
+			"revision":    signingLog.Revision,
+			"created":     signingLog.Created,
+		})
+	}
+
+	for _, brandID := range brands {
+		webhook.Notify(brandID, datastore.EventSerialSigned, map[string]interface{}{
+			"brand-id": brandID,
+			"serials":  serials[brandID],
+		})
+	}
+}
+
+// signedSerial holds a signed serial assertion, along with the signing log that is to be
+// stored for it, the model that it was signed for and the quota reserved for it
+type signedSerial struct {
+	assertion   asserts.Assertion
+	signingLog  datastore.SigningLog
+	model       datastore.Model
+	remodel     *datastore.RemodelHistory
+	reservation quota.Reservation
+}
+
+// signSerialRequest validates a serial-request, along with the model and current serial assertions
+// of a remodeling request, and signs the serial assertion for the device. The signing log is not
+// stored, so that the caller can store it once the serial assertion is to be returned. Once the
+// request is valid, the caller's reserve function reserves the quota of the model before the serial
+// is signed, and may use up the nonce. The reservation is released if the signing fails
+func signSerialRequest(serialReq *asserts.SerialRequest, modelAssert, serialAssert asserts.Assertion, apiKey string, reserve func(nonce string, model datastore.Model) (quota.Reservation, response.ErrorResponse)) (signedSerial, response.ErrorResponse) {
+	err := asserts.SignatureCheck(serialReq, serialReq.DeviceKey())
 	if err != nil {
 		msg := fmt.Sprintf("could not validate serial-request self-signature (%s)", err)
 		svlog.Message("SIGN", response.ErrorInvalidAssertion.Code, msg)
-		return response.ErrorResponse{Success: false, Code: response.ErrorInvalidAssertion.Code, Message: msg, StatusCode: http.StatusBadRequest}
+		return signedSerial{}, response.ErrorResponse{Success: false, Code: response.ErrorInvalidAssertion.Code, Message: msg, StatusCode: http.StatusBadRequest}
 	}
 
 	// Double check the model assertion if present
-	modelAssert, ok := assertions["model"]
-	if ok {
+	if modelAssert != nil {
 		if modelAssert.HeaderString("brand-id") != serialReq.HeaderString("brand-id") || modelAssert.HeaderString("model") != serialReq.HeaderString("model") {
 			const msg = "Model and serial-request assertion do not match"
 			svlog.Message("SIGN", "mismatched-model", msg)
-			return response.ErrorResponse{Success: false, Code: "mismatched-model", Message: msg, StatusCode: http.StatusBadRequest}
+			return signedSerial{}, response.ErrorResponse{Success: false, Code: "mismatched-model", Message: msg, StatusCode: http.StatusBadRequest}
 		}
 
-		// TODO: ideally check the signature of model, need access
-		// to the brand public key(s) for models
+		// Check the signature of the model with the cached brand account-key
+		errResponse := verifyModelAssertion(modelAssert)
+		if !errResponse.Success {
+			return signedSerial{}, errResponse
+		}
 	}
 
+	var remodel *datastore.RemodelHistory
 	if isRemodelingSerialRequest(serialReq) {
-		serialAssert := assertions["serial"]
-		errResponse := checkRemodelingRequest(serialReq, modelAssert, serialAssert, apiKey)
+		history, errResponse := checkRemodelingRequest(serialReq, modelAssert, serialAssert, apiKey)
 		if !errResponse.Success {
-			return errResponse
+			return signedSerial{}, errResponse
 		}
+		remodel = &history
 	} else {
 		// Check the serial assertion
-		if _, ok := assertions["serial"]; ok {
+		if serialAssert != nil {
 			const msg = "unexpected assertion in the request stream"
 			svlog.Message("SIGN", response.ErrorInvalidAssertion.Code, msg)
-			return response.ErrorResponse{Success: false, Code: response.ErrorInvalidAssertion.Code, Message: msg, StatusCode: http.StatusBadRequest}
+			return signedSerial{}, response.ErrorResponse{Success: false, Code: response.ErrorInvalidAssertion.Code, Message: msg, StatusCode: http.StatusBadRequest}
 		}
 	}
 
-	// Verify that the nonce is valid and has not expired
-	err = datastore.Environ.DB.ValidateDeviceNonce(serialReq.HeaderString("request-id"))
+	// Verify that the nonce is valid, has not expired and was requested with the same API key. The
+	// nonce is not used up until the quota has been reserved
+	err = datastore.Environ.Nonces.CheckDeviceNonce(serialReq.HeaderString("request-id"), apiKey)
 	if err != nil {
 		svlog.Message("SIGN", response.ErrorInvalidNonce.Code, response.ErrorInvalidNonce.Message)
-		return response.ErrorInvalidNonce
+		return signedSerial{}, response.ErrorInvalidNonce
 	}
 
-	// Validate the model by checking that it exists on the database
+	// Validate the model by checking that it exists on the database, for the API key that the nonce
+	// was requested with
 	model, errResponse := findModel(serialReq.HeaderString("brand-id"), serialReq.HeaderString("model"), serialReq.HeaderString("serial"), apiKey)
 	if !errResponse.Success {
-		return errResponse
+		return signedSerial{}, errResponse
 	}
 
 	// Check that the model has an active keypair
 	if !model.KeyActive {
 		svlog.Message("SIGN", response.ErrorInactiveModel.Code, response.ErrorInactiveModel.Message)
-		return response.ErrorInactiveModel
+		return signedSerial{}, response.ErrorInactiveModel
 	}
 
 	// Create a basic signing log entry (without the serial number)
 	signingLog := datastore.SigningLog{Make: serialReq.HeaderString("brand-id"), Model: serialReq.HeaderString("model"), Fingerprint: serialReq.SignKeyID()}
 
 	// Convert the serial-request headers into a serial assertion
-	serialAssertion, err := serialRequestToSerial(serialReq, &signingLog)
-	if err != nil {
-		svlog.Message("SIGN", response.ErrorCreateAssertion.Code, err.Error())
-		return response.ErrorCreateAssertion
+	serialAssertion, errResponse := serialRequestToSerial(serialReq, model, &signingLog)
+	if !errResponse.Success {
+		return signedSerial{}, errResponse
+	}
+
+	// Check that no serial assertion has been revoked for the serial number
+	errResponse = checkSerialRevoked(signingLog.Make, signingLog.Model, signingLog.SerialNumber, 0)
+	if !errResponse.Success {
+		return signedSerial{}, errResponse
+	}
+
+	// Check that the serial number is registered for the model, if it has an allowlist
+	errResponse = checkSerialAllowlist(model, signingLog.SerialNumber)
+	if !errResponse.Success {
+		return signedSerial{}, errResponse
+	}
+
+	// Reserve the quota of the model for the serial, before it is signed
+	reservation, errResponse := reserve(serialReq.HeaderString("request-id"), model)
+	if !errResponse.Success {
+		return signedSerial{}, errResponse
 	}
 
 	// Sign the assertion with the snapd assertions module
 	signedAssertion, err := datastore.Environ.KeypairDB.SignAssertion(asserts.SerialType, serialAssertion.Headers(), serialAssertion.Body(), model.AuthorityID, model.KeyID, model.SealedKey)
 	if err != nil {
+		reservation.Release()
 		svlog.Message("SIGN", "signing-assertion", err.Error())
-		return response.ErrorResponse{Success: false, Code: "signing-assertion", Message: err.Error(), StatusCode: http.StatusBadRequest}
+		return signedSerial{}, response.ErrorResponse{Success: false, Code: "signing-assertion", Message: err.Error(), StatusCode: http.StatusBadRequest}
 	}
 
-	// Store the serial number and device-key fingerprint in the database
-	err = datastore.Environ.DB.CreateSigningLog(signingLog)
-	if err != nil {
-		svlog.Message("SIGN", "logging-assertion", err.Error())
-		return response.ErrorResponse{Success: false, Code: "logging-assertion", Message: err.Error(), StatusCode: http.StatusBadRequest}
+	// Complete the remodel history with the details of the new serial assertion
+	if remodel != nil {
+		remodel.ToBrandID = signingLog.Make
+		remodel.ToModel = signingLog.Model
+		remodel.ToSerial = signingLog.SerialNumber
+		remodel.Fingerprint = signingLog.Fingerprint
+		remodel.Revision = signingLog.Revision
 	}
 
-	// Return successful JSON response with the signed text
-	formatSignResponse(signedAssertion, w)
-	return response.ErrorResponse{Success: true}
+	return signedSerial{assertion: signedAssertion, signingLog: signingLog, model: model, remodel: remodel, reservation: reservation}, response.ErrorResponse{Success: true}
 }
 
-func checkRemodelingRequest(serialReq *asserts.SerialRequest, modelAssert, serialAssert asserts.Assertion, apiKey string) response.ErrorResponse {
+// checkRemodelingRequest validates the model and current serial assertions of a remodeling
+// request, and returns the remodel history of the device without the new serial assertion details
+func checkRemodelingRequest(serialReq *asserts.SerialRequest, modelAssert, serialAssert asserts.Assertion, apiKey string) (datastore.RemodelHistory, response.ErrorResponse) {
 	originalBrandID := serialReq.HeaderString("original-brand-id")
 	originalModel := serialReq.HeaderString("original-model")
 	originalSerial := serialReq.HeaderString("original-serial")
+	remodel := datastore.RemodelHistory{FromBrandID: originalBrandID, FromModel: originalModel, FromSerial: originalSerial}
 
 	if modelAssert == nil {
 		const msg = "Model assertion can't be empty for a remodeling request"
 		svlog.Message("SIGN", "invalid-assertion", msg)
-		return response.ErrorResponse{Success: false, Code: response.ErrorInvalidAssertion.Code, Message: msg, StatusCode: http.StatusBadRequest}
+		return remodel, response.ErrorResponse{Success: false, Code: response.ErrorInvalidAssertion.Code, Message: msg, StatusCode: http.StatusBadRequest}
 	}
 
 	// Double check the serial assertion
 	if serialAssert == nil {
 		const msg = "The current serial assertion can't be empty for a remodeling request"
 		svlog.Message("SIGN", "invalid-assertion", msg)
-		return response.ErrorResponse{Success: false, Code: response.ErrorInvalidAssertion.Code, Message: msg, StatusCode: http.StatusBadRequest}
+		return remodel, response.ErrorResponse{Success: false, Code: response.ErrorInvalidAssertion.Code, Message: msg, StatusCode: http.StatusBadRequest}
 	}
 
-	// Validate the original model by checking that it exists on the database
-	originalModelAssert, errResponse := findModel(originalBrandID, originalModel, originalSerial, apiKey)
+	// Validate the new model: the remodel must be allowed by a rule or a sub-store mapping
+	fromModel, ruleID, errResponse := findRemodelOriginalModel(serialReq, apiKey)
 	if !errResponse.Success {
-		svlog.Message("SIGN", "invalid-assertion", "original model is not valid")
-		return errResponse
-	}
-
-	// Validate the new model: it must be defind in the sub-store of the orignal model
-	substore, err := datastore.Environ.DB.GetSubstore(originalModelAssert.ID, originalSerial)
-	if err != nil {
-		svlog.Message("PIVOT", "invalid-substore", "Cannot find sub-store mapping for the model")
-		return response.ErrorInvalidSubstore
-	}
-
-	// Check if find model maches requested model
-	if serialReq.HeaderString("model") != substore.ModelName {
-		const msg = "Requested model is invalid"
-		svlog.Message("SIGN", "invalid-assertion", msg)
-		return response.ErrorResponse{Success: false, Code: response.ErrorInvalidAssertion.Code, Message: msg, StatusCode: http.StatusBadRequest}
+		return remodel, errResponse
 	}
+	remodel.RuleID = ruleID
 
 	// Check that original-* fields are matching old serial
 	if serialAssert.HeaderString("model") != originalModel {
 		const msg = "Original model is invalid"
 		svlog.Message("SIGN", "invalid-assertion", msg)
-		return response.ErrorResponse{Success: false, Code: response.ErrorInvalidAssertion.Code, Message: msg, StatusCode: http.StatusBadRequest}
+		return remodel, response.ErrorResponse{Success: false, Code: response.ErrorInvalidAssertion.Code, Message: msg, StatusCode: http.StatusBadRequest}
 	}
 	if serialAssert.HeaderString("serial") != originalSerial {
 		const msg = "Original serial number is invalid"
 		svlog.Message("SIGN", "invalid-assertion", msg)
-		return response.ErrorResponse{Success: false, Code: response.ErrorInvalidAssertion.Code, Message: msg, StatusCode: http.StatusBadRequest}
+		return remodel, response.ErrorResponse{Success: false, Code: response.ErrorInvalidAssertion.Code, Message: msg, StatusCode: http.StatusBadRequest}
 	}
 	if serialAssert.HeaderString("brand-id") != originalBrandID {
 		const msg = "Original brand-id is invalid"
 		svlog.Message("SIGN", "invalid-assertion", msg)
-		return response.ErrorResponse{Success: false, Code: response.ErrorInvalidAssertion.Code, Message: msg, StatusCode: http.StatusBadRequest}
+		return remodel, response.ErrorResponse{Success: false, Code: response.ErrorInvalidAssertion.Code, Message: msg, StatusCode: http.StatusBadRequest}
 	}
 
 	// Check that the device key is the same between serial-request and old serial
 	if serialAssert.HeaderString("device-key") != serialReq.HeaderString("device-key") {
 		const msg = "Device-key is invalid"
 		svlog.Message("SIGN", "invalid-assertion", msg)
-		return response.ErrorResponse{Success: false, Code: response.ErrorInvalidAssertion.Code, Message: msg, StatusCode: http.StatusBadRequest}
+		return remodel, response.ErrorResponse{Success: false, Code: response.ErrorInvalidAssertion.Code, Message: msg, StatusCode: http.StatusBadRequest}
 	}
 
-	keyID := substore.FromModel.KeyID
-	if keyID != serialAssert.HeaderString("sign-key-sha3-384") {
+	// The serial may be signed by the model's key, or by a key of a rotation that is in its overlap period
+	keypair, ok := findSigningKeypair(fromModel, serialAssert.HeaderString("sign-key-sha3-384"))
+	if !ok {
 		msg := fmt.Sprintf("public key id for the model is invalid")
 		svlog.Message("SIGN", response.ErrorInvalidAssertion.Code, msg)
-		return response.ErrorResponse{Success: false, Code: response.ErrorInvalidAssertion.Code, Message: msg, StatusCode: http.StatusBadRequest}
+		return remodel, response.ErrorResponse{Success: false, Code: response.ErrorInvalidAssertion.Code, Message: msg, StatusCode: http.StatusBadRequest}
 	}
 
-	oldModelPublicKey, err := datastore.Environ.KeypairDB.PublicKey(keyID)
+	err := datastore.Environ.KeypairDB.LoadKeypair(keypair.AuthorityID, keypair.KeyID, keypair.SealedKey)
 	if err != nil {
 		msg := fmt.Sprintf("could not find public key for the model (%s)", err)
 		svlog.Message("SIGN", response.ErrorInvalidAssertion.Code, msg)
-		return response.ErrorResponse{Success: false, Code: response.ErrorInvalidAssertion.Code, Message: msg, StatusCode: http.StatusBadRequest}
+		return remodel, response.ErrorResponse{Success: false, Code: response.ErrorInvalidAssertion.Code, Message: msg, StatusCode: http.StatusBadRequest}
+	}
+
+	oldModelPublicKey, err := datastore.Environ.KeypairDB.PublicKey(keypair.KeyID)
+	if err != nil {
+		msg := fmt.Sprintf("could not find public key for the model (%s)", err)
+		svlog.Message("SIGN", response.ErrorInvalidAssertion.Code, msg)
+		return remodel, response.ErrorResponse{Success: false, Code: response.ErrorInvalidAssertion.Code, Message: msg, StatusCode: http.StatusBadRequest}
 	}
 
 	err = asserts.SignatureCheck(serialAssert, oldModelPublicKey)
 	if err != nil {
 		msg := fmt.Sprintf("could not validate serial-request self-signature (%s)", err)
 		svlog.Message("SIGN", response.ErrorInvalidAssertion.Code, msg)
-		return response.ErrorResponse{Success: false, Code: response.ErrorInvalidAssertion.Code, Message: msg, StatusCode: http.StatusBadRequest}
+		return remodel, response.ErrorResponse{Success: false, Code: response.ErrorInvalidAssertion.Code, Message: msg, StatusCode: http.StatusBadRequest}
 	}
 
+	// Check that the current serial assertion has not been revoked
+	return remodel, checkSerialRevoked(originalBrandID, originalModel, originalSerial, serialAssert.Revision())
+}
+
+// findRemodelOriginalModel finds the original model of a remodeling request. The remodel must be
+// allowed by a remodel rule from the original model to the new model, otherwise the new model
+// must be defined in the sub-store of the original model and serial number
+func findRemodelOriginalModel(serialReq *asserts.SerialRequest, apiKey string) (datastore.Model, int, response.ErrorResponse) {
+	originalBrandID := serialReq.HeaderString("original-brand-id")
+	originalModel := serialReq.HeaderString("original-model")
+	originalSerial := serialReq.HeaderString("original-serial")
+
+	rule, err := datastore.Environ.DB.GetRemodelRule(originalBrandID, originalModel, serialReq.HeaderString("brand-id"), serialReq.HeaderString("model"))
+	if err == nil {
+		// Check that the serial number for the new model follows the rule
+		if err = rule.CheckSerial(originalSerial, serialRequestNumber(serialReq)); err != nil {
+			svlog.Message("SIGN", response.ErrorRemodelSerial.Code, err.Error())
+			return rule.FromModel, rule.ID, response.ErrorResponse{Success: false, Code: response.ErrorRemodelSerial.Code, Message: err.Error(), StatusCode: http.StatusBadRequest}
+		}
+		return rule.FromModel, rule.ID, response.ErrorResponse{Success: true}
+	}
+
+	// Validate the original model by checking that it exists on the database
+	originalModelAssert, errResponse := findModel(originalBrandID, originalModel, originalSerial, apiKey)
+	if !errResponse.Success {
+		svlog.Message("SIGN", "invalid-assertion", "original model is not valid")
+		return originalModelAssert, 0, errResponse
+	}
+
+	// Validate the new model: it must be defind in the sub-store of the orignal model
+	substore, err := datastore.Environ.DB.GetSubstore(originalModelAssert.ID, originalSerial)
+	if err != nil {
+		svlog.Message("PIVOT", "invalid-substore", "Cannot find sub-store mapping for the model")
+		return originalModelAssert, 0, response.ErrorInvalidSubstore
+	}
+
+	// Check if find model maches requested model
+	if serialReq.HeaderString("model") != substore.ModelName {
+		const msg = "Requested model is invalid"
+		svlog.Message("SIGN", "invalid-assertion", msg)
+		return substore.FromModel, 0, response.ErrorResponse{Success: false, Code: response.ErrorInvalidAssertion.Code, Message: msg, StatusCode: http.StatusBadRequest}
+	}
+
+	return substore.FromModel, 0, response.ErrorResponse{Success: true}
+}
+
+// serialRequestNumber returns the serial number of a serial-request, from the header or the body
+func serialRequestNumber(serialReq *asserts.SerialRequest) string {
+	if serial := serialReq.HeaderString("serial"); len(serial) > 0 {
+		return serial
+	}
+
+	// Decode the body which must be YAML, ignore errors
+	body := make(map[string]interface{})
+	yaml.Unmarshal(serialReq.Body(), &body)
+
+	serial, _ := body["serial"].(string)
+	return serial
+}
+
+// verifyModelAssertion checks the signature of a model assertion. The account and account-key
+// assertions that are cached in the database are trusted, so the store does not need to be reachable
+func verifyModelAssertion(modelAssert asserts.Assertion) response.ErrorResponse {
+	db, err := trustedAssertionDatabase(modelAssert.AuthorityID(), modelAssert.SignKeyID())
+	if err == nil {
+		err = db.Check(modelAssert)
+	}
+	if err != nil {
+		msg := fmt.Sprintf("could not verify the model assertion signature (%s)", err)
+		svlog.Message("SIGN", response.ErrorInvalidModelSignature.Code, msg)
+		return response.ErrorResponse{Success: false, Code: response.ErrorInvalidModelSignature.Code, Message: msg, StatusCode: http.StatusBadRequest}
+	}
+	return response.ErrorResponse{Success: true}
+}
+
+// trustedAssertionDatabase opens an assertion database that trusts the account assertion of the
+// authority and the account-key assertion of its signing-key
+func trustedAssertionDatabase(authorityID, keyID string) (*asserts.Database, error) {
+	keypair, err := datastore.Environ.DB.GetKeypairByPublicID(authorityID, keyID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find the signing-key %s", keyID)
+	}
+	accountKey, err := decodeCachedAssertion(keypair.Assertion, asserts.AccountKeyType)
+	if err != nil {
+		return nil, err
+	}
+	if accountKey.HeaderString("account-id") != authorityID || accountKey.HeaderString("public-key-sha3-384") != keyID {
+		return nil, fmt.Errorf("the account-key assertion does not match the signing-key %s", keyID)
+	}
+
+	account, err := datastore.Environ.DB.GetAccount(authorityID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find the account %s", authorityID)
+	}
+	accountAssert, err := decodeCachedAssertion(account.Assertion, asserts.AccountType)
+	if err != nil {
+		return nil, err
+	}
+	if accountAssert.HeaderString("account-id") != authorityID {
+		return nil, fmt.Errorf("the account assertion does not match the account %s", authorityID)
+	}
+
+	return asserts.OpenDatabase(&asserts.DatabaseConfig{
+		Backstore: asserts.NewMemoryBackstore(),
+		Trusted:   []asserts.Assertion{accountAssert, accountKey},
+	})
+}
+
+// decodeCachedAssertion decodes an assertion of the expected type that is cached in the database
+func decodeCachedAssertion(encoded string, assertType *asserts.AssertionType) (asserts.Assertion, error) {
+	if len(encoded) == 0 {
+		return nil, fmt.Errorf("no %s assertion has been uploaded", assertType.Name)
+	}
+	assertion, err := asserts.Decode([]byte(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s assertion: %v", assertType.Name, err)
+	}
+	if assertion.Type() != assertType {
+		return nil, fmt.Errorf("expected an %s assertion, got %q", assertType.Name, assertion.Type().Name)
+	}
+	return assertion, nil
+}
+
+// checkSerialRevoked checks that a revision of the serial assertion has not been revoked.
+// A revision of zero checks that none of the serial assertions of the serial number are revoked
+func checkSerialRevoked(brandID, modelName, serialNumber string, revision int) response.ErrorResponse {
+	revoked, err := datastore.Environ.DB.CheckSerialRevoked(brandID, modelName, serialNumber, revision)
+	if err != nil {
+		svlog.Message("SIGN", response.ErrorCheckAssertion.Code, err.Error())
+		return response.ErrorCheckAssertion
+	}
+	if revoked {
+		svlog.Message("SIGN", response.ErrorRevokedSerial.Code, response.ErrorRevokedSerial.Message)
+		return response.ErrorRevokedSerial
+	}
 	return response.ErrorResponse{Success: true}
 }
 
+// checkSerialAllowlist checks that the serial number may be signed for the model
+func checkSerialAllowlist(model datastore.Model, serialNumber string) response.ErrorResponse {
+	err := datastore.Environ.DB.CheckSerialAllowlist(model.ID, serialNumber)
+	switch err {
+	case nil:
+		return response.ErrorResponse{Success: true}
+	case datastore.ErrorSerialNotAllowed:
+		svlog.Message("SIGN", response.ErrorUnknownSerial.Code, response.ErrorUnknownSerial.Message)
+		return response.ErrorUnknownSerial
+	case datastore.ErrorSerialRevoked:
+		svlog.Message("SIGN", response.ErrorRevokedSerial.Code, response.ErrorRevokedSerial.Message)
+		return response.ErrorRevokedSerial
+	default:
+		svlog.Message("SIGN", response.ErrorCheckAssertion.Code, err.Error())
+		return response.ErrorCheckAssertion
+	}
+}
+
+// findSigningKeypair finds the keypair of the model with the key ID. The model's current key is
+// accepted, along with the retiring and successor keys of a key rotation in its overlap period
+func findSigningKeypair(model datastore.Model, keyID string) (datastore.Keypair, bool) {
+	if model.KeyID == keyID {
+		return datastore.Keypair{AuthorityID: model.AuthorityID, KeyID: model.KeyID, SealedKey: model.SealedKey}, true
+	}
+
+	keypairs, err := datastore.Environ.DB.ListRotationKeypairs(model.ID, datastore.KeyTypeSigning)
+	if err != nil {
+		log.Println(err)
+		return datastore.Keypair{}, false
+	}
+
+	for _, k := range keypairs {
+		if k.KeyID == keyID {
+			return k, true
+		}
+	}
+	return datastore.Keypair{}, false
+}
+
 // findModel finds the model by checking that there is an original or pivoted model
 func findModel(brandID, modelName, serialNumer, apiKey string) (datastore.Model, response.ErrorResponse) {
 	// Assume this is an original (non-pivoted) serial assertion
@@ -350,6 +629,7 @@ func findModel(brandID, modelName, serialNumer, apiKey string) (datastore.Model,
 		svlog.Message("SIGN", response.ErrorInvalidModel.Code, response.ErrorInvalidModel.Message)
 	} else {
 		// Found the model, so return it
+		useDueKeyRotations(&model)
 		return model, response.ErrorResponse{Success: true}
 	}
 
@@ -362,15 +642,25 @@ func findModel(brandID, modelName, serialNumer, apiKey string) (datastore.Model,
 		return model, response.ErrorInvalidModelSubstore
 	}
 
-	if substore.FromModel.APIKey != apiKey {
+	// The API key must be one of the original model's keys
+	if _, err := datastore.Environ.DB.FindModel(substore.FromModel.BrandID, substore.FromModel.Name, apiKey); err != nil {
 		return substore.FromModel, response.ErrorInvalidModelSubstore
 	}
 
+	useDueKeyRotations(&substore.FromModel)
 	return substore.FromModel, response.ErrorResponse{Success: true}
 }
 
-// serialRequestToSerial converts a serial-request to a serial assertion
-func serialRequestToSerial(assertion asserts.Assertion, signingLog *datastore.SigningLog) (asserts.Assertion, error) {
+// useDueKeyRotations signs with the successor key of a rotation that is due, until it is promoted
+// by the background job. The retiring key is still accepted, so an error is only logged
+func useDueKeyRotations(model *datastore.Model) {
+	if err := datastore.Environ.DB.ApplyDueKeyRotations(model); err != nil {
+		svlog.Message("SIGN", "due-key-rotations", err.Error())
+	}
+}
+
+// serialRequestToSerial converts a serial-request to a serial assertion, applying the model's duplicate-signing policy
+func serialRequestToSerial(assertion asserts.Assertion, model datastore.Model, signingLog *datastore.SigningLog) (asserts.Assertion, response.ErrorResponse) {
 
 	// Create the serial assertion header from the serial-request headers
 	serialHeaders := assertion.Headers()
@@ -399,7 +689,7 @@ func serialRequestToSerial(assertion asserts.Assertion, signingLog *datastore.Si
 	// Check that we have a serial
 	if headers["serial"] == nil {
 		svlog.Message("SIGN", "create-assertion", response.ErrorEmptySerial.Message)
-		return nil, errors.New(response.ErrorEmptySerial.Message)
+		return nil, response.ErrorEmptySerial
 	}
 
 	// Check that we have not already signed this device, and get the max. revision number for the serial number
@@ -407,10 +697,14 @@ func serialRequestToSerial(assertion asserts.Assertion, signingLog *datastore.Si
 	duplicateExists, maxRevision, err := datastore.Environ.DB.CheckForDuplicate(signingLog)
 	if err != nil {
 		svlog.Message("SIGN", "duplicate-assertion", err.Error())
-		return nil, errors.New(response.ErrorDuplicateAssertion.Message)
+		return nil, response.ErrorCreateAssertion
 	}
 	if duplicateExists {
 		svlog.Message("SIGN", "duplicate-assertion", "The serial number and/or device-key have already been used to sign a device")
+
+		if errResponse := checkDuplicatePolicy(model, *signingLog, maxRevision); !errResponse.Success {
+			return nil, errResponse
+		}
 	}
 
 	// Set the revision number, incrementing the previously used one
@@ -424,7 +718,56 @@ func serialRequestToSerial(assertion asserts.Assertion, signingLog *datastore.Si
 
 	// Create a new serial assertion
 	content, signature := assertion.Signature()
-	return asserts.Assemble(headers, assertion.Body(), content, signature)
+	serialAssertion, err := asserts.Assemble(headers, assertion.Body(), content, signature)
+	if err != nil {
+		svlog.Message("SIGN", response.ErrorCreateAssertion.Code, err.Error())
+		return nil, response.ErrorCreateAssertion
+	}
+	return serialAssertion, response.ErrorResponse{Success: true}
+}
+
+// checkDuplicatePolicy checks that the model's duplicate-signing policy allows a serial
+// number or device-key that has been signed before to be signed again
+func checkDuplicatePolicy(model datastore.Model, signingLog datastore.SigningLog, maxRevision int) response.ErrorResponse {
+	var msg string
+
+	switch model.DuplicatePolicy {
+	case datastore.DuplicatePolicyReject:
+		msg = "The serial number and/or device-key have already been used to sign a device"
+
+	case datastore.DuplicatePolicySameDeviceKey:
+		conflict, err := datastore.Environ.DB.CheckForDeviceKeyConflict(signingLog)
+		if err != nil {
+			svlog.Message("SIGN", response.ErrorCheckAssertion.Code, err.Error())
+			return response.ErrorCheckAssertion
+		}
+		if conflict {
+			msg = "The serial number and device-key do not match the ones that have already been signed"
+		}
+
+	case datastore.DuplicatePolicyMaxResigns:
+		// A device-key that was signed for another serial number is also a re-sign
+		resignRevision, err := datastore.Environ.DB.FindMaxResignRevision(signingLog)
+		if err != nil {
+			svlog.Message("SIGN", response.ErrorCheckAssertion.Code, err.Error())
+			return response.ErrorCheckAssertion
+		}
+		if resignRevision > maxRevision {
+			maxRevision = resignRevision
+		}
+
+		// The first signature of the serial number is not a re-sign
+		if maxRevision > model.MaxResigns {
+			msg = fmt.Sprintf("The serial number has already been re-signed the maximum number of times (%d)", model.MaxResigns)
+		}
+	}
+
+	if len(msg) == 0 {
+		return response.ErrorResponse{Success: true}
+	}
+
+	svlog.Message("SIGN", response.ErrorDuplicatePolicy.Code, msg)
+	return response.ErrorResponse{Success: false, Code: response.ErrorDuplicatePolicy.Code, Message: msg, StatusCode: http.StatusBadRequest}
 }
 
 func formatSignResponse(assertion asserts.Assertion, w http.ResponseWriter) error {
@@ -22,19 +22,25 @@ package sign_test
 
 import (
 	"bytes"
+	"crypto/ed25519"
 	"encoding/base64"
+	"encoding/json"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/CanonicalLtd/serial-vault/config"
 	"github.com/CanonicalLtd/serial-vault/crypt"
 	"github.com/CanonicalLtd/serial-vault/datastore"
 	"github.com/CanonicalLtd/serial-vault/service"
 	"github.com/CanonicalLtd/serial-vault/service/response"
+	"github.com/CanonicalLtd/serial-vault/service/sign"
 	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
 	check "gopkg.in/check.v1"
 )
 
@@ -59,7 +65,7 @@ var _ = check.Suite(&SignSuite{})
 func (s *SignSuite) SetUpTest(c *check.C) {
 	// Mock the database
 	config := config.Settings{KeyStoreType: "filesystem", KeyStorePath: "../../keystore", JwtSecret: "SomeTestSecretValue"}
-	datastore.Environ = &datastore.Env{DB: &datastore.MockDB{}, Config: config}
+	datastore.Environ = &datastore.Env{DB: &trustedMockDB{}, Config: config, Nonces: &datastore.MockNonceStore{}}
 	datastore.OpenKeyStore(config)
 }
 
@@ -135,10 +141,40 @@ func (s *SignSuite) TestSerial(c *check.C) {
 		c.Assert(w.Code, check.Equals, t.Code)
 		c.Assert(w.Header().Get("Content-Type"), check.Equals, t.Type)
 
-		datastore.Environ.DB = &datastore.MockDB{}
+		datastore.Environ.DB = &trustedMockDB{}
 	}
 }
 
+func (s *SignSuite) TestSerialModelSignature(c *check.C) {
+	tests := []struct {
+		model string
+		db    datastore.Datastore
+		code  int
+	}{
+		{modelAssertion, &trustedMockDB{}, 200},
+		{unsignedModelAssertion, &trustedMockDB{}, 400},
+		{forgedModelAssertion(), &trustedMockDB{}, 400},
+		{modelAssertion, &datastore.MockDB{}, 400},
+	}
+
+	for _, t := range tests {
+		assertions, err := generateSerialRequestAssertion("alder", "A123456L", "")
+		c.Assert(err, check.IsNil)
+		assertions = append(assertions, []byte("\n"+t.model)...)
+
+		datastore.Environ.DB = t.db
+		w := sendRequest("POST", "/v1/serial", bytes.NewReader(assertions), "ValidAPIKey", c)
+		c.Assert(w.Code, check.Equals, t.code)
+		if t.code != 200 {
+			result := response.ErrorResponse{}
+			err = json.NewDecoder(w.Body).Decode(&result)
+			c.Assert(err, check.IsNil)
+			c.Assert(result.Code, check.Equals, response.ErrorInvalidModelSignature.Code)
+		}
+	}
+	datastore.Environ.DB = &trustedMockDB{}
+}
+
 func (s *SignSuite) TestRequestIDHandler(c *check.C) {
 	tests := []SuiteTest{
 		{false, "POST", "/v1/request-id", nil, 200, response.JSONHeader, "InbuiltAPIKey"},
@@ -148,17 +184,80 @@ func (s *SignSuite) TestRequestIDHandler(c *check.C) {
 
 	for _, t := range tests {
 		if t.MockError {
-			datastore.Environ.DB = &datastore.ErrorMockDB{}
+			datastore.Environ.Nonces = &datastore.ErrorMockNonceStore{}
 		}
 
 		w := sendRequest(t.Method, t.URL, bytes.NewReader(t.Data), t.APIKey, c)
 		c.Assert(w.Code, check.Equals, t.Code)
 		c.Assert(w.Header().Get("Content-Type"), check.Equals, t.Type)
 
-		datastore.Environ.DB = &datastore.MockDB{}
+		datastore.Environ.Nonces = &datastore.MockNonceStore{}
 	}
 }
 
+func (s *SignSuite) TestSerialNonceError(c *check.C) {
+	datastore.Environ.Nonces = &datastore.ErrorMockNonceStore{}
+
+	assertions, err := generateSerialRequestAssertion("alder", "A123456L", "")
+	c.Assert(err, check.IsNil)
+	w := sendRequest("POST", "/v1/serial", bytes.NewReader(assertions), "ValidAPIKey", c)
+	c.Assert(w.Code, check.Equals, 400)
+	result := response.ErrorResponse{}
+	err = json.NewDecoder(w.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Code, check.Equals, response.ErrorInvalidNonce.Code)
+
+	datastore.Environ.Nonces = &datastore.MockNonceStore{}
+}
+
+func (s *SignSuite) TestSerialNonceAPIKey(c *check.C) {
+	datastore.Environ.Nonces = datastore.NewMemoryNonceStore(600)
+
+	requestID := func(apiKey string) string {
+		w := sendRequest("POST", "/v1/request-id", nil, apiKey, c)
+		c.Assert(w.Code, check.Equals, 200)
+		result := sign.RequestIDResponse{}
+		err := json.NewDecoder(w.Body).Decode(&result)
+		c.Assert(err, check.IsNil)
+		return result.RequestID
+	}
+
+	// A nonce that was requested with another API key is refused
+	otherNonce := requestID("OtherAPIKey")
+	nonce := requestID("ValidAPIKey")
+
+	tests := []struct {
+		nonce string
+		code  int
+	}{
+		{otherNonce, 400},
+		{nonce, 200},
+		{nonce, 400},
+	}
+
+	for _, t := range tests {
+		assertions, err := generateSerialRequestAssertionWithNonce("alder", "A123456L", "", t.nonce)
+		c.Assert(err, check.IsNil)
+
+		w := sendRequest("POST", "/v1/serial", bytes.NewReader(assertions), "ValidAPIKey", c)
+		c.Assert(w.Code, check.Equals, t.code)
+		if t.code != 200 {
+			result := response.ErrorResponse{}
+			err = json.NewDecoder(w.Body).Decode(&result)
+			c.Assert(err, check.IsNil)
+			c.Assert(result.Code, check.Equals, response.ErrorInvalidNonce.Code)
+		}
+	}
+
+	// The nonce can still be used with the API key that requested it
+	assertions, err := generateSerialRequestAssertionWithNonce("alder", "A123456L", "", otherNonce)
+	c.Assert(err, check.IsNil)
+	w := sendRequest("POST", "/v1/serial", bytes.NewReader(assertions), "OtherAPIKey", c)
+	c.Assert(w.Code, check.Equals, 200)
+
+	datastore.Environ.Nonces = &datastore.MockNonceStore{}
+}
+
 func generatePrivateKey() (asserts.PrivateKey, error) {
 	signingKey, err := ioutil.ReadFile("../../keystore/TestDeviceKey.asc")
 	if err != nil {
@@ -171,12 +270,20 @@ func generatePrivateKey() (asserts.PrivateKey, error) {
 }
 
 func generateSerialRequestAssertion(model, serial, body string) ([]byte, error) {
+	return generateSerialRequestAssertionWithNonce(model, serial, body, "REQID")
+}
+
+func generateSerialRequestAssertionWithNonce(model, serial, body, nonce string) ([]byte, error) {
 	privateKey, _ := generatePrivateKey()
+	return generateSerialRequestAssertionWithKey(model, serial, body, nonce, privateKey)
+}
+
+func generateSerialRequestAssertionWithKey(model, serial, body, nonce string, privateKey asserts.PrivateKey) ([]byte, error) {
 	encodedPubKey, _ := asserts.EncodePublicKey(privateKey.PublicKey())
 	headers := map[string]interface{}{
 		"brand-id":   "system",
 		"device-key": string(encodedPubKey),
-		"request-id": "REQID",
+		"request-id": nonce,
 		"model":      model,
 	}
 
@@ -247,7 +354,79 @@ func serialRequestPlusModelPlusWrongModel(c *check.C) ([]byte, error) {
 	return assertions, nil
 }
 
-const modelAssertion = `type: model
+// brandAccounts holds the account and account-key assertions of the test brands, which are
+// signed by a test store
+var brandAccounts = newBrandAccounts()
+
+var testBrands = []string{"system", "mybrand", "vendor"}
+
+var modelAssertion = string(asserts.Encode(brandAccounts.Model("system", "alder", map[string]interface{}{
+	"display-name": "Alder",
+	"architecture": "amd64",
+	"gadget":       "alder-gadget",
+	"kernel":       "alder-linux",
+	"store":        "brand-store",
+})))
+
+var newModelAssertion = string(asserts.Encode(brandAccounts.Model("mybrand", "alder-mybrand", map[string]interface{}{
+	"display-name": "Mybrand",
+	"architecture": "amd64",
+	"gadget":       "mybrand-gadget",
+	"kernel":       "mybrand-linux",
+	"store":        "mybrand-store",
+})))
+
+func newBrandAccounts() *assertstest.SigningAccounts {
+	accounts := assertstest.NewSigningAccounts(assertstest.NewStoreStack("canonical", nil))
+	for _, brandID := range testBrands {
+		brandKey, _ := assertstest.GenerateKey(752)
+		accounts.Register(brandID, brandKey, nil)
+	}
+	return accounts
+}
+
+// forgedModelAssertion generates a model assertion that is signed by a key that is not the
+// brand's account-key
+func forgedModelAssertion() string {
+	forgedKey, _ := assertstest.GenerateKey(752)
+	signingDB := assertstest.NewSigningDB("system", forgedKey)
+	model, _ := signingDB.Sign(asserts.ModelType, map[string]interface{}{
+		"series":       "16",
+		"brand-id":     "system",
+		"model":        "alder",
+		"architecture": "amd64",
+		"gadget":       "alder-gadget",
+		"kernel":       "alder-linux",
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}, nil, "")
+	return string(asserts.Encode(model))
+}
+
+// trustedMockDB returns the cached account and account-key assertions of the test brands
+type trustedMockDB struct {
+	datastore.MockDB
+}
+
+func (mdb *trustedMockDB) GetAccount(authorityID string) (datastore.Account, error) {
+	for _, brandID := range testBrands {
+		if brandID == authorityID {
+			return datastore.Account{AuthorityID: brandID, Assertion: string(asserts.Encode(brandAccounts.Account(brandID)))}, nil
+		}
+	}
+	return mdb.MockDB.GetAccount(authorityID)
+}
+
+func (mdb *trustedMockDB) GetKeypairByPublicID(authorityID, keyID string) (datastore.Keypair, error) {
+	for _, brandID := range testBrands {
+		accountKey := brandAccounts.AccountKey(brandID)
+		if brandID == authorityID && accountKey.PublicKeyID() == keyID {
+			return datastore.Keypair{AuthorityID: brandID, KeyID: keyID, Active: true, Assertion: string(asserts.Encode(accountKey))}, nil
+		}
+	}
+	return mdb.MockDB.GetKeypairByPublicID(authorityID, keyID)
+}
+
+const unsignedModelAssertion = `type: model
 authority-id: system
 series: 16
 brand-id: system
@@ -263,23 +442,6 @@ timestamp: 2016-01-02T15:04:05Z
 
 AXNpZw==
 `
-const newModelAssertion = `type: model
-authority-id: mybrand
-series: 16
-brand-id: mybrand
-model: alder-mybrand
-display-name: Mybrand
-architecture: amd64
-gadget: mybrand-gadget
-kernel: mybrand-linux
-store: mybrand-store
-body-length: 0
-sign-key-sha3-384: Jv8_JiHiIzJVcO9M55pPdqSDWUvuhfDIBJUS-3VW7F_idjix7Ffn5qMxB21ZQuij
-timestamp: 2018-05-07T14:38:51Z
-
-AXNpZw==
-`
-
 const badSerialRequest = `type: serial-request
 brand-id: System
 device-key:
@@ -530,7 +692,7 @@ cvxVzSrgJm1PB96l9R3WCYmc5lAn`
 func (s *SignSuite) TestSignHandlerErrorKeyStore(c *check.C) {
 	// Mock the database and the keystore
 	settings := config.Settings{KeyStoreType: "filesystem", KeyStorePath: "../../keystore", JwtSecret: "SomeTestSecretValue"}
-	datastore.Environ = &datastore.Env{DB: &datastore.MockDB{}, Config: settings}
+	datastore.Environ = &datastore.Env{DB: &datastore.MockDB{}, Config: settings, Nonces: &datastore.MockNonceStore{}}
 	datastore.Environ.KeypairDB, _ = datastore.GetErrorMockKeyStore(settings)
 
 	// Generate a test serial-request assertion
@@ -657,6 +819,223 @@ func (s *SignSuite) TestRemodeling(c *check.C) {
 		c.Assert(w.Code, check.Equals, t.Code)
 		c.Assert(w.Header().Get("Content-Type"), check.Equals, t.Type)
 
-		datastore.Environ.DB = &datastore.MockDB{}
+		datastore.Environ.DB = &trustedMockDB{}
+	}
+}
+
+func (s *SignSuite) TestRemodelingRotatedKey(c *check.C) {
+	// The original serial is signed by the retiring key of the model's key rotation
+	serialReq, err := generateSerialRequestAssertion("alder", "A123456R", "")
+	c.Assert(err, check.IsNil)
+	w := sendRequest("POST", "/v1/serial", bytes.NewReader(serialReq), "ValidAPIKey", c)
+	c.Assert(w.Code, check.Equals, 200)
+	serialAssertions := w.Body.String()
+
+	serialReq, err = generateSerialRequestAssertionRemodeling("alder-mybrand", "alder", "A123456R", "")
+	c.Assert(err, check.IsNil)
+	assertions := append(serialReq, []byte("\n"+newModelAssertion)...)
+	assertions = append(assertions, []byte("\n"+serialAssertions)...)
+
+	w = sendRequest("POST", "/v1/serial", bytes.NewReader(assertions), "ValidAPIKey", c)
+	c.Assert(w.Code, check.Equals, 200)
+	c.Assert(w.Header().Get("Content-Type"), check.Equals, asserts.MediaType)
+
+	// The rotation has ended, so the retiring key is no longer accepted
+	datastore.Environ.DB = &rotationEndedMockDB{}
+	w = sendRequest("POST", "/v1/serial", bytes.NewReader(assertions), "ValidAPIKey", c)
+	c.Assert(w.Code, check.Equals, 400)
+	c.Assert(w.Header().Get("Content-Type"), check.Equals, response.JSONHeader)
+	datastore.Environ.DB = &trustedMockDB{}
+}
+
+type rotationEndedMockDB struct {
+	trustedMockDB
+}
+
+func (mdb *rotationEndedMockDB) ListRotationKeypairs(modelID int, keyType string) ([]datastore.Keypair, error) {
+	return []datastore.Keypair{}, nil
+}
+
+func (s *SignSuite) TestSerialAllowlist(c *check.C) {
+	tests := []struct {
+		serial string
+		code   int
+		errmsg string
+	}{
+		{"A123456L", 200, ""},
+		{"UNREGISTERED", 400, response.ErrorUnknownSerial.Code},
+		{"REVOKED", 400, response.ErrorRevokedSerial.Code},
+	}
+
+	for _, t := range tests {
+		assertions, err := generateSerialRequestAssertion("alder", t.serial, "")
+		c.Assert(err, check.IsNil)
+
+		w := sendRequest("POST", "/v1/serial", bytes.NewReader(assertions), "ValidAPIKey", c)
+		c.Assert(w.Code, check.Equals, t.code)
+		if t.code != 200 {
+			result := response.ErrorResponse{}
+			err = json.NewDecoder(w.Body).Decode(&result)
+			c.Assert(err, check.IsNil)
+			c.Assert(result.Code, check.Equals, t.errmsg)
+		}
+	}
+}
+
+func (s *SignSuite) TestDuplicatePolicy(c *check.C) {
+	tests := []struct {
+		model  string
+		serial string
+		code   int
+	}{
+		{"alder", "Aduplicate", 200},
+		{"alder-reject", "A123456L", 200},
+		{"alder-reject", "Aduplicate", 400},
+		{"alder-samekey", "Areflashed", 200},
+		{"alder-samekey", "Aduplicate", 400},
+		{"alder-resigns", "Areflashed", 200},
+		{"alder-resigns", "Aduplicate", 400},
+		{"alder-resigns", "Akeyreused", 400},
+		{"alder", "Akeyreused", 200},
+	}
+
+	for _, t := range tests {
+		assertions, err := generateSerialRequestAssertion(t.model, t.serial, "")
+		c.Assert(err, check.IsNil)
+
+		w := sendRequest("POST", "/v1/serial", bytes.NewReader(assertions), "ValidAPIKey", c)
+		c.Assert(w.Code, check.Equals, t.code)
+		if t.code != 200 {
+			result := response.ErrorResponse{}
+			err = json.NewDecoder(w.Body).Decode(&result)
+			c.Assert(err, check.IsNil)
+			c.Assert(result.Code, check.Equals, response.ErrorDuplicatePolicy.Code)
+		}
+	}
+}
+
+func (s *SignSuite) TestSerialRevoked(c *check.C) {
+	tests := []struct {
+		serial string
+		code   int
+	}{
+		{"A123456L", 200},
+		{"R12345", 400},
+		{"R23456", 400},
+	}
+
+	for _, t := range tests {
+		assertions, err := generateSerialRequestAssertion("alder", t.serial, "")
+		c.Assert(err, check.IsNil)
+
+		w := sendRequest("POST", "/v1/serial", bytes.NewReader(assertions), "ValidAPIKey", c)
+		c.Assert(w.Code, check.Equals, t.code)
+		if t.code != 200 {
+			result := response.ErrorResponse{}
+			err = json.NewDecoder(w.Body).Decode(&result)
+			c.Assert(err, check.IsNil)
+			c.Assert(result.Code, check.Equals, response.ErrorRevokedSerial.Code)
+		}
+	}
+}
+
+func (s *SignSuite) TestSerialQuota(c *check.C) {
+	tests := []struct {
+		model string
+		code  int
+	}{
+		{"alder-quota", 200},
+		{"alder-quota-used", 429},
+	}
+
+	for _, t := range tests {
+		assertions, err := generateSerialRequestAssertion(t.model, "A123456L", "")
+		c.Assert(err, check.IsNil)
+
+		w := sendRequest("POST", "/v1/serial", bytes.NewReader(assertions), "ValidAPIKey", c)
+		c.Assert(w.Code, check.Equals, t.code)
+		if t.code != 200 {
+			result := response.ErrorResponse{}
+			err = json.NewDecoder(w.Body).Decode(&result)
+			c.Assert(err, check.IsNil)
+			c.Assert(result.Code, check.Equals, response.ErrorMonthlyQuota.Code)
+			c.Assert(result.SubCode, check.Equals, response.ErrorMonthlyQuota.SubCode)
+			c.Assert(w.Header().Get("Retry-After"), check.Not(check.Equals), "")
+		}
 	}
 }
+
+func (s *SignSuite) TestRemodelingRevoked(c *check.C) {
+	serialReq, err := generateSerialRequestAssertion("alder", "A123456L", "")
+	c.Assert(err, check.IsNil)
+	w := sendRequest("POST", "/v1/serial", bytes.NewReader(serialReq), "ValidAPIKey", c)
+	c.Assert(w.Code, check.Equals, 200)
+	serialAssertions := w.Body.String()
+
+	serialReq, err = generateSerialRequestAssertionRemodeling("alder-mybrand", "alder", "A123456L", "")
+	c.Assert(err, check.IsNil)
+	assertions := append(serialReq, []byte("\n"+newModelAssertion)...)
+	assertions = append(assertions, []byte("\n"+serialAssertions)...)
+
+	// The serial assertion of the original model has been revoked
+	datastore.Environ.DB = &revokedMockDB{}
+	w = sendRequest("POST", "/v1/serial", bytes.NewReader(assertions), "ValidAPIKey", c)
+	c.Assert(w.Code, check.Equals, 400)
+	result := response.ErrorResponse{}
+	err = json.NewDecoder(w.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Code, check.Equals, response.ErrorRevokedSerial.Code)
+	datastore.Environ.DB = &trustedMockDB{}
+}
+
+type revokedMockDB struct {
+	trustedMockDB
+}
+
+func (mdb *revokedMockDB) CheckSerialRevoked(brandID, modelName, serialNumber string, revision int) (bool, error) {
+	return modelName == "alder" && revision > 0, nil
+}
+
+func (s *SignSuite) TestRevocationList(c *check.C) {
+	// The list is not served without a revocation signing key
+	w := sendRequest("GET", "/v1/revocations?brand-id=system&model=alder", nil, "ValidAPIKey", c)
+	c.Assert(w.Code, check.Equals, 500)
+
+	seed, publicKey, err := crypt.CreateEd25519Key()
+	c.Assert(err, check.IsNil)
+	datastore.Environ.Config.RevocationSigningKey = seed
+
+	w = sendRequest("GET", "/v1/revocations?brand-id=system&model=alder", nil, "ValidAPIKey", c)
+	c.Assert(w.Code, check.Equals, 200)
+	c.Assert(w.Header().Get("Content-Type"), check.Equals, response.JSONHeader)
+
+	// Verify the signature of the list with the public key
+	header := w.Header().Get(sign.RevocationSignatureHeader)
+	c.Assert(strings.HasPrefix(header, "ed25519="), check.Equals, true)
+	public, _ := base64.StdEncoding.DecodeString(publicKey)
+	signature, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, "ed25519="))
+	c.Assert(ed25519.Verify(public, w.Body.Bytes(), signature), check.Equals, true)
+
+	result := sign.RevocationListResponse{}
+	err = json.NewDecoder(w.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.BrandID, check.Equals, "system")
+	c.Assert(result.Model, check.Equals, "alder")
+	c.Assert(len(result.Revocations), check.Equals, 2)
+
+	w = sendRequest("GET", "/v1/revocations?brand-id=system&model=invalid", nil, "ValidAPIKey", c)
+	c.Assert(w.Code, check.Equals, 400)
+
+	w = sendRequest("GET", "/v1/revocations?brand-id=system&model=alder", nil, "InvalidAPIKey", c)
+	c.Assert(w.Code, check.Equals, 400)
+
+	datastore.Environ.Config.RevocationSigningKey = "invalid"
+	w = sendRequest("GET", "/v1/revocations?brand-id=system&model=alder", nil, "ValidAPIKey", c)
+	c.Assert(w.Code, check.Equals, 500)
+
+	datastore.Environ.Config.RevocationSigningKey = seed
+	datastore.Environ.DB = &datastore.ErrorMockDB{}
+	w = sendRequest("GET", "/v1/revocations?brand-id=system&model=alder", nil, "ValidAPIKey", c)
+	c.Assert(w.Code, check.Equals, 400)
+	datastore.Environ.DB = &trustedMockDB{}
+}
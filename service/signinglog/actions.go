@@ -21,6 +21,7 @@ package signinglog
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 
 	"github.com/CanonicalLtd/serial-vault/service/log"
@@ -38,6 +39,7 @@ type ListResponse struct {
 	ErrorMessage string                 `json:"message"`
 	SigningLog   []datastore.SigningLog `json:"logs"`
 	Total        int                    `json:"total_count"`
+	Next         string                 `json:"next,omitempty"`
 }
 
 // FiltersResponse is the JSON response from the API Signing Log Filters method
@@ -67,7 +69,7 @@ func listHandler(w http.ResponseWriter, user datastore.User, apiCall bool) {
 
 	// Return successful JSON response with the list of models
 	w.WriteHeader(http.StatusOK)
-	formatListResponse(true, "", "", "", logs, w)
+	formatListResponse(true, "", "", "", logs, "", w)
 }
 
 // listForAccountHandler is the API method to fetch the log records from signing for an account
@@ -86,9 +88,15 @@ func listForAccountHandler(w http.ResponseWriter, user datastore.User, apiCall b
 		return
 	}
 
+	// A full page has the cursor for the next page
+	var next string
+	if params.Limit > 0 && uint64(len(logs)) >= params.Limit {
+		next = datastore.NewSigningLogCursor(logs[len(logs)-1]).Encode()
+	}
+
 	// Return successful JSON response with the list of models
 	w.WriteHeader(http.StatusOK)
-	formatListResponse(true, "", "", "", logs, w)
+	formatListResponse(true, "", "", "", logs, next, w)
 }
 
 // listFiltersHandler is the API method to fetch the log filter values
@@ -112,8 +120,45 @@ func listFiltersHandler(w http.ResponseWriter, user datastore.User, apiCall bool
 	formatFiltersResponse(true, "", "", "", filters, w)
 }
 
-func formatListResponse(success bool, errorCode, errorSubcode, message string, logs []datastore.SigningLog, w http.ResponseWriter) error {
-	response := ListResponse{Success: success, ErrorCode: errorCode, ErrorSubcode: errorSubcode, ErrorMessage: message, SigningLog: logs}
+// exportHandler is the API method to stream the log records from signing for an account, as CSV
+// or JSON Lines. An error after the export has started cannot be reported in the response, so it
+// is logged and the export is cut short
+func exportHandler(w http.ResponseWriter, user datastore.User, apiCall bool, authorityID, format string, params datastore.SigningLogExportParams) {
+	err := auth.CheckUserPermissions(user, datastore.Admin, apiCall)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	out := &exportResponse{
+		w:           w,
+		contentType: exportContentTypes[format],
+		filename:    fmt.Sprintf("signinglog-%s.%s", authorityID, format),
+	}
+	export, err := NewExportWriter(out, format)
+	if err == nil {
+		err = datastore.Environ.DB.ExportAllowedSigningLog(user, authorityID, params, export.Write)
+	}
+	if err == nil {
+		err = export.Flush()
+	}
+	if err != nil {
+		if out.started {
+			log.Printf("Error exporting the signing log of %s: %v\n", authorityID, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		response.FormatStandardResponse(false, "error-fetch-signinglog", "", err.Error(), w)
+		return
+	}
+
+	// An empty JSON Lines export has not written anything yet
+	out.start()
+}
+
+func formatListResponse(success bool, errorCode, errorSubcode, message string, logs []datastore.SigningLog, next string, w http.ResponseWriter) error {
+	response := ListResponse{Success: success, ErrorCode: errorCode, ErrorSubcode: errorSubcode, ErrorMessage: message, SigningLog: logs, Next: next}
 
 	if len(logs) > 0 {
 		response.Total = logs[0].Total
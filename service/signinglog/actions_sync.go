@@ -26,6 +26,7 @@ import (
 	"github.com/CanonicalLtd/serial-vault/datastore"
 	"github.com/CanonicalLtd/serial-vault/service/auth"
 	"github.com/CanonicalLtd/serial-vault/service/response"
+	"github.com/CanonicalLtd/serial-vault/webhook"
 )
 
 func syncLogHandler(w http.ResponseWriter, user datastore.User, apiCall bool, signLog datastore.SigningLog) {
@@ -51,6 +52,15 @@ func syncLogHandler(w http.ResponseWriter, user datastore.User, apiCall bool, si
 			response.FormatStandardResponse(false, "error-signinglog-create", "", err.Error(), w)
 			return
 		}
+
+		webhook.Notify(signLog.Make, datastore.EventSyncReceived, map[string]interface{}{
+			"brand-id":    signLog.Make,
+			"model":       signLog.Model,
+			"serial":      signLog.SerialNumber,
+			"fingerprint": signLog.Fingerprint,
+			"revision":    signLog.Revision,
+			"created":     signLog.Created,
+		})
 	}
 
 	// Return successful JSON response
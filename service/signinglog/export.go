@@ -0,0 +1,208 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package signinglog
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+)
+
+// Formats of the signing log export
+const (
+	ExportCSV   = "csv"
+	ExportJSONL = "jsonl"
+)
+
+var exportContentTypes = map[string]string{
+	ExportCSV:   "text/csv; charset=UTF-8",
+	ExportJSONL: "application/x-ndjson",
+}
+
+var exportCSVHeader = []string{"id", "make", "model", "serialnumber", "fingerprint", "created", "revision", "synced"}
+
+// exportRecord is a signing log in a JSON Lines export
+type exportRecord struct {
+	ID           int       `json:"id"`
+	Make         string    `json:"make"`
+	Model        string    `json:"model"`
+	SerialNumber string    `json:"serialnumber"`
+	Fingerprint  string    `json:"fingerprint"`
+	Created      time.Time `json:"created"`
+	Revision     int       `json:"revision"`
+	Synced       int       `json:"synced"`
+}
+
+// ExportWriter writes the signing logs of an export, one at a time. Nothing is written to the
+// output until the first signing log, or the flush of an empty export
+type ExportWriter interface {
+	Write(signingLog datastore.SigningLog) error
+	Flush() error
+}
+
+// NewExportWriter creates the writer of an export in the format
+func NewExportWriter(w io.Writer, format string) (ExportWriter, error) {
+	switch format {
+	case ExportCSV:
+		return &csvExport{w: csv.NewWriter(w)}, nil
+	case ExportJSONL:
+		return &jsonlExport{e: json.NewEncoder(w)}, nil
+	default:
+		return nil, fmt.Errorf("the export format must be '%s' or '%s'", ExportCSV, ExportJSONL)
+	}
+}
+
+type csvExport struct {
+	w       *csv.Writer
+	started bool
+}
+
+func (e *csvExport) Write(signingLog datastore.SigningLog) error {
+	if err := e.start(); err != nil {
+		return err
+	}
+	return e.w.Write([]string{
+		strconv.Itoa(signingLog.ID),
+		signingLog.Make,
+		signingLog.Model,
+		signingLog.SerialNumber,
+		signingLog.Fingerprint,
+		signingLog.Created.UTC().Format(time.RFC3339),
+		strconv.Itoa(signingLog.Revision),
+		strconv.Itoa(signingLog.Synced),
+	})
+}
+
+func (e *csvExport) Flush() error {
+	if err := e.start(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvExport) start() error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+	return e.w.Write(exportCSVHeader)
+}
+
+type jsonlExport struct {
+	e *json.Encoder
+}
+
+func (e *jsonlExport) Write(signingLog datastore.SigningLog) error {
+	return e.e.Encode(exportRecord{
+		ID:           signingLog.ID,
+		Make:         signingLog.Make,
+		Model:        signingLog.Model,
+		SerialNumber: signingLog.SerialNumber,
+		Fingerprint:  signingLog.Fingerprint,
+		Created:      signingLog.Created.UTC(),
+		Revision:     signingLog.Revision,
+		Synced:       signingLog.Synced,
+	})
+}
+
+func (e *jsonlExport) Flush() error {
+	return nil
+}
+
+// exportResponse sets the headers of the export response when the first data is written, so an
+// error before then can still be returned as a JSON response
+type exportResponse struct {
+	w           http.ResponseWriter
+	contentType string
+	filename    string
+	started     bool
+}
+
+func (r *exportResponse) Write(p []byte) (int, error) {
+	r.start()
+	return r.w.Write(p)
+}
+
+func (r *exportResponse) start() {
+	if r.started {
+		return
+	}
+	r.started = true
+	r.w.Header().Set("Content-Type", r.contentType)
+	r.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", r.filename))
+	r.w.WriteHeader(http.StatusOK)
+}
+
+// ParseTimeFilter parses the time of a signing log filter, either a date (2006-01-02) or an RFC3339 time
+func ParseTimeFilter(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, fmt.Errorf("the time '%s' must be a date (YYYY-MM-DD) or an RFC3339 time", value)
+	}
+	return t, nil
+}
+
+// GetSigningLogExportParams returns the format and filters of an export from the query parameters.
+// The 'filter' is a comma-separated list of models and the 'serialnumber' is a pattern, where '*'
+// matches any characters
+func GetSigningLogExportParams(r *http.Request) (string, datastore.SigningLogExportParams, error) {
+	query := r.URL.Query()
+	params := datastore.SigningLogExportParams{
+		Serialnumber: query.Get("serialnumber"),
+	}
+
+	format := query.Get("format")
+	if len(format) == 0 {
+		format = ExportCSV
+	}
+	if _, ok := exportContentTypes[format]; !ok {
+		return format, params, fmt.Errorf("the export format must be '%s' or '%s'", ExportCSV, ExportJSONL)
+	}
+
+	if filter := query.Get("filter"); filter != "" {
+		params.Models = strings.Split(filter, ",")
+	}
+
+	for _, p := range []struct {
+		name  string
+		value **time.Time
+	}{{"from", &params.From}, {"to", &params.To}} {
+		if v := query.Get(p.name); len(v) > 0 {
+			t, err := ParseTimeFilter(v)
+			if err != nil {
+				return format, params, err
+			}
+			*p.value = &t
+		}
+	}
+
+	return format, params, nil
+}
@@ -0,0 +1,145 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package signinglog_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/signinglog"
+	check "gopkg.in/check.v1"
+)
+
+func (s *SigningLogSuite) TestExportHandler(c *check.C) {
+	tests := []struct {
+		URL         string
+		API         bool
+		Code        int
+		Type        string
+		Permissions int
+		EnableAuth  bool
+		Lines       int
+	}{
+		{"/v1/signinglog/account/system/export", false, 200, "text/csv; charset=UTF-8", 0, false, 11},
+		{"/v1/signinglog/account/system/export?format=jsonl", false, 200, "application/x-ndjson", 0, false, 10},
+		{"/v1/signinglog/account/system/export?format=csv&filter=alder&serialnumber=A*&from=2020-01-01", false, 200, "text/csv; charset=UTF-8", datastore.Admin, true, 5},
+		{"/v1/signinglog/account/system/export", false, 400, "application/json; charset=UTF-8", datastore.Standard, true, 0},
+		{"/v1/signinglog/account/system/export", false, 400, "application/json; charset=UTF-8", 0, true, 0},
+		{"/v1/signinglog/account/system/export?format=xml", false, 400, "application/json; charset=UTF-8", 0, false, 0},
+		{"/v1/signinglog/account/system/export?to=tomorrow", false, 400, "application/json; charset=UTF-8", 0, false, 0},
+		{"/api/signinglog/account/system/export?format=jsonl", true, 200, "application/x-ndjson", datastore.Admin, true, 4},
+		{"/api/signinglog/account/system/export", true, 400, "application/json; charset=UTF-8", datastore.Standard, true, 0},
+		{"/api/signinglog/account/system/export", true, 400, "application/json; charset=UTF-8", 0, true, 0},
+		{"/api/signinglog/account/system/export?format=xml", true, 400, "application/json; charset=UTF-8", datastore.Admin, true, 0},
+	}
+
+	for _, t := range tests {
+		if t.EnableAuth {
+			datastore.Environ.Config.EnableUserAuth = true
+		}
+
+		var w *httptest.ResponseRecorder
+		if t.API {
+			w = sendAdminAPIRequest("GET", t.URL, nil, t.Permissions, c)
+		} else {
+			w = sendAdminRequest("GET", t.URL, nil, t.Permissions, c)
+		}
+		c.Assert(w.Code, check.Equals, t.Code, check.Commentf(t.URL))
+		c.Assert(w.Header().Get("Content-Type"), check.Equals, t.Type)
+
+		if t.Code == http.StatusOK {
+			c.Assert(w.Header().Get("Content-Disposition"), check.Matches, `attachment; filename="signinglog-system\.(csv|jsonl)"`)
+			c.Assert(strings.Split(strings.TrimSpace(w.Body.String()), "\n"), check.HasLen, t.Lines)
+		} else {
+			result, err := parseListResponse(w)
+			c.Assert(err, check.IsNil)
+			c.Assert(result.Success, check.Equals, false)
+		}
+
+		datastore.Environ.Config.EnableUserAuth = false
+	}
+}
+
+func (s *SigningLogSuite) TestExportHandlerError(c *check.C) {
+	datastore.Environ.DB = &datastore.ErrorMockDB{}
+
+	w := sendAdminRequest("GET", "/v1/signinglog/account/system/export", nil, 0, c)
+	c.Assert(w.Code, check.Equals, 400)
+	result, err := parseListResponse(w)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Success, check.Equals, false)
+	c.Assert(result.ErrorCode, check.Equals, "error-fetch-signinglog")
+}
+
+func (s *SigningLogSuite) TestExportWriter(c *check.C) {
+	log1 := datastore.SigningLog{ID: 1, Make: "system", Model: "alder", SerialNumber: "A,1", Fingerprint: "aaaabbbb", Revision: 2}
+
+	w := bytes.NewBufferString("")
+	export, err := signinglog.NewExportWriter(w, signinglog.ExportCSV)
+	c.Assert(err, check.IsNil)
+	c.Assert(w.Len(), check.Equals, 0)
+	c.Assert(export.Write(log1), check.IsNil)
+	c.Assert(export.Flush(), check.IsNil)
+	c.Assert(w.String(), check.Equals, "id,make,model,serialnumber,fingerprint,created,revision,synced\n1,system,alder,\"A,1\",aaaabbbb,0001-01-01T00:00:00Z,2,0\n")
+
+	w = bytes.NewBufferString("")
+	export, err = signinglog.NewExportWriter(w, signinglog.ExportJSONL)
+	c.Assert(err, check.IsNil)
+	c.Assert(export.Write(log1), check.IsNil)
+	c.Assert(export.Flush(), check.IsNil)
+	c.Assert(w.String(), check.Equals, `{"id":1,"make":"system","model":"alder","serialnumber":"A,1","fingerprint":"aaaabbbb","created":"0001-01-01T00:00:00Z","revision":2,"synced":0}`+"\n")
+
+	_, err = signinglog.NewExportWriter(w, "xml")
+	c.Assert(err, check.ErrorMatches, "the export format must be 'csv' or 'jsonl'")
+}
+
+func (s *SigningLogSuite) TestGetSigningLogExportParams(c *check.C) {
+	from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2020, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		url        string
+		wantFormat string
+		want       datastore.SigningLogExportParams
+		wantErr    string
+	}{
+		{`/ping`, "csv", datastore.SigningLogExportParams{}, ""},
+		{`/ping?format=jsonl&filter=foo,bar&serialnumber=R12*`, "jsonl", datastore.SigningLogExportParams{Models: []string{"foo", "bar"}, Serialnumber: "R12*"}, ""},
+		{`/ping?from=2020-01-01&to=2020-02-01T12:00:00Z`, "csv", datastore.SigningLogExportParams{From: &from, To: &to}, ""},
+		{`/ping?format=xml`, "xml", datastore.SigningLogExportParams{}, "the export format must be 'csv' or 'jsonl'"},
+		{`/ping?from=01/01/2020`, "csv", datastore.SigningLogExportParams{}, "the time '01/01/2020' must be .*"},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest("GET", tt.url, nil)
+
+		format, params, err := signinglog.GetSigningLogExportParams(r)
+		if len(tt.wantErr) > 0 {
+			c.Assert(err, check.ErrorMatches, tt.wantErr)
+			continue
+		}
+		c.Assert(err, check.IsNil)
+		c.Assert(format, check.Equals, tt.wantFormat)
+		c.Assert(params, check.DeepEquals, tt.want)
+	}
+}
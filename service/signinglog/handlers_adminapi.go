@@ -25,10 +25,12 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/CanonicalLtd/serial-vault/datastore"
 	"github.com/CanonicalLtd/serial-vault/service/request"
 	"github.com/CanonicalLtd/serial-vault/service/response"
+	"github.com/gorilla/mux"
 )
 
 // APIList is the API method to fetch the log records from signing
@@ -46,6 +48,51 @@ func APIList(w http.ResponseWriter, r *http.Request) {
 	listHandler(w, user, true)
 }
 
+// APIListForAccount is the API method to fetch the log records from signing for an account
+func APIListForAccount(w http.ResponseWriter, r *http.Request) {
+	// Validate the user and API key
+	user, err := request.CheckUserAPI(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	params, err := GetSigningLogParams(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-signinglog-params", "", err.Error(), w)
+		return
+	}
+
+	// Call the API with the user
+	listForAccountHandler(w, user, true, vars["authorityID"], params)
+}
+
+// APIExport is the API method to stream the log records from signing for an account, as CSV or
+// JSON Lines
+func APIExport(w http.ResponseWriter, r *http.Request) {
+	// Validate the user and API key
+	user, err := request.CheckUserAPI(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	format, params, err := GetSigningLogExportParams(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		response.FormatStandardResponse(false, "error-signinglog-export", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+
+	// Call the API with the user
+	exportHandler(w, user, true, vars["authorityID"], format, params)
+}
+
 // APISyncLog is the API method to sync a factory log to the cloud
 func APISyncLog(w http.ResponseWriter, r *http.Request) {
 	// Validate the user and API key
@@ -72,8 +119,11 @@ func APISyncLog(w http.ResponseWriter, r *http.Request) {
 	syncLogHandler(w, user, true, request)
 }
 
-// GetSigningLogParams parse and set defaults for the search parameters from the request
-func GetSigningLogParams(r *http.Request) *datastore.SigningLogParams {
+// GetSigningLogParams parse and set defaults for the search parameters from the request. The
+// 'from' and 'to' times are dates (2006-01-02) or RFC3339 times, and 'after' is the cursor of the
+// last signing log of the previous page, which are refused when they are not valid. Other values
+// that are not valid are ignored
+func GetSigningLogParams(r *http.Request) (*datastore.SigningLogParams, error) {
 	params := &datastore.SigningLogParams{
 		Limit: datastore.ListSigningLogDefaultLimit,
 	}
@@ -83,6 +133,10 @@ func GetSigningLogParams(r *http.Request) *datastore.SigningLogParams {
 		params.Offset = offset
 	}
 
+	if limit, err := strconv.ParseUint(query.Get("limit"), 10, 64); err == nil && limit > 0 {
+		params.Limit = limit
+	}
+
 	if fetchAll := query.Get("all"); fetchAll == "true" {
 		params.Limit = 0 // Means no limit.
 		params.Offset = 0
@@ -93,6 +147,44 @@ func GetSigningLogParams(r *http.Request) *datastore.SigningLogParams {
 	}
 
 	params.Serialnumber = query.Get("serialnumber")
+	params.Fingerprint = query.Get("fingerprint")
+
+	for _, p := range []struct {
+		name  string
+		value **time.Time
+	}{{"from", &params.CreatedFrom}, {"to", &params.CreatedTo}} {
+		if v := query.Get(p.name); len(v) > 0 {
+			t, err := ParseTimeFilter(v)
+			if err != nil {
+				return params, err
+			}
+			*p.value = &t
+		}
+	}
+
+	if revision, err := strconv.Atoi(query.Get("revision")); err == nil && revision > 0 {
+		params.Revision = revision
+	}
+
+	if synced, err := strconv.ParseBool(query.Get("synced")); err == nil {
+		params.Synced = &synced
+	}
+
+	switch sort := query.Get("sort"); sort {
+	case datastore.SigningLogSortID, datastore.SigningLogSortCreated, datastore.SigningLogSortSerialNumber:
+		params.Sort = sort
+	}
+	params.Ascending = query.Get("order") == "asc"
+
+	if after := query.Get("after"); len(after) > 0 {
+		cursor, err := datastore.DecodeSigningLogCursor(after)
+		if err != nil {
+			return params, err
+		}
+		// Keyset pagination replaces the offset
+		params.After = &cursor
+		params.Offset = 0
+	}
 
-	return params
+	return params, nil
 }
@@ -67,6 +67,47 @@ func (s *SigningLogSuite) TestAPISigningLogHandler(c *check.C) {
 	}
 }
 
+func (s *SigningLogSuite) TestAPISigningLogTokenScope(c *check.C) {
+	log1 := datastore.SigningLog{ID: 1, Make: "system", Model: "alder", SerialNumber: "abcd1234", Fingerprint: "aaaabbbbccccdddd", Revision: 1, Created: time.Now()}
+	l1, _ := json.Marshal(log1)
+
+	tests := []struct {
+		Method  string
+		URL     string
+		Data    []byte
+		Token   string
+		Code    int
+		Success bool
+	}{
+		{"GET", "/api/signinglog", nil, "TokenSigningLogRead", 200, true},
+		{"GET", "/api/signinglog/account/system", nil, "TokenSigningLogRead", 200, true},
+		{"POST", "/api/signinglog", l1, "TokenSigningLogRead", 400, false},
+		{"GET", "/api/signinglog", nil, "TokenSigningLogAccount", 400, false},
+		{"GET", "/api/signinglog/account/system", nil, "TokenSigningLogAccount", 200, true},
+		{"GET", "/api/signinglog/account/other", nil, "TokenSigningLogAccount", 400, false},
+		{"GET", "/api/signinglog", nil, "TokenSync", 400, false},
+		{"POST", "/api/signinglog", l1, "TokenSync", 200, true},
+		{"GET", "/api/signinglog", nil, "TokenUnknown", 400, false},
+	}
+
+	for _, t := range tests {
+		datastore.Environ.Config.EnableUserAuth = true
+
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(t.Method, t.URL, bytes.NewReader(t.Data))
+		r.Header.Set("user", "sv")
+		r.Header.Set("api-key", t.Token)
+		service.AdminRouter().ServeHTTP(w, r)
+
+		c.Assert(w.Code, check.Equals, t.Code)
+		result, err := parseListResponse(w)
+		c.Assert(err, check.IsNil)
+		c.Assert(result.Success, check.Equals, t.Success)
+
+		datastore.Environ.Config.EnableUserAuth = false
+	}
+}
+
 func sendAdminAPIRequest(method, url string, data io.Reader, permissions int, c *check.C) *httptest.ResponseRecorder {
 	w := httptest.NewRecorder()
 	r, _ := http.NewRequest(method, url, data)
@@ -88,10 +129,16 @@ func sendAdminAPIRequest(method, url string, data io.Reader, permissions int, c
 }
 
 func (s *SigningLogSuite) TestGetSigningLogParams(c *check.C) {
+	from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC)
+	synced := false
+	cursor := datastore.SigningLogCursor{ID: 120, Created: from, SerialNumber: "R100"}
+
 	tests := []struct {
-		name string
-		url  string
-		want *datastore.SigningLogParams
+		name    string
+		url     string
+		want    *datastore.SigningLogParams
+		wantErr string
 	}{
 		{
 			name: "case 1",
@@ -132,11 +179,61 @@ func (s *SigningLogSuite) TestGetSigningLogParams(c *check.C) {
 				Limit: 0,
 			},
 		},
+		{
+			name: "case 6",
+			url:  `/ping?limit=20&from=2020-01-01&to=2020-01-02T12:00:00Z&fingerprint=aaaabbbb&revision=2&synced=false&sort=created&order=asc`,
+			want: &datastore.SigningLogParams{
+				Limit:       20,
+				CreatedFrom: &from,
+				CreatedTo:   &to,
+				Fingerprint: "aaaabbbb",
+				Revision:    2,
+				Synced:      &synced,
+				Sort:        datastore.SigningLogSortCreated,
+				Ascending:   true,
+			},
+		},
+		{
+			name: "case 7",
+			url:  `/ping?offset=100&after=` + cursor.Encode() + `&sort=fingerprint&order=up&revision=-1&synced=maybe`,
+			want: &datastore.SigningLogParams{
+				Limit: datastore.ListSigningLogDefaultLimit,
+				After: &cursor,
+			},
+		},
+		{
+			name: "case 8",
+			url:  `/ping?limit=0`,
+			want: &datastore.SigningLogParams{
+				Limit: datastore.ListSigningLogDefaultLimit,
+			},
+		},
+		{
+			name:    "case 9",
+			url:     `/ping?after=invalid`,
+			wantErr: "the cursor is invalid",
+		},
+		{
+			name:    "case 10",
+			url:     `/ping?from=yesterday`,
+			wantErr: "the time 'yesterday' must be a date .*",
+		},
+		{
+			name:    "case 11",
+			url:     `/ping?to=2020-13-01`,
+			wantErr: "the time '2020-13-01' must be a date .*",
+		},
 	}
 	for _, tt := range tests {
 		r, _ := http.NewRequest("GET", tt.url, nil)
 
-		if got := signinglog.GetSigningLogParams(r); !reflect.DeepEqual(got, tt.want) {
+		got, err := signinglog.GetSigningLogParams(r)
+		if len(tt.wantErr) > 0 {
+			c.Assert(err, check.ErrorMatches, tt.wantErr, check.Commentf(tt.name))
+			continue
+		}
+		c.Assert(err, check.IsNil, check.Commentf(tt.name))
+		if !reflect.DeepEqual(got, tt.want) {
 			c.Errorf("getSigningLogParams() = %#v, want %#v", got, tt.want)
 		}
 	}
@@ -47,7 +47,11 @@ func ListForAccount(w http.ResponseWriter, r *http.Request) {
 	}
 
 	vars := mux.Vars(r)
-	params := GetSigningLogParams(r)
+	params, err := GetSigningLogParams(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-signinglog-params", "", err.Error(), w)
+		return
+	}
 
 	listForAccountHandler(w, authUser, false, vars["authorityID"], params)
 }
@@ -64,3 +68,24 @@ func ListFilters(w http.ResponseWriter, r *http.Request) {
 
 	listFiltersHandler(w, authUser, false, vars["authorityID"])
 }
+
+// Export is the API method to stream the log records from signing for an account, as CSV or
+// JSON Lines
+func Export(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	format, params, err := GetSigningLogExportParams(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		response.FormatStandardResponse(false, "error-signinglog-export", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+
+	exportHandler(w, authUser, false, vars["authorityID"], format, params)
+}
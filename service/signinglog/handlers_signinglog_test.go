@@ -122,6 +122,39 @@ func (s *SigningLogSuite) TestSigningLogErrorHandler(c *check.C) {
 	}
 }
 
+func (s *SigningLogSuite) TestSigningLogNextPage(c *check.C) {
+	w := sendAdminRequest("GET", "/v1/signinglog/account/system?limit=5", nil, 0, c)
+	c.Assert(w.Code, check.Equals, 200)
+	result, err := parseListResponse(w)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Success, check.Equals, true)
+
+	cursor, err := datastore.DecodeSigningLogCursor(result.Next)
+	c.Assert(err, check.IsNil)
+	c.Assert(cursor.ID, check.Equals, result.SigningLog[len(result.SigningLog)-1].ID)
+
+	w = sendAdminRequest("GET", "/v1/signinglog/account/system?limit=20", nil, 0, c)
+	result, err = parseListResponse(w)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Next, check.Equals, "")
+}
+
+func (s *SigningLogSuite) TestSigningLogInvalidParams(c *check.C) {
+	for _, url := range []string{
+		"/v1/signinglog/account/system?from=yesterday",
+		"/v1/signinglog/account/system?to=2020-02-30",
+		"/v1/signinglog/account/system?after=invalid",
+	} {
+		w := sendAdminRequest("GET", url, nil, 0, c)
+		c.Assert(w.Code, check.Equals, 400)
+
+		result, err := parseListResponse(w)
+		c.Assert(err, check.IsNil)
+		c.Assert(result.Success, check.Equals, false)
+		c.Assert(result.ErrorCode, check.Equals, "error-signinglog-params")
+	}
+}
+
 func (s *SigningLogSuite) TestListFilters(c *check.C) {
 	tests := []SigningLogTest{
 		{"GET", "/v1/signinglog/account/system/filters", nil, 200, "application/json; charset=UTF-8", 0, false, true, 0},
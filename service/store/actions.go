@@ -23,6 +23,7 @@ import (
 	"net/http"
 
 	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/audit"
 	"github.com/CanonicalLtd/serial-vault/service/auth"
 	"github.com/CanonicalLtd/serial-vault/service/log"
 	"github.com/CanonicalLtd/serial-vault/service/response"
@@ -51,6 +52,17 @@ func keyRegisterHandler(w http.ResponseWriter, user datastore.User, apiCall bool
 		return
 	}
 
+	// Record the registration without the store credentials. The store cannot undo the registration,
+	// so it is recorded before it is made
+	err = audit.Record(datastore.Environ.DB, user, "store:key-register", "keypair/"+keyAuth.AuthorityID+"/"+keyAuth.KeyName, nil, map[string]string{
+		"authority-id": keyAuth.AuthorityID,
+		"key-name":     keyAuth.KeyName,
+	})
+	if err != nil {
+		response.FormatStandardResponse(false, response.ErrorStoreKeypair.Code, "", err.Error(), w)
+		return
+	}
+
 	// Register the account key with the store
 	err = store.RegisterKey(keyAuth, keypair)
 	if err != nil {
@@ -27,6 +27,7 @@ import (
 	"github.com/CanonicalLtd/serial-vault/service/log"
 
 	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/audit"
 	"github.com/CanonicalLtd/serial-vault/service/auth"
 	"github.com/CanonicalLtd/serial-vault/service/response"
 )
@@ -86,7 +87,12 @@ func updateHandler(w http.ResponseWriter, user datastore.User, apiCall bool, sto
 		return
 	}
 
-	err = datastore.Environ.DB.UpdateAllowedSubstore(store, user)
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		if err := db.UpdateAllowedSubstore(store, user); err != nil {
+			return err
+		}
+		return audit.Record(db, user, "substore:update", fmt.Sprintf("substore/%d", store.ID), nil, store)
+	})
 	if err != nil {
 		log.Println(err)
 		response.FormatStandardResponse(false, "error-stores-substore", "", err.Error(), w)
@@ -107,7 +113,15 @@ func createHandler(w http.ResponseWriter, user datastore.User, apiCall bool, sto
 		return
 	}
 
-	allowedSubstore, err := datastore.Environ.DB.CreateAllowedSubstore(store, user)
+	var allowedSubstore datastore.Substore
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		var err error
+		allowedSubstore, err = db.CreateAllowedSubstore(store, user)
+		if err != nil {
+			return err
+		}
+		return audit.Record(db, user, "substore:create", fmt.Sprintf("substore/%d", allowedSubstore.ID), nil, allowedSubstore)
+	})
 	if err != nil {
 		log.Println(err)
 		response.FormatStandardResponse(false, "error-stores-json", "", err.Error(), w)
@@ -150,7 +164,15 @@ func deleteHandler(w http.ResponseWriter, user datastore.User, apiCall bool, sto
 		return
 	}
 
-	errorSubcode, err := datastore.Environ.DB.DeleteAllowedSubstore(storeID, user)
+	var errorSubcode string
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		var err error
+		errorSubcode, err = db.DeleteAllowedSubstore(storeID, user)
+		if err != nil {
+			return err
+		}
+		return audit.Record(db, user, "substore:delete", fmt.Sprintf("substore/%d", storeID), nil, nil)
+	})
 	if err != nil {
 		log.Println(err)
 		response.FormatStandardResponse(false, "error-deleting-store", errorSubcode, err.Error(), w)
@@ -21,9 +21,11 @@ package user
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 
 	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/audit"
 	"github.com/CanonicalLtd/serial-vault/service/auth"
 	"github.com/CanonicalLtd/serial-vault/service/log"
 	"github.com/CanonicalLtd/serial-vault/service/response"
@@ -107,7 +109,22 @@ func createHandler(w http.ResponseWriter, authUser datastore.User, apiCall bool,
 		return
 	}
 
-	user.ID, err = datastore.Environ.DB.CreateUser(user)
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		var err error
+		user.ID, err = db.CreateUser(user)
+		if err != nil {
+			return err
+		}
+
+		// Only the hash of the API key is stored, so a generated key is returned now
+		if len(user.APIKey) == 0 {
+			user.APIKey, err = db.ResetUserAPIKey(user.ID)
+			if err != nil {
+				return err
+			}
+		}
+		return audit.Record(db, authUser, "user:create", fmt.Sprintf("user/%d", user.ID), nil, user)
+	})
 	if err != nil {
 		log.Error("error-creating-user", err)
 		response.FormatStandardResponse(false, "error-creating-user", "", err.Error(), w)
@@ -116,7 +133,42 @@ func createHandler(w http.ResponseWriter, authUser datastore.User, apiCall bool,
 
 	// Return successful JSON response
 	w.WriteHeader(http.StatusOK)
-	response.FormatStandardResponse(true, "", "", "", w)
+	formatUserResponse(user, w)
+}
+
+// apiKeyResetHandler is the API method to generate a new API key for a user. The response holds
+// the new API key, which cannot be retrieved later
+func apiKeyResetHandler(w http.ResponseWriter, authUser datastore.User, apiCall bool, userID int) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(authUser, datastore.Superuser, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	user, err := datastore.Environ.DB.GetUser(userID)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-get-user", "", err.Error(), w)
+		return
+	}
+
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		var err error
+		user.APIKey, err = db.ResetUserAPIKey(userID)
+		if err != nil {
+			return err
+		}
+		return audit.Record(db, authUser, "user:apikey-reset", fmt.Sprintf("user/%d", userID), nil, map[string]string{"api-key": user.APIKey})
+	})
+	if err != nil {
+		log.Error("error-reset-apikey", err)
+		response.FormatStandardResponse(false, "error-reset-apikey", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	formatUserResponse(user, w)
 }
 
 func formatListResponse(users []datastore.User, w http.ResponseWriter) error {
@@ -150,7 +202,14 @@ func updateHandler(w http.ResponseWriter, authUser datastore.User, apiCall bool,
 		return
 	}
 
-	err = datastore.Environ.DB.UpdateUser(user)
+	before, _ := datastore.Environ.DB.GetUser(user.ID)
+
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		if err := db.UpdateUser(user); err != nil {
+			return err
+		}
+		return audit.Record(db, authUser, "user:update", fmt.Sprintf("user/%d", user.ID), before, user)
+	})
 	if err != nil {
 		log.Println("Error updating the store:", err)
 		response.FormatStandardResponse(false, "error-stores-substore", "", "Error updating the store", w)
@@ -171,7 +230,14 @@ func deleteHandler(w http.ResponseWriter, user datastore.User, apiCall bool, use
 		return
 	}
 
-	err = datastore.Environ.DB.DeleteUser(userID)
+	before, _ := datastore.Environ.DB.GetUser(userID)
+
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		if err := db.DeleteUser(userID); err != nil {
+			return err
+		}
+		return audit.Record(db, user, "user:delete", fmt.Sprintf("user/%d", userID), before, nil)
+	})
 	if err != nil {
 		response.FormatStandardResponse(false, "error-deleting-user", "", err.Error(), w)
 		return
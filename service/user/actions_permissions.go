@@ -0,0 +1,134 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package user
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/audit"
+	"github.com/CanonicalLtd/serial-vault/service/auth"
+	"github.com/CanonicalLtd/serial-vault/service/log"
+	"github.com/CanonicalLtd/serial-vault/service/response"
+)
+
+// PermissionListResponse is the JSON response from the API Permission List method
+type PermissionListResponse struct {
+	Success      bool                           `json:"success"`
+	ErrorCode    string                         `json:"error_code"`
+	ErrorSubcode string                         `json:"error_subcode"`
+	ErrorMessage string                         `json:"message"`
+	Role         []string                       `json:"role"`
+	Accounts     []datastore.AccountPermissions `json:"accounts"`
+}
+
+// permissionListHandler is the API method to fetch the permissions of a user: the permissions of
+// the user's role, and the accounts on which the user's permissions have been set
+func permissionListHandler(w http.ResponseWriter, authUser datastore.User, apiCall bool, userID int) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(authUser, datastore.Superuser, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	user, err := datastore.Environ.DB.GetUser(userID)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-get-user", "", err.Error(), w)
+		return
+	}
+
+	accounts, err := datastore.Environ.DB.ListUserAccountPermissions(userID)
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-fetch-permissions", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	formatPermissionListResponse(datastore.RolePermissions[user.Role], accounts, w)
+}
+
+// permissionUpdateHandler is the API method to set the permissions of a user on an account
+func permissionUpdateHandler(w http.ResponseWriter, authUser datastore.User, apiCall bool, userID int, permissions datastore.AccountPermissions) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(authUser, datastore.Superuser, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		if err := db.SetUserAccountPermissions(userID, permissions.AuthorityID, permissions.Permissions); err != nil {
+			return err
+		}
+		return audit.Record(db, authUser, "user:permissions-update", fmt.Sprintf("user/%d/permissions/%s", userID, permissions.AuthorityID), nil, permissions)
+	})
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-updating-permissions", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response.FormatStandardResponse(true, "", "", "", w)
+}
+
+// permissionDeleteHandler is the API method to remove the permissions of a user on an account, so
+// the user has the permissions of their role on it
+func permissionDeleteHandler(w http.ResponseWriter, authUser datastore.User, apiCall bool, userID int, authorityID string) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(authUser, datastore.Superuser, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		if err := db.DeleteUserAccountPermissions(userID, authorityID); err != nil {
+			return err
+		}
+		return audit.Record(db, authUser, "user:permissions-delete", fmt.Sprintf("user/%d/permissions/%s", userID, authorityID), nil, nil)
+	})
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-deleting-permissions", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response.FormatStandardResponse(true, "", "", "", w)
+}
+
+func formatPermissionListResponse(role []string, accounts []datastore.AccountPermissions, w http.ResponseWriter) error {
+	response := PermissionListResponse{Success: true, Role: role, Accounts: accounts}
+
+	// Encode the response as JSON
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error forming the permissions response.\n %v", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package user
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/audit"
+	"github.com/CanonicalLtd/serial-vault/service/auth"
+	"github.com/CanonicalLtd/serial-vault/service/log"
+	"github.com/CanonicalLtd/serial-vault/service/response"
+)
+
+// SessionListResponse is the JSON response from the API Session List method
+type SessionListResponse struct {
+	Success      bool                    `json:"success"`
+	ErrorCode    string                  `json:"error_code"`
+	ErrorSubcode string                  `json:"error_subcode"`
+	ErrorMessage string                  `json:"message"`
+	Sessions     []datastore.UserSession `json:"sessions"`
+}
+
+// sessionListHandler is the API method to fetch the active login sessions of a user
+func sessionListHandler(w http.ResponseWriter, authUser datastore.User, apiCall bool, userID int) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(authUser, datastore.Superuser, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	user, err := datastore.Environ.DB.GetUser(userID)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-get-user", "", err.Error(), w)
+		return
+	}
+
+	sessions, err := datastore.Environ.DB.ListUserSessions(user.Username)
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-fetch-sessions", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	formatSessionListResponse(sessions, w)
+}
+
+// sessionRevokeHandler is the API method to revoke all the login sessions of a user, logging the
+// user out everywhere
+func sessionRevokeHandler(w http.ResponseWriter, authUser datastore.User, apiCall bool, userID int) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(authUser, datastore.Superuser, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	user, err := datastore.Environ.DB.GetUser(userID)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-get-user", "", err.Error(), w)
+		return
+	}
+
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		if err := db.RevokeUserSessions(user.Username); err != nil {
+			return err
+		}
+		return audit.Record(db, authUser, "user:sessions-revoke", fmt.Sprintf("user/%d/sessions", userID), nil, nil)
+	})
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-revoking-sessions", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response.FormatStandardResponse(true, "", "", "", w)
+}
+
+func formatSessionListResponse(sessions []datastore.UserSession, w http.ResponseWriter) error {
+	response := SessionListResponse{Success: true, Sessions: sessions}
+
+	// Encode the response as JSON
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error forming the sessions response.\n %v", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package user
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/audit"
+	"github.com/CanonicalLtd/serial-vault/service/auth"
+	"github.com/CanonicalLtd/serial-vault/service/log"
+	"github.com/CanonicalLtd/serial-vault/service/response"
+)
+
+// TokenListResponse is the JSON response from the API Token List method
+type TokenListResponse struct {
+	Success      bool                  `json:"success"`
+	ErrorCode    string                `json:"error_code"`
+	ErrorSubcode string                `json:"error_subcode"`
+	ErrorMessage string                `json:"message"`
+	Tokens       []datastore.UserToken `json:"tokens"`
+}
+
+// TokenResponse is the JSON response from the API Token Create method
+type TokenResponse struct {
+	Success      bool                `json:"success"`
+	ErrorCode    string              `json:"error_code"`
+	ErrorSubcode string              `json:"error_subcode"`
+	ErrorMessage string              `json:"message"`
+	Token        datastore.UserToken `json:"token"`
+}
+
+// tokenListHandler is the API method to fetch the personal access tokens of the user
+func tokenListHandler(w http.ResponseWriter, user datastore.User, apiCall bool) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.Standard, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	tokens, err := datastore.Environ.DB.ListAllowedUserTokens(user)
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-fetch-tokens", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	formatTokenListResponse(tokens, w)
+}
+
+// tokenCreateHandler is the API method to create a personal access token for the user. The
+// response holds the new token, which cannot be retrieved later
+func tokenCreateHandler(w http.ResponseWriter, user datastore.User, apiCall bool, token datastore.UserToken) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.Standard, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		var err error
+		token, err = db.CreateAllowedUserToken(token, user)
+		if err != nil {
+			return err
+		}
+		return audit.Record(db, user, "user:token-create", fmt.Sprintf("user/%d/token/%d", user.ID, token.ID), nil, token)
+	})
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-creating-token", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	formatTokenResponse(token, w)
+}
+
+// tokenRevokeHandler is the API method to revoke a personal access token of the user
+func tokenRevokeHandler(w http.ResponseWriter, user datastore.User, apiCall bool, tokenID int) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.Standard, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		if err := db.RevokeAllowedUserToken(tokenID, user); err != nil {
+			return err
+		}
+		return audit.Record(db, user, "user:token-revoke", fmt.Sprintf("user/%d/token/%d", user.ID, tokenID), nil, nil)
+	})
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-revoking-token", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response.FormatStandardResponse(true, "", "", "", w)
+}
+
+func formatTokenListResponse(tokens []datastore.UserToken, w http.ResponseWriter) error {
+	response := TokenListResponse{Success: true, Tokens: tokens}
+
+	// Encode the response as JSON
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error forming the personal access tokens response.\n %v", err)
+		return err
+	}
+	return nil
+}
+
+func formatTokenResponse(token datastore.UserToken, w http.ResponseWriter) error {
+	response := TokenResponse{Success: true, Token: token}
+
+	// Encode the response as JSON
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error forming the personal access token response.\n %v", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package user_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/user"
+	check "gopkg.in/check.v1"
+)
+
+func (s *ServiceSuite) TestPermissionListHandler(c *check.C) {
+	w := sendAdminRequest("GET", "/v1/users/3/permissions", nil, datastore.Superuser, c)
+	c.Assert(w.Code, check.Equals, http.StatusOK)
+
+	result := user.PermissionListResponse{}
+	err := json.NewDecoder(w.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Success, check.Equals, true)
+	c.Assert(result.Role, check.DeepEquals, datastore.Permissions)
+	c.Assert(result.Accounts, check.HasLen, 1)
+	c.Assert(result.Accounts[0].AuthorityID, check.Equals, "readonly")
+
+	s.sendRequestRepliesUserError("GET", "/v1/users/99/permissions", nil, c)
+	s.sendRequestWithoutPermissions("GET", "/v1/users/3/permissions", nil, c)
+
+	datastore.Environ.DB = &datastore.ErrorMockDB{}
+	s.sendRequestRepliesUserError("GET", "/v1/users/3/permissions", nil, c)
+}
+
+func (s *ServiceSuite) TestPermissionUpdateHandler(c *check.C) {
+	valid, _ := json.Marshal(datastore.AccountPermissions{AuthorityID: "system", Permissions: []string{datastore.PermissionSigningLogRead}})
+	empty, _ := json.Marshal(datastore.AccountPermissions{AuthorityID: "system"})
+	invalid, _ := json.Marshal(datastore.AccountPermissions{AuthorityID: "system", Permissions: []string{"keypair:delete"}})
+
+	tests := []UserTest{
+		{"PUT", "/v1/users/3/permissions", valid, 200, "application/json; charset=UTF-8", datastore.Superuser, true, true, 0},
+		{"PUT", "/v1/users/3/permissions", empty, 400, "application/json; charset=UTF-8", datastore.Superuser, true, false, 0},
+		{"PUT", "/v1/users/3/permissions", invalid, 400, "application/json; charset=UTF-8", datastore.Superuser, true, false, 0},
+		{"PUT", "/v1/users/3/permissions", []byte("{bad"), 400, "application/json; charset=UTF-8", datastore.Superuser, true, false, 0},
+		{"PUT", "/v1/users/3/permissions", nil, 400, "application/json; charset=UTF-8", datastore.Superuser, true, false, 0},
+		{"PUT", "/v1/users/99/permissions", valid, 400, "application/json; charset=UTF-8", datastore.Superuser, true, false, 0},
+		{"PUT", "/v1/users/3/permissions", valid, 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+		{"DELETE", "/v1/users/3/permissions/readonly", nil, 200, "application/json; charset=UTF-8", datastore.Superuser, true, true, 0},
+		{"DELETE", "/v1/users/99/permissions/readonly", nil, 400, "application/json; charset=UTF-8", datastore.Superuser, true, false, 0},
+		{"DELETE", "/v1/users/3/permissions/readonly", nil, 400, "application/json; charset=UTF-8", datastore.Admin, true, false, 0},
+	}
+
+	for _, t := range tests {
+		datastore.Environ.Config.EnableUserAuth = t.EnableAuth
+
+		w := sendAdminRequest(t.Method, t.URL, bytes.NewReader(t.Data), t.Permissions, c)
+		c.Assert(w.Code, check.Equals, t.Code)
+		c.Assert(w.Header().Get("Content-Type"), check.Equals, t.Type)
+
+		result := user.PermissionListResponse{}
+		err := json.NewDecoder(w.Body).Decode(&result)
+		c.Assert(err, check.IsNil)
+		c.Assert(result.Success, check.Equals, t.Success)
+
+		datastore.Environ.Config.EnableUserAuth = true
+	}
+
+	datastore.Environ.DB = &datastore.ErrorMockDB{}
+	s.sendRequestRepliesUserError("PUT", "/v1/users/3/permissions", bytes.NewReader(valid), c)
+	s.sendRequestRepliesUserError("DELETE", "/v1/users/3/permissions/readonly", nil, c)
+}
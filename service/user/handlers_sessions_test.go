@@ -0,0 +1,80 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package user_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service"
+	"github.com/CanonicalLtd/serial-vault/service/user"
+	"github.com/CanonicalLtd/serial-vault/usso"
+	"github.com/juju/usso/openid"
+	check "gopkg.in/check.v1"
+)
+
+func (s *ServiceSuite) TestSessionHandlers(c *check.C) {
+	// Log in as user1
+	sreg := map[string]string{"nickname": "user1", "fullname": "Rigoberto Picaporte"}
+	jwtToken, err := usso.NewJWTToken(&openid.Response{ID: "identity", SReg: sreg}, datastore.Standard)
+	c.Assert(err, check.IsNil)
+
+	result := s.sendRequestRepliesSessionList("GET", "/v1/users/1/sessions", c)
+	c.Assert(result.Success, check.Equals, true)
+	c.Assert(len(result.Sessions) > 0, check.Equals, true)
+	c.Assert(result.Sessions[0].Username, check.Equals, "user1")
+
+	// Revoke the sessions of user1
+	w := sendAdminRequest("DELETE", "/v1/users/1/sessions", nil, datastore.Superuser, c)
+	c.Assert(w.Code, check.Equals, http.StatusOK)
+
+	result = s.sendRequestRepliesSessionList("GET", "/v1/users/1/sessions", c)
+	c.Assert(len(result.Sessions), check.Equals, 0)
+
+	// The JWT of user1 is no longer accepted
+	w = httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/v1/tokens", nil)
+	r.Header.Set("Authorization", "Bearer "+jwtToken)
+	service.AdminRouter().ServeHTTP(w, r)
+	c.Assert(w.Code, check.Equals, http.StatusBadRequest)
+}
+
+func (s *ServiceSuite) TestSessionHandlersInvalid(c *check.C) {
+	s.sendRequestRepliesUserError("GET", "/v1/users/99/sessions", nil, c)
+	s.sendRequestRepliesUserError("DELETE", "/v1/users/99/sessions", nil, c)
+	s.sendRequestWithoutPermissions("GET", "/v1/users/1/sessions", nil, c)
+	s.sendRequestWithoutPermissions("DELETE", "/v1/users/1/sessions", nil, c)
+
+	datastore.Environ.DB = &datastore.ErrorMockDB{}
+	s.sendRequestRepliesUserError("GET", "/v1/users/1/sessions", nil, c)
+	s.sendRequestRepliesUserError("DELETE", "/v1/users/1/sessions", nil, c)
+}
+
+func (s *ServiceSuite) sendRequestRepliesSessionList(method, url string, c *check.C) user.SessionListResponse {
+	w := sendAdminRequest(method, url, nil, datastore.Superuser, c)
+	c.Assert(w.Code, check.Equals, http.StatusOK)
+
+	result := user.SessionListResponse{}
+	err := json.NewDecoder(w.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	return result
+}
@@ -0,0 +1,135 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package user_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/user"
+	check "gopkg.in/check.v1"
+)
+
+func (s *ServiceSuite) TestTokenListHandler(c *check.C) {
+	tests := []UserTest{
+		{"GET", "/v1/tokens", nil, 200, "application/json; charset=UTF-8", datastore.Standard, true, true, 1},
+		{"GET", "/v1/tokens", nil, 200, "application/json; charset=UTF-8", datastore.Superuser, true, true, 1},
+		{"GET", "/v1/tokens", nil, 400, "application/json; charset=UTF-8", 0, true, false, 0},
+		{"GET", "/v1/tokens", nil, 400, "application/json; charset=UTF-8", 0, false, false, 0},
+	}
+
+	for _, t := range tests {
+		datastore.Environ.Config.EnableUserAuth = t.EnableAuth
+
+		w := sendAdminRequest(t.Method, t.URL, bytes.NewReader(t.Data), t.Permissions, c)
+		c.Assert(w.Code, check.Equals, t.Code)
+		c.Assert(w.Header().Get("Content-Type"), check.Equals, t.Type)
+
+		result, err := parseTokenListResponse(w)
+		c.Assert(err, check.IsNil)
+		c.Assert(result.Success, check.Equals, t.Success)
+		c.Assert(len(result.Tokens), check.Equals, t.List)
+
+		datastore.Environ.Config.EnableUserAuth = true
+	}
+}
+
+func (s *ServiceSuite) TestTokenCreateHandler(c *check.C) {
+	valid, _ := json.Marshal(datastore.UserToken{Label: "ci-logs", Scopes: []string{"signinglog:read"}})
+	noScope, _ := json.Marshal(datastore.UserToken{Label: "ci-logs"})
+	badScope, _ := json.Marshal(datastore.UserToken{Label: "ci-logs", Scopes: []string{"signinglog:delete"}})
+
+	tests := []UserTest{
+		{"POST", "/v1/tokens", valid, 200, "application/json; charset=UTF-8", datastore.Standard, true, true, 0},
+		{"POST", "/v1/tokens", noScope, 400, "application/json; charset=UTF-8", datastore.Standard, true, false, 0},
+		{"POST", "/v1/tokens", badScope, 400, "application/json; charset=UTF-8", datastore.Standard, true, false, 0},
+		{"POST", "/v1/tokens", []byte("{bad"), 400, "application/json; charset=UTF-8", datastore.Standard, true, false, 0},
+		{"POST", "/v1/tokens", nil, 400, "application/json; charset=UTF-8", datastore.Standard, true, false, 0},
+		{"POST", "/v1/tokens", valid, 400, "application/json; charset=UTF-8", 0, true, false, 0},
+		{"POST", "/v1/tokens", valid, 400, "application/json; charset=UTF-8", 0, false, false, 0},
+	}
+
+	for _, t := range tests {
+		datastore.Environ.Config.EnableUserAuth = t.EnableAuth
+
+		w := sendAdminRequest(t.Method, t.URL, bytes.NewReader(t.Data), t.Permissions, c)
+		c.Assert(w.Code, check.Equals, t.Code)
+		c.Assert(w.Header().Get("Content-Type"), check.Equals, t.Type)
+
+		result := user.TokenResponse{}
+		err := json.NewDecoder(w.Body).Decode(&result)
+		c.Assert(err, check.IsNil)
+		c.Assert(result.Success, check.Equals, t.Success)
+		if t.Success {
+			c.Assert(result.Token.Token, check.Equals, "MintedUserToken")
+		}
+
+		datastore.Environ.Config.EnableUserAuth = true
+	}
+}
+
+func (s *ServiceSuite) TestTokenRevokeHandler(c *check.C) {
+	tests := []UserTest{
+		{"DELETE", "/v1/tokens/1", nil, 200, "application/json; charset=UTF-8", datastore.Standard, true, true, 0},
+		{"DELETE", "/v1/tokens/99", nil, 400, "application/json; charset=UTF-8", datastore.Standard, true, false, 0},
+		{"DELETE", "/v1/tokens/1", nil, 400, "application/json; charset=UTF-8", 0, true, false, 0},
+	}
+
+	for _, t := range tests {
+		datastore.Environ.Config.EnableUserAuth = t.EnableAuth
+
+		w := sendAdminRequest(t.Method, t.URL, bytes.NewReader(t.Data), t.Permissions, c)
+		c.Assert(w.Code, check.Equals, t.Code)
+
+		result := user.TokenResponse{}
+		err := json.NewDecoder(w.Body).Decode(&result)
+		c.Assert(err, check.IsNil)
+		c.Assert(result.Success, check.Equals, t.Success)
+
+		datastore.Environ.Config.EnableUserAuth = true
+	}
+}
+
+func (s *ServiceSuite) TestTokenHandlerWithError(c *check.C) {
+	datastore.Environ.DB = &datastore.ErrorMockDB{}
+
+	s.sendRequestRepliesUserError("GET", "/v1/tokens", nil, c)
+	s.sendRequestRepliesUserError("DELETE", "/v1/tokens/1", nil, c)
+}
+
+func (s *ServiceSuite) TestAPIKeyResetHandler(c *check.C) {
+	result := s.sendRequestRepliesUser("POST", "/v1/users/2/apikey", nil, c)
+	c.Assert(result.User.APIKey, check.Equals, "ResetUserAPIKey")
+
+	s.sendRequestRepliesUserError("POST", "/v1/users/99/apikey", nil, c)
+	s.sendRequestWithoutPermissions("POST", "/v1/users/2/apikey", nil, c)
+
+	datastore.Environ.DB = &datastore.ErrorMockDB{}
+	s.sendRequestRepliesUserError("POST", "/v1/users/2/apikey", nil, c)
+}
+
+func parseTokenListResponse(w *httptest.ResponseRecorder) (user.TokenListResponse, error) {
+	// Check the JSON response
+	result := user.TokenListResponse{}
+	err := json.NewDecoder(w.Body).Decode(&result)
+	return result, err
+}
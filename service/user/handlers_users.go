@@ -174,6 +174,24 @@ func Delete(w http.ResponseWriter, r *http.Request) {
 	deleteHandler(w, authUser, false, userID)
 }
 
+// APIKeyReset is the API method to generate a new API key for a user
+func APIKeyReset(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	userID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-user", "", err.Error(), w)
+		return
+	}
+
+	apiKeyResetHandler(w, authUser, false, userID)
+}
+
 // GetOtherAccounts is the API method to retrieve accounts not belonging to the user
 func GetOtherAccounts(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
@@ -73,7 +73,7 @@ func (s *ServiceSuite) TestUsersHandler(c *check.C) {
 	datastore.Environ.DB = &datastore.MockDB{}
 
 	result := s.sendRequestRepliesUsersList("GET", "/v1/users", nil, c)
-	c.Assert(len(result.Users), check.Equals, 6)
+	c.Assert(len(result.Users), check.Equals, 7)
 	c.Assert(result.Users[0].Name, check.Equals, "Rigoberto Picaporte")
 	c.Assert(result.Users[1].Name, check.Equals, "Nancy Reagan")
 	c.Assert(result.Users[2].Name, check.Equals, "Steven Vault")
@@ -144,7 +144,8 @@ func (s *ServiceSuite) TestCreateUserHandler(c *check.C) {
 	data, err := json.Marshal(user)
 	c.Assert(err, check.IsNil)
 
-	s.sendRequestRepliesUser("POST", "/v1/users", bytes.NewReader(data), c)
+	result := s.sendRequestRepliesUser("POST", "/v1/users", bytes.NewReader(data), c)
+	c.Assert(result.User.APIKey, check.Equals, "ResetUserAPIKey")
 }
 
 func (s *ServiceSuite) TestCreateUserHandlerWithOneAccount(c *check.C) {
@@ -0,0 +1,267 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/audit"
+	"github.com/CanonicalLtd/serial-vault/service/auth"
+	"github.com/CanonicalLtd/serial-vault/service/log"
+	"github.com/CanonicalLtd/serial-vault/service/response"
+)
+
+// ListResponse is the JSON response from the API Webhook List method
+type ListResponse struct {
+	Success      bool                `json:"success"`
+	ErrorCode    string              `json:"error_code"`
+	ErrorSubcode string              `json:"error_subcode"`
+	ErrorMessage string              `json:"message"`
+	Webhooks     []datastore.Webhook `json:"webhooks"`
+}
+
+// GetResponse is the JSON response from the API Webhook Get and Create methods
+type GetResponse struct {
+	Success      bool              `json:"success"`
+	ErrorCode    string            `json:"error_code"`
+	ErrorSubcode string            `json:"error_subcode"`
+	ErrorMessage string            `json:"message"`
+	Webhook      datastore.Webhook `json:"webhook"`
+}
+
+// DeliveryListResponse is the JSON response from the API Webhook Deliveries method
+type DeliveryListResponse struct {
+	Success      bool                        `json:"success"`
+	ErrorCode    string                      `json:"error_code"`
+	ErrorSubcode string                      `json:"error_subcode"`
+	ErrorMessage string                      `json:"message"`
+	Deliveries   []datastore.WebhookDelivery `json:"deliveries"`
+}
+
+// listHandler is the API method to fetch the webhooks of the user's accounts
+func listHandler(w http.ResponseWriter, user datastore.User, apiCall bool) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.Admin, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	webhooks, err := datastore.Environ.DB.ListAllowedWebhooks(user)
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-fetch-webhooks", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	formatListResponse(webhooks, w)
+}
+
+// getHandler is the API method to fetch a webhook
+func getHandler(w http.ResponseWriter, user datastore.User, apiCall bool, webhookID int) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.Admin, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	webhook, err := datastore.Environ.DB.GetAllowedWebhook(webhookID, user)
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-fetch-webhook", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	formatGetResponse(webhook, w)
+}
+
+// createHandler is the API method to create a webhook for an account. The response holds the
+// secret of the webhook, which cannot be retrieved later
+func createHandler(w http.ResponseWriter, user datastore.User, apiCall bool, webhook datastore.Webhook) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.Admin, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		var err error
+		webhook, err = db.CreateAllowedWebhook(webhook, user)
+		if err != nil {
+			return err
+		}
+		return audit.Record(db, user, "webhook:create", fmt.Sprintf("webhook/%d", webhook.ID), nil, webhook)
+	})
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-creating-webhook", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	formatGetResponse(webhook, w)
+}
+
+// updateHandler is the API method to update the URL, events and state of a webhook
+func updateHandler(w http.ResponseWriter, user datastore.User, apiCall bool, webhookID int, webhook datastore.Webhook) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.Admin, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	before, _ := datastore.Environ.DB.GetAllowedWebhook(webhookID, user)
+
+	webhook.ID = webhookID
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		if err := db.UpdateAllowedWebhook(webhook, user); err != nil {
+			return err
+		}
+		return audit.Record(db, user, "webhook:update", fmt.Sprintf("webhook/%d", webhookID), before, webhook)
+	})
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-updating-webhook", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response.FormatStandardResponse(true, "", "", "", w)
+}
+
+// deleteHandler is the API method to delete a webhook
+func deleteHandler(w http.ResponseWriter, user datastore.User, apiCall bool, webhookID int) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.Admin, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	before, _ := datastore.Environ.DB.GetAllowedWebhook(webhookID, user)
+
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		if err := db.DeleteAllowedWebhook(webhookID, user); err != nil {
+			return err
+		}
+		return audit.Record(db, user, "webhook:delete", fmt.Sprintf("webhook/%d", webhookID), before, nil)
+	})
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-deleting-webhook", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response.FormatStandardResponse(true, "", "", "", w)
+}
+
+// deliveryListHandler is the API method to fetch the latest deliveries of a webhook, with their status
+func deliveryListHandler(w http.ResponseWriter, user datastore.User, apiCall bool, webhookID int) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.Admin, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	deliveries, err := datastore.Environ.DB.ListAllowedWebhookDeliveries(webhookID, user)
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-fetch-deliveries", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	formatDeliveryListResponse(deliveries, w)
+}
+
+// deliveryRetryHandler is the API method to queue a delivery of a webhook to be attempted again
+func deliveryRetryHandler(w http.ResponseWriter, user datastore.User, apiCall bool, webhookID, deliveryID int) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := auth.CheckUserPermissions(user, datastore.Admin, apiCall)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", "", w)
+		return
+	}
+
+	err = datastore.Environ.DB.Transaction(func(db datastore.Datastore) error {
+		if err := db.RetryAllowedWebhookDelivery(webhookID, deliveryID, user); err != nil {
+			return err
+		}
+		return audit.Record(db, user, "webhook:delivery-retry", fmt.Sprintf("webhook/%d/delivery/%d", webhookID, deliveryID), nil, nil)
+	})
+	if err != nil {
+		log.Println(err)
+		response.FormatStandardResponse(false, "error-retrying-delivery", "", err.Error(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response.FormatStandardResponse(true, "", "", "", w)
+}
+
+func formatListResponse(webhooks []datastore.Webhook, w http.ResponseWriter) error {
+	response := ListResponse{Success: true, Webhooks: webhooks}
+
+	// Encode the response as JSON
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error forming the webhooks response.\n %v", err)
+		return err
+	}
+	return nil
+}
+
+func formatGetResponse(webhook datastore.Webhook, w http.ResponseWriter) error {
+	response := GetResponse{Success: true, Webhook: webhook}
+
+	// Encode the response as JSON
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error forming the webhook response.\n %v", err)
+		return err
+	}
+	return nil
+}
+
+func formatDeliveryListResponse(deliveries []datastore.WebhookDelivery, w http.ResponseWriter) error {
+	response := DeliveryListResponse{Success: true, Deliveries: deliveries}
+
+	// Encode the response as JSON
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error forming the webhook deliveries response.\n %v", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package webhook
+
+import (
+	"net/http"
+
+	"github.com/CanonicalLtd/serial-vault/service/request"
+	"github.com/CanonicalLtd/serial-vault/service/response"
+)
+
+// APIList is the API method to fetch the webhooks of the user's accounts
+func APIList(w http.ResponseWriter, r *http.Request) {
+	// Validate the user and API key
+	user, err := request.CheckUserAPI(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	listHandler(w, user, true)
+}
+
+// APIGet is the API method to fetch a webhook
+func APIGet(w http.ResponseWriter, r *http.Request) {
+	// Validate the user and API key
+	user, err := request.CheckUserAPI(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	webhookID, _, err := webhookIDs(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-webhook", "", err.Error(), w)
+		return
+	}
+
+	getHandler(w, user, true, webhookID)
+}
+
+// APICreate is the API method to create a webhook for an account
+func APICreate(w http.ResponseWriter, r *http.Request) {
+	// Validate the user and API key
+	user, err := request.CheckUserAPI(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	webhook, ok := decodeWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	createHandler(w, user, true, webhook)
+}
+
+// APIUpdate is the API method to update a webhook
+func APIUpdate(w http.ResponseWriter, r *http.Request) {
+	// Validate the user and API key
+	user, err := request.CheckUserAPI(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	webhookID, _, err := webhookIDs(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-webhook", "", err.Error(), w)
+		return
+	}
+
+	webhook, ok := decodeWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	updateHandler(w, user, true, webhookID, webhook)
+}
+
+// APIDelete is the API method to delete a webhook
+func APIDelete(w http.ResponseWriter, r *http.Request) {
+	// Validate the user and API key
+	user, err := request.CheckUserAPI(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	webhookID, _, err := webhookIDs(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-webhook", "", err.Error(), w)
+		return
+	}
+
+	deleteHandler(w, user, true, webhookID)
+}
+
+// APIDeliveryList is the API method to fetch the latest deliveries of a webhook, with their status
+func APIDeliveryList(w http.ResponseWriter, r *http.Request) {
+	// Validate the user and API key
+	user, err := request.CheckUserAPI(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	webhookID, _, err := webhookIDs(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-webhook", "", err.Error(), w)
+		return
+	}
+
+	deliveryListHandler(w, user, true, webhookID)
+}
+
+// APIDeliveryRetry is the API method to attempt a delivery of a webhook again
+func APIDeliveryRetry(w http.ResponseWriter, r *http.Request) {
+	// Validate the user and API key
+	user, err := request.CheckUserAPI(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	webhookID, deliveryID, err := webhookIDs(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-webhook", "", err.Error(), w)
+		return
+	}
+
+	deliveryRetryHandler(w, user, true, webhookID, deliveryID)
+}
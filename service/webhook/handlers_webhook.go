@@ -0,0 +1,184 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/auth"
+	"github.com/CanonicalLtd/serial-vault/service/response"
+	"github.com/gorilla/mux"
+)
+
+// List is the API method to fetch the webhooks of the user's accounts
+func List(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	listHandler(w, authUser, false)
+}
+
+// Get is the API method to fetch a webhook
+func Get(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	webhookID, _, err := webhookIDs(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-webhook", "", err.Error(), w)
+		return
+	}
+
+	getHandler(w, authUser, false, webhookID)
+}
+
+// Create is the API method to create a webhook for an account
+func Create(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	webhook, ok := decodeWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	createHandler(w, authUser, false, webhook)
+}
+
+// Update is the API method to update a webhook
+func Update(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	webhookID, _, err := webhookIDs(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-webhook", "", err.Error(), w)
+		return
+	}
+
+	webhook, ok := decodeWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	updateHandler(w, authUser, false, webhookID, webhook)
+}
+
+// Delete is the API method to delete a webhook
+func Delete(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	webhookID, _, err := webhookIDs(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-webhook", "", err.Error(), w)
+		return
+	}
+
+	deleteHandler(w, authUser, false, webhookID)
+}
+
+// DeliveryList is the API method to fetch the latest deliveries of a webhook
+func DeliveryList(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	webhookID, _, err := webhookIDs(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-webhook", "", err.Error(), w)
+		return
+	}
+
+	deliveryListHandler(w, authUser, false, webhookID)
+}
+
+// DeliveryRetry is the API method to attempt a delivery of a webhook again
+func DeliveryRetry(w http.ResponseWriter, r *http.Request) {
+	authUser, err := auth.GetUserFromJWT(w, r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-auth", "", err.Error(), w)
+		return
+	}
+
+	webhookID, deliveryID, err := webhookIDs(r)
+	if err != nil {
+		response.FormatStandardResponse(false, "error-invalid-webhook", "", err.Error(), w)
+		return
+	}
+
+	deliveryRetryHandler(w, authUser, false, webhookID, deliveryID)
+}
+
+// webhookIDs returns the webhook ID and, for the routes of a delivery, the delivery ID
+func webhookIDs(r *http.Request) (int, int, error) {
+	vars := mux.Vars(r)
+
+	webhookID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if _, ok := vars["deliveryID"]; !ok {
+		return webhookID, 0, nil
+	}
+	deliveryID, err := strconv.Atoi(vars["deliveryID"])
+	return webhookID, deliveryID, err
+}
+
+// decodeWebhook decodes the webhook in the request body, replying with the error when it is not valid
+func decodeWebhook(w http.ResponseWriter, r *http.Request) (datastore.Webhook, bool) {
+	defer r.Body.Close()
+
+	webhook := datastore.Webhook{}
+	err := json.NewDecoder(r.Body).Decode(&webhook)
+	switch {
+	// Check we have some data
+	case err == io.EOF:
+		response.FormatStandardResponse(false, "error-webhook-data", "", "No webhook data supplied", w)
+		return webhook, false
+		// Check for parsing errors
+	case err != nil:
+		response.FormatStandardResponse(false, "error-decode-json", "", err.Error(), w)
+		return webhook, false
+	}
+	return webhook, true
+}
@@ -0,0 +1,252 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package webhook_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CanonicalLtd/serial-vault/config"
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service"
+	svwebhook "github.com/CanonicalLtd/serial-vault/service/webhook"
+	"github.com/CanonicalLtd/serial-vault/usso"
+	"github.com/CanonicalLtd/serial-vault/webhook"
+	"github.com/juju/usso/openid"
+	check "gopkg.in/check.v1"
+)
+
+func TestWebhookSuite(t *testing.T) { check.TestingT(t) }
+
+type WebhookSuite struct{}
+
+var _ = check.Suite(&WebhookSuite{})
+
+func (s *WebhookSuite) SetUpTest(c *check.C) {
+	// Mock the database
+	config := config.Settings{KeyStoreType: "filesystem", KeyStorePath: "../../keystore", JwtSecret: "SomeTestSecretValue", EnableUserAuth: true}
+	datastore.Environ = &datastore.Env{DB: &datastore.MockDB{}, Config: config}
+	datastore.OpenKeyStore(config)
+
+	// Disable CSRF for tests as we do not have a secure connection
+	service.MiddlewareWithCSRF = service.Middleware
+}
+
+func (s *WebhookSuite) TestWebhookHandlers(c *check.C) {
+	data := []byte(`{"authority-id":"system","url":"https://mes.example.com/hook","events":["serial:signed","sync:received"]}`)
+	w := sendAdminRequest("POST", "/v1/webhooks", bytes.NewReader(data), datastore.Admin, c)
+	created := parseGetResponse(w, c)
+	c.Assert(created.Webhook.ID > 0, check.Equals, true)
+	c.Assert(created.Webhook.Secret, check.Not(check.Equals), "")
+	c.Assert(created.Webhook.Active, check.Equals, true)
+	url := fmt.Sprintf("/v1/webhooks/%d", created.Webhook.ID)
+
+	// The secret is only returned when the webhook is created
+	got := parseGetResponse(sendAdminRequest("GET", url, nil, datastore.Admin, c), c)
+	c.Assert(got.Webhook.URL, check.Equals, "https://mes.example.com/hook")
+	c.Assert(got.Webhook.Secret, check.Equals, "")
+
+	w = sendAdminRequest("GET", "/v1/webhooks", nil, datastore.Admin, c)
+	c.Assert(w.Code, check.Equals, http.StatusOK)
+	list := svwebhook.ListResponse{}
+	c.Assert(json.NewDecoder(w.Body).Decode(&list), check.IsNil)
+	c.Assert(len(list.Webhooks) > 0, check.Equals, true)
+
+	data = []byte(`{"url":"https://mes.example.com/hook2","events":["serial:signed"],"active":true}`)
+	w = sendAdminRequest("PUT", url, bytes.NewReader(data), datastore.Admin, c)
+	c.Assert(w.Code, check.Equals, http.StatusOK)
+	got = parseGetResponse(sendAdminRequest("GET", url, nil, datastore.Admin, c), c)
+	c.Assert(got.Webhook.URL, check.Equals, "https://mes.example.com/hook2")
+	c.Assert(got.Webhook.Events, check.DeepEquals, []string{"serial:signed"})
+
+	// Queue an event and check the status of its delivery
+	webhook.Notify("system", datastore.EventSerialSigned, map[string]string{"serial": "A1234"})
+	deliveries := parseDeliveryListResponse(sendAdminRequest("GET", url+"/deliveries", nil, datastore.Admin, c), c)
+	c.Assert(deliveries.Deliveries, check.HasLen, 1)
+	c.Assert(deliveries.Deliveries[0].Status, check.Equals, datastore.WebhookPending)
+	c.Assert(deliveries.Deliveries[0].Event, check.Equals, datastore.EventSerialSigned)
+
+	w = sendAdminRequest("POST", fmt.Sprintf("%s/deliveries/%d/retry", url, deliveries.Deliveries[0].ID), nil, datastore.Admin, c)
+	c.Assert(w.Code, check.Equals, http.StatusOK)
+
+	w = sendAdminRequest("DELETE", url, nil, datastore.Admin, c)
+	c.Assert(w.Code, check.Equals, http.StatusOK)
+	w = sendAdminRequest("GET", url, nil, datastore.Admin, c)
+	c.Assert(w.Code, check.Equals, http.StatusBadRequest)
+}
+
+func (s *WebhookSuite) TestWebhookAPIHandlers(c *check.C) {
+	data := []byte(`{"authority-id":"system","url":"https://mes.example.com/api","events":["pivot:performed"]}`)
+	w := sendAPIRequest("POST", "/api/webhooks", bytes.NewReader(data), c)
+	created := parseGetResponse(w, c)
+	url := fmt.Sprintf("/api/webhooks/%d", created.Webhook.ID)
+
+	parseGetResponse(sendAPIRequest("GET", url, nil, c), c)
+	w = sendAPIRequest("GET", "/api/webhooks", nil, c)
+	c.Assert(w.Code, check.Equals, http.StatusOK)
+
+	data = []byte(`{"url":"https://mes.example.com/api","events":["pivot:performed"],"active":false}`)
+	w = sendAPIRequest("PUT", url, bytes.NewReader(data), c)
+	c.Assert(w.Code, check.Equals, http.StatusOK)
+
+	deliveries := parseDeliveryListResponse(sendAPIRequest("GET", url+"/deliveries", nil, c), c)
+	c.Assert(deliveries.Deliveries, check.HasLen, 0)
+
+	w = sendAPIRequest("POST", url+"/deliveries/99/retry", nil, c)
+	c.Assert(w.Code, check.Equals, http.StatusBadRequest)
+
+	w = sendAPIRequest("DELETE", url, nil, c)
+	c.Assert(w.Code, check.Equals, http.StatusOK)
+}
+
+func (s *WebhookSuite) TestWebhookSigningLogPermission(c *check.C) {
+	send := func(method, url string, data []byte) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(method, url, bytes.NewReader(data))
+		r.Header.Set("user", "reader")
+		r.Header.Set("api-key", "ValidAPIKey")
+		service.AdminRouter().ServeHTTP(w, r)
+		return w
+	}
+
+	// The signing logs of the account cannot be read by the user, so the serials cannot be sent
+	data := []byte(`{"authority-id":"nologs","url":"https://mes.example.com/api","events":["serial:signed"]}`)
+	w := send("POST", "/api/webhooks", data)
+	c.Assert(w.Code, check.Equals, http.StatusBadRequest)
+
+	// The other events can be sent, but the webhook cannot be changed to the signing of serials
+	data = []byte(`{"authority-id":"nologs","url":"https://mes.example.com/api","events":["pivot:performed"]}`)
+	created := parseGetResponse(send("POST", "/api/webhooks", data), c)
+	url := fmt.Sprintf("/api/webhooks/%d", created.Webhook.ID)
+
+	data = []byte(`{"url":"https://mes.example.com/api","events":["pivot:performed","serial:signed"],"active":true}`)
+	w = send("PUT", url, data)
+	c.Assert(w.Code, check.Equals, http.StatusBadRequest)
+
+	// The signing logs of the account can be read by the user
+	data = []byte(`{"authority-id":"system","url":"https://mes.example.com/api","events":["serial:signed"]}`)
+	created = parseGetResponse(send("POST", "/api/webhooks", data), c)
+	c.Assert(created.Webhook.Events, check.DeepEquals, []string{"serial:signed"})
+
+	send("DELETE", url, nil)
+	send("DELETE", fmt.Sprintf("/api/webhooks/%d", created.Webhook.ID), nil)
+}
+
+func (s *WebhookSuite) TestWebhookHandlersInvalid(c *check.C) {
+	tests := []struct {
+		method      string
+		url         string
+		data        string
+		permissions int
+	}{
+		{"GET", "/v1/webhooks", "", datastore.Standard},
+		{"POST", "/v1/webhooks", `{"authority-id":"system","url":"https://mes.example.com","events":["serial:signed"]}`, datastore.Standard},
+		{"POST", "/v1/webhooks", "", datastore.Admin},
+		{"POST", "/v1/webhooks", "က", datastore.Admin},
+		{"POST", "/v1/webhooks", `{"authority-id":"system","url":"ftp://mes.example.com","events":["serial:signed"]}`, datastore.Admin},
+		{"POST", "/v1/webhooks", `{"authority-id":"system","url":"https://mes.example.com","events":["invalid"]}`, datastore.Admin},
+		{"POST", "/v1/webhooks", `{"authority-id":"system","url":"https://mes.example.com","events":[]}`, datastore.Admin},
+		{"POST", "/v1/webhooks", `{"url":"https://mes.example.com","events":["serial:signed"]}`, datastore.Admin},
+		{"GET", "/v1/webhooks/999", "", datastore.Admin},
+		{"PUT", "/v1/webhooks/999", `{"url":"https://mes.example.com","events":["serial:signed"]}`, datastore.Admin},
+		{"DELETE", "/v1/webhooks/999", "", datastore.Admin},
+		{"GET", "/v1/webhooks/999/deliveries", "", datastore.Admin},
+		{"POST", "/v1/webhooks/999/deliveries/1/retry", "", datastore.Admin},
+	}
+
+	for _, t := range tests {
+		w := sendAdminRequest(t.method, t.url, bytes.NewReader([]byte(t.data)), t.permissions, c)
+		c.Assert(w.Code, check.Equals, http.StatusBadRequest, check.Commentf("%s %s", t.method, t.url))
+	}
+
+	datastore.Environ.DB = &datastore.ErrorMockDB{}
+	for _, t := range []struct{ method, url, data string }{
+		{"GET", "/v1/webhooks", ""},
+		{"GET", "/v1/webhooks/1", ""},
+		{"POST", "/v1/webhooks", `{"authority-id":"system","url":"https://mes.example.com","events":["serial:signed"]}`},
+		{"PUT", "/v1/webhooks/1", `{"url":"https://mes.example.com","events":["serial:signed"]}`},
+		{"DELETE", "/v1/webhooks/1", ""},
+		{"GET", "/v1/webhooks/1/deliveries", ""},
+		{"POST", "/v1/webhooks/1/deliveries/1/retry", ""},
+	} {
+		w := sendAdminRequest(t.method, t.url, bytes.NewReader([]byte(t.data)), datastore.Admin, c)
+		c.Assert(w.Code, check.Equals, http.StatusBadRequest, check.Commentf("%s %s", t.method, t.url))
+	}
+}
+
+func parseGetResponse(w *httptest.ResponseRecorder, c *check.C) svwebhook.GetResponse {
+	c.Assert(w.Code, check.Equals, http.StatusOK)
+
+	result := svwebhook.GetResponse{}
+	err := json.NewDecoder(w.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Success, check.Equals, true)
+	return result
+}
+
+func parseDeliveryListResponse(w *httptest.ResponseRecorder, c *check.C) svwebhook.DeliveryListResponse {
+	c.Assert(w.Code, check.Equals, http.StatusOK)
+
+	result := svwebhook.DeliveryListResponse{}
+	err := json.NewDecoder(w.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Success, check.Equals, true)
+	return result
+}
+
+func sendAdminRequest(method, url string, data io.Reader, permissions int, c *check.C) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(method, url, data)
+
+	// Create a JWT and add it to the request
+	err := createJWTWithRole(r, permissions)
+	c.Assert(err, check.IsNil)
+
+	service.AdminRouter().ServeHTTP(w, r)
+
+	return w
+}
+
+func sendAPIRequest(method, url string, data io.Reader, c *check.C) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(method, url, data)
+	r.Header.Set("user", "sv")
+	r.Header.Set("api-key", "ValidAPIKey")
+
+	service.AdminRouter().ServeHTTP(w, r)
+
+	return w
+}
+
+func createJWTWithRole(r *http.Request, role int) error {
+	sreg := map[string]string{"nickname": "sv", "fullname": "Steven Vault", "email": "sv@example.com"}
+	resp := openid.Response{ID: "identity", Teams: []string{}, SReg: sreg}
+	jwtToken, err := usso.NewJWTToken(&resp, role)
+	if err != nil {
+		return fmt.Errorf("Error creating a JWT: %v", err)
+	}
+	r.Header.Set("Authorization", "Bearer "+jwtToken)
+	return nil
+}
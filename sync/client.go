@@ -147,11 +147,96 @@ func (c *FactoryClient) Models() error {
 			return err
 		}
 
+		err = c.modelAPIKeys(m.ID)
+		if err != nil {
+			return err
+		}
+
+		err = c.serialAllowlist(m.ID)
+		if err != nil {
+			return err
+		}
+
+		err = c.serialRevocations(m)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// modelAPIKeys synchronizes the hashes of the named API keys of a model to the factory instance
+func (c *FactoryClient) modelAPIKeys(modelID int) error {
+	result, err := FetchModelAPIKeys(c.URL, c.Username, c.APIKey, modelID)
+	if err != nil {
+		log.Errorf("Error parsing model API keys: %v", err)
+		return err
+	}
+	if !result.Success {
+		log.Errorf("Error fetching model API keys: %s", result.ErrorMessage)
+		return errors.New(result.ErrorMessage)
+	}
+
+	err = datastore.Environ.DB.SyncModelAPIKeys(result.APIKeys)
+	if err != nil {
+		log.Errorf("Error updating model API keys: %v", err)
+	}
+	return err
+}
+
+// serialAllowlist synchronizes the serial number allowlist of a model to the factory instance,
+// so that the factory only signs the registered serial numbers. The allowlist is fetched in
+// pages and only replaced once it has all been fetched
+func (c *FactoryClient) serialAllowlist(modelID int) error {
+	serials := []datastore.SerialAllowlist{}
+	after := ""
+
+	for {
+		result, err := FetchSerialAllowlist(c.URL, c.Username, c.APIKey, modelID, after)
+		if err != nil {
+			log.Errorf("Error parsing the serial number allowlist: %v", err)
+			return err
+		}
+		if !result.Success {
+			log.Errorf("Error fetching the serial number allowlist: %s", result.ErrorMessage)
+			return errors.New(result.ErrorMessage)
+		}
+
+		serials = append(serials, result.Serials...)
+		if len(result.Serials) < datastore.SerialAllowlistPageSize {
+			break
+		}
+		after = result.Serials[len(result.Serials)-1].SerialNumber
+	}
+
+	err := datastore.Environ.DB.SyncSerialAllowlist(modelID, serials)
+	if err != nil {
+		log.Errorf("Error updating the serial number allowlist: %v", err)
+	}
+	return err
+}
+
+// serialRevocations synchronizes the revoked serial assertions of a model to the factory instance,
+// so that the factory does not re-sign them
+func (c *FactoryClient) serialRevocations(m datastore.Model) error {
+	result, err := FetchSerialRevocations(c.URL, c.Username, c.APIKey, m.ID)
+	if err != nil {
+		log.Errorf("Error parsing the serial revocations: %v", err)
+		return err
+	}
+	if !result.Success {
+		log.Errorf("Error fetching the serial revocations: %s", result.ErrorMessage)
+		return errors.New(result.ErrorMessage)
+	}
+
+	err = datastore.Environ.DB.SyncSerialRevocations(m.BrandID, m.Name, result.Revocations)
+	if err != nil {
+		log.Errorf("Error updating the serial revocations: %v", err)
+	}
+	return err
+}
+
 // SigningLogs sends signing logs to the cloud from the factory
 func (c *FactoryClient) SigningLogs() error {
 	// Fetch the signing logs that have not been synced
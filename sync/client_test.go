@@ -24,6 +24,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -72,6 +73,18 @@ func (s *startSuite) TestStartUnit(c *check.C) {
 			Args:         []string{"model"},
 			ErrorMessage: "MOCK fail fetching models",
 			MockFail:     true},
+		{
+			Args:           []string{"model"},
+			ErrorMessage:   "MOCK fail fetching model API keys",
+			MockAPIKeyFail: true},
+		{
+			Args:              []string{"model"},
+			ErrorMessage:      "MOCK fail fetching the serial number allowlist",
+			MockAllowlistFail: true},
+		{
+			Args:            []string{"model"},
+			ErrorMessage:    "MOCK fail fetching the serial revocations",
+			MockRevokedFail: true},
 		{
 			Args:         []string{"signinglog"},
 			ErrorMessage: ""},
@@ -106,6 +119,15 @@ func (s *startSuite) TestStartUnit(c *check.C) {
 			sync.FetchModels = mockFetchModelsFail
 			sync.SendTestLog = mockSendTestLogError
 		}
+		if t.MockAPIKeyFail {
+			sync.FetchModelAPIKeys = mockFetchModelAPIKeysFail
+		}
+		if t.MockAllowlistFail {
+			sync.FetchSerialAllowlist = mockFetchSerialAllowlistFail
+		}
+		if t.MockRevokedFail {
+			sync.FetchSerialRevocations = mockFetchSerialRevocationsFail
+		}
 		if !t.MockErrorDB && !t.MockFail {
 			// This ensures that we treat the keypairs as new
 			sync.GetKeypairByPublicID = mockGetKeypairByPublicID
@@ -137,6 +159,9 @@ func (s *startSuite) TestStartUnit(c *check.C) {
 		sync.FetchAccounts = mockFetchAccounts
 		sync.FetchSigningKeys = mockFetchSigningKeys
 		sync.FetchModels = mockFetchModels
+		sync.FetchModelAPIKeys = mockFetchModelAPIKeys
+		sync.FetchSerialAllowlist = mockFetchSerialAllowlist
+		sync.FetchSerialRevocations = mockFetchSerialRevocations
 		sync.SendSigningLog = mockSendSigningLog
 		sync.SendTestLog = mockSendTestLog
 	}
@@ -182,6 +207,39 @@ func mockFetchModelsFail(url, username, apikey string) (model.ListResponse, erro
 	return model.ListResponse{Success: false, ErrorMessage: "MOCK fail fetching models"}, nil
 }
 
+func mockFetchModelAPIKeys(url, username, apikey string, modelID int) (model.APIKeyListResponse, error) {
+	w := sendSyncAPIRequest("GET", fmt.Sprintf("/api/models/%d/apikeys", modelID), nil)
+	result := model.APIKeyListResponse{}
+	err := json.NewDecoder(w.Body).Decode(&result)
+	return result, err
+}
+
+func mockFetchModelAPIKeysFail(url, username, apikey string, modelID int) (model.APIKeyListResponse, error) {
+	return model.APIKeyListResponse{Success: false, ErrorMessage: "MOCK fail fetching model API keys"}, nil
+}
+
+func mockFetchSerialAllowlist(url, username, apikey string, modelID int, after string) (model.SerialListResponse, error) {
+	w := sendSyncAPIRequest("GET", fmt.Sprintf("/api/models/%d/serials?after=%s", modelID, after), nil)
+	result := model.SerialListResponse{}
+	err := json.NewDecoder(w.Body).Decode(&result)
+	return result, err
+}
+
+func mockFetchSerialAllowlistFail(url, username, apikey string, modelID int, after string) (model.SerialListResponse, error) {
+	return model.SerialListResponse{Success: false, ErrorMessage: "MOCK fail fetching the serial number allowlist"}, nil
+}
+
+func mockFetchSerialRevocations(url, username, apikey string, modelID int) (model.RevocationListResponse, error) {
+	w := sendSyncAPIRequest("GET", fmt.Sprintf("/api/models/%d/revocations", modelID), nil)
+	result := model.RevocationListResponse{}
+	err := json.NewDecoder(w.Body).Decode(&result)
+	return result, err
+}
+
+func mockFetchSerialRevocationsFail(url, username, apikey string, modelID int) (model.RevocationListResponse, error) {
+	return model.RevocationListResponse{Success: false, ErrorMessage: "MOCK fail fetching the serial revocations"}, nil
+}
+
 func mockSendSigningLog(url, username, apikey string, signLog datastore.SigningLog) (bool, error) {
 	return true, nil
 }
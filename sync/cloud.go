@@ -23,7 +23,9 @@ package sync
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	neturl "net/url"
 
 	"github.com/CanonicalLtd/serial-vault/datastore"
 	"github.com/CanonicalLtd/serial-vault/service/account"
@@ -82,6 +84,43 @@ var FetchModels = func(url, username, apikey string) (model.ListResponse, error)
 	return parseModelResponse(w)
 }
 
+// FetchModelAPIKeys fetches the named API keys of a model from the cloud serial vault
+var FetchModelAPIKeys = func(url, username, apikey string, modelID int) (model.APIKeyListResponse, error) {
+	w, err := SendRequest("GET", url, fmt.Sprintf("models/%d/apikeys", modelID), username, apikey, nil)
+	if err != nil {
+		log.Errorf("Error fetching model API keys: %v", err)
+		return model.APIKeyListResponse{}, err
+	}
+
+	// Parse the response from the cloud
+	return parseAPIKeyResponse(w)
+}
+
+// FetchSerialAllowlist fetches a page of the serial number allowlist of a model, after a serial
+// number, from the cloud serial vault
+var FetchSerialAllowlist = func(url, username, apikey string, modelID int, after string) (model.SerialListResponse, error) {
+	w, err := SendRequest("GET", url, fmt.Sprintf("models/%d/serials?after=%s", modelID, neturl.QueryEscape(after)), username, apikey, nil)
+	if err != nil {
+		log.Errorf("Error fetching the serial number allowlist: %v", err)
+		return model.SerialListResponse{}, err
+	}
+
+	// Parse the response from the cloud
+	return parseSerialListResponse(w)
+}
+
+// FetchSerialRevocations fetches the revoked serial assertions of a model from the cloud serial vault
+var FetchSerialRevocations = func(url, username, apikey string, modelID int) (model.RevocationListResponse, error) {
+	w, err := SendRequest("GET", url, fmt.Sprintf("models/%d/revocations", modelID), username, apikey, nil)
+	if err != nil {
+		log.Errorf("Error fetching the serial revocations: %v", err)
+		return model.RevocationListResponse{}, err
+	}
+
+	// Parse the response from the cloud
+	return parseRevocationListResponse(w)
+}
+
 // SendSigningLog sends a signing log to the cloud serial vault
 var SendSigningLog = func(url, username, apikey string, signLog datastore.SigningLog) (bool, error) {
 
@@ -160,6 +199,27 @@ func parseModelResponse(w *http.Response) (model.ListResponse, error) {
 	return result, err
 }
 
+func parseAPIKeyResponse(w *http.Response) (model.APIKeyListResponse, error) {
+	// Check the JSON response
+	result := model.APIKeyListResponse{}
+	err := json.NewDecoder(w.Body).Decode(&result)
+	return result, err
+}
+
+func parseSerialListResponse(w *http.Response) (model.SerialListResponse, error) {
+	// Check the JSON response
+	result := model.SerialListResponse{}
+	err := json.NewDecoder(w.Body).Decode(&result)
+	return result, err
+}
+
+func parseRevocationListResponse(w *http.Response) (model.RevocationListResponse, error) {
+	// Check the JSON response
+	result := model.RevocationListResponse{}
+	err := json.NewDecoder(w.Body).Decode(&result)
+	return result, err
+}
+
 func parseStandardResponse(w *http.Response) (response.StandardResponse, error) {
 	// Check the JSON response
 	result := response.StandardResponse{}
@@ -41,6 +41,9 @@ func (s *startSuite) SetUpTest(c *check.C) {
 	sync.FetchSigningKeys = mockFetchSigningKeys
 	datastore.ReEncryptKeypair = mockReEncryptKeypair
 	sync.FetchModels = mockFetchModels
+	sync.FetchModelAPIKeys = mockFetchModelAPIKeys
+	sync.FetchSerialAllowlist = mockFetchSerialAllowlist
+	sync.FetchSerialRevocations = mockFetchSerialRevocations
 	sync.SendSigningLog = mockSendSigningLog
 	sync.SendTestLog = mockSendTestLog
 }
@@ -85,6 +88,9 @@ func (s *startSuite) TestStart(c *check.C) {
 		sync.FetchAccounts = mockFetchAccounts
 		sync.FetchSigningKeys = mockFetchSigningKeys
 		sync.FetchModels = mockFetchModels
+		sync.FetchModelAPIKeys = mockFetchModelAPIKeys
+		sync.FetchSerialAllowlist = mockFetchSerialAllowlist
+		sync.FetchSerialRevocations = mockFetchSerialRevocations
 		sync.SendSigningLog = mockSendSigningLog
 	}
 }
@@ -33,10 +33,13 @@ import (
 func Test(t *testing.T) { check.TestingT(t) }
 
 type suiteTest struct {
-	Args         []string
-	ErrorMessage string
-	MockErrorDB  bool
-	MockFail     bool
+	Args              []string
+	ErrorMessage      string
+	MockErrorDB       bool
+	MockFail          bool
+	MockAPIKeyFail    bool
+	MockAllowlistFail bool
+	MockRevokedFail   bool
 }
 
 func mockArgs(args ...string) (restore func()) {
@@ -19,6 +19,8 @@
 
 package usso
 
+import "time"
+
 const jwtSecret = "TODO-ReplaceWithASecretFromTheConfigurationFile"
 
 // ClaimsKey is the context key for the JWT claims
@@ -32,7 +34,16 @@ const (
 	ClaimsName             = "name"
 	ClaimsRole             = "role"
 	StandardClaimExpiresAt = "exp"
+	StandardClaimID        = "jti"
 )
 
 // JWTCookie is the name of the cookie used to store the JWT
 const JWTCookie = "X-Auth-Token"
+
+// Lifetimes of the JWT and of the login session. The JWT is short-lived and is refreshed while the
+// session is in use: the session expires when it is idle, and is limited to a maximum age
+const (
+	jwtExpiry          = 15 * time.Minute
+	sessionIdleTimeout = time.Hour
+	sessionMaxAge      = 24 * time.Hour
+)
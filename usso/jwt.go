@@ -33,7 +33,7 @@ import (
 	"github.com/juju/usso/openid"
 )
 
-func createJWT(username, name, email, identity string, role int, expires int64) (string, error) {
+func createJWT(username, name, email, identity string, role int, jti string, expires int64) (string, error) {
 	token := jwt.New(jwt.SigningMethodHS256)
 
 	claims := token.Claims.(jwt.MapClaims)
@@ -42,6 +42,7 @@ func createJWT(username, name, email, identity string, role int, expires int64)
 	claims[ClaimsEmail] = email
 	claims[ClaimsIdentity] = identity
 	claims[ClaimsRole] = role
+	claims[StandardClaimID] = jti
 	claims[StandardClaimExpiresAt] = expires
 
 	jwtSecret := datastore.Environ.Config.JwtSecret
@@ -58,7 +59,30 @@ func createJWT(username, name, email, identity string, role int, expires int64)
 
 // NewJWTToken creates a new JWT from the verified OpenID response
 func NewJWTToken(resp *openid.Response, role int) (string, error) {
-	return createJWT(resp.SReg["nickname"], resp.SReg["fullname"], resp.SReg["email"], resp.ID, role, time.Now().Add(time.Hour*24).Unix())
+	return newSessionJWT(resp.SReg["nickname"], resp.SReg["fullname"], resp.SReg["email"], resp.ID, role)
+}
+
+// newSessionJWT starts a login session for the user and creates its JWT
+func newSessionJWT(username, name, email, identity string, role int) (string, error) {
+	jti, err := randomString()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	session := datastore.UserSession{
+		JTI:      jti,
+		Username: username,
+		Created:  now,
+		Expires:  now.Add(sessionIdleTimeout),
+		LastSeen: now,
+	}
+	if err := datastore.Environ.DB.CreateUserSession(session); err != nil {
+		log.Printf("Error creating the session: %v", err)
+		return "", err
+	}
+
+	return createJWT(username, name, email, identity, role, jti, now.Add(jwtExpiry).Unix())
 }
 
 func keyFunc(token *jwt.Token) (interface{}, error) {
@@ -77,6 +101,93 @@ func VerifyJWT(jwtToken string) (*jwt.Token, error) {
 	return token, err
 }
 
+// VerifySession checks the JWT and that its login session is active. When the JWT is close to its
+// expiry, or has expired, it is refreshed: the session is extended and a new JWT is returned for it.
+// The role of the refreshed JWT is read from the database, so role changes apply within a refresh
+func VerifySession(jwtToken string) (*jwt.Token, string, error) {
+	token, err := VerifyJWT(jwtToken)
+	if err != nil {
+		// An expired JWT can still be refreshed while its session is active
+		if !isExpired(err) {
+			return nil, "", err
+		}
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	jti, _ := claims[StandardClaimID].(string)
+	username, _ := claims[ClaimsUsername].(string)
+	if len(jti) == 0 {
+		return nil, "", errors.New("The JWT has no session")
+	}
+
+	session, err := datastore.Environ.DB.GetUserSession(jti)
+	if err != nil || session.Username != username {
+		return nil, "", errors.New("The session has expired or has been revoked")
+	}
+
+	now := time.Now()
+	expires, _ := claims[StandardClaimExpiresAt].(float64)
+	if time.Unix(int64(expires), 0).Sub(now) > jwtExpiry/2 {
+		return token, "", nil
+	}
+
+	user, err := datastore.Environ.DB.GetUserByUsername(username)
+	if err != nil || user.Role == datastore.Invalid {
+		datastore.Environ.DB.RevokeUserSession(jti)
+		return nil, "", errors.New("The user no longer has access")
+	}
+
+	sessionExpires := now.Add(sessionIdleTimeout)
+	if maxExpires := session.Created.Add(sessionMaxAge); sessionExpires.After(maxExpires) {
+		sessionExpires = maxExpires
+	}
+	if err := datastore.Environ.DB.RefreshUserSession(jti, sessionExpires); err != nil {
+		return nil, "", err
+	}
+
+	jwtExpires := now.Add(jwtExpiry)
+	if jwtExpires.After(sessionExpires) {
+		jwtExpires = sessionExpires
+	}
+	name, _ := claims[ClaimsName].(string)
+	email, _ := claims[ClaimsEmail].(string)
+	identity, _ := claims[ClaimsIdentity].(string)
+	refreshed, err := createJWT(username, name, email, identity, user.Role, jti, jwtExpires.Unix())
+	if err != nil {
+		return nil, "", err
+	}
+
+	token, err = VerifyJWT(refreshed)
+	return token, refreshed, err
+}
+
+// isExpired checks whether the only JWT verification error is its expiry
+func isExpired(err error) bool {
+	vErr, ok := err.(*jwt.ValidationError)
+	return ok && vErr.Errors == jwt.ValidationErrorExpired
+}
+
+// revokeSession revokes the login session of the JWT of the request, if there is one
+func revokeSession(r *http.Request) {
+	jwtToken, err := JWTExtractor(r)
+	if err != nil {
+		return
+	}
+
+	// The session of an expired JWT is revoked too, as it may still be refreshed
+	token, err := VerifyJWT(jwtToken)
+	if token == nil || (err != nil && !isExpired(err)) {
+		return
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	if jti, _ := claims[StandardClaimID].(string); len(jti) > 0 {
+		if err := datastore.Environ.DB.RevokeUserSession(jti); err != nil {
+			log.Println("Error logging out:", err.Error())
+		}
+	}
+}
+
 // AddJWTCookie sets the JWT as a cookie
 func AddJWTCookie(jwtToken string, w http.ResponseWriter) {
 
@@ -84,7 +195,7 @@ func AddJWTCookie(jwtToken string, w http.ResponseWriter) {
 	// (In practice, the cookie will be used more as clicking on a page link will not send the auth header)
 	w.Header().Set("Authorization", "Bearer "+jwtToken)
 
-	expireCookie := time.Now().Add(time.Hour * 1)
+	expireCookie := time.Now().Add(sessionIdleTimeout)
 	cookie := http.Cookie{Name: JWTCookie, Value: jwtToken, Expires: expireCookie, HttpOnly: true}
 	http.SetCookie(w, &cookie)
 }
@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/CanonicalLtd/serial-vault/config"
 	"github.com/CanonicalLtd/serial-vault/datastore"
@@ -58,7 +59,7 @@ func TestNewJWTToken(t *testing.T) {
 	}
 
 	config := config.Settings{JwtSecret: "SomeTestSecretValue"}
-	datastore.Environ = &datastore.Env{Config: config}
+	datastore.Environ = &datastore.Env{DB: &datastore.MockDB{}, Config: config}
 
 	for _, r := range []testJWT{test1, test2, test3} {
 
@@ -97,6 +98,86 @@ func expectedToken(t *testing.T, jwtToken string, resp *openid.Response, usernam
 	}
 }
 
+func sessionClaims(t *testing.T, jwtToken string) jwt.MapClaims {
+	token, err := VerifyJWT(jwtToken)
+	if err != nil && !isExpired(err) {
+		t.Fatalf("Error validating JWT: %v", err)
+	}
+	return token.Claims.(jwt.MapClaims)
+}
+
+func TestVerifySession(t *testing.T) {
+	datastore.Environ = &datastore.Env{DB: &datastore.MockDB{}, Config: config.Settings{JwtSecret: "SomeTestSecretValue"}}
+
+	jwtToken, err := newSessionJWT("user1", "Rigoberto Picaporte", "", "id", datastore.Standard)
+	if err != nil {
+		t.Fatalf("Error creating JWT: %v", err)
+	}
+	jti, _ := sessionClaims(t, jwtToken)[StandardClaimID].(string)
+	if len(jti) == 0 {
+		t.Fatal("Expected the JWT to have a session ID")
+	}
+
+	// A fresh JWT is not refreshed
+	token, refreshed, err := VerifySession(jwtToken)
+	if err != nil {
+		t.Fatalf("Error verifying the session: %v", err)
+	}
+	if !token.Valid || refreshed != "" {
+		t.Errorf("Expected a valid JWT without refresh, got: %v, %v", token.Valid, refreshed)
+	}
+
+	// A revoked session is not accepted
+	datastore.Environ.DB.RevokeUserSession(jti)
+	if _, _, err := VerifySession(jwtToken); err == nil {
+		t.Error("Expected an error for a revoked session")
+	}
+
+	// A JWT without a session is not accepted
+	noSession, _ := createJWT("user1", "", "", "id", datastore.Standard, "", time.Now().Add(jwtExpiry).Unix())
+	if _, _, err := VerifySession(noSession); err == nil {
+		t.Error("Expected an error for a JWT without a session")
+	}
+}
+
+func TestVerifySessionRefresh(t *testing.T) {
+	datastore.Environ = &datastore.Env{DB: &datastore.MockDB{}, Config: config.Settings{JwtSecret: "SomeTestSecretValue"}}
+
+	jwtToken, err := newSessionJWT("user1", "Rigoberto Picaporte", "", "id", datastore.Admin)
+	if err != nil {
+		t.Fatalf("Error creating JWT: %v", err)
+	}
+	jti, _ := sessionClaims(t, jwtToken)[StandardClaimID].(string)
+
+	// An expired JWT of an active session is refreshed, with the user's current role
+	expired, _ := createJWT("user1", "Rigoberto Picaporte", "", "id", datastore.Admin, jti, time.Now().Add(-time.Minute).Unix())
+	token, refreshed, err := VerifySession(expired)
+	if err != nil {
+		t.Fatalf("Error verifying the session: %v", err)
+	}
+	if !token.Valid || refreshed == "" {
+		t.Fatalf("Expected a refreshed JWT, got: %v, %v", token.Valid, refreshed)
+	}
+	claims := sessionClaims(t, refreshed)
+	if claims[StandardClaimID] != jti {
+		t.Errorf("Expected the session ID '%s', got: %v", jti, claims[StandardClaimID])
+	}
+	if int(claims[ClaimsRole].(float64)) != datastore.Standard {
+		t.Errorf("Expected the role from the database, got: %v", claims[ClaimsRole])
+	}
+
+	// The session of an unknown user is revoked
+	jwtToken, _ = newSessionJWT("unknown", "", "", "id", datastore.Admin)
+	jti, _ = sessionClaims(t, jwtToken)[StandardClaimID].(string)
+	expired, _ = createJWT("unknown", "", "", "id", datastore.Admin, jti, time.Now().Add(-time.Minute).Unix())
+	if _, _, err := VerifySession(expired); err == nil {
+		t.Error("Expected an error refreshing the JWT of an unknown user")
+	}
+	if _, err := datastore.Environ.DB.GetUserSession(jti); err == nil {
+		t.Error("Expected the session to be revoked")
+	}
+}
+
 func testHandler(w http.ResponseWriter, r *http.Request) {
 
 }
@@ -0,0 +1,501 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package usso
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/log"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// AuthProviderOIDC is the login provider setting for an OpenID Connect provider
+const AuthProviderOIDC = "oidc"
+
+// Defaults for the OpenID Connect settings
+const (
+	defaultOIDCScopes        = "openid,profile,email"
+	defaultOIDCUsernameClaim = "preferred_username"
+	defaultOIDCGroupsClaim   = "groups"
+)
+
+// oidcStateCookie holds the state and nonce of a login, between the redirect to the OpenID Connect
+// provider and its response
+const oidcStateCookie = "X-OIDC-State"
+const oidcStateMaxAge = 600
+
+var oidcClient = &http.Client{Timeout: 10 * time.Second}
+
+// oidcProvider holds the endpoints of an OpenID Connect provider, from its discovery document
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcTokenResponse is the response from the token endpoint of an OpenID Connect provider
+type oidcTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// jsonWebKey is an RSA key from the key set of an OpenID Connect provider
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+var oidcProviders = struct {
+	sync.Mutex
+	discovered map[string]*oidcProvider
+}{discovered: map[string]*oidcProvider{}}
+
+// oidcLoginHandler processes the login for an OpenID Connect provider, using the authorization code flow
+func oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	provider, err := discoverOIDCProvider(datastore.Environ.Config.OIDCIssuer)
+	if err != nil {
+		log.Printf("Error discovering the OpenID Connect provider: %v", err)
+		replyHTTPError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	if r.Form.Get("code") == "" && r.Form.Get("error") == "" {
+		oidcRedirect(w, r, provider)
+		return
+	}
+
+	claims, err := oidcVerifyResponse(w, r, provider)
+	if err != nil {
+		// A mangled OpenID Connect response is suspicious, so leave a nasty response
+		log.Printf("Error verifying the OpenID Connect response: %v", err)
+		replyHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Check we have the mandatory claims in the response
+	username := stringClaim(claims, oidcUsernameClaim())
+	if len(username) == 0 {
+		log.Printf("The '%s' claim is missing from the OpenID Connect response", oidcUsernameClaim())
+		http.Redirect(w, r, "/notfound", http.StatusTemporaryRedirect)
+		return
+	}
+
+	// The username claim may be changed at the provider, so an existing user must be bound to the
+	// same identity before the user is updated from the role mappings
+	identity := stringClaim(claims, "iss") + "#" + stringClaim(claims, "sub")
+	if existing, err := datastore.Environ.DB.GetUserByUsername(username); err == nil {
+		if !bindOIDCIdentity(w, existing, identity) {
+			return
+		}
+	}
+
+	// Create or update the user from the role mappings of the user's groups
+	if err := provisionUser(username, stringClaim(claims, "name"), stringClaim(claims, "email"), groupsClaim(claims)); err != nil {
+		log.Printf("Error provisioning user %v: %v\n", username, err)
+		replyHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	User, ok := getLoginUser(w, r, username)
+	if !ok {
+		return
+	}
+
+	// Bind a user that has been created from the role mappings
+	if !bindOIDCIdentity(w, User, identity) {
+		return
+	}
+
+	// Build the JWT
+	jwtToken, err := newSessionJWT(username, stringClaim(claims, "name"), stringClaim(claims, "email"), identity, User.Role)
+	completeLogin(w, r, jwtToken, err)
+}
+
+// bindOIDCIdentity binds the user to the identity on the user's first login, and refuses the login
+// when the user is bound to a different identity
+func bindOIDCIdentity(w http.ResponseWriter, user datastore.User, identity string) bool {
+	ok, err := datastore.Environ.DB.BindUserOIDCIdentity(user.ID, identity)
+	if err != nil {
+		log.Printf("Error binding user %v to the OpenID Connect identity: %v\n", user.Username, err)
+		replyHTTPError(w, http.StatusInternalServerError, err)
+		return false
+	}
+	if !ok {
+		err = fmt.Errorf("the user '%s' belongs to a different OpenID Connect identity", user.Username)
+		log.Printf("Error logging in: %v", err)
+		replyHTTPError(w, http.StatusForbidden, err)
+		return false
+	}
+	return true
+}
+
+// oidcRedirect redirects to the OpenID Connect provider to log in, keeping the state and nonce of
+// the login in a cookie
+func oidcRedirect(w http.ResponseWriter, r *http.Request, provider *oidcProvider) {
+	state, err := randomString()
+	if err != nil {
+		replyHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	nonce, err := randomString()
+	if err != nil {
+		replyHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state + ":" + nonce,
+		Path:     "/login",
+		MaxAge:   oidcStateMaxAge,
+		HttpOnly: true,
+		Secure:   datastore.Environ.Config.URLScheme == "https",
+	})
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", datastore.Environ.Config.OIDCClientID)
+	query.Set("redirect_uri", oidcRedirectURI())
+	query.Set("scope", strings.Join(oidcScopes(), " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+
+	http.Redirect(w, r, provider.AuthorizationEndpoint+"?"+query.Encode(), http.StatusFound)
+}
+
+// oidcVerifyResponse checks the response from the OpenID Connect provider against the state of
+// the login, exchanges the authorization code and verifies the ID token. The claims of the ID
+// token are returned, along with the user info claims when the username claim is not in the ID token
+func oidcVerifyResponse(w http.ResponseWriter, r *http.Request, provider *oidcProvider) (jwt.MapClaims, error) {
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		return nil, errors.New("the login state is missing")
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/login", MaxAge: -1, HttpOnly: true})
+
+	parts := strings.SplitN(cookie.Value, ":", 2)
+	if len(parts) != 2 || subtle.ConstantTimeCompare([]byte(parts[0]), []byte(r.Form.Get("state"))) != 1 {
+		return nil, errors.New("the login state does not match")
+	}
+
+	if e := r.Form.Get("error"); len(e) > 0 {
+		return nil, fmt.Errorf("the login was refused: %s %s", e, r.Form.Get("error_description"))
+	}
+
+	tokens, err := provider.exchangeCode(r.Form.Get("code"))
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := provider.verifyIDToken(tokens.IDToken, parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := claims[oidcUsernameClaim()]; ok || len(provider.UserinfoEndpoint) == 0 {
+		return claims, nil
+	}
+
+	info, err := provider.userinfo(tokens.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	if stringClaim(info, "sub") != stringClaim(claims, "sub") {
+		return nil, errors.New("the user info is for a different user")
+	}
+	for k, v := range info {
+		if _, ok := claims[k]; !ok {
+			claims[k] = v
+		}
+	}
+	return claims, nil
+}
+
+// discoverOIDCProvider fetches the discovery document of the OpenID Connect provider. The provider
+// is cached once it is discovered
+func discoverOIDCProvider(issuer string) (*oidcProvider, error) {
+	if len(issuer) == 0 {
+		return nil, errors.New("the OpenID Connect issuer is not configured")
+	}
+
+	oidcProviders.Lock()
+	defer oidcProviders.Unlock()
+
+	if p, ok := oidcProviders.discovered[issuer]; ok {
+		return p, nil
+	}
+
+	p := &oidcProvider{}
+	if err := getJSON(strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", "", p); err != nil {
+		return nil, err
+	}
+	if p.Issuer != issuer {
+		return nil, fmt.Errorf("the issuer '%s' of the discovery document does not match '%s'", p.Issuer, issuer)
+	}
+	if len(p.AuthorizationEndpoint) == 0 || len(p.TokenEndpoint) == 0 || len(p.JWKSURI) == 0 {
+		return nil, errors.New("the discovery document is missing the provider endpoints")
+	}
+
+	oidcProviders.discovered[issuer] = p
+	return p, nil
+}
+
+// exchangeCode exchanges the authorization code for the ID and access tokens
+func (p *oidcProvider) exchangeCode(code string) (oidcTokenResponse, error) {
+	tokens := oidcTokenResponse{}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", oidcRedirectURI())
+
+	req, err := http.NewRequest("POST", p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return tokens, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(datastore.Environ.Config.OIDCClientID), url.QueryEscape(datastore.Environ.Config.OIDCClientSecret))
+
+	resp, err := oidcClient.Do(req)
+	if err != nil {
+		return tokens, fmt.Errorf("error exchanging the authorization code: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return tokens, fmt.Errorf("error exchanging the authorization code: %v", err)
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return tokens, fmt.Errorf("error exchanging the authorization code: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || len(tokens.Error) > 0 {
+		return tokens, fmt.Errorf("error exchanging the authorization code: %d %s %s", resp.StatusCode, tokens.Error, tokens.ErrorDescription)
+	}
+	if len(tokens.IDToken) == 0 {
+		return tokens, errors.New("the ID token is missing from the token response")
+	}
+	return tokens, nil
+}
+
+// verifyIDToken checks the signature of the ID token, using the provider's key set, and its
+// issuer, audience, expiry and nonce
+func (p *oidcProvider) verifyIDToken(idToken, nonce string) (jwt.MapClaims, error) {
+	keys, err := p.keys()
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := jwt.Parse(idToken, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		kid, _ := t.Header["kid"].(string)
+		if key, ok := keys[kid]; ok {
+			return key, nil
+		}
+		if len(kid) == 0 && len(keys) == 1 {
+			for _, key := range keys {
+				return key, nil
+			}
+		}
+		return nil, fmt.Errorf("cannot find the signing key '%s'", kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %v", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid ID token claims")
+	}
+	if stringClaim(claims, "iss") != p.Issuer {
+		return nil, errors.New("the ID token is from a different issuer")
+	}
+	if !hasAudience(claims, datastore.Environ.Config.OIDCClientID) {
+		return nil, errors.New("the ID token is for a different client")
+	}
+	if _, ok := claims[StandardClaimExpiresAt]; !ok {
+		return nil, errors.New("the ID token has no expiry time")
+	}
+	if subtle.ConstantTimeCompare([]byte(stringClaim(claims, "nonce")), []byte(nonce)) != 1 {
+		return nil, errors.New("the ID token nonce does not match")
+	}
+	return claims, nil
+}
+
+// keys fetches the RSA keys from the key set of the provider
+func (p *oidcProvider) keys() (map[string]*rsa.PublicKey, error) {
+	keySet := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+	if err := getJSON(p.JWKSURI, "", &keySet); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range keySet.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signing key '%s': %v", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signing key '%s': %v", k.Kid, err)
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	return keys, nil
+}
+
+// userinfo fetches the claims of the user from the user info endpoint of the provider
+func (p *oidcProvider) userinfo(accessToken string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	err := getJSON(p.UserinfoEndpoint, accessToken, &claims)
+	return claims, err
+}
+
+func getJSON(u, accessToken string, v interface{}) error {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if len(accessToken) > 0 {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	resp, err := oidcClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error fetching %s: %v", u, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error fetching %s: %s", u, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("error fetching %s: %v", u, err)
+	}
+	return nil
+}
+
+func hasAudience(claims jwt.MapClaims, clientID string) bool {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok && s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func stringClaim(claims jwt.MapClaims, name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
+
+// groupsClaim returns the groups of the user, from a list or a space-separated claim
+func groupsClaim(claims jwt.MapClaims) []string {
+	name := datastore.Environ.Config.OIDCGroupsClaim
+	if len(name) == 0 {
+		name = defaultOIDCGroupsClaim
+	}
+
+	switch groups := claims[name].(type) {
+	case string:
+		return strings.Fields(groups)
+	case []interface{}:
+		list := []string{}
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func oidcRedirectURI() string {
+	u := url.URL{Scheme: datastore.Environ.Config.URLScheme, Host: datastore.Environ.Config.URLHost, Path: "/login"}
+	return u.String()
+}
+
+func oidcScopes() []string {
+	scopes := datastore.Environ.Config.OIDCScopes
+	if len(scopes) == 0 {
+		scopes = defaultOIDCScopes
+	}
+	// The openid scope is needed to get an ID token
+	list := strings.FieldsFunc(scopes, isComma)
+	for _, s := range list {
+		if s == "openid" {
+			return list
+		}
+	}
+	return append([]string{"openid"}, list...)
+}
+
+func oidcUsernameClaim() string {
+	if len(datastore.Environ.Config.OIDCUsernameClaim) == 0 {
+		return defaultOIDCUsernameClaim
+	}
+	return datastore.Environ.Config.OIDCUsernameClaim
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.New("Error generating a random string")
+	}
+	return hex.EncodeToString(b), nil
+}
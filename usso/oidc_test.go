@@ -0,0 +1,342 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package usso
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/config"
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// mockOIDCProvider is a local OpenID Connect provider that issues an ID token for a set of claims
+type mockOIDCProvider struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	claims   jwt.MapClaims
+	userinfo jwt.MapClaims
+	nonce    string
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Error generating the provider key: %v", err)
+	}
+	p := &mockOIDCProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcProvider{
+			Issuer:                p.server.URL,
+			AuthorizationEndpoint: p.server.URL + "/authorize",
+			TokenEndpoint:         p.server.URL + "/token",
+			UserinfoEndpoint:      p.server.URL + "/userinfo",
+			JWKSURI:               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		e := big.NewInt(int64(key.PublicKey.E)).Bytes()
+		json.NewEncoder(w).Encode(map[string][]jsonWebKey{"keys": {{
+			Kty: "RSA",
+			Kid: "test-key",
+			N:   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(e),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "serial-vault" || secret != "client-secret" || r.FormValue("code") != "valid-code" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(oidcTokenResponse{Error: "invalid_grant"})
+			return
+		}
+
+		claims := jwt.MapClaims{"nonce": p.nonce}
+		for k, v := range p.claims {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test-key"
+		idToken, _ := token.SignedString(p.key)
+		json.NewEncoder(w).Encode(oidcTokenResponse{AccessToken: "access-token", IDToken: idToken})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(p.userinfo)
+	})
+	p.server = httptest.NewServer(mux)
+
+	p.claims = jwt.MapClaims{
+		"iss":                p.server.URL,
+		"sub":                "1234",
+		"aud":                "serial-vault",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"preferred_username": "sv",
+		"name":               "Simon Vault",
+		"email":              "sv@example.com",
+	}
+
+	config := config.Settings{
+		JwtSecret:        "SomeTestSecretValue",
+		URLScheme:        "https",
+		URLHost:          "serial-vault",
+		AuthProvider:     AuthProviderOIDC,
+		OIDCIssuer:       p.server.URL,
+		OIDCClientID:     "serial-vault",
+		OIDCClientSecret: "client-secret",
+	}
+	datastore.Environ = &datastore.Env{DB: &datastore.MockDB{}, Config: config}
+	return p
+}
+
+// login redirects to the provider and returns the state cookie and the state
+func (p *mockOIDCProvider) login(t *testing.T) (*http.Cookie, string) {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/login", nil)
+	http.HandlerFunc(LoginHandler).ServeHTTP(w, r)
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected HTTP status '302', got: %v", w.Code)
+	}
+
+	u, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("Error Parsing the redirect URL: %v", err)
+	}
+	if !strings.HasPrefix(u.String(), p.server.URL+"/authorize?") {
+		t.Errorf("Unexpected redirect URL: %v", u)
+	}
+	if u.Query().Get("redirect_uri") != "https://serial-vault/login" {
+		t.Errorf("Unexpected redirect URI: %v", u.Query().Get("redirect_uri"))
+	}
+	if u.Query().Get("scope") != "openid profile email" {
+		t.Errorf("Unexpected scopes: %v", u.Query().Get("scope"))
+	}
+	p.nonce = u.Query().Get("nonce")
+
+	cookies := (&http.Response{Header: w.Header()}).Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcStateCookie {
+		t.Fatalf("Expected the state cookie, got: %v", cookies)
+	}
+	return cookies[0], u.Query().Get("state")
+}
+
+// callback sends the response from the provider to the login handler
+func (p *mockOIDCProvider) callback(cookie *http.Cookie, query string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/login?"+query, nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	http.HandlerFunc(LoginHandler).ServeHTTP(w, r)
+	return w
+}
+
+func TestOIDCLoginHandler(t *testing.T) {
+	p := newMockOIDCProvider(t)
+	defer p.server.Close()
+
+	cookie, state := p.login(t)
+	w := p.callback(cookie, "code=valid-code&state="+state)
+
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("Expected HTTP status '307', got: %v", w.Code)
+	}
+	if w.Header().Get("Location") != "/" {
+		t.Errorf("Expected redirect to / but got: %v", w.Header().Get("Location"))
+	}
+
+	jwtToken, err := JWTExtractor(&http.Request{Header: w.Header()})
+	if err != nil {
+		t.Fatalf("Error getting the JWT cookie: %v", err)
+	}
+	token, err := VerifyJWT(jwtToken)
+	if err != nil {
+		t.Fatalf("Error validating JWT: %v", err)
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	if claims[ClaimsUsername] != "sv" || claims[ClaimsName] != "Simon Vault" || claims[ClaimsEmail] != "sv@example.com" {
+		t.Errorf("Unexpected JWT claims: %v", claims)
+	}
+	if int(claims[ClaimsRole].(float64)) != datastore.Admin {
+		t.Errorf("Expected the admin role, got: %v", claims[ClaimsRole])
+	}
+	if claims[ClaimsIdentity] != p.server.URL+"#1234" {
+		t.Errorf("Unexpected identity: %v", claims[ClaimsIdentity])
+	}
+}
+
+func TestOIDCLoginHandlerUsernameClaim(t *testing.T) {
+	p := newMockOIDCProvider(t)
+	defer p.server.Close()
+
+	// The username claim is fetched from the user info when it is not in the ID token
+	datastore.Environ.Config.OIDCUsernameClaim = "nickname"
+	p.userinfo = jwt.MapClaims{"sub": "1234", "nickname": "user1"}
+
+	cookie, state := p.login(t)
+	w := p.callback(cookie, "code=valid-code&state="+state)
+
+	if w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") != "/" {
+		t.Fatalf("Expected redirect to /, got: %v %v", w.Code, w.Header().Get("Location"))
+	}
+	jwtToken, _ := JWTExtractor(&http.Request{Header: w.Header()})
+	token, err := VerifyJWT(jwtToken)
+	if err != nil {
+		t.Fatalf("Error validating JWT: %v", err)
+	}
+	if token.Claims.(jwt.MapClaims)[ClaimsUsername] != "user1" {
+		t.Errorf("Unexpected username: %v", token.Claims.(jwt.MapClaims)[ClaimsUsername])
+	}
+
+	// The user info must be for the same user
+	p.userinfo = jwt.MapClaims{"sub": "5678", "nickname": "user1"}
+	cookie, state = p.login(t)
+	w = p.callback(cookie, "code=valid-code&state="+state)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected HTTP status '400', got: %v", w.Code)
+	}
+}
+
+func TestOIDCLoginHandlerIdentity(t *testing.T) {
+	p := newMockOIDCProvider(t)
+	defer p.server.Close()
+
+	// The user is bound to the identity of the first login
+	cookie, state := p.login(t)
+	w := p.callback(cookie, "code=valid-code&state="+state)
+	if w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") != "/" {
+		t.Fatalf("Expected redirect to /, got: %v %v", w.Code, w.Header().Get("Location"))
+	}
+
+	// Another identity that claims the same username is refused
+	p.claims["sub"] = "5678"
+	cookie, state = p.login(t)
+	w = p.callback(cookie, "code=valid-code&state="+state)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected HTTP status '403', got: %v", w.Code)
+	}
+	if _, err := JWTExtractor(&http.Request{Header: w.Header()}); err == nil {
+		t.Error("Expected no JWT cookie")
+	}
+
+	// The bound identity can log in again
+	p.claims["sub"] = "1234"
+	cookie, state = p.login(t)
+	w = p.callback(cookie, "code=valid-code&state="+state)
+	if w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") != "/" {
+		t.Errorf("Expected redirect to /, got: %v %v", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestOIDCLoginHandlerBadUser(t *testing.T) {
+	p := newMockOIDCProvider(t)
+	defer p.server.Close()
+
+	tests := []jwt.MapClaims{
+		{"preferred_username": "unknown"},
+		{"preferred_username": ""},
+	}
+
+	for _, claims := range tests {
+		for k, v := range claims {
+			p.claims[k] = v
+		}
+
+		cookie, state := p.login(t)
+		w := p.callback(cookie, "code=valid-code&state="+state)
+
+		if w.Code != http.StatusTemporaryRedirect {
+			t.Errorf("Expected HTTP status '307', got: %v", w.Code)
+		}
+		if w.Header().Get("Location") != "/notfound" {
+			t.Errorf("Expected redirect to /notfound but got: %v", w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestOIDCLoginHandlerInvalid(t *testing.T) {
+	p := newMockOIDCProvider(t)
+	defer p.server.Close()
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		query  string
+		cookie bool
+	}{
+		{"no state cookie", nil, "code=valid-code&state=%s", false},
+		{"wrong state", nil, "code=valid-code&state=invalid", true},
+		{"refused", nil, "error=access_denied&state=%s", true},
+		{"invalid code", nil, "code=invalid&state=%s", true},
+		{"wrong issuer", jwt.MapClaims{"iss": "https://other"}, "code=valid-code&state=%s", true},
+		{"wrong audience", jwt.MapClaims{"aud": "other"}, "code=valid-code&state=%s", true},
+		{"expired", jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}, "code=valid-code&state=%s", true},
+		{"wrong nonce", jwt.MapClaims{"nonce": "invalid"}, "code=valid-code&state=%s", true},
+	}
+
+	for _, tt := range tests {
+		p.claims["iss"] = p.server.URL
+		p.claims["aud"] = "serial-vault"
+		p.claims["exp"] = time.Now().Add(time.Hour).Unix()
+		delete(p.claims, "nonce")
+		for k, v := range tt.claims {
+			p.claims[k] = v
+		}
+
+		cookie, state := p.login(t)
+		if !tt.cookie {
+			cookie = nil
+		}
+		w := p.callback(cookie, strings.Replace(tt.query, "%s", state, 1))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected HTTP status '400', got: %v", tt.name, w.Code)
+		}
+	}
+}
+
+func TestOIDCScopes(t *testing.T) {
+	datastore.Environ = &datastore.Env{Config: config.Settings{OIDCScopes: "profile,groups"}}
+	if scopes := strings.Join(oidcScopes(), " "); scopes != "openid profile groups" {
+		t.Errorf("Unexpected scopes: %v", scopes)
+	}
+
+	datastore.Environ.Config.OIDCScopes = "email,openid"
+	if scopes := strings.Join(oidcScopes(), " "); scopes != "email openid" {
+		t.Errorf("Unexpected scopes: %v", scopes)
+	}
+}
@@ -51,8 +51,12 @@ func replyHTTPError(w http.ResponseWriter, returnCode int, err error) {
 	errorTemplate.Execute(w, err)
 }
 
-// LoginHandler processes the login for Ubuntu SSO
+// LoginHandler processes the login for Ubuntu SSO, or for the OpenID Connect provider when it is configured
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
+	if datastore.Environ.Config.AuthProvider == AuthProviderOIDC {
+		oidcLoginHandler(w, r)
+		return
+	}
 
 	r.ParseForm()
 
@@ -65,7 +69,7 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Form.Get("openid.ns") == "" {
 		req := openid.Request{
 			ReturnTo:     url.String(),
-			Teams:        strings.FieldsFunc(teams, isComma),
+			Teams:        append(strings.FieldsFunc(teams, isComma), mappedGroups()...),
 			SRegRequired: strings.FieldsFunc(required, isComma),
 			SRegOptional: strings.FieldsFunc(optional, isComma),
 		}
@@ -90,23 +94,46 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Create or update the user from the role mappings of the user's teams
+	if err := provisionUser(username, fullname, resp.SReg["email"], resp.Teams); err != nil {
+		log.Printf("Error provisioning user %v: %v\n", username, err)
+		replyHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	User, ok := getLoginUser(w, r, username)
+	if !ok {
+		return
+	}
+
+	// Build the JWT
+	jwtToken, err := NewJWTToken(resp, User.Role)
+	completeLogin(w, r, jwtToken, err)
+}
+
+// getLoginUser fetches the user that is logging in. The user is redirected to the not-found page
+// when they cannot log in
+func getLoginUser(w http.ResponseWriter, r *http.Request, username string) (datastore.User, bool) {
 	User, err := datastore.Environ.DB.GetUserByUsername(username)
 	if err != nil {
 		// Cannot find the user, so redirect to the login page
 		log.Printf("Error retrieving user from datastore: %v\n", err)
 		http.Redirect(w, r, "/notfound", http.StatusTemporaryRedirect)
-		return
+		return User, false
 	}
 
 	// verify role value is valid
 	if User.Role != datastore.Standard && User.Role != datastore.Admin && User.Role != datastore.Superuser {
 		log.Printf("Role obtained from database for user %v has not a valid value: %v\n", username, User.Role)
 		http.Redirect(w, r, "/notfound", http.StatusTemporaryRedirect)
-		return
+		return User, false
 	}
 
-	// Build the JWT
-	jwtToken, err := NewJWTToken(resp, User.Role)
+	return User, true
+}
+
+// completeLogin sets the cookie with the JWT of the logged-in user and redirects to the homepage
+func completeLogin(w http.ResponseWriter, r *http.Request, jwtToken string, err error) {
 	if err != nil {
 		// Unexpected that this should occur, so leave the detailed response
 		log.Printf("Error creating the JWT: %v", err)
@@ -131,25 +158,23 @@ var errorTemplate = template.Must(template.New("failure").Parse(`<html>
 </html>
 `))
 
-// LogoutHandler logs the user out by removing the cookie and the JWT authorization header
+// LogoutHandler logs the user out by revoking the session, and removing the cookie and the JWT authorization header
 func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 
+	// Revoke the session, so the JWT is no longer accepted
+	revokeSession(r)
+
 	// Remove the authorization header with contains the bearer token
 	w.Header().Del("Authorization")
 
 	// Create a new invalid token with an unauthorized user
-	jwtToken, err := createJWT("INVALID", "Not Logged-In", "", "", 0, 0)
+	jwtToken, err := createJWT("INVALID", "Not Logged-In", "", "", 0, "", 0)
 	if err != nil {
 		log.Println("Error logging out:", err.Error())
 	}
 
 	// Update the cookie with the invalid token and expired date
-	c, err := r.Cookie(JWTCookie)
-	if err != nil {
-		log.Println("Error logging out:", err.Error())
-	}
-	c.Value = jwtToken
-	c.Expires = time.Now().AddDate(0, 0, -1)
+	c := &http.Cookie{Name: JWTCookie, Value: jwtToken, Expires: time.Now().AddDate(0, 0, -1), HttpOnly: true}
 
 	// Set the bearer token and the cookie
 	http.SetCookie(w, c)
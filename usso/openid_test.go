@@ -229,3 +229,36 @@ func verifySuccess(requestURL string) (*openid.Response, error) {
 func verifyFail(requestURL string) (*openid.Response, error) {
 	return nil, errors.New("MOCK error from OpenID verification")
 }
+
+func TestLogoutHandlerRevokesSession(t *testing.T) {
+	datastore.Environ = &datastore.Env{DB: &datastore.MockDB{}, Config: config.Settings{JwtSecret: "SomeTestSecretValue"}}
+
+	jwtToken, err := newSessionJWT("user1", "Rigoberto Picaporte", "", "id", datastore.Standard)
+	if err != nil {
+		t.Fatalf("Error creating JWT: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/logout", nil)
+	r.AddCookie(&http.Cookie{Name: JWTCookie, Value: jwtToken})
+	http.HandlerFunc(LogoutHandler).ServeHTTP(w, r)
+
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Errorf("Expected HTTP status '307', got: %v", w.Code)
+	}
+	if _, _, err := VerifySession(jwtToken); err == nil {
+		t.Error("Expected the session to be revoked")
+	}
+}
+
+func TestLogoutHandlerNoCookie(t *testing.T) {
+	datastore.Environ = &datastore.Env{DB: &datastore.MockDB{}, Config: config.Settings{JwtSecret: "SomeTestSecretValue"}}
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/logout", nil)
+	http.HandlerFunc(LogoutHandler).ServeHTTP(w, r)
+
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Errorf("Expected HTTP status '307', got: %v", w.Code)
+	}
+}
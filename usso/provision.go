@@ -0,0 +1,105 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package usso
+
+import (
+	"strings"
+
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/log"
+)
+
+// provisionUser creates or updates the user that is logging in, using the role mappings of the
+// user's teams or groups. A provisioned user loses access when they are no longer in a mapped
+// group. Nothing is changed when there are no role mappings
+func provisionUser(username, name, email string, groups []string) error {
+	if len(datastore.Environ.Config.RoleMappings) == 0 {
+		return nil
+	}
+
+	role, accounts, ok := mapGroups(groups)
+	if !ok {
+		user, err := datastore.Environ.DB.GetUserByUsername(username)
+		if err != nil || !user.Provisioned || user.Role == datastore.Invalid {
+			return nil
+		}
+
+		log.Printf("Removing the access of user %v, who is no longer in a mapped group\n", username)
+		return datastore.Environ.DB.DeprovisionUser(user.ID)
+	}
+
+	if len(name) == 0 {
+		name = username
+	}
+	user := datastore.User{
+		Username: username,
+		Name:     name,
+		Email:    email,
+		Role:     role,
+		Accounts: datastore.BuildAccountsFromAuthorityIDs(accounts),
+	}
+	_, err := datastore.Environ.DB.ProvisionUser(user)
+	return err
+}
+
+// mapGroups returns the role and accounts that the role mappings give to the teams or groups. The
+// highest role of the matching mappings is used, with the accounts of all of them
+func mapGroups(groups []string) (int, []string, bool) {
+	member := map[string]bool{}
+	for _, g := range groups {
+		member[g] = true
+	}
+
+	role := datastore.Invalid
+	accounts := []string{}
+	seen := map[string]bool{}
+	for _, m := range datastore.Environ.Config.RoleMappings {
+		if !member[m.Group] {
+			continue
+		}
+
+		r, ok := datastore.RoleID[strings.ToLower(m.Role)]
+		if !ok || r == datastore.Invalid {
+			log.Printf("The role '%s' of the mapping for group '%s' is invalid\n", m.Role, m.Group)
+			continue
+		}
+		if r > role {
+			role = r
+		}
+
+		for _, a := range m.Accounts {
+			if !seen[a] {
+				seen[a] = true
+				accounts = append(accounts, a)
+			}
+		}
+	}
+
+	return role, accounts, role != datastore.Invalid
+}
+
+// mappedGroups returns the groups of the role mappings
+func mappedGroups() []string {
+	groups := []string{}
+	for _, m := range datastore.Environ.Config.RoleMappings {
+		groups = append(groups, m.Group)
+	}
+	return groups
+}
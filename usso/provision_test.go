@@ -0,0 +1,208 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package usso
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/CanonicalLtd/serial-vault/config"
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/dgrijalva/jwt-go"
+)
+
+var testRoleMappings = []config.RoleMapping{
+	{Group: "sv-standard", Role: "standard", Accounts: []string{"system", "brand1"}},
+	{Group: "sv-admins", Role: "admin", Accounts: []string{"system"}},
+	{Group: "sv-typo", Role: "admni", Accounts: []string{"brand2"}},
+}
+
+// provisionMockDB records the users that are provisioned and deprovisioned
+type provisionMockDB struct {
+	datastore.MockDB
+	users         map[string]datastore.User
+	deprovisioned []int
+}
+
+func newProvisionMockDB() *provisionMockDB {
+	return &provisionMockDB{users: map[string]datastore.User{
+		"sv":   {ID: 3, Username: "sv", Name: "Simon Vault", Email: "sv@example.com", Role: datastore.Admin},
+		"gone": {ID: 5, Username: "gone", Name: "Gone", Email: "gone@example.com", Role: datastore.Admin, Provisioned: true},
+	}}
+}
+
+func (db *provisionMockDB) GetUserByUsername(username string) (datastore.User, error) {
+	u, ok := db.users[username]
+	if !ok {
+		return u, sql.ErrNoRows
+	}
+	return u, nil
+}
+
+func (db *provisionMockDB) ProvisionUser(user datastore.User) (int, error) {
+	if u, ok := db.users[user.Username]; ok {
+		user.ID = u.ID
+	} else {
+		user.ID = 10 + len(db.users)
+	}
+	user.Provisioned = true
+	db.users[user.Username] = user
+	return user.ID, nil
+}
+
+func (db *provisionMockDB) DeprovisionUser(userID int) error {
+	db.deprovisioned = append(db.deprovisioned, userID)
+	for k, u := range db.users {
+		if u.ID == userID {
+			u.Role = datastore.Invalid
+			u.Accounts = nil
+			db.users[k] = u
+		}
+	}
+	return nil
+}
+
+func TestMapGroups(t *testing.T) {
+	datastore.Environ = &datastore.Env{Config: config.Settings{RoleMappings: testRoleMappings}}
+
+	tests := []struct {
+		groups   []string
+		role     int
+		accounts []string
+		ok       bool
+	}{
+		{[]string{"sv-standard"}, datastore.Standard, []string{"system", "brand1"}, true},
+		{[]string{"sv-admins", "sv-standard", "other"}, datastore.Admin, []string{"system", "brand1"}, true},
+		{[]string{"sv-typo"}, datastore.Invalid, []string{}, false},
+		{[]string{"other"}, datastore.Invalid, []string{}, false},
+		{nil, datastore.Invalid, []string{}, false},
+	}
+
+	for _, tt := range tests {
+		role, accounts, ok := mapGroups(tt.groups)
+		if role != tt.role || ok != tt.ok || !reflect.DeepEqual(accounts, tt.accounts) {
+			t.Errorf("mapGroups(%v) = %v, %v, %v; want %v, %v, %v", tt.groups, role, accounts, ok, tt.role, tt.accounts, tt.ok)
+		}
+	}
+}
+
+func TestOIDCLoginHandlerProvision(t *testing.T) {
+	p := newMockOIDCProvider(t)
+	defer p.server.Close()
+
+	db := newProvisionMockDB()
+	datastore.Environ.DB = db
+	datastore.Environ.Config.RoleMappings = testRoleMappings
+
+	tests := []struct {
+		username string
+		groups   interface{}
+		location string
+		role     int
+		accounts int
+	}{
+		// A new user is created from the mapped groups
+		{"newuser", []interface{}{"sv-admins", "sv-standard"}, "/", datastore.Admin, 2},
+		// The user is updated when the groups change
+		{"newuser", "sv-standard other", "/", datastore.Standard, 2},
+		// A provisioned user loses access when they are no longer in a mapped group
+		{"newuser", []interface{}{"other"}, "/notfound", datastore.Invalid, 0},
+		{"gone", nil, "/notfound", datastore.Invalid, 0},
+		// A user that was created by hand is not changed
+		{"sv", nil, "/", datastore.Admin, 0},
+	}
+
+	for _, tt := range tests {
+		p.claims["preferred_username"] = tt.username
+		p.claims["groups"] = tt.groups
+
+		cookie, state := p.login(t)
+		w := p.callback(cookie, "code=valid-code&state="+state)
+
+		if w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") != tt.location {
+			t.Errorf("%s: expected redirect to %s, got: %v %v", tt.username, tt.location, w.Code, w.Header().Get("Location"))
+		}
+
+		user := db.users[tt.username]
+		if user.Role != tt.role || len(user.Accounts) != tt.accounts {
+			t.Errorf("%s: expected role %d with %d accounts, got: %v", tt.username, tt.role, tt.accounts, user)
+		}
+
+		if tt.location == "/" {
+			jwtToken, _ := JWTExtractor(&http.Request{Header: w.Header()})
+			token, err := VerifyJWT(jwtToken)
+			if err != nil {
+				t.Fatalf("Error validating JWT: %v", err)
+			}
+			if int(token.Claims.(jwt.MapClaims)[ClaimsRole].(float64)) != tt.role {
+				t.Errorf("%s: unexpected JWT role: %v", tt.username, token.Claims.(jwt.MapClaims)[ClaimsRole])
+			}
+		}
+	}
+
+	if !reflect.DeepEqual(db.deprovisioned, []int{12, 5}) {
+		t.Errorf("Unexpected deprovisioned users: %v", db.deprovisioned)
+	}
+}
+
+func TestLoginHandlerProvisionTeams(t *testing.T) {
+	// Response parameters from OpenID login
+	const url = "/login?openid.ns=http://specs.openid.net/auth/2.0&openid.mode=id_res&openid.op_endpoint=https://login.ubuntu.com/%2Bopenid&openid.claimed_id=https://login.ubuntu.com/%2Bid/AAAAAA&openid.identity=https://login.ubuntu.com/%2Bid/AAAAAA&openid.return_to=http://return.to&openid.response_nonce=2005-05-15T17:11:51ZUNIQUE&openid.assoc_handle=1&openid.signed=op_endpoint,return_to,response_nonce,assoc_handle,claimed_id,identity,sreg.email,sreg.fullname&openid.sig=AAAA&openid.ns.sreg=http://openid.net/extensions/sreg/1.1&openid.sreg.email=a@example.org&openid.sreg.fullname=A&openid.sreg.nickname=a"
+
+	// Mock the database and OpenID verification, with the user in the mapped team
+	db := newProvisionMockDB()
+	config := config.Settings{JwtSecret: "SomeTestSecretValue", RoleMappings: []config.RoleMapping{
+		{Group: "ce-web-logs", Role: "standard", Accounts: []string{"system"}},
+	}}
+	datastore.Environ = &datastore.Env{DB: db, Config: config}
+	verify = verifySuccess
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", url, nil)
+	http.HandlerFunc(LoginHandler).ServeHTTP(w, r)
+
+	if w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") != "/" {
+		t.Errorf("Expected redirect to /, got: %v %v", w.Code, w.Header().Get("Location"))
+	}
+
+	user := db.users["a"]
+	if !user.Provisioned || user.Role != datastore.Standard || user.Name != "A" || user.Email != "a@example.org" {
+		t.Errorf("Unexpected provisioned user: %v", user)
+	}
+}
+
+func TestLoginHandlerUSSOTeams(t *testing.T) {
+	config := config.Settings{JwtSecret: "SomeTestSecretValue", RoleMappings: testRoleMappings}
+	datastore.Environ = &datastore.Env{DB: &datastore.MockDB{}, Config: config}
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/login", nil)
+	http.HandlerFunc(LoginHandler).ServeHTTP(w, r)
+
+	// The teams of the role mappings are requested from Ubuntu SSO
+	u, _ := url.Parse(w.Header().Get("Location"))
+	if teams := u.Query().Get("openid.lp.query_membership"); teams != "sv-standard,sv-admins,sv-typo" {
+		t.Errorf("Unexpected teams requested: %v", teams)
+	}
+}
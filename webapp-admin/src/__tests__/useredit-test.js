@@ -59,15 +59,13 @@ describe('user edit', function() {
 
         // Check that the form is rendered without data
         var inputs = ReactTestUtils.scryRenderedDOMComponentsWithTag(userPage, 'input');
-        expect(inputs.length).toBe(4);
+        expect(inputs.length).toBe(3);
         expect(inputs[0].value).toBe('');
         expect(inputs[0].id).toBe('username');
         expect(inputs[1].value).toBe('');
         expect(inputs[1].id).toBe('name');
         expect(inputs[2].value).toBe('');
         expect(inputs[2].id).toBe('email');
-        expect(inputs[3].value).toBe('');
-        expect(inputs[3].id).toBe('api-key');
 
         var selects = ReactTestUtils.scryRenderedDOMComponentsWithTag(userPage, 'select');
         expect(selects.length).toBe(1);
@@ -94,6 +92,27 @@ describe('user edit', function() {
         expect(ReactTestUtils.isCompositeComponent(userPage)).toBeTruthy();
     });
 
+    it('displays the API key once it is generated', function() {
+
+        // Mock the data retrieval from the API
+        var getUser = jest.fn();
+        var getAllAccounts = jest.fn();
+        UserEdit.prototype.getUser = getUser;
+        UserEdit.prototype.getAllAccounts = getAllAccounts;
+
+        // Render the component
+        var userPage = ReactTestUtils.renderIntoDocument(
+            <UserEdit params={{}} token={token} />
+        );
+        userPage.setState({apiKey: 'GeneratedAPIKey'});
+
+        // Check that only the API key is shown
+        var inputs = ReactTestUtils.scryRenderedDOMComponentsWithTag(userPage, 'input');
+        expect(inputs.length).toBe(1);
+        expect(inputs[0].id).toBe('api-key');
+        expect(inputs[0].value).toBe('GeneratedAPIKey');
+    });
+
     it('displays error with no permissions', function() {
 
         // Render the component
@@ -30,6 +30,7 @@ class ModelEdit extends Component {
             model: {'brand-id': this.props.selectedAccount.AuthorityID},
             error: null,
             hideForm: false,
+            apiKey: null,
         }
     }
 
@@ -99,6 +100,18 @@ class ModelEdit extends Component {
         this.setState({model: model});
     }
 
+    handleChangeDuplicatePolicy = (e) => {
+        var model = this.state.model;
+        model['duplicate-policy'] = e.target.value;
+        this.setState({model: model});
+    }
+
+    handleChangeMaxResigns = (e) => {
+        var model = this.state.model;
+        model['max-resigns'] = parseInt(e.target.value, 10) || 0;
+        this.setState({model: model});
+    }
+
     handleSaveClick = (e) => {
         e.preventDefault();
         var self = this;
@@ -114,13 +127,13 @@ class ModelEdit extends Component {
                 }
             });
         } else {
-            // Create a new model
+            // Create a new model. Its API key is only shown now, as only the hash is stored
             Models.create(this.state.model).then(function(response) {
                 var data = JSON.parse(response.body);
                 if (response.statusCode >= 300) {
                     self.setState({error: self.formatError(data)});
                 } else {
-                    window.location = '/models';
+                    self.setState({apiKey: data.model['api-key'], error: null});
                 }
             });
         }
@@ -152,6 +165,24 @@ class ModelEdit extends Component {
             )
         }
 
+        if (this.state.apiKey) {
+            return (
+                <div className="row">
+                    <section className="row">
+                        <h2>{this.state.title}</h2>
+                        <p>{T('api-key-once')}</p>
+                        <label htmlFor="api-key">{T('api-key')}:
+                            <input type="text" id="api-key" value={this.state.apiKey} readOnly />
+                        </label>
+                        <div>
+                            <a href='/models' className="p-button--brand">{T('close')}</a>
+                        </div>
+                    </section>
+                    <br />
+                </div>
+            )
+        }
+
         return (
             <div className="row">
                 <section className="row">
@@ -169,10 +200,13 @@ class ModelEdit extends Component {
                                     <input type="text" id="model" placeholder={T('model-description')}
                                         value={this.state.model.model} onChange={this.handleChangeModel}/>
                                 </label>
-                                <label htmlFor="model">{T('api-key')}:
-                                    <input type="text" id="api-key" placeholder={T('api-key-description')}
-                                        value={this.state.model['api-key']} onChange={this.handleChangeAPIKey}/>
-                                </label>
+                                {!this.state.model.id ?
+                                    <label htmlFor="api-key">{T('api-key')}:
+                                        <input type="text" id="api-key" placeholder={T('api-key-description')}
+                                            value={this.state.model['api-key']} onChange={this.handleChangeAPIKey}/>
+                                    </label>
+                                    : ''
+                                }
                                 <label htmlFor="keypair">{T('private-key')}:
                                     <select value={this.state.model['keypair-id']} id="keypair" onChange={this.handleChangePrivateKey}>
                                         <option />
@@ -197,6 +231,21 @@ class ModelEdit extends Component {
                                         })}
                                     </select>
                                 </label>
+                                <label htmlFor="duplicate-policy">{T('duplicate-policy')}:
+                                    <select value={this.state.model['duplicate-policy']} id="duplicate-policy" onChange={this.handleChangeDuplicatePolicy}>
+                                        <option value="allow">{T('duplicate-policy-allow')}</option>
+                                        <option value="reject">{T('duplicate-policy-reject')}</option>
+                                        <option value="same-device-key">{T('duplicate-policy-same-device-key')}</option>
+                                        <option value="max-resigns">{T('duplicate-policy-max-resigns')}</option>
+                                    </select>
+                                </label>
+                                {this.state.model['duplicate-policy'] === 'max-resigns' ?
+                                    <label htmlFor="max-resigns">{T('max-resigns')}:
+                                        <input type="number" id="max-resigns" min="0" placeholder={T('max-resigns-description')}
+                                            value={this.state.model['max-resigns']} onChange={this.handleChangeMaxResigns}/>
+                                    </label>
+                                    : ''
+                                }
                             </fieldset>
                         </form>
 
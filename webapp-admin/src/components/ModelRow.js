@@ -21,16 +21,6 @@ import {T} from './Utils'
 
 class ModelRow extends Component {
 
-    copyToClipboard = (e) => {
-        e.preventDefault()
-        const el = document.createElement('textarea');
-        el.value = e.target.getAttribute('data-key');
-        document.body.appendChild(el);
-        el.select();
-        document.execCommand('copy');
-        document.body.removeChild(el);
-    }
-
     renderActions() {
         if (this.props.model.id !== this.props.confirmDelete) {
             return (
@@ -63,13 +53,7 @@ class ModelRow extends Component {
                 <td>
                     {this.renderActions()}
                 </td>
-                <td className="overflow" title={this.props.model.model}>
-                    <button onClick={this.copyToClipboard} data-key={this.props.model['api-key']} className="p-button--neutral small" title={T('copy-api-key')}>
-                        <i className="fa fa-clipboard" data-key={this.props.model['api-key']} />
-                    </button>
-                    &nbsp;
-                    {this.props.model.model}
-                </td>
+                <td className="overflow" title={this.props.model.model}>{this.props.model.model}</td>
                 <td className="overflow" title={fingerprint} >{fingerprint}</td>
                 <td className="overflow" title={fingerprintUser} >{fingerprintUser}</td>
                 <td>{this.props.model['key-active'] && this.props.model['key-active-user'] ? <i className="fa fa-check"></i> :  <i className="fa fa-times"></i>}</td>
@@ -30,6 +30,7 @@ class UserEdit extends Component {
             user: {},
             error: null,
             hideForm: false,
+            apiKey: null,
             // TODO temporary move user.Accounts to userAccounts, as backend provides accounts for the user 
             // that way. In future this will be get in an independant call.
             assignedAccounts: [],
@@ -131,7 +132,6 @@ class UserEdit extends Component {
         requestData['name'] = user.Name
         requestData['email'] = user.Email
         requestData['role'] = user.Role
-        requestData['api_key'] = user.APIKey
         requestData['accounts'] = this.state.assignedAccounts
         return requestData
     }
@@ -152,18 +152,32 @@ class UserEdit extends Component {
                 }
             });
         } else {
-            // Create a new user
+            // Create a new user. The API key is only shown now, as only its hash is stored
             Users.create(requestData).then((response) => {
                 var data = JSON.parse(response.body);
                 if (response.statusCode >= 300) {
                     this.setState({error: this.formatError(data)});
                 } else {
-                    window.location = '/users';
+                    this.setState({apiKey: data.user.APIKey, error: null});
                 }
             });
         }
     }
 
+    handleResetAPIKey = (e) => {
+        e.preventDefault();
+
+        // The new API key is only shown now, as only its hash is stored
+        Users.resetapikey(this.state.user.ID).then((response) => {
+            var data = JSON.parse(response.body);
+            if (response.statusCode >= 300) {
+                this.setState({error: this.formatError(data)});
+            } else {
+                this.setState({apiKey: data.user.APIKey, error: null});
+            }
+        });
+    }
+
     handleClickAccount = (e) => {
         e.preventDefault();
         var acc = e.target.getAttribute('data-account');
@@ -220,6 +234,24 @@ class UserEdit extends Component {
             )
         }
 
+        if (this.state.apiKey) {
+            return (
+                <div className="row">
+                    <section className="row">
+                        <h2>{this.state.title}</h2>
+                        <p>{T('api-key-once')}</p>
+                        <label htmlFor="api-key">{T('api-key')}:
+                            <input type="text" id="api-key" value={this.state.apiKey} readOnly />
+                        </label>
+                        <div>
+                            <a href='/users' className="p-button--brand">{T('close')}</a>
+                        </div>
+                    </section>
+                    <br />
+                </div>
+            )
+        }
+
         return (
             <div className="row">
                 <section className="row">
@@ -250,10 +282,14 @@ class UserEdit extends Component {
                                         <option key="superuser" value="300">Superuser</option>
                                     </select>
                                 </label>
-                                <label htmlFor="api-key">{T('api-key')}:
-                                    <input type="text" id="api-key" placeholder={T('api-key')} 
-                                        value={this.state.user.APIKey} readOnly />
-                                </label>
+                                {this.state.user.ID ?
+                                    <label htmlFor="api-key">{T('api-key')}:
+                                        <div>
+                                            <button onClick={this.handleResetAPIKey} className="p-button--neutral">{T('reset-api-key')}</button>
+                                        </div>
+                                    </label>
+                                    : ''
+                                }
                             </fieldset>
 
                             <h3>{T('user-accounts')}</h3>
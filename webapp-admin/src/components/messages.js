@@ -32,6 +32,7 @@ var intlData = {
       "add-new-user": "Add a new user",
       "api-key": "API Key",
       "api-key-description": "API Key to sign a serial assertion request (min. 10 characters). Will be generated if blank or invalid",
+      "api-key-once": "Copy the API key now. Only its hash is stored, so it cannot be shown again",
       "architecture": "Architecture",
       "architecture-description": "The architecture of the device",
       "assertion": "Assertion",
@@ -52,7 +53,6 @@ var intlData = {
       "confirm-model-delete": "Remove this model?",
       "confirm-store-delete": "Remove this sub-store model?",
       "confirm-user-delete": "Remove this user?",
-      "copy-api-key": "Copy API key to clipboard",
       "create-assertion": "Error creating the assertion",
       "create-system-user": "Create System-User",
       "date": "Date",
@@ -64,6 +64,11 @@ var intlData = {
       "display_name": "Display Name",
       "display_name-description": "Descriptive name of the device",
       "download": "Download",
+      "duplicate-policy": "Duplicate Signing",
+      "duplicate-policy-allow": "Allow re-signing",
+      "duplicate-policy-reject": "Reject re-signing",
+      "duplicate-policy-same-device-key": "Allow re-signing with the same device-key",
+      "duplicate-policy-max-resigns": "Allow a maximum number of re-signs",
       "edit-model": "Edit Model",
       "edit-user": "Edit User",
       "email": "Email",
@@ -125,6 +130,8 @@ var intlData = {
       "login": "Login",
       "logout": "Logout",
       "makes": "Brands",
+      "max-resigns": "Maximum Re-signs",
+      "max-resigns-description": "The number of times a serial number can be re-signed",
       "model-description": "The name of the device model",
       "model": "Model",
       "modelname": "Model Name",
@@ -169,6 +176,7 @@ var intlData = {
       "remove": "Remove",
       "required-snaps": "Required Snaps",
       "required-snaps-description": "(optional) List of required snaps - enter a comma-separated list",
+      "reset-api-key": "Reset the API key",
       "reseller": "Reseller",
       "reseller-features": "Enable Reseller Features",
       "revision": "Revision",
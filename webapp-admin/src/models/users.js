@@ -41,6 +41,10 @@ var Users = {
 
 	create:  function(user) {
 		return Ajax.post(this.url, user);
+	},
+
+	resetapikey:  function(userId) {
+		return Ajax.post(this.url + '/' + userId + '/apikey', {});
 	}
 
 }
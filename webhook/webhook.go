@@ -0,0 +1,205 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/config"
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	"github.com/CanonicalLtd/serial-vault/service/log"
+)
+
+// Headers of the requests to the webhooks
+const (
+	HeaderEvent     = "X-Serial-Vault-Event"
+	HeaderDelivery  = "X-Serial-Vault-Delivery"
+	HeaderSignature = "X-Serial-Vault-Signature"
+	HeaderTimestamp = "X-Serial-Vault-Timestamp"
+)
+
+const (
+	defaultInterval    = 10
+	defaultMaxAttempts = 8
+	deliveryBatch      = 100
+	maxRetryDelay      = time.Hour
+)
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// Payload is the JSON body that is sent to a webhook for an event
+type Payload struct {
+	Event       string      `json:"event"`
+	AuthorityID string      `json:"authority-id"`
+	Created     time.Time   `json:"created"`
+	Data        interface{} `json:"data"`
+}
+
+// Notify queues an event of an account for the webhooks that subscribe to it. The event is
+// delivered in the background, so a failure to queue it is only logged
+func Notify(authorityID, event string, data interface{}) {
+	body, err := json.Marshal(Payload{Event: event, AuthorityID: authorityID, Created: time.Now().UTC(), Data: data})
+	if err != nil {
+		log.Printf("Error encoding the '%s' webhook event: %v", event, err)
+		return
+	}
+
+	if err := datastore.Environ.DB.QueueWebhookEvent(authorityID, event, string(body)); err != nil {
+		log.Printf("Error queuing the '%s' webhook event for '%s': %v", event, authorityID, err)
+	}
+}
+
+// Start starts the background delivery of the queued events
+func Start(config config.Settings) {
+	go deliver(interval(config), maxAttempts(config))
+}
+
+func interval(config config.Settings) time.Duration {
+	if config.WebhookInterval <= 0 {
+		return defaultInterval * time.Second
+	}
+	return time.Duration(config.WebhookInterval) * time.Second
+}
+
+func maxAttempts(config config.Settings) int {
+	if config.WebhookMaxAttempts <= 0 {
+		return defaultMaxAttempts
+	}
+	return config.WebhookMaxAttempts
+}
+
+// deliver periodically attempts the deliveries that are due
+func deliver(interval time.Duration, maxAttempts int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		DeliverDue(maxAttempts)
+	}
+}
+
+// DeliverDue attempts the deliveries that are due and returns the number that were delivered. Each
+// attempt is claimed first, so that several instances of the service can share the queue
+func DeliverDue(maxAttempts int) int {
+	deliveries, err := datastore.Environ.DB.ListDueWebhookDeliveries(deliveryBatch)
+	if err != nil {
+		log.Printf("Error fetching the webhook deliveries: %v", err)
+		return 0
+	}
+
+	delivered := 0
+	for _, d := range deliveries {
+		claimed, err := datastore.Environ.DB.ClaimWebhookDelivery(d, time.Now().UTC().Add(retryDelay(d.Attempts+1)))
+		if err != nil {
+			log.Printf("Error claiming the webhook delivery %d: %v", d.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		d.Attempts++
+
+		if attempt(&d, maxAttempts) {
+			delivered++
+		}
+		if err := datastore.Environ.DB.UpdateWebhookDelivery(d); err != nil {
+			log.Printf("Error updating the webhook delivery %d: %v", d.ID, err)
+		}
+	}
+	return delivered
+}
+
+// attempt sends a delivery to its webhook and records the result. A delivery that has failed on
+// its last attempt is not retried
+func attempt(d *datastore.WebhookDelivery, maxAttempts int) bool {
+	var err error
+	d.ResponseCode, err = send(*d)
+	if err == nil {
+		now := time.Now().UTC()
+		d.Status = datastore.WebhookDelivered
+		d.Delivered = &now
+		d.LastError = ""
+		return true
+	}
+
+	d.LastError = err.Error()
+	if d.Attempts >= maxAttempts {
+		d.Status = datastore.WebhookFailed
+	}
+	return false
+}
+
+// send posts the payload of a delivery to its webhook. Any response other than 2xx is a failure
+func send(d datastore.WebhookDelivery) (int, error) {
+	req, err := http.NewRequest("POST", d.URL, strings.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, d.Event)
+	req.Header.Set(HeaderDelivery, fmt.Sprint(d.ID))
+	timestamp := time.Now().Unix()
+	req.Header.Set(HeaderTimestamp, fmt.Sprint(timestamp))
+	req.Header.Set(HeaderSignature, Signature(d.Secret, timestamp, []byte(d.Payload)))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("The webhook replied with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Signature returns the signature of a payload, as it is sent in the signature header: the
+// HMAC-SHA256 of the timestamp header, a dot and the payload with the secret of the webhook. The
+// timestamp is signed so that the receiver can refuse a delivery that is replayed later
+func Signature(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryDelay is the time before the next attempt, doubling from a minute up to an hour
+func retryDelay(attempt int) time.Duration {
+	if attempt > 7 {
+		return maxRetryDelay
+	}
+	delay := time.Minute << uint(attempt-1)
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
@@ -0,0 +1,172 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017-2018 Canonical Ltd
+ * License granted by Canonical Limited
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/CanonicalLtd/serial-vault/config"
+	"github.com/CanonicalLtd/serial-vault/datastore"
+	check "gopkg.in/check.v1"
+)
+
+func TestWebhookSuite(t *testing.T) { check.TestingT(t) }
+
+type webhookSuite struct {
+	server   *httptest.Server
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+var _ = check.Suite(&webhookSuite{})
+
+func (s *webhookSuite) SetUpTest(c *check.C) {
+	datastore.Environ = &datastore.Env{DB: &datastore.MockDB{}}
+
+	s.status = http.StatusOK
+	s.requests = nil
+	s.bodies = nil
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		s.requests = append(s.requests, r)
+		s.bodies = append(s.bodies, body)
+		w.WriteHeader(s.status)
+	}))
+}
+
+func (s *webhookSuite) TearDownTest(c *check.C) {
+	s.server.Close()
+}
+
+func (s *webhookSuite) createWebhook(authorityID string, events []string, c *check.C) datastore.Webhook {
+	w, err := datastore.Environ.DB.CreateAllowedWebhook(datastore.Webhook{AuthorityID: authorityID, URL: s.server.URL, Events: events}, datastore.User{Role: datastore.Superuser})
+	c.Assert(err, check.IsNil)
+	return w
+}
+
+func (s *webhookSuite) deliveries(webhookID int, c *check.C) []datastore.WebhookDelivery {
+	deliveries, err := datastore.Environ.DB.ListAllowedWebhookDeliveries(webhookID, datastore.User{Role: datastore.Superuser})
+	c.Assert(err, check.IsNil)
+	return deliveries
+}
+
+func (s *webhookSuite) TestNotifyDelivered(c *check.C) {
+	w := s.createWebhook("notify-brand", []string{datastore.EventSerialSigned}, c)
+
+	Notify("notify-brand", datastore.EventSerialSigned, map[string]string{"serial": "A1234"})
+	Notify("notify-brand", datastore.EventKeypairDisabled, map[string]string{"key-name": "not-subscribed"})
+	Notify("other-brand", datastore.EventSerialSigned, map[string]string{"serial": "B1234"})
+
+	c.Assert(DeliverDue(3), check.Equals, 1)
+	c.Assert(s.requests, check.HasLen, 1)
+
+	r := s.requests[0]
+	c.Assert(r.Header.Get(HeaderEvent), check.Equals, datastore.EventSerialSigned)
+	timestamp, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+	c.Assert(err, check.IsNil)
+	c.Assert(r.Header.Get(HeaderSignature), check.Equals, Signature(w.Secret, timestamp, s.bodies[0]))
+
+	payload := Payload{}
+	c.Assert(json.Unmarshal(s.bodies[0], &payload), check.IsNil)
+	c.Assert(payload.Event, check.Equals, datastore.EventSerialSigned)
+	c.Assert(payload.AuthorityID, check.Equals, "notify-brand")
+	c.Assert(payload.Data, check.DeepEquals, map[string]interface{}{"serial": "A1234"})
+
+	deliveries := s.deliveries(w.ID, c)
+	c.Assert(deliveries, check.HasLen, 1)
+	c.Assert(deliveries[0].Status, check.Equals, datastore.WebhookDelivered)
+	c.Assert(deliveries[0].Attempts, check.Equals, 1)
+	c.Assert(deliveries[0].ResponseCode, check.Equals, http.StatusOK)
+	c.Assert(deliveries[0].Delivered, check.NotNil)
+
+	// A delivered event is not sent again
+	c.Assert(DeliverDue(3), check.Equals, 0)
+	c.Assert(s.requests, check.HasLen, 1)
+}
+
+func (s *webhookSuite) TestNotifyRetried(c *check.C) {
+	w := s.createWebhook("retry-brand", []string{datastore.EventSyncReceived}, c)
+	s.status = http.StatusInternalServerError
+
+	Notify("retry-brand", datastore.EventSyncReceived, map[string]string{"serial": "A1234"})
+	c.Assert(DeliverDue(2), check.Equals, 0)
+
+	deliveries := s.deliveries(w.ID, c)
+	c.Assert(deliveries[0].Status, check.Equals, datastore.WebhookPending)
+	c.Assert(deliveries[0].Attempts, check.Equals, 1)
+	c.Assert(deliveries[0].ResponseCode, check.Equals, http.StatusInternalServerError)
+	c.Assert(deliveries[0].LastError, check.Equals, "The webhook replied with status 500")
+	c.Assert(deliveries[0].NextAttempt.After(time.Now()), check.Equals, true)
+
+	// The delivery is not attempted before it is due
+	c.Assert(DeliverDue(2), check.Equals, 0)
+	c.Assert(s.requests, check.HasLen, 1)
+
+	// The delivery fails on its last attempt
+	err := datastore.Environ.DB.RetryAllowedWebhookDelivery(w.ID, deliveries[0].ID, datastore.User{Role: datastore.Superuser})
+	c.Assert(err, check.IsNil)
+	c.Assert(DeliverDue(1), check.Equals, 0)
+	deliveries = s.deliveries(w.ID, c)
+	c.Assert(deliveries[0].Status, check.Equals, datastore.WebhookFailed)
+
+	// A retried delivery is sent again
+	s.status = http.StatusNoContent
+	err = datastore.Environ.DB.RetryAllowedWebhookDelivery(w.ID, deliveries[0].ID, datastore.User{Role: datastore.Superuser})
+	c.Assert(err, check.IsNil)
+	c.Assert(DeliverDue(1), check.Equals, 1)
+	deliveries = s.deliveries(w.ID, c)
+	c.Assert(deliveries[0].Status, check.Equals, datastore.WebhookDelivered)
+	c.Assert(s.requests, check.HasLen, 3)
+}
+
+func (s *webhookSuite) TestNotifyError(c *check.C) {
+	datastore.Environ.DB = &datastore.ErrorMockDB{}
+
+	Notify("error-brand", datastore.EventSerialSigned, map[string]string{"serial": "A1234"})
+	c.Assert(DeliverDue(3), check.Equals, 0)
+	c.Assert(s.requests, check.HasLen, 0)
+}
+
+func (s *webhookSuite) TestSignature(c *check.C) {
+	c.Assert(Signature("secret", 1700000000, []byte(`{"event":"serial:signed"}`)), check.Equals, "sha256=b52597641751acd146b480768cb080c4160aefff9626acaa6873d4261e49f254")
+}
+
+func (s *webhookSuite) TestRetryDelay(c *check.C) {
+	c.Assert(retryDelay(1), check.Equals, time.Minute)
+	c.Assert(retryDelay(2), check.Equals, 2*time.Minute)
+	c.Assert(retryDelay(6), check.Equals, 32*time.Minute)
+	c.Assert(retryDelay(7), check.Equals, time.Hour)
+	c.Assert(retryDelay(100), check.Equals, time.Hour)
+}
+
+func (s *webhookSuite) TestConfig(c *check.C) {
+	c.Assert(interval(config.Settings{}), check.Equals, 10*time.Second)
+	c.Assert(interval(config.Settings{WebhookInterval: 30}), check.Equals, 30*time.Second)
+	c.Assert(maxAttempts(config.Settings{}), check.Equals, 8)
+	c.Assert(maxAttempts(config.Settings{WebhookMaxAttempts: 3}), check.Equals, 3)
+}